@@ -0,0 +1,75 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles exporting the rounds in progress for diagnostics
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// ActiveRound is a round in progress and its state. The network is empty for
+// rounds of the default network.
+type ActiveRound struct {
+	ID      id.Round
+	State   string
+	Network string `json:",omitempty"`
+}
+
+// GetActiveRounds returns the rounds in progress, between precomputing and
+// completed, with their states. Rounds are listed by network, starting with the
+// default network, and ordered by round ID within each. Rounds that finish
+// while they are listed are left out.
+func (m *RegistrationImpl) GetActiveRounds() []ActiveRound {
+	var rounds []ActiveRound
+	for _, state := range m.getNetworkStates() {
+		tracker := m.getRoundTracker(state)
+		if tracker == nil {
+			continue
+		}
+
+		for _, rid := range tracker.GetActiveRounds() {
+			r, exists := state.GetRoundMap().GetRound(rid)
+			if !exists {
+				continue
+			}
+			rounds = append(rounds, ActiveRound{
+				ID:      rid,
+				State:   r.GetRoundState().String(),
+				Network: state.GetNetwork(),
+			})
+		}
+	}
+
+	return rounds
+}
+
+// ExportActiveRounds returns a JSON list of the rounds in progress and their
+// states on behalf of an administrator. Returns an error if the sender is not
+// an authenticated administrator.
+// Served over HTTP at activeRoundsPath.
+func (m *RegistrationImpl) ExportActiveRounds(auth *connect.Auth) ([]byte,
+	error) {
+	if err := m.checkAdminAuth(auth, "export active rounds"); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(m.GetActiveRounds())
+	if err != nil {
+		return nil, errors.Errorf("Failed to marshal active rounds: %+v", err)
+	}
+
+	jww.INFO.Printf("Active rounds have been exported by %s",
+		auth.Sender.GetId())
+
+	return data, nil
+}
@@ -0,0 +1,126 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/json"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/elixxir/registration/storage/round"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that ExportActiveRounds() lists every started round with its state,
+// ordered by ID, and stops listing each round once it completes.
+func TestRegistrationImpl_ExportActiveRounds(t *testing.T) {
+	impl, auth := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+	impl.roundTracker = scheduling.NewRoundTracker()
+
+	// Start rounds out of order in different states
+	roundStates := map[id.Round]states.Round{
+		7: states.REALTIME, 3: states.PRECOMPUTING, 5: states.STANDBY}
+	rounds := make(map[id.Round]*round.State)
+	for rid, state := range roundStates {
+		rounds[rid] = round.NewState_Testing(rid, state, nil, t)
+		impl.State.GetRoundMap().AddRound_Testing(rounds[rid], t)
+		impl.roundTracker.AddActiveRound(rid)
+	}
+
+	exportActive := func() []ActiveRound {
+		data, err := impl.ExportActiveRounds(auth)
+		if err != nil {
+			t.Fatalf("ExportActiveRounds() returned an error: %+v", err)
+		}
+		var active []ActiveRound
+		if err = json.Unmarshal(data, &active); err != nil {
+			t.Fatalf("Failed to unmarshal active rounds: %+v", err)
+		}
+		return active
+	}
+
+	expected := []ActiveRound{
+		{ID: 3, State: states.PRECOMPUTING.String()},
+		{ID: 5, State: states.STANDBY.String()},
+		{ID: 7, State: states.REALTIME.String()},
+	}
+	for len(expected) > 0 {
+		if active := exportActive(); !reflect.DeepEqual(expected, active) {
+			t.Errorf("Unexpected active rounds.\n\texpected: %+v"+
+				"\n\treceived: %+v", expected, active)
+		}
+
+		// Complete the round that has been running the longest
+		r := rounds[expected[0].ID]
+		if err := r.Update(states.COMPLETED, time.Now()); err != nil {
+			t.Fatalf("Failed to complete round %d: %+v", expected[0].ID, err)
+		}
+		impl.roundTracker.RemoveActiveRound(expected[0].ID)
+		expected = expected[1:]
+	}
+
+	if active := exportActive(); len(active) != 0 {
+		t.Errorf("Completed rounds still listed as active: %+v", active)
+	}
+}
+
+// Error path: Tests that ExportActiveRounds() rejects senders that are not
+// administrators.
+func TestRegistrationImpl_ExportActiveRounds_NotAdmin(t *testing.T) {
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+	impl.roundTracker = scheduling.NewRoundTracker()
+
+	userHost, err := connect.NewHost(id.NewIdFromString("user", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+
+	_, err = impl.ExportActiveRounds(
+		&connect.Auth{IsAuthenticated: true, Sender: userHost})
+	if err == nil {
+		t.Error("ExportActiveRounds() did not return an error for a sender " +
+			"that is not an administrator.")
+	}
+}
+
+// Tests that GetActiveRounds() lists the rounds of every network, starting
+// with the default network, each tracked by its own network's RoundTracker.
+func TestRegistrationImpl_GetActiveRounds_Networks(t *testing.T) {
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+	impl.roundTracker = scheduling.NewRoundTracker()
+	err := impl.addNetworks([]networkParams{{Name: "testnet"}},
+		getTestKey(), 8, region.GetCountryBins(), &ndf.NetworkDefinition{})
+	if err != nil {
+		t.Fatalf("Failed to add network: %+v", err)
+	}
+
+	// Both networks run a round with the same ID
+	for _, state := range impl.getNetworkStates() {
+		r := round.NewState_Testing(1, states.REALTIME, nil, t)
+		state.GetRoundMap().AddRound_Testing(r, t)
+		impl.getRoundTracker(state).AddActiveRound(1)
+	}
+
+	expected := []ActiveRound{
+		{ID: 1, State: states.REALTIME.String()},
+		{ID: 1, State: states.REALTIME.String(), Network: "testnet"},
+	}
+	if active := impl.GetActiveRounds(); !reflect.DeepEqual(expected, active) {
+		t.Errorf("Unexpected active rounds.\n\texpected: %+v"+
+			"\n\treceived: %+v", expected, active)
+	}
+}
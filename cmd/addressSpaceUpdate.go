@@ -11,7 +11,9 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/netTime"
 	"sort"
 	"time"
 )
@@ -64,23 +66,70 @@ func (m *RegistrationImpl) updateAddressSpace(latest ndf.AddressSpace,
 				"address space size list from storage: %+v", err)
 		}
 
-		m.State.SetAddressSpaceSize(uint32(latest.Size))
+		jww.INFO.Printf("Address space size update found in database; "+
+			"scheduled state address space size %d to take effect at %s and "+
+			"updating the NDF with changes (length of list %d).", latest.Size,
+			latest.Timestamp, len(addressSpaces))
 
-		jww.INFO.Printf("Address space size update found in database; set "+
-			"state address space size to %d and updating the NDF with "+
-			"changes (length of list %d).", latest.Size, len(addressSpaces))
+		// Update the state and NDF of each network
+		for _, state := range m.getNetworkStates() {
+			state.SetAddressSpaceSchedule(addressSpaces)
 
-		// Update the NDF
-		m.State.InternalNdfLock.Lock()
-		updateNDF := m.State.GetUnprunedNdf()
-		updateNDF.AddressSpace = addressSpaces
-		m.State.UpdateInternalNdf(updateNDF)
-		m.State.InternalNdfLock.Unlock()
+			state.InternalNdfLock.Lock()
+			updateNDF := state.GetUnprunedNdf()
+			updateNDF.AddressSpace = addressSpaces
+			state.UpdateInternalNdf(updateNDF)
+			state.InternalNdfLock.Unlock()
+		}
 	}
 
 	return latest, nil
 }
 
+// ScheduleAddressSpaceSize schedules the address space size to change to the
+// given size at the given time on behalf of an administrator. The change is
+// stored and picked up by the address space size tracker, which adds it to the
+// NDF so that the network can prepare for it. Rounds created once the change
+// takes effect use the new size. The size must be larger than, and the time
+// after, the latest scheduled size. Returns an error if the sender is not an
+// authenticated administrator.
+// Served over HTTP at addressSpacePath.
+func (m *RegistrationImpl) ScheduleAddressSpaceSize(size uint8,
+	timestamp time.Time, auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "schedule address space sizes"); err != nil {
+		return err
+	}
+
+	if !timestamp.After(netTime.Now()) {
+		return errors.Errorf("Address space size change must be scheduled "+
+			"in the future; %s has passed", timestamp)
+	}
+
+	latest, err := storage.PermissioningDb.GetLatestEphemeralLength()
+	if err != nil {
+		return errors.Errorf("Failed to get latest address space size from "+
+			"storage: %+v", err)
+	} else if size <= latest.Length {
+		return errors.Errorf("Address space size %d must be larger than the "+
+			"latest address space size %d", size, latest.Length)
+	} else if !timestamp.After(latest.Timestamp) {
+		return errors.Errorf("Address space size change must be scheduled "+
+			"after the latest change at %s", latest.Timestamp)
+	}
+
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: size, Timestamp: timestamp})
+	if err != nil {
+		return errors.Errorf("Failed to store address space size %d: %+v",
+			size, err)
+	}
+
+	jww.INFO.Printf("Address space size %d has been scheduled for %s by %s",
+		size, timestamp, auth.Sender.GetId())
+
+	return nil
+}
+
 // GetAddressSpaceSizesFromStorage returns a list of sorted address spaces and
 // the newest addresses space from storage. An error is returned if no ephemeral
 // ID lengths are found in storage.
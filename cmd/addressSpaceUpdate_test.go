@@ -9,7 +9,10 @@ package cmd
 
 import (
 	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/netTime"
 	"gitlab.com/xx_network/primitives/region"
 	"reflect"
 	"testing"
@@ -73,9 +76,11 @@ func TestRegistrationImpl_updateAddressSpace(t *testing.T) {
 			"\nexpected: %+v\nreceived: %+v", latest, testLatest)
 	}
 
-	if m.State.GetAddressSpaceSize() != uint32(latest.Size) {
+	// Only the first address space has taken effect; the rest are scheduled
+	// for the future
+	if m.State.GetAddressSpaceSize() != uint32(addressSpaces[0].Size) {
 		t.Errorf("updateAddressSpace() did not set the correct state addres space size."+
-			"\nexpected: %d\nreceived: %d", latest.Size, m.State.GetAddressSpaceSize())
+			"\nexpected: %d\nreceived: %d", addressSpaces[0].Size, m.State.GetAddressSpaceSize())
 	}
 }
 
@@ -154,6 +159,103 @@ func TestRegistrationImpl_updateAddressSpace_NoStorage(t *testing.T) {
 	}
 }
 
+// Tests that ScheduleAddressSpaceSize() stores the scheduled size and that the
+// state only switches to it once its time is reached after the tracker picks
+// it up.
+func TestRegistrationImpl_ScheduleAddressSpaceSize(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+
+	initial := ndf.AddressSpace{Size: 8, Timestamp: netTime.Now().Add(-time.Hour)}
+	err := storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: initial.Size, Timestamp: initial.Timestamp})
+	if err != nil {
+		t.Fatalf("Failed to insert ephemeral length: %+v", err)
+	}
+	latest, err := impl.updateAddressSpace(ndf.AddressSpace{},
+		storage.PermissioningDb)
+	if err != nil {
+		t.Fatalf("updateAddressSpace() returned an error: %+v", err)
+	}
+
+	changeTime := netTime.Now().Add(250 * time.Millisecond)
+	err = impl.ScheduleAddressSpaceSize(16, changeTime, auth)
+	if err != nil {
+		t.Fatalf("ScheduleAddressSpaceSize() returned an error: %+v", err)
+	}
+
+	_, err = impl.updateAddressSpace(latest, storage.PermissioningDb)
+	if err != nil {
+		t.Fatalf("updateAddressSpace() returned an error: %+v", err)
+	}
+	if len(impl.State.GetUnprunedNdf().AddressSpace) != 2 {
+		t.Errorf("Scheduled address space size not added to the NDF: %+v",
+			impl.State.GetUnprunedNdf().AddressSpace)
+	}
+
+	// The current size remains active until the change time
+	if size := impl.State.GetAddressSpaceSize(); size != uint32(initial.Size) {
+		t.Errorf("Address space size changed before the scheduled time."+
+			"\n\texpected: %d\n\treceived: %d", initial.Size, size)
+	}
+
+	time.Sleep(time.Until(changeTime) + 50*time.Millisecond)
+	if size := impl.State.GetAddressSpaceSize(); size != 16 {
+		t.Errorf("Address space size did not change at the scheduled time."+
+			"\n\texpected: %d\n\treceived: %d", 16, size)
+	}
+}
+
+// Error path: Tests that ScheduleAddressSpaceSize() rejects senders that are
+// not administrators, times that have passed, and sizes or times that do not
+// come after the latest scheduled size.
+func TestRegistrationImpl_ScheduleAddressSpaceSize_Invalid(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+
+	latest := &storage.EphemeralLength{
+		Length: 8, Timestamp: netTime.Now().Add(time.Hour)}
+	err := storage.PermissioningDb.InsertEphemeralLength(latest)
+	if err != nil {
+		t.Fatalf("Failed to insert ephemeral length: %+v", err)
+	}
+
+	userHost, err := connect.NewHost(id.NewIdFromString("user", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+	userAuth := &connect.Auth{IsAuthenticated: true, Sender: userHost}
+
+	tests := []struct {
+		name      string
+		size      uint8
+		timestamp time.Time
+		auth      *connect.Auth
+	}{
+		{"not admin", 16, netTime.Now().Add(2 * time.Hour), userAuth},
+		{"passed", 16, netTime.Now().Add(-time.Minute), auth},
+		{"smaller", 8, netTime.Now().Add(2 * time.Hour), auth},
+		{"before latest", 16, netTime.Now().Add(time.Minute), auth},
+	}
+
+	for _, tt := range tests {
+		err = impl.ScheduleAddressSpaceSize(tt.size, tt.timestamp, tt.auth)
+		if err == nil {
+			t.Errorf("ScheduleAddressSpaceSize() did not return an error "+
+				"for %q.", tt.name)
+		}
+	}
+
+	ephLens, err := storage.PermissioningDb.GetEphemeralLengths()
+	if err != nil {
+		t.Fatalf("Failed to get ephemeral lengths: %+v", err)
+	}
+	if len(ephLens) != 1 {
+		t.Errorf("Rejected address space sizes were stored: %+v", ephLens)
+	}
+}
+
 // Happy path.
 func Test_GetAddressSpaceSizesFromStorage(t *testing.T) {
 	// Create list of address spaces to add to storage
@@ -0,0 +1,57 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles rejecting replayed administrator queries
+
+package cmd
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"sync"
+	"time"
+)
+
+// adminReplayTracker remembers the signed digests of the administrator queries
+// accepted from each sender until their timestamps leave adminRequestWindow,
+// so that a captured query cannot be replayed while its timestamp is still
+// accepted.
+type adminReplayTracker struct {
+	seen map[id.ID]map[string]time.Time
+	mux  sync.Mutex
+}
+
+// newAdminReplayTracker creates an empty adminReplayTracker.
+func newAdminReplayTracker() *adminReplayTracker {
+	return &adminReplayTracker{seen: make(map[id.ID]map[string]time.Time)}
+}
+
+// add records the digest of a query from the sender that is accepted until
+// the expiry. Returns false if the digest was already recorded for the sender
+// and has not expired by now. Expired digests of the sender are forgotten.
+func (t *adminReplayTracker) add(sender *id.ID, digest []byte, expiry,
+	now time.Time) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	digests, exists := t.seen[*sender]
+	if !exists {
+		digests = make(map[string]time.Time)
+		t.seen[*sender] = digests
+	}
+
+	for d, e := range digests {
+		if !now.Before(e) {
+			delete(digests, d)
+		}
+	}
+
+	if _, exists = digests[string(digest)]; exists {
+		return false
+	}
+	digests[string(digest)] = expiry
+	return true
+}
@@ -0,0 +1,47 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+	"time"
+)
+
+// Tests that adminReplayTracker.add() rejects a digest already recorded for
+// the sender until it expires, while accepting it from another sender.
+func TestAdminReplayTracker_add(t *testing.T) {
+	tracker := newAdminReplayTracker()
+	sender := id.NewIdFromString("admin", id.User, t)
+	other := id.NewIdFromString("other", id.User, t)
+	digest := []byte("digest")
+	now := time.Now()
+	expiry := now.Add(adminRequestWindow)
+
+	if !tracker.add(sender, digest, expiry, now) {
+		t.Errorf("First query rejected.")
+	}
+	if tracker.add(sender, digest, expiry, now.Add(time.Second)) {
+		t.Errorf("Replayed query accepted.")
+	}
+	if !tracker.add(other, digest, expiry, now) {
+		t.Errorf("Query from another sender rejected.")
+	}
+	if !tracker.add(sender, []byte("other"), expiry, now) {
+		t.Errorf("Other query from the sender rejected.")
+	}
+
+	// Once expired, the digest is forgotten
+	if !tracker.add(sender, digest, expiry.Add(adminRequestWindow), expiry) {
+		t.Errorf("Query rejected after the recorded one expired.")
+	}
+	if len(tracker.seen[*sender]) != 1 {
+		t.Errorf("Expired digests were not forgotten."+
+			"\n\texpected: %d\n\treceived: %d", 1, len(tracker.seen[*sender]))
+	}
+}
@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles administrators banning nodes from the network
+
+package cmd
+
+import (
+	"encoding/base64"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// BanNode immediately bans the node from the network on behalf of an
+// administrator. The ban and its reason are stored, the node is pruned from
+// the NDF, and the scheduler is notified so that the node is removed from the
+// waiting pool and any round it is in is killed with a signed error giving the
+// reason. Returns an error if the sender is not an authenticated
+// administrator. Served over HTTP at banNodePath.
+func (m *RegistrationImpl) BanNode(nid *id.ID, reason string,
+	auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "ban nodes"); err != nil {
+		return err
+	}
+
+	state := m.getNodeNetworkState(nid)
+	if state == nil {
+		return errors.Errorf("Node %s could not be found in internal state "+
+			"tracker", nid)
+	}
+	n := state.GetNodeMap().GetNode(nid)
+	if n.IsBanned() {
+		return errors.Errorf("Node %s has already been banned", nid)
+	}
+
+	// Store the ban first so that it persists across restarts
+	err := storage.PermissioningDb.BanNode(nid, reason, time.Now())
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to store ban of node %s", nid)
+	}
+
+	// Remove the node from the NDF on the next update
+	state.SetPrunedNode(nid)
+
+	// Take the polling lock so that no polls are processed until the
+	// scheduler has handled the update; it is released by the scheduler
+	n.GetPollingLock().Lock()
+
+	nun, err := n.Ban()
+	if err != nil {
+		n.GetPollingLock().Unlock()
+		return errors.WithMessage(err, "Could not ban node")
+	}
+	nun.Reason = reason
+
+	// Send the node's update notification to the scheduler
+	err = state.SendUpdateNotification(nun)
+	if err != nil {
+		n.GetPollingLock().Unlock()
+		return errors.WithMessage(err, "Could not send update notification")
+	}
+
+	jww.INFO.Printf("Node %s has been banned by %s: %s", nid,
+		auth.Sender.GetId(), reason)
+
+	return nil
+}
+
+// checkAdminAuth returns an error if the sender is not an authenticated
+// administrator. The action is described in the error.
+func (m *RegistrationImpl) checkAdminAuth(auth *connect.Auth,
+	action string) error {
+	if auth == nil || auth.Sender == nil {
+		return connect.AuthError(nil)
+	} else if !auth.IsAuthenticated {
+		return connect.AuthError(auth.Sender.GetId())
+	} else if !m.isAdmin(auth.Sender.GetId()) {
+		return errors.Errorf("%s is not an administrator and cannot %s",
+			auth.Sender.GetId(), action)
+	}
+	return nil
+}
+
+// isAdmin returns true if the ID is one of the configured administrators.
+func (m *RegistrationImpl) isAdmin(sender *id.ID) bool {
+	if m.params == nil {
+		return false
+	}
+	for _, admin := range m.params.adminIds {
+		if admin.Cmp(sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAdminIds decodes the base64 encoded administrator IDs.
+func parseAdminIds(encodedIds []string) ([]*id.ID, error) {
+	adminIds := make([]*id.ID, 0, len(encodedIds))
+	for _, encoded := range encodedIds {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Errorf("Failed to decode admin ID %q: %+v",
+				encoded, err)
+		}
+		adminId, err := id.Unmarshal(data)
+		if err != nil {
+			return nil, errors.Errorf("Failed to unmarshal admin ID %q: %+v",
+				encoded, err)
+		}
+		adminIds = append(adminIds, adminId)
+	}
+	return adminIds, nil
+}
@@ -0,0 +1,182 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/base64"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"testing"
+)
+
+// newBanTestImpl creates a RegistrationImpl with a single active node and the
+// admin configured, returning an authenticated Auth for the admin.
+func newBanTestImpl(nid, adminId *id.ID, t *testing.T) (
+	*RegistrationImpl, *connect.Auth) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	impl := &RegistrationImpl{
+		State:  testState,
+		params: &Params{adminIds: []*id.ID{adminId}},
+	}
+
+	err = storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: 10},
+		&storage.Node{Code: "AAAA", Id: nid.Bytes(), Status: uint8(node.Active),
+			ApplicationId: 10})
+	if err != nil {
+		t.Fatalf("Failed to insert node: %+v", err)
+	}
+	err = testState.GetNodeMap().AddNode(nid, "", "", "", 10)
+	if err != nil {
+		t.Fatalf("Failed to add node to state: %+v", err)
+	}
+
+	adminHost, err := connect.NewHost(adminId, "0.0.0.0:1234",
+		make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create admin host: %+v", err)
+	}
+
+	return impl, &connect.Auth{IsAuthenticated: true, Sender: adminHost}
+}
+
+// Tests that BanNode() stores the ban and its reason, prunes the node, and
+// notifies the scheduler with the reason.
+func TestRegistrationImpl_BanNode(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+	reason := "Node is serving invalid rounds"
+
+	err := impl.BanNode(nid, reason, auth)
+	if err != nil {
+		t.Fatalf("BanNode() returned an error: %+v", err)
+	}
+
+	nodes, err := storage.PermissioningDb.GetNodesByStatus(node.Banned)
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Banned node not stored: %v %+v", nodes, err)
+	}
+	if nodes[0].BanReason != reason {
+		t.Errorf("Unexpected stored ban reason."+
+			"\n\texpected: %s\n\treceived: %s", reason, nodes[0].BanReason)
+	}
+
+	if !impl.State.IsPruned(nid) {
+		t.Errorf("Banned node %s not pruned.", nid)
+	}
+
+	select {
+	case nun := <-impl.State.GetNodeUpdateChannel():
+		if !nun.Node.Cmp(nid) || nun.ToStatus != node.Banned ||
+			nun.Reason != reason {
+			t.Errorf("Unexpected update notification: %+v", nun)
+		}
+	default:
+		t.Errorf("No update notification sent to the scheduler.")
+	}
+
+	// Banning again fails
+	err = impl.BanNode(nid, reason, auth)
+	if err == nil {
+		t.Errorf("Expected error banning an already banned node.")
+	}
+}
+
+// Error path: Tests that BanNode() rejects callers that are not authenticated
+// administrators and leaves the node untouched.
+func TestRegistrationImpl_BanNode_Unauthorized(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	otherHost, err := connect.NewHost(id.NewIdFromString("other", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+
+	unauthorized := []*connect.Auth{
+		nil,
+		{IsAuthenticated: false, Sender: auth.Sender},
+		{IsAuthenticated: true, Sender: otherHost},
+	}
+	for i, a := range unauthorized {
+		if err = impl.BanNode(nid, "reason", a); err == nil {
+			t.Errorf("Did not receive an error for unauthorized caller %d.", i)
+		}
+	}
+
+	if impl.State.GetNodeMap().GetNode(nid).IsBanned() {
+		t.Errorf("Node banned by an unauthorized caller.")
+	}
+	select {
+	case nun := <-impl.State.GetNodeUpdateChannel():
+		t.Errorf("Update notification sent for unauthorized ban: %+v", nun)
+	default:
+	}
+}
+
+// Error path: the node is not in the state map.
+func TestRegistrationImpl_BanNode_UnknownNode(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	err := impl.BanNode(id.NewIdFromString("unknown", id.Node, t), "", auth)
+	if err == nil {
+		t.Errorf("Expected error banning an unknown node.")
+	}
+}
+
+// Tests that parseAdminIds() decodes base64 encoded IDs and rejects invalid
+// ones.
+func Test_parseAdminIds(t *testing.T) {
+	expected := []*id.ID{
+		id.NewIdFromString("admin1", id.User, t),
+		id.NewIdFromString("admin2", id.User, t),
+	}
+	encoded := make([]string, len(expected))
+	for i, adminId := range expected {
+		encoded[i] = base64.StdEncoding.EncodeToString(adminId.Bytes())
+	}
+
+	adminIds, err := parseAdminIds(encoded)
+	if err != nil {
+		t.Fatalf("parseAdminIds() returned an error: %+v", err)
+	}
+	if len(adminIds) != len(expected) {
+		t.Fatalf("Unexpected number of IDs.\n\texpected: %d\n\treceived: %d",
+			len(expected), len(adminIds))
+	}
+	for i := range expected {
+		if !expected[i].Cmp(adminIds[i]) {
+			t.Errorf("Unexpected ID %d.\n\texpected: %s\n\treceived: %s",
+				i, expected[i], adminIds[i])
+		}
+	}
+
+	for _, invalid := range []string{"not base64!", "AAAA"} {
+		if _, err = parseAdminIds([]string{invalid}); err == nil {
+			t.Errorf("Did not receive an error for invalid ID %q.", invalid)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles revoking the certificates nodes registered with
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/crypto/tls"
+	"gitlab.com/xx_network/primitives/id"
+	"sync"
+	"time"
+)
+
+// revokedNodeCerts tracks the nodes whose registered certificate has been
+// revoked, so that polls do not need to check storage.
+type revokedNodeCerts struct {
+	nodes map[id.ID]struct{}
+	mux   sync.RWMutex
+}
+
+// newRevokedNodeCerts creates a revokedNodeCerts containing the nodes of the
+// revoked certificates.
+func newRevokedNodeCerts(revoked []*storage.RevokedCertificate) (
+	*revokedNodeCerts, error) {
+	r := &revokedNodeCerts{nodes: make(map[id.ID]struct{}, len(revoked))}
+	for _, cert := range revoked {
+		nid, err := id.Unmarshal(cert.NodeId)
+		if err != nil {
+			return nil, errors.Errorf("Failed to unmarshal node ID of "+
+				"revoked certificate %s of %s: %+v", cert.Serial, cert.Issuer,
+				err)
+		}
+		r.nodes[*nid] = struct{}{}
+	}
+	return r, nil
+}
+
+// add marks the certificate of the node as revoked.
+func (r *revokedNodeCerts) add(nid *id.ID) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.nodes[*nid] = struct{}{}
+}
+
+// isRevoked returns true if the certificate of the node has been revoked.
+func (r *revokedNodeCerts) isRevoked(nid *id.ID) bool {
+	if r == nil {
+		return false
+	}
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	_, exists := r.nodes[*nid]
+	return exists
+}
+
+// RevokeNodeCert revokes the certificate the node registered with. The issuer
+// and serial number of the certificate are stored so that the revocation
+// persists across restarts, and the node's polls are rejected from then on. If
+// prune is set, the node is also removed from the NDF on the next update.
+func (m *RegistrationImpl) RevokeNodeCert(nid *id.ID, prune bool) error {
+	if m.revokedCerts.isRevoked(nid) {
+		return errors.Errorf("Certificate of node %s has already been "+
+			"revoked", nid)
+	}
+
+	dbNode, err := storage.PermissioningDb.GetNodeById(nid)
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to get node %s", nid)
+	}
+	cert, err := tls.LoadCertificate(dbNode.NodeCertificate)
+	if err != nil {
+		return errors.Errorf("Failed to load certificate of node %s: %+v",
+			nid, err)
+	}
+
+	// Store the revocation first so that it persists across restarts
+	err = storage.PermissioningDb.InsertRevokedCertificate(
+		&storage.RevokedCertificate{
+			Issuer:    cert.Issuer.String(),
+			Serial:    cert.SerialNumber.String(),
+			NodeId:    nid.Marshal(),
+			Timestamp: time.Now(),
+		})
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to store revocation of "+
+			"certificate of node %s", nid)
+	}
+	m.revokedCerts.add(nid)
+
+	if prune {
+		if state := m.getNodeNetworkState(nid); state != nil {
+			state.SetPrunedNode(nid)
+		}
+	}
+
+	jww.INFO.Printf("Certificate %s of %s registered by node %s has been "+
+		"revoked", cert.SerialNumber, cert.Issuer, nid)
+
+	return nil
+}
+
+// checkNodeCert returns an error if the certificate the node registered with
+// has been revoked.
+func (m *RegistrationImpl) checkNodeCert(nid *id.ID) error {
+	if m.revokedCerts.isRevoked(nid) {
+		return errors.Errorf("Certificate of node %s has been revoked", nid)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/elixxir/registration/testkeys"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// insertTestNodeCert stores a registered node with a certificate for the key
+// of the test node.
+func insertTestNodeCert(nid *id.ID, appId uint64, t *testing.T) {
+	cert := newTestCert(loadTestNodeKey(t), "node",
+		time.Now().Add(-time.Hour), time.Now().Add(time.Hour), t)
+	err := storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: appId},
+		&storage.Node{Code: "AAAA", Id: nid.Bytes(), NodeCertificate: cert,
+			Status: uint8(node.Active), ApplicationId: appId})
+	if err != nil {
+		t.Fatalf("Failed to insert node: %+v", err)
+	}
+}
+
+// Tests that RevokeNodeCert() stores the revocation of the node's certificate,
+// prunes the node, and rejects revoking the certificate again.
+func TestRegistrationImpl_RevokeNodeCert(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	revoked, err := newRevokedNodeCerts(nil)
+	if err != nil {
+		t.Fatalf("Failed to create revoked node certs: %+v", err)
+	}
+	impl := &RegistrationImpl{State: testState, revokedCerts: revoked}
+
+	nid := id.NewIdFromString("test", id.Node, t)
+	insertTestNodeCert(nid, 10, t)
+	err = testState.GetNodeMap().AddNode(nid, "", "", "", 10)
+	if err != nil {
+		t.Fatalf("Failed to add node to state: %+v", err)
+	}
+
+	if err = impl.checkNodeCert(nid); err != nil {
+		t.Errorf("Certificate rejected before it was revoked: %+v", err)
+	}
+
+	err = impl.RevokeNodeCert(nid, true)
+	if err != nil {
+		t.Fatalf("RevokeNodeCert() returned an error: %+v", err)
+	}
+
+	if err = impl.checkNodeCert(nid); err == nil {
+		t.Errorf("Revoked certificate of node %s not rejected.", nid)
+	}
+	if !testState.IsPruned(nid) {
+		t.Errorf("Node %s with a revoked certificate not pruned.", nid)
+	}
+
+	// The revocation is stored, so that it is loaded on restart
+	stored, err := storage.PermissioningDb.GetRevokedCertificates()
+	if err != nil {
+		t.Fatalf("Failed to get revoked certificates: %+v", err)
+	}
+	if len(stored) != 1 || stored[0].Serial != "1" ||
+		stored[0].Issuer != "CN=node" {
+		t.Errorf("Unexpected revoked certificates stored: %+v", stored)
+	}
+	loaded, err := newRevokedNodeCerts(stored)
+	if err != nil {
+		t.Fatalf("Failed to load revoked node certs: %+v", err)
+	}
+	if !loaded.isRevoked(nid) {
+		t.Errorf("Node %s not revoked after loading from storage.", nid)
+	}
+
+	// Revoking again fails
+	err = impl.RevokeNodeCert(nid, true)
+	if err == nil {
+		t.Errorf("Expected error revoking an already revoked certificate.")
+	}
+}
+
+// Error path: the node is not registered.
+func TestRegistrationImpl_RevokeNodeCert_UnknownNode(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	revoked, err := newRevokedNodeCerts(nil)
+	if err != nil {
+		t.Fatalf("Failed to create revoked node certs: %+v", err)
+	}
+	impl := &RegistrationImpl{revokedCerts: revoked}
+
+	err = impl.RevokeNodeCert(id.NewIdFromString("test", id.Node, t), false)
+	if err == nil {
+		t.Errorf("Expected error revoking the certificate of an unknown " +
+			"node.")
+	}
+}
+
+// Tests that Poll() rejects a node once its certificate has been revoked.
+func TestRegistrationImpl_Poll_RevokedCert(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	testID := id.NewIdFromUInt(0, id.Node, t)
+	testString := "test"
+	testParams.KeyPath = testkeys.GetCAKeyPath()
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Fatalf("Unable to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+	atomic.CompareAndSwapUint32(impl.NdfReady, 0, 1)
+	impl.params.disablePing = true
+
+	impl.State.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "420"},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()},
+		},
+		Nodes: []ndf.Node{{ID: testID.Bytes()}},
+	})
+	err = impl.State.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update ndf: %+v", err)
+	}
+
+	testHost, _ := impl.Comms.AddHost(testID, testString,
+		make([]byte, 0), connect.GetDefaultHostParams())
+	testAuth := &connect.Auth{
+		IsAuthenticated: true,
+		Sender:          testHost,
+	}
+
+	insertTestNodeCert(testID, 10, t)
+	err = impl.State.GetNodeMap().AddNode(testID, "", "", "", 10)
+	if err != nil {
+		t.Fatalf("Could not add node: %+v", err)
+	}
+	impl.State.GetNodeMap().GetNode(testID).SetConnectivity(
+		node.PortSuccessful)
+
+	testMsg := &pb.PermissioningPoll{
+		Full:           &pb.NDFHash{Hash: []byte(testString)},
+		Partial:        &pb.NDFHash{Hash: []byte(testString)},
+		Activity:       uint32(current.NOT_STARTED),
+		GatewayVersion: "1.1.0",
+		ServerVersion:  "1.1.0",
+	}
+
+	_, err = impl.Poll(testMsg, testAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error polling before revocation: %+v", err)
+	}
+
+	err = impl.RevokeNodeCert(testID, false)
+	if err != nil {
+		t.Fatalf("RevokeNodeCert() returned an error: %+v", err)
+	}
+
+	_, err = impl.Poll(testMsg, testAuth)
+	if err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("Poll() did not reject the node with a revoked "+
+			"certificate: %+v", err)
+	}
+}
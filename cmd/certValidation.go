@@ -0,0 +1,61 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles validating the certificates submitted by registering nodes
+
+package cmd
+
+import (
+	gorsa "crypto/rsa"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/crypto/tls"
+	"time"
+)
+
+// minCertRSABitLen is the smallest RSA key, in bits, accepted in a node or
+// gateway certificate. It matches the minimum recommended by the RSA signature
+// package for production use.
+const minCertRSABitLen = 3072
+
+// loadRegistrationCert decodes the PEM encoded certificate submitted by a
+// registering node or gateway and checks that it is fit to be used on the
+// network: its key must be an RSA key of at least minCertRSABitLen bits, it
+// must be valid at the given time, and its subject must have a common name.
+// The name of the certificate's owner is used in errors.
+func loadRegistrationCert(certPEM, owner string, now time.Time) (
+	*x509.Certificate, error) {
+	cert, err := tls.LoadCertificate(certPEM)
+	if err != nil {
+		return nil, errors.Errorf("Could not decode %s certificate into a "+
+			"tls cert: %v", owner, err)
+	}
+
+	pubKey, ok := cert.PublicKey.(*gorsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("%s certificate has a %T public key, "+
+			"expected an RSA key", owner, cert.PublicKey)
+	} else if bits := pubKey.N.BitLen(); bits < minCertRSABitLen {
+		return nil, errors.Errorf("%s certificate has a %d-bit RSA key, "+
+			"must be at least %d bits", owner, bits, minCertRSABitLen)
+	}
+
+	if now.Before(cert.NotBefore) {
+		return nil, errors.Errorf("%s certificate is not valid until %s",
+			owner, cert.NotBefore)
+	} else if now.After(cert.NotAfter) {
+		return nil, errors.Errorf("%s certificate expired at %s",
+			owner, cert.NotAfter)
+	}
+
+	if cert.Subject.CommonName == "" {
+		return nil, errors.Errorf("%s certificate subject %q has no "+
+			"common name", owner, cert.Subject)
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,149 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"crypto/rand"
+	gorsa "crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/testkeys"
+	"gitlab.com/xx_network/crypto/tls"
+	"gitlab.com/xx_network/primitives/utils"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a PEM encoded certificate for the key that is valid
+// between notBefore and notAfter and has the given common name.
+func newTestCert(key *gorsa.PrivateKey, commonName string, notBefore,
+	notAfter time.Time, t *testing.T) string {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// loadTestNodeKey loads the node's private key from testkeys.
+func loadTestNodeKey(t *testing.T) *gorsa.PrivateKey {
+	keyBytes, err := utils.ReadFile(testkeys.GetNodeKeyPath())
+	if err != nil {
+		t.Fatalf("Failed to read node key: %+v", err)
+	}
+	key, err := tls.LoadRSAPrivateKey(string(keyBytes))
+	if err != nil {
+		t.Fatalf("Failed to load node key: %+v", err)
+	}
+	return key
+}
+
+// Happy path: Tests that loadRegistrationCert() accepts the test node cert.
+func Test_loadRegistrationCert(t *testing.T) {
+	certBytes, err := utils.ReadFile(testkeys.GetNodeCertPath())
+	if err != nil {
+		t.Fatalf("Failed to read node cert: %+v", err)
+	}
+
+	cert, err := loadRegistrationCert(string(certBytes), "server", time.Now())
+	if err != nil {
+		t.Fatalf("loadRegistrationCert() returned an error: %+v", err)
+	}
+	if cert.Subject.CommonName != "cmix.rip" {
+		t.Errorf("Unexpected certificate loaded: %s", cert.Subject)
+	}
+}
+
+// Error path: Tests that loadRegistrationCert() rejects certificates that are
+// expired, not yet valid, missing a common name, or not PEM encoded.
+func Test_loadRegistrationCert_Invalid(t *testing.T) {
+	key := loadTestNodeKey(t)
+	now := time.Now()
+
+	tests := map[string]struct {
+		cert        string
+		expectedErr string
+	}{
+		"expired": {newTestCert(key, "cmix.rip", now.Add(-48*time.Hour),
+			now.Add(-24*time.Hour), t), "expired"},
+		"not yet valid": {newTestCert(key, "cmix.rip", now.Add(time.Hour),
+			now.Add(48*time.Hour), t), "not valid until"},
+		"no common name": {newTestCert(key, "", now.Add(-time.Hour),
+			now.Add(time.Hour), t), "no common name"},
+		"not PEM": {"not a certificate", "Could not decode"},
+	}
+
+	for name, tt := range tests {
+		_, err := loadRegistrationCert(tt.cert, "gateway", now)
+		if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+			t.Errorf("Unexpected error for %s certificate."+
+				"\n\texpected: %s\n\treceived: %+v", name, tt.expectedErr, err)
+		}
+	}
+}
+
+// Error path: Tests that loadRegistrationCert() rejects a certificate with an
+// RSA key smaller than minCertRSABitLen.
+func Test_loadRegistrationCert_UndersizedKey(t *testing.T) {
+	key, err := gorsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	now := time.Now()
+	cert := newTestCert(key, "cmix.rip", now.Add(-time.Hour),
+		now.Add(time.Hour), t)
+
+	_, err = loadRegistrationCert(cert, "server", now)
+	if err == nil || !strings.Contains(err.Error(), "1024-bit RSA key") {
+		t.Errorf("Unexpected error for an undersized key: %+v", err)
+	}
+}
+
+// Error path: Tests that prepareNodeRegistration() rejects a registration with
+// an expired gateway certificate.
+func Test_prepareNodeRegistration_ExpiredGatewayCert(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: 1}, &storage.Node{Code: "AAAA"})
+	if err != nil {
+		t.Fatalf("Failed to insert application: %+v", err)
+	}
+
+	nodeCert, err := utils.ReadFile(testkeys.GetNodeCertPath())
+	if err != nil {
+		t.Fatalf("Failed to read node cert: %+v", err)
+	}
+	now := time.Now()
+	req := NodeRegistrationRequest{
+		Salt:          []byte("salt"),
+		ServerTlsCert: string(nodeCert),
+		GatewayTlsCert: newTestCert(loadTestNodeKey(t), "gateway.cmix.rip",
+			now.Add(-48*time.Hour), now.Add(-24*time.Hour), t),
+		RegistrationCode: "AAAA",
+	}
+
+	_, _, err = prepareNodeRegistration(req, req.RegistrationCode)
+	if err == nil || !strings.Contains(err.Error(), "gateway certificate expired") {
+		t.Errorf("Unexpected error for an expired gateway certificate: %+v", err)
+	}
+}
@@ -0,0 +1,66 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles permanently removing nodes from the network
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// DecommissionNode permanently removes the node from the network. The node's
+// status and decommission time are stored, it is pruned from the NDF, and the
+// scheduler is notified so that it is never scheduled again. Unlike a ban, the
+// node is not treated as malicious: if its current round has reached realtime,
+// the round is allowed to finish, otherwise the round is killed.
+func (m *RegistrationImpl) DecommissionNode(nid *id.ID) error {
+	state := m.getNodeNetworkState(nid)
+	if state == nil {
+		return errors.Errorf("Node %s could not be found in internal state "+
+			"tracker", nid)
+	}
+	n := state.GetNodeMap().GetNode(nid)
+	if n.IsDecommissioned() {
+		return errors.Errorf("Node %s has already been decommissioned", nid)
+	}
+
+	// Store the decommission first so that it persists across restarts
+	err := storage.PermissioningDb.DecommissionNode(nid, time.Now())
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to store decommission of "+
+			"node %s", nid)
+	}
+
+	// Remove the node from the NDF on the next update
+	state.SetPrunedNode(nid)
+
+	// Take the polling lock so that no polls are processed until the
+	// scheduler has handled the update; it is released by the scheduler
+	n.GetPollingLock().Lock()
+
+	nun, err := n.Decommission()
+	if err != nil {
+		n.GetPollingLock().Unlock()
+		return errors.WithMessage(err, "Could not decommission node")
+	}
+
+	// Send the node's update notification to the scheduler
+	err = state.SendUpdateNotification(nun)
+	if err != nil {
+		n.GetPollingLock().Unlock()
+		return errors.WithMessage(err, "Could not send update notification")
+	}
+
+	jww.INFO.Printf("Node %s has been decommissioned", nid)
+
+	return nil
+}
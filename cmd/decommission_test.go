@@ -0,0 +1,96 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"testing"
+)
+
+// Tests that DecommissionNode() stores the decommission, prunes the node, and
+// notifies the scheduler.
+func TestRegistrationImpl_DecommissionNode(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	impl := &RegistrationImpl{State: testState}
+
+	nid := id.NewIdFromString("test", id.Node, t)
+	err = storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: 10},
+		&storage.Node{Code: "AAAA", Id: nid.Bytes(), Status: uint8(node.Active),
+			ApplicationId: 10})
+	if err != nil {
+		t.Fatalf("Failed to insert node: %+v", err)
+	}
+	err = testState.GetNodeMap().AddNode(nid, "", "", "", 10)
+	if err != nil {
+		t.Fatalf("Failed to add node to state: %+v", err)
+	}
+
+	err = impl.DecommissionNode(nid)
+	if err != nil {
+		t.Fatalf("DecommissionNode() returned an error: %+v", err)
+	}
+
+	nodes, err := storage.PermissioningDb.GetNodesByStatus(node.Decommissioned)
+	if err != nil || len(nodes) != 1 {
+		t.Errorf("Decommissioned node not stored: %v %+v", nodes, err)
+	}
+
+	if !testState.IsPruned(nid) {
+		t.Errorf("Decommissioned node %s not pruned.", nid)
+	}
+
+	select {
+	case nun := <-testState.GetNodeUpdateChannel():
+		if !nun.Node.Cmp(nid) || nun.ToStatus != node.Decommissioned {
+			t.Errorf("Unexpected update notification: %+v", nun)
+		}
+	default:
+		t.Errorf("No update notification sent to the scheduler.")
+	}
+
+	// Decommissioning again fails
+	err = impl.DecommissionNode(nid)
+	if err == nil {
+		t.Errorf("Expected error decommissioning an already decommissioned node.")
+	}
+}
+
+// Error path: the node is not in the state map.
+func TestRegistrationImpl_DecommissionNode_UnknownNode(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	impl := &RegistrationImpl{State: testState}
+
+	err = impl.DecommissionNode(id.NewIdFromString("test", id.Node, t))
+	if err == nil {
+		t.Errorf("Expected error decommissioning an unknown node.")
+	}
+}
@@ -0,0 +1,51 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles administrators draining the network for maintenance
+
+package cmd
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/comms/connect"
+)
+
+// Drain stops new rounds from being scheduled on every network on behalf of an
+// administrator, while rounds already in progress run to completion. Nodes
+// keep polling and joining the waiting pool, and rounds are scheduled from it
+// again once Resume is called. Returns an error if the sender is not an
+// authenticated administrator. Served over HTTP at drainPath.
+func (m *RegistrationImpl) Drain(auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "drain the network"); err != nil {
+		return err
+	}
+
+	for _, state := range m.getNetworkStates() {
+		if state.Drain() {
+			jww.WARN.Printf("Network %q is draining on behalf of %s",
+				state.GetNetwork(), auth.Sender.GetId())
+		}
+	}
+	return nil
+}
+
+// Resume allows new rounds to be scheduled on every network after Drain on
+// behalf of an administrator. Returns an error if the sender is not an
+// authenticated administrator. Served over HTTP at resumePath.
+func (m *RegistrationImpl) Resume(auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "resume the network"); err != nil {
+		return err
+	}
+
+	for _, state := range m.getNetworkStates() {
+		if state.Resume() {
+			jww.INFO.Printf("Network %q has resumed on behalf of %s",
+				state.GetNetwork(), auth.Sender.GetId())
+		}
+	}
+	return nil
+}
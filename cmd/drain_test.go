@@ -0,0 +1,84 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+)
+
+// Tests that Drain() and Resume() stop and restart round scheduling on the
+// network for an administrator.
+func TestRegistrationImpl_Drain(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	err := impl.Drain(auth)
+	if err != nil {
+		t.Fatalf("Drain() returned an error: %+v", err)
+	}
+	if !impl.State.IsDraining() {
+		t.Errorf("Network is not draining after Drain().")
+	}
+
+	// Draining again has no effect
+	err = impl.Drain(auth)
+	if err != nil || !impl.State.IsDraining() {
+		t.Errorf("Draining a drained network failed: %+v", err)
+	}
+
+	err = impl.Resume(auth)
+	if err != nil {
+		t.Fatalf("Resume() returned an error: %+v", err)
+	}
+	if impl.State.IsDraining() {
+		t.Errorf("Network is draining after Resume().")
+	}
+}
+
+// Error path: Tests that Drain() and Resume() reject callers that are not
+// authenticated administrators.
+func TestRegistrationImpl_Drain_Unauthorized(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	otherHost, err := connect.NewHost(id.NewIdFromString("other", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+
+	unauthorized := []*connect.Auth{
+		nil,
+		{IsAuthenticated: false, Sender: auth.Sender},
+		{IsAuthenticated: true, Sender: otherHost},
+	}
+	for i, a := range unauthorized {
+		if err = impl.Drain(a); err == nil {
+			t.Errorf("Expected error draining with auth %d.", i)
+		}
+		if impl.State.IsDraining() {
+			t.Errorf("Network drained with auth %d.", i)
+		}
+	}
+
+	if err = impl.Drain(auth); err != nil {
+		t.Fatalf("Drain() returned an error: %+v", err)
+	}
+	for i, a := range unauthorized {
+		if err = impl.Resume(a); err == nil {
+			t.Errorf("Expected error resuming with auth %d.", i)
+		}
+		if !impl.State.IsDraining() {
+			t.Errorf("Network resumed with auth %d.", i)
+		}
+	}
+}
@@ -10,7 +10,9 @@ package cmd
 import (
 	"fmt"
 	"gitlab.com/xx_network/primitives/region"
+	"math"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"github.com/oschwald/geoip2-golang"
@@ -30,8 +32,27 @@ const (
 	setDbSequenceErr  = "failed to set bin of node %s to %s"
 	invalidFlagsErr   = "no GeoIP2 database provided and randomGeoBinning is " +
 		"not set"
+	parseGpsErr = "failed to parse GPS location %q"
 )
 
+// geoBinCentroids are the approximate latitude and longitude of the center of
+// each geographic bin. They are used to find the bin of a node whose country
+// has no bin.
+var geoBinCentroids = map[region.GeoBin][2]float64{
+	region.NorthAmerica:           {45.0, -100.0},
+	region.SouthAndCentralAmerica: {-15.0, -60.0},
+	region.WesternEurope:          {46.0, 2.0},
+	region.CentralEurope:          {50.0, 15.0},
+	region.EasternEurope:          {49.0, 30.0},
+	region.MiddleEast:             {29.0, 45.0},
+	region.NorthernAfrica:         {20.0, 10.0},
+	region.SouthernAfrica:         {-15.0, 25.0},
+	region.Russia:                 {60.0, 90.0},
+	region.EasternAsia:            {35.0, 115.0},
+	region.WesternAsia:            {30.0, 70.0},
+	region.Oceania:                {-25.0, 135.0},
+}
+
 func (m *RegistrationImpl) setNodeGeos(n *node.State, location, geo_bin, gps_location string) error {
 
 	return storage.PermissioningDb.UpdateGeoIP(n.GetAppID(), location, geo_bin, gps_location)
@@ -43,9 +64,10 @@ func (m *RegistrationImpl) setNodeSequence(n *node.State, nodeIpAddr string) err
 	var geobin region.GeoBin
 	var err error
 	var ok bool
-	// Get country code for node
+	// Get country code for node, which is the region of a structured sequence
+	sequence := n.GetSequence()
 	if m.params.disableGeoBinning {
-		countryCode = n.GetOrdering()
+		countryCode = sequence.Region
 	} else {
 		countryCode, err = getAddressCountry(nodeIpAddr, m.geoIPDB, &m.geoIPDBStatus)
 		if err != nil {
@@ -61,7 +83,15 @@ func (m *RegistrationImpl) setNodeSequence(n *node.State, nodeIpAddr string) err
 		}
 		geobin, ok = region.GetCountryBin(countryCode)
 		if !ok {
-			return errors.WithMessage(err, "Could not get bin for country code")
+			// Fall back to the bin nearest to the node's coordinates
+			geobin, err = getGpsGeoBin(gps)
+			if err != nil {
+				return errors.WithMessagef(err, "Could not get bin for "+
+					"country code %q", countryCode)
+			}
+			jww.WARN.Printf("No geographic bin found for country code %q of "+
+				"node %s, using bin %s of GPS location %q", countryCode,
+				n.GetID(), geobin, gps)
 		}
 		countryName, err = lookupCountryName(nodeIpAddr, m.geoIPDB)
 		if err != nil {
@@ -69,10 +99,12 @@ func (m *RegistrationImpl) setNodeSequence(n *node.State, nodeIpAddr string) err
 		}
 	}
 
-	// Update sequence for the node in the database
-	err = storage.PermissioningDb.UpdateNodeSequence(n.GetID(), countryCode)
+	// Update sequence for the node in the database, keeping the shard and
+	// index of a structured sequence
+	sequence.Region = countryCode
+	err = storage.PermissioningDb.UpdateNodeSequence(n.GetID(), sequence.String())
 	if err != nil {
-		return errors.Errorf(setDbSequenceErr, n.GetID(), countryCode)
+		return errors.Errorf(setDbSequenceErr, n.GetID(), sequence)
 	}
 
 	// Generate the location string (exclude city if none is found)
@@ -85,10 +117,104 @@ func (m *RegistrationImpl) setNodeSequence(n *node.State, nodeIpAddr string) err
 		n.GetAppID(), location, geobin.String(), gps)
 
 	// Set the state ordering
-	n.SetOrdering(countryCode)
+	n.SetOrdering(sequence.String())
+	m.setNodeGeoBin(n)
 	return nil
 }
 
+// setNodeGeoBin caches the geographic bin the region of the node's ordering
+// maps to on its state. If the region is not a known country, the bin stored
+// for the node's application is used instead. If that also fails, the bin is set to
+// node.UnknownGeoBin.
+func (m *RegistrationImpl) setNodeGeoBin(n *node.State) {
+	geoBin, exists := m.State.GetGeoBins()[n.GetSequence().Region]
+	if !exists {
+		var err error
+		geoBin, err = getStoredGeoBin(n.GetAppID())
+		if err != nil {
+			jww.WARN.Printf("No geographic bin found for node %s with "+
+				"ordering %q: %+v", n.GetID(), n.GetOrdering(), err)
+			geoBin = node.UnknownGeoBin
+		}
+	}
+	n.SetGeoBin(geoBin)
+}
+
+// getStoredGeoBin returns the geographic bin stored for the application. If no
+// valid bin is stored, the bin nearest to the stored GPS location is used and
+// stored so that future lookups do not need to compute it.
+func getStoredGeoBin(appId uint64) (region.GeoBin, error) {
+	app, err := storage.PermissioningDb.GetApplication(appId)
+	if err != nil {
+		return node.UnknownGeoBin, err
+	}
+
+	geoBin, err := region.GetRegion(app.GeoBin)
+	if err == nil {
+		return geoBin, nil
+	}
+
+	geoBin, err = getGpsGeoBin(app.GpsLocation)
+	if err != nil {
+		return node.UnknownGeoBin, err
+	}
+
+	err = storage.PermissioningDb.UpdateGeoIP(
+		appId, app.Location, geoBin.String(), app.GpsLocation)
+	if err != nil {
+		jww.ERROR.Printf("Failed to store bin %s of application %d: %+v",
+			geoBin, appId, err)
+	}
+
+	return geoBin, nil
+}
+
+// getGpsGeoBin returns the geographic bin with the centroid nearest to the GPS
+// location, which is in the format returned by getAddressCoords.
+func getGpsGeoBin(gps string) (region.GeoBin, error) {
+	coords := strings.Split(gps, ",")
+	if len(coords) != 2 {
+		return node.UnknownGeoBin, errors.Errorf(parseGpsErr, gps)
+	}
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+	if err != nil {
+		return node.UnknownGeoBin, errors.Errorf(parseGpsErr, gps)
+	}
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+	if err != nil {
+		return node.UnknownGeoBin, errors.Errorf(parseGpsErr, gps)
+	}
+
+	return getNearestGeoBin(latitude, longitude), nil
+}
+
+// getNearestGeoBin returns the geographic bin with the centroid nearest to the
+// latitude and longitude.
+func getNearestGeoBin(latitude, longitude float64) region.GeoBin {
+	nearest, minDistance := node.UnknownGeoBin, math.Inf(1)
+	for geoBin, centroid := range geoBinCentroids {
+		distance := greatCircleDistance(
+			latitude, longitude, centroid[0], centroid[1])
+		if distance < minDistance ||
+			(distance == minDistance && geoBin < nearest) {
+			nearest, minDistance = geoBin, distance
+		}
+	}
+
+	return nearest
+}
+
+// greatCircleDistance returns the central angle, in radians, between two
+// points given in degrees using the haversine formula.
+func greatCircleDistance(lat1, long1, lat2, long2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLong := (long2 - long1) * toRad
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Pow(math.Sin(dLong/2), 2)
+	return 2 * math.Asin(math.Sqrt(a))
+}
+
 // getAddressCountry returns an alpha-2 country code for the address. Panics if
 // randomGeoBinning is not set or a geoip2.Reader is not provided.
 func getAddressCountry(ipAddr string, geoIPDB *geoip2.Reader, geoipStatus *geoipStatus) (string, error) {
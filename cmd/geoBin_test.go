@@ -12,6 +12,7 @@ import (
 	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
 	"math/rand"
 	"testing"
 )
@@ -52,8 +53,13 @@ func TestRegistrationImpl_setNodeBin_GeoIP2DB(t *testing.T) {
 		t.Fatalf("Failed to register a node: %+v", err)
 	}
 
-	// Make a new state map and add the node to it
-	stateMap := node.NewStateMap()
+	// Make a new state and add the node to its state map
+	impl.State, err = storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	stateMap := impl.State.GetNodeMap()
 	err = stateMap.AddNode(testID, "", "202.196.224.6:2400", "", 0)
 	if err != nil {
 		t.Fatalf("Failed to add a node to the state map: %+v", err)
@@ -81,6 +87,12 @@ func TestRegistrationImpl_setNodeBin_GeoIP2DB(t *testing.T) {
 		t.Errorf("setNodeSequence failed to set the state ordering to the expected bin."+
 			"\nexpected: %s\nreceived: %s", "PH", ordering)
 	}
+
+	expectedBin := region.GetCountryBins()["PH"]
+	if geoBin := stateMap.GetNode(testID).GetGeoBin(); geoBin != expectedBin {
+		t.Errorf("setNodeSequence failed to cache the expected geographic bin."+
+			"\nexpected: %s\nreceived: %s", expectedBin, geoBin)
+	}
 }
 
 // Panic path: test that RegistrationImpl.setNodeSequence panics when neither a
@@ -95,3 +107,132 @@ func TestRegistrationImpl_setNodeBin_NoFlags(t *testing.T) {
 	impl := &RegistrationImpl{}
 	_ = impl.setNodeSequence(&node.State{}, "")
 }
+
+// Tests that RegistrationImpl.setNodeGeoBin caches the bin of a known country
+// and node.UnknownGeoBin for an unknown one.
+func TestRegistrationImpl_setNodeGeoBin(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	impl := &RegistrationImpl{params: &Params{}}
+	impl.State, err = storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	testID := id.NewIdFromUInt(0, id.Node, t)
+	err = impl.State.GetNodeMap().AddNode(testID, "US", "", "", 0)
+	if err != nil {
+		t.Fatalf("Failed to add a node to the state map: %+v", err)
+	}
+	n := impl.State.GetNodeMap().GetNode(testID)
+
+	impl.setNodeGeoBin(n)
+	if n.GetGeoBin() != region.NorthAmerica {
+		t.Errorf("setNodeGeoBin failed to set the expected bin."+
+			"\nexpected: %s\nreceived: %s", region.NorthAmerica, n.GetGeoBin())
+	}
+
+	n.SetOrdering("not a country")
+	impl.setNodeGeoBin(n)
+	if n.GetGeoBin() != node.UnknownGeoBin {
+		t.Errorf("setNodeGeoBin failed to set the unknown bin."+
+			"\nexpected: %s\nreceived: %s", node.UnknownGeoBin, n.GetGeoBin())
+	}
+}
+
+// Tests that RegistrationImpl.setNodeGeoBin falls back to the bin nearest to
+// the node's stored GPS location when its ordering has no bin and stores the
+// computed bin.
+func TestRegistrationImpl_setNodeGeoBin_GpsFallback(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	impl := &RegistrationImpl{params: &Params{}}
+	impl.State, err = storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	// Application located in Sydney with no stored bin
+	applicationId := uint64(10)
+	err = storage.PermissioningDb.InsertApplication(&storage.Application{
+		Id:          applicationId,
+		Location:    "Sydney, Australia",
+		GpsLocation: "-33.868820, 151.209296",
+	}, &storage.Node{Code: "AAAA"})
+	if err != nil {
+		t.Fatalf("Failed to insert application: %+v", err)
+	}
+
+	testID := id.NewIdFromUInt(0, id.Node, t)
+	err = impl.State.GetNodeMap().AddNode(
+		testID, "not a country", "", "", applicationId)
+	if err != nil {
+		t.Fatalf("Failed to add a node to the state map: %+v", err)
+	}
+	n := impl.State.GetNodeMap().GetNode(testID)
+
+	impl.setNodeGeoBin(n)
+	if n.GetGeoBin() != region.Oceania {
+		t.Errorf("setNodeGeoBin failed to set the bin of the GPS location."+
+			"\nexpected: %s\nreceived: %s", region.Oceania, n.GetGeoBin())
+	}
+
+	app, err := storage.PermissioningDb.GetApplication(applicationId)
+	if err != nil {
+		t.Fatalf("Failed to get application: %+v", err)
+	}
+	if app.GeoBin != region.Oceania.String() {
+		t.Errorf("setNodeGeoBin failed to store the bin of the GPS location."+
+			"\nexpected: %s\nreceived: %s", region.Oceania, app.GeoBin)
+	}
+	if app.Location != "Sydney, Australia" {
+		t.Errorf("setNodeGeoBin modified the stored location: %q", app.Location)
+	}
+}
+
+// Tests that getGpsGeoBin returns the bin nearest to each GPS location.
+func Test_getGpsGeoBin(t *testing.T) {
+	testValues := map[string]region.GeoBin{
+		"40.712776, -74.005974":  region.NorthAmerica,
+		"-23.550520, -46.633308": region.SouthAndCentralAmerica,
+		"48.856613, 2.352222":    region.WesternEurope,
+		"52.520008, 13.404954":   region.CentralEurope,
+		"50.450100, 30.523400":   region.EasternEurope,
+		"24.713552, 46.675297":   region.MiddleEast,
+		"-26.204103, 28.047305":  region.SouthernAfrica,
+		"55.008354, 82.935730":   region.Russia,
+		"39.904202, 116.407394":  region.EasternAsia,
+		"28.704060, 77.102493":   region.WesternAsia,
+		"-33.868820, 151.209296": region.Oceania,
+	}
+
+	for gps, expected := range testValues {
+		geoBin, err := getGpsGeoBin(gps)
+		if err != nil {
+			t.Errorf("getGpsGeoBin returned an error for %q: %+v", gps, err)
+		} else if geoBin != expected {
+			t.Errorf("getGpsGeoBin returned the wrong bin for %q."+
+				"\nexpected: %s\nreceived: %s", gps, expected, geoBin)
+		}
+	}
+}
+
+// Error path: tests that getGpsGeoBin returns an error for invalid locations.
+func Test_getGpsGeoBin_ParseError(t *testing.T) {
+	for _, gps := range []string{"", "1.0", "a, 1.0", "1.0, b", "1, 2, 3"} {
+		_, err := getGpsGeoBin(gps)
+		if err == nil {
+			t.Errorf("getGpsGeoBin did not return an error for %q", gps)
+		}
+	}
+}
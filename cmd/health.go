@@ -0,0 +1,131 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles reporting the health of the permissioning server
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// healthDbTimeout is the maximum amount of time the database probe of a
+// health check may take before the database is reported as unreachable.
+const healthDbTimeout = 2 * time.Second
+
+// healthPath is the HTTP path the health report is served on.
+const healthPath = "/health"
+
+// Health reports whether the permissioning server is operational.
+type Health struct {
+	// True once the NDF is ready to be sent out
+	NdfReady bool
+
+	// Number of rounds currently run by the schedulers of all networks
+	ActiveRounds int
+
+	// Number of nodes in all networks that have not been pruned from the NDF
+	ActiveNodes int
+
+	// True if the database responded to a probe within healthDbTimeout
+	DatabaseReachable bool
+
+	// Error returned by the database probe, if any
+	DatabaseError string `json:",omitempty"`
+
+	// How long the phases of the last output NDF update of the default
+	// network took, so that slow NDF generation can be spotted as the network
+	// grows
+	NdfGeneration storage.NdfGenerationTiming
+
+	// Number of node update notifications dropped because the schedulers
+	// could not keep up; the most recent are kept in each network state
+	DroppedUpdates uint64
+}
+
+// IsHealthy returns true if the NDF is ready and the database is reachable.
+func (h Health) IsHealthy() bool {
+	return h.NdfReady && h.DatabaseReachable
+}
+
+// Health returns the current health of the permissioning server.
+func (m *RegistrationImpl) Health() Health {
+	h := Health{
+		NdfReady:      atomic.LoadUint32(m.NdfReady) == 1,
+		NdfGeneration: m.State.GetNdfGenerationTiming(),
+	}
+
+	for _, state := range m.getNetworkStates() {
+		h.ActiveNodes += state.CountActiveNodes()
+		h.DroppedUpdates += state.GetDroppedUpdateCount()
+		if tracker := m.getRoundTracker(state); tracker != nil {
+			h.ActiveRounds += tracker.Len()
+		}
+	}
+
+	err := probeDatabase(healthDbTimeout)
+	if err != nil {
+		h.DatabaseError = err.Error()
+	} else {
+		h.DatabaseReachable = true
+	}
+
+	return h
+}
+
+// probeDatabase performs a cheap read of the database. Returns an error if the
+// read fails or does not complete within the timeout.
+func probeDatabase(timeout time.Duration) error {
+	// Buffered so the probe does not leak if it completes after the timeout
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := storage.PermissioningDb.GetStateValue(storage.RoundIdKey)
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		return errors.Errorf("database probe timed out after %s", timeout)
+	}
+}
+
+// ServeHTTP writes the health report as JSON. The status code is
+// http.StatusOK if the server is healthy and http.StatusServiceUnavailable
+// otherwise.
+func (h Health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !h.IsHealthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(h)
+	if err != nil {
+		jww.ERROR.Printf("Failed to write health report: %+v", err)
+	}
+}
+
+// StartHealthServer serves the health report over HTTP on the address so that
+// it can be scraped by monitoring, along with the queries that have no comms
+// message. Blocks until the server fails.
+func StartHealthServer(impl *RegistrationImpl, address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthPath, func(w http.ResponseWriter, r *http.Request) {
+		impl.Health().ServeHTTP(w, r)
+	})
+	impl.registerHttpHandlers(mux)
+
+	jww.INFO.Printf("Serving health report on %s%s", address, healthPath)
+	return http.ListenAndServe(address, mux)
+}
@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/json"
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Tests that RegistrationImpl.Health reports the NDF status, active rounds,
+// and database reachability.
+func TestRegistrationImpl_Health(t *testing.T) {
+	var err error
+	var closeDb func() error
+	storage.PermissioningDb, closeDb, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	ndfReady := uint32(0)
+	impl := &RegistrationImpl{
+		State:        testState,
+		NdfReady:     &ndfReady,
+		roundTracker: scheduling.NewRoundTracker(),
+	}
+
+	h := impl.Health()
+	if h.NdfReady || !h.DatabaseReachable || h.IsHealthy() {
+		t.Errorf("Unexpected health before the NDF is ready: %+v", h)
+	}
+
+	atomic.StoreUint32(impl.NdfReady, 1)
+	impl.roundTracker.AddActiveRound(1)
+	impl.roundTracker.AddActiveRound(2)
+
+	h = impl.Health()
+	if !h.NdfReady || !h.DatabaseReachable || !h.IsHealthy() {
+		t.Errorf("Unexpected health once the NDF is ready: %+v", h)
+	}
+	if h.ActiveRounds != 2 {
+		t.Errorf("Unexpected number of active rounds."+
+			"\n\texpected: %d\n\treceived: %d", 2, h.ActiveRounds)
+	}
+
+	// Dropped update notifications are reported
+	for i := 0; i < cap(testState.GetNodeUpdateChannel())+2; i++ {
+		_ = testState.SendUpdateNotification(node.UpdateNotification{
+			Node: id.NewIdFromUInt(uint64(i), id.Node, t)})
+	}
+	if h = impl.Health(); h.DroppedUpdates != 2 {
+		t.Errorf("Unexpected number of dropped updates."+
+			"\n\texpected: %d\n\treceived: %d", 2, h.DroppedUpdates)
+	}
+
+	// Closing the database makes it unreachable
+	if err = closeDb(); err != nil {
+		t.Fatalf("Failed to close database: %+v", err)
+	}
+	h = impl.Health()
+	if h.DatabaseReachable || h.DatabaseError == "" || h.IsHealthy() {
+		t.Errorf("Unexpected health with a closed database: %+v", h)
+	}
+}
+
+// Tests that Health.ServeHTTP writes the report as JSON with a status code
+// matching the health.
+func TestHealth_ServeHTTP(t *testing.T) {
+	testValues := []struct {
+		health Health
+		status int
+	}{
+		{Health{NdfReady: true, DatabaseReachable: true, ActiveNodes: 3}, http.StatusOK},
+		{Health{NdfReady: false, DatabaseReachable: true}, http.StatusServiceUnavailable},
+		{Health{NdfReady: true, DatabaseError: "error"}, http.StatusServiceUnavailable},
+	}
+
+	for i, val := range testValues {
+		w := httptest.NewRecorder()
+		val.health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, healthPath, nil))
+
+		if w.Code != val.status {
+			t.Errorf("Unexpected status code (%d).\n\texpected: %d\n\treceived: %d",
+				i, val.status, w.Code)
+		}
+
+		var received Health
+		if err := json.Unmarshal(w.Body.Bytes(), &received); err != nil {
+			t.Errorf("Failed to unmarshal health report (%d): %+v", i, err)
+		} else if received != val.health {
+			t.Errorf("Unexpected health report (%d).\n\texpected: %+v\n\treceived: %+v",
+				i, val.health, received)
+		}
+	}
+}
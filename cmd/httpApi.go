@@ -0,0 +1,559 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles serving queries that have no comms message over the HTTP server of
+// the health report
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTP paths of the queries served alongside the health report.
+const (
+	ndfDiffPath      = "/ndf/diff"
+	eccNdfPath       = "/ndf/ecc"
+	ellipticKeyPath  = "/ellipticKey"
+	banNodePath      = "/admin/ban"
+	drainPath        = "/admin/drain"
+	resumePath       = "/admin/resume"
+	nodeInfoPath     = "/admin/node"
+	addressSpacePath = "/admin/addressSpace"
+	nodeStatesPath   = "/admin/nodes"
+	schedulingPath   = "/admin/scheduling"
+	nodeAddressPath  = "/admin/addresses"
+	stuckNodesPath   = "/admin/stuck"
+	allowKeyPath     = "/admin/allowlist/add"
+	disallowKeyPath  = "/admin/allowlist/remove"
+	nodeRoundPath    = "/admin/nodeRound"
+	roundMetricsPath = "/admin/roundMetrics"
+	roundErrorsPath  = "/admin/roundErrors"
+	inactivePath     = "/admin/inactive"
+	activeRoundsPath = "/admin/rounds"
+)
+
+// Headers of an administrator query. The sender is the base64 encoded ID of
+// the administrator's host and the signature is made with its RSA key over the
+// digest returned by adminRequestDigest.
+const (
+	AdminSenderHeader    = "X-Admin-Sender"
+	AdminTimestampHeader = "X-Admin-Timestamp"
+	AdminSignatureHeader = "X-Admin-Signature"
+)
+
+// adminRequestWindow is how far the timestamp of an administrator query may be
+// from the server's clock. Queries outside of it are rejected so that a
+// captured query cannot be replayed later, and queries within it are rejected
+// if they were already accepted.
+const adminRequestWindow = time.Minute
+
+// maxAdminRequestSize is the maximum size of the body of an administrator
+// query.
+const maxAdminRequestSize = 1 << 20
+
+// adminHandler runs an administrator query on the body of the request on
+// behalf of the authenticated administrator. The returned value is written as
+// the JSON response; if it is nil, the response is empty.
+type adminHandler func(r *http.Request, body []byte, auth *connect.Auth) (
+	interface{}, error)
+
+// NdfDiffResponse is the response to an NDF diff query. Only one of Diff and
+// Ndf is set; both are nil if the caller's NDF is up-to-date.
+type NdfDiffResponse struct {
+	Diff *storage.NdfDiff `json:",omitempty"`
+	Ndf  *pb.NDF          `json:",omitempty"`
+}
+
+// registerHttpHandlers adds the handlers of the queries served over HTTP to
+// the mux.
+func (m *RegistrationImpl) registerHttpHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(ndfDiffPath, m.serveNdfDiff)
+	mux.HandleFunc(eccNdfPath, m.serveEccNdf)
+	mux.HandleFunc(ellipticKeyPath, m.serveEllipticKey)
+
+	mux.HandleFunc(banNodePath, m.serveAdmin(http.MethodPost, m.serveBanNode))
+	mux.HandleFunc(drainPath, m.serveAdmin(http.MethodPost,
+		func(_ *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			return nil, m.Drain(auth)
+		}))
+	mux.HandleFunc(resumePath, m.serveAdmin(http.MethodPost,
+		func(_ *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			return nil, m.Resume(auth)
+		}))
+	mux.HandleFunc(nodeInfoPath, m.serveAdmin(http.MethodGet,
+		func(r *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			nid, err := decodeIdParam(r)
+			if err != nil {
+				return nil, err
+			}
+			return m.GetNodeInfo(nid, auth)
+		}))
+	mux.HandleFunc(addressSpacePath, m.serveAdmin(http.MethodPost,
+		m.serveScheduleAddressSpaceSize))
+	mux.HandleFunc(nodeStatesPath, m.serveAdmin(http.MethodGet,
+		func(_ *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			data, err := m.ExportNodeStates(auth)
+			return json.RawMessage(data), err
+		}))
+	mux.HandleFunc(schedulingPath, m.serveAdmin(http.MethodGet,
+		func(_ *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			return m.GetSchedulingParams(auth)
+		}))
+	mux.HandleFunc(nodeAddressPath, m.serveAdmin(http.MethodPost,
+		m.serveBulkUpdateNodeAddresses))
+	mux.HandleFunc(stuckNodesPath, m.serveAdmin(http.MethodGet,
+		func(r *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			threshold, err := time.ParseDuration(
+				r.URL.Query().Get("threshold"))
+			if err != nil {
+				return nil, errors.Errorf("Failed to parse threshold: %+v", err)
+			}
+			data, err := m.ExportStuckNodes(auth, threshold)
+			return json.RawMessage(data), err
+		}))
+	mux.HandleFunc(allowKeyPath, m.serveAdmin(http.MethodPost,
+		func(_ *http.Request, body []byte, auth *connect.Auth) (interface{}, error) {
+			return nil, m.AllowNodeKey(string(body), auth)
+		}))
+	mux.HandleFunc(disallowKeyPath, m.serveAdmin(http.MethodPost,
+		func(_ *http.Request, body []byte, auth *connect.Auth) (interface{}, error) {
+			return nil, m.DisallowNodeKey(string(body), auth)
+		}))
+	mux.HandleFunc(nodeRoundPath, m.serveAdmin(http.MethodGet,
+		func(r *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			nid, err := decodeIdParam(r)
+			if err != nil {
+				return nil, err
+			}
+			rid, inRound, err := m.GetNodeRound(auth, nid)
+			if err != nil {
+				return nil, err
+			}
+			return NodeRoundResponse{Round: rid, InRound: inRound}, nil
+		}))
+	mux.HandleFunc(roundMetricsPath, m.serveAdmin(http.MethodGet,
+		func(r *http.Request, _ []byte, _ *connect.Auth) (interface{}, error) {
+			start, end, err := decodeTimeRangeParams(r)
+			if err != nil {
+				return nil, err
+			}
+			return m.GetRoundMetrics(start, end)
+		}))
+	mux.HandleFunc(roundErrorsPath, m.serveAdmin(http.MethodGet,
+		func(r *http.Request, _ []byte, _ *connect.Auth) (interface{}, error) {
+			start, end, err := decodeTimeRangeParams(r)
+			if err != nil {
+				return nil, err
+			}
+			counts, err := m.GetRoundErrorCounts(start, end)
+			if err != nil {
+				return nil, err
+			}
+
+			// Key the counts by the name of the category
+			named := make(map[string]uint64, len(counts))
+			for category, count := range counts {
+				named[category.String()] = count
+			}
+			return named, nil
+		}))
+	mux.HandleFunc(inactivePath, m.serveAdmin(http.MethodGet,
+		m.serveInactiveNodes))
+	mux.HandleFunc(activeRoundsPath, m.serveAdmin(http.MethodGet,
+		func(_ *http.Request, _ []byte, auth *connect.Auth) (interface{}, error) {
+			data, err := m.ExportActiveRounds(auth)
+			return json.RawMessage(data), err
+		}))
+}
+
+// serveNdfDiff writes the result of PollNdfDiff as JSON. The hash of the
+// caller's partial NDF is passed as the URL-safe base64 encoded "hash" query
+// parameter; an empty hash returns the full partial NDF.
+func (m *RegistrationImpl) serveNdfDiff(w http.ResponseWriter, r *http.Request) {
+	hash, err := decodeHashParam(r)
+	if err != nil {
+		writeHttpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	diff, fullNdf, err := m.PollNdfDiff(hash)
+	if err != nil {
+		writeHttpError(w, ndfErrorStatus(err), err)
+		return
+	}
+
+	writeJson(w, NdfDiffResponse{Diff: diff, Ndf: fullNdf})
+}
+
+// serveEccNdf writes the partial NDF signed with the elliptic curve key, as
+// returned by PollNdfBySignature, as JSON. The hash of the caller's partial NDF
+// is passed as the URL-safe base64 encoded "hash" query parameter; the NDF is
+// empty if the hash matches the current NDF.
+func (m *RegistrationImpl) serveEccNdf(w http.ResponseWriter, r *http.Request) {
+	hash, err := decodeHashParam(r)
+	if err != nil {
+		writeHttpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, eccNdf, err := m.PollNdfBySignature(hash, true)
+	if err != nil {
+		writeHttpError(w, ndfErrorStatus(err), err)
+		return
+	}
+
+	writeJson(w, eccNdf)
+}
+
+// serveEllipticKey writes the elliptic curve public key signed with the RSA
+// key, as returned by GetSignedEllipticPublicKey, as JSON.
+func (m *RegistrationImpl) serveEllipticKey(w http.ResponseWriter, _ *http.Request) {
+	signedKey, err := m.GetSignedEllipticPublicKey()
+	if err != nil {
+		writeHttpError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJson(w, signedKey)
+}
+
+// NodeRoundResponse is the response to a query for the round a node is in.
+// Round is only set if InRound is true.
+type NodeRoundResponse struct {
+	Round   id.Round
+	InRound bool
+}
+
+// BanNodeRequest is the body of a query to ban a node.
+type BanNodeRequest struct {
+	ID     *id.ID
+	Reason string
+}
+
+// serveBanNode bans the node in the BanNodeRequest body using BanNode.
+func (m *RegistrationImpl) serveBanNode(_ *http.Request, body []byte,
+	auth *connect.Auth) (interface{}, error) {
+	var request BanNodeRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errors.Errorf("Failed to unmarshal request: %+v", err)
+	} else if request.ID == nil {
+		return nil, errors.New("No node ID provided")
+	}
+
+	return nil, m.BanNode(request.ID, request.Reason, auth)
+}
+
+// AddressSpaceSizeRequest is the body of a query to schedule an address space
+// size change.
+type AddressSpaceSizeRequest struct {
+	Size      uint8
+	Timestamp time.Time
+}
+
+// serveScheduleAddressSpaceSize schedules the address space size change in the
+// AddressSpaceSizeRequest body using ScheduleAddressSpaceSize.
+func (m *RegistrationImpl) serveScheduleAddressSpaceSize(_ *http.Request,
+	body []byte, auth *connect.Auth) (interface{}, error) {
+	var request AddressSpaceSizeRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errors.Errorf("Failed to unmarshal request: %+v", err)
+	}
+
+	return nil, m.ScheduleAddressSpaceSize(request.Size, request.Timestamp,
+		auth)
+}
+
+// NodeAddressUpdate is an entry in the body of a query to update the addresses
+// of many nodes; the body is a list of them.
+type NodeAddressUpdate struct {
+	ID *id.ID
+	NodeAddresses
+}
+
+// serveBulkUpdateNodeAddresses updates the addresses of the nodes in the list
+// of NodeAddressUpdate in the body using BulkUpdateNodeAddresses.
+func (m *RegistrationImpl) serveBulkUpdateNodeAddresses(_ *http.Request,
+	body []byte, auth *connect.Auth) (interface{}, error) {
+	var request []NodeAddressUpdate
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errors.Errorf("Failed to unmarshal request: %+v", err)
+	}
+
+	updates := make(map[id.ID]NodeAddresses, len(request))
+	for _, update := range request {
+		if update.ID == nil {
+			return nil, errors.New("No node ID provided")
+		} else if _, exists := updates[*update.ID]; exists {
+			return nil, errors.Errorf("Node %s is listed more than once",
+				update.ID)
+		}
+		updates[*update.ID] = update.NodeAddresses
+	}
+
+	return nil, m.BulkUpdateNodeAddresses(updates, auth)
+}
+
+// InactiveNode is an entry in the response to a query for the nodes that have
+// not polled since a time.
+type InactiveNode struct {
+	Id            *id.ID
+	ServerAddress string
+	LastActive    time.Time
+}
+
+// serveInactiveNodes returns the nodes that have not polled since the RFC 3339
+// formatted "since" query parameter, as returned by GetNodesInactiveSince.
+// Only the ID, address, and last activity of each node is returned so that
+// registration codes and salts are not exposed.
+func (m *RegistrationImpl) serveInactiveNodes(r *http.Request, _ []byte,
+	_ *connect.Auth) (interface{}, error) {
+	cutoff, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		return nil, errors.Errorf("Failed to parse time: %+v", err)
+	}
+
+	nodes, err := m.GetNodesInactiveSince(cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	inactive := make([]InactiveNode, len(nodes))
+	for i, n := range nodes {
+		nid, err := id.Unmarshal(n.Id)
+		if err != nil {
+			return nil, errors.Errorf("Failed to unmarshal ID of node with "+
+				"code %s: %+v", n.Code, err)
+		}
+		inactive[i] = InactiveNode{
+			Id:            nid,
+			ServerAddress: n.ServerAddress,
+			LastActive:    n.LastActive,
+		}
+	}
+	return inactive, nil
+}
+
+// serveAdmin returns an HTTP handler that runs the administrator query for
+// requests with the method that are signed by an administrator. The response
+// is http.StatusForbidden if the sender cannot be authenticated as an
+// administrator and http.StatusBadRequest if the query fails.
+func (m *RegistrationImpl) serveAdmin(method string,
+	handle adminHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeHttpError(w, http.StatusMethodNotAllowed, errors.Errorf(
+				"%s requires method %s", r.URL.Path, method))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body,
+			maxAdminRequestSize))
+		if err != nil {
+			writeHttpError(w, http.StatusBadRequest,
+				errors.Errorf("Failed to read request: %+v", err))
+			return
+		}
+
+		auth := m.authenticateAdminRequest(r, body, time.Now())
+		err = m.checkAdminAuth(auth, "query "+r.URL.Path)
+		if err != nil {
+			writeHttpError(w, http.StatusForbidden, errors.WithMessage(err,
+				auth.Reason))
+			return
+		}
+
+		result, err := handle(r, body, auth)
+		if err != nil {
+			writeHttpError(w, http.StatusBadRequest, err)
+			return
+		} else if result == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJson(w, result)
+	}
+}
+
+// authenticateAdminRequest returns the Auth of the sender of the request. The
+// sender is authenticated if it is a known host, the request is signed with
+// the host's key within adminRequestWindow of now, and the same request has
+// not already been accepted from the sender. Whether the sender is an
+// administrator is checked separately by checkAdminAuth.
+func (m *RegistrationImpl) authenticateAdminRequest(r *http.Request,
+	body []byte, now time.Time) *connect.Auth {
+	auth := &connect.Auth{}
+	auth.IpAddress, _, _ = net.SplitHostPort(r.RemoteAddr)
+
+	senderBytes, err := base64.StdEncoding.DecodeString(
+		r.Header.Get(AdminSenderHeader))
+	if err != nil {
+		auth.Reason = "sender cannot be decoded"
+		return auth
+	}
+	sender, err := id.Unmarshal(senderBytes)
+	if err != nil {
+		auth.Reason = "sender cannot be unmarshalled"
+		return auth
+	}
+	host, exists := m.Comms.GetHost(sender)
+	if !exists {
+		auth.Reason = "sender is not a known host"
+		return auth
+	}
+	auth.Sender = host
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(AdminTimestampHeader),
+		10, 64)
+	if err != nil {
+		auth.Reason = "timestamp cannot be parsed"
+		return auth
+	}
+	if age := now.Sub(time.Unix(0, timestamp)); age > adminRequestWindow ||
+		age < -adminRequestWindow {
+		auth.Reason = "timestamp is outside of the accepted window"
+		return auth
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(
+		r.Header.Get(AdminSignatureHeader))
+	if err != nil {
+		auth.Reason = "signature cannot be decoded"
+		return auth
+	}
+	digest := adminRequestDigest(r.Method, r.URL.RequestURI(), timestamp, body)
+	err = rsa.Verify(host.GetPubKey(), crypto.SHA256, digest, sig, nil)
+	if err != nil {
+		auth.Reason = "signature is invalid"
+		return auth
+	}
+
+	expiry := time.Unix(0, timestamp).Add(adminRequestWindow)
+	if !m.adminRequests.add(sender, digest, expiry, now) {
+		auth.Reason = "request has already been received"
+		return auth
+	}
+
+	auth.IsAuthenticated = true
+	auth.Reason = "authenticated"
+	return auth
+}
+
+// SignAdminRequest sets the headers of an administrator query served over HTTP
+// that authenticate it as sent by the host with the ID and private key at the
+// timestamp. The body must be the body the request is sent with.
+func SignAdminRequest(r *http.Request, body []byte, sender *id.ID,
+	key *rsa.PrivateKey, timestamp time.Time) error {
+	ts := timestamp.UnixNano()
+	sig, err := rsa.Sign(rand.Reader, key, crypto.SHA256,
+		adminRequestDigest(r.Method, r.URL.RequestURI(), ts, body), nil)
+	if err != nil {
+		return errors.Errorf("Failed to sign request: %+v", err)
+	}
+
+	r.Header.Set(AdminSenderHeader, base64.StdEncoding.EncodeToString(
+		sender.Marshal()))
+	r.Header.Set(AdminTimestampHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(AdminSignatureHeader, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// adminRequestDigest returns the SHA-256 hash of the method, request URI,
+// timestamp in nanoseconds, and body of an administrator query, which is
+// signed by the sender.
+func adminRequestDigest(method, uri string, timestamp int64,
+	body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(method + "\n" + uri + "\n" +
+		strconv.FormatInt(timestamp, 10) + "\n"))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// decodeIdParam returns the node ID in the URL-safe base64 encoded "id" query
+// parameter of the request.
+func decodeIdParam(r *http.Request) (*id.ID, error) {
+	idBytes, err := base64.URLEncoding.DecodeString(r.URL.Query().Get("id"))
+	if err != nil {
+		return nil, errors.Errorf("Failed to decode node ID: %+v", err)
+	}
+	nid, err := id.Unmarshal(idBytes)
+	if err != nil {
+		return nil, errors.Errorf("Failed to unmarshal node ID: %+v", err)
+	}
+	return nid, nil
+}
+
+// decodeTimeRangeParams returns the times in the RFC 3339 formatted "start"
+// and "end" query parameters of the request.
+func decodeTimeRangeParams(r *http.Request) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+	if err != nil {
+		return time.Time{}, time.Time{},
+			errors.Errorf("Failed to parse start time: %+v", err)
+	}
+	end, err := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+	if err != nil {
+		return time.Time{}, time.Time{},
+			errors.Errorf("Failed to parse end time: %+v", err)
+	}
+	return start, end, nil
+}
+
+// decodeHashParam returns the NDF hash in the URL-safe base64 encoded "hash"
+// query parameter of the request.
+func decodeHashParam(r *http.Request) ([]byte, error) {
+	hash, err := base64.URLEncoding.DecodeString(r.URL.Query().Get("hash"))
+	if err != nil {
+		return nil, errors.Errorf("Failed to decode NDF hash: %+v", err)
+	}
+	return hash, nil
+}
+
+// ndfErrorStatus returns http.StatusServiceUnavailable if the error is
+// returned because the NDF is not ready yet and
+// http.StatusInternalServerError otherwise.
+func ndfErrorStatus(err error) int {
+	if err.Error() == ndf.NO_NDF {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJson writes the value as the JSON body of the response.
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		jww.ERROR.Printf("Failed to write HTTP response: %+v", err)
+	}
+}
+
+// writeHttpError writes the error as the plain text body of the response with
+// the status code.
+func writeHttpError(w http.ResponseWriter, status int, err error) {
+	jww.DEBUG.Printf("HTTP query failed with status %d: %+v", status, err)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,734 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"gitlab.com/elixxir/comms/registration"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/round"
+	"gitlab.com/elixxir/registration/testkeys"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/comms/signature"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"gitlab.com/xx_network/primitives/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tests that the NDF diff query serves the diff to a recent NDF, the full NDF
+// for an unknown hash, and an error while the NDF is not ready.
+func TestRegistrationImpl_serveNdfDiff(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	ndfReady := uint32(0)
+	impl := &RegistrationImpl{State: testState, NdfReady: &ndfReady}
+	mux := http.NewServeMux()
+	impl.registerHttpHandlers(mux)
+
+	query := func(hash []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ndfDiffPath+
+			"?hash="+base64.URLEncoding.EncodeToString(hash), nil))
+		return w
+	}
+
+	if w := query(nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status code before the NDF is ready."+
+			"\n\texpected: %d\n\treceived: %d",
+			http.StatusServiceUnavailable, w.Code)
+	}
+	atomic.StoreUint32(impl.NdfReady, 1)
+
+	testNdf := &ndf.NetworkDefinition{
+		Nodes:    []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	}
+	testState.UpdateInternalNdf(testNdf)
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+	oldHash := testState.GetPartialNdf().GetHash()
+
+	testNdf.Nodes = append(testNdf.Nodes,
+		ndf.Node{ID: id.NewIdFromUInt(1, id.Node, t).Bytes()})
+	testNdf.Gateways = append(testNdf.Gateways,
+		ndf.Gateway{ID: id.NewIdFromUInt(1, id.Gateway, t).Bytes()})
+	testState.UpdateInternalNdf(testNdf)
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+
+	// Recent hash returns a diff
+	w := query(oldHash)
+	var response NdfDiffResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if response.Diff == nil || response.Ndf != nil ||
+		len(response.Diff.AddedNodes) != 1 {
+		t.Errorf("Did not receive the expected diff: %+v", response)
+	}
+
+	// Unknown hash falls back to the full NDF
+	w = query([]byte("unknown"))
+	response = NdfDiffResponse{}
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if response.Diff != nil || response.Ndf == nil ||
+		string(response.Ndf.Ndf) != string(testState.GetPartialNdf().GetPb().Ndf) {
+		t.Errorf("Did not receive the full NDF: %+v", response)
+	}
+
+	// A malformed hash is rejected
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		ndfDiffPath+"?hash=%25%25", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code for a malformed hash."+
+			"\n\texpected: %d\n\treceived: %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// Tests that the EdDSA signed NDF query serves the partial NDF signed with the
+// elliptic curve key, and an empty NDF when the caller's NDF is current.
+func TestRegistrationImpl_serveEccNdf(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	ndfReady := uint32(1)
+	impl := &RegistrationImpl{State: testState, NdfReady: &ndfReady}
+	mux := http.NewServeMux()
+	impl.registerHttpHandlers(mux)
+
+	testState.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Nodes: []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	})
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+
+	query := func(hash []byte) storage.EccSignedNdf {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, eccNdfPath+
+			"?hash="+base64.URLEncoding.EncodeToString(hash), nil))
+		var eccNdf storage.EccSignedNdf
+		if err = json.Unmarshal(w.Body.Bytes(), &eccNdf); err != nil {
+			t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+		}
+		return eccNdf
+	}
+
+	expected := testState.GetPartialEccNdf()
+	eccNdf := query([]byte("outdated"))
+	if string(eccNdf.Ndf) != string(expected.Ndf) || eccNdf.EccSignature == nil ||
+		string(eccNdf.EccSignature.Signature) != string(expected.EccSignature.Signature) {
+		t.Errorf("Did not receive the EdDSA signed NDF."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, eccNdf)
+	}
+
+	eccNdf = query(testState.GetPartialNdf().GetHash())
+	if len(eccNdf.Ndf) != 0 || eccNdf.EccSignature != nil {
+		t.Errorf("Received an NDF for a current hash: %+v", eccNdf)
+	}
+}
+
+// Tests that the elliptic public key query serves the key with a valid
+// signature from the server's RSA key.
+func TestRegistrationImpl_serveEllipticKey(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	impl := &RegistrationImpl{State: testState}
+	mux := http.NewServeMux()
+	impl.registerHttpHandlers(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ellipticKeyPath, nil))
+	var signedKey storage.SignedEllipticKey
+	if err = json.Unmarshal(w.Body.Bytes(), &signedKey); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+
+	expected := testState.GetEllipticPublicKey().Marshal()
+	if !bytes.Equal(expected, signedKey.EllipticPubKey) {
+		t.Errorf("Received the wrong key.\n\texpected: %v\n\treceived: %v",
+			expected, signedKey.EllipticPubKey)
+	}
+
+	err = signature.VerifyRsa(&signedKey, testState.GetPrivateKey().GetPublic())
+	if err != nil {
+		t.Errorf("Failed to verify signature of elliptic public key: %+v", err)
+	}
+}
+
+// newAdminHttpTestImpl adds a host for the admin, using the test certificate,
+// to the comms of the RegistrationImpl and returns a mux serving its HTTP
+// queries and the admin's private key.
+func newAdminHttpTestImpl(impl *RegistrationImpl, adminId *id.ID,
+	t *testing.T) (*http.ServeMux, *rsa.PrivateKey) {
+	cert, err := utils.ReadFile(testkeys.GetCACertPath())
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %+v", err)
+	}
+
+	impl.Comms = &registration.Comms{ProtoComms: &connect.ProtoComms{
+		Manager: connect.NewManagerTesting(t)}}
+	impl.adminRequests = newAdminReplayTracker()
+	_, err = impl.Comms.AddHost(adminId, "0.0.0.0:1234", cert,
+		connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to add admin host: %+v", err)
+	}
+
+	mux := http.NewServeMux()
+	impl.registerHttpHandlers(mux)
+	return mux, getTestKey()
+}
+
+// sendAdminRequest sends the administrator query to the mux signed by the
+// sender with the key at the timestamp and returns the response.
+func sendAdminRequest(mux *http.ServeMux, method, path string, body []byte,
+	sender *id.ID, key *rsa.PrivateKey, timestamp time.Time,
+	t *testing.T) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if sender != nil {
+		err := SignAdminRequest(r, body, sender, key, timestamp)
+		if err != nil {
+			t.Fatalf("Failed to sign request: %+v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// Tests that administrator queries are only run when signed by an
+// administrator's host within the accepted window and not replayed, using
+// the ban query.
+func TestRegistrationImpl_serveAdmin(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	// A host that is not an administrator
+	otherId := id.NewIdFromString("other", id.User, t)
+	cert, _ := utils.ReadFile(testkeys.GetCACertPath())
+	_, err := impl.Comms.AddHost(otherId, "0.0.0.0:1234", cert,
+		connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to add host: %+v", err)
+	}
+
+	body, _ := json.Marshal(BanNodeRequest{ID: nid, Reason: "test"})
+	now := time.Now()
+
+	testValues := []struct {
+		name   string
+		method string
+		sender *id.ID
+		ts     time.Time
+		tamper bool
+		status int
+	}{
+		{"unsigned", http.MethodPost, nil, now, false, http.StatusForbidden},
+		{"not admin", http.MethodPost, otherId, now, false, http.StatusForbidden},
+		{"stale", http.MethodPost, adminId, now.Add(-2 * adminRequestWindow),
+			false, http.StatusForbidden},
+		{"tampered", http.MethodPost, adminId, now, true, http.StatusForbidden},
+		{"wrong method", http.MethodGet, adminId, now, false,
+			http.StatusMethodNotAllowed},
+	}
+
+	for _, val := range testValues {
+		r := httptest.NewRequest(val.method, banNodePath,
+			bytes.NewReader(body))
+		if val.sender != nil {
+			if err = SignAdminRequest(r, body, val.sender, key, val.ts); err != nil {
+				t.Fatalf("Failed to sign request: %+v", err)
+			}
+		}
+		if val.tamper {
+			r = httptest.NewRequest(val.method, banNodePath,
+				bytes.NewReader([]byte(`{"Reason":"other"}`)))
+			_ = SignAdminRequest(r, body, val.sender, key, val.ts)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != val.status {
+			t.Errorf("Unexpected status code for %s request."+
+				"\n\texpected: %d\n\treceived: %d: %s",
+				val.name, val.status, w.Code, w.Body)
+		}
+	}
+
+	if impl.State.GetNodeMap().GetNode(nid).IsBanned() {
+		t.Fatalf("Node banned by a rejected request.")
+	}
+
+	w := sendAdminRequest(mux, http.MethodPost, banNodePath, body, adminId,
+		key, now, t)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status code for a signed request."+
+			"\n\texpected: %d\n\treceived: %d: %s",
+			http.StatusNoContent, w.Code, w.Body)
+	}
+	if !impl.State.GetNodeMap().GetNode(nid).IsBanned() {
+		t.Errorf("Node not banned by a signed request.")
+	}
+
+	// Sending the signed request again is rejected
+	w = sendAdminRequest(mux, http.MethodPost, banNodePath, body, adminId,
+		key, now, t)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status code for a replayed request."+
+			"\n\texpected: %d\n\treceived: %d: %s",
+			http.StatusForbidden, w.Code, w.Body)
+	}
+}
+
+// Tests that the drain and resume queries drain the network and resume it.
+func TestRegistrationImpl_serveDrain(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodPost, drainPath, nil, adminId, key,
+		time.Now(), t)
+	if w.Code != http.StatusNoContent || !impl.State.IsDraining() {
+		t.Errorf("Network not drained (%d): %s", w.Code, w.Body)
+	}
+
+	w = sendAdminRequest(mux, http.MethodPost, resumePath, nil, adminId, key,
+		time.Now(), t)
+	if w.Code != http.StatusNoContent || impl.State.IsDraining() {
+		t.Errorf("Network not resumed (%d): %s", w.Code, w.Body)
+	}
+}
+
+// Tests that the node information query serves the registration record of the
+// node and rejects unknown and malformed node IDs.
+func TestRegistrationImpl_serveNodeInfo(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodGet, nodeInfoPath+"?id="+
+		base64.URLEncoding.EncodeToString(nid.Marshal()), nil, adminId, key,
+		time.Now(), t)
+	var info NodeInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if !info.Id.Cmp(nid) || info.Application.Id != 10 {
+		t.Errorf("Unexpected node record: %+v", info)
+	}
+
+	for _, query := range []string{"?id=" + base64.URLEncoding.EncodeToString(
+		id.NewIdFromString("unknown", id.Node, t).Marshal()), "?id=%25"} {
+		w = sendAdminRequest(mux, http.MethodGet, nodeInfoPath+query, nil,
+			adminId, key, time.Now(), t)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code for query %q."+
+				"\n\texpected: %d\n\treceived: %d",
+				query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// Tests that the address space query schedules the size change and rejects
+// a size that is not larger than the latest.
+func TestRegistrationImpl_serveScheduleAddressSpaceSize(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	err := storage.PermissioningDb.InsertEphemeralLength(&storage.EphemeralLength{
+		Length: 8, Timestamp: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to insert ephemeral length: %+v", err)
+	}
+
+	changeTime := time.Now().Add(time.Hour)
+	for _, val := range []struct {
+		size   uint8
+		status int
+	}{{8, http.StatusBadRequest}, {16, http.StatusNoContent}} {
+		body, _ := json.Marshal(
+			AddressSpaceSizeRequest{Size: val.size, Timestamp: changeTime})
+		w := sendAdminRequest(mux, http.MethodPost, addressSpacePath, body,
+			adminId, key, time.Now(), t)
+		if w.Code != val.status {
+			t.Errorf("Unexpected status code for size %d."+
+				"\n\texpected: %d\n\treceived: %d: %s",
+				val.size, val.status, w.Code, w.Body)
+		}
+	}
+
+	latest, err := storage.PermissioningDb.GetLatestEphemeralLength()
+	if err != nil {
+		t.Fatalf("Failed to get latest ephemeral length: %+v", err)
+	}
+	if latest.Length != 16 || !latest.Timestamp.Equal(changeTime) {
+		t.Errorf("Address space size change not stored: %+v", latest)
+	}
+}
+
+// Tests that the node states query serves the snapshot of the nodes of each
+// network.
+func TestRegistrationImpl_serveNodeStates(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodGet, nodeStatesPath, nil, adminId,
+		key, time.Now(), t)
+	var snapshots []NetworkNodeSnapshots
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshots); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if len(snapshots) != 1 || len(snapshots[0].Nodes) != 1 ||
+		!snapshots[0].Nodes[0].ID.Cmp(nid) {
+		t.Errorf("Expected the snapshot of node %s: %s", nid, w.Body)
+	}
+}
+
+// Tests that the scheduling parameters query serves the loaded parameters and
+// an error before scheduling has started.
+func TestRegistrationImpl_serveSchedulingParams(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromString("test", id.Node, t),
+		adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodGet, schedulingPath, nil, adminId,
+		key, time.Now(), t)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code before scheduling has started."+
+			"\n\texpected: %d\n\treceived: %d", http.StatusBadRequest, w.Code)
+	}
+
+	impl.schedulingParams = scheduling.ParseParams(
+		[]byte(`{"TeamSize": 5, "BatchSize": 64}`))
+	w = sendAdminRequest(mux, http.MethodGet, schedulingPath, nil, adminId,
+		key, time.Now(), t)
+	var params scheduling.Params
+	if err := json.Unmarshal(w.Body.Bytes(), &params); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if params.TeamSize != 5 || params.BatchSize != 64 {
+		t.Errorf("Served params do not match the loaded config: %+v", params)
+	}
+}
+
+// Tests that the node addresses query updates the addresses of every listed
+// node and rejects a list naming a node twice.
+func TestRegistrationImpl_serveBulkUpdateNodeAddresses(t *testing.T) {
+	nodeIds := []*id.ID{id.NewIdFromUInt(1, id.Node, t),
+		id.NewIdFromUInt(2, id.Node, t)}
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _, _ := newAddressTestImpl(nodeIds, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	duplicate := []NodeAddressUpdate{
+		{nodeIds[0], NodeAddresses{"10.0.0.1:11420", "10.0.0.2:22840"}},
+		{nodeIds[0], NodeAddresses{"10.0.0.3:11420", "10.0.0.4:22840"}},
+	}
+	body, _ := json.Marshal(duplicate)
+	w := sendAdminRequest(mux, http.MethodPost, nodeAddressPath, body, adminId,
+		key, time.Now(), t)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code for a duplicate node."+
+			"\n\texpected: %d\n\treceived: %d", http.StatusBadRequest, w.Code)
+	}
+
+	updates := []NodeAddressUpdate{
+		{nodeIds[0], NodeAddresses{"10.0.0.1:11420", "10.0.0.2:22840"}},
+		{nodeIds[1], NodeAddresses{"10.0.0.3:11420", "10.0.0.4:22840"}},
+	}
+	body, _ = json.Marshal(updates)
+	w = sendAdminRequest(mux, http.MethodPost, nodeAddressPath, body, adminId,
+		key, time.Now(), t)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected status code.\n\texpected: %d\n\treceived: %d: %s",
+			http.StatusNoContent, w.Code, w.Body)
+	}
+
+	for _, update := range updates {
+		n := impl.State.GetNodeMap().GetNode(update.ID)
+		if n.GetNodeAddresses() != update.Node ||
+			n.GetGatewayAddress() != update.Gateway {
+			t.Errorf("Unexpected addresses of node %s."+
+				"\n\texpected: %+v\n\treceived: %s, %s", update.ID,
+				update.NodeAddresses, n.GetNodeAddresses(),
+				n.GetGatewayAddress())
+		}
+	}
+}
+
+// Tests that the stuck nodes query serves the stuck nodes of each network and
+// rejects a malformed or non-positive threshold.
+func TestRegistrationImpl_serveStuckNodes(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodGet, stuckNodesPath+"?threshold=5m",
+		nil, adminId, key, time.Now(), t)
+	var snapshots []NetworkNodeSnapshots
+	if err := json.Unmarshal(w.Body.Bytes(), &snapshots); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if len(snapshots) != 1 || len(snapshots[0].Nodes) != 0 {
+		t.Errorf("Expected no stuck nodes in the default network: %s", w.Body)
+	}
+
+	for _, threshold := range []string{"", "five", "0s"} {
+		w = sendAdminRequest(mux, http.MethodGet,
+			stuckNodesPath+"?threshold="+threshold, nil, adminId, key,
+			time.Now(), t)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Unexpected status code for threshold %q."+
+				"\n\texpected: %d\n\treceived: %d",
+				threshold, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+// Tests that the allowlist queries add the key of the certificate in the body
+// to the allowlist and remove it again.
+func TestRegistrationImpl_serveNodeKeyAllowlist(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	impl.params.nodeKeyAllowlist = true
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	w := sendAdminRequest(mux, http.MethodPost, allowKeyPath, nodeCert,
+		adminId, key, time.Now(), t)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to allow node key (%d): %s", w.Code, w.Body)
+	}
+	if err := impl.checkNodeKeyAllowed(string(nodeCert)); err != nil {
+		t.Errorf("Allowed node key rejected: %+v", err)
+	}
+
+	w = sendAdminRequest(mux, http.MethodPost, disallowKeyPath, nodeCert,
+		adminId, key, time.Now(), t)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to disallow node key (%d): %s", w.Code, w.Body)
+	}
+	if err := impl.checkNodeKeyAllowed(string(nodeCert)); err == nil {
+		t.Errorf("Disallowed node key not rejected.")
+	}
+
+	w = sendAdminRequest(mux, http.MethodPost, allowKeyPath,
+		[]byte("not a certificate"), adminId, key, time.Now(), t)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code for an invalid certificate."+
+			"\n\texpected: %d\n\treceived: %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// Tests that the node round query serves the round the node is in.
+func TestRegistrationImpl_serveNodeRound(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	query := func() NodeRoundResponse {
+		w := sendAdminRequest(mux, http.MethodGet, nodeRoundPath+"?id="+
+			base64.URLEncoding.EncodeToString(nid.Marshal()), nil, adminId,
+			key, time.Now(), t)
+		var response NodeRoundResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+		}
+		return response
+	}
+
+	if response := query(); response.InRound {
+		t.Errorf("Node reported in a round before joining one: %+v", response)
+	}
+
+	err := impl.State.GetNodeMap().GetNode(nid).SetRound(
+		round.NewState_Testing(42, states.PENDING, nil, t))
+	if err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	if response := query(); !response.InRound || response.Round != 42 {
+		t.Errorf("Unexpected node round.\n\texpected: %d\n\treceived: %+v",
+			42, response)
+	}
+}
+
+// Tests that the round metrics query serves the metrics of the rounds that
+// finished realtime between the times and rejects a malformed time.
+func TestRegistrationImpl_serveRoundMetrics(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	now := time.Now().Round(time.Second)
+	for i, realtimeEnd := range []time.Time{
+		now.Add(-2 * time.Hour), now.Add(-time.Minute)} {
+		err := storage.PermissioningDb.InsertRoundMetric(&storage.RoundMetric{
+			Id: uint64(i + 1), PrecompStart: realtimeEnd,
+			PrecompEnd: realtimeEnd, RealtimeStart: realtimeEnd,
+			RealtimeEnd: realtimeEnd, RoundEnd: realtimeEnd}, nil)
+		if err != nil {
+			t.Fatalf("Failed to insert round metric: %+v", err)
+		}
+	}
+
+	query := roundMetricsPath + "?start=" +
+		now.Add(-time.Hour).Format(time.RFC3339) + "&end=" +
+		now.Format(time.RFC3339)
+	w := sendAdminRequest(mux, http.MethodGet, query, nil, adminId, key,
+		time.Now(), t)
+	var metrics []*storage.RoundMetric
+	if err := json.Unmarshal(w.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if len(metrics) != 1 || metrics[0].Id != 2 {
+		t.Errorf("Expected only the metric of round 2: %s", w.Body)
+	}
+
+	w = sendAdminRequest(mux, http.MethodGet, roundMetricsPath+"?start=now",
+		nil, adminId, key, time.Now(), t)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code for a malformed time."+
+			"\n\texpected: %d\n\treceived: %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+// Tests that the round error query serves the number of errors in each
+// category keyed by the name of the category.
+func TestRegistrationImpl_serveRoundErrorCounts(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	now := time.Now()
+	err := storage.PermissioningDb.InsertRoundMetric(&storage.RoundMetric{
+		Id: 1, PrecompStart: now, PrecompEnd: now, RealtimeStart: now,
+		RealtimeEnd: now, RoundEnd: now}, nil)
+	if err != nil {
+		t.Fatalf("Failed to insert round metric: %+v", err)
+	}
+	for _, category := range []storage.RoundErrorCategory{storage.TimeoutError,
+		storage.TimeoutError, storage.NodeReportedError} {
+		err = storage.PermissioningDb.InsertRoundError(1, category, "test")
+		if err != nil {
+			t.Fatalf("Failed to insert round error: %+v", err)
+		}
+	}
+
+	query := roundErrorsPath + "?start=" +
+		now.Add(-time.Hour).Format(time.RFC3339) + "&end=" +
+		now.Add(time.Hour).Format(time.RFC3339)
+	w := sendAdminRequest(mux, http.MethodGet, query, nil, adminId, key, now, t)
+	var counts map[string]uint64
+	if err := json.Unmarshal(w.Body.Bytes(), &counts); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if counts[storage.TimeoutError.String()] != 2 ||
+		counts[storage.NodeReportedError.String()] != 1 {
+		t.Errorf("Unexpected round error counts: %s", w.Body)
+	}
+}
+
+// Tests that the inactive node query serves the nodes that have not polled
+// since the time without their registration codes.
+func TestRegistrationImpl_serveInactiveNodes(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(nid, adminId, t)
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	query := inactivePath + "?since=" + time.Now().Format(time.RFC3339)
+	w := sendAdminRequest(mux, http.MethodGet, query, nil, adminId, key,
+		time.Now(), t)
+	var inactive []InactiveNode
+	if err := json.Unmarshal(w.Body.Bytes(), &inactive); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if len(inactive) != 1 || !inactive[0].Id.Cmp(nid) {
+		t.Errorf("Expected node %s to be inactive: %s", nid, w.Body)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("Code")) {
+		t.Errorf("Registration code served: %s", w.Body)
+	}
+}
+
+// Tests that the active rounds query serves the rounds in progress.
+func TestRegistrationImpl_serveActiveRounds(t *testing.T) {
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t), adminId, t)
+	impl.roundTracker = scheduling.NewRoundTracker()
+	mux, key := newAdminHttpTestImpl(impl, adminId, t)
+
+	impl.State.GetRoundMap().AddRound_Testing(
+		round.NewState_Testing(42, states.REALTIME, nil, t), t)
+	impl.roundTracker.AddActiveRound(42)
+
+	w := sendAdminRequest(mux, http.MethodGet, activeRoundsPath, nil, adminId,
+		key, time.Now(), t)
+	var active []ActiveRound
+	if err := json.Unmarshal(w.Body.Bytes(), &active); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %+v", w.Body, err)
+	}
+	if len(active) != 1 || active[0].ID != 42 ||
+		active[0].State != states.REALTIME.String() {
+		t.Errorf("Expected round 42 in REALTIME: %s", w.Body)
+	}
+}
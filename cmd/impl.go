@@ -63,6 +63,31 @@ type RegistrationImpl struct {
 	geoIPDBStatus geoipStatus
 
 	earliestRoundTracker atomic.Value
+
+	// Tracks the rounds currently run by the scheduler of the default network
+	roundTracker *scheduling.RoundTracker
+
+	// Collects the nodes that polled until they are marked active in storage
+	lastActive *lastActiveTracker
+
+	// Throttles node registration attempts from each source
+	nodeRegistrationLimiter *nodeRegistrationLimiter
+
+	// Rejects administrator queries served over HTTP that are replayed
+	adminRequests *adminReplayTracker
+
+	// Nodes whose registered certificate has been revoked
+	revokedCerts *revokedNodeCerts
+
+	// States of the networks run alongside the default network, keyed on name
+	networks map[string]*storage.NetworkState
+
+	// Tracks the rounds currently run by the scheduler of each network run
+	// alongside the default network, keyed on name
+	networkRoundTrackers map[string]*scheduling.RoundTracker
+
+	// Set to 1 once Shutdown is called, after which polls are rejected
+	shuttingDown uint32
 }
 
 // function used to schedule nodes
@@ -77,7 +102,7 @@ type earliestRoundTracking struct {
 }
 
 // Configure and start the Permissioning Server
-func StartRegistration(params Params) (*RegistrationImpl, error) {
+func StartRegistration(params *Params) (*RegistrationImpl, error) {
 
 	// Initialize variables
 	ndfReady := uint32(0)
@@ -122,9 +147,20 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 			"database: %v.", err)
 	}
 
+	// Load the nodes whose certificates have been revoked
+	revokedCerts, err := storage.PermissioningDb.GetRevokedCertificates()
+	if err != nil {
+		return nil, errors.Errorf("Failed to get revoked certificates from "+
+			"database: %+v", err)
+	}
+	revokedNodes, err := newRevokedNodeCerts(revokedCerts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build default parameters
 	regImpl := &RegistrationImpl{
-		params:               &params,
+		params:               params,
 		fullNdfOutputPath:    params.FullNdfOutputPath,
 		NdfReady:             &ndfReady,
 		Stopped:              &roundCreationStopped,
@@ -132,6 +168,12 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 		beginScheduling:      make(chan struct{}, 1),
 		registrationTimes:    make(map[id.ID]int64),
 		earliestRoundTracker: atomic.Value{},
+		roundTracker:         scheduling.NewRoundTracker(),
+		lastActive:           newLastActiveTracker(),
+		revokedCerts:         revokedNodes,
+		nodeRegistrationLimiter: newNodeRegistrationLimiter(
+			params.nodeRegistrationLimit, params.nodeRegistrationWindow),
+		adminRequests: newAdminReplayTracker(),
 	}
 
 	// If the the GeoIP2 database file is supplied, then use it to open the
@@ -149,8 +191,18 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 
 	}
 
+	// Store the bins from the geo bin file, if one is provided, so that they
+	// are loaded from Storage below
+	if params.geoBinsFile != "" {
+		numBins, err := storage.PermissioningDb.LoadGeoBins(params.geoBinsFile)
+		if err != nil {
+			return nil, err
+		}
+		jww.INFO.Printf("Stored %d GeoBins from %s", numBins, params.geoBinsFile)
+	}
+
 	// Determine which type of GeoBinning we're using
-	if regImpl.params.blockchainGeoBinning {
+	if regImpl.params.blockchainGeoBinning || params.geoBinsFile != "" {
 		geoBins, err = storage.PermissioningDb.GetBins()
 		if err != nil {
 			return nil, err
@@ -203,6 +255,41 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 	if err != nil {
 		return nil, err
 	}
+	regImpl.State.SetAddressSpaceSchedule(addressSpaces)
+	if params.roundUpdateGapTimeout > 0 {
+		regImpl.State.SetRoundUpdateGapTimeout(params.roundUpdateGapTimeout)
+	}
+	if params.maxFutureRoundUpdates > 0 {
+		regImpl.State.SetMaxFutureRoundUpdates(params.maxFutureRoundUpdates)
+	}
+	if params.roundUpdateSigners > 0 {
+		err = regImpl.State.SetRoundUpdateSigners(params.roundUpdateSigners)
+		if err != nil {
+			return nil, err
+		}
+	}
+	regImpl.State.SetNdfUpdateDebounceWindow(params.ndfDebounceWindow)
+	regImpl.State.SetNdfTimestampSkew(params.ndfTimestampSkew)
+
+	// Set where the NDFs are written to, which may be object storage
+	fullNdfOutput, err := storage.NewNdfOutput(
+		params.FullNdfOutputPath, params.NdfOutputS3)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid full NDF output")
+	}
+	signedPartialNdfOutput, err := storage.NewNdfOutput(
+		params.SignedPartialNdfOutputPath, params.NdfOutputS3)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid signed partial NDF output")
+	}
+	regImpl.State.SetNdfOutputs(fullNdfOutput, signedPartialNdfOutput)
+
+	fullNdfFormat, err := storage.NewNdfFormat(
+		params.FullNdfOutputFormat, params.FullNdfOutputPath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid full NDF output format")
+	}
+	regImpl.State.SetFullNdfFormat(fullNdfFormat)
 
 	if !noTLS {
 		// Read in TLS keys from files
@@ -295,6 +382,13 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 	// update the internal state with the newly-formed NDF
 	regImpl.State.UpdateInternalNdf(networkDef)
 
+	// Create the states of any additional networks from the same NDF
+	err = regImpl.addNetworks(params.networks, rsaPrivateKey,
+		uint32(newestAddressSpace.Size), geoBins, networkDef)
+	if err != nil {
+		return nil, err
+	}
+
 	var hosts []*connect.Host
 
 	if LoadAllRegNodes {
@@ -302,6 +396,11 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 		if err != nil {
 			jww.FATAL.Panicf("Could not load all nodes from database: %+v", err)
 		}
+
+		err = regImpl.rebuildNdfs()
+		if err != nil {
+			jww.FATAL.Panicf("Could not rebuild NDF from database: %+v", err)
+		}
 	}
 
 	// Start the communication server
@@ -317,17 +416,31 @@ func StartRegistration(params Params) (*RegistrationImpl, error) {
 	return regImpl, nil
 }
 
-// Tracks nodes banned from the network. Sends an update to the scheduler
+// Tracks nodes banned from the network. Sends an update to the scheduler of
+// each network tracking a banned node
 func BannedNodeTracker(impl *RegistrationImpl) error {
-	state := impl.State
 	// Search the database for any banned nodes
 	bannedNodes, err := storage.PermissioningDb.GetNodesByStatus(node.Banned)
 	if err != nil {
 		return errors.Errorf("Failed to get nodes by %s status: %v", node.Banned, err)
 	}
 
-	impl.State.InternalNdfLock.Lock()
-	defer impl.State.InternalNdfLock.Unlock()
+	for _, state := range impl.getNetworkStates() {
+		err = banNodes(state, bannedNodes)
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to ban nodes in "+
+				"network %q", state.GetNetwork())
+		}
+	}
+
+	return nil
+}
+
+// banNodes removes the banned nodes from the NDF of the network and bans those
+// it tracks, sending an update to its scheduler
+func banNodes(state *storage.NetworkState, bannedNodes []*storage.Node) error {
+	state.InternalNdfLock.Lock()
+	defer state.InternalNdfLock.Unlock()
 	def := state.GetUnprunedNdf()
 
 	// Parse through the returned node list
@@ -476,3 +589,29 @@ func (m *RegistrationImpl) GetEarliestRoundInfo() (uint64, uint64, int64, error)
 	return earliestRound.ClientRoundId,
 		earliestRound.GatewayRoundId, earliestRound.GatewayTimestamp, nil
 }
+
+// GetRoundMetrics returns the metrics, including topologies, of the rounds that
+// finished realtime between start and end.
+// Served over HTTP at roundMetricsPath.
+func (m *RegistrationImpl) GetRoundMetrics(start, end time.Time) (
+	[]*storage.RoundMetric, error) {
+	if end.Before(start) {
+		return nil, errors.Errorf("End time %s is before start time %s",
+			end, start)
+	}
+
+	return storage.PermissioningDb.GetRoundMetrics(start, end)
+}
+
+// GetRoundErrorCounts returns the number of round errors stored between start
+// and end for each category of failure.
+// Served over HTTP at roundErrorsPath.
+func (m *RegistrationImpl) GetRoundErrorCounts(start, end time.Time) (
+	map[storage.RoundErrorCategory]uint64, error) {
+	if end.Before(start) {
+		return nil, errors.Errorf("End time %s is before start time %s",
+			end, start)
+	}
+
+	return storage.PermissioningDb.GetRoundErrorCounts(start, end)
+}
@@ -0,0 +1,179 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles recording when nodes were last active in storage
+
+package cmd
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"sync"
+	"time"
+)
+
+// lastActiveUpdateInterval is how often the nodes that polled since the last
+// update are marked active in storage.
+const lastActiveUpdateInterval = 30 * time.Second
+
+// lastActiveTracker collects the nodes that polled so that their LastActive
+// can be updated in storage in one batch rather than on every poll.
+type lastActiveTracker struct {
+	polled map[id.ID]struct{}
+	mux    sync.Mutex
+}
+
+// newLastActiveTracker creates an empty lastActiveTracker.
+func newLastActiveTracker() *lastActiveTracker {
+	return &lastActiveTracker{polled: make(map[id.ID]struct{})}
+}
+
+// add records that the node polled.
+func (t *lastActiveTracker) add(nid *id.ID) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.polled[*nid] = struct{}{}
+}
+
+// update sets LastActive to now in storage for the nodes that polled since
+// the previous update. If storage fails, the nodes are kept for the next
+// update.
+func (t *lastActiveTracker) update() error {
+	t.mux.Lock()
+	polled := t.polled
+	t.polled = make(map[id.ID]struct{}, len(polled))
+	t.mux.Unlock()
+
+	if len(polled) == 0 {
+		return nil
+	}
+
+	ids := make([]*id.ID, 0, len(polled))
+	for nid := range polled {
+		nidCopy := nid
+		ids = append(ids, &nidCopy)
+	}
+
+	err := storage.PermissioningDb.UpdateLastActive(ids)
+	if err != nil {
+		t.mux.Lock()
+		for nid := range polled {
+			t.polled[nid] = struct{}{}
+		}
+		t.mux.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// TrackLastActive starts a service that every interval updates LastActive in
+// storage for the nodes that polled. The service runs until the quit channel
+// is invoked.
+func (m *RegistrationImpl) TrackLastActive(interval time.Duration,
+	quit chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			jww.INFO.Print("Stopping last active tracker.")
+			return
+		case <-ticker.C:
+			m.UpdateLastActive()
+		}
+	}
+}
+
+// UpdateLastActive sets LastActive to now in storage for the nodes that polled
+// since the previous update.
+func (m *RegistrationImpl) UpdateLastActive() {
+	err := m.lastActive.update()
+	if err != nil {
+		jww.ERROR.Printf("Could not update last active: %+v", err)
+	}
+}
+
+// GetNodesInactiveSince returns the registered nodes that have not polled
+// since the cutoff.
+// Served over HTTP at inactivePath.
+func (m *RegistrationImpl) GetNodesInactiveSince(cutoff time.Time) (
+	[]*storage.Node, error) {
+	return storage.PermissioningDb.GetNodesInactiveSince(cutoff)
+}
+
+// TrackInactiveNodes starts a service that every interval prunes the nodes that
+// have not been active within the prune retention limit from the NDF, so that
+// changes to the limit take effect without waiting for the node metric
+// tracker. The service runs until the quit channel is invoked.
+func (m *RegistrationImpl) TrackInactiveNodes(interval time.Duration,
+	quit chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			jww.INFO.Print("Stopping inactive node tracker.")
+			return
+		case <-ticker.C:
+			err := m.pruneInactiveNodes(time.Now())
+			if err != nil {
+				jww.ERROR.Printf("Could not prune inactive nodes: %+v", err)
+			}
+		}
+	}
+}
+
+// pruneInactiveNodes prunes every registered node whose LastActive in storage
+// is older than the prune retention limit from the NDF of its network. Nodes
+// are only added to the prune list; nodes that become active again are
+// restored by the node metric tracker. Does nothing if NDF pruning is disabled.
+func (m *RegistrationImpl) pruneInactiveNodes(now time.Time) error {
+	if m.params.disableNDFPruning {
+		return nil
+	}
+
+	cutoff := now.Add(-m.params.GetPruneRetention())
+	inactive, err := storage.PermissioningDb.GetNodesInactiveSince(cutoff)
+	if err != nil {
+		return err
+	}
+
+	// Group the inactive nodes by the network they are in
+	inactiveByNetwork := make(map[*storage.NetworkState][]*id.ID)
+	for _, n := range inactive {
+		nid, err := id.Unmarshal(n.Id)
+		if err != nil {
+			jww.WARN.Printf("Could not unmarshal ID of inactive node with "+
+				"code %s: %+v", n.Code, err)
+			continue
+		}
+		if state := m.getNodeNetworkState(nid); state != nil {
+			inactiveByNetwork[state] = append(inactiveByNetwork[state], nid)
+		}
+	}
+
+	for state, nodeIds := range inactiveByNetwork {
+		pruned := state.PruneNodes(nodeIds)
+		if pruned == 0 {
+			continue
+		}
+
+		jww.INFO.Printf("Pruned %d node(s) of network %q inactive since %s",
+			pruned, state.GetNetwork(), cutoff)
+		err = state.UpdateOutputNdf()
+		if err != nil {
+			jww.ERROR.Printf("Failed to trigger NDF output of network %q: %+v",
+				state.GetNetwork(), err)
+		}
+	}
+
+	return nil
+}
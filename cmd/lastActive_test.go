@@ -0,0 +1,163 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Tests that lastActiveTracker.update() marks the nodes that polled as active
+// in storage and leaves the rest inactive.
+func TestLastActiveTracker_update(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	codes := []string{"AAAA", "BBBB"}
+	nodeIds := make([]*id.ID, len(codes))
+	for i, code := range codes {
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: uint64(i + 1)}, &storage.Node{Code: code})
+		if err != nil {
+			t.Fatalf("Failed to insert application: %+v", err)
+		}
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = storage.PermissioningDb.RegisterNode(
+			nodeIds[i], []byte("salt"), code, "", "", "", "")
+		if err != nil {
+			t.Fatalf("Failed to register node: %+v", err)
+		}
+	}
+
+	tracker := newLastActiveTracker()
+	tracker.add(nodeIds[0])
+	tracker.add(nodeIds[0])
+	if err = tracker.update(); err != nil {
+		t.Fatalf("update() returned an error: %+v", err)
+	}
+
+	nodes, err := storage.PermissioningDb.GetNodesInactiveSince(
+		time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to get inactive nodes: %+v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Code != "BBBB" {
+		t.Errorf("Unexpected inactive nodes.\n\texpected: %s\n\treceived: %+v",
+			"BBBB", nodes)
+	}
+
+	if len(tracker.polled) != 0 {
+		t.Errorf("Polled nodes not cleared after update: %v", tracker.polled)
+	}
+}
+
+// Error path: Tests that lastActiveTracker.update() keeps the nodes that
+// polled when storage fails so that they are updated next time.
+func TestLastActiveTracker_update_StorageError(t *testing.T) {
+	var err error
+	var closeFunc func() error
+	storage.PermissioningDb, closeFunc, err = storage.NewDatabase(
+		"", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err = closeFunc(); err != nil {
+		t.Fatalf("Failed to close database: %+v", err)
+	}
+
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	tracker := newLastActiveTracker()
+	tracker.add(nid)
+	if err = tracker.update(); err == nil {
+		t.Fatalf("update() did not return an error for a closed database.")
+	}
+
+	if _, exists := tracker.polled[*nid]; !exists {
+		t.Errorf("Polled node dropped after a failed update.")
+	}
+}
+
+// Tests that pruneInactiveNodes() prunes the nodes whose LastActive is older
+// than the prune retention limit, including those that become inactive when
+// the limit is lowered, and prunes nothing when NDF pruning is disabled.
+func TestRegistrationImpl_pruneInactiveNodes(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	now := time.Now()
+	lastActive := []time.Time{now.Add(-10 * time.Minute),
+		now.Add(-time.Hour), now.Add(-3 * time.Hour)}
+	nodeIds := make([]*id.ID, len(lastActive))
+	for i := range lastActive {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		appId := uint64(i + 1)
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: appId}, &storage.Node{
+				Code:          strconv.Itoa(i),
+				Id:            nodeIds[i].Bytes(),
+				ApplicationId: appId,
+				LastActive:    lastActive[i],
+			})
+		if err != nil {
+			t.Fatalf("Failed to insert application: %+v", err)
+		}
+		err = testState.GetNodeMap().AddNode(
+			nodeIds[i], strconv.Itoa(i), "", "", appId)
+		if err != nil {
+			t.Fatalf("Failed to add node to state: %+v", err)
+		}
+	}
+
+	impl := &RegistrationImpl{
+		State: testState,
+		params: &Params{
+			pruneRetentionLimit: 2 * time.Hour,
+			disableNDFPruning:   true,
+		},
+	}
+	checkPruned := func(expected ...*id.ID) {
+		prunedIds := make(map[id.ID]bool, len(expected))
+		for _, nid := range expected {
+			prunedIds[*nid] = true
+		}
+		if err = impl.pruneInactiveNodes(now); err != nil {
+			t.Fatalf("pruneInactiveNodes() returned an error: %+v", err)
+		}
+		for _, nid := range nodeIds {
+			if testState.IsPruned(nid) != prunedIds[*nid] {
+				t.Errorf("Unexpected prune state of node %s with limit %s."+
+					"\n\texpected: %t\n\treceived: %t", nid,
+					impl.params.GetPruneRetention(), prunedIds[*nid],
+					!prunedIds[*nid])
+			}
+		}
+	}
+
+	checkPruned()
+
+	impl.params.disableNDFPruning = false
+	checkPruned(nodeIds[2])
+
+	impl.params.pruneRetentionLimit = 30 * time.Minute
+	checkPruned(nodeIds[1], nodeIds[2])
+}
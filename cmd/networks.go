@@ -0,0 +1,170 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles running several networks from one permissioning instance
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"sort"
+)
+
+// networkParams configures a network run alongside the default network. Nodes
+// are placed in the network matching the Network of their application; nodes
+// of any other network are placed in the default network.
+type networkParams struct {
+	Name                       string
+	FullNdfOutputPath          string
+	FullNdfOutputFormat        string
+	SignedPartialNdfOutputPath string
+}
+
+// addNetworks creates the state of each configured network. Each network
+// starts from a copy of the default network's NDF signed with its own
+// elliptic key, writes its NDFs to its own outputs, and has its rounds tracked
+// by its own RoundTracker.
+func (m *RegistrationImpl) addNetworks(networks []networkParams,
+	rsaPrivateKey *rsa.PrivateKey, addressSpaceSize uint32,
+	geoBins map[string]region.GeoBin,
+	networkDef *ndf.NetworkDefinition) error {
+
+	m.networks = make(map[string]*storage.NetworkState, len(networks))
+	m.networkRoundTrackers =
+		make(map[string]*scheduling.RoundTracker, len(networks))
+	for _, network := range networks {
+		if network.Name == "" {
+			return errors.New("Additional networks must be named")
+		} else if _, exists := m.networks[network.Name]; exists {
+			return errors.Errorf("Network %q is configured more than once",
+				network.Name)
+		}
+
+		state, err := storage.NewNetworkState(network.Name, rsaPrivateKey,
+			addressSpaceSize, network.FullNdfOutputPath,
+			network.SignedPartialNdfOutputPath, geoBins)
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to create state for "+
+				"network %q", network.Name)
+		}
+		if m.params.roundUpdateGapTimeout > 0 {
+			state.SetRoundUpdateGapTimeout(m.params.roundUpdateGapTimeout)
+		}
+		if m.params.maxFutureRoundUpdates > 0 {
+			state.SetMaxFutureRoundUpdates(m.params.maxFutureRoundUpdates)
+		}
+		if m.params.roundUpdateSigners > 0 {
+			err = state.SetRoundUpdateSigners(m.params.roundUpdateSigners)
+			if err != nil {
+				return errors.WithMessagef(err, "Failed to set round update "+
+					"signers for network %q", network.Name)
+			}
+		}
+		state.SetNdfUpdateDebounceWindow(m.params.ndfDebounceWindow)
+		state.SetNdfTimestampSkew(m.params.ndfTimestampSkew)
+		state.SetAddressSpaceSchedule(networkDef.AddressSpace)
+
+		fullNdfOutput, err := storage.NewNdfOutput(
+			network.FullNdfOutputPath, m.params.NdfOutputS3)
+		if err != nil {
+			return errors.WithMessagef(err, "Invalid full NDF output for "+
+				"network %q", network.Name)
+		}
+		signedPartialNdfOutput, err := storage.NewNdfOutput(
+			network.SignedPartialNdfOutputPath, m.params.NdfOutputS3)
+		if err != nil {
+			return errors.WithMessagef(err, "Invalid signed partial NDF "+
+				"output for network %q", network.Name)
+		}
+		state.SetNdfOutputs(fullNdfOutput, signedPartialNdfOutput)
+
+		fullNdfFormat, err := storage.NewNdfFormat(
+			network.FullNdfOutputFormat, network.FullNdfOutputPath)
+		if err != nil {
+			return errors.WithMessagef(err, "Invalid full NDF output format "+
+				"for network %q", network.Name)
+		}
+		state.SetFullNdfFormat(fullNdfFormat)
+
+		def := networkDef.DeepCopy()
+		def.Registration.EllipticPubKey =
+			state.GetEllipticPublicKey().MarshalText()
+		state.UpdateInternalNdf(def)
+
+		m.networks[network.Name] = state
+		m.networkRoundTrackers[network.Name] = scheduling.NewRoundTracker()
+		jww.INFO.Printf("Added network %q", network.Name)
+	}
+
+	return nil
+}
+
+// getNetworkStates returns the state of every network, starting with the
+// default network followed by the others ordered by name.
+func (m *RegistrationImpl) getNetworkStates() []*storage.NetworkState {
+	names := make([]string, 0, len(m.networks))
+	for name := range m.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	states := make([]*storage.NetworkState, 0, len(m.networks)+1)
+	states = append(states, m.State)
+	for _, name := range names {
+		states = append(states, m.networks[name])
+	}
+	return states
+}
+
+// getRoundTracker returns the RoundTracker of the network's scheduler or nil if
+// the network has none.
+func (m *RegistrationImpl) getRoundTracker(
+	state *storage.NetworkState) *scheduling.RoundTracker {
+	if state == m.State {
+		return m.roundTracker
+	}
+	return m.networkRoundTrackers[state.GetNetwork()]
+}
+
+// getApplicationNetworkState returns the state of the network the application
+// belongs to. When no additional networks are configured, the default network
+// is returned without looking up the application.
+func (m *RegistrationImpl) getApplicationNetworkState(appId uint64) (
+	*storage.NetworkState, error) {
+	if len(m.networks) == 0 {
+		return m.State, nil
+	}
+
+	app, err := storage.PermissioningDb.GetApplication(appId)
+	if err != nil {
+		return nil, errors.Errorf("Failed to get application %d to "+
+			"determine its network: %+v", appId, err)
+	}
+
+	if state, exists := m.networks[app.Network]; exists {
+		return state, nil
+	}
+	return m.State, nil
+}
+
+// getNodeNetworkState returns the state of the network tracking the node or
+// nil if no network is tracking it.
+func (m *RegistrationImpl) getNodeNetworkState(nid *id.ID) *storage.NetworkState {
+	for _, state := range m.getNetworkStates() {
+		if state.GetNodeMap().GetNode(nid) != nil {
+			return state
+		}
+	}
+	return nil
+}
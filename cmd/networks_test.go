@@ -0,0 +1,224 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"bytes"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ndfContainsNode returns true if the node or its gateway is in the NDF.
+func ndfContainsNode(def *ndf.NetworkDefinition, nid *id.ID) bool {
+	gwId := nid.DeepCopy()
+	gwId.SetType(id.Gateway)
+	for _, n := range def.Nodes {
+		if bytes.Equal(n.ID, nid.Bytes()) {
+			return true
+		}
+	}
+	for _, g := range def.Gateways {
+		if bytes.Equal(g.ID, gwId.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tests that nodes registered in two networks run by the same instance are
+// only added to the NDF of their own network and that their polls are routed
+// to it.
+func TestRegistrationImpl_RegisterNodes_Networks(t *testing.T) {
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to insert ephemeral length into database: %+v", err)
+	}
+
+	// Add one node to the default network and one to the test network
+	networks := []string{"", "testnet"}
+	codes := []string{"AAAA", "BBBB"}
+	for i, network := range networks {
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: uint64(i + 1), Network: network},
+			&storage.Node{Code: codes[i], Sequence: "CR",
+				ApplicationId: uint64(i + 1)})
+		if err != nil {
+			t.Fatalf("Failed to insert application: %+v", err)
+		}
+	}
+
+	localParams := newTestParams()
+	localParams.minimumNodes = 2
+	localParams.disablePing = true
+	localParams.networks = []networkParams{{Name: "testnet"}}
+
+	impl, err := StartRegistration(localParams)
+	if err != nil {
+		t.Fatalf("Failed to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+
+	_, _, err = impl.RegisterNodes([]NodeRegistrationRequest{
+		{Salt: []byte("testtesttesttesttesttesttesttest"),
+			ServerAddr: nodeAddr, ServerTlsCert: string(nodeCert),
+			GatewayAddr: nodeAddr, GatewayTlsCert: string(nodeCert),
+			RegistrationCode: codes[0]},
+		{Salt: []byte("testtesttesttesttesttesttesttesc"),
+			ServerAddr: "0.0.0.0:6901", ServerTlsCert: string(nodeCert),
+			GatewayAddr: "0.0.0.0:6902", GatewayTlsCert: string(nodeCert),
+			RegistrationCode: codes[1]},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register nodes: %+v", err)
+	}
+
+	states := []*storage.NetworkState{impl.State, impl.networks["testnet"]}
+	nodeIds := make([]*id.ID, len(codes))
+	for i, code := range codes {
+		nodeInfo, err := storage.PermissioningDb.GetNode(code)
+		if err != nil {
+			t.Fatalf("Failed to get node %s: %+v", code, err)
+		}
+		nodeIds[i], err = id.Unmarshal(nodeInfo.Id)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal node ID: %+v", err)
+		}
+	}
+
+	// Each node is only in the state and NDF of its own network
+	for i, state := range states {
+		other := states[1-i]
+		if impl.getNodeNetworkState(nodeIds[i]) != state {
+			t.Errorf("Node %s is not tracked by network %q.", nodeIds[i],
+				state.GetNetwork())
+		}
+		if other.GetNodeMap().GetNode(nodeIds[i]) != nil {
+			t.Errorf("Node %s of network %q is tracked by network %q.",
+				nodeIds[i], state.GetNetwork(), other.GetNetwork())
+		}
+		if !ndfContainsNode(state.GetUnprunedNdf(), nodeIds[i]) {
+			t.Errorf("Node %s is not in the NDF of network %q.", nodeIds[i],
+				state.GetNetwork())
+		}
+		if ndfContainsNode(other.GetUnprunedNdf(), nodeIds[i]) {
+			t.Errorf("Node %s of network %q is in the NDF of network %q.",
+				nodeIds[i], state.GetNetwork(), other.GetNetwork())
+		}
+	}
+
+	// Once no longer pruned, each node is only in its own network's output
+	for i, state := range states {
+		state.SetPrunedNodes(map[id.ID]bool{})
+		state.InternalNdfLock.Lock()
+		state.UpdateInternalNdf(state.GetUnprunedNdf())
+		state.InternalNdfLock.Unlock()
+		err = state.UpdateOutputNdf()
+		if err != nil {
+			t.Fatalf("Failed to update output NDF: %+v", err)
+		}
+		if !ndfContainsNode(state.GetFullNdf().Get(), nodeIds[i]) {
+			t.Errorf("Node %s is not in the output NDF of network %q.",
+				nodeIds[i], state.GetNetwork())
+		}
+		if ndfContainsNode(state.GetFullNdf().Get(), nodeIds[1-i]) {
+			t.Errorf("Node %s is in the output NDF of network %q.",
+				nodeIds[1-i], state.GetNetwork())
+		}
+	}
+
+	// The test network's node is served the test network's NDF when polling
+	atomic.CompareAndSwapUint32(impl.NdfReady, 0, 1)
+	states[1].GetNodeMap().GetNode(nodeIds[1]).SetConnectivity(
+		node.PortSuccessful)
+	nodeHost, exists := impl.Comms.GetHost(nodeIds[1])
+	if !exists {
+		t.Fatalf("No host for node %s.", nodeIds[1])
+	}
+	response, err := impl.Poll(&pb.PermissioningPoll{
+		Full:           &pb.NDFHash{Hash: []byte("test")},
+		Partial:        &pb.NDFHash{Hash: []byte("test")},
+		Activity:       uint32(current.WAITING),
+		GatewayVersion: "1.1.0",
+		ServerVersion:  "1.1.0",
+		ServerAddress:  "0.0.0.0:6901",
+		GatewayAddress: "0.0.0.0:6902",
+	}, &connect.Auth{IsAuthenticated: true, Sender: nodeHost})
+	if err != nil {
+		t.Fatalf("Failed to poll: %+v", err)
+	}
+	expected := states[1].GetFullNdf().GetPb()
+	if response.FullNDF == nil || !bytes.Equal(expected.Ndf, response.FullNDF.Ndf) {
+		t.Errorf("Node was not served the NDF of its network."+
+			"\n\texpected: %s\n\treceived: %v", expected.Ndf, response.FullNDF)
+	}
+
+	// The node's activity is sent to the scheduler of its own network
+	select {
+	case update := <-states[1].GetNodeUpdateChannel():
+		if !update.Node.Cmp(nodeIds[1]) || update.ToActivity != current.WAITING {
+			t.Errorf("Unexpected update sent to the scheduler of network "+
+				"%q: %+v", states[1].GetNetwork(), update)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("No update sent to the scheduler of network %q.",
+			states[1].GetNetwork())
+	}
+	select {
+	case update := <-states[0].GetNodeUpdateChannel():
+		t.Errorf("Update sent to the scheduler of the default network: %+v",
+			update)
+	default:
+	}
+}
+
+// Error path: Tests that addNetworks() rejects unnamed and duplicate networks.
+func TestRegistrationImpl_addNetworks_Invalid(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	tests := map[string]struct {
+		networks    []networkParams
+		expectedErr string
+	}{
+		"unnamed": {[]networkParams{{}}, "must be named"},
+		"duplicate": {[]networkParams{{Name: "testnet"}, {Name: "testnet"}},
+			"configured more than once"},
+	}
+
+	for name, tt := range tests {
+		impl := &RegistrationImpl{params: &Params{}}
+		err = impl.addNetworks(tt.networks, getTestKey(), 8,
+			region.GetCountryBins(), &ndf.NetworkDefinition{})
+		if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+			t.Errorf("Unexpected error for %s networks."+
+				"\n\texpected: %s\n\treceived: %+v", name, tt.expectedErr, err)
+		}
+	}
+}
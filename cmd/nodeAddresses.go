@@ -0,0 +1,155 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles checking node addresses and administrators updating the addresses of
+// many nodes at once
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// NodeAddresses are the addresses of a node and its gateway.
+type NodeAddresses struct {
+	Node    string
+	Gateway string
+}
+
+// BulkUpdateNodeAddresses updates the addresses of many nodes at once on
+// behalf of an administrator, such as during a datacenter migration, without
+// waiting for each node to report its new addresses. Every node and address is
+// checked before any are changed. The addresses are stored and updated in the
+// internal NDF, after which the output NDF of each affected network is
+// regenerated once. Returns an error if the sender is not an authenticated
+// administrator, a node is not in the network, or an address is invalid.
+// Served over HTTP at nodeAddressPath.
+func (m *RegistrationImpl) BulkUpdateNodeAddresses(
+	updates map[id.ID]NodeAddresses, auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "update node addresses"); err != nil {
+		return err
+	}
+
+	// Check every update before changing anything
+	states := make(map[*storage.NetworkState][]*id.ID)
+	for nid, addresses := range updates {
+		nid := nid
+		state := m.getNodeNetworkState(&nid)
+		if state == nil {
+			return errors.Errorf("Node %s could not be found in internal "+
+				"state tracker", &nid)
+		}
+		if err := checkNodeAddresses(addresses); err != nil {
+			return errors.WithMessagef(err, "Invalid addresses for node %s",
+				&nid)
+		}
+		states[state] = append(states[state], &nid)
+	}
+
+	for state, nodes := range states {
+		for _, nid := range nodes {
+			addresses := updates[*nid]
+			err := storage.PermissioningDb.UpdateNodeAddresses(
+				nid, addresses.Node, addresses.Gateway)
+			if err != nil {
+				return errors.WithMessagef(err, "Failed to store addresses "+
+					"of node %s", nid)
+			}
+
+			n := state.GetNodeMap().GetNode(nid)
+			n.SetAddresses(addresses.Node, addresses.Gateway)
+			state.GetNodeMap().IndexAddresses(nid, addresses.Node,
+				addresses.Gateway)
+			n.SetConnectivity(node.PortUnknown)
+			if m.Comms != nil {
+				if nodeHost, exists := m.Comms.GetHost(nid); exists {
+					nodeHost.UpdateAddress(addresses.Node)
+				}
+			}
+		}
+
+		state.InternalNdfLock.Lock()
+		currentNdf := state.GetUnprunedNdf()
+		if currentNdf == nil {
+			state.InternalNdfLock.Unlock()
+			return errors.Errorf("Network %q has no NDF to update",
+				state.GetNetwork())
+		}
+		for _, nid := range nodes {
+			addresses := updates[*nid]
+			err := updateNdfNodeAddr(nid, addresses.Node, currentNdf)
+			if err == nil {
+				err = updateNdfGatewayAddr(nid, addresses.Gateway, currentNdf)
+			}
+			if err != nil {
+				state.InternalNdfLock.Unlock()
+				return err
+			}
+		}
+		state.UpdateInternalNdf(currentNdf)
+		state.InternalNdfLock.Unlock()
+
+		err := state.UpdateOutputNdf()
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to output the NDF of "+
+				"network %q", state.GetNetwork())
+		}
+		jww.INFO.Printf("Updated the addresses of %d nodes in network %q on "+
+			"behalf of %s", len(nodes), state.GetNetwork(),
+			auth.Sender.GetId())
+	}
+
+	return nil
+}
+
+// checkNodeAddresses returns an error if either address is missing or is not
+// an IP address or domain name, or if both addresses are the same.
+func checkNodeAddresses(addresses NodeAddresses) error {
+	if addresses.Node == "" || addresses.Gateway == "" {
+		return errors.New("Node and gateway addresses are required")
+	} else if addresses.Node == addresses.Gateway {
+		return errors.Errorf("Node and gateway cannot have the same "+
+			"address %s", addresses.Node)
+	}
+
+	for _, address := range []string{addresses.Node, addresses.Gateway} {
+		if !utils.IsIP(address) {
+			if err := utils.IsDomainName(address); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkAddressesUnassigned returns an error if any of the addresses is already
+// assigned to a node other than the node with the given ID, as returned by
+// owner. If allowDuplicates is set, a warning is logged instead.
+func checkAddressesUnassigned(nid *id.ID, owner func(address string) *id.ID,
+	allowDuplicates bool, addresses ...string) error {
+	for _, address := range addresses {
+		assigned := owner(address)
+		if assigned == nil || assigned.Cmp(nid) {
+			continue
+		}
+
+		if allowDuplicates {
+			jww.WARN.Printf("Node %s is using address %s, which is already "+
+				"assigned to node %s", nid, address, assigned)
+			continue
+		}
+		return errors.Errorf("Address %s is already assigned to node %s",
+			address, assigned)
+	}
+	return nil
+}
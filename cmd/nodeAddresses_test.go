@@ -0,0 +1,300 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeCounter is an NDF output that counts its writes.
+type writeCounter struct {
+	writes int
+}
+
+func (w *writeCounter) Write([]byte) error {
+	w.writes++
+	return nil
+}
+
+// newAddressTestImpl returns a RegistrationImpl administered by adminId, whose
+// NDF lists the nodes and whose full NDF writes are counted by the returned
+// output, and the auth of the administrator.
+func newAddressTestImpl(nodeIds []*id.ID, adminId *id.ID, t *testing.T) (
+	*RegistrationImpl, *connect.Auth, *writeCounter) {
+	impl, auth := newBanTestImpl(nodeIds[0], adminId, t)
+
+	def := &ndf.NetworkDefinition{}
+	for i, nid := range nodeIds {
+		if i > 0 {
+			err := storage.PermissioningDb.InsertApplication(
+				&storage.Application{Id: uint64(10 + i)},
+				&storage.Node{Code: strconv.Itoa(i), Id: nid.Bytes(),
+					Status: uint8(node.Active), ApplicationId: uint64(10 + i)})
+			if err != nil {
+				t.Fatalf("Failed to insert node: %+v", err)
+			}
+			err = impl.State.GetNodeMap().AddNode(nid, "", "", "", uint64(10+i))
+			if err != nil {
+				t.Fatalf("Failed to add node to state: %+v", err)
+			}
+		}
+
+		gwId := nid.DeepCopy()
+		gwId.SetType(id.Gateway)
+		def.Nodes = append(def.Nodes, ndf.Node{ID: nid.Bytes()})
+		def.Gateways = append(def.Gateways, ndf.Gateway{ID: gwId.Bytes()})
+	}
+	impl.State.UpdateInternalNdf(def)
+
+	output := &writeCounter{}
+	impl.State.SetNdfOutputs(output, &writeCounter{})
+	return impl, auth, output
+}
+
+// Tests that BulkUpdateNodeAddresses() stores the addresses of every node and
+// outputs an NDF listing all of them with a single update.
+func TestRegistrationImpl_BulkUpdateNodeAddresses(t *testing.T) {
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i+1), id.Node, t)
+	}
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth, output := newAddressTestImpl(nodeIds, adminId, t)
+
+	updates := make(map[id.ID]NodeAddresses, len(nodeIds))
+	for i, nid := range nodeIds {
+		updates[*nid] = NodeAddresses{
+			Node:    "10.0.0." + strconv.Itoa(i+1) + ":11420",
+			Gateway: "gateway" + strconv.Itoa(i+1) + ".example.com:22840",
+		}
+	}
+
+	err := impl.BulkUpdateNodeAddresses(updates, auth)
+	if err != nil {
+		t.Fatalf("BulkUpdateNodeAddresses() returned an error: %+v", err)
+	}
+
+	if output.writes != 1 {
+		t.Errorf("Unexpected number of NDF outputs."+
+			"\n\texpected: %d\n\treceived: %d", 1, output.writes)
+	}
+
+	outputNdf := impl.State.GetFullNdf().Get()
+	for i, nid := range nodeIds {
+		expected := updates[*nid]
+		if outputNdf.Nodes[i].Address != expected.Node {
+			t.Errorf("Unexpected NDF address of node %s."+
+				"\n\texpected: %s\n\treceived: %s", nid, expected.Node,
+				outputNdf.Nodes[i].Address)
+		}
+		if outputNdf.Gateways[i].Address != expected.Gateway {
+			t.Errorf("Unexpected NDF address of gateway of node %s."+
+				"\n\texpected: %s\n\treceived: %s", nid, expected.Gateway,
+				outputNdf.Gateways[i].Address)
+		}
+
+		n := impl.State.GetNodeMap().GetNode(nid)
+		if n.GetNodeAddresses() != expected.Node ||
+			n.GetGatewayAddress() != expected.Gateway {
+			t.Errorf("Unexpected state addresses of node %s."+
+				"\n\texpected: %+v\n\treceived: %s, %s", nid, expected,
+				n.GetNodeAddresses(), n.GetGatewayAddress())
+		}
+
+		stored, err := storage.PermissioningDb.GetNodeById(nid)
+		if err != nil {
+			t.Fatalf("Failed to get node %s: %+v", nid, err)
+		}
+		if stored.ServerAddress != expected.Node ||
+			stored.GatewayAddress != expected.Gateway {
+			t.Errorf("Unexpected stored addresses of node %s."+
+				"\n\texpected: %+v\n\treceived: %s, %s", nid, expected,
+				stored.ServerAddress, stored.GatewayAddress)
+		}
+	}
+}
+
+// Error path: Tests that BulkUpdateNodeAddresses() changes nothing when a node
+// is unknown, an address is invalid, or the sender is not an administrator.
+func TestRegistrationImpl_BulkUpdateNodeAddresses_Error(t *testing.T) {
+	nodeIds := []*id.ID{id.NewIdFromUInt(1, id.Node, t),
+		id.NewIdFromUInt(2, id.Node, t)}
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth, output := newAddressTestImpl(nodeIds, adminId, t)
+
+	valid := NodeAddresses{Node: "10.0.0.1:11420", Gateway: "10.0.0.2:22840"}
+	unknown := id.NewIdFromUInt(3, id.Node, t)
+	tests := []map[id.ID]NodeAddresses{
+		{*nodeIds[0]: valid, *unknown: valid},
+		{*nodeIds[0]: valid, *nodeIds[1]: {Node: "10.0.0.3:11420"}},
+		{*nodeIds[0]: valid,
+			*nodeIds[1]: {Node: "10.0.0.3:1", Gateway: "10.0.0.3:1"}},
+		{*nodeIds[0]: valid,
+			*nodeIds[1]: {Node: "10.0.0.3:1", Gateway: "bad_domain!:1"}},
+	}
+	for i, updates := range tests {
+		if err := impl.BulkUpdateNodeAddresses(updates, auth); err == nil {
+			t.Errorf("Expected error for updates %d.", i)
+		}
+	}
+
+	if err := impl.BulkUpdateNodeAddresses(
+		map[id.ID]NodeAddresses{*nodeIds[0]: valid}, nil); err == nil {
+		t.Errorf("Expected error for unauthenticated sender.")
+	}
+
+	if output.writes != 0 {
+		t.Errorf("NDF was output after failed updates.")
+	}
+	if address := impl.State.GetNodeMap().GetNode(nodeIds[0]).
+		GetNodeAddresses(); address != "" {
+		t.Errorf("Node address was updated after failed updates: %s",
+			address)
+	}
+}
+
+// Tests that checkIPAddresses() rejects a gateway address already assigned to
+// another node, or only warns and takes the address when duplicates are
+// allowed.
+func TestCheckIPAddresses_DuplicateAddress(t *testing.T) {
+	for _, allowDuplicates := range []bool{false, true} {
+		nodeIds := []*id.ID{
+			id.NewIdFromUInt(1, id.Node, t), id.NewIdFromUInt(2, id.Node, t)}
+		adminId := id.NewIdFromString("admin", id.User, t)
+		impl, _, _ := newAddressTestImpl(nodeIds, adminId, t)
+		nodeMap := impl.State.GetNodeMap()
+
+		poll := func(nid *id.ID, nodeAddress, gatewayAddress string) error {
+			nodeHost, err := connect.NewHost(nid, nodeAddress, nil,
+				connect.GetDefaultHostParams())
+			if err != nil {
+				t.Fatalf("Failed to create node host: %+v", err)
+			}
+			return checkIPAddresses(impl.State, nodeMap.GetNode(nid),
+				&pb.PermissioningPoll{ServerAddress: nodeAddress,
+					GatewayAddress: gatewayAddress}, nodeHost, allowDuplicates)
+		}
+
+		err := poll(nodeIds[0], "10.0.0.1:11420", "10.0.0.1:22840")
+		if err != nil {
+			t.Fatalf("Failed to update addresses of the first node: %+v", err)
+		}
+
+		err = poll(nodeIds[1], "10.0.0.2:11420", "10.0.0.1:22840")
+		gatewayAddress := nodeMap.GetNode(nodeIds[1]).GetGatewayAddress()
+		if allowDuplicates {
+			if err != nil {
+				t.Errorf("Duplicate gateway address rejected when allowed: "+
+					"%+v", err)
+			}
+			if gatewayAddress != "10.0.0.1:22840" {
+				t.Errorf("Duplicate gateway address not taken when allowed."+
+					"\n\texpected: %s\n\treceived: %s", "10.0.0.1:22840",
+					gatewayAddress)
+			}
+		} else {
+			if err == nil || !strings.Contains(err.Error(), "already assigned") {
+				t.Errorf("Duplicate gateway address not rejected: %+v", err)
+			}
+			if gatewayAddress != "" {
+				t.Errorf("Gateway address updated to a duplicate: %s",
+					gatewayAddress)
+			}
+			if owner := nodeMap.GetAddressOwner("10.0.0.1:22840"); owner == nil ||
+				!owner.Cmp(nodeIds[0]) {
+				t.Errorf("Unexpected owner of the gateway address."+
+					"\n\texpected: %s\n\treceived: %s", nodeIds[0], owner)
+			}
+		}
+	}
+}
+
+// Tests that checkRegistrationAddresses() rejects a registration whose gateway
+// address is already assigned to a registered node or to another node in the
+// same batch, or accepts it when duplicates are allowed.
+func TestRegistrationImpl_checkRegistrationAddresses(t *testing.T) {
+	for _, allowDuplicates := range []bool{false, true} {
+		nodeIds := []*id.ID{id.NewIdFromUInt(1, id.Node, t),
+			id.NewIdFromUInt(2, id.Node, t), id.NewIdFromUInt(3, id.Node, t)}
+		adminId := id.NewIdFromString("admin", id.User, t)
+		impl, _ := newBanTestImpl(nodeIds[0], adminId, t)
+		impl.params.allowDuplicateAddresses = allowDuplicates
+		impl.State.GetNodeMap().GetNode(nodeIds[0]).SetAddresses(
+			"10.0.0.1:11420", "10.0.0.1:22840")
+		impl.State.GetNodeMap().IndexAddresses(nodeIds[0], "10.0.0.1:11420",
+			"10.0.0.1:22840")
+
+		batch := make(map[string]*id.ID)
+		check := func(nid *id.ID, nodeAddress, gatewayAddress string) error {
+			return impl.checkRegistrationAddresses(storage.NodeRegistration{
+				Id: nid, ServerAddress: nodeAddress,
+				GatewayAddress: gatewayAddress}, 10, batch)
+		}
+
+		// A gateway address assigned to a registered node
+		err := check(nodeIds[1], "10.0.0.2:11420", "10.0.0.1:22840")
+		if allowDuplicates && err != nil {
+			t.Errorf("Gateway address of a registered node rejected when "+
+				"allowed: %+v", err)
+		} else if !allowDuplicates && (err == nil ||
+			!strings.Contains(err.Error(), "already assigned")) {
+			t.Errorf("Gateway address of a registered node not rejected: %+v",
+				err)
+		}
+
+		// A gateway address assigned to a node earlier in the batch
+		err = check(nodeIds[1], "10.0.0.2:11420", "10.0.0.2:22840")
+		if err != nil && !allowDuplicates {
+			t.Fatalf("Unassigned addresses rejected: %+v", err)
+		}
+		err = check(nodeIds[2], "10.0.0.3:11420", "10.0.0.2:22840")
+		if allowDuplicates && err != nil {
+			t.Errorf("Gateway address of a node in the batch rejected when "+
+				"allowed: %+v", err)
+		} else if !allowDuplicates && (err == nil ||
+			!strings.Contains(err.Error(), "already assigned")) {
+			t.Errorf("Gateway address of a node in the batch not rejected: "+
+				"%+v", err)
+		}
+	}
+}
+
+// Tests that checkAddressesUnassigned() rejects an address assigned to another
+// node unless duplicates are allowed, and accepts addresses that are
+// unassigned or assigned to the node itself.
+func Test_checkAddressesUnassigned(t *testing.T) {
+	nid := id.NewIdFromUInt(1, id.Node, t)
+	other := id.NewIdFromUInt(2, id.Node, t)
+	owners := map[string]*id.ID{"10.0.0.1:11420": nid, "10.0.0.2:11420": other}
+	owner := func(address string) *id.ID { return owners[address] }
+
+	err := checkAddressesUnassigned(nid, owner, false, "10.0.0.1:11420",
+		"10.0.0.3:11420")
+	if err != nil {
+		t.Errorf("Unassigned or own addresses rejected: %+v", err)
+	}
+
+	err = checkAddressesUnassigned(nid, owner, false, "10.0.0.3:11420",
+		"10.0.0.2:11420")
+	if err == nil || !strings.Contains(err.Error(), other.String()) {
+		t.Errorf("Address of another node not rejected: %+v", err)
+	}
+
+	err = checkAddressesUnassigned(nid, owner, true, "10.0.0.2:11420")
+	if err != nil {
+		t.Errorf("Address of another node rejected when allowed: %+v", err)
+	}
+}
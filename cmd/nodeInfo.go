@@ -0,0 +1,80 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles retrieving the stored registration record of a node
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// NodeInfo is the stored registration record of a node and its application.
+// Secret material, such as the salt and the registration code, is omitted.
+type NodeInfo struct {
+	Id       *id.ID
+	Sequence string
+	Status   node.Status
+
+	ServerAddress      string
+	GatewayAddress     string
+	NodeCertificate    string
+	GatewayCertificate string
+
+	DateRegistered     time.Time
+	LastActive         time.Time
+	DateDecommissioned time.Time
+	DateBanned         time.Time
+	BanReason          string
+
+	// The node's application without the nested node record
+	Application storage.Application
+}
+
+// GetNodeInfo returns the stored registration record of the node joined with
+// its application on behalf of an administrator. Returns an error if the
+// sender is not an authenticated administrator or the node is not registered.
+// Served over HTTP at nodeInfoPath.
+func (m *RegistrationImpl) GetNodeInfo(nid *id.ID, auth *connect.Auth) (
+	*NodeInfo, error) {
+	if err := m.checkAdminAuth(auth, "view node information"); err != nil {
+		return nil, err
+	}
+
+	n, err := storage.PermissioningDb.GetNodeById(nid)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to get node %s", nid)
+	}
+	app, err := storage.PermissioningDb.GetNodeApplication(nid)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to get application "+
+			"of node %s", nid)
+	}
+
+	info := &NodeInfo{
+		Id:                 nid.DeepCopy(),
+		Sequence:           n.Sequence,
+		Status:             node.Status(n.Status),
+		ServerAddress:      n.ServerAddress,
+		GatewayAddress:     n.GatewayAddress,
+		NodeCertificate:    n.NodeCertificate,
+		GatewayCertificate: n.GatewayCertificate,
+		DateRegistered:     n.DateRegistered,
+		LastActive:         n.LastActive,
+		DateDecommissioned: n.DateDecommissioned,
+		DateBanned:         n.DateBanned,
+		BanReason:          n.BanReason,
+		Application:        *app,
+	}
+	info.Application.Node = storage.Node{}
+	return info, nil
+}
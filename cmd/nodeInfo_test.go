@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+)
+
+// Tests that GetNodeInfo() returns the node's stored record joined with its
+// application.
+func TestRegistrationImpl_GetNodeInfo(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	// Register a second node with its addresses and application details
+	otherId := id.NewIdFromString("other", id.Node, t)
+	err := storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: 11, Name: "other node", Team: "team"},
+		&storage.Node{Code: "BBBB", Sequence: "CR", ApplicationId: 11})
+	if err != nil {
+		t.Fatalf("Failed to insert node: %+v", err)
+	}
+	err = storage.PermissioningDb.RegisterNode(otherId, []byte("salt"), "BBBB",
+		"0.0.0.0:1", "serverCert", "0.0.0.0:2", "gatewayCert")
+	if err != nil {
+		t.Fatalf("Failed to register node: %+v", err)
+	}
+
+	info, err := impl.GetNodeInfo(otherId, auth)
+	if err != nil {
+		t.Fatalf("GetNodeInfo() returned an error: %+v", err)
+	}
+	if !info.Id.Cmp(otherId) || info.Sequence != "CR" ||
+		info.ServerAddress != "0.0.0.0:1" || info.GatewayAddress != "0.0.0.0:2" ||
+		info.NodeCertificate != "serverCert" ||
+		info.GatewayCertificate != "gatewayCert" {
+		t.Errorf("Unexpected node record: %+v", info)
+	}
+	if info.Application.Id != 11 || info.Application.Name != "other node" ||
+		info.Application.Team != "team" {
+		t.Errorf("Unexpected application: %+v", info.Application)
+	}
+	if info.Application.Node.Code != "" || info.Application.Node.Salt != nil {
+		t.Errorf("Node record nested in application: %+v",
+			info.Application.Node)
+	}
+
+	info, err = impl.GetNodeInfo(nid, auth)
+	if err != nil {
+		t.Fatalf("GetNodeInfo() returned an error: %+v", err)
+	}
+	if info.Status != node.Active || info.Application.Id != 10 {
+		t.Errorf("Unexpected node record: %+v", info)
+	}
+}
+
+// Error path: Tests that GetNodeInfo() rejects callers that are not
+// authenticated administrators and unknown nodes.
+func TestRegistrationImpl_GetNodeInfo_Invalid(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	unauthorized := []*connect.Auth{
+		nil,
+		{IsAuthenticated: false, Sender: auth.Sender},
+	}
+	for i, a := range unauthorized {
+		if _, err := impl.GetNodeInfo(nid, a); err == nil {
+			t.Errorf("Expected error getting node information with auth %d.", i)
+		}
+	}
+
+	unknown := id.NewIdFromString("unknown", id.Node, t)
+	if _, err := impl.GetNodeInfo(unknown, auth); err == nil {
+		t.Errorf("Expected error getting information of an unknown node.")
+	}
+}
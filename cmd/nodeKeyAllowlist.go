@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles restricting node registration to an allowlist of node keys
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/crypto/tls"
+	"time"
+)
+
+// nodeKeyFingerprint returns the hex encoded SHA-256 hash of the DER encoded
+// public key of the PEM encoded certificate.
+func nodeKeyFingerprint(certPEM string) (string, error) {
+	cert, err := tls.LoadCertificate(certPEM)
+	if err != nil {
+		return "", errors.Errorf("Could not decode certificate into a tls "+
+			"cert: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return "", errors.Errorf("Could not marshal public key of "+
+			"certificate: %v", err)
+	}
+
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// AllowNodeKey adds the public key of the PEM encoded node certificate to the
+// allowlist on behalf of an administrator, so that a node submitting a
+// certificate with the key may register while the allowlist is enabled.
+// Returns an error if the sender is not an authenticated administrator.
+// Served over HTTP at allowKeyPath.
+func (m *RegistrationImpl) AllowNodeKey(certPEM string,
+	auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "allow node keys"); err != nil {
+		return err
+	}
+
+	fingerprint, err := nodeKeyFingerprint(certPEM)
+	if err != nil {
+		return err
+	}
+
+	err = storage.PermissioningDb.InsertAllowedNodeKey(fingerprint, time.Now())
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to store allowed node key %s",
+			fingerprint)
+	}
+
+	jww.INFO.Printf("Node key %s has been allowed by %s", fingerprint,
+		auth.Sender.GetId())
+
+	return nil
+}
+
+// DisallowNodeKey removes the public key of the PEM encoded node certificate
+// from the allowlist on behalf of an administrator. Nodes already registered
+// with the key are not affected. Returns an error if the sender is not an
+// authenticated administrator or the key is not on the allowlist.
+// Served over HTTP at disallowKeyPath.
+func (m *RegistrationImpl) DisallowNodeKey(certPEM string,
+	auth *connect.Auth) error {
+	if err := m.checkAdminAuth(auth, "disallow node keys"); err != nil {
+		return err
+	}
+
+	fingerprint, err := nodeKeyFingerprint(certPEM)
+	if err != nil {
+		return err
+	}
+
+	err = storage.PermissioningDb.DeleteAllowedNodeKey(fingerprint)
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to remove allowed node key %s",
+			fingerprint)
+	}
+
+	jww.INFO.Printf("Node key %s has been disallowed by %s", fingerprint,
+		auth.Sender.GetId())
+
+	return nil
+}
+
+// checkNodeKeyAllowed returns an error if the allowlist is enabled and the
+// public key of the PEM encoded node certificate is not on it.
+func (m *RegistrationImpl) checkNodeKeyAllowed(certPEM string) error {
+	if !m.params.nodeKeyAllowlist {
+		return nil
+	}
+
+	fingerprint, err := nodeKeyFingerprint(certPEM)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := storage.PermissioningDb.IsNodeKeyAllowed(fingerprint)
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to check allowlist for node "+
+			"key %s", fingerprint)
+	} else if !allowed {
+		return errors.Errorf("Node key %s is not on the allowlist",
+			fingerprint)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that while the allowlist is enabled, a node is only able to register
+// once the key of its certificate has been allowed.
+func TestRegistrationImpl_RegisterNode_NodeKeyAllowlist(t *testing.T) {
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to insert ephemeral length into database: %+v", err)
+	}
+	storage.PopulateNodeRegistrationCodes([]node.Info{
+		{RegCode: "AAAA", Order: "CR"},
+	})
+
+	adminId := id.NewIdFromString("admin", id.User, t)
+	localParams := newTestParams()
+	localParams.nodeKeyAllowlist = true
+	localParams.adminIds = []*id.ID{adminId}
+	impl, err := StartRegistration(localParams)
+	if err != nil {
+		t.Fatalf("Unable to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+
+	testSalt := []byte("testtesttesttesttesttesttesttest")
+	err = impl.RegisterNode(testSalt, nodeAddr, string(nodeCert),
+		nodeAddr, string(nodeCert), "AAAA")
+	if err == nil || !strings.Contains(err.Error(), "allowlist") {
+		t.Fatalf("Node with a key that is not allowed was not rejected: %+v",
+			err)
+	}
+
+	adminHost, err := connect.NewHost(adminId, "0.0.0.0:1234",
+		make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create admin host: %+v", err)
+	}
+	err = impl.AllowNodeKey(string(nodeCert),
+		&connect.Auth{IsAuthenticated: true, Sender: adminHost})
+	if err != nil {
+		t.Fatalf("AllowNodeKey() returned an error: %+v", err)
+	}
+
+	err = impl.RegisterNode(testSalt, nodeAddr, string(nodeCert),
+		nodeAddr, string(nodeCert), "AAAA")
+	if err != nil {
+		t.Errorf("Node with an allowed key failed to register: %+v", err)
+	}
+}
+
+// Tests that DisallowNodeKey() removes an allowed key from the allowlist and
+// that removing it again returns an error.
+func TestRegistrationImpl_DisallowNodeKey(t *testing.T) {
+	impl, auth := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+	impl.params.nodeKeyAllowlist = true
+
+	err := impl.AllowNodeKey(string(nodeCert), auth)
+	if err != nil {
+		t.Fatalf("AllowNodeKey() returned an error: %+v", err)
+	}
+	if err = impl.checkNodeKeyAllowed(string(nodeCert)); err != nil {
+		t.Errorf("Allowed node key rejected: %+v", err)
+	}
+
+	err = impl.DisallowNodeKey(string(nodeCert), auth)
+	if err != nil {
+		t.Fatalf("DisallowNodeKey() returned an error: %+v", err)
+	}
+	if err = impl.checkNodeKeyAllowed(string(nodeCert)); err == nil {
+		t.Errorf("Disallowed node key not rejected.")
+	}
+
+	// Error path: the key is no longer on the allowlist
+	if err = impl.DisallowNodeKey(string(nodeCert), auth); err == nil {
+		t.Errorf("Expected error disallowing a key that is not allowed.")
+	}
+}
+
+// Error path: Tests that AllowNodeKey() rejects senders that are not
+// administrators.
+func TestRegistrationImpl_AllowNodeKey_NotAdmin(t *testing.T) {
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+
+	userHost, err := connect.NewHost(id.NewIdFromString("user", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+
+	err = impl.AllowNodeKey(string(nodeCert),
+		&connect.Auth{IsAuthenticated: true, Sender: userHost})
+	if err == nil {
+		t.Error("AllowNodeKey() did not return an error for a sender that " +
+			"is not an administrator.")
+	}
+}
@@ -77,12 +77,6 @@ func TrackNodeMetrics(impl *RegistrationImpl, quitChan chan struct{}, nodeMetric
 				}
 			}
 
-			// Keep track of stale/pruned nodes
-			// Set to true if pruned, false if stale
-			toPrune := make(map[id.ID]bool)
-			// List of nodes to update activity in Storage
-			var toUpdate []*id.ID
-
 			// Obtain active nodes
 			var active map[id.ID]bool
 			if onlyScheduleActive {
@@ -93,60 +87,86 @@ func TrackNodeMetrics(impl *RegistrationImpl, quitChan chan struct{}, nodeMetric
 				jww.DEBUG.Printf("Found %d active nodes!", len(active))
 			}
 
-			// Iterate over the Node States
-			nodeStates := impl.State.GetNodeMap().GetNodeStates()
-			for _, nodeState := range nodeStates {
-
-				// Build the NodeMetric
-				currentTime := time.Now()
-				metric := &storage.NodeMetric{
-					NodeId:    nodeState.GetID().Bytes(),
-					StartTime: startTime,
-					EndTime:   currentTime,
-					NumPings:  nodeState.GetAndResetNumPolls(),
-				}
+			// Update the metrics and NDF of each network
+			pruneRetention := impl.params.GetPruneRetention()
+			for _, state := range impl.getNetworkStates() {
+				// Keep track of stale/pruned nodes
+				// Set to true if pruned, false if stale
+				toPrune := make(map[id.ID]bool)
+
+				// Iterate over the Node States of the network
+				nodeStates := state.GetNodeMap().GetNodeStates()
+				for _, nodeState := range nodeStates {
+
+					// Build the NodeMetric
+					currentTime := time.Now()
+					metric := &storage.NodeMetric{
+						NodeId:    nodeState.GetID().Bytes(),
+						StartTime: startTime,
+						EndTime:   currentTime,
+						NumPings:  nodeState.GetAndResetNumPolls(),
+					}
 
-				// set the node to prune if it has not contacted
-				if metric.NumPings == 0 || (onlyScheduleActive && !active[*nodeState.GetID()]) {
-					toPrune[*nodeState.GetID()] = false
-				} else {
-					nodeState.SetLastActive()
-					toUpdate = append(toUpdate, nodeState.GetID())
-				}
-				if time.Since(nodeState.GetLastActive()) > impl.params.pruneRetentionLimit {
-					toPrune[*nodeState.GetID()] = true
-				}
+					// set the node to prune if it has not contacted
+					if metric.NumPings == 0 || (onlyScheduleActive && !active[*nodeState.GetID()]) {
+						toPrune[*nodeState.GetID()] = false
+					} else {
+						nodeState.SetLastActive()
+					}
+					if time.Since(nodeState.GetLastActive()) > pruneRetention ||
+						nodeState.IsDecommissioned() {
+						toPrune[*nodeState.GetID()] = true
+					}
 
-				// Store the NodeMetric
-				if !onlyScheduleActive || active[*nodeState.GetID()] {
-					err = storage.PermissioningDb.InsertNodeMetric(metric)
-					if err != nil {
-						jww.FATAL.Panicf("Unable to store node metric: %+v", err)
+					// Store the NodeMetric
+					pollIntervals := nodeState.GetAndResetPollIntervals()
+					latencySamples := nodeState.GetAndResetLatencySamples()
+					if !onlyScheduleActive || active[*nodeState.GetID()] {
+						err = storage.PermissioningDb.InsertNodeMetric(metric)
+						if err != nil {
+							jww.FATAL.Panicf("Unable to store node metric: %+v", err)
+						}
+
+						// Store the PollMetric if the node polled more than once
+						if pollIntervals.Count > 0 {
+							err = storage.PermissioningDb.InsertPollMetric(&storage.PollMetric{
+								NodeId:       metric.NodeId,
+								StartTime:    startTime,
+								EndTime:      currentTime,
+								NumIntervals: pollIntervals.Count,
+								MinInterval:  pollIntervals.Min.Milliseconds(),
+								MaxInterval:  pollIntervals.Max.Milliseconds(),
+								MeanInterval: pollIntervals.Mean().Milliseconds(),
+							})
+							if err != nil {
+								jww.ERROR.Printf("Unable to store poll metric: %+v", err)
+							}
+
+							err = storage.PermissioningDb.InsertNodeLatency(
+								nodeState.GetID(), currentTime, latencySamples)
+							if err != nil {
+								jww.ERROR.Printf("Unable to store node latency: %+v", err)
+							}
+						}
 					}
 				}
-			}
-
-			// Update all the active nodes in the database
-			err = storage.PermissioningDb.UpdateLastActive(toUpdate)
-			if err != nil {
-				jww.ERROR.Printf("TrackNodeMetrics: Could not update last active: %v", err)
-			}
 
-			if !impl.params.disableNDFPruning {
-				// add disabled nodes to the prune list
-				jww.DEBUG.Printf("Setting %d pruned nodes", len(toPrune))
-				impl.State.InternalNdfLock.Lock()
-				impl.State.SetPrunedNodes(toPrune)
-				currentNdf := impl.State.GetUnprunedNdf()
-				currentNdf.WhitelistedIds = whitelistedIds
-				currentNdf.WhitelistedIpAddresses = whitelistedIpAddresses
-				impl.State.UpdateInternalNdf(currentNdf)
-				impl.State.InternalNdfLock.Unlock()
-			}
+				if !impl.params.disableNDFPruning {
+					// add disabled nodes to the prune list
+					jww.DEBUG.Printf("Setting %d pruned nodes", len(toPrune))
+					state.InternalNdfLock.Lock()
+					state.SetPrunedNodes(toPrune)
+					currentNdf := state.GetUnprunedNdf()
+					currentNdf.WhitelistedIds = whitelistedIds
+					currentNdf.WhitelistedIpAddresses = whitelistedIpAddresses
+					state.UpdateInternalNdf(currentNdf)
+					state.InternalNdfLock.Unlock()
+				}
 
-			err = impl.State.UpdateOutputNdf()
-			if err != nil {
-				jww.ERROR.Printf("Failed to trigger NDF output: %+v", err)
+				err = state.UpdateOutputNdf()
+				if err != nil {
+					jww.ERROR.Printf("Failed to trigger NDF output: %+v", err)
+				}
 			}
 
 			paramsCopy := impl.schedulingParams.SafeCopy()
@@ -0,0 +1,114 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles exporting the state of the nodes for diagnostics
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// NetworkNodeSnapshots contains the snapshots of the nodes in a network.
+type NetworkNodeSnapshots struct {
+	// Name of the network; empty for the default network
+	Network string
+
+	Nodes []node.Snapshot
+}
+
+// ExportNodeStates returns a JSON snapshot of the state of every node in each
+// network on behalf of an administrator, to be attached to support tickets.
+// Returns an error if the sender is not an authenticated administrator.
+// Served over HTTP at nodeStatesPath.
+func (m *RegistrationImpl) ExportNodeStates(auth *connect.Auth) ([]byte, error) {
+	if err := m.checkAdminAuth(auth, "export node states"); err != nil {
+		return nil, err
+	}
+
+	states := m.getNetworkStates()
+	snapshots := make([]NetworkNodeSnapshots, len(states))
+	for i, state := range states {
+		snapshots[i] = NetworkNodeSnapshots{
+			Network: state.GetNetwork(),
+			Nodes:   state.GetNodeSnapshots(),
+		}
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return nil, errors.Errorf("Failed to marshal node states: %+v", err)
+	}
+
+	jww.INFO.Printf("Node states have been exported by %s",
+		auth.Sender.GetId())
+
+	return data, nil
+}
+
+// ExportStuckNodes returns a JSON snapshot of every node in each network that
+// entered PRECOMPUTING, STANDBY, or REALTIME and has not polled or has not
+// progressed for longer than the threshold, on behalf of an administrator.
+// Returns an error if the sender is not an authenticated administrator or the
+// threshold is not positive.
+// Served over HTTP at stuckNodesPath.
+func (m *RegistrationImpl) ExportStuckNodes(auth *connect.Auth,
+	threshold time.Duration) ([]byte, error) {
+	if err := m.checkAdminAuth(auth, "export stuck nodes"); err != nil {
+		return nil, err
+	}
+	if threshold <= 0 {
+		return nil, errors.Errorf("Stuck node threshold must be positive, "+
+			"received %s", threshold)
+	}
+
+	states := m.getNetworkStates()
+	snapshots := make([]NetworkNodeSnapshots, len(states))
+	for i, state := range states {
+		snapshots[i] = NetworkNodeSnapshots{
+			Network: state.GetNetwork(),
+			Nodes:   state.GetStuckNodes(threshold),
+		}
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return nil, errors.Errorf("Failed to marshal stuck nodes: %+v", err)
+	}
+
+	jww.INFO.Printf("Nodes stuck for longer than %s have been exported by %s",
+		threshold, auth.Sender.GetId())
+
+	return data, nil
+}
+
+// GetNodeRound returns the ID of the round the node is currently in on behalf
+// of an administrator, so that a misbehaving node can be correlated with a
+// round. Returns false if the node is not in a round. Returns an error if the
+// sender is not an authenticated administrator or the node is not registered
+// in any network.
+// Served over HTTP at nodeRoundPath.
+func (m *RegistrationImpl) GetNodeRound(auth *connect.Auth, nid *id.ID) (
+	id.Round, bool, error) {
+	if err := m.checkAdminAuth(auth, "get node round"); err != nil {
+		return 0, false, err
+	}
+
+	state := m.getNodeNetworkState(nid)
+	if state == nil {
+		return 0, false, errors.Errorf("Node %s is not registered", nid)
+	}
+
+	rid, inRound := state.GetNodeRound(nid)
+	return rid, inRound, nil
+}
@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/json"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/storage/round"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+	"time"
+)
+
+// Tests that ExportNodeStates() returns the JSON snapshot of the nodes of each
+// network.
+func TestRegistrationImpl_ExportNodeStates(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	data, err := impl.ExportNodeStates(auth)
+	if err != nil {
+		t.Fatalf("ExportNodeStates() returned an error: %+v", err)
+	}
+
+	var snapshots []NetworkNodeSnapshots
+	if err = json.Unmarshal(data, &snapshots); err != nil {
+		t.Fatalf("Failed to unmarshal node states: %+v", err)
+	}
+
+	if len(snapshots) != 1 || snapshots[0].Network != "" {
+		t.Fatalf("Expected the snapshot of only the default network: %s",
+			data)
+	}
+	if len(snapshots[0].Nodes) != 1 || !snapshots[0].Nodes[0].ID.Cmp(nid) {
+		t.Fatalf("Expected the snapshot of node %s: %s", nid, data)
+	}
+	if activity := snapshots[0].Nodes[0].Activity; activity !=
+		current.NOT_STARTED.String() {
+		t.Errorf("Unexpected node activity.\n\texpected: %s\n\treceived: %s",
+			current.NOT_STARTED, activity)
+	}
+}
+
+// Error path: Tests that ExportNodeStates() rejects senders that are not
+// administrators.
+func TestRegistrationImpl_ExportNodeStates_NotAdmin(t *testing.T) {
+	impl, _ := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+
+	userHost, err := connect.NewHost(id.NewIdFromString("user", id.User, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+
+	_, err = impl.ExportNodeStates(
+		&connect.Auth{IsAuthenticated: true, Sender: userHost})
+	if err == nil {
+		t.Error("ExportNodeStates() did not return an error for a sender " +
+			"that is not an administrator.")
+	}
+}
+
+// Tests that ExportStuckNodes() returns the JSON snapshot of a node stalled in
+// REALTIME only once it has not progressed for longer than the threshold.
+func TestRegistrationImpl_ExportStuckNodes(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	// Move the node through a round into REALTIME
+	n := impl.State.GetNodeMap().GetNode(nid)
+	r := round.NewState_Testing(42, states.PRECOMPUTING, nil, t)
+	if _, _, err := n.Update(current.WAITING); err != nil {
+		t.Fatalf("Failed to update node to WAITING: %+v", err)
+	}
+	if err := n.SetRound(r); err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	for _, activity := range []current.Activity{
+		current.PRECOMPUTING, current.STANDBY} {
+		if _, _, err := n.Update(activity); err != nil {
+			t.Fatalf("Failed to update node to %s: %+v", activity, err)
+		}
+	}
+	if err := r.Update(states.REALTIME, time.Now()); err != nil {
+		t.Fatalf("Failed to update round: %+v", err)
+	}
+	if _, _, err := n.Update(current.REALTIME); err != nil {
+		t.Fatalf("Failed to update node to REALTIME: %+v", err)
+	}
+
+	threshold := time.Minute
+	exportStuck := func() []NetworkNodeSnapshots {
+		data, err := impl.ExportStuckNodes(auth, threshold)
+		if err != nil {
+			t.Fatalf("ExportStuckNodes() returned an error: %+v", err)
+		}
+		var snapshots []NetworkNodeSnapshots
+		if err = json.Unmarshal(data, &snapshots); err != nil {
+			t.Fatalf("Failed to unmarshal stuck nodes: %+v", err)
+		}
+		if len(snapshots) != 1 || snapshots[0].Network != "" {
+			t.Fatalf("Expected only the default network: %+v", snapshots)
+		}
+		return snapshots
+	}
+
+	if snapshots := exportStuck(); len(snapshots[0].Nodes) != 0 {
+		t.Errorf("Node reported stuck before the threshold: %+v",
+			snapshots[0].Nodes)
+	}
+
+	n.SetLastPoll(time.Now().Add(-2*threshold), t)
+	n.SetLastUpdate(time.Now().Add(-2*threshold), t)
+
+	snapshots := exportStuck()
+	if len(snapshots[0].Nodes) != 1 || !snapshots[0].Nodes[0].ID.Cmp(nid) {
+		t.Fatalf("Expected node %s to be stuck: %+v", nid, snapshots[0].Nodes)
+	}
+	if activity := snapshots[0].Nodes[0].Activity; activity !=
+		current.REALTIME.String() {
+		t.Errorf("Unexpected node activity.\n\texpected: %s\n\treceived: %s",
+			current.REALTIME, activity)
+	}
+}
+
+// Error path: Tests that ExportStuckNodes() rejects a threshold that is not
+// positive.
+func TestRegistrationImpl_ExportStuckNodes_InvalidThreshold(t *testing.T) {
+	impl, auth := newBanTestImpl(id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromString("admin", id.User, t), t)
+
+	_, err := impl.ExportStuckNodes(auth, 0)
+	if err == nil {
+		t.Error("ExportStuckNodes() did not return an error for a zero " +
+			"threshold.")
+	}
+}
+
+// Tests that GetNodeRound() returns the round a node is in only while it is in
+// the round, and errors for a node that is not registered.
+func TestRegistrationImpl_GetNodeRound(t *testing.T) {
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	rid, inRound, err := impl.GetNodeRound(auth, nid)
+	if err != nil || inRound {
+		t.Errorf("Node reported in round %d before joining one: %+v", rid, err)
+	}
+
+	n := impl.State.GetNodeMap().GetNode(nid)
+	err = n.SetRound(round.NewState_Testing(42, states.PENDING, nil, t))
+	if err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	rid, inRound, err = impl.GetNodeRound(auth, nid)
+	if err != nil || !inRound || rid != 42 {
+		t.Errorf("Unexpected node round.\n\texpected: %d\n\treceived: %d "+
+			"(in round: %t, %+v)", 42, rid, inRound, err)
+	}
+
+	_, _, err = impl.GetNodeRound(auth, id.NewIdFromUInt(1, id.Node, t))
+	if err == nil {
+		t.Error("GetNodeRound() did not return an error for a node that is " +
+			"not registered.")
+	}
+}
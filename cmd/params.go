@@ -13,6 +13,8 @@ import (
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/primitives/version"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
 	"sync"
 	"time"
@@ -30,6 +32,14 @@ type Params struct {
 	WhitelistedIdsPath         string
 	WhitelistedIpAddressPath   string
 
+	// Object store the NDFs are written to when an output path is of the
+	// form s3://bucket/key
+	NdfOutputS3 storage.S3Config
+
+	// Format the full NDF is written in; selected by the extension of the
+	// output path when empty
+	FullNdfOutputFormat string
+
 	cmix                  ndf.Group
 	e2e                   ndf.Group
 	publicAddress         string
@@ -43,6 +53,7 @@ type Params struct {
 	minGatewayVersion     version.Version
 	minServerVersion      version.Version
 	minClientVersion      version.Version
+	requireGatewayVersion bool
 	addressSpaceSize      uint8
 	allowLocalIPs         bool
 	disableGeoBinning     bool
@@ -53,8 +64,38 @@ type Params struct {
 
 	disableNDFPruning bool
 
+	// Log a warning instead of rejecting a node or gateway address that is
+	// already assigned to another node
+	allowDuplicateAddresses bool
+
+	// Return the FAILED update of a node's round in the response to a poll
+	// that reports progress in the round, so the node can reset sooner
+	notifyFailedRounds bool
+
 	geoIPDBFile string
 
+	// Path to a JSON or CSV file of country to geographic bin pairs that are
+	// stored in the database at startup and used for geobinning
+	geoBinsFile string
+
+	// IDs of the administrators allowed to ban nodes
+	adminIds []*id.ID
+
+	// Only allow nodes to register with a certificate whose public key is on
+	// the allowlist in storage
+	nodeKeyAllowlist bool
+
+	// Networks run alongside the default network
+	networks []networkParams
+
+	// How long NDF changes reported in polls are collected before the output
+	// NDF is updated
+	ndfDebounceWindow time.Duration
+
+	// How far the timestamp of a changed NDF may be behind the output NDF
+	// before the change is skipped as stale
+	ndfTimestampSkew time.Duration
+
 	clientRegistrationAddress string
 
 	versionLock sync.RWMutex
@@ -62,7 +103,8 @@ type Params struct {
 	// How long offline nodes remain in the NDF. If a node is
 	// offline past this duration the node is cleared from the
 	// NDF. Expects duration in"h". (Defaults to 1 week (168 hours)
-	pruneRetentionLimit time.Duration
+	pruneRetentionLimit    time.Duration
+	pruneRetentionLimitMux sync.Mutex
 
 	// How long rounds will be tracked by gateways.
 	// Rounds (and messages as an extension)
@@ -71,6 +113,32 @@ type Params struct {
 	messageRetentionLimit    time.Duration
 	messageRetentionLimitMux sync.Mutex
 
+	// How long to wait for a missing round update before skipping it so that
+	// later round updates can be sent out. (Defaults to 1 minute)
+	roundUpdateGapTimeout time.Duration
+
+	// Maximum number of round updates held behind missing updates before the
+	// missing updates are skipped without waiting. (Defaults to 10000)
+	maxFutureRoundUpdates int
+
+	// Number of workers signing round updates. (Defaults to 0, which uses
+	// one worker per CPU)
+	roundUpdateSigners int
+
+	// Number of consecutive polls in which a node reports an outdated NDF
+	// before it is flagged. (Defaults to 0, which disables the check)
+	maxStaleNdfPolls uint32
+
+	// Maximum number of round updates returned in a poll. (Defaults to 0,
+	// which returns every update)
+	maxUpdatesPerPoll uint32
+
+	// Number of registration attempts a node may make in a burst, which leak
+	// away over the window; failed attempts count as several attempts.
+	// (Defaults to 10 attempts over 10 minutes)
+	nodeRegistrationLimit  uint32
+	nodeRegistrationWindow time.Duration
+
 	// Specs on rate limiting clients
 	leakedCapacity uint32
 	leakedTokens   uint32
@@ -91,6 +159,12 @@ func toGroup(grp map[string]string) (*ndf.Group, error) {
 	return &ndf.Group{Prime: pStr, Generator: gStr}, nil
 }
 
+func (p *Params) GetPruneRetention() time.Duration {
+	p.pruneRetentionLimitMux.Lock()
+	defer p.pruneRetentionLimitMux.Unlock()
+	return p.pruneRetentionLimit
+}
+
 func (p *Params) GetMessageRetention() time.Duration {
 	p.messageRetentionLimitMux.Lock()
 	defer p.messageRetentionLimitMux.Unlock()
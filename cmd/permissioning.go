@@ -19,12 +19,13 @@ import (
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/crypto/signature/rsa"
-	"gitlab.com/xx_network/crypto/tls"
 	"gitlab.com/xx_network/crypto/xx"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
 	"gitlab.com/xx_network/primitives/region"
+	"net"
 	"sync/atomic"
+	"time"
 )
 
 // Handle registration check attempt by node. We assume
@@ -65,35 +66,227 @@ func (m *RegistrationImpl) CheckNodeRegistration(msg *mixmessages.RegisteredNode
 var curNodeReg = uint32(0)
 var curNodeRegPtr = &curNodeReg
 
-// Handle registration attempt by a Node
+// NodeRegistrationRequest contains the information sent by a Node attempting
+// to register.
+type NodeRegistrationRequest struct {
+	Salt             []byte
+	ServerAddr       string
+	ServerTlsCert    string
+	GatewayAddr      string
+	GatewayTlsCert   string
+	RegistrationCode string
+}
+
+// Handle registration attempt by a Node. Retrying an attempt that succeeded,
+// such as after the response timed out, succeeds again when the retry matches
+// the stored registration exactly. Attempts are rate limited per sender, with
+// failed attempts counting more heavily, so that a sender cannot guess
+// registration codes by trying many of them.
+//
+// The sender is the host of the server address. This depends on comms building
+// the server address from the peer address of the connection, with only the
+// port taken from the registration message, so the host cannot be chosen by
+// the sender.
 func (m *RegistrationImpl) RegisterNode(salt []byte, serverAddr, serverTlsCert, gatewayAddr,
 	gatewayTlsCert, registrationCode string) error {
 
-	// If disableRegCodes is set, we atomically increase curNodeReg and use the previous code in the sequence
-	if disableRegCodes {
-		regNum := atomic.AddUint32(curNodeRegPtr, 1)
-		registrationCode = regCodeInfos[regNum-1].RegCode
+	sender := registrationSender(serverAddr)
+	if !m.nodeRegistrationLimiter.allow(sender) {
+		jww.WARN.Printf("Rejected node registration attempt from %s: too "+
+			"many attempts", sender)
+		return errors.New("Too many registration attempts, try again later")
+	}
+
+	err := m.registerNode(salt, serverAddr, serverTlsCert,
+		gatewayAddr, gatewayTlsCert, registrationCode)
+	if err != nil {
+		m.nodeRegistrationLimiter.fail(sender)
+	}
+	return err
+}
+
+// registrationSender returns the host of the server address of a registration
+// attempt, which identifies its sender. The whole address is returned if it
+// has no port.
+func registrationSender(serverAddr string) string {
+	host, _, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		return serverAddr
+	}
+	return host
+}
+
+// registerNode registers a single Node as a batch of one.
+func (m *RegistrationImpl) registerNode(salt []byte, serverAddr, serverTlsCert,
+	gatewayAddr, gatewayTlsCert, registrationCode string) error {
+	_, failed, err := m.RegisterNodes([]NodeRegistrationRequest{{
+		Salt:             salt,
+		ServerAddr:       serverAddr,
+		ServerTlsCert:    serverTlsCert,
+		GatewayAddr:      gatewayAddr,
+		GatewayTlsCert:   gatewayTlsCert,
+		RegistrationCode: registrationCode,
+	}})
+
+	// Return the error for the single node rather than the batch summary
+	for _, regErr := range failed {
+		return regErr
+	}
+	return err
+}
+
+// RegisterNodes handles registration attempts by a batch of Nodes. All Nodes
+// are inserted into the database in a single transaction; if any registration
+// is invalid or the insert fails, no Nodes are registered. Requests that retry
+// a successful request with the same salt, certificates and addresses are
+// reported as registered without registering the Node again. Returns the registration codes that were
+// registered and the errors for each code that failed.
+func (m *RegistrationImpl) RegisterNodes(requests []NodeRegistrationRequest) (
+	succeeded []string, failed map[string]error, err error) {
+
+	failed = make(map[string]error)
+	registrations := make([]storage.NodeRegistration, 0, len(requests))
+	nodeInfos := make([]*storage.Node, 0, len(requests))
+	codes := make(map[string]struct{}, len(requests))
+	batchAddresses := make(map[string]*id.ID, 2*len(requests))
+	var retried []string
+	for _, req := range requests {
+		registrationCode := req.RegistrationCode
+
+		// A retry with the same salt, certificates and addresses resolves to
+		// the registered Node and succeeds again
+		if !disableRegCodes && isRegistrationRetry(req) {
+			jww.INFO.Printf("Registration with code %s was retried after "+
+				"it succeeded", registrationCode)
+			retried = append(retried, registrationCode)
+			continue
+		}
+
+		// If disableRegCodes is set, we atomically increase curNodeReg and use the previous code in the sequence
+		if disableRegCodes {
+			regNum := atomic.AddUint32(curNodeRegPtr, 1)
+			registrationCode = regCodeInfos[regNum-1].RegCode
+		}
+
+		// Reject codes that appear more than once in the batch
+		if _, exists := codes[registrationCode]; exists {
+			failed[registrationCode] = errors.Errorf("Registration code %s "+
+				"appears more than once in the batch", registrationCode)
+			continue
+		}
+		codes[registrationCode] = struct{}{}
+
+		registration, nodeInfo, err := prepareNodeRegistration(req, registrationCode)
+		if err == nil {
+			err = m.checkNodeKeyAllowed(req.ServerTlsCert)
+		}
+		if err == nil {
+			err = m.checkRegistrationAddresses(registration,
+				nodeInfo.ApplicationId, batchAddresses)
+		}
+		if err != nil {
+			failed[registrationCode] = err
+			continue
+		}
+		registrations = append(registrations, registration)
+		nodeInfos = append(nodeInfos, nodeInfo)
+	}
+
+	if len(failed) != 0 {
+		return nil, failed, errors.Errorf("Failed to register %d of %d "+
+			"node(s), no nodes were registered: %v", len(failed),
+			len(requests), failed)
+	}
+
+	// Attempt to insert all Nodes into the database
+	succeeded = retried
+	if len(registrations) == 0 {
+		return succeeded, nil, nil
+	}
+	err = storage.PermissioningDb.RegisterNodes(registrations)
+	if err != nil {
+		err = errors.Errorf("unable to insert node: %+v", err)
+		for _, r := range registrations {
+			failed[r.Code] = err
+		}
+		return nil, failed, err
+	}
+
+	for i, r := range registrations {
+		jww.DEBUG.Printf("Inserted node %s into the database with code %s",
+			r.Id, r.Code)
+
+		err = m.addRegisteredNode(r, nodeInfos[i])
+		if err != nil {
+			failed[r.Code] = err
+			continue
+		}
+		succeeded = append(succeeded, r.Code)
+	}
+
+	if len(failed) != 0 {
+		return succeeded, failed, errors.Errorf("Failed to complete "+
+			"registration of %d of %d node(s): %v", len(failed),
+			len(requests), failed)
+	}
+
+	return succeeded, nil, nil
+}
+
+// isRegistrationRetry determines if the request matches the registration
+// already stored for its code. The Node ID is generated from the salt and the
+// server certificate, so a matching request resolves to the registered Node.
+func isRegistrationRetry(req NodeRegistrationRequest) bool {
+	nodeInfo, err := storage.PermissioningDb.GetNode(req.RegistrationCode)
+	if err != nil || len(nodeInfo.Id) == 0 || len(nodeInfo.Salt) == 0 {
+		return false
+	}
+
+	salt := req.Salt
+	if len(salt) > 32 {
+		salt = salt[:32]
 	}
 
+	return bytes.Equal(nodeInfo.Salt, salt) &&
+		nodeInfo.NodeCertificate == req.ServerTlsCert &&
+		nodeInfo.GatewayCertificate == req.GatewayTlsCert &&
+		nodeInfo.ServerAddress == req.ServerAddr &&
+		nodeInfo.GatewayAddress == req.GatewayAddr
+}
+
+// prepareNodeRegistration validates the registration code and generates the
+// Node ID for the registration request.
+func prepareNodeRegistration(req NodeRegistrationRequest,
+	registrationCode string) (storage.NodeRegistration, *storage.Node, error) {
+
 	// Check that the node hasn't already been registered
 	nodeInfo, err := storage.PermissioningDb.GetNode(registrationCode)
 	if err != nil {
-		return errors.Errorf(
+		return storage.NodeRegistration{}, nil, errors.Errorf(
 			"Registration code %+v is invalid or not currently enabled: %+v", registrationCode, err)
 	}
 
-	// Generate the Node ID
-	tlsCert, err := tls.LoadCertificate(serverTlsCert)
+	// Reject malformed certificates before they are stored
+	now := time.Now()
+	tlsCert, err := loadRegistrationCert(req.ServerTlsCert, "server", now)
+	if err != nil {
+		return storage.NodeRegistration{}, nil, err
+	}
+	_, err = loadRegistrationCert(req.GatewayTlsCert, "gateway", now)
 	if err != nil {
-		return errors.Errorf("Could not decode server certificate into a tls cert: %v", err)
+		return storage.NodeRegistration{}, nil, err
 	}
+
+	// Generate the Node ID
 	nodePubKey := &rsa.PublicKey{PublicKey: *tlsCert.PublicKey.(*gorsa.PublicKey)}
+	salt := req.Salt
 	if len(salt) > 32 {
 		salt = salt[:32]
 	}
 	nodeId, err := xx.NewID(nodePubKey, salt, id.Node)
 	if err != nil {
-		return errors.Errorf("Unable to generate Node ID with salt %v: %+v", salt, err)
+		return storage.NodeRegistration{}, nil, errors.Errorf(
+			"Unable to generate Node ID with salt %v: %+v", salt, err)
 	}
 
 	// Handle various re-registration cases
@@ -102,38 +295,89 @@ func (m *RegistrationImpl) RegisterNode(salt []byte, serverAddr, serverTlsCert,
 		// Ensure that generated ID matches stored ID
 		// Ensure that salt is not already stored
 		if !bytes.Equal(nodeInfo.Id, nodeId.Marshal()) {
-			return errors.Errorf("Generated ID %+v does not match stored ID: %+v", nodeId.Marshal(), nodeInfo.Id)
+			return storage.NodeRegistration{}, nil, errors.Errorf(
+				"Generated ID %+v does not match stored ID: %+v", nodeId.Marshal(), nodeInfo.Id)
 
 		} else if len(nodeInfo.Salt) != 0 {
-			return errors.Errorf(
+			return storage.NodeRegistration{}, nil, errors.Errorf(
 				"Node with registration code %s has already been registered", registrationCode)
 		}
 	}
 
-	// Attempt to insert Node into the database
-	err = storage.PermissioningDb.RegisterNode(nodeId, salt, registrationCode, serverAddr,
-		serverTlsCert, gatewayAddr, gatewayTlsCert)
+	registration := storage.NodeRegistration{
+		Id:                 nodeId,
+		Salt:               salt,
+		Code:               registrationCode,
+		ServerAddress:      req.ServerAddr,
+		ServerCertificate:  req.ServerTlsCert,
+		GatewayAddress:     req.GatewayAddr,
+		GatewayCertificate: req.GatewayTlsCert,
+	}
+
+	return registration, nodeInfo, nil
+}
+
+// checkRegistrationAddresses returns an error if the node or gateway address of
+// the registration is already assigned to another node in the network of the
+// application or to another node registering in the same batch, whose
+// addresses are in batch. The addresses of the registration are added to
+// batch.
+func (m *RegistrationImpl) checkRegistrationAddresses(
+	r storage.NodeRegistration, applicationId uint64,
+	batch map[string]*id.ID) error {
+	state, err := m.getApplicationNetworkState(applicationId)
+	if err != nil {
+		return err
+	}
+
+	owner := func(address string) *id.ID {
+		if nid, exists := batch[address]; exists {
+			return nid
+		}
+		return state.GetNodeMap().GetAddressOwner(address)
+	}
+	err = checkAddressesUnassigned(r.Id, owner,
+		m.params.allowDuplicateAddresses, r.ServerAddress, r.GatewayAddress)
 	if err != nil {
-		return errors.Errorf("unable to insert node: %+v", err)
+		return err
+	}
+
+	for _, address := range []string{r.ServerAddress, r.GatewayAddress} {
+		if address != "" {
+			batch[address] = r.Id
+		}
+	}
+	return nil
+}
+
+// addRegisteredNode adds a Node that has been inserted into the database to
+// the host object and state tracker and completes its registration.
+func (m *RegistrationImpl) addRegisteredNode(r storage.NodeRegistration,
+	nodeInfo *storage.Node) error {
+	serverAddr := r.ServerAddress
+
+	// Get the state of the network the node belongs to
+	state, err := m.getApplicationNetworkState(nodeInfo.ApplicationId)
+	if err != nil {
+		return err
 	}
-	jww.DEBUG.Printf("Inserted node %s into the database with code %s",
-		nodeId.String(), registrationCode)
 
 	//add the node to the host object for authenticated communications
-	_, err = m.Comms.AddHost(nodeId, serverAddr, []byte(serverTlsCert), connect.GetDefaultHostParams())
+	_, err = m.Comms.AddHost(r.Id, serverAddr, []byte(r.ServerCertificate), connect.GetDefaultHostParams())
 	if err != nil {
 		return errors.Errorf("Could not register host for Server %s: %+v", serverAddr, err)
 	}
 
 	//add the node to the node map to track its state
-	err = m.State.GetNodeMap().AddNode(nodeId, nodeInfo.Sequence, serverAddr, gatewayAddr, nodeInfo.ApplicationId)
+	err = state.GetNodeMap().AddNode(r.Id, nodeInfo.Sequence, serverAddr, r.GatewayAddress, nodeInfo.ApplicationId)
 	if err != nil {
 		return errors.WithMessage(err, "Could not register node with "+
 			"state tracker")
 	}
+	m.setNodeGeoBin(state.GetNodeMap().GetNode(r.Id))
 
 	// Notify registration thread
-	return m.completeNodeRegistration(registrationCode)
+	return m.completeNodeRegistration(state, r.Code)
 }
 
 type protoHost struct {
@@ -159,16 +403,22 @@ func (m *RegistrationImpl) LoadAllRegisteredNodes() ([]*connect.Host, error) {
 	for _, n := range nodes {
 		nid, err := id.Unmarshal(n.Id)
 
+		state, err := m.getApplicationNetworkState(n.ApplicationId)
+		if err != nil {
+			return nil, err
+		}
+
 		h, _ := connect.NewHost(nid, n.ServerAddress, []byte(n.NodeCertificate), connect.GetDefaultHostParams())
 		hosts = append(hosts, h)
 		//add the node to the node map to track its state
-		err = m.State.GetNodeMap().AddNode(nid, n.Sequence, n.ServerAddress, n.GatewayAddress, n.ApplicationId)
+		err = state.GetNodeMap().AddNode(nid, n.Sequence, n.ServerAddress, n.GatewayAddress, n.ApplicationId)
 		if err != nil {
 			return nil, errors.WithMessage(err, "Could not register node with "+
 				"state tracker")
 		}
+		m.setNodeGeoBin(state.GetNodeMap().GetNode(nid))
 
-		err = m.completeNodeRegistration(n.Code)
+		err = m.completeNodeRegistration(state, n.Code)
 		if err != nil {
 			return nil, err
 		}
@@ -182,11 +432,16 @@ func (m *RegistrationImpl) LoadAllRegisteredNodes() ([]*connect.Host, error) {
 	for _, n := range bannedNodes {
 		nid, err := id.Unmarshal(n.Id)
 
+		state, err := m.getApplicationNetworkState(n.ApplicationId)
+		if err != nil {
+			return nil, err
+		}
+
 		h, _ := connect.NewHost(nid, n.ServerAddress, []byte(n.NodeCertificate), connect.GetDefaultHostParams())
 		hosts = append(hosts, h)
 
 		//add the node to the node map to track its state
-		err = m.State.GetNodeMap().AddBannedNode(nid, n.Sequence, n.ServerAddress, n.GatewayAddress)
+		err = state.GetNodeMap().AddBannedNode(nid, n.Sequence, n.ServerAddress, n.GatewayAddress)
 		if err != nil {
 			return nil, errors.WithMessage(err, "Could not register node with "+
 				"state tracker")
@@ -196,11 +451,12 @@ func (m *RegistrationImpl) LoadAllRegisteredNodes() ([]*connect.Host, error) {
 	return hosts, nil
 }
 
-// Handles including new registrations in the network
+// Handles including new registrations in the network tracked by the state
 // fixme: we should split this function into what is relevant to registering a  node and what is relevant
 //
 //	to permissioning
-func (m *RegistrationImpl) completeNodeRegistration(regCode string) error {
+func (m *RegistrationImpl) completeNodeRegistration(state *storage.NetworkState,
+	regCode string) error {
 
 	m.registrationLock.Lock()
 	defer m.registrationLock.Unlock()
@@ -210,11 +466,11 @@ func (m *RegistrationImpl) completeNodeRegistration(regCode string) error {
 	jww.INFO.Printf("Registered %d node(s)!", m.numRegistered)
 
 	// Add the new node to the topology
-	m.State.InternalNdfLock.Lock()
-	networkDef := m.State.GetUnprunedNdf()
+	state.InternalNdfLock.Lock()
+	networkDef := state.GetUnprunedNdf()
 	gateway, n, regTime, err := assembleNdf(regCode)
 	if err != nil {
-		m.State.InternalNdfLock.Unlock()
+		state.InternalNdfLock.Unlock()
 		err := errors.Errorf("unable to assemble topology: %+v", err)
 		jww.ERROR.Print(err.Error())
 		return errors.Errorf("Could not complete registration: %+v", err)
@@ -222,26 +478,26 @@ func (m *RegistrationImpl) completeNodeRegistration(regCode string) error {
 
 	nodeID, err := id.Unmarshal(n.ID)
 	if err != nil {
-		m.State.InternalNdfLock.Unlock()
+		state.InternalNdfLock.Unlock()
 		return errors.WithMessage(err, "Error parsing node ID")
 	}
 
 	m.registrationTimes[*nodeID] = regTime
 	err = m.insertNdf(networkDef, gateway, n, regTime)
 	if err != nil {
-		m.State.InternalNdfLock.Unlock()
+		state.InternalNdfLock.Unlock()
 		return errors.WithMessage(err, "Failed to insert nodes in definition")
 	}
 
 	//set the node as pruned if pruning is not disabled to ensure they have
 	//to be online to get scheduled
 	if !m.params.disableNDFPruning {
-		m.State.SetPrunedNode(nodeID)
+		state.SetPrunedNode(nodeID)
 	}
 
 	// update the internal state with the newly-updated ndf
-	m.State.UpdateInternalNdf(networkDef)
-	m.State.InternalNdfLock.Unlock()
+	state.UpdateInternalNdf(networkDef)
+	state.InternalNdfLock.Unlock()
 
 	// Kick off the network if the minimum number of nodes has been met
 	if uint32(m.numRegistered) == m.params.minimumNodes {
@@ -309,9 +565,21 @@ func assembleNdf(code string) (ndf.Gateway, ndf.Node, int64, error) {
 				" code %+v: %+v", code, err)
 	}
 
+	nodeID, gateway, n, err := buildNdfEntries(nodeInfo)
+	if err != nil {
+		return ndf.Gateway{}, ndf.Node{}, 0, err
+	}
+
+	jww.INFO.Printf("Node %s (AppID: %d) registered with code %s", nodeID, nodeInfo.ApplicationId, code)
+
+	return gateway, n, nodeInfo.DateRegistered.UnixNano(), nil
+}
+
+// Build the NDF entries of the node and its gateway from its stored information
+func buildNdfEntries(nodeInfo *storage.Node) (*id.ID, ndf.Gateway, ndf.Node, error) {
 	nodeID, err := id.Unmarshal(nodeInfo.Id)
 	if err != nil {
-		return ndf.Gateway{}, ndf.Node{}, 0, errors.Errorf("Error parsing node ID: %v", err)
+		return nil, ndf.Gateway{}, ndf.Node{}, errors.Errorf("Error parsing node ID: %v", err)
 	}
 
 	n := ndf.Node{
@@ -320,14 +588,16 @@ func assembleNdf(code string) (ndf.Gateway, ndf.Node, int64, error) {
 		TlsCertificate: nodeInfo.NodeCertificate,
 	}
 
-	jww.INFO.Printf("Node %s (AppID: %d) registered with code %s", nodeID, nodeInfo.ApplicationId, code)
-
 	gwID := nodeID.DeepCopy()
 	gwID.SetType(id.Gateway)
 
-	bin, exists := region.GetCountryBin(nodeInfo.Sequence)
+	sequence, err := node.ParseSequence(nodeInfo.Sequence)
+	if err != nil {
+		return nil, ndf.Gateway{}, ndf.Node{}, err
+	}
+	bin, exists := region.GetCountryBin(sequence.Region)
 	if !exists {
-		return ndf.Gateway{}, ndf.Node{}, 0,
+		return nil, ndf.Gateway{}, ndf.Node{},
 			errors.Errorf("Error parsing node sequence %s, countru does not exist", nodeInfo.Sequence)
 	}
 
@@ -338,5 +608,5 @@ func assembleNdf(code string) (ndf.Gateway, ndf.Node, int64, error) {
 		Bin:            bin,
 	}
 
-	return gateway, n, nodeInfo.DateRegistered.UnixNano(), nil
+	return nodeID, gateway, n, nil
 }
@@ -14,6 +14,7 @@ import (
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/utils"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -85,7 +86,7 @@ func TestLoadAllRegisteredNodes(t *testing.T) {
 	testParams := Params{
 		CertPath:           testkeys.GetCACertPath(),
 		KeyPath:            testkeys.GetCAKeyPath(),
-		FullNdfOutputPath:  testkeys.GetNDFPath(),
+		FullNdfOutputPath:  filepath.Join(t.TempDir(), "ndf.json"),
 		udbCertPath:        testkeys.GetUdbCertPath(),
 		NsCertPath:         testkeys.GetUdbCertPath(),
 		WhitelistedIdsPath: testkeys.GetPreApprovedPath(),
@@ -94,7 +95,7 @@ func TestLoadAllRegisteredNodes(t *testing.T) {
 	}
 
 	// Start registration server
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(&testParams)
 	if err != nil {
 		t.Fatal(err)
 	}
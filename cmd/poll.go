@@ -15,6 +15,7 @@ import (
 	jww "github.com/spf13/jwalterweatherman"
 	pb "gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/primitives/states"
 	"gitlab.com/elixxir/primitives/version"
 	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/node"
@@ -47,6 +48,12 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 			"is nil, poll cannot be processed")
 	}
 
+	// Stop accepting polls once shutting down
+	if atomic.LoadUint32(&m.shuttingDown) == 1 {
+		return response, errors.New("Permissioning is shutting down, poll " +
+			"cannot be processed")
+	}
+
 	// Ensure poller is properly authenticated
 	if !auth.IsAuthenticated {
 		return response, connect.AuthError(auth.Sender.GetId())
@@ -60,35 +67,51 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 
 	// Get the nodeState and update
 	nid := auth.Sender.GetId()
-	n := m.State.GetNodeMap().GetNode(nid)
-	if n == nil {
+	state := m.getNodeNetworkState(nid)
+	if state == nil {
 		err = errors.Errorf("Node %s could not be found in internal state "+
 			"tracker", nid)
 		return response, err
 	}
+	n := state.GetNodeMap().GetNode(nid)
 
 	// Check if the node has been deemed out of network
 	if n.IsBanned() {
 		return response, errors.Errorf("Node %s has been banned from the network", nid)
 	}
 
+	// Reject nodes whose certificate has been revoked
+	if err = m.checkNodeCert(nid); err != nil {
+		return response, err
+	}
+
+	// A decommissioned node may only poll until its last round completes
+	if n.IsDecommissioned() {
+		if hasRound, _ := n.GetCurrentRound(); !hasRound {
+			return response, errors.Errorf("Node %s has been decommissioned "+
+				"from the network", nid)
+		}
+	}
+
 	activity := current.Activity(msg.Activity)
 
 	// update ip addresses if necessary
-	err = checkIPAddresses(m, n, msg, auth.Sender)
+	err = checkIPAddresses(state, n, msg, auth.Sender,
+		m.params.allowDuplicateAddresses)
 	if err != nil {
 		err = errors.WithMessage(err, "Failed to update IP addresses")
 		return response, err
 	}
 
 	// Check the node's connectivity
-	continuePoll, err := m.checkConnectivity(n, auth.IpAddress, activity)
+	continuePoll, err := m.checkConnectivity(state, n, auth.IpAddress, activity)
 	if err != nil || !continuePoll {
 		return response, err
 	}
 
 	// Increment the Node's poll count
 	n.IncrementNumPolls()
+	m.lastActive.add(nid)
 
 	// Ensure the NDF is ready to be returned
 	regComplete := atomic.LoadUint32(m.NdfReady)
@@ -97,20 +120,27 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 	}
 
 	// Return updated NDF if provided hash does not match current NDF hash
-	if isSame := m.State.GetFullNdf().CompareHash(msg.Full.Hash); !isSame {
+	isSame := state.GetFullNdf().CompareHash(msg.Full.Hash)
+	checkNdfFreshness(n, msg.Full.Hash, isSame, m.params.maxStaleNdfPolls)
+	if !isSame {
 		jww.TRACE.Printf("Returning a new NDF to a back-end server!")
 
 		// Return the updated NDFs
-		response.FullNDF = m.State.GetFullNdf().GetPb()
-		response.PartialNDF = m.State.GetPartialNdf().GetPb()
+		response.FullNDF = state.GetFullNdf().GetPb()
+		response.PartialNDF = state.GetPartialNdf().GetPb()
 	}
 
 	// Fetch the latest round updates
-	response.Updates, err = m.State.GetUpdates(int(msg.LastUpdate))
+	response.Updates, err = state.GetUpdates(int(msg.LastUpdate))
 	if err != nil {
 		return response, err
 	}
 
+	// Return no more updates than the limit; the node receives the rest in
+	// its next polls
+	response.Updates = limitPollUpdates(response.Updates,
+		m.params.maxUpdatesPerPoll)
+
 	// Commit updates reported by the node if node involved in the current round
 	jww.TRACE.Printf("Updating state for node %s: %+v",
 		auth.Sender.GetId(), msg)
@@ -137,7 +167,7 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 	}
 
 	//check if the node is pruned if it is, bail
-	if m.State.IsPruned(n.GetID()) {
+	if state.IsPruned(n.GetID()) {
 		return response, err
 	}
 
@@ -147,6 +177,13 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 	// processing completes
 	n.GetPollingLock().Lock()
 
+	// Tell a node still reporting progress in a round that has failed, so it
+	// can reset without waiting to reach the failure in its round updates
+	if m.params.notifyFailedRounds {
+		response.Updates = addRoundFailure(state, n, activity,
+			response.Updates)
+	}
+
 	// update does edge checking. It ensures the state change received was a
 	// valid one and the state of the node and
 	// any associated round allows for that change. If the change was not
@@ -165,7 +202,7 @@ func (m *RegistrationImpl) Poll(msg *pb.PermissioningPoll, auth *connect.Auth) (
 	updateNotification.ClientErrors = msg.ClientErrors
 
 	// Update occurred, report it to the control thread
-	return response, m.State.SendUpdateNotification(updateNotification)
+	return response, state.SendUpdateNotification(updateNotification)
 }
 
 // PollNdf handles the client polling for an updated NDF
@@ -187,6 +224,75 @@ func (m *RegistrationImpl) PollNdf(theirNdfHash []byte) (*pb.NDF, error) {
 	return m.State.GetPartialNdf().GetPb(), nil
 }
 
+// PollNdfBySignature handles a client polling for an updated NDF signed with
+// the requested key. If useEcc is set, the partial NDF signed with the elliptic
+// curve key is returned. Otherwise, the RSA signed partial NDF is returned, as
+// done by PollNdf. The EdDSA signed NDF is served over HTTP at eccNdfPath.
+func (m *RegistrationImpl) PollNdfBySignature(theirNdfHash []byte,
+	useEcc bool) (*pb.NDF, *storage.EccSignedNdf, error) {
+	if !useEcc {
+		rsaNdf, err := m.PollNdf(theirNdfHash)
+		return rsaNdf, nil, err
+	}
+
+	// Ensure the NDF is ready to be returned
+	regComplete := atomic.LoadUint32(m.NdfReady)
+	if regComplete != 1 {
+		return nil, nil, errors.New(ndf.NO_NDF)
+	}
+
+	// Do not return NDF if backend hash matches. Both signed NDFs contain the
+	// same NDF, so the hash of the RSA signed NDF is used for both.
+	if isSame := m.State.GetPartialNdf().CompareHash(theirNdfHash); isSame {
+		return nil, &storage.EccSignedNdf{}, nil
+	}
+
+	jww.TRACE.Printf("Returning a new EdDSA signed NDF to a back-end server!")
+	return nil, m.State.GetPartialEccNdf(), nil
+}
+
+// GetSignedEllipticPublicKey returns the server's elliptic curve public key,
+// used to verify EdDSA signed round updates, signed with the server's RSA key.
+// Served over HTTP at ellipticKeyPath.
+func (m *RegistrationImpl) GetSignedEllipticPublicKey() (
+	*storage.SignedEllipticKey, error) {
+	signedKey := m.State.GetSignedEllipticPublicKey()
+	if signedKey == nil {
+		return nil, errors.New("Elliptic public key has not been signed")
+	}
+
+	return signedKey, nil
+}
+
+// PollNdfDiff handles a client polling for the changes to the NDF since the
+// NDF with the given hash. If the hash is recent enough, the diff to the
+// current partial NDF is returned. Otherwise, the full partial NDF is returned
+// as a fallback. Both are nil if the caller's NDF is already up-to-date. Served
+// over HTTP at ndfDiffPath.
+func (m *RegistrationImpl) PollNdfDiff(theirNdfHash []byte) (
+	*storage.NdfDiff, *pb.NDF, error) {
+
+	// Ensure the NDF is ready to be returned
+	regComplete := atomic.LoadUint32(m.NdfReady)
+	if regComplete != 1 {
+		return nil, nil, errors.New(ndf.NO_NDF)
+	}
+
+	// Do not return anything if backend hash matches
+	if isSame := m.State.GetPartialNdf().CompareHash(theirNdfHash); isSame {
+		return nil, nil, nil
+	}
+
+	if diff, ok := m.State.GetPartialNdfDiff(theirNdfHash); ok {
+		jww.TRACE.Printf("Returning an NDF diff to a back-end server!")
+		return diff, nil, nil
+	}
+
+	jww.TRACE.Printf("Unable to diff NDF, returning the full NDF to a " +
+		"back-end server!")
+	return nil, m.State.GetPartialNdf().GetPb(), nil
+}
+
 // checkVersion checks if the PermissioningPoll message server and gateway
 // versions are compatible with the required version.
 func checkVersion(p *Params, msg *pb.PermissioningPoll) error {
@@ -198,8 +304,11 @@ func checkVersion(p *Params, msg *pb.PermissioningPoll) error {
 	p.versionLock.RUnlock()
 
 	// Skip checking gateway if the server is polled before gateway resulting in
-	// a blank gateway version
-	if msg.GetGatewayVersion() != "" {
+	// a blank gateway version, unless the gateway version is required
+	if msg.GetGatewayVersion() == "" && p.requireGatewayVersion {
+		return errors.Errorf("The gateway version is required to be at "+
+			"least %#v but none was reported.", requiredGateway.String())
+	} else if msg.GetGatewayVersion() != "" {
 		// Parse the gateway version string
 		gatewayVersion, err := version.ParseVersion(msg.GetGatewayVersion())
 		if err != nil {
@@ -235,6 +344,79 @@ func checkVersion(p *Params, msg *pb.PermissioningPoll) error {
 	return nil
 }
 
+// checkNdfFreshness records the NDF hash reported by the node and flags the
+// node once it has reported an outdated NDF in maxStalePolls consecutive polls,
+// as it is not applying the NDFs returned to it. The node is only flagged once
+// per run of stale polls. Returns true if the node has reached the limit. The
+// check is disabled when maxStalePolls is 0.
+func checkNdfFreshness(n *node.State, hash []byte, isCurrent bool,
+	maxStalePolls uint32) bool {
+	stalePolls := n.RecordNdfHash(hash, isCurrent)
+	if maxStalePolls == 0 || stalePolls < maxStalePolls {
+		return false
+	}
+
+	if stalePolls == maxStalePolls {
+		_, since := n.GetNdfHash()
+		jww.WARN.Printf("Node %s has polled with an outdated NDF %d times in "+
+			"a row and has reported the same NDF since %s", n.GetID(),
+			stalePolls, since)
+	}
+
+	return true
+}
+
+// addRoundFailure returns the updates with the signed FAILED update of the
+// node's round added first if the round has failed while the node reports an
+// activity other than ERROR and the update is not already included. It is
+// added first so that the last update, which the node resumes polling from, is
+// unchanged. The updates are returned as is if the FAILED update is no longer
+// held.
+func addRoundFailure(state *storage.NetworkState, n *node.State,
+	activity current.Activity, updates []*pb.RoundInfo) []*pb.RoundInfo {
+	if activity == current.ERROR {
+		return updates
+	}
+
+	hasRound, r := n.GetCurrentRound()
+	if !hasRound || r.GetRoundState() != states.FAILED {
+		return updates
+	}
+
+	isFailure := func(update *pb.RoundInfo) bool {
+		return id.Round(update.ID) == r.GetRoundID() &&
+			states.Round(update.State) == states.FAILED
+	}
+	for _, update := range updates {
+		if isFailure(update) {
+			return updates
+		}
+	}
+
+	history, err := state.GetRoundUpdateHistory(r.GetRoundID())
+	if err != nil {
+		jww.DEBUG.Printf("Could not notify node %s of the failure of round "+
+			"%d: %+v", n.GetID(), r.GetRoundID(), err)
+		return updates
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if isFailure(history[i]) {
+			return append([]*pb.RoundInfo{history[i]}, updates...)
+		}
+	}
+
+	return updates
+}
+
+// limitPollUpdates returns the oldest updates up to the limit, so that the
+// updates after them are returned in later polls. The limit is ignored when 0.
+func limitPollUpdates(updates []*pb.RoundInfo, limit uint32) []*pb.RoundInfo {
+	if limit == 0 || uint32(len(updates)) <= limit {
+		return updates
+	}
+	return updates[:limit]
+}
+
 func updateNdfEd25519(nid *id.ID, ed []byte, ndf *ndf.NetworkDefinition) error {
 	for i, n := range ndf.Nodes {
 		if bytes.Equal(n.ID, nid[:]) {
@@ -317,8 +499,15 @@ func verifyError(msg *pb.PermissioningPoll, n *node.State, m *RegistrationImpl)
 	return nil
 }
 
-func checkIPAddresses(m *RegistrationImpl, n *node.State,
-	msg *pb.PermissioningPoll, nodeHost *connect.Host) error {
+// checkIPAddresses updates the node and gateway addresses of the node, its host,
+// and the NDF to the addresses in the poll if they have changed. A new address
+// that is already assigned to another node is rejected, unless allowDuplicates
+// is set, in which case a warning is logged. New addresses are validated and
+// stored before they are claimed in the state, and the stored addresses are
+// restored if the claim fails.
+func checkIPAddresses(state *storage.NetworkState, n *node.State,
+	msg *pb.PermissioningPoll, nodeHost *connect.Host,
+	allowDuplicates bool) error {
 
 	// Pull the addresses out of the message
 	gatewayAddress, nodeAddress := msg.GatewayAddress, msg.ServerAddress
@@ -329,52 +518,79 @@ func checkIPAddresses(m *RegistrationImpl, n *node.State,
 			"gateway and node address of: %s and %s", nodeAddress, gatewayAddress)
 	}
 
-	// Update server and gateway addresses in state, if necessary
-	nodeUpdate, err := n.UpdateNodeAddresses(nodeAddress)
-	if err != nil {
-		return err
-	}
-	gatewayUpdate, err := n.UpdateGatewayAddresses(gatewayAddress)
-	if err != nil {
-		return err
+	// Validate the addresses that changed
+	oldNodeAddress, oldGatewayAddress := n.GetNodeAddresses(), n.GetGatewayAddress()
+	var changed []string
+	if nodeAddress != oldNodeAddress {
+		changed = append(changed, nodeAddress)
 	}
-	edUpdate, err := n.UpdateEd25519Key(msg.Ed25519)
-	if err != nil {
-		return err
+	if gatewayAddress != "" && gatewayAddress != oldGatewayAddress {
+		changed = append(changed, gatewayAddress)
 	}
-
-	// If state required changes, then check the NDF
-	if nodeUpdate || gatewayUpdate || edUpdate {
-		jww.TRACE.Printf("UPDATING gateway and node update: %s, %s", msg.ServerAddress,
-			gatewayAddress)
-
-		if nodeUpdate && !utils.IsIP(nodeAddress) {
-			err := utils.IsDomainName(nodeAddress)
-			if err != nil {
+	for _, address := range changed {
+		if !utils.IsIP(address) {
+			if err := utils.IsDomainName(address); err != nil {
 				return err
 			}
 		}
+	}
 
-		if gatewayUpdate && !utils.IsIP(gatewayAddress) {
-			err := utils.IsDomainName(gatewayAddress)
+	var claim node.AddressClaim
+	if len(changed) != 0 {
+		// Reject an address assigned to another node before storing it
+		if !allowDuplicates {
+			err := checkAddressesUnassigned(n.GetID(),
+				state.GetNodeMap().GetAddressOwner, false, changed...)
 			if err != nil {
 				return err
 			}
 		}
 
 		// Update address information in Storage
-		err := storage.PermissioningDb.UpdateNodeAddresses(nodeHost.GetId(), nodeAddress, gatewayAddress)
+		err := storage.PermissioningDb.UpdateNodeAddresses(nodeHost.GetId(),
+			nodeAddress, gatewayAddress)
+		if err != nil {
+			return err
+		}
+
+		// Check and take the addresses in one operation, as another node may
+		// have taken one since it was checked
+		claim, err = state.GetNodeMap().ClaimAddresses(n.GetID(),
+			nodeAddress, gatewayAddress, allowDuplicates)
+		if err == nil {
+			owner := func(address string) *id.ID { return claim.Owners[address] }
+			err = checkAddressesUnassigned(n.GetID(), owner, allowDuplicates,
+				changed...)
+		}
 		if err != nil {
+			restoreErr := storage.PermissioningDb.UpdateNodeAddresses(
+				nodeHost.GetId(), n.GetNodeAddresses(), n.GetGatewayAddress())
+			if restoreErr != nil {
+				jww.ERROR.Printf("Failed to restore the stored addresses of "+
+					"node %s: %+v", n.GetID(), restoreErr)
+			}
 			return err
 		}
+	}
 
-		m.State.InternalNdfLock.Lock()
-		currentNDF := m.State.GetUnprunedNdf()
+	edUpdate, err := n.UpdateEd25519Key(msg.Ed25519)
+	if err != nil {
+		return err
+	}
+	nodeUpdate, gatewayUpdate := claim.NodeUpdate, claim.GatewayUpdate
+
+	// If state required changes, then check the NDF
+	if nodeUpdate || gatewayUpdate || edUpdate {
+		jww.TRACE.Printf("UPDATING gateway and node update: %s, %s", msg.ServerAddress,
+			gatewayAddress)
+
+		state.InternalNdfLock.Lock()
+		currentNDF := state.GetUnprunedNdf()
 
 		if currentNDF == nil {
-			m.State.InternalNdfLock.Unlock()
+			state.InternalNdfLock.Unlock()
 			return errors.New("Received nil ndf from" +
-				" m.State.GetUnprunedNdf")
+				" state.GetUnprunedNdf")
 		}
 
 		n.SetConnectivity(node.PortUnknown)
@@ -382,39 +598,43 @@ func checkIPAddresses(m *RegistrationImpl, n *node.State,
 		if nodeUpdate {
 			nodeHost.UpdateAddress(nodeAddress)
 			if err := updateNdfNodeAddr(n.GetID(), nodeAddress, currentNDF); err != nil {
-				m.State.InternalNdfLock.Unlock()
+				state.InternalNdfLock.Unlock()
 				return err
 			}
 		}
 
 		if gatewayUpdate {
 			if err := updateNdfGatewayAddr(n.GetID(), gatewayAddress, currentNDF); err != nil {
-				m.State.InternalNdfLock.Unlock()
+				state.InternalNdfLock.Unlock()
 				return err
 			}
 		}
 
 		if edUpdate {
 			if err := updateNdfEd25519(n.GetID(), msg.Ed25519, currentNDF); err != nil {
-				m.State.InternalNdfLock.Unlock()
+				state.InternalNdfLock.Unlock()
 				return err
 			}
 		}
 
 		// Update the internal state with the newly-updated ndf
-		m.State.UpdateInternalNdf(currentNDF)
-		m.State.InternalNdfLock.Unlock()
+		state.UpdateInternalNdf(currentNDF)
+		state.InternalNdfLock.Unlock()
+
+		// Output the change; changes from many polls are written together
+		state.QueueOutputNdfUpdate()
 	}
 
 	return nil
 }
 
 // checkConnectivity handles the responses to the different connectivity states
-// of a node. If the returned boolean is true, then the poll should continue.
+// of a node in the network tracked by the state. If the returned boolean is
+// true, then the poll should continue.
 // The nodeIpAddr is the IP of the node when it connects to permissioning; it
 // is not the IP or domain name reported by the node.
-func (m *RegistrationImpl) checkConnectivity(n *node.State, nodeIpAddr string,
-	activity current.Activity) (bool, error) {
+func (m *RegistrationImpl) checkConnectivity(state *storage.NetworkState,
+	n *node.State, nodeIpAddr string, activity current.Activity) (bool, error) {
 
 	switch n.GetConnectivity() {
 	case node.PortUnknown:
@@ -451,6 +671,12 @@ func (m *RegistrationImpl) checkConnectivity(n *node.State, nodeIpAddr string,
 					isOnline
 			}
 
+			// A node whose gateway cannot be reached stays in the NDF as
+			// GatewayUnreachable without a gateway address so that clients do
+			// not attempt to contact it
+			state.SetGatewayReachable(n.GetID(),
+				gwPing && n.GetGatewayAddress() != "")
+
 			if nodePing && gwPing {
 				// If connection was successful, mark the port as forwarded
 				n.SetConnectivity(node.PortSuccessful)
@@ -27,6 +27,7 @@ import (
 	"gitlab.com/xx_network/primitives/ndf"
 	"gitlab.com/xx_network/primitives/region"
 	"gitlab.com/xx_network/primitives/utils"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -56,7 +57,7 @@ func TestRegistrationImpl_Poll_NDF(t *testing.T) {
 	// Start registration server
 	testParams.KeyPath = testkeys.GetCAKeyPath()
 	testParams.WhitelistedIdsPath = testkeys.GetPreApprovedPath()
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf("Unable to start registration: %+v", err)
 	}
@@ -136,12 +137,129 @@ func TestRegistrationImpl_Poll_NDF(t *testing.T) {
 	impl.Comms.Shutdown()
 }
 
+// Tests that Poll() counts the consecutive polls in which a node reports an
+// outdated NDF and resets the count once the node reports the current NDF.
+func TestRegistrationImpl_Poll_StaleNdf(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	testID := id.NewIdFromUInt(0, id.Node, t)
+	testString := "test"
+	testParams.KeyPath = testkeys.GetCAKeyPath()
+	testParams.WhitelistedIdsPath = testkeys.GetPreApprovedPath()
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Fatalf("Unable to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+	atomic.CompareAndSwapUint32(impl.NdfReady, 0, 1)
+	impl.params.disablePing = true
+	impl.params.maxStaleNdfPolls = 3
+
+	impl.State.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "420"},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()},
+		},
+		Nodes: []ndf.Node{{ID: testID.Bytes()}},
+	})
+	err = impl.State.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update ndf: %+v", err)
+	}
+
+	testHost, _ := impl.Comms.AddHost(testID, testString,
+		make([]byte, 0), connect.GetDefaultHostParams())
+	testAuth := &connect.Auth{
+		IsAuthenticated: true,
+		Sender:          testHost,
+	}
+
+	err = impl.State.GetNodeMap().AddNode(testID, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("Could not add node: %+v", err)
+	}
+	n := impl.State.GetNodeMap().GetNode(testID)
+	n.SetConnectivity(node.PortSuccessful)
+
+	newPoll := func(hash []byte) *pb.PermissioningPoll {
+		return &pb.PermissioningPoll{
+			Full:           &pb.NDFHash{Hash: hash},
+			Partial:        &pb.NDFHash{Hash: hash},
+			Activity:       uint32(current.NOT_STARTED),
+			GatewayVersion: "1.1.0",
+			ServerVersion:  "1.1.0",
+		}
+	}
+
+	// The node keeps polling with an outdated NDF despite being sent the
+	// current one
+	for i := uint32(1); i <= impl.params.maxStaleNdfPolls+1; i++ {
+		response, err := impl.Poll(newPoll([]byte(testString)), testAuth)
+		if err != nil {
+			t.Fatalf("Unexpected error for poll %d: %+v", i, err)
+		}
+		if response.FullNDF == nil {
+			t.Errorf("No NDF provided for poll %d.", i)
+		}
+		if n.GetStaleNdfPolls() != i {
+			t.Errorf("Unexpected number of stale polls after poll %d."+
+				"\n\texpected: %d\n\treceived: %d", i, i,
+				n.GetStaleNdfPolls())
+		}
+	}
+
+	_, err = impl.Poll(newPoll(impl.State.GetFullNdf().GetHash()), testAuth)
+	if err != nil {
+		t.Fatalf("Unexpected error polling with current NDF: %+v", err)
+	}
+	if n.GetStaleNdfPolls() != 0 {
+		t.Errorf("Stale polls not reset after polling with current NDF."+
+			"\n\texpected: %d\n\treceived: %d", 0, n.GetStaleNdfPolls())
+	}
+}
+
+// Tests that checkNdfFreshness() flags a node once it reaches the limit of
+// consecutive stale polls until it reports the current NDF.
+func TestCheckNdfFreshness(t *testing.T) {
+	nodeMap := node.NewStateMap()
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	err := nodeMap.AddNode(nid, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("Could not add node: %+v", err)
+	}
+	n := nodeMap.GetNode(nid)
+
+	const maxStalePolls = 3
+	expected := []bool{false, false, true, true}
+	for i, flag := range expected {
+		if checkNdfFreshness(n, []byte("old"), false, maxStalePolls) != flag {
+			t.Errorf("Unexpected flag for stale poll %d."+
+				"\n\texpected: %t\n\treceived: %t", i+1, flag, !flag)
+		}
+	}
+
+	if checkNdfFreshness(n, []byte("new"), true, maxStalePolls) {
+		t.Errorf("Node flagged after reporting the current NDF.")
+	}
+
+	// The check is disabled when the limit is zero
+	for i := 0; i < maxStalePolls+1; i++ {
+		if checkNdfFreshness(n, []byte("old"), false, 0) {
+			t.Errorf("Node flagged with the check disabled on poll %d.", i+1)
+		}
+	}
+}
+
 func TestRegistrationImpl_Poll_Round(t *testing.T) {
 	testID := id.NewIdFromUInt(0, id.Node, t)
 	testString := "test"
 	// Start registration server
 	testParams.KeyPath = testkeys.GetCAKeyPath()
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf("Unable to start registration: %+v", err)
 	}
@@ -227,6 +345,205 @@ func TestRegistrationImpl_Poll_Round(t *testing.T) {
 	impl.Comms.Shutdown()
 }
 
+// Tests that Poll() returns no more round updates than the configured
+// maximum, oldest first, and returns the rest in the next poll.
+func TestRegistrationImpl_Poll_MaxUpdates(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	testID := id.NewIdFromUInt(0, id.Node, t)
+	testString := "test"
+	// Start registration server
+	testParams.KeyPath = testkeys.GetCAKeyPath()
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Fatalf("Unable to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+	atomic.CompareAndSwapUint32(impl.NdfReady, 0, 1)
+	impl.params.disablePing = true
+	impl.params.maxUpdatesPerPoll = 3
+
+	impl.State.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "420"},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()},
+		},
+		Nodes: []ndf.Node{
+			{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()},
+		},
+	})
+	err = impl.State.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+
+	testHost, _ := impl.Comms.AddHost(testID, testString,
+		make([]byte, 0), connect.GetDefaultHostParams())
+	testAuth := &connect.Auth{IsAuthenticated: true, Sender: testHost}
+
+	err = impl.State.GetNodeMap().AddNode(testID, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("Could not add node: %+v", err)
+	}
+	impl.State.GetNodeMap().GetNode(testID).SetConnectivity(
+		node.PortSuccessful)
+
+	// Queue more updates than are returned in a poll
+	const numUpdates = 5
+	for i := 1; i <= numUpdates; i++ {
+		err = impl.State.AddRoundUpdate(&pb.RoundInfo{
+			ID:         uint64(i),
+			State:      uint32(states.PRECOMPUTING),
+			Timestamps: make([]uint64, states.FAILED),
+		})
+		if err != nil {
+			t.Fatalf("Could not add round update: %+v", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		updates, _ := impl.State.GetUpdates(0)
+		if len(updates) == numUpdates {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	testMsg := &pb.PermissioningPoll{
+		Full:           &pb.NDFHash{Hash: impl.State.GetFullNdf().GetHash()},
+		Partial:        &pb.NDFHash{Hash: []byte(testString)},
+		Activity:       uint32(current.NOT_STARTED),
+		GatewayVersion: "1.1.0",
+		ServerVersion:  "1.1.0",
+	}
+
+	// Each poll returns the oldest updates the node has not received. The node
+	// does not change activity, so its polls are not held until the scheduler
+	// handles the change.
+	for _, expected := range [][]uint64{{1, 2, 3}, {4, 5}} {
+		response, err := impl.Poll(testMsg, testAuth)
+		if err != nil {
+			t.Fatalf("Unexpected error polling: %+v", err)
+		}
+
+		received := make([]uint64, len(response.GetUpdates()))
+		for i, update := range response.GetUpdates() {
+			received[i] = update.ID
+		}
+		if !reflect.DeepEqual(received, expected) {
+			t.Errorf("Unexpected rounds of the returned updates."+
+				"\n\texpected: %v\n\treceived: %v", expected, received)
+		}
+
+		if len(response.GetUpdates()) > 0 {
+			testMsg.LastUpdate = response.GetUpdates()[len(received)-1].UpdateID
+		}
+	}
+}
+
+// Tests that addRoundFailure() adds the FAILED update of a node's round first
+// when the node reports progress in the round after it was killed, and leaves
+// the updates unchanged when the node is in ERROR or already receives it.
+func Test_addRoundFailure(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+	state, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	if err = state.GetNodeMap().AddNode(nid, "", "", "", 0); err != nil {
+		t.Fatalf("Could not add node: %+v", err)
+	}
+	n := state.GetNodeMap().GetNode(nid)
+
+	// The node's round is killed while it is precomputing
+	if _, _, err = n.Update(current.WAITING); err != nil {
+		t.Fatalf("Failed to update node to WAITING: %+v", err)
+	}
+	r := round.NewState_Testing(42, states.PRECOMPUTING, nil, t)
+	if err = n.SetRound(r); err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	if _, _, err = n.Update(current.PRECOMPUTING); err != nil {
+		t.Fatalf("Failed to update node to PRECOMPUTING: %+v", err)
+	}
+	r.AppendError(&pb.RoundError{Id: 42, Error: "round timed out"})
+	if err = r.Update(states.FAILED, time.Now()); err != nil {
+		t.Fatalf("Failed to fail round: %+v", err)
+	}
+	if err = state.AddRoundUpdate(r.BuildRoundInfo()); err != nil {
+		t.Fatalf("Failed to add round update: %+v", err)
+	}
+
+	var history []*pb.RoundInfo
+	for timeout := time.After(time.Second); len(history) == 0; {
+		select {
+		case <-timeout:
+			t.Fatalf("Round update not added: %+v", err)
+		case <-time.After(5 * time.Millisecond):
+			history, err = state.GetRoundUpdateHistory(42)
+		}
+	}
+	failure := history[0]
+	latest := &pb.RoundInfo{ID: 43, UpdateID: failure.UpdateID + 1}
+
+	updates := addRoundFailure(state, n, current.STANDBY,
+		[]*pb.RoundInfo{latest})
+	if !reflect.DeepEqual(updates, []*pb.RoundInfo{failure, latest}) {
+		t.Errorf("FAILED update not added first.\n\texpected: %v"+
+			"\n\treceived: %v", []*pb.RoundInfo{failure, latest}, updates)
+	}
+
+	for _, tt := range []struct {
+		activity current.Activity
+		updates  []*pb.RoundInfo
+	}{
+		{current.ERROR, []*pb.RoundInfo{latest}},
+		{current.STANDBY, []*pb.RoundInfo{failure, latest}},
+	} {
+		updates = addRoundFailure(state, n, tt.activity, tt.updates)
+		if !reflect.DeepEqual(updates, tt.updates) {
+			t.Errorf("Updates changed for a node in %s.\n\texpected: %v"+
+				"\n\treceived: %v", tt.activity, tt.updates, updates)
+		}
+	}
+}
+
+// Tests that limitPollUpdates() returns the oldest updates up to the limit.
+func TestLimitPollUpdates(t *testing.T) {
+	updates := make([]*pb.RoundInfo, 5)
+	for i := range updates {
+		updates[i] = &pb.RoundInfo{ID: uint64(i)}
+	}
+
+	tests := []struct {
+		limit    uint32
+		expected int
+	}{
+		{0, 5},
+		{3, 3},
+		{5, 5},
+		{10, 5},
+	}
+	for i, tt := range tests {
+		limited := limitPollUpdates(updates, tt.limit)
+		if !reflect.DeepEqual(limited, updates[:tt.expected]) {
+			t.Errorf("Unexpected updates returned for test %d with limit %d."+
+				"\n\texpected: %d updates\n\treceived: %d updates",
+				i, tt.limit, tt.expected, len(limited))
+		}
+	}
+}
+
 /*// Error path: Ndf not ready
 func TestRegistrationImpl_PollNoNdf(t *testing.T) {
 
@@ -290,7 +607,7 @@ func TestRegistrationImpl_PollNdf(t *testing.T) {
 	RegParams.minimumNodes = 3
 	RegParams.disableNDFPruning = true
 	// Start registration server
-	impl, err := StartRegistration(RegParams)
+	impl, err := StartRegistration(&RegParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -397,7 +714,7 @@ func TestRegistrationImpl_PollNdf_NoNDF(t *testing.T) {
 	RegParams.minimumNodes = 3
 	RegParams.disableNDFPruning = true
 	// Start registration server
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -425,6 +742,185 @@ func TestRegistrationImpl_PollNdf_NoNDF(t *testing.T) {
 	}
 }
 
+// Tests that PollNdfDiff() returns a diff for a recent NDF hash, the full NDF
+// for an unknown hash, and nothing for the current hash.
+func TestRegistrationImpl_PollNdfDiff(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	ndfReady := uint32(0)
+	impl := &RegistrationImpl{State: testState, NdfReady: &ndfReady}
+
+	_, _, err = impl.PollNdfDiff(nil)
+	if err == nil || err.Error() != ndf.NO_NDF {
+		t.Errorf("PollNdfDiff() did not return the expected error when the "+
+			"NDF is not ready.\n\texpected: %s\n\treceived: %+v", ndf.NO_NDF, err)
+	}
+	atomic.StoreUint32(impl.NdfReady, 1)
+
+	testNdf := &ndf.NetworkDefinition{
+		Nodes:    []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	}
+	testState.UpdateInternalNdf(testNdf)
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+	oldHash := testState.GetPartialNdf().GetHash()
+
+	testNdf.Nodes = append(testNdf.Nodes,
+		ndf.Node{ID: id.NewIdFromUInt(1, id.Node, t).Bytes()})
+	testNdf.Gateways = append(testNdf.Gateways,
+		ndf.Gateway{ID: id.NewIdFromUInt(1, id.Gateway, t).Bytes()})
+	testState.UpdateInternalNdf(testNdf)
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+
+	// Recent hash returns a diff
+	diff, fullNdf, err := impl.PollNdfDiff(oldHash)
+	if err != nil {
+		t.Errorf("PollNdfDiff() returned an error: %+v", err)
+	}
+	if diff == nil || fullNdf != nil || len(diff.AddedNodes) != 1 {
+		t.Errorf("PollNdfDiff() did not return the expected diff."+
+			"\n\tdiff: %+v\n\tndf: %+v", diff, fullNdf)
+	}
+
+	// Unknown hash falls back to the full NDF
+	diff, fullNdf, err = impl.PollNdfDiff([]byte("unknown"))
+	if err != nil {
+		t.Errorf("PollNdfDiff() returned an error: %+v", err)
+	}
+	if diff != nil || fullNdf != testState.GetPartialNdf().GetPb() {
+		t.Errorf("PollNdfDiff() did not fall back to the full NDF."+
+			"\n\tdiff: %+v\n\tndf: %+v", diff, fullNdf)
+	}
+
+	// Current hash returns nothing
+	diff, fullNdf, err = impl.PollNdfDiff(testState.GetPartialNdf().GetHash())
+	if err != nil || diff != nil || fullNdf != nil {
+		t.Errorf("PollNdfDiff() returned data for an up-to-date NDF."+
+			"\n\tdiff: %+v\n\tndf: %+v\n\terr: %+v", diff, fullNdf, err)
+	}
+}
+
+// Tests that PollNdfBySignature() returns the RSA signed NDF when the elliptic
+// curve signature is not requested and the EdDSA signed NDF when it is.
+func TestRegistrationImpl_PollNdfBySignature(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	ndfReady := uint32(0)
+	impl := &RegistrationImpl{State: testState, NdfReady: &ndfReady}
+
+	_, _, err = impl.PollNdfBySignature(nil, true)
+	if err == nil || err.Error() != ndf.NO_NDF {
+		t.Errorf("PollNdfBySignature() did not return the expected error "+
+			"when the NDF is not ready.\n\texpected: %s\n\treceived: %+v",
+			ndf.NO_NDF, err)
+	}
+	atomic.StoreUint32(impl.NdfReady, 1)
+
+	testState.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Nodes: []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	})
+	if err = testState.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output ndf: %+v", err)
+	}
+
+	// RSA signed NDF
+	rsaNdf, eccNdf, err := impl.PollNdfBySignature(nil, false)
+	if err != nil {
+		t.Errorf("PollNdfBySignature() returned an error: %+v", err)
+	}
+	if eccNdf != nil || rsaNdf != testState.GetPartialNdf().GetPb() {
+		t.Errorf("PollNdfBySignature() did not return the RSA signed NDF."+
+			"\n\trsa: %+v\n\tecc: %+v", rsaNdf, eccNdf)
+	}
+
+	// EdDSA signed NDF
+	rsaNdf, eccNdf, err = impl.PollNdfBySignature(nil, true)
+	if err != nil {
+		t.Errorf("PollNdfBySignature() returned an error: %+v", err)
+	}
+	if rsaNdf != nil || eccNdf != testState.GetPartialEccNdf() {
+		t.Errorf("PollNdfBySignature() did not return the EdDSA signed NDF."+
+			"\n\trsa: %+v\n\tecc: %+v", rsaNdf, eccNdf)
+	}
+	err = signature.VerifyEddsa(eccNdf, testState.GetEllipticPublicKey())
+	if err != nil {
+		t.Errorf("Failed to verify EdDSA signed NDF: %+v", err)
+	}
+
+	// Current hash returns an empty NDF
+	rsaNdf, eccNdf, err = impl.PollNdfBySignature(
+		testState.GetPartialNdf().GetHash(), true)
+	if err != nil || rsaNdf != nil || eccNdf == nil || eccNdf.Ndf != nil {
+		t.Errorf("PollNdfBySignature() returned data for an up-to-date NDF."+
+			"\n\trsa: %+v\n\tecc: %+v\n\terr: %+v", rsaNdf, eccNdf, err)
+	}
+}
+
+// Tests that GetSignedEllipticPublicKey() returns the state's elliptic public
+// key with a valid signature from the server's RSA key, and that the same key
+// is returned on every call.
+func TestRegistrationImpl_GetSignedEllipticPublicKey(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	impl := &RegistrationImpl{State: testState}
+
+	signedKey, err := impl.GetSignedEllipticPublicKey()
+	if err != nil {
+		t.Fatalf("GetSignedEllipticPublicKey() returned an error: %+v", err)
+	}
+
+	expected := testState.GetEllipticPublicKey().Marshal()
+	if !bytes.Equal(expected, signedKey.EllipticPubKey) {
+		t.Errorf("GetSignedEllipticPublicKey() returned the wrong key."+
+			"\n\texpected: %v\n\treceived: %v", expected, signedKey.EllipticPubKey)
+	}
+
+	err = signature.VerifyRsa(signedKey, testState.GetPrivateKey().GetPublic())
+	if err != nil {
+		t.Errorf("Failed to verify signature of elliptic public key: %+v", err)
+	}
+
+	signedKey2, err := impl.GetSignedEllipticPublicKey()
+	if err != nil || signedKey2 != signedKey {
+		t.Errorf("GetSignedEllipticPublicKey() did not return the cached key."+
+			"\n\texpected: %p\n\treceived: %p\n\terr: %+v",
+			signedKey, signedKey2, err)
+	}
+}
+
 func TestPoll_BannedNode(t *testing.T) {
 	//Create database
 	var err error
@@ -445,7 +941,7 @@ func TestPoll_BannedNode(t *testing.T) {
 	// Start registration server
 	testParams.KeyPath = testkeys.GetCAKeyPath()
 	testParams.disableNDFPruning = true
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf("Unable to start registration: %+v", err)
 	}
@@ -632,6 +1128,48 @@ func TestCheckVersion_EmptyVersions(t *testing.T) {
 	}
 }
 
+// Check that checkVersion() rejects a blank gateway version when the gateway
+// version is required and skips the check otherwise.
+func TestCheckVersion_RequireGatewayVersion(t *testing.T) {
+	testMsg := &pb.PermissioningPoll{
+		ServerVersion:  "1.5.6",
+		GatewayVersion: "",
+	}
+
+	requiredServer, _ := version.ParseVersion("1.3.2")
+	requiredGateway, _ := version.ParseVersion("1.3.2")
+
+	for _, required := range []bool{true, false} {
+		p := &Params{
+			minGatewayVersion:     requiredGateway,
+			minServerVersion:      requiredServer,
+			requireGatewayVersion: required,
+		}
+
+		err := checkVersion(p, testMsg)
+		if required && err == nil {
+			t.Errorf("checkVersion() did not error on an empty gateway " +
+				"version when it is required.")
+		} else if !required && err != nil {
+			t.Errorf("checkVersion() unexpectedly errored on an empty "+
+				"gateway version when it is not required: %+v", err)
+		}
+	}
+
+	// A valid gateway version passes when required
+	testMsg.GatewayVersion = "1.4.5"
+	p := &Params{
+		minGatewayVersion:     requiredGateway,
+		minServerVersion:      requiredServer,
+		requireGatewayVersion: true,
+	}
+	err := checkVersion(p, testMsg)
+	if err != nil {
+		t.Errorf("checkVersion() unexpectedly errored on a compatible "+
+			"gateway version: %+v", err)
+	}
+}
+
 // Check that checkVersion() correctly determines the message versions to be
 // compatible with the required version when they are equal.
 func TestCheckVersion_Edge(t *testing.T) {
@@ -795,7 +1333,7 @@ func TestCheckVersion_InvalidVersionGatewayAndServer(t *testing.T) {
 	testString := "test"
 	// Start registration server
 	testParams.KeyPath = testkeys.GetCAKeyPath()
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf("Unable to start registration: %+v", err)
 	}
@@ -0,0 +1,101 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles rebuilding the NDF from storage when the server restarts
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/ndf"
+	"sort"
+)
+
+// rebuildNdfs rebuilds the nodes and gateways of the internal NDF of every
+// network from the active nodes stored in the database and outputs the
+// result, so that the NDF is usable on startup instead of waiting for every
+// node to poll; nodes still pruned on startup are left out of the output NDF
+// until they are online. Nodes are ordered by registration time, as they are when
+// they register. Nodes stored without a server address are listed as Stale
+// and nodes stored without a gateway address are listed as GatewayUnreachable
+// with a blank gateway address, until they report their addresses.
+func (m *RegistrationImpl) rebuildNdfs() error {
+	nodes, err := storage.PermissioningDb.GetNodes()
+	if err != nil {
+		return errors.Errorf("Failed to get nodes to rebuild the NDF: %+v",
+			err)
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].DateRegistered.Before(nodes[j].DateRegistered)
+	})
+
+	type ndfEntries struct {
+		nodes    []ndf.Node
+		gateways []ndf.Gateway
+	}
+	entries := make(map[*storage.NetworkState]*ndfEntries)
+	for _, state := range m.getNetworkStates() {
+		entries[state] = &ndfEntries{
+			nodes:    make([]ndf.Node, 0),
+			gateways: make([]ndf.Gateway, 0),
+		}
+	}
+
+	for _, nodeInfo := range nodes {
+		// Only registered nodes that are part of the network are in the NDF
+		if nodeInfo.Id == nil || nodeInfo.Status != uint8(node.Active) {
+			continue
+		}
+
+		nid, gateway, n, err := buildNdfEntries(nodeInfo)
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to rebuild the NDF "+
+				"entries of the node with code %s", nodeInfo.Code)
+		}
+		state, err := m.getApplicationNetworkState(nodeInfo.ApplicationId)
+		if err != nil {
+			return err
+		}
+
+		if n.Address == "" {
+			jww.WARN.Printf("Node %s has no stored address and is listed in "+
+				"the NDF as %s", nid, ndf.Stale)
+			n.Status = ndf.Stale
+		}
+		if gateway.Address == "" {
+			jww.WARN.Printf("Gateway of node %s has no stored address and is "+
+				"listed in the NDF without one", nid)
+			state.SetGatewayReachable(nid, false)
+		}
+
+		m.registrationTimes[*nid] = nodeInfo.DateRegistered.UnixNano()
+		entries[state].nodes = append(entries[state].nodes, n)
+		entries[state].gateways = append(entries[state].gateways, gateway)
+	}
+
+	for _, state := range m.getNetworkStates() {
+		state.InternalNdfLock.Lock()
+		def := state.GetUnprunedNdf()
+		def.Nodes = entries[state].nodes
+		def.Gateways = entries[state].gateways
+		state.UpdateInternalNdf(def)
+		state.InternalNdfLock.Unlock()
+
+		err = state.UpdateOutputNdf()
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to output the rebuilt "+
+				"NDF of network %q", state.GetNetwork())
+		}
+		jww.INFO.Printf("Rebuilt NDF of network %q with %d nodes from "+
+			"storage", state.GetNetwork(), len(def.Nodes))
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"bytes"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/region"
+	"testing"
+	"time"
+)
+
+// Tests that rebuildNdfs() rebuilds the NDF from the active registered nodes
+// in the database in order of registration, listing nodes without a server
+// address as Stale and nodes without a gateway address as GatewayUnreachable
+// with a blank gateway address.
+func TestRegistrationImpl_rebuildNdfs(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testState, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+	testState.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "registration"}})
+	impl := &RegistrationImpl{
+		State:             testState,
+		params:            &Params{},
+		registrationTimes: make(map[id.ID]int64),
+	}
+
+	start := time.Now()
+	nodes := []*storage.Node{
+		{Code: "AAAA", ServerAddress: "1.1.1.1:1", GatewayAddress: "1.1.1.1:2",
+			DateRegistered: start.Add(2 * time.Minute)},
+		{Code: "BBBB", ServerAddress: "2.2.2.2:1", GatewayAddress: "2.2.2.2:2",
+			DateRegistered: start},
+		{Code: "CCCC", GatewayAddress: "3.3.3.3:2",
+			DateRegistered: start.Add(time.Minute)},
+		{Code: "DDDD", ServerAddress: "4.4.4.4:1",
+			DateRegistered: start.Add(3 * time.Minute)},
+		{Code: "EEEE", ServerAddress: "5.5.5.5:1", GatewayAddress: "5.5.5.5:2",
+			DateRegistered: start, Status: uint8(node.Banned)},
+		{Code: "FFFF"},
+	}
+	nodeIds := make([]*id.ID, len(nodes))
+	for i, n := range nodes {
+		n.Sequence = "US"
+		n.ApplicationId = uint64(i + 1)
+		if n.Code != "FFFF" {
+			nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+			n.Id = nodeIds[i].Bytes()
+			if n.Status == uint8(node.Unregistered) {
+				n.Status = uint8(node.Active)
+			}
+		}
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: uint64(i + 1)}, n)
+		if err != nil {
+			t.Fatalf("Failed to insert node %s: %+v", n.Code, err)
+		}
+	}
+
+	err = impl.rebuildNdfs()
+	if err != nil {
+		t.Fatalf("rebuildNdfs() returned an error: %+v", err)
+	}
+
+	// The internal NDF holds the active nodes in order of registration
+	expected := []*id.ID{nodeIds[1], nodeIds[2], nodeIds[0], nodeIds[3]}
+	internalNdf := testState.GetUnprunedNdf()
+	if len(internalNdf.Nodes) != len(expected) ||
+		len(internalNdf.Gateways) != len(expected) {
+		t.Fatalf("Unexpected number of nodes and gateways in the NDF."+
+			"\n\texpected: %d\n\treceived: %d nodes, %d gateways",
+			len(expected), len(internalNdf.Nodes), len(internalNdf.Gateways))
+	}
+	for i, nid := range expected {
+		if !bytes.Equal(internalNdf.Nodes[i].ID, nid.Bytes()) {
+			t.Errorf("Unexpected node at index %d of the NDF."+
+				"\n\texpected: %s\n\treceived: %v", i, nid,
+				internalNdf.Nodes[i].ID)
+		}
+	}
+	if internalNdf.Registration.Address != "registration" {
+		t.Errorf("Rebuilding the NDF changed its registration address."+
+			"\n\texpected: %s\n\treceived: %s", "registration",
+			internalNdf.Registration.Address)
+	}
+
+	// The output NDF lists each node, ordered by ID, with the status of its
+	// addresses
+	outputNdf := testState.GetFullNdf().Get()
+	expectedStatus := []ndf.Status{
+		ndf.Active, ndf.Active, ndf.Stale, storage.GatewayUnreachable}
+	if len(outputNdf.Nodes) != len(expected) {
+		t.Fatalf("Unexpected number of nodes in the output NDF."+
+			"\n\texpected: %d\n\treceived: %d", len(expected),
+			len(outputNdf.Nodes))
+	}
+	for i, status := range expectedStatus {
+		if outputNdf.Nodes[i].Status != status {
+			t.Errorf("Unexpected status of node %s in the output NDF."+
+				"\n\texpected: %s\n\treceived: %s", nodeIds[i], status,
+				outputNdf.Nodes[i].Status)
+		}
+	}
+	if len(outputNdf.Gateways) != len(expected) {
+		t.Fatalf("Unexpected number of gateways in the output NDF."+
+			"\n\texpected: %d\n\treceived: %d", len(expected),
+			len(outputNdf.Gateways))
+	}
+	for i, g := range outputNdf.Gateways {
+		if (g.Address == "") != (i == 3) {
+			t.Errorf("Unexpected address of gateway %d in the output NDF: %q",
+				i, g.Address)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles rate limiting node registration attempts
+
+package cmd
+
+import (
+	"gitlab.com/xx_network/primitives/rateLimiting"
+	"time"
+)
+
+const (
+	// Number of registration attempts that may be made by a sender in a burst
+	// when no limit is configured
+	defaultNodeRegistrationLimit = 10
+
+	// Time over which a full burst of attempts leaks away when no window is
+	// configured
+	defaultNodeRegistrationWindow = 10 * time.Minute
+
+	// Number of attempts a failed registration counts as, so that repeated
+	// failures by a sender are throttled sooner
+	failedNodeRegistrationCost = 3
+
+	// Time between removals of sources that have not been used to register
+	// for nodeRegistrationBucketMaxAge
+	nodeRegistrationBucketPoll   = time.Minute
+	nodeRegistrationBucketMaxAge = time.Hour
+)
+
+// nodeRegistrationLimiter throttles node registration attempts per source
+// using a leaky bucket per source, as is done for clients by gateways. The
+// source of an attempt is the address of its sender.
+type nodeRegistrationLimiter struct {
+	buckets *rateLimiting.BucketMap
+	quit    chan struct{}
+}
+
+// newNodeRegistrationLimiter creates a nodeRegistrationLimiter that allows a
+// source limit attempts in a burst, which leak away over the window. A limit or
+// window of zero uses defaultNodeRegistrationLimit or
+// defaultNodeRegistrationWindow.
+func newNodeRegistrationLimiter(limit uint32,
+	window time.Duration) *nodeRegistrationLimiter {
+	if limit == 0 {
+		limit = defaultNodeRegistrationLimit
+	}
+	if window <= 0 {
+		window = defaultNodeRegistrationWindow
+	}
+
+	quit := make(chan struct{})
+	return &nodeRegistrationLimiter{
+		buckets: rateLimiting.CreateBucketMap(limit, limit, window,
+			nodeRegistrationBucketPoll, nodeRegistrationBucketMaxAge, nil,
+			quit),
+		quit: quit,
+	}
+}
+
+// allow returns true and records the attempt if the source has not used up
+// its attempts. Attempts that are rejected are not recorded. Every attempt is
+// allowed by a nil limiter.
+func (l *nodeRegistrationLimiter) allow(source string) bool {
+	if l == nil {
+		return true
+	}
+	bucket := l.buckets.LookupBucket(source)
+	if bucket.IsFull() {
+		return false
+	}
+	bucket.Add(1)
+	return true
+}
+
+// fail records that an attempt allowed for the source failed, so that it
+// counts as failedNodeRegistrationCost attempts.
+func (l *nodeRegistrationLimiter) fail(source string) {
+	if l == nil {
+		return
+	}
+	l.buckets.LookupBucket(source).Add(failedNodeRegistrationCost - 1)
+}
+
+// stop stops the removal of stale sources.
+func (l *nodeRegistrationLimiter) stop() {
+	close(l.quit)
+}
@@ -0,0 +1,155 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"fmt"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that nodeRegistrationLimiter rejects a source once it has used up its
+// attempts, with failures counting more heavily, without affecting other
+// sources, and allows the source again once the window has passed.
+func TestNodeRegistrationLimiter(t *testing.T) {
+	window := 400 * time.Millisecond
+	limiter := newNodeRegistrationLimiter(4, window)
+	defer limiter.stop()
+
+	// A failed attempt and a successful one use up the four attempts
+	if !limiter.allow("a") {
+		t.Fatal("First attempt rejected.")
+	}
+	limiter.fail("a")
+	if !limiter.allow("a") {
+		t.Fatal("Attempt rejected before the limit was reached.")
+	}
+	if limiter.allow("a") {
+		t.Error("Attempt allowed after the limit was reached.")
+	}
+
+	if !limiter.allow("b") {
+		t.Error("Attempt from another source rejected.")
+	}
+
+	time.Sleep(window + window/4)
+	if !limiter.allow("a") {
+		t.Error("Attempt rejected after the window passed.")
+	}
+}
+
+// Tests that newNodeRegistrationLimiter uses the defaults for a zero limit and
+// window.
+func TestNewNodeRegistrationLimiter_Defaults(t *testing.T) {
+	limiter := newNodeRegistrationLimiter(0, 0)
+	defer limiter.stop()
+
+	for i := 0; i < defaultNodeRegistrationLimit; i++ {
+		if !limiter.allow("a") {
+			t.Fatalf("Attempt %d rejected before the default limit %d.",
+				i+1, defaultNodeRegistrationLimit)
+		}
+	}
+	if limiter.allow("a") {
+		t.Errorf("Attempt allowed after the default limit %d.",
+			defaultNodeRegistrationLimit)
+	}
+}
+
+// Tests that RegisterNode() rejects attempts from a sender once it has failed
+// too often, even when every attempt guesses a different registration code,
+// without affecting other senders, and allows it again once the window has
+// passed.
+func TestRegistrationImpl_RegisterNode_RateLimited(t *testing.T) {
+	// Initialize the database
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Errorf("Failed to insert ephemeral length into database: %+v", err)
+	}
+	storage.PopulateNodeRegistrationCodes(
+		[]node.Info{{RegCode: "AAAA", Order: "CR"}})
+	RegParams = *newTestParams()
+
+	// Five failed attempts use up the limit
+	const attempts = 5
+	localParams := newTestParams()
+	localParams.nodeRegistrationLimit = attempts * failedNodeRegistrationCost
+	localParams.nodeRegistrationWindow = 600 * time.Millisecond
+	impl, err := StartRegistration(localParams)
+	if err != nil {
+		t.Fatalf("Failed to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+	defer impl.nodeRegistrationLimiter.stop()
+
+	testSalt := []byte("testtesttesttesttesttesttesttest")
+	register := func(code, addr string) error {
+		return impl.RegisterNode(testSalt, addr, string(nodeCert),
+			addr, string(nodeCert), code)
+	}
+
+	// Guess a different code with each attempt from different ports
+	for i := 0; i < attempts; i++ {
+		err = register(fmt.Sprintf("ZZZ%d", i),
+			fmt.Sprintf("10.0.0.1:%d", 11420+i))
+		if err == nil || strings.Contains(err.Error(), "Too many") {
+			t.Fatalf("Expected attempt %d with an invalid code to fail "+
+				"registering: %+v", i+1, err)
+		}
+	}
+
+	err = register("YYYY", "10.0.0.1:11520")
+	if err == nil || !strings.Contains(err.Error(), "Too many") {
+		t.Fatalf("Attempt after the limit was not rate limited: %+v", err)
+	}
+
+	// The valid code is rejected from the limited sender but not from another
+	err = register("AAAA", "10.0.0.1:6900")
+	if err == nil || !strings.Contains(err.Error(), "Too many") {
+		t.Errorf("Valid registration from the limited sender was not rate "+
+			"limited: %+v", err)
+	}
+	if err = register("AAAA", nodeAddr); err != nil {
+		t.Errorf("Valid registration from another sender failed: %+v", err)
+	}
+
+	time.Sleep(localParams.nodeRegistrationWindow * 5 / 4)
+	err = register("YYYY", "10.0.0.1:11520")
+	if err == nil || strings.Contains(err.Error(), "Too many") {
+		t.Errorf("Attempt after the window was rate limited: %+v", err)
+	}
+}
+
+// Tests that registrationSender() returns the host of the server address, or
+// the whole address when it has no port.
+func Test_registrationSender(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1:11420":   "10.0.0.1",
+		"[::1]:11420":      "::1",
+		"node.example.com": "node.example.com",
+	}
+
+	for addr, expected := range tests {
+		if sender := registrationSender(addr); sender != expected {
+			t.Errorf("Unexpected sender for address %q."+
+				"\nexpected: %s\nreceived: %s", addr, expected, sender)
+		}
+	}
+}
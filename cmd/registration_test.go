@@ -20,6 +20,7 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/utils"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -30,6 +31,8 @@ var nodeCert []byte
 var nodeKey []byte
 var permAddr = "0.0.0.0:5900"
 var testParams Params
+var testNdfDir string
+var testMinGatewayVersion, testMinServerVersion version.Version
 var gatewayCert []byte
 
 var nodeComm *nodeComms.Comms
@@ -57,41 +60,54 @@ func TestMain(m *testing.M) {
 		fmt.Printf("Could not get gateway cert: %+v\n", err)
 	}
 
-	minGatewayVersion, err := version.ParseVersion("1.1.0")
+	testMinGatewayVersion, err = version.ParseVersion("1.1.0")
 	if err != nil {
 		fmt.Printf("Could not parse gateway version: %+v\n", err)
 	}
 
-	minServerVersion, err := version.ParseVersion("1.1.0")
+	testMinServerVersion, err = version.ParseVersion("1.1.0")
 	if err != nil {
 		fmt.Printf("Could not parse server version: %+v\n", err)
 	}
 
-	testParams = Params{
-		Address:             permAddr,
-		CertPath:            testkeys.GetCACertPath(),
-		KeyPath:             testkeys.GetCAKeyPath(),
-		FullNdfOutputPath:   testkeys.GetNDFPath(),
-		publicAddress:       permAddr,
-		udbCertPath:         testkeys.GetUdbCertPath(),
-		NsCertPath:          testkeys.GetUdbCertPath(),
-		minimumNodes:        3,
-		minGatewayVersion:   minGatewayVersion,
-		minServerVersion:    minServerVersion,
-		disableGeoBinning:   true,
-		pruneRetentionLimit: 500 * time.Millisecond,
+	// Write NDF output outside the source tree
+	testNdfDir, err = os.MkdirTemp("", "registration")
+	if err != nil {
+		fmt.Printf("Could not create NDF output directory: %+v\n", err)
 	}
+
+	testParams = *newTestParams()
 	nodeComm = nodeComms.StartNode(&id.TempGateway, nodeAddr, 0, nodeComms.NewImplementation(), nodeCert, nodeKey)
 
 	runFunc := func() int {
 		code := m.Run()
 		nodeComm.Shutdown()
+		_ = os.RemoveAll(testNdfDir)
 		return code
 	}
 
 	os.Exit(runFunc())
 }
 
+// newTestParams returns new Params with the values of testParams, so that
+// each test can start the registration server with its own Params.
+func newTestParams() *Params {
+	return &Params{
+		Address:             permAddr,
+		CertPath:            testkeys.GetCACertPath(),
+		KeyPath:             testkeys.GetCAKeyPath(),
+		FullNdfOutputPath:   filepath.Join(testNdfDir, "ndf.json"),
+		publicAddress:       permAddr,
+		udbCertPath:         testkeys.GetUdbCertPath(),
+		NsCertPath:          testkeys.GetUdbCertPath(),
+		minimumNodes:        3,
+		minGatewayVersion:   testMinGatewayVersion,
+		minServerVersion:    testMinServerVersion,
+		disableGeoBinning:   true,
+		pruneRetentionLimit: 500 * time.Millisecond,
+	}
+}
+
 // Error path: Test an insertion on an empty database
 func TestEmptyDataBase(t *testing.T) {
 
@@ -119,7 +135,7 @@ func TestEmptyDataBase(t *testing.T) {
 		WhitelistedIdsPath: testkeys.GetPreApprovedPath(),
 	}
 	// Start registration server
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(&testParams)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -152,7 +168,7 @@ func TestRegCodeExists_InsertRegCode(t *testing.T) {
 
 	// Start registration server
 	testParams.Address = "0.0.0.0:5901"
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(&testParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -214,7 +230,7 @@ func TestCompleteRegistration_HappyPath(t *testing.T) {
 	localParams := testParams
 	localParams.minimumNodes = 1
 	// Start registration server
-	impl, err := StartRegistration(localParams)
+	impl, err := StartRegistration(&localParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -267,7 +283,7 @@ func TestDoubleRegistration(t *testing.T) {
 	RegParams = testParams
 
 	// Start registration server
-	impl, err := StartRegistration(testParams)
+	impl, err := StartRegistration(newTestParams())
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -295,6 +311,62 @@ func TestDoubleRegistration(t *testing.T) {
 	t.Errorf("Expected happy path, recieved error: %+v", err)
 }
 
+// Tests that RegisterNode() succeeds when a successful registration is retried
+// with the same salt, certificates and addresses, and fails when the retry
+// differs from the stored registration.
+func TestRegistrationImpl_RegisterNode_Retry(t *testing.T) {
+	// Initialize the database
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Errorf("Failed to insert ephemeral length into database: %+v", err)
+	}
+	storage.PopulateNodeRegistrationCodes(
+		[]node.Info{{RegCode: "AAAA", Order: "CR"}})
+	RegParams = *newTestParams()
+
+	// Start registration server
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Fatalf("Failed to start registration: %+v", err)
+	}
+	defer impl.Comms.Shutdown()
+
+	testSalt := []byte("testtesttesttesttesttesttesttest")
+	err = impl.RegisterNode(testSalt, nodeAddr, string(nodeCert), nodeAddr,
+		string(nodeCert), "AAAA")
+	if err != nil {
+		t.Fatalf("Failed to register node: %+v", err)
+	}
+
+	// The response was lost, so the node sends the same registration again
+	err = impl.RegisterNode(testSalt, nodeAddr, string(nodeCert), nodeAddr,
+		string(nodeCert), "AAAA")
+	if err != nil {
+		t.Errorf("Retry of the registration failed: %+v", err)
+	}
+
+	// A registration that differs from the stored one is not a retry
+	err = impl.RegisterNode([]byte("testtesttesttesttesttesttesttesc"),
+		nodeAddr, string(nodeCert), nodeAddr, string(nodeCert), "AAAA")
+	if err == nil {
+		t.Errorf("Registration with another salt did not fail.")
+	}
+	err = impl.RegisterNode(testSalt, "0.0.0.0:6901", string(nodeCert),
+		"0.0.0.0:6901", string(nodeCert), "AAAA")
+	if err == nil {
+		t.Errorf("Registration with other addresses did not fail.")
+	}
+}
+
 // Happy path: attempt to register 2 nodes
 func TestTopology_MultiNodes(t *testing.T) {
 	// Initialize the database
@@ -325,7 +397,7 @@ func TestTopology_MultiNodes(t *testing.T) {
 	localParams.minimumNodes = 2
 
 	// Start registration server
-	impl, err := StartRegistration(localParams)
+	impl, err := StartRegistration(&localParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -363,6 +435,133 @@ func TestTopology_MultiNodes(t *testing.T) {
 	}
 }
 
+// Happy path: register 2 nodes in a single batch
+func TestRegistrationImpl_RegisterNodes(t *testing.T) {
+	// Initialize the database
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Errorf("Failed to insert ephemeral length into database: %+v", err)
+	}
+
+	// Create reg codes and populate the database
+	infos := []node.Info{
+		{RegCode: "AAAA", Order: "CR"},
+		{RegCode: "BBBB", Order: "GB"},
+	}
+	storage.PopulateNodeRegistrationCodes(infos)
+
+	localParams := newTestParams()
+	localParams.minimumNodes = 2
+
+	// Start registration server
+	impl, err := StartRegistration(localParams)
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer impl.Comms.Shutdown()
+
+	go func() {
+		succeeded, failed, err := impl.RegisterNodes([]NodeRegistrationRequest{
+			{Salt: []byte("testtesttesttesttesttesttesttest"),
+				ServerAddr: nodeAddr, ServerTlsCert: string(nodeCert),
+				GatewayAddr: nodeAddr, GatewayTlsCert: string(nodeCert),
+				RegistrationCode: "AAAA"},
+			{Salt: []byte("testtesttesttesttesttesttesttesc"),
+				ServerAddr: "0.0.0.0:6901", ServerTlsCert: string(nodeCert),
+				GatewayAddr: "0.0.0.0:6901", GatewayTlsCert: string(nodeCert),
+				RegistrationCode: "BBBB"},
+		})
+		if err != nil || len(failed) != 0 {
+			t.Errorf("Expected happy path, recieved error: %+v", err)
+		}
+		if len(succeeded) != 2 {
+			t.Errorf("Unexpected number of registered nodes."+
+				"\n\texpected: %d\n\treceived: %d", 2, len(succeeded))
+		}
+	}()
+
+	select {
+	case <-time.NewTimer(250 * time.Millisecond).C:
+		t.Errorf("Registration failed to complete")
+		t.FailNow()
+	case <-impl.beginScheduling:
+	}
+}
+
+// Error path: a batch with an invalid registration code registers no nodes
+// and reports the failed code
+func TestRegistrationImpl_RegisterNodes_Rollback(t *testing.T) {
+	// Initialize the database
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Errorf("%+v", err)
+	}
+	err = storage.PermissioningDb.InsertEphemeralLength(
+		&storage.EphemeralLength{Length: 8, Timestamp: time.Now()})
+	if err != nil {
+		t.Errorf("Failed to insert ephemeral length into database: %+v", err)
+	}
+
+	infos := []node.Info{
+		{RegCode: "AAAA", Order: "CR"},
+	}
+	storage.PopulateNodeRegistrationCodes(infos)
+
+	// Start registration server
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Errorf(err.Error())
+		return
+	}
+	defer impl.Comms.Shutdown()
+
+	succeeded, failed, err := impl.RegisterNodes([]NodeRegistrationRequest{
+		{Salt: []byte("testtesttesttesttesttesttesttest"),
+			ServerAddr: nodeAddr, ServerTlsCert: string(nodeCert),
+			GatewayAddr: nodeAddr, GatewayTlsCert: string(nodeCert),
+			RegistrationCode: "AAAA"},
+		{Salt: []byte("testtesttesttesttesttesttesttesc"),
+			ServerAddr: "0.0.0.0:6901", ServerTlsCert: string(nodeCert),
+			GatewayAddr: "0.0.0.0:6901", GatewayTlsCert: string(nodeCert),
+			RegistrationCode: "ZZZZ"},
+	})
+	if err == nil {
+		t.Errorf("Expected error path, registered a batch with an invalid code")
+	}
+	if len(succeeded) != 0 {
+		t.Errorf("Unexpected registered codes: %v", succeeded)
+	}
+	if _, exists := failed["ZZZZ"]; !exists || len(failed) != 1 {
+		t.Errorf("Expected only the invalid code to fail, received: %v", failed)
+	}
+
+	// Ensure the valid code was not registered
+	nodeInfo, err := storage.PermissioningDb.GetNode("AAAA")
+	if err != nil {
+		t.Fatalf("Failed to get node: %+v", err)
+	}
+	if len(nodeInfo.Salt) != 0 {
+		t.Errorf("Valid registration code was registered in a failed batch")
+	}
+	if impl.State.GetNodeMap().Len() != 0 {
+		t.Errorf("Nodes added to the state tracker in a failed batch")
+	}
+}
+
 // Happy path
 func TestRegistrationImpl_CheckNodeRegistration(t *testing.T) {
 	// Initialize the database
@@ -393,7 +592,7 @@ func TestRegistrationImpl_CheckNodeRegistration(t *testing.T) {
 	localParams.minimumNodes = 2
 
 	// Start registration server
-	impl, err := StartRegistration(localParams)
+	impl, err := StartRegistration(&localParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -469,7 +668,7 @@ func TestCheckRegistration_NilMsg(t *testing.T) {
 	localParams.minimumNodes = 2
 
 	// Start registration server
-	impl, err := StartRegistration(localParams)
+	impl, err := StartRegistration(&localParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -524,7 +723,7 @@ func TestCheckRegistration_InvalidID(t *testing.T) {
 	localParams.minimumNodes = 2
 
 	// Start registration server
-	impl, err := StartRegistration(localParams)
+	impl, err := StartRegistration(&localParams)
 	if err != nil {
 		t.Errorf(err.Error())
 		return
@@ -56,7 +56,11 @@ const (
 	// Default duration between polls of the disabled Node list for updates.
 	defaultDisabledNodesPollDuration = time.Minute
 	defaultPruneRetention            = 24 * 7 * time.Hour
+	defaultInactivePruneInterval     = time.Minute
+	defaultStateSnapshotInterval     = time.Minute
 	defaultMessageRetention          = 24 * 7 * time.Hour
+	defaultRoundUpdateGapTimeout     = time.Minute
+	defaultMaxFutureRoundUpdates     = 10000
 
 	// Default settings for Go profiling
 	profilingOutputFlags   = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
@@ -126,6 +130,12 @@ var rootCmd = &cobra.Command{
 		localAddress := fmt.Sprintf("0.0.0.0:%d", viper.GetInt("port"))
 		fullNdfOutputPath := viper.GetString("fullNdfOutputPath")
 		signedPartialNdfOutputPath := viper.GetString("signedPartialNDFOutputPath")
+		ndfOutputS3 := storage.S3Config{
+			Endpoint:        viper.GetString("ndfOutputS3.endpoint"),
+			Region:          viper.GetString("ndfOutputS3.region"),
+			AccessKeyID:     viper.GetString("ndfOutputS3.accessKeyId"),
+			SecretAccessKey: viper.GetString("ndfOutputS3.secretAccessKey"),
+		}
 		whitelistedIdsPath := viper.GetString("whitelistedIdsPath")
 		whitelistedIpAddressesPath := viper.GetString("whitelistedIpAddressesPath")
 
@@ -189,6 +199,22 @@ var rootCmd = &cobra.Command{
 		udbCertPath := viper.GetString("udbCertPath")
 		udbAddress := viper.GetString("udbAddress")
 
+		// Parse the IDs of the administrators allowed to ban nodes
+		adminIds, err := parseAdminIds(viper.GetStringSlice("adminIds"))
+		if err != nil {
+			jww.FATAL.Panicf("Could not parse adminIds: %+v", err)
+		}
+
+		// Collect NDF changes for 5 seconds before outputting them by default
+		viper.SetDefault("ndfUpdateDebounceWindow", 5*time.Second)
+
+		// Get the networks run alongside the default network
+		var networks []networkParams
+		err = viper.UnmarshalKey("networks", &networks)
+		if err != nil {
+			jww.FATAL.Panicf("Could not parse networks: %+v", err)
+		}
+
 		// load the scheduling params file as a string
 		SchedulingConfigPath := viper.GetString("schedulingConfigPath")
 		SchedulingConfig, err := utils.ReadFile(SchedulingConfigPath)
@@ -238,6 +264,9 @@ var rootCmd = &cobra.Command{
 
 		viper.SetDefault("messageRetentionLimit", defaultMessageRetention)
 
+		viper.SetDefault("roundUpdateGapTimeout", defaultRoundUpdateGapTimeout)
+		viper.SetDefault("maxFutureRoundUpdates", defaultMaxFutureRoundUpdates)
+
 		// Get rate limiting values
 		capacity := viper.GetUint32("RateLimiting.Capacity")
 		if capacity == 0 {
@@ -260,6 +289,8 @@ var rootCmd = &cobra.Command{
 			KeyPath:                    keyPath,
 			FullNdfOutputPath:          fullNdfOutputPath,
 			SignedPartialNdfOutputPath: signedPartialNdfOutputPath,
+			NdfOutputS3:                ndfOutputS3,
+			FullNdfOutputFormat:        viper.GetString("fullNdfOutputFormat"),
 			WhitelistedIdsPath:         whitelistedIdsPath,
 			WhitelistedIpAddressPath:   whitelistedIpAddressesPath,
 			NsCertPath:                 nsCertPath,
@@ -278,18 +309,36 @@ var rootCmd = &cobra.Command{
 			minGatewayVersion:          minGatewayVersion,
 			minServerVersion:           minServerVersion,
 			minClientVersion:           minClientVersion,
+			requireGatewayVersion:      viper.GetBool("requireGatewayVersion"),
 			addressSpaceSize:           uint8(viper.GetUint("addressSpace")),
 			allowLocalIPs:              viper.GetBool("allowLocalIPs"),
+			allowDuplicateAddresses:    viper.GetBool("allowDuplicateAddresses"),
 			disableGeoBinning:          viper.GetBool("disableGeoBinning"),
 			blockchainGeoBinning:       viper.GetBool("blockchainGeoBinning"),
 			onlyScheduleActive:         viper.GetBool("onlyScheduleActive"),
 			enableBlockchain:           viper.GetBool("enableBlockchain"),
 
 			disableNDFPruning:     viper.GetBool("disableNDFPruning"),
+			notifyFailedRounds:    viper.GetBool("notifyFailedRounds"),
 			geoIPDBFile:           viper.GetString("geoIPDBFile"),
+			geoBinsFile:           viper.GetString("geoBinsFile"),
+			adminIds:              adminIds,
+			nodeKeyAllowlist:      viper.GetBool("nodeKeyAllowlist"),
+			networks:              networks,
 			pruneRetentionLimit:   viper.GetDuration("pruneRetentionLimit"),
 			messageRetentionLimit: viper.GetDuration("messageRetentionLimit"),
+			roundUpdateGapTimeout: viper.GetDuration("roundUpdateGapTimeout"),
+			maxFutureRoundUpdates: viper.GetInt("maxFutureRoundUpdates"),
+			roundUpdateSigners:    viper.GetInt("roundUpdateSigners"),
+			maxStaleNdfPolls:      viper.GetUint32("maxStaleNdfPolls"),
+			maxUpdatesPerPoll:     viper.GetUint32("maxUpdatesPerPoll"),
+			ndfDebounceWindow:     viper.GetDuration("ndfUpdateDebounceWindow"),
+			ndfTimestampSkew:      viper.GetDuration("ndfTimestampSkew"),
 			versionLock:           sync.RWMutex{},
+			nodeRegistrationLimit: viper.GetUint32(
+				"nodeRegistrationLimit"),
+			nodeRegistrationWindow: viper.GetDuration(
+				"nodeRegistrationWindow"),
 
 			// Rate limiting specs
 			leakedCapacity: capacity,
@@ -307,14 +356,61 @@ var rootCmd = &cobra.Command{
 		LoadAllRegNodes = true
 
 		// Start registration server
-		impl, err := StartRegistration(RegParams)
+		impl, err := StartRegistration(&RegParams)
 		if err != nil {
 			jww.FATAL.Panicf(err.Error())
 		}
 
+		// Hold the scheduler lease of each network so that a second server
+		// sharing the database does not schedule rounds alongside this one;
+		// if another server holds it, wait for it as a standby. The holder
+		// defaults to the host and address, so a restarted server reclaims
+		// its own lease
+		schedulerLeaseHolder := viper.GetString("schedulerLeaseHolder")
+		if schedulerLeaseHolder == "" {
+			schedulerLeaseHolder = storage.SchedulerLeaseHolder(publicAddress)
+		}
+		var schedulerLeaseTrackerQuitChans []chan struct{}
+		holdsSchedulerLeases := true
+		for _, state := range impl.getNetworkStates() {
+			state.SetSchedulerLeaseDuration(
+				viper.GetDuration("schedulerLeaseDuration"))
+			state.SetSchedulerLeaseHolder(schedulerLeaseHolder)
+			err = state.AcquireSchedulerLease()
+			if err != nil {
+				jww.WARN.Printf("Not scheduling rounds until the scheduler "+
+					"lease is acquired: %+v", err)
+				holdsSchedulerLeases = false
+			}
+			quitChan := make(chan struct{})
+			schedulerLeaseTrackerQuitChans =
+				append(schedulerLeaseTrackerQuitChans, quitChan)
+			go state.TrackSchedulerLease(quitChan)
+		}
+
+		// Restore the network states checkpointed before a restart
+		stateSnapshotPath := viper.GetString("stateSnapshotPath")
+		if stateSnapshotPath != "" && !holdsSchedulerLeases {
+			jww.WARN.Printf("Not restoring state snapshots while another " +
+				"server holds the scheduler lease")
+		} else if stateSnapshotPath != "" {
+			err = impl.RestoreStateSnapshots(stateSnapshotPath)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to restore state snapshots: %+v", err)
+			}
+		}
+
 		viper.OnConfigChange(impl.update)
 		viper.WatchConfig()
 
+		// Serve the health report for monitoring if an address is configured
+		if healthAddress := viper.GetString("healthAddress"); healthAddress != "" {
+			go func() {
+				err := StartHealthServer(impl, healthAddress)
+				jww.ERROR.Printf("Health server stopped: %+v", err)
+			}()
+		}
+
 		// Get disabled Nodes poll duration from config file or default to 1
 		// minute if not set
 		disabledNodesPollDuration = viper.GetDuration("disabledNodesPollDuration")
@@ -322,19 +418,30 @@ var rootCmd = &cobra.Command{
 			disabledNodesPollDuration = defaultDisabledNodesPollDuration
 		}
 
-		// Start routine to update disabled Nodes list
-		disabledNodePollQuitChan := make(chan struct{})
+		// Start routine to update disabled Nodes list of each network
+		var disabledNodePollQuitChans []chan struct{}
 		disabledNodesPath = viper.GetString("disabledNodesPath")
-		if disabledNodesPath != "" {
-			err = impl.State.CreateDisabledNodes(disabledNodesPath, disabledNodesPollDuration)
-			if err != nil {
-				jww.WARN.Printf("Error while parsing disabled Node list: %v", err)
+		for _, state := range impl.getNetworkStates() {
+			if viper.GetBool("disabledNodesFromDb") {
+				err = state.CreateDbDisabledNodes(disabledNodesPollDuration)
+				if err != nil {
+					jww.WARN.Printf("Error while reading disabled Node list: %v", err)
+					continue
+				}
+			} else if disabledNodesPath != "" {
+				err = state.CreateDisabledNodes(disabledNodesPath, disabledNodesPollDuration)
+				if err != nil {
+					jww.WARN.Printf("Error while parsing disabled Node list: %v", err)
+					continue
+				}
 			} else {
-				go impl.State.StartPollDisabledNodes(disabledNodePollQuitChan)
+				jww.DEBUG.Printf("No disabled Node list path provided. Skipping " +
+					"disabled Node list polling.")
+				break
 			}
-		} else {
-			jww.DEBUG.Printf("No disabled Node list path provided. Skipping " +
-				"disabled Node list polling.")
+			quitChan := make(chan struct{})
+			disabledNodePollQuitChans = append(disabledNodePollQuitChans, quitChan)
+			go state.StartPollDisabledNodes(quitChan)
 		}
 
 		// Parse params JSON
@@ -351,6 +458,26 @@ var rootCmd = &cobra.Command{
 		metricTrackerQuitChan := make(chan struct{})
 		go TrackNodeMetrics(impl, metricTrackerQuitChan, nodeMetricInterval)
 
+		// Record the nodes that polled as active in storage until stopped
+		lastActiveTrackerQuitChan := make(chan struct{})
+		go impl.TrackLastActive(lastActiveUpdateInterval,
+			lastActiveTrackerQuitChan)
+
+		// Prune nodes inactive past the prune retention limit until stopped
+		viper.SetDefault("inactivePruneInterval", defaultInactivePruneInterval)
+		inactivePruneTrackerQuitChan := make(chan struct{})
+		go impl.TrackInactiveNodes(viper.GetDuration("inactivePruneInterval"),
+			inactivePruneTrackerQuitChan)
+
+		// Checkpoint the network states to snapshot files until stopped
+		viper.SetDefault("stateSnapshotInterval", defaultStateSnapshotInterval)
+		stateSnapshotTrackerQuitChan := make(chan struct{})
+		if stateSnapshotPath != "" {
+			go impl.TrackStateSnapshots(stateSnapshotPath,
+				viper.GetDuration("stateSnapshotInterval"),
+				stateSnapshotTrackerQuitChan)
+		}
+
 		// Run address space updater until stopped
 		viper.SetDefault("addressSpaceSizeUpdateInterval", 5*time.Minute)
 		addressSpaceSizeUpdateInterval := viper.GetDuration("addressSpaceSizeUpdateInterval")
@@ -387,35 +514,46 @@ var rootCmd = &cobra.Command{
 		<-impl.beginScheduling
 		jww.INFO.Printf("Minimum number of nodes %v have registered, "+
 			"beginning scheduling and round creation", RegParams.minimumNodes)
-		err = impl.State.UpdateOutputNdf()
-		if err != nil {
-			jww.FATAL.Panicf("Failed to update output NDF with "+
-				"registered nodes for scheduling: %+v", err)
+		for _, state := range impl.getNetworkStates() {
+			err = state.UpdateOutputNdf()
+			if err != nil {
+				jww.FATAL.Panicf("Failed to update output NDF of network %q "+
+					"with registered nodes for scheduling: %+v",
+					state.GetNetwork(), err)
+			}
 		}
 
-		roundCreationQuitChan := make(chan chan struct{})
-
-		// Begin scheduling algorithm
-		go func() {
-			// Initialize scheduling
-			err = scheduling.Scheduler(params, impl.State, roundCreationQuitChan)
-			if err == nil {
-				err = errors.New("")
-			}
-			jww.FATAL.Panicf("Scheduling Algorithm exited: %v", err)
-		}()
+		// Begin scheduling algorithm, with a scheduler for each network
+		roundCreationQuitChans := make(map[*storage.NetworkState]chan chan struct{})
+		for _, state := range impl.getNetworkStates() {
+			roundCreationQuitChan := make(chan chan struct{})
+			roundCreationQuitChans[state] = roundCreationQuitChan
+			go func(state *storage.NetworkState) {
+				// Initialize scheduling
+				err := scheduling.Scheduler(params, state,
+					impl.getRoundTracker(state), roundCreationQuitChan)
+				if err == nil {
+					err = errors.New("")
+				}
+				jww.FATAL.Panicf("Scheduling Algorithm of network %q "+
+					"exited: %v", state.GetNetwork(), err)
+			}(state)
+		}
 
 		var stopOnce sync.Once
 		// Set up signal handler for stopping round creation
 		stopRounds := func() {
-			k := make(chan struct{})
-			roundCreationQuitChan <- k
-			jww.INFO.Printf("Stopping round creation...")
-			select {
-			case <-k:
-				jww.INFO.Printf("stopped!\n")
-			case <-time.After(closeTimeout):
-				jww.ERROR.Print("couldn't stop round creation!")
+			for _, state := range impl.getNetworkStates() {
+				k := make(chan struct{})
+				roundCreationQuitChans[state] <- k
+				jww.INFO.Printf("Stopping round creation of network %q...",
+					state.GetNetwork())
+				select {
+				case <-k:
+					jww.INFO.Printf("stopped!\n")
+				case <-time.After(closeTimeout):
+					jww.ERROR.Print("couldn't stop round creation!")
+				}
 			}
 
 			bannedNodeTrackerQuitChan <- struct{}{}
@@ -436,11 +574,44 @@ var rootCmd = &cobra.Command{
 			metricTrackerQuitChan <- struct{}{}
 
 			// Stop polling for disabled Nodes
-			disabledNodePollQuitChan <- struct{}{}
+			for _, quitChan := range disabledNodePollQuitChans {
+				quitChan <- struct{}{}
+			}
 
 			// Stop address space tracker
 			addressSpaceTrackerQuitChan <- struct{}{}
 
+			// Stop last active tracker and record the nodes that polled since
+			// its last update
+			lastActiveTrackerQuitChan <- struct{}{}
+			impl.UpdateLastActive()
+
+			// Stop pruning inactive nodes
+			inactivePruneTrackerQuitChan <- struct{}{}
+
+			// Stop checkpointing the network states after a final snapshot
+			if stateSnapshotPath != "" {
+				stateSnapshotTrackerQuitChan <- struct{}{}
+			}
+
+			// Stop removing stale sources of node registration attempts
+			impl.nodeRegistrationLimiter.stop()
+
+			// Write any NDF changes still waiting to be output and stop
+			// retrying writes to remote outputs
+			for _, state := range impl.getNetworkStates() {
+				err := state.FlushOutputNdf()
+				if err != nil {
+					jww.ERROR.Printf("Failed to output NDF of network %q: %+v",
+						state.GetNetwork(), err)
+				}
+				err = state.CloseNdfOutputs()
+				if err != nil {
+					jww.ERROR.Printf("Failed to close NDF outputs of network "+
+						"%q: %+v", state.GetNetwork(), err)
+				}
+			}
+
 			// Close GeoIP2 reader
 			impl.geoIPDBStatus.ToStopped()
 			err := impl.geoIPDB.Close()
@@ -448,6 +619,12 @@ var rootCmd = &cobra.Command{
 				jww.ERROR.Printf("Error closing GeoIP2 database reader: %+v", err)
 			}
 
+			// Stop renewing the scheduler leases and release them so that a
+			// standby server can take over
+			for _, quitChan := range schedulerLeaseTrackerQuitChans {
+				quitChan <- struct{}{}
+			}
+
 			// Close connection to the database
 			err = closeFunc()
 			if err != nil {
@@ -459,8 +636,9 @@ var rootCmd = &cobra.Command{
 				pprof.StopCPUProfile()
 			}
 			stopOnce.Do(stopRounds)
+			// Drain pending round updates and metrics while storage is open
+			impl.Shutdown(closeTimeout)
 			stopForKillOnce.Do(stopForKill)
-			impl.Comms.Shutdown()
 		}
 		ReceiveUSR2Signal(stopEverything)
 
@@ -622,7 +800,7 @@ func (m *RegistrationImpl) update(in fsnotify.Event) {
 	m.updateVersions()
 	m.updateRateLimiting()
 	m.updateEarliestRound()
-
+	m.updatePruneRetention()
 }
 
 func (m *RegistrationImpl) updateEarliestRound() {
@@ -637,6 +815,17 @@ func (m *RegistrationImpl) updateEarliestRound() {
 
 }
 
+func (m *RegistrationImpl) updatePruneRetention() {
+	pruneRetention := viper.GetDuration("pruneRetentionLimit")
+	if pruneRetention <= 0 {
+		pruneRetention = defaultPruneRetention
+	}
+
+	m.params.pruneRetentionLimitMux.Lock()
+	m.params.pruneRetentionLimit = pruneRetention
+	m.params.pruneRetentionLimitMux.Unlock()
+}
+
 func (m *RegistrationImpl) updateRateLimiting() {
 	// Get rate limiting values
 	capacity := viper.GetUint32("RateLimiting.Capacity")
@@ -653,13 +842,15 @@ func (m *RegistrationImpl) updateRateLimiting() {
 	}
 	leakedDurations = leakedDurations * uint64(time.Millisecond)
 
-	m.State.InternalNdfLock.Lock()
-	currentNdf := m.State.GetUnprunedNdf()
-	currentNdf.RateLimits.Capacity = uint(capacity)
-	currentNdf.RateLimits.LeakedTokens = uint(leakedTokens)
-	currentNdf.RateLimits.LeakDuration = leakedDurations
+	for _, state := range m.getNetworkStates() {
+		state.InternalNdfLock.Lock()
+		currentNdf := state.GetUnprunedNdf()
+		currentNdf.RateLimits.Capacity = uint(capacity)
+		currentNdf.RateLimits.LeakedTokens = uint(leakedTokens)
+		currentNdf.RateLimits.LeakDuration = leakedDurations
 
-	m.State.InternalNdfLock.Unlock()
+		state.InternalNdfLock.Unlock()
+	}
 
 }
 
@@ -686,12 +877,14 @@ func (m *RegistrationImpl) updateVersions() {
 	}
 
 	// Modify the client version
-	m.State.InternalNdfLock.Lock()
-	updateNDF := m.State.GetUnprunedNdf()
-	jww.DEBUG.Printf("Updating client version from %s to %s", updateNDF.ClientVersion, clientVersion)
-	updateNDF.ClientVersion = clientVersion
-	m.State.UpdateInternalNdf(updateNDF)
-	m.State.InternalNdfLock.Unlock()
+	for _, state := range m.getNetworkStates() {
+		state.InternalNdfLock.Lock()
+		updateNDF := state.GetUnprunedNdf()
+		jww.DEBUG.Printf("Updating client version from %s to %s", updateNDF.ClientVersion, clientVersion)
+		updateNDF.ClientVersion = clientVersion
+		state.UpdateInternalNdf(updateNDF)
+		state.InternalNdfLock.Unlock()
+	}
 
 	// Modify server and gateway versions
 	m.params.versionLock.Lock()
@@ -0,0 +1,67 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles exporting round metrics as CSV
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ExportRoundMetricsCsv writes the metrics of the rounds that finished realtime
+// between start and end to the writer as CSV, one row per round.
+func (m *RegistrationImpl) ExportRoundMetricsCsv(w io.Writer, start,
+	end time.Time) error {
+	metrics, err := m.GetRoundMetrics(start, end)
+	if err != nil {
+		return errors.Errorf("Failed to get round metrics: %+v", err)
+	}
+
+	if err = storage.WriteRoundMetricsCsv(w, metrics); err != nil {
+		return err
+	}
+
+	jww.INFO.Printf("Exported %d round metrics between %s and %s",
+		len(metrics), start, end)
+	return nil
+}
+
+// ExportRoundMetricsCsvFile writes the metrics of the rounds that finished
+// realtime between start and end to the CSV file at the path, replacing any
+// existing file.
+func (m *RegistrationImpl) ExportRoundMetricsCsvFile(path string, start,
+	end time.Time) error {
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return errors.Errorf("Failed to expand round metric file path: %+v",
+			err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), utils.DirPerms); err != nil {
+		return errors.Errorf("Failed to create round metric file directory: "+
+			"%+v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		utils.FilePerms)
+	if err != nil {
+		return errors.Errorf("Failed to open round metric file: %+v", err)
+	}
+
+	err = m.ExportRoundMetricsCsv(f, start, end)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = errors.Errorf("Failed to close round metric file: %+v", closeErr)
+	}
+	return err
+}
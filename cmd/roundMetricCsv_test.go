@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"encoding/csv"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that ExportRoundMetricsCsvFile() writes only the rounds that finished
+// realtime within the range to the file.
+func TestRegistrationImpl_ExportRoundMetricsCsvFile(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "",
+		"TestRegistrationImpl_ExportRoundMetricsCsvFile", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	now := time.Now()
+	nid := id.NewIdFromString("node", id.Node, t)
+	err = storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: 1}, &storage.Node{Code: "TEST", Id: nid.Bytes()})
+	if err != nil {
+		t.Fatalf("Failed to insert node: %+v", err)
+	}
+	for rid, realtimeEnd := range map[uint64]time.Time{
+		1: now.Add(-time.Hour),
+		2: now.Add(-10 * time.Minute),
+		3: now.Add(-5 * time.Minute),
+	} {
+		err = storage.PermissioningDb.InsertRoundMetric(&storage.RoundMetric{
+			Id:            rid,
+			PrecompStart:  realtimeEnd.Add(-3 * time.Second),
+			PrecompEnd:    realtimeEnd.Add(-2 * time.Second),
+			RealtimeStart: realtimeEnd.Add(-time.Second),
+			RealtimeEnd:   realtimeEnd,
+			RoundEnd:      realtimeEnd,
+			BatchSize:     32,
+		}, [][]byte{nid.Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert round metric %d: %+v", rid, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics", "rounds.csv")
+	impl := &RegistrationImpl{}
+	err = impl.ExportRoundMetricsCsvFile(path, now.Add(-20*time.Minute), now)
+	if err != nil {
+		t.Fatalf("ExportRoundMetricsCsvFile() returned an error: %+v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open exported file: %+v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %+v", err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("Unexpected number of rows.\n\texpected: %d\n\treceived: %d",
+			3, len(rows))
+	}
+	if !reflect.DeepEqual(storage.RoundMetricCsvHeader, rows[0]) {
+		t.Errorf("Unexpected header.\n\texpected: %v\n\treceived: %v",
+			storage.RoundMetricCsvHeader, rows[0])
+	}
+	for i, rid := range []string{"2", "3"} {
+		if rows[i+1][0] != rid || rows[i+1][9] != nid.String() {
+			t.Errorf("Unexpected row %d: %v", i+1, rows[i+1])
+		}
+	}
+
+	// An inverted range is rejected
+	err = impl.ExportRoundMetricsCsvFile(path, now, now.Add(-time.Minute))
+	if err == nil {
+		t.Errorf("ExportRoundMetricsCsvFile() did not return an error for " +
+			"an inverted range.")
+	}
+}
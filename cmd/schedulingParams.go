@@ -0,0 +1,36 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles retrieving the scheduling parameters the server is running with
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/xx_network/comms/connect"
+)
+
+// GetSchedulingParams returns a copy of the scheduling parameters currently
+// used to create rounds on behalf of an administrator, including any updates
+// made while the server runs. Changes to the returned parameters do not affect
+// scheduling. Returns an error if the sender is not an authenticated
+// administrator or scheduling has not started.
+// Served over HTTP at schedulingPath.
+func (m *RegistrationImpl) GetSchedulingParams(auth *connect.Auth) (
+	*scheduling.Params, error) {
+	if err := m.checkAdminAuth(auth, "view scheduling parameters"); err != nil {
+		return nil, err
+	}
+
+	if m.schedulingParams == nil {
+		return nil, errors.New("Scheduling parameters have not been loaded")
+	}
+
+	params := m.schedulingParams.SafeCopy().DeepCopy()
+	return &params, nil
+}
@@ -0,0 +1,81 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/scheduling"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+)
+
+// Tests that GetSchedulingParams() returns the loaded scheduling parameters and
+// that changing them does not change the parameters used for scheduling.
+func TestRegistrationImpl_GetSchedulingParams(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+	impl.schedulingParams = scheduling.ParseParams([]byte(`{
+		"TeamSize": 5,
+		"MinTeamSize": 3,
+		"BatchSize": 64,
+		"TeamBatchSizes": {"3": 32},
+		"MinimumDelay": 60,
+		"RealtimeDelay": 3000,
+		"Threshold": 0.3
+	}`))
+
+	params, err := impl.GetSchedulingParams(auth)
+	if err != nil {
+		t.Fatalf("GetSchedulingParams() returned an error: %+v", err)
+	}
+
+	if params.TeamSize != 5 || params.MinTeamSize != 3 ||
+		params.BatchSize != 64 || params.TeamBatchSizes[3] != 32 ||
+		params.RealtimeDelay != 3000 || params.Threshold != 0.3 {
+		t.Errorf("Returned params do not match the loaded config: %+v", params)
+	}
+
+	// Defaults applied when loading the config are returned
+	if params.PrecomputationTimeout != 60000 {
+		t.Errorf("Returned params do not have the default timeout."+
+			"\n\texpected: %d\n\treceived: %d", 60000,
+			params.PrecomputationTimeout)
+	}
+
+	params.TeamSize = 7
+	params.TeamBatchSizes[3] = 16
+	live := impl.schedulingParams.SafeCopy()
+	if live.TeamSize != 5 || live.TeamBatchSizes[3] != 32 {
+		t.Errorf("Changing the returned params changed the live params: %+v",
+			live)
+	}
+}
+
+// Error path: Tests that GetSchedulingParams() rejects callers that are not
+// authenticated administrators and returns an error before scheduling starts.
+func TestRegistrationImpl_GetSchedulingParams_Error(t *testing.T) {
+	nid := id.NewIdFromString("test", id.Node, t)
+	adminId := id.NewIdFromString("admin", id.User, t)
+	impl, auth := newBanTestImpl(nid, adminId, t)
+
+	if _, err := impl.GetSchedulingParams(auth); err == nil {
+		t.Errorf("Expected error before the params are loaded.")
+	}
+
+	impl.schedulingParams = scheduling.ParseParams([]byte(`{"TeamSize": 3}`))
+	unauthorized := []*connect.Auth{
+		nil,
+		{IsAuthenticated: false, Sender: auth.Sender},
+	}
+	for i, a := range unauthorized {
+		if _, err := impl.GetSchedulingParams(a); err == nil {
+			t.Errorf("Expected error getting params with auth %d.", i)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles shutting down the server without losing pending round accounting
+
+package cmd
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/scheduling"
+	"sync/atomic"
+	"time"
+)
+
+// Shutdown gracefully stops the server. Polls are rejected from then on, the
+// round updates still being signed or added are drained, and the round metrics
+// waiting to be retried are flushed to storage before comms are shut down, so
+// that the accounting of the last rounds is not lost. Waits at most timeout for
+// the round updates of each network. Calls after the first do nothing.
+func (m *RegistrationImpl) Shutdown(timeout time.Duration) {
+	if !atomic.CompareAndSwapUint32(&m.shuttingDown, 0, 1) {
+		return
+	}
+	jww.INFO.Printf("Shutting down, no longer accepting polls")
+
+	for _, state := range m.getNetworkStates() {
+		err := state.FlushRoundUpdates(timeout)
+		if err != nil {
+			jww.ERROR.Printf("Failed to drain round updates of network %q: "+
+				"%+v", state.GetNetwork(), err)
+		}
+	}
+
+	if remaining := scheduling.FlushRoundMetrics(); remaining > 0 {
+		jww.ERROR.Printf("Failed to store %d round metrics before shutting "+
+			"down", remaining)
+	}
+
+	m.Comms.Shutdown()
+	jww.INFO.Printf("Shut down")
+}
@@ -0,0 +1,78 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/testkeys"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/primitives/id"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that Shutdown() adds every pending round update before returning and
+// that polls are rejected afterwards.
+func TestRegistrationImpl_Shutdown(t *testing.T) {
+	const numUpdates = 100
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create new database: %+v", err)
+	}
+
+	testParams.KeyPath = testkeys.GetCAKeyPath()
+	impl, err := StartRegistration(newTestParams())
+	if err != nil {
+		t.Fatalf("Unable to start registration: %+v", err)
+	}
+
+	updates, err := impl.State.GetUpdates(0)
+	if err != nil {
+		t.Fatalf("GetUpdates() produced an error: %+v", err)
+	}
+	initial := len(updates)
+	for i := 0; i < numUpdates; i++ {
+		err = impl.State.AddRoundUpdate(&pb.RoundInfo{
+			ID:         uint64(i + 1),
+			Timestamps: make([]uint64, states.FAILED),
+		})
+		if err != nil {
+			t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+		}
+	}
+
+	impl.Shutdown(10 * time.Second)
+
+	updates, err = impl.State.GetUpdates(0)
+	if err != nil {
+		t.Fatalf("GetUpdates() produced an error: %+v", err)
+	}
+	if len(updates)-initial != numUpdates {
+		t.Errorf("Not all pending round updates were added on shutdown."+
+			"\n\texpected: %d\n\treceived: %d", numUpdates,
+			len(updates)-initial)
+	}
+
+	testHost, err := connect.NewHost(id.NewIdFromUInt(0, id.Node, t),
+		"0.0.0.0:1234", make([]byte, 0), connect.GetDefaultHostParams())
+	if err != nil {
+		t.Fatalf("Failed to create host: %+v", err)
+	}
+	_, err = impl.Poll(&pb.PermissioningPoll{},
+		&connect.Auth{IsAuthenticated: true, Sender: testHost})
+	if err == nil || !strings.Contains(err.Error(), "shutting down") {
+		t.Errorf("Poll() was not rejected after shutting down: %+v", err)
+	}
+
+	// Shutting down again does nothing
+	impl.Shutdown(10 * time.Second)
+}
@@ -0,0 +1,80 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles checkpointing the network states to snapshot files
+
+package cmd
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"time"
+)
+
+// stateSnapshotPath returns the path of the snapshot file of the network. The
+// default network uses the configured path and every other network appends its
+// name to it.
+func stateSnapshotPath(path string, state *storage.NetworkState) string {
+	if state.GetNetwork() == "" {
+		return path
+	}
+	return path + "." + state.GetNetwork()
+}
+
+// RestoreStateSnapshots restores the state of every network from its snapshot
+// file under the path, if one has been written and it is not behind the
+// database. Must be called before scheduling starts.
+func (m *RegistrationImpl) RestoreStateSnapshots(path string) error {
+	for _, state := range m.getNetworkStates() {
+		snapshot, err := storage.ReadStateSnapshot(stateSnapshotPath(path, state))
+		if err != nil {
+			return err
+		} else if snapshot == nil {
+			jww.INFO.Printf("No state snapshot of network %q to restore",
+				state.GetNetwork())
+			continue
+		}
+
+		if _, err = state.RestoreSnapshot(snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TrackStateSnapshots starts a service that every interval writes a snapshot of
+// the state of every network to its snapshot file under the path. A final
+// snapshot is written when the quit channel is invoked.
+func (m *RegistrationImpl) TrackStateSnapshots(path string,
+	interval time.Duration, quit chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			jww.INFO.Print("Stopping state snapshot tracker.")
+			m.WriteStateSnapshots(path)
+			return
+		case <-ticker.C:
+			m.WriteStateSnapshots(path)
+		}
+	}
+}
+
+// WriteStateSnapshots writes a snapshot of the state of every network to its
+// snapshot file under the path.
+func (m *RegistrationImpl) WriteStateSnapshots(path string) {
+	for _, state := range m.getNetworkStates() {
+		err := state.WriteSnapshot(stateSnapshotPath(path, state))
+		if err != nil {
+			jww.ERROR.Printf("Could not write state snapshot of network %q: "+
+				"%+v", state.GetNetwork(), err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import (
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/region"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the snapshots written by WriteStateSnapshots() are restored by
+// RestoreStateSnapshots() to the state created after a restart.
+func TestRegistrationImpl_RestoreStateSnapshots(t *testing.T) {
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Unable to create state: %+v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = state.IncrementRoundID(); err != nil {
+			t.Fatalf("Failed to increment round ID: %+v", err)
+		}
+	}
+	state.SetAddressSpaceSize(12)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	m := &RegistrationImpl{State: state}
+	m.WriteStateSnapshots(path)
+
+	// Simulate a restart with an empty database
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	restarted, err := storage.NewState(getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Unable to create state: %+v", err)
+	}
+	m = &RegistrationImpl{State: restarted}
+	if err = m.RestoreStateSnapshots(path); err != nil {
+		t.Fatalf("RestoreStateSnapshots() returned an error: %+v", err)
+	}
+
+	expected, received := state.GetSnapshot(), restarted.GetSnapshot()
+	if received.RoundID != expected.RoundID ||
+		received.AddressSpaceSize != expected.AddressSpaceSize {
+		t.Errorf("Unexpected restored state.\n\texpected: %+v"+
+			"\n\treceived: %+v", expected, received)
+	}
+}
+
+// Tests that stateSnapshotPath() appends the name of additional networks to the
+// path.
+func TestStateSnapshotPath(t *testing.T) {
+	var err error
+	dblck.Lock()
+	defer dblck.Unlock()
+
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, err := storage.NewNetworkState("testnet", getTestKey(), 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Unable to create state: %+v", err)
+	}
+
+	if path := stateSnapshotPath("state.json", state); path != "state.json.testnet" {
+		t.Errorf("Unexpected snapshot path.\n\texpected: %s\n\treceived: %s",
+			"state.json.testnet", path)
+	}
+}
@@ -10,6 +10,7 @@ package scheduling
 // Contains the handler for node updates
 import (
 	"fmt"
+	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	pb "gitlab.com/elixxir/comms/mixmessages"
@@ -26,11 +27,24 @@ import (
 type stateChanger struct {
 	lastRealtime time.Time
 
-	realtimeDelay time.Duration
-	realtimeDelta time.Duration
+	realtimeDelay        time.Duration
+	realtimeDelayPerNode time.Duration
+	realtimeDelta        time.Duration
 
 	realtimeTimeout time.Duration
 
+	// Time a node that fails a round with an error is held out of teams
+	nodeErrorCooldown time.Duration
+
+	// Number of errors a node may report while not in a round before it is
+	// flagged, and the time a flagged node is held out of teams
+	roundlessErrorLimit    uint32
+	roundlessErrorCooldown time.Duration
+
+	// Format of the summary logged for each completed round; empty if no
+	// summary is logged
+	roundSummaryFormat string
+
 	pool *waitingPool
 
 	state *storage.NetworkState
@@ -38,6 +52,58 @@ type stateChanger struct {
 	roundTracker *RoundTracker
 
 	roundTimeoutChan chan id.Round
+
+	// Realtime timings of rounds that have not yet reached realtime, so that
+	// rounds keep the params they were created with
+	roundTimings map[id.Round]roundTiming
+
+	// Records node state transitions to storage; nil if they are not recorded
+	transitionLog *nodeTransitionLog
+}
+
+// roundTiming holds the realtime timings a round was created with.
+type roundTiming struct {
+	realtimeDelay        time.Duration
+	realtimeDelayPerNode time.Duration
+	realtimeDelta        time.Duration
+	realtimeTimeout      time.Duration
+}
+
+// realtimeDelayFor returns the delay before realtime starts for a round with a
+// team of teamSize nodes, which is the realtime delay plus the per node delay
+// for each node in the team.
+func (rt roundTiming) realtimeDelayFor(teamSize int) time.Duration {
+	return rt.realtimeDelay + time.Duration(teamSize)*rt.realtimeDelayPerNode
+}
+
+// setRoundTiming records the realtime timings of the newly created round.
+func (sc *stateChanger) setRoundTiming(newRound protoRound) {
+	if sc.roundTimings == nil {
+		sc.roundTimings = make(map[id.Round]roundTiming)
+	}
+	sc.roundTimings[newRound.ID] = roundTiming{
+		realtimeDelay:        newRound.RealtimeDelay,
+		realtimeDelayPerNode: newRound.RealtimeDelayPerNode,
+		realtimeDelta:        newRound.MinimumDelay,
+		realtimeTimeout:      newRound.RealtimeTimeout,
+	}
+}
+
+// popRoundTiming returns the realtime timings the round was created with and
+// forgets them, as they are only used once the round finishes precomputation.
+// Rounds without recorded timings use those of the state changer.
+func (sc *stateChanger) popRoundTiming(roundID id.Round) roundTiming {
+	timing, exists := sc.roundTimings[roundID]
+	if !exists {
+		return roundTiming{
+			realtimeDelay:        sc.realtimeDelay,
+			realtimeDelayPerNode: sc.realtimeDelayPerNode,
+			realtimeDelta:        sc.realtimeDelta,
+			realtimeTimeout:      sc.realtimeTimeout,
+		}
+	}
+	delete(sc.roundTimings, roundID)
+	return timing
 }
 
 // HandleNodeUpdates handles the node state changes.
@@ -53,6 +119,16 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 	// is no update, it is released in the endpoint, otherwise it is released
 	// here which blocks all future polls until processing completes
 	defer n.GetPollingLock().Unlock()
+
+	// Ignore an update that was already handled so that a node reporting the
+	// same transition again cannot advance its round twice
+	if !n.MarkUpdateHandled(update.Sequence) {
+		jww.WARN.Printf("Ignoring duplicate update %d of node %s from %s "+
+			"to %s", update.Sequence, update.Node, update.FromActivity,
+			update.ToActivity)
+		return nil
+	}
+
 	hasRound, r := n.GetCurrentRound()
 
 	// Enforce that only error updates are allowed for a failed round
@@ -63,6 +139,19 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 		update.ToActivity = current.ERROR
 	}
 
+	// Keep an audit trail of the transition for post-mortem analysis
+	transition := &storage.NodeStateTransition{
+		NodeId:       update.Node.Marshal(),
+		FromActivity: uint32(update.FromActivity),
+		ToActivity:   uint32(update.ToActivity),
+		Timestamp:    time.Now(),
+	}
+	if hasRound {
+		roundID := uint64(r.GetRoundID())
+		transition.RoundId = &roundID
+	}
+	sc.transitionLog.record(transition)
+
 	if update.ClientErrors != nil && len(update.ClientErrors) > 0 {
 		r.AppendClientErrors(update.ClientErrors)
 	}
@@ -74,23 +163,52 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 				NodeId: id.Permissioning.Marshal(),
 				Error:  fmt.Sprintf("Round killed due to particiption of banned node %s", update.Node),
 			}
+			if update.Reason != "" {
+				banError.Error += ": " + update.Reason
+			}
 			err := signature.SignRsa(banError, sc.state.GetPrivateKey())
 			if err != nil {
 				return errors.Errorf("Failed to sign error message for banned node %s: %+v", update.Node, err)
 			}
 			n.ClearRound()
-			return killRound(sc.state, r, banError, sc.roundTracker)
+			return sc.killRound(r, banError, storage.BannedNodeError)
 		} else {
 			sc.pool.Ban(n)
 			return nil
 		}
 	}
 
+	// remove the node from scheduling if it has been decommissioned
+	if update.ToStatus == node.Decommissioned &&
+		update.FromStatus != node.Decommissioned {
+		sc.pool.Remove(n)
+		if hasRound && !roundReachedRealtime(r) {
+			decommissionError := &pb.RoundError{
+				Id:     uint64(r.GetRoundID()),
+				NodeId: id.Permissioning.Marshal(),
+				Error:  fmt.Sprintf("Round killed due to decommissioning of node %s", update.Node),
+			}
+			err := signature.SignRsa(decommissionError, sc.state.GetPrivateKey())
+			if err != nil {
+				return errors.Errorf("Failed to sign error message for decommissioned node %s: %+v", update.Node, err)
+			}
+			n.ClearRound()
+			return sc.killRound(r, decommissionError,
+				storage.DecommissionedNodeError)
+		}
+		return nil
+	}
+
 	//get node and round information
 	switch update.ToActivity {
 	case current.NOT_STARTED:
 		// Do nothing
 	case current.WAITING:
+		// A decommissioned node that finished its round is never rescheduled
+		if update.ToStatus == node.Decommissioned {
+			return nil
+		}
+
 		// If the node was in the offline pool, set it to online
 		//  (which also adds it to the online pool)
 		if update.FromStatus == node.Inactive && update.ToStatus == node.Active {
@@ -129,11 +247,13 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 			// This signals the end of the precomp timeout,
 			// followed by initiating the realtime timeout.
 			r.DenoteRoundCompleted()
+			timing := sc.popRoundTiming(r.GetRoundID())
 			go waitForRoundTimeout(sc.roundTimeoutChan, sc.state, r,
-				sc.realtimeTimeout, true)
+				timing.realtimeTimeout, true)
 
-			startTime := time.Now().Add(sc.realtimeDelay)
-			nextRoundMinimum := sc.lastRealtime.Add(sc.realtimeDelta)
+			startTime := time.Now().Add(
+				timing.realtimeDelayFor(r.GetTopology().Len()))
+			nextRoundMinimum := sc.lastRealtime.Add(timing.realtimeDelta)
 			if nextRoundMinimum.After(startTime) {
 				startTime = nextRoundMinimum
 			}
@@ -186,6 +306,7 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 
 		// Clear the round
 		n.ClearRound()
+		n.ResetRoundlessErrors()
 
 		// Keep track of when the first node reached the completed state
 		if r.GetTopology().IsLastNode(n.GetID()) {
@@ -220,6 +341,8 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 
 			// Store round metric in another thread for completed round
 			go StoreRoundMetric(roundInfo, r.GetRoundState(), r.GetRealtimeCompletedTs())
+			logRoundSummary(sc.roundSummaryFormat, roundInfo,
+				r.GetRealtimeCompletedTs())
 
 			// Commit metrics about the round to storage
 			return nil
@@ -235,8 +358,13 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 			// Signal the round as completed to disable the timeout
 			r.DenoteRoundCompleted()
 
+			// Hold the node that caused the failure out of the next teams
+			sc.startErrorCooldown(update)
+
 			// Fail the round and make accompanying round state updates
-			err = killRound(sc.state, r, update.Error, sc.roundTracker)
+			err = sc.killRound(r, update.Error, storage.NodeReportedError)
+		} else {
+			sc.handleRoundlessError(n, update)
 		}
 		return err
 	}
@@ -244,16 +372,18 @@ func (sc *stateChanger) HandleNodeUpdates(update node.UpdateNotification) error
 	return nil
 }
 
-// Insert metrics about the newly-completed round into storage
+// Insert metrics about the newly-completed round into storage. If the insert
+// fails, it is retried in the background.
 func StoreRoundMetric(roundInfo *pb.RoundInfo, roundEnd states.Round, realtimeTs int64) {
 	metric := &storage.RoundMetric{
-		Id:            roundInfo.ID,
-		PrecompStart:  time.Unix(0, int64(roundInfo.Timestamps[states.PRECOMPUTING])),
-		PrecompEnd:    time.Unix(0, int64(roundInfo.Timestamps[states.STANDBY])),
-		RealtimeStart: time.Unix(0, int64(roundInfo.Timestamps[states.REALTIME])),
-		RealtimeEnd:   time.Unix(0, realtimeTs),
-		RoundEnd:      time.Unix(0, int64(roundInfo.Timestamps[roundEnd])),
-		BatchSize:     roundInfo.BatchSize,
+		Id:               roundInfo.ID,
+		PrecompStart:     time.Unix(0, int64(roundInfo.Timestamps[states.PRECOMPUTING])),
+		PrecompEnd:       time.Unix(0, int64(roundInfo.Timestamps[states.STANDBY])),
+		RealtimeStart:    time.Unix(0, int64(roundInfo.Timestamps[states.REALTIME])),
+		RealtimeEnd:      time.Unix(0, realtimeTs),
+		RoundEnd:         time.Unix(0, int64(roundInfo.Timestamps[roundEnd])),
+		BatchSize:        roundInfo.BatchSize,
+		ClientErrorCount: uint32(len(roundInfo.ClientErrors)),
 	}
 
 	precompDuration := metric.PrecompEnd.Sub(metric.PrecompStart)
@@ -262,17 +392,132 @@ func StoreRoundMetric(roundInfo *pb.RoundInfo, roundEnd states.Round, realtimeTs
 	jww.TRACE.Printf("Precomp for round %v took: %v", roundInfo.GetRoundId(), precompDuration)
 	jww.TRACE.Printf("Realtime for round %v took: %v", roundInfo.GetRoundId(), realTimeDuration)
 
-	err := storage.PermissioningDb.InsertRoundMetric(metric, roundInfo.Topology)
+	topology, unknown := checkRoundTopology(roundInfo)
+	metric.UnknownNodeCount = uint32(unknown)
+
+	err := roundMetrics.insert(metric, topology)
 	if err != nil {
-		jww.ERROR.Printf("Failed to insert metric for round %d: %+v",
-			roundInfo.GetRoundId(), err)
+		jww.WARN.Printf("Failed to insert metric for round %d, queueing "+
+			"for retry: %+v", roundInfo.GetRoundId(), err)
+		roundMetrics.add(metric, topology)
+	}
+}
+
+// checkRoundTopology returns the topology of the round with the entries of
+// nodes that are not registered emptied, so that the metric is stored without
+// them, and the number of such nodes. Nodes that cannot be looked up for other
+// reasons are kept.
+func checkRoundTopology(roundInfo *pb.RoundInfo) ([][]byte, int) {
+	topology := make([][]byte, len(roundInfo.Topology))
+	var unknown []string
+	for i, nodeIdBytes := range roundInfo.Topology {
+		nid, err := id.Unmarshal(nodeIdBytes)
+		if err != nil {
+			unknown = append(unknown, fmt.Sprintf("invalid ID at %d", i))
+			continue
+		}
+
+		_, err = storage.PermissioningDb.GetNodeById(nid)
+		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+			unknown = append(unknown, nid.String())
+			continue
+		} else if err != nil {
+			jww.WARN.Printf("Failed to look up node %s in the topology of "+
+				"round %d: %+v", nid, roundInfo.GetRoundId(), err)
+		}
+		topology[i] = nodeIdBytes
+	}
+
+	if len(unknown) > 0 {
+		jww.WARN.Printf("Round %d has %d unregistered nodes in its "+
+			"topology, which are omitted from its metric: %v",
+			roundInfo.GetRoundId(), len(unknown), unknown)
+	}
+	return topology, len(unknown)
+}
+
+// roundReachedRealtime returns true if the round has been queued for or has
+// begun realtime. Such rounds are allowed to finish when a member is
+// decommissioned, as killing them would drop the messages sent by clients,
+// while rounds still in precomputation have carried no messages and are killed.
+func roundReachedRealtime(r *round.State) bool {
+	switch r.GetRoundState() {
+	case states.QUEUED, states.REALTIME, states.COMPLETED:
+		return true
+	default:
+		return false
+	}
+}
+
+// startErrorCooldown holds the node that caused the reported round error out of
+// team selection for the node error cooldown. The node named in the error is
+// held out, falling back to the reporting node if the error names none.
+func (sc *stateChanger) startErrorCooldown(update node.UpdateNotification) {
+	if sc.nodeErrorCooldown <= 0 {
+		return
+	}
+
+	nid := update.Node
+	if update.Error != nil {
+		if errorNodeId, err := id.Unmarshal(update.Error.NodeId); err == nil {
+			nid = errorNodeId
+		}
 	}
+	n := sc.state.GetNodeMap().GetNode(nid)
+	if n == nil {
+		return
+	}
+
+	cooldownUntil := time.Now().Add(sc.nodeErrorCooldown)
+	n.SetCooldownUntil(cooldownUntil)
+	jww.INFO.Printf("Node %s failed a round and is held out of teams until %s",
+		nid, cooldownUntil)
+}
+
+// handleRoundlessError counts an error the node reported while not in a round,
+// which often indicates a misconfigured node. Once the node has reported
+// roundlessErrorLimit of them since it last completed a round, it is flagged
+// with a warning and held out of team selection for the roundlessErrorCooldown,
+// if set, and its count restarts. Nodes are not flagged if the limit is 0.
+func (sc *stateChanger) handleRoundlessError(n *node.State,
+	update node.UpdateNotification) {
+	count := n.AddRoundlessError()
+	if sc.roundlessErrorLimit == 0 || count < sc.roundlessErrorLimit {
+		return
+	}
+	n.ResetRoundlessErrors()
+
+	reason := "no error given"
+	if update.Error != nil {
+		reason = update.Error.Error
+	}
+
+	if sc.roundlessErrorCooldown <= 0 {
+		jww.WARN.Printf("Node %s reported %d errors without a round and may "+
+			"be misconfigured; last error: %s", n.GetID(), count, reason)
+		return
+	}
+
+	cooldownUntil := time.Now().Add(sc.roundlessErrorCooldown)
+	n.SetCooldownUntil(cooldownUntil)
+	jww.WARN.Printf("Node %s reported %d errors without a round and may be "+
+		"misconfigured, it is held out of teams until %s; last error: %s",
+		n.GetID(), count, cooldownUntil, reason)
+}
+
+// killRound kills the round and forgets its realtime timings.
+func (sc *stateChanger) killRound(r *round.State, roundError *pb.RoundError,
+	category storage.RoundErrorCategory) error {
+	delete(sc.roundTimings, r.GetRoundID())
+	return killRound(sc.state, r, roundError, category, sc.roundTracker)
 }
 
-// killRound updates the round.State to states.FAILED, stores the round metric,
-// and clears the round from round.StateMap if all nodes are finished.
+// killRound updates the round.State to states.FAILED, stores the round metric
+// and the error with its category, and clears the round from round.StateMap if
+// all nodes are finished.
 func killRound(state *storage.NetworkState, r *round.State,
-	roundError *pb.RoundError, roundTracker *RoundTracker) error {
+	roundError *pb.RoundError, category storage.RoundErrorCategory,
+	roundTracker *RoundTracker) error {
 
 	// Append the error to and update the round state
 	roundId := r.GetRoundID()
@@ -332,7 +577,8 @@ func killRound(state *storage.NetworkState, r *round.State,
 			jww.INFO.Print(formattedError)
 
 			// Next, attempt to insert the error for the failed round
-			err = storage.PermissioningDb.InsertRoundError(roundId, formattedError)
+			err = storage.PermissioningDb.InsertRoundError(roundId, category,
+				formattedError)
 			if err != nil {
 				jww.WARN.Printf("Could not insert round error: %+v", err)
 			}
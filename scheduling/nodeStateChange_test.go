@@ -8,9 +8,11 @@
 package scheduling
 
 import (
+	"bytes"
 	"crypto/rand"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/primitives/states"
 	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/elixxir/registration/storage/round"
@@ -19,6 +21,7 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/region"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -677,6 +680,192 @@ func TestHandleNodeUpdates_BannedNode(t *testing.T) {
 
 }
 
+// Tests that the reason given for a ban is included in the signed error of the
+// round killed because of it.
+func TestHandleNodeUpdates_BannedNode_Reason(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nodeList := make([]*id.ID, 3)
+	for i := uint64(0); i < uint64(len(nodeList)); i++ {
+		nodeList[i] = id.NewIdFromUInt(i, id.Node, t)
+		err := testState.GetNodeMap().AddNode(nodeList[i], strconv.Itoa(int(i)), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+	}
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+
+	r := round.NewState_Testing(42, states.PRECOMPUTING,
+		connect.NewCircuit(nodeList), t)
+	ns := testState.GetNodeMap().GetNode(nodeList[0])
+	if err = ns.SetRound(r); err != nil {
+		t.Fatalf("Unable to set round for mock node: %v", err)
+	}
+
+	reason := "Node is serving invalid rounds"
+	ns.GetPollingLock().Lock()
+	nun, err := ns.Ban()
+	if err != nil {
+		t.Fatalf("Failed to ban node: %+v", err)
+	}
+	nun.Reason = reason
+	if err = sc.HandleNodeUpdates(nun); err != nil {
+		t.Errorf("Happy path received error: %v", err)
+	}
+
+	if r.GetRoundState() != states.FAILED {
+		t.Errorf("Round not killed.\n\tExpected: %s\n\tReceived: %s",
+			states.FAILED, r.GetRoundState())
+	}
+
+	roundErrors := r.BuildRoundInfo().Errors
+	if len(roundErrors) != 1 {
+		t.Fatalf("Unexpected number of round errors: %v", roundErrors)
+	}
+	if !strings.HasSuffix(roundErrors[0].Error, ": "+reason) {
+		t.Errorf("Round error does not contain the ban reason."+
+			"\n\tExpected suffix: %s\n\tReceived: %s", reason,
+			roundErrors[0].Error)
+	}
+	if roundErrors[0].GetSignature() == nil {
+		t.Errorf("Round error with ban reason not signed.")
+	}
+}
+
+// Tests that a decommissioned node is removed from the pool, that its round is
+// killed if it is still precomputing, and that its round is allowed to finish
+// if it has reached realtime.
+func TestHandleNodeUpdates_DecommissionedNode(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	testPool := NewWaitingPool()
+
+	// Build mock nodes and place in map
+	nodeList := make([]*id.ID, 5)
+	for i := uint64(0); i < uint64(len(nodeList)); i++ {
+		nodeList[i] = id.NewIdFromUInt(i, id.Node, t)
+		err := testState.GetNodeMap().AddNode(nodeList[i], strconv.Itoa(int(i)), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testPool.Add(testState.GetNodeMap().GetNode(nodeList[i]))
+	}
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             testPool,
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+
+	decommission := func(nid *id.ID) {
+		ns := testState.GetNodeMap().GetNode(nid)
+		ns.GetPollingLock().Lock()
+		nun, err := ns.Decommission()
+		if err != nil {
+			t.Fatalf("Failed to decommission node %s: %+v", nid, err)
+		}
+		err = sc.HandleNodeUpdates(nun)
+		if err != nil {
+			t.Errorf("Happy path received error: %v", err)
+		}
+	}
+
+	// Test that a node with no round gets removed from the pool
+	decommission(nodeList[0])
+	if testPool.Len() != len(nodeList)-1 {
+		t.Errorf("Node expected to be removed from the pool."+
+			"\n\tExpected size: %d\n\tReceived size: %d",
+			len(nodeList)-1, testPool.Len())
+	}
+
+	// Test that a node in a precomputing round has its round killed
+	precompRound := round.NewState_Testing(42, states.PRECOMPUTING,
+		connect.NewCircuit(nodeList[1:3]), t)
+	ns := testState.GetNodeMap().GetNode(nodeList[1])
+	if err = ns.SetRound(precompRound); err != nil {
+		t.Fatalf("Unable to set round for mock node: %v", err)
+	}
+	decommission(nodeList[1])
+	if hasRound, _ := ns.GetCurrentRound(); hasRound {
+		t.Errorf("Did not expect node with round after being decommissioned.")
+	}
+	if precompRound.GetRoundState() != states.FAILED {
+		t.Errorf("Precomputing round not killed."+
+			"\n\tExpected: %s\n\tReceived: %s",
+			states.FAILED, precompRound.GetRoundState())
+	}
+
+	// Test that a node in a realtime round is allowed to finish it
+	realtimeRound := round.NewState_Testing(43, states.REALTIME,
+		connect.NewCircuit(nodeList[3:]), t)
+	ns = testState.GetNodeMap().GetNode(nodeList[3])
+	if err = ns.SetRound(realtimeRound); err != nil {
+		t.Fatalf("Unable to set round for mock node: %v", err)
+	}
+	decommission(nodeList[3])
+	if hasRound, r := ns.GetCurrentRound(); !hasRound || r != realtimeRound {
+		t.Errorf("Expected node to keep its realtime round after being " +
+			"decommissioned.")
+	}
+	if realtimeRound.GetRoundState() != states.REALTIME {
+		t.Errorf("Realtime round unexpectedly changed state."+
+			"\n\tExpected: %s\n\tReceived: %s",
+			states.REALTIME, realtimeRound.GetRoundState())
+	}
+
+	// Test that the node is not returned to the pool once its round is over
+	ns.ClearRound()
+	ns.GetPollingLock().Lock()
+	err = sc.HandleNodeUpdates(node.UpdateNotification{
+		Node:         nodeList[3],
+		FromStatus:   node.Decommissioned,
+		ToStatus:     node.Decommissioned,
+		FromActivity: current.COMPLETED,
+		ToActivity:   current.WAITING,
+	})
+	if err != nil {
+		t.Errorf("Happy path received error: %v", err)
+	}
+	if testPool.Len() != len(nodeList)-3 {
+		t.Errorf("Decommissioned nodes expected to be removed from the pool."+
+			"\n\tExpected size: %d\n\tReceived size: %d",
+			len(nodeList)-3, testPool.Len())
+	}
+}
+
 // Happy path
 func TestKillRound(t *testing.T) {
 	testParams := Params{
@@ -723,7 +912,7 @@ func TestKillRound(t *testing.T) {
 
 	tesTracker := NewRoundTracker()
 
-	err = killRound(testState, r, re, tesTracker)
+	err = killRound(testState, r, re, storage.NodeReportedError, tesTracker)
 	if err != nil {
 		t.Errorf("Unexpected error in happy path: %v", err)
 	}
@@ -1098,3 +1287,632 @@ func TestHandleNodeUpdates_NOT_STARTED(t *testing.T) {
 		t.Errorf("Happy path received error: %v", err)
 	}
 }
+
+// Tests that a round moved to realtime uses the realtime timings it was created
+// with rather than those the state changer was updated to afterwards.
+func TestHandleNodeUpdates_Standby_RoundTiming(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	err = testState.GetNodeMap().AddNode(nid, "0", "", "", 0)
+	if err != nil {
+		t.Fatalf("Couldn't add node: %v", err)
+	}
+
+	roundID, err := testState.IncrementRoundID()
+	if err != nil {
+		t.Fatalf("IncrementRoundID() failed: %+v", err)
+	}
+	r, err := testState.GetRoundMap().AddRound(roundID, 32, 8, 5*time.Minute,
+		connect.NewCircuit([]*id.ID{nid}))
+	if err != nil {
+		t.Fatalf("Failed to add round: %v", err)
+	}
+	err = r.Update(states.PRECOMPUTING, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to move round to %s: %+v", states.PRECOMPUTING, err)
+	}
+	n := testState.GetNodeMap().GetNode(nid)
+	_ = n.SetRound(r)
+
+	// The round is created with a realtime delay of an hour, after which the
+	// state changer is updated to have no delay
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+	sc.setRoundTiming(protoRound{
+		ID:              roundID,
+		RealtimeDelay:   time.Hour,
+		RealtimeTimeout: 15 * time.Second,
+	})
+	sc.realtimeDelay = 0
+
+	n.GetPollingLock().Lock()
+	err = sc.HandleNodeUpdates(node.UpdateNotification{
+		Node:         nid,
+		FromActivity: current.PRECOMPUTING,
+		ToActivity:   current.STANDBY,
+	})
+	if err != nil {
+		t.Fatalf("HandleNodeUpdates() returned an error: %+v", err)
+	}
+
+	if r.GetRoundState() != states.QUEUED {
+		t.Fatalf("Round not queued.\n\texpected: %s\n\treceived: %s",
+			states.QUEUED, r.GetRoundState())
+	}
+	queued := time.Unix(0, int64(r.BuildRoundInfo().Timestamps[states.QUEUED]))
+	if time.Until(queued) < 59*time.Minute {
+		t.Errorf("Round did not use the realtime delay it was created with."+
+			"\n\texpected: %s\n\treceived: %s", time.Hour, time.Until(queued))
+	}
+	if _, exists := sc.roundTimings[roundID]; exists {
+		t.Errorf("Round timing not removed once used.")
+	}
+}
+
+// Tests that realtimeDelayFor() adds the per node delay for each node in the
+// team to the realtime delay.
+func TestRoundTiming_realtimeDelayFor(t *testing.T) {
+	tests := []struct {
+		timing   roundTiming
+		teamSize int
+		expected time.Duration
+	}{
+		{roundTiming{realtimeDelay: 3 * time.Second}, 5, 3 * time.Second},
+		{roundTiming{realtimeDelay: 3 * time.Second,
+			realtimeDelayPerNode: 200 * time.Millisecond}, 1, 3200 * time.Millisecond},
+		{roundTiming{realtimeDelay: 3 * time.Second,
+			realtimeDelayPerNode: 200 * time.Millisecond}, 3, 3600 * time.Millisecond},
+		{roundTiming{realtimeDelay: 3 * time.Second,
+			realtimeDelayPerNode: 200 * time.Millisecond}, 10, 5 * time.Second},
+		{roundTiming{realtimeDelayPerNode: time.Second}, 7, 7 * time.Second},
+	}
+
+	for i, tt := range tests {
+		delay := tt.timing.realtimeDelayFor(tt.teamSize)
+		if delay != tt.expected {
+			t.Errorf("Unexpected realtime delay for team size %d (%d)."+
+				"\n\texpected: %s\n\treceived: %s",
+				tt.teamSize, i, tt.expected, delay)
+		}
+	}
+}
+
+// Tests that a round moved to realtime is delayed by the per node delay for
+// each node in its team.
+func TestHandleNodeUpdates_Standby_RealtimeDelayPerNode(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	err = testState.GetNodeMap().AddNode(nid, "0", "", "", 0)
+	if err != nil {
+		t.Fatalf("Couldn't add node: %v", err)
+	}
+
+	roundID, err := testState.IncrementRoundID()
+	if err != nil {
+		t.Fatalf("IncrementRoundID() failed: %+v", err)
+	}
+	r, err := testState.GetRoundMap().AddRound(roundID, 32, 8, 5*time.Minute,
+		connect.NewCircuit([]*id.ID{nid}))
+	if err != nil {
+		t.Fatalf("Failed to add round: %v", err)
+	}
+	err = r.Update(states.PRECOMPUTING, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to move round to %s: %+v", states.PRECOMPUTING, err)
+	}
+	n := testState.GetNodeMap().GetNode(nid)
+	_ = n.SetRound(r)
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+	sc.setRoundTiming(protoRound{
+		ID:                   roundID,
+		RealtimeDelay:        time.Minute,
+		RealtimeDelayPerNode: time.Hour,
+		RealtimeTimeout:      15 * time.Second,
+	})
+
+	n.GetPollingLock().Lock()
+	err = sc.HandleNodeUpdates(node.UpdateNotification{
+		Node:         nid,
+		FromActivity: current.PRECOMPUTING,
+		ToActivity:   current.STANDBY,
+	})
+	if err != nil {
+		t.Fatalf("HandleNodeUpdates() returned an error: %+v", err)
+	}
+
+	if r.GetRoundState() != states.QUEUED {
+		t.Fatalf("Round not queued.\n\texpected: %s\n\treceived: %s",
+			states.QUEUED, r.GetRoundState())
+	}
+	queued := time.Unix(0, int64(r.BuildRoundInfo().Timestamps[states.QUEUED]))
+	if delay := time.Until(queued); delay < 60*time.Minute ||
+		delay > 61*time.Minute {
+		t.Errorf("Round did not use the per node realtime delay."+
+			"\n\texpected: %s\n\treceived: %s", 61*time.Minute, delay)
+	}
+}
+
+// Tests that popRoundTiming() falls back to the state changer's timings for a
+// round without recorded timings.
+func TestStateChanger_popRoundTiming_Default(t *testing.T) {
+	sc := &stateChanger{
+		realtimeDelay:   time.Second,
+		realtimeDelta:   2 * time.Second,
+		realtimeTimeout: 3 * time.Second,
+	}
+
+	expected := roundTiming{
+		realtimeDelay:   time.Second,
+		realtimeDelta:   2 * time.Second,
+		realtimeTimeout: 3 * time.Second,
+	}
+	if timing := sc.popRoundTiming(5); timing != expected {
+		t.Errorf("Unexpected default round timing."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, timing)
+	}
+}
+
+// Tests that StoreRoundMetric stores the number of client errors reported
+// during the round with its round metric.
+func TestStoreRoundMetric_ClientErrorCount(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "",
+		"TestStoreRoundMetric_ClientErrorCount", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	nodeList := make([]*id.ID, 3)
+	for i := range nodeList {
+		nodeList[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: uint64(i + 1)},
+			&storage.Node{Code: strconv.Itoa(i), Id: nodeList[i].Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert node: %+v", err)
+		}
+	}
+
+	r, err := testState.GetRoundMap().AddRound(id.Round(1), 32, 8,
+		5*time.Minute, connect.NewCircuit(nodeList))
+	if err != nil {
+		t.Fatalf("Failed to add round: %+v", err)
+	}
+
+	clientErrors := []*mixmessages.ClientError{
+		{ClientId: []byte("client0"), Error: "error0", Source: nodeList[0].Bytes()},
+		{ClientId: []byte("client1"), Error: "error1", Source: nodeList[1].Bytes()},
+	}
+	r.AppendClientErrors(clientErrors)
+
+	now := time.Now()
+	err = r.Update(states.FAILED, now)
+	if err != nil {
+		t.Fatalf("Failed to update round: %+v", err)
+	}
+	StoreRoundMetric(r.BuildRoundInfo(), states.FAILED, now.UnixNano())
+
+	metrics, err := storage.PermissioningDb.GetRoundMetrics(
+		now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to get round metrics: %+v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Unexpected number of round metrics."+
+			"\n\texpected: %d\n\treceived: %d", 1, len(metrics))
+	}
+	if metrics[0].ClientErrorCount != uint32(len(clientErrors)) {
+		t.Errorf("Unexpected ClientErrorCount."+
+			"\n\texpected: %d\n\treceived: %d", len(clientErrors),
+			metrics[0].ClientErrorCount)
+	}
+}
+
+// Tests that StoreRoundMetric() stores the metric of a round whose topology
+// includes an unregistered node, omitting the node from the stored topology
+// and counting it as unknown.
+func TestStoreRoundMetric_UnknownNode(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "",
+		"TestStoreRoundMetric_UnknownNode", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	// The node at index 1 is not registered
+	nodeList := make([]*id.ID, 3)
+	for i := range nodeList {
+		nodeList[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		if i == 1 {
+			continue
+		}
+		err = storage.PermissioningDb.InsertApplication(
+			&storage.Application{Id: uint64(i + 1)},
+			&storage.Node{Code: strconv.Itoa(i), Id: nodeList[i].Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert node: %+v", err)
+		}
+	}
+
+	r, err := testState.GetRoundMap().AddRound(id.Round(1), 32, 8,
+		5*time.Minute, connect.NewCircuit(nodeList))
+	if err != nil {
+		t.Fatalf("Failed to add round: %+v", err)
+	}
+
+	now := time.Now()
+	err = r.Update(states.FAILED, now)
+	if err != nil {
+		t.Fatalf("Failed to update round: %+v", err)
+	}
+	StoreRoundMetric(r.BuildRoundInfo(), states.FAILED, now.UnixNano())
+
+	metrics, err := storage.PermissioningDb.GetRoundMetrics(
+		now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to get round metrics: %+v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("Unexpected number of round metrics."+
+			"\n\texpected: %d\n\treceived: %d", 1, len(metrics))
+	}
+	if metrics[0].UnknownNodeCount != 1 {
+		t.Errorf("Unexpected UnknownNodeCount."+
+			"\n\texpected: %d\n\treceived: %d", 1,
+			metrics[0].UnknownNodeCount)
+	}
+
+	topologies := metrics[0].Topologies
+	if len(topologies) != 2 {
+		t.Fatalf("Unexpected number of topology entries."+
+			"\n\texpected: %d\n\treceived: %d", 2, len(topologies))
+	}
+	for _, topology := range topologies {
+		if !bytes.Equal(topology.NodeId, nodeList[topology.Order].Bytes()) ||
+			topology.Order == 1 {
+			t.Errorf("Unexpected topology entry %+v.", topology)
+		}
+	}
+}
+
+// Tests that a round in progress completes while the network is draining.
+func TestHandleNodeUpdates_Completed_Draining(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nodeList := make([]*id.ID, 3)
+	for i := range nodeList {
+		nodeList[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = testState.GetNodeMap().AddNode(nodeList[i], strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+	}
+
+	roundState, err := testState.GetRoundMap().AddRound(id.Round(1), 32, 8,
+		5*time.Minute, connect.NewCircuit(nodeList))
+	if err != nil {
+		t.Fatalf("Failed to add round: %v", err)
+	}
+	err = roundState.Update(states.REALTIME, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to move round to realtime: %v", err)
+	}
+
+	testState.Drain()
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+	for _, nid := range nodeList {
+		_ = testState.GetNodeMap().GetNode(nid).SetRound(roundState)
+		testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+
+		err = sc.HandleNodeUpdates(node.UpdateNotification{
+			Node:         nid,
+			FromActivity: current.REALTIME,
+			ToActivity:   current.COMPLETED,
+		})
+		if err != nil {
+			t.Errorf("Failed to handle completed update: %v", err)
+		}
+	}
+
+	if roundState.GetRoundState() != states.COMPLETED {
+		t.Errorf("Round did not complete while draining."+
+			"\n\texpected: %s\n\treceived: %s", states.COMPLETED,
+			roundState.GetRoundState())
+	}
+}
+
+// Tests that when a round fails because of a node's error, the node named in
+// the error is held out of teams for the node error cooldown while the
+// reporting node is not.
+func TestHandleNodeUpdates_Error_Cooldown(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nodeList := make([]*id.ID, 3)
+	for i := uint64(0); i < uint64(len(nodeList)); i++ {
+		nodeList[i] = id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nodeList[i], strconv.Itoa(int(i)), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+	}
+
+	roundID, err := testState.GetRoundID()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	roundState := round.NewState_Testing(
+		roundID, 0, connect.NewCircuit(nodeList), t)
+	for _, nid := range nodeList {
+		_ = testState.GetNodeMap().GetNode(nid).SetRound(roundState)
+	}
+
+	// The first node reports an error caused by the second node
+	testUpdate := node.UpdateNotification{
+		Node:         nodeList[0],
+		FromActivity: current.WAITING,
+		ToActivity:   current.ERROR,
+		Error: &mixmessages.RoundError{
+			Id:     uint64(roundID),
+			NodeId: nodeList[1].Bytes(),
+			Error:  "test",
+		},
+	}
+	testState.GetNodeMap().GetNode(testUpdate.Node).GetPollingLock().Lock()
+
+	cooldown := time.Minute
+	sc := &stateChanger{
+		lastRealtime:      time.Unix(0, 0),
+		realtimeTimeout:   15 * time.Second,
+		nodeErrorCooldown: cooldown,
+		pool:              NewWaitingPool(),
+		state:             testState,
+		roundTracker:      NewRoundTracker(),
+		roundTimeoutChan:  make(chan id.Round, 1),
+		roundTimings:      make(map[id.Round]roundTiming),
+	}
+
+	start := time.Now()
+	err = sc.HandleNodeUpdates(testUpdate)
+	if err != nil {
+		t.Fatalf("Failed to handle update: %+v", err)
+	}
+
+	cooldownUntil := testState.GetNodeMap().GetNode(nodeList[1]).GetCooldownUntil()
+	if cooldownUntil.Before(start.Add(cooldown)) ||
+		cooldownUntil.After(time.Now().Add(cooldown)) {
+		t.Errorf("Node that caused the error has an unexpected cooldown."+
+			"\n\texpected: %s\n\treceived: %s", start.Add(cooldown), cooldownUntil)
+	}
+	for _, nid := range []*id.ID{nodeList[0], nodeList[2]} {
+		cooldownUntil = testState.GetNodeMap().GetNode(nid).GetCooldownUntil()
+		if !cooldownUntil.IsZero() {
+			t.Errorf("Node %s that did not cause the error has a cooldown."+
+				"\n\texpected: %s\n\treceived: %s", nid, time.Time{}, cooldownUntil)
+		}
+	}
+}
+
+// Tests that a node reporting errors while not in a round is flagged once it
+// reaches the roundless error limit: held out of teams when a cooldown is set,
+// and only counted otherwise.
+func TestHandleNodeUpdates_Error_Roundless(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	const limit = 3
+	for i, cooldown := range []time.Duration{time.Minute, 0} {
+		nid := id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		n := testState.GetNodeMap().GetNode(nid)
+
+		testPool := NewWaitingPool()
+		testPool.Add(n)
+		sc := &stateChanger{
+			lastRealtime:           time.Unix(0, 0),
+			realtimeTimeout:        15 * time.Second,
+			roundlessErrorLimit:    limit,
+			roundlessErrorCooldown: cooldown,
+			pool:                   testPool,
+			state:                  testState,
+			roundTracker:           NewRoundTracker(),
+			roundTimeoutChan:       make(chan id.Round, 1),
+			roundTimings:           make(map[id.Round]roundTiming),
+		}
+
+		reportError := func() {
+			n.GetPollingLock().Lock()
+			err := sc.HandleNodeUpdates(node.UpdateNotification{
+				Node:         nid,
+				FromActivity: current.WAITING,
+				ToActivity:   current.ERROR,
+				Error: &mixmessages.RoundError{
+					NodeId: nid.Bytes(),
+					Error:  "misconfigured",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to handle update: %+v", err)
+			}
+		}
+
+		for j := 1; j < limit; j++ {
+			reportError()
+			if count := n.GetRoundlessErrors(); count != uint32(j) {
+				t.Errorf("Unexpected roundless error count (cooldown %s)."+
+					"\n\texpected: %d\n\treceived: %d", cooldown, j, count)
+			}
+		}
+		if !n.GetCooldownUntil().IsZero() || testPool.AvailableLen() != 1 {
+			t.Errorf("Node flagged before reaching the limit (cooldown %s).",
+				cooldown)
+		}
+
+		start := time.Now()
+		reportError()
+		if count := n.GetRoundlessErrors(); count != 0 {
+			t.Errorf("Roundless error count not reset after flagging "+
+				"(cooldown %s): %d", cooldown, count)
+		}
+
+		cooldownUntil := n.GetCooldownUntil()
+		if cooldown == 0 {
+			if !cooldownUntil.IsZero() || testPool.AvailableLen() != 1 {
+				t.Errorf("Node held out of teams without a cooldown: %s",
+					cooldownUntil)
+			}
+		} else if cooldownUntil.Before(start.Add(cooldown)) ||
+			testPool.AvailableLen() != 0 {
+			t.Errorf("Node not held out of teams after reaching the limit."+
+				"\n\texpected: %s\n\treceived: %s", start.Add(cooldown),
+				cooldownUntil)
+		}
+	}
+}
+
+// Tests that a COMPLETED update handled twice is ignored the second time and
+// that the round only completes once every node has reported COMPLETED.
+func TestHandleNodeUpdates_Completed_Duplicate(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	nodeList := make([]*id.ID, 2)
+	for i := range nodeList {
+		nodeList[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = testState.GetNodeMap().AddNode(nodeList[i], strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %+v", err)
+		}
+	}
+
+	r, err := testState.GetRoundMap().AddRound(id.Round(1), 32, 8,
+		5*time.Minute, connect.NewCircuit(nodeList))
+	if err != nil {
+		t.Fatalf("Failed to add round: %+v", err)
+	}
+	for _, s := range []states.Round{states.PRECOMPUTING, states.STANDBY,
+		states.QUEUED, states.REALTIME} {
+		if err = r.Update(s, time.Now()); err != nil {
+			t.Fatalf("Failed to move round to %s: %+v", s, err)
+		}
+	}
+	for _, nid := range nodeList {
+		_ = testState.GetNodeMap().GetNode(nid).SetRound(r)
+	}
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+	}
+	handle := func(nid *id.ID, sequence uint64) {
+		testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+		err := sc.HandleNodeUpdates(node.UpdateNotification{
+			Node:         nid,
+			FromActivity: current.REALTIME,
+			ToActivity:   current.COMPLETED,
+			Sequence:     sequence,
+		})
+		if err != nil {
+			t.Errorf("Failed to handle update %d of node %s: %+v",
+				sequence, nid, err)
+		}
+	}
+
+	// The first node reports COMPLETED twice
+	handle(nodeList[0], 1)
+	handle(nodeList[0], 1)
+	if r.GetRoundState() != states.REALTIME {
+		t.Errorf("Round advanced before every node completed."+
+			"\n\texpected: %s\n\treceived: %s", states.REALTIME,
+			r.GetRoundState())
+	}
+
+	handle(nodeList[1], 1)
+	if r.GetRoundState() != states.COMPLETED {
+		t.Errorf("Round did not complete once every node completed."+
+			"\n\texpected: %s\n\treceived: %s", states.COMPLETED,
+			r.GetRoundState())
+	}
+}
@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles recording node state transitions to storage off of the scheduling
+// thread
+
+package scheduling
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"time"
+)
+
+const (
+	// number of transitions that can wait to be written; when full, new
+	// transitions are dropped rather than blocking the scheduler
+	nodeTransitionLogLen = 10000
+
+	// maximum number of transitions written in one batch
+	nodeTransitionBatchSize = 100
+
+	// how often a partial batch of transitions is written
+	nodeTransitionFlushInterval = 5 * time.Second
+)
+
+// insertNodeStateTransition inserts the transition into the permissioning
+// database.
+func insertNodeStateTransition(transition *storage.NodeStateTransition) error {
+	return storage.PermissioningDb.InsertNodeStateTransition(transition)
+}
+
+// nodeTransitionLog batches node state transitions recorded by the scheduler
+// and writes them to storage in its own goroutine, so that slow writes never
+// hold up scheduling.
+type nodeTransitionLog struct {
+	transitions chan *storage.NodeStateTransition
+
+	insert        func(transition *storage.NodeStateTransition) error
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// newNodeTransitionLog creates an empty log which writes transitions with the
+// given function.
+func newNodeTransitionLog(insert func(
+	transition *storage.NodeStateTransition) error) *nodeTransitionLog {
+	return &nodeTransitionLog{
+		transitions:   make(chan *storage.NodeStateTransition, nodeTransitionLogLen),
+		insert:        insert,
+		batchSize:     nodeTransitionBatchSize,
+		flushInterval: nodeTransitionFlushInterval,
+	}
+}
+
+// record queues the transition to be written without blocking. A nil log
+// records nothing.
+func (l *nodeTransitionLog) record(transition *storage.NodeStateTransition) {
+	if l == nil {
+		return
+	}
+
+	select {
+	case l.transitions <- transition:
+	default:
+		jww.WARN.Printf("Node transition log is full, dropping transition "+
+			"of node %v", transition.NodeId)
+	}
+}
+
+// run writes queued transitions in batches until the quit channel is closed
+// or signaled, at which point the remaining transitions are written.
+func (l *nodeTransitionLog) run(quit chan struct{}) {
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*storage.NodeStateTransition, 0, l.batchSize)
+	for {
+		select {
+		case <-quit:
+			for {
+				select {
+				case transition := <-l.transitions:
+					batch = append(batch, transition)
+				default:
+					l.flush(batch)
+					return
+				}
+			}
+		case transition := <-l.transitions:
+			batch = append(batch, transition)
+			if len(batch) >= l.batchSize {
+				batch = l.flush(batch)
+			}
+		case <-ticker.C:
+			batch = l.flush(batch)
+		}
+	}
+}
+
+// flush writes the batch to storage and returns it emptied. Transitions that
+// fail to be written are dropped, as the log is only used for debugging.
+func (l *nodeTransitionLog) flush(
+	batch []*storage.NodeStateTransition) []*storage.NodeStateTransition {
+	failed := 0
+	for _, transition := range batch {
+		if err := l.insert(transition); err != nil {
+			failed++
+			jww.DEBUG.Printf("Failed to insert node transition: %+v", err)
+		}
+	}
+	if failed > 0 {
+		jww.ERROR.Printf("Failed to insert %d of %d node transitions",
+			failed, len(batch))
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,209 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/elixxir/registration/storage/round"
+	"gitlab.com/xx_network/comms/connect"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transitionRecorder records the transitions it is asked to insert, failing
+// the first failures inserts.
+type transitionRecorder struct {
+	failures int
+	inserted []*storage.NodeStateTransition
+	mux      sync.Mutex
+}
+
+func (r *transitionRecorder) insert(
+	transition *storage.NodeStateTransition) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("database unavailable")
+	}
+	r.inserted = append(r.inserted, transition)
+	return nil
+}
+
+func (r *transitionRecorder) len() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.inserted)
+}
+
+// Tests that nodeTransitionLog.run() writes a full batch as soon as it is
+// collected and the remaining transitions when it is stopped.
+func TestNodeTransitionLog_run(t *testing.T) {
+	recorder := &transitionRecorder{}
+	l := newNodeTransitionLog(recorder.insert)
+	l.batchSize = 3
+	l.flushInterval = time.Hour
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		l.run(quit)
+		close(done)
+	}()
+
+	for i := 0; i < 4; i++ {
+		l.record(&storage.NodeStateTransition{ToActivity: uint32(i)})
+	}
+
+	for i := 0; recorder.len() != 3; i++ {
+		if i > 100 {
+			t.Fatalf("Full batch not written: %d transitions inserted",
+				recorder.len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The partial batch is written once the log is stopped
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("run() did not return after quit.")
+	}
+	if recorder.len() != 4 {
+		t.Errorf("Remaining transitions not written on quit."+
+			"\n\texpected: %d\n\treceived: %d", 4, recorder.len())
+	}
+	for i, transition := range recorder.inserted {
+		if transition.ToActivity != uint32(i) {
+			t.Errorf("Transition %d written out of order: %+v", i, transition)
+		}
+	}
+}
+
+// Tests that nodeTransitionLog.run() writes a partial batch on the flush
+// interval and keeps going after failed inserts.
+func TestNodeTransitionLog_run_FlushInterval(t *testing.T) {
+	recorder := &transitionRecorder{failures: 1}
+	l := newNodeTransitionLog(recorder.insert)
+	l.flushInterval = 10 * time.Millisecond
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go l.run(quit)
+
+	l.record(&storage.NodeStateTransition{ToActivity: 1})
+	l.record(&storage.NodeStateTransition{ToActivity: 2})
+
+	for i := 0; recorder.len() != 1; i++ {
+		if i > 100 {
+			t.Fatalf("Partial batch not written: %d transitions inserted",
+				recorder.len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Tests that nodeTransitionLog.record() drops transitions instead of blocking
+// when the log is full, and does nothing on a nil log.
+func TestNodeTransitionLog_record_Full(t *testing.T) {
+	l := &nodeTransitionLog{
+		transitions: make(chan *storage.NodeStateTransition, 1),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.record(&storage.NodeStateTransition{})
+		l.record(&storage.NodeStateTransition{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("record() blocked on a full log.")
+	}
+	if len(l.transitions) != 1 {
+		t.Errorf("Unexpected number of queued transitions: %d",
+			len(l.transitions))
+	}
+
+	var nilLog *nodeTransitionLog
+	nilLog.record(&storage.NodeStateTransition{})
+}
+
+// Tests that HandleNodeUpdates() records the transition of the node along with
+// the round it is in.
+func TestHandleNodeUpdates_RecordsTransition(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	nid := id.NewIdFromUInt(0, id.Node, t)
+	err = testState.GetNodeMap().AddNode(nid, "0", "", "", 0)
+	if err != nil {
+		t.Fatalf("Couldn't add node: %v", err)
+	}
+
+	sc := &stateChanger{
+		lastRealtime:     time.Unix(0, 0),
+		realtimeTimeout:  15 * time.Second,
+		pool:             NewWaitingPool(),
+		state:            testState,
+		roundTracker:     NewRoundTracker(),
+		roundTimeoutChan: make(chan id.Round, 1),
+		transitionLog:    newNodeTransitionLog(nil),
+	}
+
+	r := round.NewState_Testing(42, states.PRECOMPUTING,
+		connect.NewCircuit([]*id.ID{nid}), t)
+	ns := testState.GetNodeMap().GetNode(nid)
+	if err = ns.SetRound(r); err != nil {
+		t.Fatalf("Unable to set round for mock node: %v", err)
+	}
+
+	ns.GetPollingLock().Lock()
+	err = sc.HandleNodeUpdates(node.UpdateNotification{
+		Node:         nid,
+		FromActivity: current.WAITING,
+		ToActivity:   current.PRECOMPUTING,
+	})
+	if err != nil {
+		t.Errorf("Happy path received error: %v", err)
+	}
+
+	select {
+	case transition := <-sc.transitionLog.transitions:
+		if !bytes.Equal(transition.NodeId, nid.Marshal()) ||
+			transition.FromActivity != uint32(current.WAITING) ||
+			transition.ToActivity != uint32(current.PRECOMPUTING) ||
+			transition.RoundId == nil || *transition.RoundId != 42 {
+			t.Errorf("Unexpected transition recorded: %+v", transition)
+		}
+	default:
+		t.Errorf("No transition recorded.")
+	}
+}
@@ -10,9 +10,11 @@ package scheduling
 // Contains the scheduling params object and the internal protoRound object
 
 import (
+	"github.com/pkg/errors"
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/id"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -25,8 +27,14 @@ type SafeParams struct {
 
 	// Hold a reference to the actual Params
 	*Params
+
+	// Signals the Scheduler that the Params have been updated
+	updated chan struct{}
 }
 
+// maxBatchSize is the largest batch size accepted by Validate.
+const maxBatchSize = 1 << 16
+
 // Allows for safe duplication of the current internal Params object
 func (s *SafeParams) SafeCopy() Params {
 	s.RLock()
@@ -34,12 +42,189 @@ func (s *SafeParams) SafeCopy() Params {
 	return *s.Params
 }
 
+// Update replaces the Params with newParams if they are valid and notifies the
+// running Scheduler, which applies them to rounds created after the update.
+// Rounds already created keep the Params they were created with. Returns an
+// error and keeps the current Params if newParams are invalid. The Scheduler is
+// not notified if newParams match the current Params.
+func (s *SafeParams) Update(newParams Params) error {
+	err := newParams.Validate()
+	if err != nil {
+		return errors.WithMessage(err, "Rejected scheduling params update")
+	}
+
+	s.Lock()
+	if reflect.DeepEqual(*s.Params, newParams) {
+		s.Unlock()
+		return nil
+	}
+	*s.Params = newParams
+	updated := s.getUpdatedChan()
+	s.Unlock()
+
+	// Only one pending notification is needed as the Scheduler reads the
+	// latest Params when notified
+	select {
+	case updated <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// updatedChan returns the channel that is signaled when the Params are updated.
+func (s *SafeParams) updatedChan() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.getUpdatedChan()
+}
+
+// getUpdatedChan returns the updated channel, creating it if it does not
+// exist. Must be called with the lock held.
+func (s *SafeParams) getUpdatedChan() chan struct{} {
+	if s.updated == nil {
+		s.updated = make(chan struct{}, 1)
+	}
+	return s.updated
+}
+
+// Validate returns an error if the Params cannot be used to schedule rounds.
+func (p Params) Validate() error {
+	if p.TeamSize == 0 {
+		return errors.New("TeamSize must be greater than 0")
+	}
+	if p.MinTeamSize > p.TeamSize {
+		return errors.Errorf("MinTeamSize %d must not be greater than "+
+			"TeamSize %d", p.MinTeamSize, p.TeamSize)
+	}
+	if p.PoolMinimumSize != 0 && p.PoolMinimumSize < p.TeamSize {
+		return errors.Errorf("PoolMinimumSize %d must not be less than "+
+			"TeamSize %d", p.PoolMinimumSize, p.TeamSize)
+	}
+	if p.BatchSize == 0 || p.BatchSize > maxBatchSize {
+		return errors.Errorf("BatchSize %d must be between 1 and %d",
+			p.BatchSize, maxBatchSize)
+	}
+	for teamSize, batchSize := range p.TeamBatchSizes {
+		if batchSize == 0 || batchSize > maxBatchSize {
+			return errors.Errorf("Batch size %d for team size %d must be "+
+				"between 1 and %d", batchSize, teamSize, maxBatchSize)
+		}
+	}
+	if p.PrecomputationTimeout <= 0 || p.RealtimeTimeout <= 0 ||
+		p.ResourceQueueTimeout <= 0 {
+		return errors.New("Round timeouts must be greater than 0")
+	}
+	if p.MinimumDelay < 0 || p.RealtimeDelay < 0 ||
+		p.RealtimeDelayPerNode < 0 {
+		return errors.New("Round delays must not be negative")
+	}
+	if p.NodeErrorCooldown < 0 {
+		return errors.New("NodeErrorCooldown must not be negative")
+	}
+	if p.RoundlessErrorCooldown < 0 {
+		return errors.New("RoundlessErrorCooldown must not be negative")
+	}
+	if !validRoundSummaryFormat(p.RoundSummaryFormat) {
+		return errors.Errorf("RoundSummaryFormat %q must be empty, %q, or %q",
+			p.RoundSummaryFormat, RoundSummaryText, RoundSummaryJSON)
+	}
+	if p.ReputationWindow < 0 {
+		return errors.New("ReputationWindow must not be negative")
+	}
+	if p.Threshold < 0 || p.Threshold > 1 {
+		return errors.Errorf("Threshold %f must be between 0 and 1",
+			p.Threshold)
+	}
+	return p.validateAffinityGroups()
+}
+
+// validateAffinityGroups returns an error if an affinity group cannot fit in a
+// team, a node is listed in more than one group, or groups are used with
+// OneNodePerShard.
+func (p Params) validateAffinityGroups() error {
+	if p.OneNodePerShard && len(p.AffinityGroups) > 0 {
+		return errors.New("AffinityGroups cannot be used with OneNodePerShard")
+	}
+
+	grouped := make(map[id.ID]struct{})
+	for i, group := range p.AffinityGroups {
+		if len(group) > int(p.TeamSize) {
+			return errors.Errorf("Affinity group %d has %d nodes, which is "+
+				"more than TeamSize %d", i, len(group), p.TeamSize)
+		}
+		for _, nid := range group {
+			if nid == nil {
+				return errors.Errorf("Affinity group %d has a nil node ID", i)
+			} else if _, exists := grouped[*nid]; exists {
+				return errors.Errorf("Node %s is listed in more than one "+
+					"affinity group", nid)
+			}
+			grouped[*nid] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// fullPoolSize returns the number of nodes the pool must hold before a full
+// team is formed, which is TeamSize unless PoolMinimumSize is larger.
+func (p Params) fullPoolSize() int {
+	if p.PoolMinimumSize > p.TeamSize {
+		return int(p.PoolMinimumSize)
+	}
+	return int(p.TeamSize)
+}
+
+// batchSizeFor returns the batch size of a round with a team of teamSize nodes,
+// which is BatchSize unless TeamBatchSizes has an entry for the team size.
+func (p Params) batchSizeFor(teamSize uint32) uint32 {
+	if batchSize, exists := p.TeamBatchSizes[teamSize]; exists {
+		return batchSize
+	}
+	return p.BatchSize
+}
+
+// DeepCopy returns a copy of the Params that shares no maps or slices with
+// the original, so that changes to the copy do not affect the original.
+func (p Params) DeepCopy() Params {
+	if p.TeamBatchSizes != nil {
+		teamBatchSizes := make(map[uint32]uint32, len(p.TeamBatchSizes))
+		for teamSize, batchSize := range p.TeamBatchSizes {
+			teamBatchSizes[teamSize] = batchSize
+		}
+		p.TeamBatchSizes = teamBatchSizes
+	}
+
+	if p.AffinityGroups != nil {
+		affinityGroups := make([][]*id.ID, len(p.AffinityGroups))
+		for i, group := range p.AffinityGroups {
+			affinityGroups[i] = make([]*id.ID, len(group))
+			for j, nid := range group {
+				affinityGroups[i][j] = nid.DeepCopy()
+			}
+		}
+		p.AffinityGroups = affinityGroups
+	}
+
+	return p
+}
+
 // JSONable structure which defines the parameters of the Scheduler
 type Params struct {
 	// number of nodes in a team
 	TeamSize uint32
+	// smallest number of nodes a team may be formed with when the pool does
+	// not reach TeamSize within MinTeamSizeTimeout; 0 disables smaller teams
+	MinTeamSize uint32
+	// number of nodes the pool must hold before a team is formed, as a buffer
+	// above TeamSize so that teams are picked from more nodes than needed; 0
+	// forms teams as soon as the pool reaches TeamSize
+	PoolMinimumSize uint32
 	// number of slots in a batch
 	BatchSize uint32
+	// number of slots in a batch of rounds with a team of the given size,
+	// used instead of BatchSize for team sizes that are listed
+	TeamBatchSizes map[uint32]uint32
 
 	// NOTE: All times in MS
 	// Resource queue timeout on nodes
@@ -48,18 +233,66 @@ type Params struct {
 	MinimumDelay time.Duration
 	// Delay for a realtime round to start
 	RealtimeDelay time.Duration
+	// Delay added to RealtimeDelay for each node in the team, so that larger
+	// teams have more lead time before realtime; 0 keeps the delay static
+	RealtimeDelayPerNode time.Duration
 	// Time between cleaning up offline nodes
 	NodeCleanUpInterval time.Duration
 	// Time until round precomputation times out
 	PrecomputationTimeout time.Duration
 	// Time until round realtime times out
 	RealtimeTimeout time.Duration
+	// Time the pool waits to reach TeamSize before a team of at least
+	// MinTeamSize nodes is formed
+	MinTeamSizeTimeout time.Duration
+	// Time a node that reported an error failing a round is held out of team
+	// selection; 0 disables the cooldown
+	NodeErrorCooldown time.Duration
+	// Number of errors a node may report while not in a round, since it last
+	// completed a round, before it is flagged as likely misconfigured; 0
+	// disables flagging
+	RoundlessErrorLimit uint32
+	// Time a node flagged for errors reported while not in a round is held out
+	// of team selection; 0 only logs the flag
+	RoundlessErrorCooldown time.Duration
+	// Time before now in which the rounds a node took part in are used to
+	// compute its reputation, which weights the nodes picked at random for a
+	// team towards nodes that fail fewer rounds; 0 disables the weighting
+	ReputationWindow time.Duration
+	// Maximum number of rounds in progress at once; new rounds are not formed
+	// while it is reached. 0 leaves the number of rounds unlimited
+	MaxActiveRounds uint32
+	// Groups of nodes that are always scheduled in the same team; a team with
+	// any member of a group is only formed once every member is available
+	AffinityGroups [][]*id.ID
 	//Debug flag used to cause regular prints about the state of the network
 	DebugTrackRounds bool
+	// Format of the summary logged at info level for each completed round,
+	// RoundSummaryText or RoundSummaryJSON; empty disables the summary
+	RoundSummaryFormat string
 
 	//SECURE ONLY
 	// Minimum percentage of nodes in the waiting pool before secure teaming wil create a team
 	Threshold float64
+
+	// When set, teams are picked so that no more than GeoSpreadMaxFraction of
+	// the team is from a single geographic bin, if the pool allows it
+	GeoSpread            bool
+	GeoSpreadMaxFraction float64
+
+	// When set, the team is ordered lexically by each node's sequence string
+	// instead of by latency so that the topology is deterministic; used for
+	// debugging and reproducible test networks
+	SequenceOrdering bool
+
+	// When set, teams are picked so that no two nodes share the shard of their
+	// structured sequences ("region/shard/index"); nodes without a shard are
+	// not constrained. Cannot be used with AffinityGroups
+	OneNodePerShard bool
+
+	// Path to the file round metrics waiting to be retried are stored in so
+	// that they survive a restart; if empty, they are kept in memory only
+	RoundMetricQueuePath string
 }
 
 //internal structure which describes a round to be created
@@ -69,4 +302,11 @@ type protoRound struct {
 	NodeStateList        []*node.State
 	BatchSize            uint32
 	ResourceQueueTimeout time.Duration
+
+	// Timings of the Params the round was created with
+	PrecomputationTimeout time.Duration
+	MinimumDelay          time.Duration
+	RealtimeDelay         time.Duration
+	RealtimeDelayPerNode  time.Duration
+	RealtimeTimeout       time.Duration
 }
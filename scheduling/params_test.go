@@ -0,0 +1,180 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"encoding/json"
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+)
+
+// newTestParams returns valid scheduling params.
+func newTestParams() Params {
+	return Params{
+		TeamSize:              3,
+		BatchSize:             32,
+		ResourceQueueTimeout:  180000,
+		MinimumDelay:          60,
+		RealtimeDelay:         3000,
+		PrecomputationTimeout: 30000,
+		RealtimeTimeout:       15000,
+		Threshold:             0.3,
+	}
+}
+
+// Tests that Validate() accepts valid params and rejects each invalid field.
+func TestParams_Validate(t *testing.T) {
+	if err := newTestParams().Validate(); err != nil {
+		t.Errorf("Validate() rejected valid params: %+v", err)
+	}
+
+	invalid := map[string]func(p *Params){
+		"TeamSize":          func(p *Params) { p.TeamSize = 0 },
+		"MinTeamSize":       func(p *Params) { p.MinTeamSize = 4 },
+		"PoolMinimumSize":   func(p *Params) { p.PoolMinimumSize = 2 },
+		"ZeroBatchSize":     func(p *Params) { p.BatchSize = 0 },
+		"LargeBatchSize":    func(p *Params) { p.BatchSize = maxBatchSize + 1 },
+		"PrecompTimeout":    func(p *Params) { p.PrecomputationTimeout = 0 },
+		"RealtimeTimeout":   func(p *Params) { p.RealtimeTimeout = 0 },
+		"ResourceTimeout":   func(p *Params) { p.ResourceQueueTimeout = 0 },
+		"MinimumDelay":      func(p *Params) { p.MinimumDelay = -1 },
+		"RealtimeDelay":     func(p *Params) { p.RealtimeDelay = -1 },
+		"DelayPerNode":      func(p *Params) { p.RealtimeDelayPerNode = -1 },
+		"ReputationWindow":  func(p *Params) { p.ReputationWindow = -1 },
+		"RoundSummary":      func(p *Params) { p.RoundSummaryFormat = "xml" },
+		"NegativeThreshold": func(p *Params) { p.Threshold = -0.1 },
+		"LargeThreshold":    func(p *Params) { p.Threshold = 1.1 },
+		"ZeroTeamBatchSize": func(p *Params) {
+			p.TeamBatchSizes = map[uint32]uint32{2: 0}
+		},
+		"LargeTeamBatchSize": func(p *Params) {
+			p.TeamBatchSizes = map[uint32]uint32{2: maxBatchSize + 1}
+		},
+		"LargeAffinityGroup": func(p *Params) {
+			p.AffinityGroups = [][]*id.ID{newTestIds(4, t)}
+		},
+		"OverlappingAffinityGroups": func(p *Params) {
+			ids := newTestIds(3, t)
+			p.AffinityGroups = [][]*id.ID{ids[:2], ids[1:]}
+		},
+		"AffinityGroupsOnePerShard": func(p *Params) {
+			p.AffinityGroups = [][]*id.ID{newTestIds(2, t)}
+			p.OneNodePerShard = true
+		},
+	}
+	for name, modify := range invalid {
+		p := newTestParams()
+		modify(&p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate() accepted invalid %s.", name)
+		}
+	}
+}
+
+// Tests that ParseParams() rejects an affinity group larger than TeamSize.
+func TestParseParams_LargeAffinityGroup(t *testing.T) {
+	p := newTestParams()
+	p.AffinityGroups = [][]*id.ID{newTestIds(int(p.TeamSize)+1, t)}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Failed to marshal params: %+v", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("ParseParams() did not reject an affinity group " +
+				"larger than TeamSize.")
+		}
+	}()
+	ParseParams(data)
+}
+
+// newTestIds returns n distinct node IDs.
+func newTestIds(n int, t *testing.T) []*id.ID {
+	ids := make([]*id.ID, n)
+	for i := range ids {
+		ids[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+	}
+	return ids
+}
+
+// Tests that SafeParams.Update() stores valid params and notifies the
+// Scheduler, and that invalid params are rejected without a notification.
+func TestSafeParams_Update(t *testing.T) {
+	initial := newTestParams()
+	params := &SafeParams{Params: &initial}
+	updated := params.updatedChan()
+
+	newParams := newTestParams()
+	newParams.BatchSize = 64
+	newParams.RealtimeDelay = 5000
+	if err := params.Update(newParams); err != nil {
+		t.Fatalf("Update() returned an error: %+v", err)
+	}
+	if !reflect.DeepEqual(params.SafeCopy(), newParams) {
+		t.Errorf("Update() did not store the params."+
+			"\n\texpected: %+v\n\treceived: %+v", newParams, params.SafeCopy())
+	}
+	select {
+	case <-updated:
+	default:
+		t.Errorf("Update() did not notify of the update.")
+	}
+
+	badParams := newTestParams()
+	badParams.TeamSize = 0
+	if err := params.Update(badParams); err == nil {
+		t.Errorf("Update() accepted invalid params.")
+	}
+	if !reflect.DeepEqual(params.SafeCopy(), newParams) {
+		t.Errorf("Update() modified the params with invalid params."+
+			"\n\texpected: %+v\n\treceived: %+v", newParams, params.SafeCopy())
+	}
+	select {
+	case <-updated:
+		t.Errorf("Update() notified of an invalid update.")
+	default:
+	}
+
+	if err := params.Update(newParams); err != nil {
+		t.Fatalf("Update() returned an error: %+v", err)
+	}
+	select {
+	case <-updated:
+		t.Errorf("Update() notified of unchanged params.")
+	default:
+	}
+}
+
+// Tests that changes to the maps and slices of a copy made by
+// Params.DeepCopy() do not affect the original.
+func TestParams_DeepCopy(t *testing.T) {
+	original := newTestParams()
+	original.TeamBatchSizes = map[uint32]uint32{2: 16}
+	original.AffinityGroups = [][]*id.ID{
+		{id.NewIdFromString("a", id.Node, t), id.NewIdFromString("b", id.Node, t)}}
+	expected := newTestParams()
+	expected.TeamBatchSizes = map[uint32]uint32{2: 16}
+	expected.AffinityGroups = [][]*id.ID{
+		{id.NewIdFromString("a", id.Node, t), id.NewIdFromString("b", id.Node, t)}}
+
+	paramsCopy := original.DeepCopy()
+	if !reflect.DeepEqual(paramsCopy, original) {
+		t.Errorf("Copy does not match the original."+
+			"\n\texpected: %+v\n\treceived: %+v", original, paramsCopy)
+	}
+
+	paramsCopy.TeamBatchSizes[2] = 8
+	paramsCopy.AffinityGroups[0][0] = id.NewIdFromString("c", id.Node, t)
+	paramsCopy.AffinityGroups[0][1][0] = 0xFF
+	if !reflect.DeepEqual(original, expected) {
+		t.Errorf("Changing the copy changed the original."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, original)
+	}
+}
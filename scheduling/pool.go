@@ -8,14 +8,28 @@
 package scheduling
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
 	"github.com/golang-collections/collections/set"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/crypto/shuffle"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"math"
+	"sort"
 	"sync"
+	"time"
 )
 
+// waitingPoolVersion is the current version of the serialized waiting pool.
+// It must be incremented when the serialized format changes.
+const waitingPoolVersion = 0
+
 // pool.go contains logic for the secure teaming algorithm's
 //   waiting pool.
 
@@ -29,6 +43,18 @@ type waitingPool struct {
 	pool    *set.Set
 	offline *set.Set
 
+	// Groups of nodes that must be picked together and the index of the
+	// group of each node in one
+	affinityGroups [][]*id.ID
+	affinity       map[id.ID]int
+
+	// When set, no two nodes with the same shard are picked for a team
+	onePerShard bool
+
+	// Reputation of each node, used to weight the nodes picked at random;
+	// nil when nodes are picked uniformly
+	reputations map[id.ID]float64
+
 	mux sync.RWMutex
 }
 
@@ -47,6 +73,77 @@ func (wp *waitingPool) Len() int {
 	return wp.pool.Len()
 }
 
+// AvailableLen returns the number of nodes in the online pool that can be
+// picked for a single team, which excludes nodes in a scheduling cooldown and
+// nodes waiting on the rest of their affinity group. If onePerShard is set,
+// each shard is counted as one node.
+func (wp *waitingPool) AvailableLen() int {
+	wp.mux.RLock()
+	defer wp.mux.RUnlock()
+	return countNodes(wp.teamUnits(wp.available(time.Now())))
+}
+
+// CanPick returns true if a team of exactly n nodes can be picked from the
+// online pool without splitting an affinity group
+func (wp *waitingPool) CanPick(n int) bool {
+	wp.mux.RLock()
+	defer wp.mux.RUnlock()
+	units := wp.teamUnits(wp.available(time.Now()))
+	return canFill(units, make([]bool, len(units)), -1, n)
+}
+
+// SetAffinityGroups sets the groups of nodes that are always picked for the
+// same team. A node may only be in one group.
+func (wp *waitingPool) SetAffinityGroups(groups [][]*id.ID) {
+	affinity := make(map[id.ID]int)
+	for i, group := range groups {
+		for _, nid := range group {
+			affinity[*nid] = i
+		}
+	}
+
+	wp.mux.Lock()
+	wp.affinityGroups = groups
+	wp.affinity = affinity
+	wp.mux.Unlock()
+}
+
+// SetOnePerShard sets whether teams are picked with no two nodes from the same
+// shard of their structured sequences. Must not be set with affinity groups.
+func (wp *waitingPool) SetOnePerShard(onePerShard bool) {
+	wp.mux.Lock()
+	wp.onePerShard = onePerShard
+	wp.mux.Unlock()
+}
+
+// SetReputations sets the reputation of each node, above 0 and at most 1,
+// which weights the nodes picked at random towards nodes with a higher
+// reputation. Nodes without a reputation are given defaultReputation. If
+// reputations is nil, nodes are picked uniformly at random.
+func (wp *waitingPool) SetReputations(reputations map[id.ID]float64) {
+	wp.mux.Lock()
+	wp.reputations = reputations
+	wp.mux.Unlock()
+}
+
+// NextCooldownEnd returns the earliest time a node in the online pool leaves
+// its scheduling cooldown, or zero if no node in the pool is cooling down
+func (wp *waitingPool) NextCooldownEnd() time.Time {
+	wp.mux.RLock()
+	defer wp.mux.RUnlock()
+
+	now := time.Now()
+	var next time.Time
+	wp.pool.Do(func(face interface{}) {
+		cooldownUntil := face.(*node.State).GetCooldownUntil()
+		if cooldownUntil.After(now) &&
+			(next.IsZero() || cooldownUntil.Before(next)) {
+			next = cooldownUntil
+		}
+	})
+	return next
+}
+
 // OfflineLen returns the length of the offline pool
 func (wp *waitingPool) OfflineLen() int {
 	wp.mux.RLock()
@@ -54,15 +151,23 @@ func (wp *waitingPool) OfflineLen() int {
 	return wp.offline.Len()
 }
 
-// Add inserts a node into the online pool
+// Add inserts a node into the online pool, recording when it started waiting
 func (wp *waitingPool) Add(n *node.State) {
 	wp.mux.Lock()
+	if !wp.pool.Has(n) {
+		n.SetWaitingSince(time.Now())
+	}
 	wp.pool.Insert(n)
 	wp.mux.Unlock()
 }
 
 // Removes the node from the pool banning it
 func (wp *waitingPool) Ban(n *node.State) {
+	wp.Remove(n)
+}
+
+// Removes the node from both the online and offline pools
+func (wp *waitingPool) Remove(n *node.State) {
 	wp.mux.Lock()
 	wp.pool.Remove(n)
 	wp.offline.Remove(n)
@@ -76,56 +181,417 @@ func (wp *waitingPool) SetNodeToOnline(ns *node.State) {
 	wp.mux.Lock()
 	defer wp.mux.Unlock()
 
+	// Nodes returning from the offline pool keep the time they started waiting
+	if !wp.pool.Has(ns) && !wp.offline.Has(ns) {
+		ns.SetWaitingSince(time.Now())
+	}
 	wp.offline.Remove(ns)
 	wp.pool.Insert(ns)
 }
 
-// PickNRandAtThreshold collects n nodes at random from the pool and returns
-//   those nodes.
+// PickNRandAtThreshold collects n nodes from the pool and returns those
+//   nodes. The half of the team that have waited longest in the pool are
+//   always picked so that no node is starved; the rest are picked at random,
+//   weighted by reputation if reputations are set. Nodes in a scheduling
+//   cooldown are not picked. The members of an affinity group are picked
+//   together once all of them are available. If onePerShard is set, no two
+//   nodes from the same shard are picked.
 // If there are not enough nodes, either from the threshold or
 //   the requested nodes, this function errors
 func (wp *waitingPool) PickNRandAtThreshold(thresh, n int) ([]*node.State, error) {
 	wp.mux.Lock()
 	defer wp.mux.Unlock()
 
-	newPool := wp.pool
+	available := wp.available(time.Now())
+	numAvailable := countNodes(wp.affinityUnits(available))
 
 	// Check that the pool meets the threshold requirement
-	if newPool.Len() < thresh {
-		return nil, errors.Errorf("Number of stored nodes (%v) does not reach threshold", newPool.Len())
+	if numAvailable < thresh {
+		return nil, errors.Errorf("Number of stored nodes (%v) does not reach threshold", numAvailable)
 	}
 
 	// Check that the pool has enough nodes to satisfy n
-	if newPool.Len() < n {
+	if numAvailable < n {
 		return nil, errors.Errorf("Number of stored nodes (%v) not enough"+
-			" to pick %v nodes", newPool.Len(), n)
+			" to pick %v nodes", numAvailable, n)
 	}
 
-	// Create an incrementing list of numbers up to pool's length
-	numList := make([]uint32, newPool.Len())
-	for i := 0; i < newPool.Len(); i++ {
-		numList[i] = uint32(i)
+	// Collect the longest waiting nodes and then nodes at random
+	units := wp.teamUnits(fairCandidates(available, n, wp.reputations))
+	nodeList := pickUnits(units, make([]bool, len(units)),
+		make([]*node.State, 0, n), n, nil)
+	if len(nodeList) < n {
+		return nil, errors.Errorf("Stored nodes (%v) cannot fill a team of "+
+			"%v nodes without splitting an affinity group", numAvailable, n)
 	}
 
-	// Shuffle these numbers
-	shuffle.Shuffle32(&numList)
+	// Remove collected nodes from pool
+	for _, ns := range nodeList {
+		wp.pool.Remove(ns)
+	}
 
-	var nodeList []*node.State
-	iterator := 0
+	// Return collected ndoes
+	return nodeList, nil
+}
+
+// PickNRandAtThresholdWithSpread collects n nodes from the pool such that no
+//   more than maxPerBin nodes are from the same geographic bin, and returns
+//   those nodes. As in PickNRandAtThreshold, the longest waiting nodes are
+//   favored and the rest are picked at random, weighted by reputation if
+//   reputations are set.
+// If the pool is not diverse enough to satisfy the constraint, the remaining
+//   slots are filled at random from the nodes that were passed over so that a
+//   team is still formed. Nodes in a scheduling cooldown are not picked. The
+//   members of an affinity group are picked together once all of them are
+//   available. As in PickNRandAtThreshold, if onePerShard is set, no two
+//   nodes from the same shard are picked.
+// If there are not enough nodes, either from the threshold or
+//   the requested nodes, this function errors
+func (wp *waitingPool) PickNRandAtThresholdWithSpread(thresh, n,
+	maxPerBin int) ([]*node.State, error) {
+	wp.mux.Lock()
+	defer wp.mux.Unlock()
+
+	available := wp.available(time.Now())
+	numAvailable := countNodes(wp.affinityUnits(available))
+
+	// Check that the pool meets the threshold requirement
+	if numAvailable < thresh {
+		return nil, errors.Errorf("Number of stored nodes (%v) does not reach threshold", numAvailable)
+	}
 
-	// Collect nodes from pool at random
-	newPool.Do(func(face interface{}) {
-		if numList[iterator] < uint32(n) {
-			nodeList = append(nodeList, face.(*node.State))
+	// Check that the pool has enough nodes to satisfy n
+	if numAvailable < n {
+		return nil, errors.Errorf("Number of stored nodes (%v) not enough"+
+			" to pick %v nodes", numAvailable, n)
+	}
+
+	// Collect nodes while their bin is below the limit
+	binCounts := make(map[region.GeoBin]int)
+	withinLimit := func(unit []*node.State) bool {
+		unitCounts := make(map[region.GeoBin]int, len(unit))
+		for _, ns := range unit {
+			unitCounts[ns.GetGeoBin()]++
 		}
-		iterator++
-	})
+		for bin, count := range unitCounts {
+			if binCounts[bin]+count > maxPerBin {
+				return false
+			}
+		}
+		for bin, count := range unitCounts {
+			binCounts[bin] += count
+		}
+		return true
+	}
+	units := wp.teamUnits(fairCandidates(available, n, wp.reputations))
+	picked := make([]bool, len(units))
+	nodeList := pickUnits(units, picked, make([]*node.State, 0, n), n,
+		withinLimit)
+
+	// Relax the constraint if the pool is not diverse enough
+	if len(nodeList) < n {
+		jww.DEBUG.Printf("Waiting pool not diverse enough to limit bins to "+
+			"%d nodes, filling %d slots regardless of bin", maxPerBin,
+			n-len(nodeList))
+		nodeList = pickUnits(units, picked, nodeList, n, nil)
+	}
+	if len(nodeList) < n {
+		return nil, errors.Errorf("Stored nodes (%v) cannot fill a team of "+
+			"%v nodes without splitting an affinity group", numAvailable, n)
+	}
 
 	// Remove collected nodes from pool
 	for _, ns := range nodeList {
 		wp.pool.Remove(ns)
 	}
 
-	// Return collected ndoes
 	return nodeList, nil
 }
+
+// available returns the nodes in the online pool that are not in a scheduling
+// cooldown at the given time. Must be called with the lock held.
+func (wp *waitingPool) available(now time.Time) []*node.State {
+	nodes := make([]*node.State, 0, wp.pool.Len())
+	wp.pool.Do(func(face interface{}) {
+		ns := face.(*node.State)
+		if !ns.GetCooldownUntil().After(now) {
+			nodes = append(nodes, ns)
+		}
+	})
+	return nodes
+}
+
+// affinityUnits splits the nodes into the units they are picked in: the
+// members of each affinity group together, placed where the first of them
+// appears, and every other node on its own. Members of a group that is not
+// entirely among the nodes are left out so that they wait for the rest of
+// their group. Must be called with the lock held.
+func (wp *waitingPool) affinityUnits(nodes []*node.State) [][]*node.State {
+	units := make([][]*node.State, 0, len(nodes))
+	groupUnits := make(map[int]int)
+	for _, ns := range nodes {
+		group, exists := wp.affinity[*ns.GetID()]
+		if !exists {
+			units = append(units, []*node.State{ns})
+		} else if i, exists := groupUnits[group]; exists {
+			units[i] = append(units[i], ns)
+		} else {
+			groupUnits[group] = len(units)
+			units = append(units, []*node.State{ns})
+		}
+	}
+
+	complete := units[:0]
+	for _, unit := range units {
+		group, exists := wp.affinity[*unit[0].GetID()]
+		if !exists || len(unit) == len(wp.affinityGroups[group]) {
+			complete = append(complete, unit)
+		}
+	}
+	return complete
+}
+
+// teamUnits returns the nodes that can be teamed split into units, as split by
+// affinityUnits. If onePerShard is set, only the first node of each shard is
+// kept. Must be called with the lock held.
+func (wp *waitingPool) teamUnits(nodes []*node.State) [][]*node.State {
+	if wp.onePerShard {
+		nodes = onePerShard(nodes)
+	}
+	return wp.affinityUnits(nodes)
+}
+
+// onePerShard returns the nodes, in order, leaving out every node that has the
+// same shard as a node before it. Nodes without a shard are always kept.
+func onePerShard(nodes []*node.State) []*node.State {
+	shards := make(map[string]struct{}, len(nodes))
+	kept := make([]*node.State, 0, len(nodes))
+	for _, ns := range nodes {
+		shard := ns.GetSequence().ShardKey()
+		if shard != "" {
+			if _, exists := shards[shard]; exists {
+				continue
+			}
+			shards[shard] = struct{}{}
+		}
+		kept = append(kept, ns)
+	}
+	return kept
+}
+
+// pickUnits appends units to the node list in order until it holds n nodes.
+// A unit is skipped if it is already picked, does not fit, would leave slots
+// that the remaining units cannot fill exactly, or is rejected by accept,
+// which may be nil. Picked units are marked in picked.
+func pickUnits(units [][]*node.State, picked []bool, nodeList []*node.State,
+	n int, accept func(unit []*node.State) bool) []*node.State {
+	for i, unit := range units {
+		remaining := n - len(nodeList)
+		if remaining == 0 {
+			break
+		}
+		if picked[i] || len(unit) > remaining ||
+			!canFill(units, picked, i, remaining-len(unit)) ||
+			(accept != nil && !accept(unit)) {
+			continue
+		}
+		picked[i] = true
+		nodeList = append(nodeList, unit...)
+	}
+	return nodeList
+}
+
+// canFill returns true if the units that are not picked, excluding the unit at
+// index skip, can be combined to hold exactly n nodes.
+func canFill(units [][]*node.State, picked []bool, skip, n int) bool {
+	reachable := make([]bool, n+1)
+	reachable[0] = true
+	for i, unit := range units {
+		if picked[i] || i == skip {
+			continue
+		}
+		for sum := n; sum >= len(unit); sum-- {
+			reachable[sum] = reachable[sum] || reachable[sum-len(unit)]
+		}
+		if reachable[n] {
+			return true
+		}
+	}
+	return reachable[n]
+}
+
+// countNodes returns the number of nodes in the units.
+func countNodes(units [][]*node.State) int {
+	count := 0
+	for _, unit := range units {
+		count += len(unit)
+	}
+	return count
+}
+
+// fairCandidates returns the candidates in the order they should be picked for
+// a team of n nodes: the half of the team, rounded up, that have waited
+// longest in the pool, followed by the remaining nodes in random order. A node
+// moves ahead of every node added after it each time a team is picked, so it
+// cannot wait indefinitely, while the random remainder keeps teams
+// unpredictable. If reputations is not nil, the random order of the remaining
+// nodes is weighted so that nodes with a higher reputation tend to come first.
+func fairCandidates(candidates []*node.State, n int,
+	reputations map[id.ID]float64) []*node.State {
+	// Shuffle the nodes so that ties in waiting time are broken at random
+	numList := make([]uint32, len(candidates))
+	for i := range numList {
+		numList[i] = uint32(i)
+	}
+	shuffle.Shuffle32(&numList)
+	shuffled := make([]*node.State, len(candidates))
+	for i, j := range numList {
+		shuffled[i] = candidates[j]
+	}
+
+	// Find the longest waiting nodes
+	waitingSince := make(map[*node.State]time.Time, len(shuffled))
+	for _, ns := range shuffled {
+		waitingSince[ns] = ns.GetWaitingSince()
+	}
+	oldest := make([]*node.State, len(shuffled))
+	copy(oldest, shuffled)
+	sort.SliceStable(oldest, func(i, j int) bool {
+		return waitingSince[oldest[i]].Before(waitingSince[oldest[j]])
+	})
+	numFavored := (n + 1) / 2
+	if numFavored > len(oldest) {
+		numFavored = len(oldest)
+	}
+	favored := oldest[:numFavored]
+
+	// Put the longest waiting nodes first, followed by the rest at random
+	isFavored := make(map[*node.State]struct{}, len(favored))
+	ordered := make([]*node.State, 0, len(shuffled))
+	for _, ns := range favored {
+		isFavored[ns] = struct{}{}
+		ordered = append(ordered, ns)
+	}
+	rest := make([]*node.State, 0, len(shuffled)-len(favored))
+	for _, ns := range shuffled {
+		if _, exists := isFavored[ns]; !exists {
+			rest = append(rest, ns)
+		}
+	}
+	if reputations != nil {
+		rest = weightedOrder(rest, reputations)
+	}
+
+	return append(ordered, rest...)
+}
+
+// weightedOrder returns the nodes in a random order in which each node is
+// more likely to come before another the higher its reputation is relative
+// to the other's. Each node is given the key u^(1/w), where u is uniformly
+// random in [0, 1) and w is its reputation, and the nodes are sorted by
+// descending key.
+func weightedOrder(nodes []*node.State,
+	reputations map[id.ID]float64) []*node.State {
+	keys := make(map[*node.State]float64, len(nodes))
+	for _, ns := range nodes {
+		reputation, exists := reputations[*ns.GetID()]
+		if !exists {
+			reputation = defaultReputation
+		}
+		keys[ns] = math.Pow(randFloat64(), 1/reputation)
+	}
+
+	ordered := make([]*node.State, len(nodes))
+	copy(ordered, nodes)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return keys[ordered[i]] > keys[ordered[j]]
+	})
+	return ordered
+}
+
+// randFloat64 returns a cryptographically random number in [0, 1).
+func randFloat64() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		jww.FATAL.Panicf("Failed to read random bytes: %+v", err)
+	}
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// serialWaitingPool is the serialized form of the online pool stored in the
+// State table.
+type serialWaitingPool struct {
+	Version int
+	Nodes   []*id.ID
+}
+
+// Save stores the membership of the online pool in the State table so that it
+// can be restored after a restart.
+func (wp *waitingPool) Save() error {
+	serial := serialWaitingPool{Version: waitingPoolVersion}
+
+	wp.mux.RLock()
+	wp.pool.Do(func(face interface{}) {
+		serial.Nodes = append(serial.Nodes, face.(*node.State).GetID())
+	})
+	wp.mux.RUnlock()
+
+	data, err := json.Marshal(serial)
+	if err != nil {
+		return errors.Errorf("Failed to marshal waiting pool: %+v", err)
+	}
+
+	return storage.PermissioningDb.UpsertState(&storage.State{
+		Key:   storage.WaitingPool,
+		Value: string(data),
+	})
+}
+
+// Restore adds the nodes stored by Save to the online pool. Nodes that no
+// longer exist in the node map, that have been banned or decommissioned, or
+// that are not currently WAITING are skipped; the latter are added to the pool
+// once they poll as WAITING. Returns the number of nodes restored.
+func (wp *waitingPool) Restore(nodes *node.StateMap) (int, error) {
+	data, err := storage.PermissioningDb.GetStateValue(storage.WaitingPool)
+	if err != nil {
+		return 0, errors.Errorf("Failed to load waiting pool: %+v", err)
+	}
+
+	var serial serialWaitingPool
+	err = json.Unmarshal([]byte(data), &serial)
+	if err != nil {
+		return 0, errors.Errorf("Failed to unmarshal waiting pool: %+v", err)
+	}
+
+	if serial.Version != waitingPoolVersion {
+		return 0, errors.Errorf("Stored waiting pool version %d does not "+
+			"match expected version %d", serial.Version, waitingPoolVersion)
+	}
+
+	restored := 0
+	for _, nid := range serial.Nodes {
+		n := nodes.GetNode(nid)
+		if n == nil {
+			jww.WARN.Printf("Not restoring node %s to the waiting pool: "+
+				"node not found", nid)
+			continue
+		} else if n.IsBanned() {
+			jww.WARN.Printf("Not restoring node %s to the waiting pool: "+
+				"node is banned", nid)
+			continue
+		} else if n.IsDecommissioned() {
+			jww.WARN.Printf("Not restoring node %s to the waiting pool: "+
+				"node is decommissioned", nid)
+			continue
+		} else if activity := n.GetActivity(); activity != current.WAITING {
+			jww.DEBUG.Printf("Not restoring node %s to the waiting pool: "+
+				"node is %s", nid, activity)
+			continue
+		}
+
+		wp.Add(n)
+		restored++
+	}
+
+	return restored, nil
+}
@@ -10,6 +10,7 @@ package scheduling
 import (
 	"crypto/rand"
 	"github.com/golang-collections/collections/set"
+	"gitlab.com/elixxir/primitives/current"
 	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/xx_network/crypto/signature/rsa"
@@ -125,6 +126,182 @@ func TestWaitingPool_PickNRandAtThreshold(t *testing.T) {
 
 }
 
+// Tests that when the pool holds more nodes than a team, every node is picked
+// within the number of rounds it takes to pick each node once if half of every
+// team are the longest waiting nodes.
+func TestWaitingPool_PickNRandAtThreshold_Fairness(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	totalNodes := 10
+	teamSize := 3
+	for i := 0; i < totalNodes; i++ {
+		testPool.Add(setupNode(t, testState, uint64(i)))
+	}
+
+	// Every round picks at least (teamSize+1)/2 nodes that have not been
+	// picked yet, as nodes returned to the pool wait behind them
+	maxRounds := totalNodes / ((teamSize + 1) / 2)
+	picked := make(map[id.ID]int)
+	for round := 0; round < maxRounds; round++ {
+		nodeList, err := testPool.PickNRandAtThreshold(teamSize, teamSize)
+		if err != nil {
+			t.Fatalf("Failed to pick team for round %d: %+v", round, err)
+		}
+
+		// Return the team to the pool once the round completes
+		time.Sleep(time.Millisecond)
+		for _, ns := range nodeList {
+			picked[*ns.GetID()]++
+			testPool.Add(ns)
+		}
+	}
+
+	if len(picked) != totalNodes {
+		t.Errorf("Not every node was picked within %d rounds."+
+			"\n\texpected: %d\n\treceived: %d", maxRounds, totalNodes,
+			len(picked))
+	}
+}
+
+// Tests that PickNRandAtThresholdWithSpread() picks the longest waiting nodes
+// when their bins allow it.
+func TestWaitingPool_PickNRandAtThresholdWithSpread_Fairness(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	// Add two nodes from different bins, which then wait longer than the rest
+	var oldest []*node.State
+	for i := 0; i < 2; i++ {
+		ns := setupNode(t, testState, uint64(i))
+		ns.SetGeoBin(region.GeoBin(i))
+		testPool.Add(ns)
+		oldest = append(oldest, ns)
+	}
+	time.Sleep(time.Millisecond)
+	for i := 2; i < 10; i++ {
+		ns := setupNode(t, testState, uint64(i))
+		ns.SetGeoBin(region.GeoBin(i))
+		testPool.Add(ns)
+	}
+
+	for i := 0; i < 10; i++ {
+		nodeList, err := testPool.PickNRandAtThresholdWithSpread(4, 4, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		for _, ns := range oldest {
+			found := false
+			for _, picked := range nodeList {
+				found = found || picked == ns
+			}
+			if !found {
+				t.Errorf("Longest waiting node %s not picked.", ns.GetID())
+			}
+		}
+
+		// Return the team without changing when its nodes started waiting
+		for _, ns := range nodeList {
+			testPool.pool.Insert(ns)
+		}
+	}
+}
+
+// Tests that adding a node that is already in the pool does not reset how
+// long it has been waiting.
+func TestWaitingPool_Add_KeepsWaitingSince(t *testing.T) {
+	testPool := NewWaitingPool()
+	ns := setupNode(t, setupNodeMap(t), 0)
+
+	testPool.Add(ns)
+	waitingSince := ns.GetWaitingSince()
+	if waitingSince.IsZero() {
+		t.Fatalf("Add() did not record when the node started waiting.")
+	}
+
+	time.Sleep(time.Millisecond)
+	testPool.Add(ns)
+	if !ns.GetWaitingSince().Equal(waitingSince) {
+		t.Errorf("Add() reset the waiting time of a node in the pool."+
+			"\n\texpected: %s\n\treceived: %s", waitingSince,
+			ns.GetWaitingSince())
+	}
+}
+
+// Happy path: a diverse pool produces a team with no bin over the limit
+func TestWaitingPool_PickNRandAtThresholdWithSpread(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	// Half the pool is from one bin, the rest spread over other bins
+	bins := []region.GeoBin{region.NorthAmerica, region.WesternEurope,
+		region.EasternAsia, region.Oceania, region.Russia}
+	for i := 0; i < 10; i++ {
+		newNode := setupNode(t, testState, uint64(i))
+		if i%2 == 0 {
+			newNode.SetGeoBin(region.NorthAmerica)
+		} else {
+			newNode.SetGeoBin(bins[i/2])
+		}
+		testPool.Add(newNode)
+	}
+
+	for trial := 0; trial < 20; trial++ {
+		nodeList, err := testPool.PickNRandAtThresholdWithSpread(5, 5, 2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(nodeList) != 5 {
+			t.Errorf("Node list not of expected length."+
+				"\n\tExpected: %d: "+
+				"\n\tReceived: %d", 5, len(nodeList))
+		}
+
+		binCounts := make(map[region.GeoBin]int)
+		for _, n := range nodeList {
+			binCounts[n.GetGeoBin()]++
+			testPool.Add(n)
+		}
+		for bin, count := range binCounts {
+			if count > 2 {
+				t.Errorf("Bin %s has %d nodes in the team, more than the "+
+					"limit of %d.", bin, count, 2)
+			}
+		}
+	}
+}
+
+// Tests that a pool stacked with nodes from the same bin still produces a
+// full team rather than failing when the spread cannot be satisfied.
+func TestWaitingPool_PickNRandAtThresholdWithSpread_Relaxed(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	for i := 0; i < 10; i++ {
+		newNode := setupNode(t, testState, uint64(i))
+		newNode.SetGeoBin(region.NorthAmerica)
+		testPool.Add(newNode)
+	}
+
+	nodeList, err := testPool.PickNRandAtThresholdWithSpread(5, 5, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(nodeList) != 5 {
+		t.Errorf("Node list not of expected length."+
+			"\n\tExpected: %d: "+
+			"\n\tReceived: %d", 5, len(nodeList))
+	}
+
+	if testPool.Len() != 5 {
+		t.Errorf("Picked nodes not removed from the pool."+
+			"\n\tExpected: %d: "+
+			"\n\tReceived: %d", 5, testPool.Len())
+	}
+}
+
 // Error path: does not meet threshold
 func TestWaitingPool_PickNRandAtThreshold_ThresholdErr(t *testing.T) {
 	testPool := NewWaitingPool()
@@ -210,3 +387,326 @@ func setupNodeMap(t *testing.T) *storage.NetworkState {
 
 	return testState
 }
+
+// Tests that a pool stored with Save() is restored by Restore(), skipping nodes
+// that are no longer in the node map, that have been banned or decommissioned,
+// or that are not WAITING.
+func TestWaitingPool_Save_Restore(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testNodeMap := node.NewStateMap()
+	testPool := NewWaitingPool()
+	for i := uint64(0); i < 6; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		if err = testNodeMap.AddNode(nid, "", "", "", 0); err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testPool.Add(testNodeMap.GetNode(nid))
+	}
+
+	if err = testPool.Save(); err != nil {
+		t.Fatalf("Save() returned an error: %+v", err)
+	}
+
+	// Build a new node map where one node is missing, one is banned, one is
+	// decommissioned and one has not yet polled as WAITING
+	restoredNodeMap := node.NewStateMap()
+	for _, i := range []uint64{0, 1, 3, 4} {
+		err = restoredNodeMap.AddNode(id.NewIdFromUInt(i, id.Node, t), "", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+	}
+	err = restoredNodeMap.AddBannedNode(id.NewIdFromUInt(2, id.Node, t), "", "", "")
+	if err != nil {
+		t.Fatalf("Couldn't add banned node: %v", err)
+	}
+	for _, i := range []uint64{0, 1, 3} {
+		_, _, err = restoredNodeMap.GetNode(id.NewIdFromUInt(i, id.Node, t)).
+			Update(current.WAITING)
+		if err != nil {
+			t.Fatalf("Failed to update node activity: %+v", err)
+		}
+	}
+	_, err = restoredNodeMap.GetNode(id.NewIdFromUInt(3, id.Node, t)).Decommission()
+	if err != nil {
+		t.Fatalf("Failed to decommission node: %+v", err)
+	}
+
+	restoredPool := NewWaitingPool()
+	restored, err := restoredPool.Restore(restoredNodeMap)
+	if err != nil {
+		t.Fatalf("Restore() returned an error: %+v", err)
+	}
+
+	if restored != 2 || restoredPool.Len() != 2 {
+		t.Errorf("Restore() restored an unexpected number of nodes."+
+			"\n\texpected: %d\n\treceived: %d (pool length %d)", 2, restored,
+			restoredPool.Len())
+	}
+
+	for i := uint64(0); i < 2; i++ {
+		n := restoredNodeMap.GetNode(id.NewIdFromUInt(i, id.Node, t))
+		if !restoredPool.pool.Has(n) {
+			t.Errorf("Node %s was not restored to the pool.", n.GetID())
+		}
+	}
+}
+
+// Error path: Tests that Restore() fails for an unknown serialization version
+// and when nothing has been stored.
+func TestWaitingPool_Restore_Error(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if _, err = NewWaitingPool().Restore(node.NewStateMap()); err == nil {
+		t.Errorf("Restore() did not fail when no pool was stored.")
+	}
+
+	err = storage.PermissioningDb.UpsertState(&storage.State{
+		Key:   storage.WaitingPool,
+		Value: `{"Version":99,"Nodes":[]}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to store waiting pool: %+v", err)
+	}
+
+	if _, err = NewWaitingPool().Restore(node.NewStateMap()); err == nil {
+		t.Errorf("Restore() did not fail for an unknown version.")
+	}
+}
+
+// Tests that a node in a scheduling cooldown is not picked for a team and is
+// not counted as available until the cooldown expires.
+func TestWaitingPool_PickNRandAtThreshold_Cooldown(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	totalNodes := 4
+	nodes := make([]*node.State, totalNodes)
+	for i := range nodes {
+		nodes[i] = setupNode(t, testState, uint64(i))
+		testPool.Add(nodes[i])
+	}
+
+	cooldown := 100 * time.Millisecond
+	cooling := nodes[0]
+	cooling.SetCooldownUntil(time.Now().Add(cooldown))
+
+	if testPool.AvailableLen() != totalNodes-1 {
+		t.Errorf("Available length counts the cooling node."+
+			"\n\texpected: %d\n\treceived: %d", totalNodes-1, testPool.AvailableLen())
+	}
+	if next := testPool.NextCooldownEnd(); !next.Equal(cooling.GetCooldownUntil()) {
+		t.Errorf("Unexpected next cooldown end."+
+			"\n\texpected: %s\n\treceived: %s", cooling.GetCooldownUntil(), next)
+	}
+
+	// A full team cannot be formed while the node is cooling down
+	_, err := testPool.PickNRandAtThreshold(totalNodes, totalNodes)
+	if err == nil {
+		t.Errorf("Picked a team including a node in a cooldown.")
+	}
+	nodeList, err := testPool.PickNRandAtThreshold(1, totalNodes-1)
+	if err != nil {
+		t.Fatalf("Failed to pick nodes: %+v", err)
+	}
+	for _, ns := range nodeList {
+		if ns == cooling {
+			t.Errorf("Node in a cooldown was picked for a team.")
+		}
+	}
+	for _, ns := range nodeList {
+		testPool.Add(ns)
+	}
+
+	// Once the cooldown expires the node is available again
+	time.Sleep(cooldown)
+	if testPool.AvailableLen() != totalNodes {
+		t.Errorf("Available length does not count the node after its cooldown."+
+			"\n\texpected: %d\n\treceived: %d", totalNodes, testPool.AvailableLen())
+	}
+	if next := testPool.NextCooldownEnd(); !next.IsZero() {
+		t.Errorf("Unexpected next cooldown end after the cooldown expired."+
+			"\n\texpected: %s\n\treceived: %s", time.Time{}, next)
+	}
+	nodeList, err = testPool.PickNRandAtThreshold(totalNodes, totalNodes)
+	if err != nil {
+		t.Fatalf("Failed to pick nodes after the cooldown: %+v", err)
+	}
+	if len(nodeList) != totalNodes {
+		t.Errorf("Unexpected number of nodes picked."+
+			"\n\texpected: %d\n\treceived: %d", totalNodes, len(nodeList))
+	}
+}
+
+// Tests that the members of a two-node affinity group are held back until both
+// are in the pool and are then always picked for the same team.
+func TestWaitingPool_PickNRandAtThreshold_Affinity(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	nodes := make([]*node.State, 5)
+	for i := range nodes {
+		nodes[i] = setupNode(t, testState, uint64(i))
+	}
+	testPool.SetAffinityGroups(
+		[][]*id.ID{{nodes[0].GetID(), nodes[1].GetID()}})
+
+	// Only one member of the group is in the pool, so it is held back
+	for _, ns := range append([]*node.State{nodes[0]}, nodes[2:]...) {
+		testPool.Add(ns)
+	}
+	if testPool.AvailableLen() != 3 {
+		t.Errorf("Available length counts the incomplete affinity group."+
+			"\n\texpected: %d\n\treceived: %d", 3, testPool.AvailableLen())
+	}
+	nodeList, err := testPool.PickNRandAtThreshold(1, 3)
+	if err != nil {
+		t.Fatalf("Failed to pick nodes: %+v", err)
+	}
+	for _, ns := range nodeList {
+		if ns == nodes[0] {
+			t.Errorf("Member of an incomplete affinity group was picked.")
+		}
+		testPool.Add(ns)
+	}
+
+	// Once both members are in the pool they are picked together
+	testPool.Add(nodes[1])
+	if testPool.AvailableLen() != len(nodes) {
+		t.Errorf("Available length does not count the affinity group."+
+			"\n\texpected: %d\n\treceived: %d", len(nodes),
+			testPool.AvailableLen())
+	}
+	pickedGroup := false
+	for i := 0; i < 50; i++ {
+		nodeList, err = testPool.PickNRandAtThreshold(1, 3)
+		if err != nil {
+			t.Fatalf("Failed to pick nodes (%d): %+v", i, err)
+		}
+
+		members := 0
+		for _, ns := range nodeList {
+			if ns == nodes[0] || ns == nodes[1] {
+				members++
+			}
+			testPool.Add(ns)
+		}
+		if members == 1 {
+			t.Fatalf("Affinity group was split (%d): %v", i, nodeList)
+		}
+		pickedGroup = pickedGroup || members == 2
+	}
+	if !pickedGroup {
+		t.Errorf("Affinity group was never picked.")
+	}
+}
+
+// Tests that a team is not picked when the affinity groups in the pool cannot
+// fill it exactly.
+func TestWaitingPool_PickNRandAtThreshold_AffinityCannotFill(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	nodes := make([]*node.State, 4)
+	for i := range nodes {
+		nodes[i] = setupNode(t, testState, uint64(i))
+		testPool.Add(nodes[i])
+	}
+	testPool.SetAffinityGroups([][]*id.ID{
+		{nodes[0].GetID(), nodes[1].GetID()},
+		{nodes[2].GetID(), nodes[3].GetID()},
+	})
+
+	if testPool.CanPick(3) {
+		t.Errorf("CanPick() reports that two groups of two can fill a " +
+			"team of three.")
+	}
+	if _, err := testPool.PickNRandAtThreshold(1, 3); err == nil {
+		t.Errorf("Picked a team of three from two groups of two.")
+	}
+	if testPool.Len() != len(nodes) {
+		t.Errorf("Nodes were removed from the pool by a failed pick."+
+			"\n\texpected: %d\n\treceived: %d", len(nodes), testPool.Len())
+	}
+
+	if !testPool.CanPick(2) || !testPool.CanPick(4) {
+		t.Errorf("CanPick() reports that whole groups cannot fill a team.")
+	}
+	nodeList, err := testPool.PickNRandAtThresholdWithSpread(1, 2, 2)
+	if err != nil {
+		t.Fatalf("Failed to pick nodes: %+v", err)
+	}
+	picked := set.New(nodeList[0], nodeList[1])
+	if !(picked.Has(nodes[0]) && picked.Has(nodes[1]) ||
+		picked.Has(nodes[2]) && picked.Has(nodes[3])) {
+		t.Errorf("Picked team is not an affinity group: %v", nodeList)
+	}
+}
+
+// Tests that when onePerShard is set, teams are picked with no two nodes from
+// the same shard, while nodes without a shard are not constrained.
+func TestWaitingPool_PickNRandAtThreshold_OnePerShard(t *testing.T) {
+	testPool := NewWaitingPool()
+	testPool.SetOnePerShard(true)
+	testState := setupNodeMap(t)
+
+	// Four shards, one of them in two regions, and two nodes without a shard
+	sequences := []string{"US/a/0", "US/a/1", "US/a/2", "US/b/0", "US/b/1",
+		"DE/a/0", "CA/c/0", "US", "US"}
+	for i, sequence := range sequences {
+		ns := setupNode(t, testState, uint64(i))
+		ns.SetOrdering(sequence)
+		testPool.Add(ns)
+	}
+
+	if testPool.AvailableLen() != 6 {
+		t.Errorf("Available length does not count each shard once."+
+			"\n\texpected: %d\n\treceived: %d", 6, testPool.AvailableLen())
+	}
+	if !testPool.CanPick(6) || testPool.CanPick(7) {
+		t.Errorf("CanPick() reports teams with two nodes of a shard.")
+	}
+	if _, err := testPool.PickNRandAtThreshold(1, 7); err == nil {
+		t.Errorf("Picked a team of seven from four shards and two nodes " +
+			"without a shard.")
+	}
+
+	for i := 0; i < 50; i++ {
+		var nodeList []*node.State
+		var err error
+		if i%2 == 0 {
+			nodeList, err = testPool.PickNRandAtThreshold(1, 5)
+		} else {
+			nodeList, err = testPool.PickNRandAtThresholdWithSpread(1, 5, 1)
+		}
+		if err != nil {
+			t.Fatalf("Failed to pick nodes (%d): %+v", i, err)
+		}
+
+		shards := make(map[string]bool)
+		for _, ns := range nodeList {
+			shard := ns.GetSequence().ShardKey()
+			if shard != "" && shards[shard] {
+				t.Fatalf("Team has more than one node of shard %s (%d).",
+					shard, i)
+			}
+			shards[shard] = true
+			testPool.Add(ns)
+		}
+	}
+
+	// Without the constraint, nodes of the same shard are teamed
+	testPool.SetOnePerShard(false)
+	if !testPool.CanPick(len(sequences)) {
+		t.Errorf("CanPick() constrains shards when onePerShard is not set.")
+	}
+}
@@ -0,0 +1,72 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles scoring nodes by the outcomes of the rounds they recently took part
+// in, so that team selection can favor nodes that rarely fail rounds
+
+package scheduling
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+const (
+	// how often node reputations are recomputed from storage
+	reputationRefreshInterval = time.Minute
+
+	// reputation of a node without any rounds in the window, which matches
+	// the score of a node with no round outcomes
+	defaultReputation = 0.5
+)
+
+// reputationScore returns the reputation of a node with the given round
+// outcomes: the fraction of its rounds that succeeded, smoothed so that nodes
+// with few rounds stay close to defaultReputation. The score is always above
+// 0 and below 1.
+func reputationScore(outcomes storage.NodeRoundOutcomes) float64 {
+	succeeded := outcomes.Rounds - outcomes.Failed
+	return float64(succeeded+1) / float64(outcomes.Rounds+2)
+}
+
+// loadReputations returns the reputation of each node that took part in a
+// round that ended within the window before now.
+func loadReputations(window time.Duration, now time.Time) (
+	map[id.ID]float64, error) {
+	outcomes, err := storage.PermissioningDb.GetNodeRoundOutcomes(
+		now.Add(-window))
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to get node round outcomes")
+	}
+
+	reputations := make(map[id.ID]float64, len(outcomes))
+	for nid, nodeOutcomes := range outcomes {
+		reputations[nid] = reputationScore(nodeOutcomes)
+	}
+	return reputations, nil
+}
+
+// refreshReputations sets the reputations of the nodes in the pool from the
+// rounds that ended within the window. If the window is 0, reputations are
+// cleared so that nodes are picked uniformly. The previous reputations are
+// kept if they cannot be loaded.
+func refreshReputations(pool *waitingPool, window time.Duration) {
+	if window == 0 {
+		pool.SetReputations(nil)
+		return
+	}
+
+	reputations, err := loadReputations(window, time.Now())
+	if err != nil {
+		jww.WARN.Printf("Unable to refresh node reputations: %+v", err)
+		return
+	}
+	pool.SetReputations(reputations)
+}
@@ -0,0 +1,213 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"fmt"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+	"time"
+)
+
+// storeTestRounds registers the node and stores rounds, that ended at
+// roundEnd, with the node as the only member, of which the given number failed.
+func storeTestRounds(nid *id.ID, firstRound uint64, rounds, failed int,
+	roundEnd time.Time, t *testing.T) {
+	err := storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: firstRound},
+		&storage.Node{Code: fmt.Sprintf("TEST%d", firstRound), Id: nid.Bytes()})
+	if err != nil {
+		t.Fatalf("Failed to insert node %s: %+v", nid, err)
+	}
+
+	for i := 0; i < rounds; i++ {
+		rid := firstRound + uint64(i)
+		err := storage.PermissioningDb.InsertRoundMetric(&storage.RoundMetric{
+			Id:       rid,
+			RoundEnd: roundEnd,
+		}, [][]byte{nid.Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert round metric %d: %+v", rid, err)
+		}
+		if i < failed {
+			err = storage.PermissioningDb.InsertRoundError(id.Round(rid),
+				storage.NodeReportedError, "test error")
+			if err != nil {
+				t.Fatalf("Failed to insert round error %d: %+v", rid, err)
+			}
+		}
+	}
+}
+
+// Tests that reputationScore() ranks nodes by the share of their rounds that
+// succeeded and gives nodes without rounds defaultReputation.
+func TestReputationScore(t *testing.T) {
+	noRounds := reputationScore(storage.NodeRoundOutcomes{})
+	if noRounds != defaultReputation {
+		t.Errorf("Unexpected score of a node without rounds."+
+			"\n\texpected: %v\n\treceived: %v", defaultReputation, noRounds)
+	}
+
+	clean := reputationScore(storage.NodeRoundOutcomes{Rounds: 20})
+	failing := reputationScore(storage.NodeRoundOutcomes{Rounds: 20, Failed: 18})
+	allFailed := reputationScore(storage.NodeRoundOutcomes{Rounds: 20, Failed: 20})
+	if !(clean > noRounds && noRounds > failing && failing > allFailed) {
+		t.Errorf("Scores not ordered by the share of successful rounds."+
+			"\n\tclean: %v\n\tno rounds: %v\n\tfailing: %v\n\tall failed: %v",
+			clean, noRounds, failing, allFailed)
+	}
+	if clean >= 1 || allFailed <= 0 {
+		t.Errorf("Scores not between 0 and 1.\n\tclean: %v\n\tall failed: %v",
+			clean, allFailed)
+	}
+}
+
+// Tests that loadReputations() only scores nodes by rounds that ended within
+// the window.
+func TestLoadReputations(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	now := time.Now()
+	clean := id.NewIdFromUInt(0, id.Node, t)
+	failing := id.NewIdFromUInt(1, id.Node, t)
+	old := id.NewIdFromUInt(2, id.Node, t)
+	storeTestRounds(clean, 1, 10, 0, now.Add(-time.Minute), t)
+	storeTestRounds(failing, 11, 10, 8, now.Add(-time.Minute), t)
+	storeTestRounds(old, 21, 10, 10, now.Add(-time.Hour), t)
+
+	reputations, err := loadReputations(30*time.Minute, now)
+	if err != nil {
+		t.Fatalf("loadReputations() returned an error: %+v", err)
+	}
+
+	expected := map[id.ID]float64{
+		*clean:   reputationScore(storage.NodeRoundOutcomes{Rounds: 10}),
+		*failing: reputationScore(storage.NodeRoundOutcomes{Rounds: 10, Failed: 8}),
+	}
+	if len(reputations) != len(expected) {
+		t.Errorf("Unexpected number of reputations."+
+			"\n\texpected: %v\n\treceived: %v", expected, reputations)
+	}
+	for nid, score := range expected {
+		if reputations[nid] != score {
+			t.Errorf("Unexpected reputation of node %s."+
+				"\n\texpected: %v\n\treceived: %v", &nid, score,
+				reputations[nid])
+		}
+	}
+}
+
+// Tests that refreshReputations() clears the reputations of the pool when the
+// window is 0.
+func TestRefreshReputations_Disabled(t *testing.T) {
+	testPool := NewWaitingPool()
+	testPool.SetReputations(map[id.ID]float64{})
+
+	refreshReputations(testPool, 0)
+	if testPool.reputations != nil {
+		t.Errorf("Reputations not cleared: %v", testPool.reputations)
+	}
+}
+
+// Tests that PickNRandAtThreshold() picks a node that failed many rounds less
+// often than a node that failed none, while still always picking the longest
+// waiting node regardless of its reputation.
+func TestWaitingPool_PickNRandAtThreshold_Reputation(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create database: %+v", err)
+	}
+
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	// The oldest node fills the longest waiting half of a team of two, so
+	// that the clean and failing nodes compete for the random half
+	oldest := setupNode(t, testState, 0)
+	testPool.Add(oldest)
+	time.Sleep(time.Millisecond)
+	clean := setupNode(t, testState, 1)
+	failing := setupNode(t, testState, 2)
+	testPool.Add(clean)
+	testPool.Add(failing)
+
+	now := time.Now()
+	storeTestRounds(oldest.GetID(), 1, 20, 20, now, t)
+	storeTestRounds(clean.GetID(), 21, 20, 0, now, t)
+	storeTestRounds(failing.GetID(), 41, 20, 18, now, t)
+	refreshReputations(testPool, time.Hour)
+
+	const trials = 1000
+	picked := make(map[*node.State]int)
+	for i := 0; i < trials; i++ {
+		nodeList, err := testPool.PickNRandAtThreshold(2, 2)
+		if err != nil {
+			t.Fatalf("Failed to pick team %d: %+v", i, err)
+		}
+		for _, ns := range nodeList {
+			picked[ns]++
+
+			// Return the node without changing when it started waiting
+			testPool.pool.Insert(ns)
+		}
+	}
+
+	if picked[oldest] != trials {
+		t.Errorf("Longest waiting node not picked for every team."+
+			"\n\texpected: %d\n\treceived: %d", trials, picked[oldest])
+	}
+
+	// The clean node is expected to be picked for about 87% of teams
+	if picked[clean] < trials*3/4 || picked[failing] > trials/4 {
+		t.Errorf("Node with many failed rounds not deprioritized."+
+			"\n\tclean node picked: %d\n\tfailing node picked: %d",
+			picked[clean], picked[failing])
+	}
+}
+
+// Tests that PickNRandAtThreshold() picks nodes with and without failed rounds
+// alike when reputations are not set.
+func TestWaitingPool_PickNRandAtThreshold_NoReputation(t *testing.T) {
+	testPool := NewWaitingPool()
+	testState := setupNodeMap(t)
+
+	oldest := setupNode(t, testState, 0)
+	testPool.Add(oldest)
+	time.Sleep(time.Millisecond)
+	first := setupNode(t, testState, 1)
+	second := setupNode(t, testState, 2)
+	testPool.Add(first)
+	testPool.Add(second)
+
+	const trials = 1000
+	picked := make(map[*node.State]int)
+	for i := 0; i < trials; i++ {
+		nodeList, err := testPool.PickNRandAtThreshold(2, 2)
+		if err != nil {
+			t.Fatalf("Failed to pick team %d: %+v", i, err)
+		}
+		for _, ns := range nodeList {
+			picked[ns]++
+			testPool.pool.Insert(ns)
+		}
+	}
+
+	// Each node is expected to be picked for about half of the teams
+	if picked[first] < trials/3 || picked[second] < trials/3 {
+		t.Errorf("Nodes not picked uniformly without reputations."+
+			"\n\tfirst node picked: %d\n\tsecond node picked: %d",
+			picked[first], picked[second])
+	}
+}
@@ -0,0 +1,282 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles retrying round metric inserts that failed
+
+package scheduling
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/utils"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum number of round metrics waiting to be retried; when full, the
+	// oldest metric is dropped
+	roundMetricQueueLen = 10000
+
+	// number of times a round metric insert is attempted before it is dropped
+	roundMetricMaxAttempts = 20
+
+	// bounds of the exponential backoff between failed retries
+	roundMetricInitialBackoff = time.Second
+	roundMetricMaxBackoff     = time.Minute
+)
+
+// roundMetrics retries the round metric inserts that failed in
+// StoreRoundMetric. Its worker is started by the Scheduler.
+var roundMetrics = newRoundMetricQueue(insertRoundMetric)
+
+// FlushRoundMetrics attempts to insert the round metrics waiting to be retried
+// so that they are not lost on shutdown. Returns the number of metrics that
+// could not be inserted.
+func FlushRoundMetrics() int {
+	return roundMetrics.flush()
+}
+
+// insertRoundMetric inserts the metric into the permissioning database.
+func insertRoundMetric(metric *storage.RoundMetric, topology [][]byte) error {
+	return storage.PermissioningDb.InsertRoundMetric(metric, topology)
+}
+
+// pendingRoundMetric is a round metric whose insert failed.
+type pendingRoundMetric struct {
+	Metric   *storage.RoundMetric
+	Topology [][]byte
+	Attempts int
+}
+
+// roundMetricQueue is a bounded queue of round metrics waiting to be inserted
+// into storage. Metrics are retried in the order they were added with
+// exponential backoff between failed attempts, and a round is only queued once
+// so that it is not counted twice. If a path is set, the queue is written to
+// it on every change so that pending metrics survive a restart.
+type roundMetricQueue struct {
+	pending []*pendingRoundMetric
+	ids     map[uint64]struct{}
+	path    string
+	mux     sync.Mutex
+
+	// Held while inserting so that a flush and the worker do not insert the
+	// same metric
+	insertMux sync.Mutex
+
+	insert         func(metric *storage.RoundMetric, topology [][]byte) error
+	maxLen         int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// Signals the worker that a metric has been added
+	added chan struct{}
+}
+
+// newRoundMetricQueue creates an empty queue which inserts metrics with the
+// given function.
+func newRoundMetricQueue(insert func(metric *storage.RoundMetric,
+	topology [][]byte) error) *roundMetricQueue {
+	return &roundMetricQueue{
+		ids:            make(map[uint64]struct{}),
+		insert:         insert,
+		maxLen:         roundMetricQueueLen,
+		initialBackoff: roundMetricInitialBackoff,
+		maxBackoff:     roundMetricMaxBackoff,
+		added:          make(chan struct{}, 1),
+	}
+}
+
+// Len returns the number of metrics waiting to be inserted.
+func (q *roundMetricQueue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.pending)
+}
+
+// add queues the metric to be retried. Metrics for rounds that are already
+// queued are ignored.
+func (q *roundMetricQueue) add(metric *storage.RoundMetric, topology [][]byte) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if _, exists := q.ids[metric.Id]; exists {
+		jww.DEBUG.Printf("Metric for round %d is already queued for retry",
+			metric.Id)
+		return
+	}
+
+	if len(q.pending) >= q.maxLen {
+		dropped := q.pending[0]
+		jww.ERROR.Printf("Round metric retry queue is full, dropping metric "+
+			"for round %d", dropped.Metric.Id)
+		q.pending = q.pending[1:]
+		delete(q.ids, dropped.Metric.Id)
+	}
+
+	q.pending = append(q.pending,
+		&pendingRoundMetric{Metric: metric, Topology: topology, Attempts: 1})
+	q.ids[metric.Id] = struct{}{}
+	q.save()
+
+	select {
+	case q.added <- struct{}{}:
+	default:
+	}
+}
+
+// insertNext attempts to insert the oldest queued metric. Returns true if the
+// metric was removed from the queue, either because it was inserted or because
+// it has run out of attempts.
+func (q *roundMetricQueue) insertNext() bool {
+	q.insertMux.Lock()
+	defer q.insertMux.Unlock()
+
+	q.mux.Lock()
+	if len(q.pending) == 0 {
+		q.mux.Unlock()
+		return true
+	}
+	next := q.pending[0]
+	q.mux.Unlock()
+
+	err := q.insert(next.Metric, next.Topology)
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	next.Attempts++
+	if err != nil && next.Attempts < roundMetricMaxAttempts {
+		jww.WARN.Printf("Failed to insert metric for round %d on attempt "+
+			"%d: %+v", next.Metric.Id, next.Attempts, err)
+		q.save()
+		return false
+	} else if err != nil {
+		jww.ERROR.Printf("Dropping metric for round %d after %d failed "+
+			"attempts: %+v", next.Metric.Id, next.Attempts, err)
+	} else {
+		jww.INFO.Printf("Inserted metric for round %d after %d attempts",
+			next.Metric.Id, next.Attempts)
+	}
+
+	// The queue is only ever shortened by insertNext and add, so the metric
+	// is still at the front unless add dropped it for being full
+	if len(q.pending) > 0 && q.pending[0] == next {
+		q.pending = q.pending[1:]
+		delete(q.ids, next.Metric.Id)
+		q.save()
+	}
+
+	return true
+}
+
+// flush attempts to insert the queued metrics without waiting between
+// attempts, stopping at the first failed insert. Returns the number of metrics
+// still queued.
+func (q *roundMetricQueue) flush() int {
+	for q.Len() > 0 {
+		if !q.insertNext() {
+			break
+		}
+	}
+	return q.Len()
+}
+
+// run inserts queued metrics until the quit channel is closed or signaled.
+// After a failed insert, it waits before retrying, doubling the wait on each
+// consecutive failure up to maxBackoff.
+func (q *roundMetricQueue) run(quit chan struct{}) {
+	backoff := q.initialBackoff
+	for {
+		if q.Len() == 0 {
+			select {
+			case <-quit:
+				return
+			case <-q.added:
+			}
+			continue
+		}
+
+		if q.insertNext() {
+			backoff = q.initialBackoff
+			continue
+		}
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+// restore sets the path the queue is written to and loads any metrics stored
+// there by a previous run. If the path is empty, the queue is kept in memory
+// only.
+func (q *roundMetricQueue) restore(path string) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.path = path
+	if path == "" || !utils.Exists(path) {
+		return nil
+	}
+
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return errors.Errorf("Failed to read round metric queue: %+v", err)
+	}
+
+	var stored []*pendingRoundMetric
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return errors.Errorf("Failed to unmarshal round metric queue: %+v", err)
+	}
+
+	for _, p := range stored {
+		if _, exists := q.ids[p.Metric.Id]; !exists {
+			q.pending = append(q.pending, p)
+			q.ids[p.Metric.Id] = struct{}{}
+		}
+	}
+
+	if len(q.pending) > 0 {
+		select {
+		case q.added <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// save writes the queue to its path, if one is set. Must be called with the
+// lock held.
+func (q *roundMetricQueue) save() {
+	if q.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(q.pending)
+	if err != nil {
+		jww.ERROR.Printf("Failed to marshal round metric queue: %+v", err)
+		return
+	}
+
+	err = utils.WriteFile(q.path, data, utils.FilePerms, utils.DirPerms)
+	if err != nil {
+		jww.ERROR.Printf("Failed to write round metric queue to %s: %+v",
+			q.path, err)
+	}
+}
@@ -0,0 +1,273 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/primitives/id"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failingInserter fails the first failures inserts and passes the rest to the
+// permissioning database, recording the order of the attempted round IDs.
+type failingInserter struct {
+	failures int
+	attempts []uint64
+	mux      sync.Mutex
+}
+
+func (f *failingInserter) insert(metric *storage.RoundMetric,
+	topology [][]byte) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.attempts = append(f.attempts, metric.Id)
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("database unavailable")
+	}
+	return storage.PermissioningDb.InsertRoundMetric(metric, topology)
+}
+
+func (f *failingInserter) getAttempts() []uint64 {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]uint64{}, f.attempts...)
+}
+
+// newTestRoundMetric returns a round metric for the round ID with a one node
+// topology.
+func newTestRoundMetric(roundID uint64, t *testing.T) (
+	*storage.RoundMetric, [][]byte) {
+	now := time.Now()
+	metric := &storage.RoundMetric{
+		Id:            roundID,
+		PrecompStart:  now,
+		PrecompEnd:    now,
+		RealtimeStart: now,
+		RealtimeEnd:   now,
+		RoundEnd:      now,
+		BatchSize:     32,
+	}
+	topology := [][]byte{id.NewIdFromUInt(roundID, id.Node, t).Marshal()}
+	return metric, topology
+}
+
+// insertTestNode stores the node of the round metric's topology so that the
+// metric can be inserted into the database.
+func insertTestNode(roundID uint64, topology [][]byte, t *testing.T) {
+	err := storage.PermissioningDb.InsertApplication(
+		&storage.Application{Id: roundID * 10},
+		&storage.Node{Code: fmt.Sprintf("TEST%d", roundID), Id: topology[0]})
+	if err != nil {
+		t.Fatalf("Failed to insert node for test: %+v", err)
+	}
+}
+
+// newTestRoundMetricQueue returns a queue with short backoffs.
+func newTestRoundMetricQueue(inserter *failingInserter) *roundMetricQueue {
+	q := newRoundMetricQueue(inserter.insert)
+	q.initialBackoff = time.Millisecond
+	q.maxBackoff = 4 * time.Millisecond
+	return q
+}
+
+// Tests that a metric whose insert fails for the first attempts is retried by
+// the worker until it is stored in the database.
+func TestRoundMetricQueue_run(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	inserter := &failingInserter{failures: 5}
+	q := newTestRoundMetricQueue(inserter)
+	quit := make(chan struct{})
+	defer close(quit)
+	go q.run(quit)
+
+	metric, topology := newTestRoundMetric(1, t)
+	insertTestNode(1, topology, t)
+	q.add(metric, topology)
+
+	for i := 0; q.Len() > 0; i++ {
+		if i > 100 {
+			t.Fatalf("Metric not inserted after %d attempts.",
+				len(inserter.getAttempts()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if attempts := len(inserter.getAttempts()); attempts != 6 {
+		t.Errorf("Unexpected number of insert attempts."+
+			"\n\texpected: %d\n\treceived: %d", 6, attempts)
+	}
+
+	metrics, err := storage.PermissioningDb.GetRoundMetrics(
+		metric.RealtimeEnd.Add(-time.Second), metric.RealtimeEnd.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to get round metrics: %+v", err)
+	}
+	if len(metrics) != 1 || metrics[0].Id != metric.Id {
+		t.Errorf("Metric not stored in the database: %+v", metrics)
+	}
+}
+
+// Tests that queued metrics are retried in the order they were added and that
+// a round queued twice is only inserted once.
+func TestRoundMetricQueue_OrderAndDeduplication(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	inserter := &failingInserter{failures: 3}
+	q := newTestRoundMetricQueue(inserter)
+
+	for _, roundID := range []uint64{1, 2, 3} {
+		_, topology := newTestRoundMetric(roundID, t)
+		insertTestNode(roundID, topology, t)
+	}
+	for _, roundID := range []uint64{3, 1, 2, 1, 3} {
+		metric, topology := newTestRoundMetric(roundID, t)
+		q.add(metric, topology)
+	}
+	if q.Len() != 3 {
+		t.Fatalf("Duplicate rounds were queued."+
+			"\n\texpected: %d\n\treceived: %d", 3, q.Len())
+	}
+
+	for i := 0; q.Len() > 0; i++ {
+		if i > 10 {
+			t.Fatalf("Queue not drained after %d attempts.", i)
+		}
+		q.insertNext()
+	}
+
+	expected := []uint64{3, 3, 3, 3, 1, 2}
+	if attempts := inserter.getAttempts(); !reflect.DeepEqual(expected, attempts) {
+		t.Errorf("Metrics not retried in order."+
+			"\n\texpected: %v\n\treceived: %v", expected, attempts)
+	}
+}
+
+// Tests that a metric is dropped after roundMetricMaxAttempts so that it does
+// not block the rest of the queue.
+func TestRoundMetricQueue_insertNext_MaxAttempts(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	inserter := &failingInserter{failures: roundMetricMaxAttempts}
+	q := newTestRoundMetricQueue(inserter)
+	metric, topology := newTestRoundMetric(1, t)
+	q.add(metric, topology)
+
+	for i := 1; i < roundMetricMaxAttempts-1; i++ {
+		if q.insertNext() {
+			t.Fatalf("Metric removed after %d attempts.", i+1)
+		}
+	}
+	if !q.insertNext() || q.Len() != 0 {
+		t.Errorf("Metric not dropped after %d attempts.",
+			roundMetricMaxAttempts)
+	}
+}
+
+// Tests that flush() stops at the first failed insert and inserts every queued
+// metric once the database is available.
+func TestRoundMetricQueue_flush(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	inserter := &failingInserter{failures: 1}
+	q := newTestRoundMetricQueue(inserter)
+	for _, roundID := range []uint64{1, 2, 3} {
+		metric, topology := newTestRoundMetric(roundID, t)
+		insertTestNode(roundID, topology, t)
+		q.add(metric, topology)
+	}
+
+	if remaining := q.flush(); remaining != 3 {
+		t.Errorf("Unexpected number of metrics left after a failed insert."+
+			"\n\texpected: %d\n\treceived: %d", 3, remaining)
+	}
+	if remaining := q.flush(); remaining != 0 {
+		t.Errorf("Unexpected number of metrics left after flushing."+
+			"\n\texpected: %d\n\treceived: %d", 0, remaining)
+	}
+
+	expected := []uint64{1, 1, 2, 3}
+	if attempts := inserter.getAttempts(); !reflect.DeepEqual(expected, attempts) {
+		t.Errorf("Unexpected insert attempts."+
+			"\n\texpected: %v\n\treceived: %v", expected, attempts)
+	}
+}
+
+// Tests that when the queue is full, the oldest metric is dropped.
+func TestRoundMetricQueue_add_Full(t *testing.T) {
+	q := newTestRoundMetricQueue(&failingInserter{})
+	q.maxLen = 2
+
+	for roundID := uint64(1); roundID <= 3; roundID++ {
+		metric, topology := newTestRoundMetric(roundID, t)
+		q.add(metric, topology)
+	}
+
+	if q.Len() != 2 || q.pending[0].Metric.Id != 2 || q.pending[1].Metric.Id != 3 {
+		t.Errorf("Oldest metric not dropped from full queue: %+v", q.pending)
+	}
+	if _, exists := q.ids[1]; exists {
+		t.Errorf("Dropped round still marked as queued.")
+	}
+}
+
+// Tests that metrics added to a queue with a path are restored by a new queue
+// with the same path.
+func TestRoundMetricQueue_restore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roundMetrics.json")
+
+	q := newTestRoundMetricQueue(&failingInserter{})
+	if err := q.restore(path); err != nil {
+		t.Fatalf("restore() returned an error for a missing file: %+v", err)
+	}
+	for roundID := uint64(1); roundID <= 2; roundID++ {
+		metric, topology := newTestRoundMetric(roundID, t)
+		q.add(metric, topology)
+	}
+
+	restored := newTestRoundMetricQueue(&failingInserter{})
+	if err := restored.restore(path); err != nil {
+		t.Fatalf("restore() returned an error: %+v", err)
+	}
+
+	if restored.Len() != 2 {
+		t.Fatalf("Unexpected number of restored metrics."+
+			"\n\texpected: %d\n\treceived: %d", 2, restored.Len())
+	}
+	for i, p := range restored.pending {
+		if p.Metric.Id != q.pending[i].Metric.Id ||
+			!reflect.DeepEqual(p.Topology, q.pending[i].Topology) {
+			t.Errorf("Restored metric %d does not match."+
+				"\n\texpected: %+v\n\treceived: %+v", i, q.pending[i], p)
+		}
+	}
+}
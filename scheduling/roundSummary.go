@@ -0,0 +1,99 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles logging a summary of each completed round
+
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	jww "github.com/spf13/jwalterweatherman"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/xx_network/primitives/id"
+	"strings"
+	"time"
+)
+
+// Formats of the round summary set by Params.RoundSummaryFormat.
+const (
+	// RoundSummaryText logs the summary as a human-readable sentence
+	RoundSummaryText = "text"
+
+	// RoundSummaryJSON logs the summary as a RoundSummary JSON object
+	RoundSummaryJSON = "json"
+)
+
+// RoundSummary is the summary of a completed round logged when the
+// RoundSummaryFormat is set. Durations are in nanoseconds when marshalled.
+type RoundSummary struct {
+	RoundID          id.Round
+	Team             []string
+	BatchSize        uint32
+	PrecompDuration  time.Duration
+	RealtimeDuration time.Duration
+	ClientErrors     int
+}
+
+// validRoundSummaryFormat returns true if the format is a known round summary
+// format or empty.
+func validRoundSummaryFormat(format string) bool {
+	return format == "" || format == RoundSummaryText ||
+		format == RoundSummaryJSON
+}
+
+// newRoundSummary returns the summary of the completed round, whose realtime
+// completed at realtimeTs in Unix nanoseconds.
+func newRoundSummary(roundInfo *pb.RoundInfo, realtimeTs int64) RoundSummary {
+	team := make([]string, 0, len(roundInfo.Topology))
+	for i, nodeIdBytes := range roundInfo.Topology {
+		nid, err := id.Unmarshal(nodeIdBytes)
+		if err != nil {
+			team = append(team, fmt.Sprintf("invalid ID at %d", i))
+			continue
+		}
+		team = append(team, nid.String())
+	}
+
+	timestamps := roundInfo.Timestamps
+	return RoundSummary{
+		RoundID:   roundInfo.GetRoundId(),
+		Team:      team,
+		BatchSize: roundInfo.BatchSize,
+		PrecompDuration: time.Duration(timestamps[states.STANDBY] -
+			timestamps[states.PRECOMPUTING]),
+		RealtimeDuration: time.Duration(uint64(realtimeTs) -
+			timestamps[states.REALTIME]),
+		ClientErrors: len(roundInfo.ClientErrors),
+	}
+}
+
+// String returns the summary as a human-readable sentence.
+func (rs RoundSummary) String() string {
+	return fmt.Sprintf("Round %d completed with team [%s], batch size %d, "+
+		"precomputation %s, realtime %s, and %d client errors", rs.RoundID,
+		strings.Join(rs.Team, ", "), rs.BatchSize, rs.PrecompDuration,
+		rs.RealtimeDuration, rs.ClientErrors)
+}
+
+// logRoundSummary logs the summary of the completed round at info level in the
+// format. Nothing is logged if the format is empty.
+func logRoundSummary(format string, roundInfo *pb.RoundInfo, realtimeTs int64) {
+	switch format {
+	case RoundSummaryText:
+		jww.INFO.Print(newRoundSummary(roundInfo, realtimeTs).String())
+	case RoundSummaryJSON:
+		data, err := json.Marshal(newRoundSummary(roundInfo, realtimeTs))
+		if err != nil {
+			jww.WARN.Printf("Failed to marshal summary of round %d: %+v",
+				roundInfo.GetRoundId(), err)
+			return
+		}
+		jww.INFO.Print(string(data))
+	}
+}
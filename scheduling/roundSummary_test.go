@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"bytes"
+	"encoding/json"
+	jww "github.com/spf13/jwalterweatherman"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSummaryTestRound returns the round info of a completed round with two
+// nodes and one client error, and the time its realtime completed.
+func newSummaryTestRound(t *testing.T) (*pb.RoundInfo, int64, []*id.ID) {
+	start := time.Unix(1600000000, 0)
+	nodes := []*id.ID{
+		id.NewIdFromString("node0", id.Node, t),
+		id.NewIdFromString("node1", id.Node, t),
+	}
+
+	timestamps := make([]uint64, states.NUM_STATES)
+	timestamps[states.PRECOMPUTING] = uint64(start.UnixNano())
+	timestamps[states.STANDBY] = uint64(start.Add(3 * time.Second).UnixNano())
+	timestamps[states.REALTIME] = uint64(start.Add(5 * time.Second).UnixNano())
+	timestamps[states.COMPLETED] = uint64(start.Add(7 * time.Second).UnixNano())
+
+	roundInfo := &pb.RoundInfo{
+		ID:           42,
+		Topology:     [][]byte{nodes[0].Bytes(), nodes[1].Bytes()},
+		BatchSize:    32,
+		Timestamps:   timestamps,
+		ClientErrors: []*pb.ClientError{{Error: "client error"}},
+	}
+	return roundInfo, start.Add(6 * time.Second).UnixNano(), nodes
+}
+
+// captureInfoLog logs at info level to a buffer until the returned function
+// is called.
+func captureInfoLog() (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	threshold := jww.LogThreshold()
+	jww.SetLogThreshold(jww.LevelInfo)
+	jww.SetLogOutput(buf)
+	return buf, func() {
+		jww.SetLogOutput(io.Discard)
+		jww.SetLogThreshold(threshold)
+	}
+}
+
+// Tests that logRoundSummary() logs a JSON summary of the completed round
+// with its ID, team, batch size, durations, and client error count.
+func Test_logRoundSummary_JSON(t *testing.T) {
+	roundInfo, realtimeTs, nodes := newSummaryTestRound(t)
+	buf, restore := captureInfoLog()
+	logRoundSummary(RoundSummaryJSON, roundInfo, realtimeTs)
+	restore()
+
+	line := buf.String()
+	start := strings.Index(line, `{"RoundID":42`)
+	if start < 0 {
+		t.Fatalf("No summary of round 42 logged: %s", line)
+	}
+	end := strings.Index(line[start:], "\n")
+	if end < 0 {
+		end = len(line) - start
+	}
+
+	var received RoundSummary
+	err := json.Unmarshal([]byte(line[start:start+end]), &received)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal logged summary: %+v", err)
+	}
+
+	expected := RoundSummary{
+		RoundID:          42,
+		Team:             []string{nodes[0].String(), nodes[1].String()},
+		BatchSize:        32,
+		PrecompDuration:  3 * time.Second,
+		RealtimeDuration: time.Second,
+		ClientErrors:     1,
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected round summary.\n\texpected: %+v\n\treceived: %+v",
+			expected, received)
+	}
+}
+
+// Tests that logRoundSummary() logs a readable summary in the text format and
+// nothing when the format is empty.
+func Test_logRoundSummary_Text(t *testing.T) {
+	roundInfo, realtimeTs, nodes := newSummaryTestRound(t)
+	buf, restore := captureInfoLog()
+	logRoundSummary("", roundInfo, realtimeTs)
+	disabled := buf.String()
+	logRoundSummary(RoundSummaryText, roundInfo, realtimeTs)
+	restore()
+
+	if strings.Contains(disabled, "Round 42 completed") {
+		t.Errorf("Summary logged while disabled: %s", disabled)
+	}
+
+	expected := "Round 42 completed with team [" + nodes[0].String() + ", " +
+		nodes[1].String() + "], batch size 32, precomputation 3s, " +
+		"realtime 1s, and 1 client errors"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Summary not logged.\n\texpected: %s\n\treceived: %s",
+			expected, buf.String())
+	}
+}
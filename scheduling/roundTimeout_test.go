@@ -0,0 +1,97 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"crypto/rand"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	mathRand "math/rand"
+	"testing"
+	"time"
+)
+
+// Tests that a round that does not transition out of precomputation is
+// signaled by waitForRoundTimeout() once the precomputation timeout of the
+// round has elapsed and is then failed by timeoutRound().
+func TestWaitForRoundTimeout(t *testing.T) {
+	testParams := Params{
+		TeamSize:              4,
+		BatchSize:             32,
+		Threshold:             1,
+		PrecomputationTimeout: 50,
+	}
+
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	testPool := NewWaitingPool()
+	for i := uint64(0); i < uint64(testParams.TeamSize); i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testPool.Add(testState.GetNodeMap().GetNode(nid))
+	}
+
+	roundID, err := testState.IncrementRoundID()
+	if err != nil {
+		t.Fatalf("IncrementRoundID() failed: %+v", err)
+	}
+	testProtoRound, err := createSecureRound(testParams, testPool,
+		int(testParams.TeamSize), roundID, testState,
+		mathRand.New(mathRand.NewSource(42)))
+	if err != nil {
+		t.Fatalf("Failed to create round: %+v", err)
+	}
+
+	testTracker := NewRoundTracker()
+	r, err := startRound(testProtoRound, testState, testTracker)
+	if err != nil {
+		t.Fatalf("Failed to start round: %+v", err)
+	}
+
+	timeoutChan := make(chan id.Round, 10)
+	go waitForRoundTimeout(timeoutChan, testState, r,
+		testProtoRound.PrecomputationTimeout, false)
+
+	select {
+	case timedOut := <-timeoutChan:
+		if timedOut != roundID {
+			t.Errorf("Wrong round timed out.\n\texpected: %d\n\treceived: %d",
+				roundID, timedOut)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Round %d was never signaled as timed out.", roundID)
+	}
+
+	err = timeoutRound(testState, roundID, testTracker)
+	if err != nil {
+		t.Fatalf("timeoutRound() returned an error: %+v", err)
+	}
+
+	if r.GetRoundState() != states.FAILED {
+		t.Errorf("Round not failed after timeout.\n\texpected: %s\n\treceived: %s",
+			states.FAILED, r.GetRoundState())
+	}
+	if testTracker.Len() != 0 {
+		t.Errorf("Round still active after timeout.")
+	}
+}
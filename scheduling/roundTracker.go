@@ -11,6 +11,7 @@ package scheduling
 
 import (
 	"gitlab.com/xx_network/primitives/id"
+	"sort"
 	"sync"
 )
 
@@ -56,8 +57,7 @@ func (rt *RoundTracker) RemoveActiveRound(rid id.Round) {
 	rt.mux.Unlock()
 }
 
-// GetActiveRounds gets the amount of active rounds in the set as well as the
-// round IDs.
+// GetActiveRounds returns the IDs of the rounds in the set in ascending order.
 func (rt *RoundTracker) GetActiveRounds() []id.Round {
 	var rounds []id.Round
 
@@ -69,5 +69,7 @@ func (rt *RoundTracker) GetActiveRounds() []id.Round {
 
 	rt.mux.Unlock()
 
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+
 	return rounds
 }
@@ -185,6 +185,22 @@ func TestRoundTracker_GetActiveRounds(t *testing.T) {
 
 }
 
+// Tests that GetActiveRounds() returns the rounds in ascending order regardless
+// of the order they were added in.
+func TestRoundTracker_GetActiveRounds_Sorted(t *testing.T) {
+	testRT := NewRoundTracker()
+	for _, rid := range []id.Round{42, 7, 1000, 8} {
+		testRT.AddActiveRound(rid)
+	}
+	testRT.RemoveActiveRound(1000)
+
+	expected := []id.Round{7, 8, 42}
+	if rounds := testRT.GetActiveRounds(); !reflect.DeepEqual(expected, rounds) {
+		t.Errorf("Unexpected active rounds.\n\texpected: %v\n\treceived: %v",
+			expected, rounds)
+	}
+}
+
 // Tests that GetActiveRounds() is thread safe.
 func TestRoundTracker_GetActiveRounds_Thread_Lock(t *testing.T) {
 	// Test values
@@ -36,6 +36,13 @@ const (
 	// how long a node needs to not act to be considered offline or in-active for the
 	// print. arbitrarily chosen.
 	timeToInactive = 3 * time.Minute
+
+	// how often the waiting pool is stored so it can be restored on restart
+	waitingPoolSaveInterval = 30 * time.Second
+
+	// how often the pool is checked for a team smaller than TeamSize when
+	// MinTeamSize is set
+	minTeamSizeCheckInterval = time.Second
 )
 
 type roundCreator func(params Params, pool *waitingPool, threshold int, roundID id.Round,
@@ -60,6 +67,26 @@ func ParseParams(serialParam []byte) *SafeParams {
 	if params.RealtimeTimeout == 0 {
 		params.RealtimeTimeout = 15000
 	}
+	// If smaller teams are enabled without a timeout, wait one minute for the
+	// pool to fill
+	if params.MinTeamSize > 0 && params.MinTeamSizeTimeout == 0 {
+		params.MinTeamSizeTimeout = 60000
+	}
+	if params.MinTeamSize > params.TeamSize {
+		jww.WARN.Printf("MinTeamSize %d is larger than TeamSize %d, smaller "+
+			"teams are disabled", params.MinTeamSize, params.TeamSize)
+		params.MinTeamSize = 0
+	}
+	if params.PoolMinimumSize != 0 && params.PoolMinimumSize < params.TeamSize {
+		jww.WARN.Printf("PoolMinimumSize %d is smaller than TeamSize %d, "+
+			"teams are formed once the pool reaches TeamSize",
+			params.PoolMinimumSize, params.TeamSize)
+		params.PoolMinimumSize = 0
+	}
+	if err = params.validateAffinityGroups(); err != nil {
+		jww.FATAL.Panicf("Scheduling Algorithm exited: Invalid affinity "+
+			"groups: %+v", err)
+	}
 
 	return params
 }
@@ -115,17 +142,30 @@ func UpdateParams(params *SafeParams, updateFreq time.Duration) {
 			continue
 		}
 
-		jww.INFO.Printf("Preparing to update scheduling params...")
-		params.Lock()
 		jww.INFO.Printf("Updating scheduling params: %+v, %s: %f", newParams, storage.PoolThreshold, threshold)
-		params.TeamSize = uint32(teamSize)
-		params.BatchSize = uint32(batchSize)
-		params.PrecomputationTimeout = time.Duration(precompTimeout)
-		params.RealtimeTimeout = time.Duration(realtimeTimeout)
-		params.MinimumDelay = time.Duration(minDelay)
-		params.RealtimeDelay = time.Duration(realtimeDelay)
-		params.Threshold = threshold
-		params.Unlock()
+		updated := params.SafeCopy()
+		updated.TeamSize = uint32(teamSize)
+		updated.BatchSize = uint32(batchSize)
+		updated.PrecomputationTimeout = time.Duration(precompTimeout)
+		updated.RealtimeTimeout = time.Duration(realtimeTimeout)
+		updated.MinimumDelay = time.Duration(minDelay)
+		updated.RealtimeDelay = time.Duration(realtimeDelay)
+		updated.Threshold = threshold
+
+		// The pool minimum size is optional; the current value is kept if it
+		// is not in the State table
+		poolMinimumSize, err := storage.PermissioningDb.GetStateInt(
+			storage.PoolMinimumSize)
+		if err == nil {
+			jww.INFO.Printf("Updating scheduling params: %s: %d",
+				storage.PoolMinimumSize, poolMinimumSize)
+			updated.PoolMinimumSize = uint32(poolMinimumSize)
+		}
+
+		err = params.Update(updated)
+		if err != nil {
+			jww.ERROR.Printf("%+v", err)
+		}
 
 		time.Sleep(updateFreq)
 	}
@@ -133,8 +173,10 @@ func UpdateParams(params *SafeParams, updateFreq time.Duration) {
 }
 
 // Scheduler is a utility function which builds a round by handling a node's
-// state changes then creating a team from the nodes in the pool
-func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan chan struct{}) error {
+// state changes then creating a team from the nodes in the pool. Active rounds
+// are tracked in the passed in RoundTracker.
+func Scheduler(params *SafeParams, state *storage.NetworkState,
+	roundTracker *RoundTracker, killchan chan chan struct{}) error {
 
 	rng := fastRNG.NewStreamGenerator(10000,
 		uint(runtime.NumCPU()), csprng.NewSystemRNG)
@@ -142,6 +184,76 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 	// Pool which tracks nodes which are not in a team
 	pool := NewWaitingPool()
 
+	// Seed the pool with nodes that were waiting before the last shutdown
+	restored, err := pool.Restore(state.GetNodeMap())
+	if err != nil {
+		jww.WARN.Printf("Unable to restore waiting pool: %+v", err)
+	} else {
+		jww.INFO.Printf("Restored %d nodes to the waiting pool", restored)
+	}
+
+	// Periodically store the pool so that it can be restored on restart
+	poolSaveQuit := make(chan struct{})
+	defer close(poolSaveQuit)
+	go func() {
+		ticker := time.NewTicker(waitingPoolSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-poolSaveQuit:
+				return
+			case <-ticker.C:
+				if err := pool.Save(); err != nil {
+					jww.ERROR.Printf("Unable to save waiting pool: %+v", err)
+				}
+			}
+		}
+	}()
+
+	// Periodically recompute node reputations from recent rounds so that team
+	// selection favors reliable nodes when ReputationWindow is set
+	reputationQuit := make(chan struct{})
+	defer close(reputationQuit)
+	go func() {
+		ticker := time.NewTicker(reputationRefreshInterval)
+		defer ticker.Stop()
+		for {
+			refreshReputations(pool,
+				params.SafeCopy().ReputationWindow*time.Millisecond)
+			select {
+			case <-reputationQuit:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Retry round metric inserts that failed, including those left over from
+	// before the last shutdown
+	err = roundMetrics.restore(params.RoundMetricQueuePath)
+	if err != nil {
+		jww.WARN.Printf("Unable to restore round metric queue: %+v", err)
+	} else if n := roundMetrics.Len(); n > 0 {
+		jww.INFO.Printf("Restored %d round metrics to retry", n)
+	}
+	roundMetricsQuit := make(chan struct{})
+	defer close(roundMetricsQuit)
+	go roundMetrics.run(roundMetricsQuit)
+
+	// Record node state transitions to storage in the background, writing
+	// any that are left once the Scheduler exits
+	transitionLog := newNodeTransitionLog(insertNodeStateTransition)
+	transitionLogQuit := make(chan struct{})
+	transitionLogDone := make(chan struct{})
+	go func() {
+		transitionLog.run(transitionLogQuit)
+		close(transitionLogDone)
+	}()
+	defer func() {
+		close(transitionLogQuit)
+		<-transitionLogDone
+	}()
+
 	// Channel to send new rounds over to be created
 	newRoundChan := make(chan protoRound, newRoundChanLen)
 
@@ -155,36 +267,26 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 	// Channel to communicate that a round has timed out
 	roundTimeoutTracker := make(chan id.Round, 1000)
 
-	roundTracker := NewRoundTracker()
-
-	//begin the thread that starts rounds
-	go func() {
-
-		lastRound := time.Now()
+	// Number of rounds sent to be started that are not yet in the round
+	// tracker, so that they count towards MaxActiveRounds
+	var pendingRounds int32
 
-		paramsCopy := params.SafeCopy()
-		minRoundDelay := (paramsCopy.MinimumDelay * time.Millisecond) / 3
-		var err error
-		for newRound := range newRoundChan {
+	// Signals that a round failed to start and its nodes were returned to the
+	// pool
+	roundReleased := make(chan struct{}, 1)
 
-			// To avoid back-to-back teaming, we make sure to sleep until the minimum delay
-			if timeDiff := time.Now().Sub(lastRound); timeDiff < minRoundDelay {
-				time.Sleep(minRoundDelay - timeDiff)
-			}
-			lastRound = time.Now()
-
-			ourRound, err := startRound(newRound, state, roundTracker)
-			if err != nil {
-				jww.FATAL.Panicf("Failed to start round %v: %+v", newRound.ID, err)
-			}
-
-			go waitForRoundTimeout(roundTimeoutTracker, state, ourRound,
-				paramsCopy.PrecomputationTimeout*time.Millisecond, false)
-		}
-
-		jww.FATAL.Panicf("Round creation thread should never exit: %v", err)
-
-	}()
+	//begin the thread that starts rounds
+	roundStarts := &roundStartThread{
+		start:         startRound,
+		state:         state,
+		pool:          pool,
+		roundTracker:  roundTracker,
+		roundTimeouts: roundTimeoutTracker,
+		pendingRounds: &pendingRounds,
+		released:      roundReleased,
+		lastRound:     time.Now(),
+	}
+	go roundStarts.run(newRoundChan)
 
 	var killed chan struct{}
 	iterationsCount := uint32(0)
@@ -196,23 +298,60 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 	}
 
 	paramsCopy := params.SafeCopy()
+	paramsUpdated := params.updatedChan()
+	pool.SetAffinityGroups(paramsCopy.AffinityGroups)
+	pool.SetOnePerShard(paramsCopy.OneNodePerShard)
+
+	// When smaller teams are enabled, regularly wake up to check whether the
+	// pool has waited long enough to form one
+	var minTeamSizeTicker *time.Ticker
+	var minTeamSizeCheck <-chan time.Time
+	startMinTeamSizeCheck := func() {
+		if paramsCopy.MinTeamSize > 0 && minTeamSizeTicker == nil {
+			minTeamSizeTicker = time.NewTicker(minTeamSizeCheckInterval)
+			minTeamSizeCheck = minTeamSizeTicker.C
+		}
+	}
+	startMinTeamSizeCheck()
+	defer func() {
+		if minTeamSizeTicker != nil {
+			minTeamSizeTicker.Stop()
+		}
+	}()
+
+	// Time since the pool has held at least MinTeamSize nodes without
+	// reaching TeamSize; zero when it has not
+	var partialPoolSince time.Time
+
+	// Fires when the next node in the pool leaves its error cooldown
+	var cooldownCheck <-chan time.Time
+	var cooldownEnd time.Time
 
 	sc := &stateChanger{
-		lastRealtime:     time.Unix(0, 0),
-		realtimeDelay:    paramsCopy.RealtimeDelay * time.Millisecond,
-		realtimeDelta:    paramsCopy.MinimumDelay * time.Millisecond,
-		realtimeTimeout:  paramsCopy.RealtimeTimeout * time.Millisecond,
-		pool:             pool,
-		state:            state,
-		roundTracker:     roundTracker,
-		roundTimeoutChan: roundTimeoutTracker,
+		lastRealtime:         time.Unix(0, 0),
+		realtimeDelay:        paramsCopy.RealtimeDelay * time.Millisecond,
+		realtimeDelayPerNode: paramsCopy.RealtimeDelayPerNode * time.Millisecond,
+		realtimeDelta:        paramsCopy.MinimumDelay * time.Millisecond,
+		realtimeTimeout:      paramsCopy.RealtimeTimeout * time.Millisecond,
+		nodeErrorCooldown:    paramsCopy.NodeErrorCooldown * time.Millisecond,
+		pool:                 pool,
+		state:                state,
+		roundTracker:         roundTracker,
+		roundTimeoutChan:     roundTimeoutTracker,
+		roundTimings:         make(map[id.Round]roundTiming),
+		transitionLog:        transitionLog,
+
+		roundlessErrorLimit:    paramsCopy.RoundlessErrorLimit,
+		roundlessErrorCooldown: paramsCopy.RoundlessErrorCooldown * time.Millisecond,
+		roundSummaryFormat:     paramsCopy.RoundSummaryFormat,
 	}
 
 	jww.INFO.Printf("Initialized state changer with: "+
 		"\n\t realtimeDelay: %s, "+
+		"\n\t realtimeDelayPerNode: %s, "+
 		"\n\t realtimeDelta: %s"+
 		"\n\t realtimeTimeout: %s", sc.realtimeDelay,
-		sc.realtimeDelta, sc.realtimeTimeout)
+		sc.realtimeDelayPerNode, sc.realtimeDelta, sc.realtimeTimeout)
 
 	// Start receiving updates from nodes
 	for {
@@ -233,6 +372,46 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 		// Receive a signal indicating that a round has timed out
 		case timedOutRoundID = <-roundTimeoutTracker:
 			isRoundTimeout = true
+		// Check whether a smaller team can be formed
+		case <-minTeamSizeCheck:
+		// Reconsider the pool when the nodes of a round that failed to start
+		// are returned to it
+		case <-roundReleased:
+		// Reconsider the pool when a node leaves its error cooldown
+		case <-cooldownCheck:
+			cooldownCheck, cooldownEnd = nil, time.Time{}
+		// Reconsider the pool when the network is drained or resumed
+		case <-state.GetDrainChangeChannel():
+			if state.IsDraining() {
+				jww.WARN.Printf("Network is draining, no new rounds will be " +
+					"scheduled")
+			} else {
+				jww.INFO.Printf("Network has resumed scheduling rounds")
+			}
+		// Reconsider the pool when the scheduler lease is acquired or lost
+		case <-state.GetSchedulerLeaseChangeChannel():
+			if !state.HoldsSchedulerLease() {
+				jww.WARN.Printf("Scheduler lease is held by another server, " +
+					"no new rounds will be scheduled")
+			} else {
+				jww.INFO.Printf("Scheduler lease acquired, scheduling rounds")
+			}
+		// Apply updated params to rounds created from now on
+		case <-paramsUpdated:
+			paramsCopy = params.SafeCopy()
+			sc.realtimeDelay = paramsCopy.RealtimeDelay * time.Millisecond
+			sc.realtimeDelayPerNode = paramsCopy.RealtimeDelayPerNode * time.Millisecond
+			sc.realtimeDelta = paramsCopy.MinimumDelay * time.Millisecond
+			sc.realtimeTimeout = paramsCopy.RealtimeTimeout * time.Millisecond
+			sc.nodeErrorCooldown = paramsCopy.NodeErrorCooldown * time.Millisecond
+			sc.roundlessErrorLimit = paramsCopy.RoundlessErrorLimit
+			sc.roundlessErrorCooldown = paramsCopy.RoundlessErrorCooldown * time.Millisecond
+			sc.roundSummaryFormat = paramsCopy.RoundSummaryFormat
+			pool.SetAffinityGroups(paramsCopy.AffinityGroups)
+			pool.SetOnePerShard(paramsCopy.OneNodePerShard)
+			startMinTeamSizeCheck()
+			jww.INFO.Printf("Applying updated scheduling params: %+v",
+				paramsCopy)
 		}
 
 		atomic.AddUint32(&iterationsCount, 1)
@@ -242,6 +421,7 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 			if err != nil {
 				return err
 			}
+			delete(sc.roundTimings, timedOutRoundID)
 		} else if hasUpdate {
 			var err error
 
@@ -254,14 +434,40 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 
 		for {
 			//get the pool of disabled nodes and determine how many
-			//nodes can be scheduled
-			numNodesInPool := pool.Len()
+			//nodes can be scheduled, excluding nodes in an error cooldown and
+			//nodes waiting on the rest of their affinity group
+			numNodesInPool := pool.AvailableLen()
+
+			// Track how long the pool has been waiting to fill
+			if numNodesInPool >= paramsCopy.fullPoolSize() ||
+				numNodesInPool < int(paramsCopy.MinTeamSize) {
+				partialPoolSince = time.Time{}
+			} else if partialPoolSince.IsZero() {
+				partialPoolSince = time.Now()
+			}
+			var waited time.Duration
+			if !partialPoolSince.IsZero() {
+				waited = time.Since(partialPoolSince)
+			}
 
-			// Create a new round if the pool is full
+			// Pause forming rounds while the maximum number are in progress;
+			// forming resumes once a round completes or fails
+			activeRounds := roundTracker.Len() +
+				int(atomic.LoadInt32(&pendingRounds))
+			atMaxActiveRounds := paramsCopy.MaxActiveRounds > 0 &&
+				activeRounds >= int(paramsCopy.MaxActiveRounds)
+
+			// Create a new round if the pool is full or has waited long
+			// enough to form a smaller team, unless the network is draining,
+			// the maximum number of rounds are in progress, or another server
+			// holds the scheduler lease. Affinity groups may prevent the pool
+			// from filling a team exactly.
 			var teamFormationThreshold int
-			teamSize := int(paramsCopy.TeamSize)
+			teamSize := teamSizeToForm(paramsCopy, numNodesInPool, waited)
 			teamFormationThreshold = int(paramsCopy.Threshold * float64(state.CountActiveNodes()))
-			if numNodesInPool >= teamFormationThreshold && numNodesInPool >= teamSize && killed == nil {
+			if numNodesInPool >= teamFormationThreshold && teamSize > 0 &&
+				killed == nil && !state.IsDraining() && !atMaxActiveRounds &&
+				state.HoldsSchedulerLease() && pool.CanPick(teamSize) {
 
 				// Increment round ID
 				currentID, err := state.IncrementRoundID()
@@ -270,24 +476,45 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 					return err
 				}
 
+				roundParams := paramsCopy
+				if teamSize < int(paramsCopy.TeamSize) {
+					jww.INFO.Printf("Pool did not reach team size %d within %s, "+
+						"forming round %d with %d nodes", paramsCopy.TeamSize,
+						waited, currentID, teamSize)
+					roundParams.TeamSize = uint32(teamSize)
+				}
+
 				stream := rng.GetStream()
-				newRound, err := createRound(paramsCopy, pool, teamFormationThreshold, currentID, state, stream)
+				newRound, err := createRound(roundParams, pool, teamFormationThreshold, currentID, state, stream)
 				stream.Close()
 				if err != nil {
 					return err
 				}
+				partialPoolSince = time.Time{}
+				sc.setRoundTiming(newRound)
 				// Send the round to the new round channel to be created
+				atomic.AddInt32(&pendingRounds, 1)
 				newRoundChan <- newRound
 			} else {
 				break
 			}
 		}
 
+		// Wake up when the next node in the pool leaves its error cooldown
+		if next := pool.NextCooldownEnd(); next.IsZero() {
+			cooldownCheck, cooldownEnd = nil, time.Time{}
+		} else if !next.Equal(cooldownEnd) {
+			cooldownCheck, cooldownEnd = time.After(time.Until(next)), next
+		}
+
 		// If the Scheduler is to be killed and no rounds are in progress,
 		// kill the Scheduler
 		if killed != nil && roundTracker.Len() == 0 {
 			// Stop round creation
 			close(newRoundChan)
+			if err := pool.Save(); err != nil {
+				jww.ERROR.Printf("Unable to save waiting pool: %+v", err)
+			}
 			jww.WARN.Printf("Scheduler is exiting due to kill signal")
 			killed <- struct{}{}
 			return nil
@@ -297,6 +524,30 @@ func Scheduler(params *SafeParams, state *storage.NetworkState, killchan chan ch
 	return errors.New("single Scheduler should never exit")
 }
 
+// teamSizeToForm returns the number of nodes to form a team with from a pool
+// of numNodesInPool nodes, or 0 if no team should be formed yet. A full team is
+// formed as soon as the pool reaches TeamSize, or PoolMinimumSize if it is
+// larger. If MinTeamSize is set and the pool has held at least MinTeamSize
+// nodes for MinTeamSizeTimeout without filling, a team of the entire pool, up
+// to TeamSize, is formed instead.
+func teamSizeToForm(params Params, numNodesInPool int, waited time.Duration) int {
+	teamSize := int(params.TeamSize)
+	if numNodesInPool >= params.fullPoolSize() {
+		return teamSize
+	}
+
+	minTeamSize := int(params.MinTeamSize)
+	if minTeamSize == 0 || numNodesInPool < minTeamSize ||
+		waited < params.MinTeamSizeTimeout*time.Millisecond {
+		return 0
+	}
+
+	if numNodesInPool > teamSize {
+		return teamSize
+	}
+	return numNodesInPool
+}
+
 // Helper function which handles when we receive a timed out round
 func timeoutRound(state *storage.NetworkState, timeoutRoundID id.Round,
 	roundTracker *RoundTracker) error {
@@ -335,7 +586,8 @@ func timeoutRound(state *storage.NetworkState, timeoutRoundID id.Round,
 				ourRound.GetRoundID(), err)
 		}
 
-		err = killRound(state, ourRound, timeoutError, roundTracker)
+		err = killRound(state, ourRound, timeoutError, storage.TimeoutError,
+			roundTracker)
 		if err != nil {
 			return errors.WithMessagef(err, "Failed to kill round %d: %s",
 				ourRound.GetRoundID(), err)
@@ -0,0 +1,470 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package scheduling
+
+import (
+	"crypto/rand"
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	mathRand "math/rand"
+	"testing"
+	"time"
+)
+
+// Tests that ParseParams() defaults the MinTeamSizeTimeout when MinTeamSize is
+// set and disables smaller teams when MinTeamSize is larger than TeamSize.
+func TestParseParams_MinTeamSize(t *testing.T) {
+	params := ParseParams([]byte(`{"TeamSize": 5, "MinTeamSize": 3}`))
+	if params.MinTeamSize != 3 || params.MinTeamSizeTimeout != 60000 {
+		t.Errorf("Unexpected min team size params."+
+			"\n\texpected: %d, %d\n\treceived: %d, %d",
+			3, 60000, params.MinTeamSize, params.MinTeamSizeTimeout)
+	}
+
+	params = ParseParams([]byte(`{"TeamSize": 5, "MinTeamSize": 6}`))
+	if params.MinTeamSize != 0 {
+		t.Errorf("MinTeamSize larger than TeamSize not disabled."+
+			"\n\texpected: %d\n\treceived: %d", 0, params.MinTeamSize)
+	}
+
+	params = ParseParams([]byte(`{"TeamSize": 5}`))
+	if params.MinTeamSize != 0 || params.MinTeamSizeTimeout != 0 {
+		t.Errorf("Smaller teams enabled when MinTeamSize is not set."+
+			"\n\texpected: %d, %d\n\treceived: %d, %d",
+			0, 0, params.MinTeamSize, params.MinTeamSizeTimeout)
+	}
+}
+
+// Tests that teamSizeToForm() forms full teams as soon as the pool fills and
+// only forms smaller teams once the pool has waited for MinTeamSizeTimeout.
+func TestTeamSizeToForm(t *testing.T) {
+	params := Params{
+		TeamSize:           5,
+		MinTeamSize:        3,
+		MinTeamSizeTimeout: 1000,
+	}
+	disabled := Params{TeamSize: 5}
+	buffered := Params{TeamSize: 3, PoolMinimumSize: 5}
+	bufferedMin := Params{
+		TeamSize:           3,
+		PoolMinimumSize:    5,
+		MinTeamSize:        2,
+		MinTeamSizeTimeout: 1000,
+	}
+
+	tests := []struct {
+		params   Params
+		pool     int
+		waited   time.Duration
+		expected int
+	}{
+		{params, 5, 0, 5},
+		{params, 7, 0, 5},
+		{params, 4, 0, 0},
+		{params, 4, 999 * time.Millisecond, 0},
+		{params, 4, time.Second, 4},
+		{params, 3, time.Second, 3},
+		{params, 2, time.Hour, 0},
+		{disabled, 5, 0, 5},
+		{disabled, 4, time.Hour, 0},
+		{buffered, 3, 0, 0},
+		{buffered, 4, time.Hour, 0},
+		{buffered, 5, 0, 3},
+		{bufferedMin, 4, 0, 0},
+		{bufferedMin, 4, time.Second, 3},
+		{bufferedMin, 2, time.Second, 2},
+	}
+
+	for i, tt := range tests {
+		received := teamSizeToForm(tt.params, tt.pool, tt.waited)
+		if received != tt.expected {
+			t.Errorf("Unexpected team size for pool of %d after %s (%d)."+
+				"\n\texpected: %d\n\treceived: %d",
+				tt.pool, tt.waited, i, tt.expected, received)
+		}
+	}
+}
+
+// Tests that a round can be created and started from a pool that never fills to
+// TeamSize once it has waited for MinTeamSizeTimeout.
+func TestScheduler_MinTeamSize_PoolNeverFills(t *testing.T) {
+	testParams := Params{
+		TeamSize:            8,
+		MinTeamSize:         3,
+		MinTeamSizeTimeout:  10,
+		BatchSize:           32,
+		Threshold:           0.3,
+		NodeCleanUpInterval: 3,
+	}
+
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	// Only five of the eight nodes ever join the pool
+	testPool := NewWaitingPool()
+	for i := uint64(0); i < 5; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testPool.Add(testState.GetNodeMap().GetNode(nid))
+	}
+
+	teamSize := teamSizeToForm(testParams, testPool.Len(), 0)
+	if teamSize != 0 {
+		t.Errorf("Team formed before the pool waited for the timeout."+
+			"\n\texpected: %d\n\treceived: %d", 0, teamSize)
+	}
+
+	teamSize = teamSizeToForm(testParams, testPool.Len(),
+		testParams.MinTeamSizeTimeout*time.Millisecond)
+	if teamSize != testPool.Len() {
+		t.Fatalf("Unexpected team size after the timeout."+
+			"\n\texpected: %d\n\treceived: %d", testPool.Len(), teamSize)
+	}
+
+	roundID, err := testState.IncrementRoundID()
+	if err != nil {
+		t.Fatalf("IncrementRoundID() failed: %+v", err)
+	}
+
+	roundParams := testParams
+	roundParams.TeamSize = uint32(teamSize)
+	prng := mathRand.New(mathRand.NewSource(42))
+	testProtoRound, err := createSecureRound(roundParams, testPool,
+		int(testParams.Threshold*float64(testPool.Len())), roundID, testState, prng)
+	if err != nil {
+		t.Fatalf("Failed to create round with a smaller team: %+v", err)
+	}
+
+	if testProtoRound.Topology.Len() != teamSize ||
+		len(testProtoRound.NodeStateList) != teamSize {
+		t.Errorf("Unexpected team size of created round."+
+			"\n\texpected: %d\n\treceived: %d topology, %d node states",
+			teamSize, testProtoRound.Topology.Len(),
+			len(testProtoRound.NodeStateList))
+	}
+	if testPool.Len() != 0 {
+		t.Errorf("Nodes left in the pool after teaming."+
+			"\n\texpected: %d\n\treceived: %d", 0, testPool.Len())
+	}
+
+	r, err := startRound(testProtoRound, testState, NewRoundTracker())
+	if err != nil {
+		t.Fatalf("Failed to start round with a smaller team: %+v", err)
+	}
+
+	if len(r.BuildRoundInfo().Topology) != teamSize {
+		t.Errorf("Unexpected topology length of started round."+
+			"\n\texpected: %d\n\treceived: %d",
+			teamSize, len(r.BuildRoundInfo().Topology))
+	}
+}
+
+// Tests that the Scheduler does not form rounds from a full pool while the
+// network is draining and forms one once it resumes.
+func TestScheduler_Drain(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+	testState.Drain()
+
+	params := ParseParams([]byte(`{"TeamSize": 3, "BatchSize": 32, ` +
+		`"Threshold": 0.3, "PrecomputationTimeout": 3600000}`))
+	tracker := NewRoundTracker()
+	go func() {
+		err := Scheduler(params, testState, tracker, make(chan chan struct{}))
+		t.Errorf("Scheduler exited: %+v", err)
+	}()
+
+	// Fill the pool with enough nodes for a round
+	for i := uint64(0); i < 3; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+		err = testState.SendUpdateNotification(node.UpdateNotification{
+			Node:         nid,
+			FromActivity: current.NOT_STARTED,
+			ToActivity:   current.WAITING,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send update: %+v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if tracker.Len() != 0 {
+		t.Errorf("Round formed while the network is draining: %v",
+			tracker.GetActiveRounds())
+	}
+
+	testState.Resume()
+	timeout := time.After(time.Second)
+	for tracker.Len() != 1 {
+		select {
+		case <-timeout:
+			t.Fatalf("No round formed after the network resumed.")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Tests that of two servers sharing a database, the Scheduler of the one
+// without the scheduler lease does not form rounds from a full pool and forms
+// one once it acquires the lease.
+func TestScheduler_SchedulerLease(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	leaderState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create leader state: %v", err)
+	}
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+	leaderState.SetSchedulerLeaseDuration(time.Minute)
+	testState.SetSchedulerLeaseDuration(time.Minute)
+	leaderState.SetSchedulerLeaseHolder("leader")
+	testState.SetSchedulerLeaseHolder("test")
+	if err = leaderState.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Failed to acquire scheduler lease: %+v", err)
+	}
+	if err = testState.AcquireSchedulerLease(); err == nil {
+		t.Fatalf("Acquired a scheduler lease held by another server.")
+	}
+
+	params := ParseParams([]byte(`{"TeamSize": 3, "BatchSize": 32, ` +
+		`"Threshold": 0.3, "PrecomputationTimeout": 3600000}`))
+	tracker := NewRoundTracker()
+	go func() {
+		err := Scheduler(params, testState, tracker, make(chan chan struct{}))
+		t.Errorf("Scheduler exited: %+v", err)
+	}()
+
+	// Fill the pool with enough nodes for a round
+	for i := uint64(0); i < 3; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+		err = testState.SendUpdateNotification(node.UpdateNotification{
+			Node:         nid,
+			FromActivity: current.NOT_STARTED,
+			ToActivity:   current.WAITING,
+		})
+		if err != nil {
+			t.Fatalf("Failed to send update: %+v", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if tracker.Len() != 0 {
+		t.Errorf("Round formed without the scheduler lease: %v",
+			tracker.GetActiveRounds())
+	}
+
+	if err = leaderState.ReleaseSchedulerLease(); err != nil {
+		t.Fatalf("Failed to release scheduler lease: %+v", err)
+	}
+	if err = testState.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Failed to acquire released scheduler lease: %+v", err)
+	}
+	timeout := time.After(time.Second)
+	for tracker.Len() != 1 {
+		select {
+		case <-timeout:
+			t.Fatalf("No round formed after the scheduler lease was acquired.")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Tests that the Scheduler does not form a round while the pool holds enough
+// nodes for a team but fewer than PoolMinimumSize, and forms one once the pool
+// reaches PoolMinimumSize.
+func TestScheduler_PoolMinimumSize(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	params := ParseParams([]byte(`{"TeamSize": 3, "PoolMinimumSize": 5, ` +
+		`"BatchSize": 32, "Threshold": 0.3, "PrecomputationTimeout": 3600000}`))
+	tracker := NewRoundTracker()
+	go func() {
+		err := Scheduler(params, testState, tracker, make(chan chan struct{}))
+		t.Errorf("Scheduler exited: %+v", err)
+	}()
+
+	// Adds the nodes to the pool
+	addNodes := func(first, last uint64) {
+		for i := first; i <= last; i++ {
+			nid := id.NewIdFromUInt(i, id.Node, t)
+			err := testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+			if err != nil {
+				t.Fatalf("Couldn't add node: %v", err)
+			}
+			testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+			err = testState.SendUpdateNotification(node.UpdateNotification{
+				Node:         nid,
+				FromActivity: current.NOT_STARTED,
+				ToActivity:   current.WAITING,
+			})
+			if err != nil {
+				t.Fatalf("Failed to send update: %+v", err)
+			}
+		}
+	}
+
+	// Enough nodes for a team, but below the pool minimum
+	addNodes(0, 3)
+	time.Sleep(100 * time.Millisecond)
+	if tracker.Len() != 0 {
+		t.Errorf("Round formed before the pool reached its minimum size: %v",
+			tracker.GetActiveRounds())
+	}
+
+	addNodes(4, 4)
+	timeout := time.After(time.Second)
+	for tracker.Len() != 1 {
+		select {
+		case <-timeout:
+			t.Fatalf("No round formed once the pool reached its minimum " +
+				"size.")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Tests that the Scheduler never has more than MaxActiveRounds rounds in
+// progress when the pool is filled repeatedly and that it forms new rounds as
+// rounds finish.
+func TestScheduler_MaxActiveRounds(t *testing.T) {
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	const teamSize, maxActiveRounds = 2, 2
+	params := ParseParams([]byte(`{"TeamSize": 2, "BatchSize": 32, ` +
+		`"Threshold": 0.3, "PrecomputationTimeout": 3600000, ` +
+		`"MaxActiveRounds": 2}`))
+	tracker := NewRoundTracker()
+	go func() {
+		err := Scheduler(params, testState, tracker, make(chan chan struct{}))
+		t.Errorf("Scheduler exited: %+v", err)
+	}()
+
+	// Adds enough nodes to the pool for the given number of rounds
+	nextNode := uint64(0)
+	fillPool := func(rounds int) {
+		for i := 0; i < rounds*teamSize; i++ {
+			nid := id.NewIdFromUInt(nextNode, id.Node, t)
+			nextNode++
+			err := testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+			if err != nil {
+				t.Fatalf("Couldn't add node: %v", err)
+			}
+			testState.GetNodeMap().GetNode(nid).GetPollingLock().Lock()
+			err = testState.SendUpdateNotification(node.UpdateNotification{
+				Node:         nid,
+				FromActivity: current.NOT_STARTED,
+				ToActivity:   current.WAITING,
+			})
+			if err != nil {
+				t.Fatalf("Failed to send update: %+v", err)
+			}
+		}
+	}
+
+	// Waits for the expected number of active rounds, failing if the maximum
+	// is ever exceeded
+	waitForActiveRounds := func(expected int) {
+		timeout := time.After(time.Second)
+		for tracker.Len() != expected {
+			if tracker.Len() > maxActiveRounds {
+				t.Fatalf("More than the maximum number of rounds are active."+
+					"\n\texpected: %d\n\treceived: %d", maxActiveRounds,
+					tracker.Len())
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("Unexpected number of active rounds."+
+					"\n\texpected: %d\n\treceived: %d", expected, tracker.Len())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+
+	// Fill the pool with enough nodes for more rounds than the maximum
+	fillPool(2 * maxActiveRounds)
+	waitForActiveRounds(maxActiveRounds)
+
+	for i := 0; i < 3; i++ {
+		// No more rounds form while the maximum are in progress
+		time.Sleep(50 * time.Millisecond)
+		if tracker.Len() != maxActiveRounds {
+			t.Fatalf("Unexpected number of active rounds at the maximum."+
+				"\n\texpected: %d\n\treceived: %d", maxActiveRounds,
+				tracker.Len())
+		}
+
+		// Finish a round and wake the Scheduler with another full team so
+		// that a waiting team replaces the finished round
+		tracker.RemoveActiveRound(tracker.GetActiveRounds()[0])
+		fillPool(1)
+		waitForActiveRounds(maxActiveRounds)
+	}
+}
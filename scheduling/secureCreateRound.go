@@ -8,6 +8,7 @@
 package scheduling
 
 import (
+	"bytes"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/registration/storage"
@@ -16,6 +17,7 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/region"
 	"io"
+	"sort"
 	"time"
 )
 
@@ -36,39 +38,100 @@ import (
 // We shall assume geographical distance causes latency in a naive
 //  manner, as delineated here:
 //  https://docs.google.com/document/d/1oyjIDlqC54u_eoFzQP9SVNU2IqjnQOjpUYd9aqbg5X0/edit#
+// If params.SequenceOrdering is set, the team is instead ordered by the nodes'
+// sequence strings.
 func createSecureRound(params Params, pool *waitingPool, threshold int, roundID id.Round,
 	state *storage.NetworkState, rng io.Reader) (protoRound, error) {
 
 	// Pick nodes from the pool
-	nodes, err := pool.PickNRandAtThreshold(threshold, int(params.TeamSize))
+	var nodes []*node.State
+	var err error
+	if params.GeoSpread {
+		nodes, err = pool.PickNRandAtThresholdWithSpread(threshold,
+			int(params.TeamSize), maxNodesPerBin(params))
+	} else {
+		nodes, err = pool.PickNRandAtThreshold(threshold, int(params.TeamSize))
+	}
 	if err != nil {
 		return protoRound{}, errors.Errorf("Failed to pick random node group: %v", err)
 	}
 
+	var team []*id.ID
+	if params.SequenceOrdering {
+		team = orderBySequence(nodes)
+	} else {
+		team, err = orderByLatency(nodes, rng)
+		if err != nil {
+			return protoRound{}, err
+		}
+	}
+
+	// Create proto-round object now that the team has been ordered
+	newRound := createProtoRound(params, state, team, roundID)
+
+	jww.TRACE.Printf("Built round %d", roundID)
+	return newRound, nil
+}
+
+// orderByLatency orders the nodes into the team with the lowest expected
+// latency between the geographic bins of consecutive nodes.
+func orderByLatency(nodes []*node.State, rng io.Reader) ([]*id.ID, error) {
 	jww.TRACE.Printf("Beginning permutations")
 	start := time.Now()
 
 	countries := make(map[id.ID]string)
 	nodeIds := make([]*id.ID, 0, len(nodes))
 	for _, n := range nodes {
-		countries[*n.GetID()] = n.GetOrdering()
+		countries[*n.GetID()] = n.GetSequence().Region
 		nodeIds = append(nodeIds, n.GetID())
 	}
 
 	optimalTeam, _, err := region.OrderNodeTeam(nodeIds, countries, region.GetCountryBins(),
 		region.CreateSetLatencyTableWeights(region.CreateLinkTable()), rng)
 	if err != nil {
-		return protoRound{}, errors.WithMessage(err,
+		return nil, errors.WithMessage(err,
 			"Failed to generate optimal ordering")
 	}
 
 	jww.DEBUG.Printf("Permuting and finding the best team took: %v", time.Now().Sub(start))
 
-	// Create proto-round object now that the optimal team has been found
-	newRound := createProtoRound(params, state, optimalTeam, roundID)
+	return optimalTeam, nil
+}
+
+// orderBySequence orders the nodes into a team sorted by their sequences:
+// lexically by region and shard, then numerically by index. Nodes with the same
+// sequence are sorted by ID so that the order does not depend on the order the
+// nodes were picked in.
+func orderBySequence(nodes []*node.State) []*id.ID {
+	sorted := make([]*node.State, len(nodes))
+	copy(sorted, nodes)
+	sequences := make(map[*node.State]node.Sequence, len(nodes))
+	for _, n := range nodes {
+		sequences[n] = n.GetSequence()
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		si, sj := sequences[sorted[i]], sequences[sorted[j]]
+		if si != sj {
+			return si.Less(sj)
+		}
+		return bytes.Compare(sorted[i].GetID().Bytes(), sorted[j].GetID().Bytes()) < 0
+	})
 
-	jww.TRACE.Printf("Built round %d", roundID)
-	return newRound, nil
+	team := make([]*id.ID, len(sorted))
+	for i, n := range sorted {
+		team[i] = n.GetID()
+	}
+	return team
+}
+
+// maxNodesPerBin returns the maximum number of nodes in a team that may be
+// from the same geographic bin. At least one node per bin is always allowed.
+func maxNodesPerBin(params Params) int {
+	maxPerBin := int(params.GeoSpreadMaxFraction * float64(params.TeamSize))
+	if maxPerBin < 1 {
+		return 1
+	}
+	return maxPerBin
 }
 
 // CreateProtoRound is a helper function which creates a protoround object
@@ -84,9 +147,14 @@ func createProtoRound(params Params, state *storage.NetworkState,
 	// Build the protoRound
 	newRound.Topology = connect.NewCircuit(bestOrder)
 	newRound.ID = roundID
-	newRound.BatchSize = params.BatchSize
+	newRound.BatchSize = params.batchSizeFor(uint32(len(bestOrder)))
 	newRound.NodeStateList = nodeStateList
 	newRound.ResourceQueueTimeout = params.ResourceQueueTimeout * time.Millisecond
+	newRound.PrecomputationTimeout = params.PrecomputationTimeout * time.Millisecond
+	newRound.MinimumDelay = params.MinimumDelay * time.Millisecond
+	newRound.RealtimeDelay = params.RealtimeDelay * time.Millisecond
+	newRound.RealtimeDelayPerNode = params.RealtimeDelayPerNode * time.Millisecond
+	newRound.RealtimeTimeout = params.RealtimeTimeout * time.Millisecond
 
 	return
 }
@@ -177,3 +177,178 @@ func TestCreateRound_Error_NotEnoughForThreshold(t *testing.T) {
 		" shouldn't be enough for threshold")
 
 }
+
+// Tests that when SequenceOrdering is set, the round's topology is ordered
+// lexically by the nodes' sequence strings regardless of the order the nodes
+// were added to the pool.
+func TestCreateRound_SequenceOrdering(t *testing.T) {
+	testParams := Params{
+		TeamSize:         5,
+		BatchSize:        32,
+		SequenceOrdering: true,
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	// Sequences of the nodes, in the order they are expected in the topology
+	sequences := []string{"AA", "AB", "B", "BA", "C"}
+	nodeIds := make([]*id.ID, len(sequences))
+	for i, sequence := range sequences {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = testState.GetNodeMap().AddNode(nodeIds[i], sequence, "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+	}
+
+	insertionOrders := [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 4, 0, 3, 1}}
+	for i, insertionOrder := range insertionOrders {
+		testPool := NewWaitingPool()
+		for _, j := range insertionOrder {
+			testPool.Add(testState.GetNodeMap().GetNode(nodeIds[j]))
+		}
+
+		prng := mathRand.New(mathRand.NewSource(int64(i)))
+		newRound, err := createSecureRound(testParams, testPool,
+			int(testParams.TeamSize), id.Round(i), testState, prng)
+		if err != nil {
+			t.Fatalf("Failed to create round %d: %+v", i, err)
+		}
+
+		for j, nid := range nodeIds {
+			if !newRound.Topology.GetNodeAtIndex(j).Cmp(nid) {
+				t.Errorf("Topology of round %d not in sequence order at "+
+					"index %d.\n\texpected: %s\n\treceived: %s", i, j, nid,
+					newRound.Topology.GetNodeAtIndex(j))
+			}
+		}
+	}
+}
+
+// Tests that rounds formed with teams of different sizes get the batch size
+// mapped to their team size and BatchSize when their team size is not mapped.
+func TestCreateRound_TeamBatchSizes(t *testing.T) {
+	params := ParseParams([]byte(`{"TeamSize": 5, "MinTeamSize": 3, ` +
+		`"BatchSize": 32, "TeamBatchSizes": {"3": 48, "5": 64}}`))
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	tests := []struct {
+		teamSize  uint32
+		batchSize uint32
+	}{{5, 64}, {4, 32}, {3, 48}}
+
+	nextNode := uint64(0)
+	for i, tt := range tests {
+		testPool := NewWaitingPool()
+		for j := uint32(0); j < tt.teamSize; j++ {
+			nid := id.NewIdFromUInt(nextNode, id.Node, t)
+			nextNode++
+			err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+			if err != nil {
+				t.Fatalf("Couldn't add node: %v", err)
+			}
+			testPool.Add(testState.GetNodeMap().GetNode(nid))
+		}
+
+		roundParams := params.SafeCopy()
+		roundParams.TeamSize = tt.teamSize
+		prng := mathRand.New(mathRand.NewSource(int64(i)))
+		newRound, err := createSecureRound(roundParams, testPool, 0,
+			id.Round(i), testState, prng)
+		if err != nil {
+			t.Fatalf("Failed to create round with team size %d: %+v",
+				tt.teamSize, err)
+		}
+
+		if newRound.BatchSize != tt.batchSize {
+			t.Errorf("Unexpected batch size for team size %d."+
+				"\n\texpected: %d\n\treceived: %d", tt.teamSize,
+				tt.batchSize, newRound.BatchSize)
+		}
+	}
+}
+
+// Tests that orderBySequence() orders nodes with the same sequence by ID.
+func TestOrderBySequence_SameSequence(t *testing.T) {
+	nodeMap := node.NewStateMap()
+	var nodes []*node.State
+	for i := uint64(3); i > 0; i-- {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err := nodeMap.AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		nodes = append(nodes, nodeMap.GetNode(nid))
+	}
+
+	team := orderBySequence(nodes)
+	for i, nid := range team {
+		expected := id.NewIdFromUInt(uint64(i+1), id.Node, t)
+		if !nid.Cmp(expected) {
+			t.Errorf("Node %d not ordered by ID."+
+				"\n\texpected: %s\n\treceived: %s", i, expected, nid)
+		}
+	}
+}
+
+// Tests that when OneNodePerShard and SequenceOrdering are set, the round's
+// team has one node of each shard and is ordered by region, shard, and then
+// numerically by index.
+func TestCreateRound_OneNodePerShard(t *testing.T) {
+	testParams := Params{
+		TeamSize:         3,
+		BatchSize:        32,
+		SequenceOrdering: true,
+		OneNodePerShard:  true,
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %v", err)
+	}
+
+	sequences := []string{"US/a/10", "US/a/2", "DE/a/3", "DE/a/20", "US/b/1"}
+	testPool := NewWaitingPool()
+	testPool.SetOnePerShard(testParams.OneNodePerShard)
+	for i, sequence := range sequences {
+		nid := id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, sequence, "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %v", err)
+		}
+		testPool.Add(testState.GetNodeMap().GetNode(nid))
+	}
+
+	newRound, err := createSecureRound(testParams, testPool,
+		int(testParams.TeamSize), 1, testState, mathRand.New(
+			mathRand.NewSource(42)))
+	if err != nil {
+		t.Fatalf("Failed to create round: %+v", err)
+	}
+
+	expectedShards := []string{"DE/a", "US/a", "US/b"}
+	var previous node.Sequence
+	for i, expected := range expectedShards {
+		n := testState.GetNodeMap().GetNode(newRound.Topology.GetNodeAtIndex(i))
+		sequence := n.GetSequence()
+		if sequence.ShardKey() != expected {
+			t.Errorf("Unexpected shard at index %d.\n\texpected: %s"+
+				"\n\treceived: %s", i, expected, sequence.ShardKey())
+		}
+		if i > 0 && !previous.Less(sequence) {
+			t.Errorf("Sequence %s at index %d not ordered after %s.",
+				sequence, i, previous)
+		}
+		previous = sequence
+	}
+}
@@ -12,9 +12,14 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/jwalterweatherman"
 	jww "github.com/spf13/jwalterweatherman"
+	pb "gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/primitives/states"
 	"gitlab.com/elixxir/registration/storage"
 	"gitlab.com/elixxir/registration/storage/round"
+	"gitlab.com/xx_network/comms/signature"
+	"gitlab.com/xx_network/primitives/id"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
@@ -66,3 +71,137 @@ func startRound(round protoRound, state *storage.NetworkState, roundTracker *Rou
 
 	return r, nil
 }
+
+// roundStarter starts a round formed by the Scheduler.
+type roundStarter func(round protoRound, state *storage.NetworkState,
+	roundTracker *RoundTracker) (*round.State, error)
+
+// roundStartThread starts the rounds formed by the Scheduler in the order they
+// are formed. A round that fails to start, including by panicking, is released
+// so that its nodes can be scheduled again and the next round is started as
+// usual.
+type roundStartThread struct {
+	start        roundStarter
+	state        *storage.NetworkState
+	pool         *waitingPool
+	roundTracker *RoundTracker
+
+	// Channel the started rounds are tracked for timeouts on
+	roundTimeouts chan id.Round
+
+	// Number of rounds formed by the Scheduler that are not yet started
+	pendingRounds *int32
+
+	// Signals the Scheduler to reconsider the pool once a round is released
+	released chan struct{}
+
+	lastRound time.Time
+}
+
+// run starts the rounds sent over newRoundChan until it is closed. If starting
+// a round panics, the panic is logged with the round and the thread restarts
+// with the next round instead of halting scheduling for the network.
+func (t *roundStartThread) run(newRoundChan <-chan protoRound) {
+	for !t.startRounds(newRoundChan) {
+		jww.WARN.Printf("Restarting round creation thread")
+	}
+	jww.INFO.Printf("Round creation thread stopped")
+}
+
+// startRounds starts the rounds sent over newRoundChan. Returns true once the
+// channel is closed and false if starting a round panicked.
+func (t *roundStartThread) startRounds(newRoundChan <-chan protoRound) (closed bool) {
+	var current *protoRound
+	defer func() {
+		if p := recover(); p != nil {
+			if current == nil {
+				jww.ERROR.Printf("Round creation thread panicked: %v\n%s",
+					p, debug.Stack())
+				return
+			}
+			nodes := make([]*id.ID, current.Topology.Len())
+			for i := range nodes {
+				nodes[i] = current.Topology.GetNodeAtIndex(i)
+			}
+			jww.ERROR.Printf("Round creation thread panicked while starting "+
+				"round %d with nodes %v: %v\n%s", current.ID, nodes, p,
+				debug.Stack())
+			t.release(*current, fmt.Sprintf("%v", p))
+		}
+	}()
+
+	for newRound := range newRoundChan {
+		current = nil
+
+		// To avoid back-to-back teaming, we make sure to sleep until the minimum delay
+		minRoundDelay := newRound.MinimumDelay / 3
+		if timeDiff := time.Now().Sub(t.lastRound); timeDiff < minRoundDelay {
+			time.Sleep(minRoundDelay - timeDiff)
+		}
+		t.lastRound = time.Now()
+
+		starting := newRound
+		current = &starting
+		ourRound, err := t.start(newRound, t.state, t.roundTracker)
+		if err != nil {
+			jww.ERROR.Printf("Failed to start round %d: %+v", newRound.ID, err)
+			t.release(newRound, err.Error())
+			continue
+		}
+		atomic.AddInt32(t.pendingRounds, -1)
+
+		go waitForRoundTimeout(t.roundTimeouts, t.state, ourRound,
+			newRound.PrecomputationTimeout, false)
+	}
+
+	return true
+}
+
+// release undoes a round that failed to start. The round is failed and removed
+// from the round map and tracker, and its nodes that are not in another round
+// are returned to the pool so that they can be scheduled again.
+func (t *roundStartThread) release(newRound protoRound, reason string) {
+	atomic.AddInt32(t.pendingRounds, -1)
+	t.roundTracker.RemoveActiveRound(newRound.ID)
+
+	if r, exists := t.state.GetRoundMap().GetRound(newRound.ID); exists {
+		roundError := &pb.RoundError{
+			Id:     uint64(newRound.ID),
+			NodeId: id.Permissioning.Marshal(),
+			Error: fmt.Sprintf("Round %d killed because it failed to "+
+				"start: %s", newRound.ID, reason),
+		}
+		err := signature.SignRsa(roundError, t.state.GetPrivateKey())
+		if err != nil {
+			jww.ERROR.Printf("Failed to sign error message for round %d that "+
+				"failed to start: %+v", newRound.ID, err)
+		}
+		r.AppendError(roundError)
+
+		if err = r.Update(states.FAILED, time.Now()); err == nil {
+			err = t.state.AddRoundUpdate(r.BuildRoundInfo())
+			if err != nil {
+				jww.ERROR.Printf("Could not issue update to kill round %d "+
+					"that failed to start: %+v", newRound.ID, err)
+			}
+		}
+		t.state.GetRoundMap().DeleteRound(newRound.ID)
+	}
+
+	for _, n := range newRound.NodeStateList {
+		if hasRound, r := n.GetCurrentRound(); hasRound {
+			if r.GetRoundID() != newRound.ID {
+				continue
+			}
+			n.ClearRound()
+		}
+		t.pool.Add(n)
+	}
+	jww.WARN.Printf("Released round %d that failed to start, returning its "+
+		"nodes to the pool", newRound.ID)
+
+	select {
+	case t.released <- struct{}{}:
+	default:
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"gitlab.com/xx_network/primitives/region"
 	mathRand "math/rand"
 	"testing"
+	"time"
 )
 
 // Happy path
@@ -232,3 +233,127 @@ func TestStartRound_BadNode(t *testing.T) {
 	}
 
 }
+
+// Tests that when starting a round panics, roundStartThread releases the round
+// by returning its nodes to the pool and removing it from the round map and
+// tracker, then continues starting the rounds after it.
+func TestRoundStartThread_Panic(t *testing.T) {
+	testParams := Params{
+		TeamSize:  2,
+		BatchSize: 32,
+		Threshold: 0.3,
+	}
+
+	var err error
+	storage.PermissioningDb, _, err = storage.NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	testState, err := storage.NewState(privKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("Failed to create test state: %+v", err)
+	}
+
+	testPool := NewWaitingPool()
+	for i := uint64(0); i < 2*uint64(testParams.TeamSize); i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		err = testState.GetNodeMap().AddNode(nid, "US", "", "", 0)
+		if err != nil {
+			t.Fatalf("Couldn't add node: %+v", err)
+		}
+		testPool.Add(testState.GetNodeMap().GetNode(nid))
+	}
+
+	// Form two rounds, the first of which panics after it is started
+	prng := mathRand.New(mathRand.NewSource(42))
+	protoRounds := make([]protoRound, 2)
+	for i := range protoRounds {
+		roundID, err := testState.IncrementRoundID()
+		if err != nil {
+			t.Fatalf("IncrementRoundID() failed: %+v", err)
+		}
+		protoRounds[i], err = createSecureRound(testParams, testPool, 1,
+			roundID, testState, prng)
+		if err != nil {
+			t.Fatalf("Failed to create round %d: %+v", i, err)
+		}
+	}
+	panicRound := protoRounds[0].ID
+	start := func(r protoRound, state *storage.NetworkState,
+		roundTracker *RoundTracker) (*round.State, error) {
+		started, err := startRound(r, state, roundTracker)
+		if r.ID == panicRound {
+			panic("injected panic")
+		}
+		return started, err
+	}
+
+	pendingRounds := int32(len(protoRounds))
+	released := make(chan struct{}, 1)
+	testTracker := NewRoundTracker()
+	thread := &roundStartThread{
+		start:         start,
+		state:         testState,
+		pool:          testPool,
+		roundTracker:  testTracker,
+		roundTimeouts: make(chan id.Round, 10),
+		pendingRounds: &pendingRounds,
+		released:      released,
+	}
+
+	newRoundChan := make(chan protoRound, len(protoRounds))
+	done := make(chan struct{})
+	go func() {
+		thread.run(newRoundChan)
+		close(done)
+	}()
+	for _, r := range protoRounds {
+		newRoundChan <- r
+	}
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatalf("Round %d was not released after panicking.", panicRound)
+	}
+	timeout := time.After(time.Second)
+	for testTracker.Len() != 1 {
+		select {
+		case <-timeout:
+			t.Fatalf("Round after the panic was not started.")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	close(newRoundChan)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Round creation thread did not stop once the channel closed.")
+	}
+
+	if active := testTracker.GetActiveRounds(); active[0] != protoRounds[1].ID {
+		t.Errorf("Unexpected active round."+
+			"\n\texpected: %d\n\treceived: %d", protoRounds[1].ID, active[0])
+	}
+	if pendingRounds != 0 {
+		t.Errorf("Unexpected number of pending rounds."+
+			"\n\texpected: %d\n\treceived: %d", 0, pendingRounds)
+	}
+	if _, exists := testState.GetRoundMap().GetRound(panicRound); exists {
+		t.Errorf("Round %d that panicked is still in the round map.",
+			panicRound)
+	}
+	if testPool.Len() != int(testParams.TeamSize) {
+		t.Errorf("Nodes of the round that panicked not returned to the pool."+
+			"\n\texpected: %d\n\treceived: %d", testParams.TeamSize,
+			testPool.Len())
+	}
+	for _, n := range protoRounds[0].NodeStateList {
+		if hasRound, _ := n.GetCurrentRound(); hasRound {
+			t.Errorf("Node %s still has the round that panicked.", n.GetID())
+		}
+	}
+}
@@ -93,7 +93,9 @@ func NewDatabase(username, password, database, address,
 	// WARNING: Order is important. Do not change without Database testing
 	models := []interface{}{
 		&State{}, &Application{}, &Node{}, roundMetricTable, &Topology{}, &NodeMetric{},
-		&RoundError{}, EphemeralLength{}, ActiveNode{}, GeoBin{},
+		&RoundError{}, EphemeralLength{}, ActiveNode{}, GeoBin{}, &PollMetric{},
+		&NodeStateTransition{}, &NodeLatency{}, &DisabledNode{},
+		&RevokedCertificate{}, &AllowedNodeKey{},
 	}
 
 	for _, model := range models {
@@ -5,7 +5,7 @@
 // LICENSE file.                                                              //
 ////////////////////////////////////////////////////////////////////////////////
 
-// Handles the loading of disabled Nodes from a text file.
+// Handles the loading of disabled Nodes from a text file or the database.
 
 package storage
 
@@ -22,17 +22,26 @@ import (
 )
 
 // disabledNodes contains a set of Node states that should be disabled from
-// running rounds. It is updated in its own thread from a text file. The mutex
-// prevents updating the the list while it is being read.
+// running rounds. It is updated in its own thread from a text file or, if no
+// path is set, from the DisabledNode table in the database. The mutex prevents
+// updating the the list while it is being read.
 type disabledNodes struct {
 	nodes    []*id.ID      // List of disabled nodes
 	path     string        // Path to list of disabled Nodes
 	interval time.Duration // Interval between polls to update list
+
+	// Applies each list polled from the database, with the Nodes removed
+	// from the list since the last poll
+	dbUpdate DatabaseNodeDisabling
 	sync.RWMutex
 }
 
 type ImmediateNodeDisabling func([]*id.ID)
 
+// DatabaseNodeDisabling applies a disabled Node list polled from the database,
+// re-enabling the Nodes that were removed from it.
+type DatabaseNodeDisabling func(disabled, enabled []*id.ID)
+
 // generateDisabledNodes reads the file at the path and generates a new
 // disabledNodes with the contents. If the file cannot be read, than an error
 // is returned. If the file can be read but the IDs cannot be parsed, then a
@@ -64,6 +73,28 @@ func generateDisabledNodes(path string, interval time.Duration,
 	return dnl, nil
 }
 
+// generateDbDisabledNodes reads the disabled Node list from the DisabledNode
+// table and generates a new disabledNodes that polls the table for updates.
+// If the table cannot be read, then an error is returned.
+func generateDbDisabledNodes(interval time.Duration,
+	update DatabaseNodeDisabling) (*disabledNodes, error) {
+	nodes, err := getDbDisabledNodes()
+	if err != nil {
+		return nil, errors.Errorf("Skipping polling of disabled node list in "+
+			"the database; error while reading list: %v", err)
+	}
+
+	update(nodes, nil)
+
+	dnl := &disabledNodes{
+		nodes:    nodes,
+		interval: interval,
+		dbUpdate: update,
+	}
+
+	return dnl, nil
+}
+
 // pollDisabledNodes initialises a disabled Node list from the specified file
 // and starts a thread that updates the list from the file at the specified
 // interval. The provided channel allows for external killing of the routine.
@@ -78,6 +109,11 @@ func (dnl *disabledNodes) pollDisabledNodes(quitChan chan struct{}) {
 			jww.DEBUG.Printf("Killing disabled Nodes polling routine.")
 			return
 		case <-ticker.C:
+			if dnl.path == "" {
+				dnl.updateFromDb()
+				continue
+			}
+
 			// Get file contents and skip parsing contents on error
 			fileBytes, err := utils.ReadFile(dnl.path)
 			if err != nil {
@@ -100,6 +136,32 @@ func (dnl *disabledNodes) pollDisabledNodes(quitChan chan struct{}) {
 	}
 }
 
+// updateFromDb replaces the disabled Node list with the list in the database
+// and applies it, re-enabling the Nodes that are no longer listed. The list is
+// kept if the database cannot be read.
+func (dnl *disabledNodes) updateFromDb() {
+	nodes, err := getDbDisabledNodes()
+	if err != nil {
+		jww.WARN.Printf("Error while reading disabled Node list from the "+
+			"database: %v", err)
+		return
+	}
+
+	listed := make(map[id.ID]struct{}, len(nodes))
+	for _, nid := range nodes {
+		listed[*nid] = struct{}{}
+	}
+	var enabled []*id.ID
+	for _, nid := range dnl.getDisabledNodes() {
+		if _, exists := listed[*nid]; !exists {
+			enabled = append(enabled, nid)
+		}
+	}
+
+	dnl.updateDisabledNodes(nodes)
+	dnl.dbUpdate(nodes, enabled)
+}
+
 // updateDisabledNodes copies the values from the new Node set into the
 // disabled Node list. This function is thread safe.
 func (dnl *disabledNodes) updateDisabledNodes(newList []*id.ID) {
@@ -171,3 +233,25 @@ func getDisabledNodes(idList string) ([]*id.ID, error) {
 
 	return nodeList, combinedErrors
 }
+
+// getDbDisabledNodes returns the IDs of the Nodes in the DisabledNode table.
+// Entries with IDs that cannot be unmarshalled are skipped with a warning.
+func getDbDisabledNodes() ([]*id.ID, error) {
+	disabled, err := PermissioningDb.GetDisabledNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeList []*id.ID
+	for _, dn := range disabled {
+		nid, err := id.Unmarshal(dn.Id)
+		if err != nil {
+			jww.WARN.Printf("Failed to unmarshal disabled Node ID %v: %v",
+				dn.Id, err)
+			continue
+		}
+		nodeList = append(nodeList, nid)
+	}
+
+	return nodeList, nil
+}
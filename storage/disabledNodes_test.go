@@ -387,3 +387,71 @@ func generateIdLists(num int, x interface{}) (string, *node.StateMap, []*id.ID)
 
 	return fileData, stateMap, nodeList
 }
+
+// Tests that CreateDbDisabledNodes() disables the Nodes in the DisabledNode
+// table and that polling the table updates the prune list as Nodes are
+// inserted and deleted, without re-enabling Nodes pruned from the NDF.
+func TestNetworkState_CreateDbDisabledNodes(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	nodeIds := make([]*id.ID, 4)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+	}
+	for _, nid := range nodeIds[:2] {
+		if err = PermissioningDb.InsertDisabledNode(nid, time.Now()); err != nil {
+			t.Fatalf("Failed to insert disabled node: %+v", err)
+		}
+	}
+
+	interval := 20 * time.Millisecond
+	err = state.CreateDbDisabledNodes(interval)
+	if err != nil {
+		t.Fatalf("CreateDbDisabledNodes() returned an error: %+v", err)
+	}
+	expected := map[id.ID]bool{*nodeIds[0]: false, *nodeIds[1]: false}
+	if prune := state.GetPruneListSnapshot(); !reflect.DeepEqual(prune, expected) {
+		t.Errorf("Unexpected prune list after creation."+
+			"\n\texpected: %v\n\treceived: %v", expected, prune)
+	}
+
+	// A node pruned from the NDF stays pruned once it is no longer disabled
+	state.SetPrunedNode(nodeIds[1])
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go state.StartPollDisabledNodes(quit)
+
+	if err = PermissioningDb.DeleteDisabledNode(nodeIds[0]); err != nil {
+		t.Fatalf("Failed to delete disabled node: %+v", err)
+	}
+	if err = PermissioningDb.DeleteDisabledNode(nodeIds[1]); err != nil {
+		t.Fatalf("Failed to delete disabled node: %+v", err)
+	}
+	if err = PermissioningDb.InsertDisabledNode(nodeIds[2], time.Now()); err != nil {
+		t.Fatalf("Failed to insert disabled node: %+v", err)
+	}
+
+	expected = map[id.ID]bool{*nodeIds[1]: true, *nodeIds[2]: false}
+	timeout := time.After(time.Second)
+	for {
+		prune := state.GetPruneListSnapshot()
+		if reflect.DeepEqual(prune, expected) {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Prune list not updated after polling."+
+				"\n\texpected: %v\n\treceived: %v", expected, prune)
+		case <-time.After(interval):
+		}
+	}
+}
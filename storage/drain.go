@@ -0,0 +1,63 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles draining the network of rounds for maintenance
+
+package storage
+
+import (
+	"sync/atomic"
+)
+
+// drainState tracks whether the network is draining and signals the scheduler
+// when that changes.
+type drainState struct {
+	draining uint32
+	changed  chan struct{}
+}
+
+// Drain stops new rounds from being scheduled on the network. Rounds already
+// in progress run to completion. Returns false if the network was already
+// draining.
+func (s *NetworkState) Drain() bool {
+	if !atomic.CompareAndSwapUint32(&s.drain.draining, 0, 1) {
+		return false
+	}
+	s.signalDrainChange()
+	return true
+}
+
+// Resume allows new rounds to be scheduled on a draining network. Returns
+// false if the network was not draining.
+func (s *NetworkState) Resume() bool {
+	if !atomic.CompareAndSwapUint32(&s.drain.draining, 1, 0) {
+		return false
+	}
+	s.signalDrainChange()
+	return true
+}
+
+// IsDraining returns true if new rounds are not to be scheduled.
+func (s *NetworkState) IsDraining() bool {
+	return atomic.LoadUint32(&s.drain.draining) == 1
+}
+
+// GetDrainChangeChannel returns a channel that receives a signal when the
+// network is drained or resumed, so that the scheduler can reconsider the
+// nodes waiting to be scheduled.
+func (s *NetworkState) GetDrainChangeChannel() <-chan struct{} {
+	return s.drain.changed
+}
+
+// signalDrainChange signals the change without blocking; a pending signal
+// already covers it.
+func (s *NetworkState) signalDrainChange() {
+	select {
+	case s.drain.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,96 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles recording node update notifications dropped because the update
+// channel was full
+
+package storage
+
+import (
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"sync"
+	"time"
+)
+
+// maxDroppedUpdates is the number of the most recent dropped update
+// notifications that are kept.
+const maxDroppedUpdates = 1000
+
+// DroppedUpdate describes a node update notification that was dropped because
+// the update channel was full.
+type DroppedUpdate struct {
+	Node         *id.ID
+	FromStatus   node.Status
+	ToStatus     node.Status
+	FromActivity current.Activity
+	ToActivity   current.Activity
+
+	// Time the notification was dropped
+	Timestamp time.Time
+}
+
+// droppedUpdateLog keeps the most recent dropped update notifications and the
+// total number dropped, so that operators can detect backpressure on the
+// update channel.
+type droppedUpdateLog struct {
+	// Ring buffer of the most recent dropped notifications; next is the index
+	// the next one is written to
+	records []DroppedUpdate
+	next    int
+
+	count uint64
+	mux   sync.Mutex
+}
+
+// add records the dropped notification, overwriting the oldest record once
+// maxDroppedUpdates are kept.
+func (l *droppedUpdateLog) add(nun node.UpdateNotification, timestamp time.Time) {
+	record := DroppedUpdate{
+		Node:         nun.Node,
+		FromStatus:   nun.FromStatus,
+		ToStatus:     nun.ToStatus,
+		FromActivity: nun.FromActivity,
+		ToActivity:   nun.ToActivity,
+		Timestamp:    timestamp,
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.records) < maxDroppedUpdates {
+		l.records = append(l.records, record)
+	} else {
+		l.records[l.next] = record
+	}
+	l.next = (l.next + 1) % maxDroppedUpdates
+	l.count++
+}
+
+// GetDroppedUpdates returns the most recent node update notifications, up to
+// maxDroppedUpdates, that were dropped because the update channel was full,
+// oldest first.
+func (s *NetworkState) GetDroppedUpdates() []DroppedUpdate {
+	l := &s.droppedUpdates
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	dropped := make([]DroppedUpdate, 0, len(l.records))
+	if len(l.records) == maxDroppedUpdates {
+		dropped = append(dropped, l.records[l.next:]...)
+		return append(dropped, l.records[:l.next]...)
+	}
+	return append(dropped, l.records...)
+}
+
+// GetDroppedUpdateCount returns the total number of node update notifications
+// dropped because the update channel was full.
+func (s *NetworkState) GetDroppedUpdateCount() uint64 {
+	s.droppedUpdates.mux.Lock()
+	defer s.droppedUpdates.mux.Unlock()
+	return s.droppedUpdates.count
+}
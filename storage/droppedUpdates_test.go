@@ -0,0 +1,108 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"gitlab.com/elixxir/primitives/current"
+	"gitlab.com/elixxir/registration/storage/node"
+	"gitlab.com/xx_network/primitives/id"
+	"testing"
+	"time"
+)
+
+// Tests that SendUpdateNotification() records the notifications it drops once
+// the update channel is full.
+func TestNetworkState_SendUpdateNotification_RecordsDropped(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Fill the buffer
+	for i := 0; i < updateBufferLength; i++ {
+		err = state.SendUpdateNotification(node.UpdateNotification{
+			Node: id.NewIdFromUInt(uint64(i), id.Node, t)})
+		if err != nil {
+			t.Fatalf("Failed to send update notification %d: %+v", i, err)
+		}
+	}
+	if count := state.GetDroppedUpdateCount(); count != 0 {
+		t.Errorf("Notifications recorded as dropped before the channel is "+
+			"full.\n\texpected: %d\n\treceived: %d", 0, count)
+	}
+
+	sent := make([]node.UpdateNotification, 3)
+	for i := range sent {
+		sent[i] = node.UpdateNotification{
+			Node:         id.NewIdFromUInt(uint64(updateBufferLength+i), id.Node, t),
+			FromStatus:   node.Active,
+			ToStatus:     node.Active,
+			FromActivity: current.WAITING,
+			ToActivity:   current.PRECOMPUTING,
+		}
+		if err = state.SendUpdateNotification(sent[i]); err == nil {
+			t.Errorf("SendUpdateNotification() did not return an error for "+
+				"notification %d sent to a full channel.", i)
+		}
+	}
+
+	if count := state.GetDroppedUpdateCount(); count != uint64(len(sent)) {
+		t.Errorf("Unexpected dropped notification count."+
+			"\n\texpected: %d\n\treceived: %d", len(sent), count)
+	}
+	dropped := state.GetDroppedUpdates()
+	if len(dropped) != len(sent) {
+		t.Fatalf("Unexpected number of dropped notifications."+
+			"\n\texpected: %d\n\treceived: %d", len(sent), len(dropped))
+	}
+	for i, record := range dropped {
+		if !record.Node.Cmp(sent[i].Node) ||
+			record.FromActivity != sent[i].FromActivity ||
+			record.ToActivity != sent[i].ToActivity ||
+			record.ToStatus != sent[i].ToStatus || record.Timestamp.IsZero() {
+			t.Errorf("Unexpected dropped notification %d."+
+				"\n\texpected: %+v\n\treceived: %+v", i, sent[i], record)
+		}
+	}
+}
+
+// Tests that droppedUpdateLog only keeps the most recent maxDroppedUpdates
+// notifications, oldest first, while counting every dropped notification.
+func TestNetworkState_GetDroppedUpdates_Wraps(t *testing.T) {
+	state := &NetworkState{}
+	total := maxDroppedUpdates + 5
+	start := time.Now()
+	for i := 0; i < total; i++ {
+		state.droppedUpdates.add(node.UpdateNotification{
+			Node: id.NewIdFromUInt(uint64(i), id.Node, t)},
+			start.Add(time.Duration(i)*time.Second))
+	}
+
+	if count := state.GetDroppedUpdateCount(); count != uint64(total) {
+		t.Errorf("Unexpected dropped notification count."+
+			"\n\texpected: %d\n\treceived: %d", total, count)
+	}
+	dropped := state.GetDroppedUpdates()
+	if len(dropped) != maxDroppedUpdates {
+		t.Fatalf("Unexpected number of dropped notifications kept."+
+			"\n\texpected: %d\n\treceived: %d", maxDroppedUpdates, len(dropped))
+	}
+	for i, record := range dropped {
+		expected := id.NewIdFromUInt(uint64(total-maxDroppedUpdates+i),
+			id.Node, t)
+		if !record.Node.Cmp(expected) {
+			t.Errorf("Unexpected node of dropped notification %d."+
+				"\n\texpected: %s\n\treceived: %s", i, expected, record.Node)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Contains the EdDSA signed NDF message for lightweight clients
+
+package storage
+
+import (
+	"gitlab.com/xx_network/comms/messages"
+	"hash"
+)
+
+// EccSignedNdf is a marshalled NDF signed with the elliptic curve key, for
+// clients that verify the NDF with a smaller key than the RSA one. It conforms
+// to the generic EdDSA signing interface.
+type EccSignedNdf struct {
+	Ndf          []byte
+	EccSignature *messages.ECCSignature
+}
+
+// GetEccSig returns the EdDSA signature.
+// If none exists, it creates it, adds it to the object, then returns it.
+func (m *EccSignedNdf) GetEccSig() *messages.ECCSignature {
+	if m.EccSignature != nil {
+		return m.EccSignature
+	}
+
+	m.EccSignature = new(messages.ECCSignature)
+
+	return m.EccSignature
+}
+
+// Digest hashes the contents of the message in a repeatable manner using the
+// provided cryptographic hash. It includes the nonce in the hash. This matches
+// the digest of the RSA signed NDF message so that the same contents are
+// signed by both keys.
+func (m *EccSignedNdf) Digest(nonce []byte, h hash.Hash) []byte {
+	h.Reset()
+
+	// Hash the ndf and the nonce
+	h.Write(m.Ndf)
+	h.Write(nonce)
+
+	// Return the hash
+	return h.Sum(nil)
+}
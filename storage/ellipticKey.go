@@ -0,0 +1,49 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Contains the RSA signed elliptic curve public key served to clients
+
+package storage
+
+import (
+	"gitlab.com/xx_network/comms/messages"
+	"hash"
+)
+
+// SignedEllipticKey is the marshalled elliptic curve public key of the server
+// signed with its RSA key, so that clients can verify that the key used to sign
+// round updates belongs to the server. It conforms to the generic RSA signing
+// interface.
+type SignedEllipticKey struct {
+	EllipticPubKey []byte
+	Signature      *messages.RSASignature
+}
+
+// GetSig returns the RSA signature.
+// If none exists, it creates it, adds it to the object, then returns it.
+func (m *SignedEllipticKey) GetSig() *messages.RSASignature {
+	if m.Signature != nil {
+		return m.Signature
+	}
+
+	m.Signature = new(messages.RSASignature)
+
+	return m.Signature
+}
+
+// Digest hashes the contents of the message in a repeatable manner using the
+// provided cryptographic hash. It includes the nonce in the hash.
+func (m *SignedEllipticKey) Digest(nonce []byte, h hash.Hash) []byte {
+	h.Reset()
+
+	// Hash the key and the nonce
+	h.Write(m.EllipticPubKey)
+	h.Write(nonce)
+
+	// Return the hash
+	return h.Sum(nil)
+}
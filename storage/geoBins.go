@@ -0,0 +1,140 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles bulk importing geographic bins from a file
+
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/region"
+	"gitlab.com/xx_network/primitives/utils"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LoadGeoBins reads the country to bin pairs in the file at the path and
+// upserts them into Storage. Returns the number of bins stored.
+func (s *Storage) LoadGeoBins(path string) (int, error) {
+	bins, err := ReadGeoBinFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, bin := range bins {
+		err = s.UpsertGeoBin(bin)
+		if err != nil {
+			return 0, errors.Errorf("Failed to store bin %d for country %q: %+v",
+				bin.Bin, bin.Country, err)
+		}
+	}
+
+	return len(bins), nil
+}
+
+// ReadGeoBinFile reads country to bin pairs from a JSON or CSV file, chosen by
+// the file's extension. A JSON file holds a list of objects with Country and
+// Bin fields, e.g. [{"Country": "US", "Bin": 0}]. A CSV file holds one
+// country,bin pair per line, with an optional "country,bin" header. Each bin
+// must be a valid region.GeoBin. If a country appears more than once, the last
+// pair wins.
+func ReadGeoBinFile(path string) ([]*GeoBin, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("Failed to read geo bin file: %+v", err)
+	}
+
+	var bins []*GeoBin
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		bins, err = parseGeoBinJSON(data)
+	case ".csv":
+		bins, err = parseGeoBinCSV(data)
+	default:
+		return nil, errors.Errorf("Geo bin file %s must have a .json or .csv "+
+			"extension", path)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to parse geo bin file %s",
+			path)
+	}
+
+	return dedupeGeoBins(bins)
+}
+
+// parseGeoBinJSON parses a JSON list of GeoBin objects.
+func parseGeoBinJSON(data []byte) ([]*GeoBin, error) {
+	var bins []*GeoBin
+	err := json.Unmarshal(data, &bins)
+	if err != nil {
+		return nil, err
+	}
+	return bins, nil
+}
+
+// parseGeoBinCSV parses country,bin lines, skipping a header line if present.
+func parseGeoBinCSV(data []byte) ([]*GeoBin, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+
+	var bins []*GeoBin
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return bins, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "country") &&
+			strings.EqualFold(record[1], "bin") {
+			continue
+		}
+
+		bin, err := strconv.ParseUint(strings.TrimSpace(record[1]), 10, 8)
+		if err != nil {
+			return nil, errors.Errorf("Invalid bin %q for country %q on "+
+				"line %d: %+v", record[1], record[0], line, err)
+		}
+		bins = append(bins,
+			&GeoBin{Country: strings.TrimSpace(record[0]), Bin: uint8(bin)})
+	}
+}
+
+// dedupeGeoBins validates the bins and removes duplicate countries, keeping
+// the last bin given for each country in the position of its first one.
+func dedupeGeoBins(bins []*GeoBin) ([]*GeoBin, error) {
+	indexes := make(map[string]int, len(bins))
+	result := make([]*GeoBin, 0, len(bins))
+	for _, bin := range bins {
+		if bin.Country == "" {
+			return nil, errors.New("Geo bin file contains an empty country")
+		}
+		if region.GeoBin(bin.Bin) > region.Oceania {
+			return nil, errors.Errorf("Bin %d for country %q is out of range "+
+				"[0, %d]", bin.Bin, bin.Country, region.Oceania)
+		}
+
+		if i, exists := indexes[bin.Country]; exists {
+			jww.WARN.Printf("Country %q appears more than once in geo bin "+
+				"file, replacing bin %s with %s", bin.Country,
+				region.GeoBin(result[i].Bin), region.GeoBin(bin.Bin))
+			result[i] = bin
+			continue
+		}
+		indexes[bin.Country] = len(result)
+		result = append(result, bin)
+	}
+	return result, nil
+}
@@ -0,0 +1,152 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"gitlab.com/xx_network/primitives/region"
+	"gitlab.com/xx_network/primitives/utils"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeGeoBinFile writes the data to a file with the name in a temporary
+// directory and returns its path.
+func writeGeoBinFile(name, data string, t *testing.T) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := utils.WriteFile(path, []byte(data), utils.FilePerms, utils.DirPerms)
+	if err != nil {
+		t.Fatalf("Failed to write geo bin file: %+v", err)
+	}
+	return path
+}
+
+// Tests that ReadGeoBinFile() parses JSON and CSV files and that a country
+// listed twice takes the last bin.
+func TestReadGeoBinFile(t *testing.T) {
+	expected := []*GeoBin{
+		{Country: "US", Bin: uint8(region.NorthAmerica)},
+		{Country: "DE", Bin: uint8(region.CentralEurope)},
+		{Country: "AU", Bin: uint8(region.Oceania)},
+	}
+
+	files := map[string]string{
+		"bins.json": `[{"Country": "US", "Bin": 1}, {"Country": "DE", "Bin": 3},
+			{"Country": "AU", "Bin": 11}, {"Country": "US", "Bin": 0}]`,
+		"bins.csv": "country,bin\nUS,1\nDE, 3\nAU,11\nUS,0\n",
+		"BINS.CSV": "US,0\nDE,3\nAU,11\n",
+	}
+
+	for name, data := range files {
+		bins, err := ReadGeoBinFile(writeGeoBinFile(name, data, t))
+		if err != nil {
+			t.Errorf("Failed to read %s: %+v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(expected, bins) {
+			t.Errorf("Unexpected bins read from %s."+
+				"\n\texpected: %+v\n\treceived: %+v", name, expected, bins)
+		}
+	}
+}
+
+// Error path: Tests that ReadGeoBinFile() rejects invalid files.
+func TestReadGeoBinFile_Error(t *testing.T) {
+	files := map[string]string{
+		"outOfRange.json":  `[{"Country": "US", "Bin": 12}]`,
+		"outOfRange.csv":   "US,12\n",
+		"emptyCountry.csv": ",0\n",
+		"badBin.csv":       "US,NorthAmerica\n",
+		"extraField.csv":   "US,0,1\n",
+		"badJson.json":     `{"US": 0}`,
+		"bins.txt":         "US,0\n",
+	}
+
+	for name, data := range files {
+		_, err := ReadGeoBinFile(writeGeoBinFile(name, data, t))
+		if err == nil {
+			t.Errorf("Did not receive an error for %s.", name)
+		}
+	}
+
+	_, err := ReadGeoBinFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Errorf("Did not receive an error for a missing file.")
+	}
+}
+
+// Tests that Storage.LoadGeoBins() inserts new countries into the database and
+// updates the bins of existing ones.
+func TestStorage_LoadGeoBins(t *testing.T) {
+	s, _, err := NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	err = s.UpsertGeoBin(&GeoBin{Country: "US", Bin: uint8(region.Oceania)})
+	if err != nil {
+		t.Fatalf("Failed to upsert bin: %+v", err)
+	}
+
+	path := writeGeoBinFile("bins.csv", "US,0\nDE,3\n", t)
+	numBins, err := s.LoadGeoBins(path)
+	if err != nil {
+		t.Fatalf("LoadGeoBins() returned an error: %+v", err)
+	}
+	if numBins != 2 {
+		t.Errorf("Unexpected number of bins loaded."+
+			"\n\texpected: %d\n\treceived: %d", 2, numBins)
+	}
+
+	expected := map[string]region.GeoBin{
+		"US": region.NorthAmerica,
+		"DE": region.CentralEurope,
+	}
+	bins, err := s.GetBins()
+	if err != nil {
+		t.Fatalf("Failed to get bins: %+v", err)
+	}
+	if !reflect.DeepEqual(expected, bins) {
+		t.Errorf("Unexpected bins in storage."+
+			"\n\texpected: %v\n\treceived: %v", expected, bins)
+	}
+}
+
+// Tests that MapImpl.UpsertGeoBin() inserts new countries and updates the bins
+// of existing ones.
+func TestMapImpl_UpsertGeoBin(t *testing.T) {
+	m := &MapImpl{}
+
+	bins := []*GeoBin{
+		{Country: "US", Bin: uint8(region.Oceania)},
+		{Country: "DE", Bin: uint8(region.CentralEurope)},
+		{Country: "US", Bin: uint8(region.NorthAmerica)},
+	}
+	for _, bin := range bins {
+		if err := m.UpsertGeoBin(bin); err != nil {
+			t.Fatalf("UpsertGeoBin() returned an error: %+v", err)
+		}
+	}
+
+	expected := map[string]uint8{
+		"US": uint8(region.NorthAmerica),
+		"DE": uint8(region.CentralEurope),
+	}
+	received, err := m.getBins()
+	if err != nil {
+		t.Fatalf("Failed to get bins: %+v", err)
+	}
+	receivedMap := make(map[string]uint8, len(received))
+	for _, bin := range received {
+		receivedMap[bin.Country] = bin.Bin
+	}
+	if !reflect.DeepEqual(expected, receivedMap) {
+		t.Errorf("Unexpected bins in map."+
+			"\n\texpected: %v\n\treceived: %v", expected, receivedMap)
+	}
+}
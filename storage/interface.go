@@ -22,28 +22,60 @@ type database interface {
 	// Permissioning methods
 	UpsertState(state *State) error
 	GetStateValue(key string) (string, error)
+	SwapStateValue(key, oldValue, newValue string) (bool, error)
 	InsertNodeMetric(metric *NodeMetric) error
+	InsertPollMetric(metric *PollMetric) error
+	InsertNodeStateTransition(transition *NodeStateTransition) error
+	GetNodeStateTransitions(nodeId *id.ID) ([]*NodeStateTransition, error)
+	InsertNodeLatency(nodeId *id.ID, timestamp time.Time, samples []time.Duration) error
+	GetNodeLatencyPercentiles(start, end time.Time, percentiles []float64) (map[id.ID][]time.Duration, error)
 	InsertRoundMetric(metric *RoundMetric, topology [][]byte) error
-	InsertRoundError(roundId id.Round, errStr string) error
+	InsertRoundError(roundId id.Round, category RoundErrorCategory, errStr string) error
+	GetRoundErrors(roundId id.Round) ([]RoundError, error)
+	GetRoundErrorCounts(start, end time.Time) (map[RoundErrorCategory]uint64, error)
 	GetLatestEphemeralLength() (*EphemeralLength, error)
 	GetEphemeralLengths() ([]*EphemeralLength, error)
+	GetEphemeralLengthSchedule() ([]*EphemeralLength, error)
 	InsertEphemeralLength(length *EphemeralLength) error
+	GetActiveEphemeralLength(at time.Time) (*EphemeralLength, error)
+	GetNextEphemeralLength(at time.Time) (*EphemeralLength, error)
 	GetEarliestRound(cutoff time.Duration) (id.Round, time.Time, error)
+	GetRoundMetrics(start, end time.Time) ([]*RoundMetric, error)
+	GetNetworkTPS(start, end time.Time) (float64, error)
+	GetRoundMetricsByNode(id *id.ID, since time.Time) ([]*RoundMetric, error)
+	GetNodeRoundOutcomes(since time.Time) (map[id.ID]NodeRoundOutcomes, error)
 	getBins() ([]*GeoBin, error)
+	UpsertGeoBin(bin *GeoBin) error
+	InsertDisabledNode(id *id.ID, timestamp time.Time) error
+	DeleteDisabledNode(id *id.ID) error
+	GetDisabledNodes() ([]*DisabledNode, error)
+	InsertRevokedCertificate(cert *RevokedCertificate) error
+	GetRevokedCertificates() ([]*RevokedCertificate, error)
+	InsertAllowedNodeKey(fingerprint string, timestamp time.Time) error
+	DeleteAllowedNodeKey(fingerprint string) error
+	GetAllowedNodeKeys() ([]*AllowedNodeKey, error)
+	IsNodeKeyAllowed(fingerprint string) (bool, error)
 
 	// Node methods
 	InsertApplication(application *Application, unregisteredNode *Node) error
 	RegisterNode(id *id.ID, salt []byte, code, serverAddr, serverCert,
 		gatewayAddress, gatewayCert string) error
+	RegisterNodes(registrations []NodeRegistration) error
 	UpdateNodeAddresses(id *id.ID, nodeAddr, gwAddr string) error
 	UpdateNodeSequence(id *id.ID, sequence string) error
+	DecommissionNode(id *id.ID, timestamp time.Time) error
+	BanNode(id *id.ID, reason string, timestamp time.Time) error
+	GetApplication(appId uint64) (*Application, error)
+	GetNodeApplication(id *id.ID) (*Application, error)
 	UpdateGeoIP(appId uint64, location, geoBin, gpsLocation string) error
 	updateLastActive(ids [][]byte, lastActive time.Time) error
 	GetNode(code string) (*Node, error)
 	GetNodes() ([]*Node, error)
 	GetNodeById(id *id.ID) (*Node, error)
 	GetNodesByStatus(status node.Status) ([]*Node, error)
+	GetNodesInactiveSince(cutoff time.Time) ([]*Node, error)
 	GetActiveNodes() ([]*ActiveNode, error)
+	GetActiveNodeByWallet(wallet string) (*ActiveNode, error)
 }
 
 // Struct implementing the Database Interface with an underlying Map
@@ -52,11 +84,22 @@ type MapImpl struct {
 	applications      map[uint64]*Application
 	nodeMetrics       map[uint64]*NodeMetric
 	nodeMetricCounter uint64
+	pollMetrics       map[uint64]*PollMetric
+	pollMetricCounter uint64
+	transitions       map[uint64]*NodeStateTransition
+	transitionCounter uint64
+	latencySamples    map[uint64]*NodeLatency
+	latencyCounter    uint64
 	roundMetrics      map[uint64]*RoundMetric
+	roundErrors       map[uint64]*RoundError
+	roundErrorCounter uint64
 	states            map[string]string
 	ephemeralLengths  map[uint8]*EphemeralLength
 	activeNodes       map[id.ID]*ActiveNode
 	geographicBin     map[string]uint8
+	disabledNodes     map[id.ID]*DisabledNode
+	revokedCerts      map[string]*RevokedCertificate
+	allowedNodeKeys   map[string]*AllowedNodeKey
 	mut               sync.Mutex
 }
 
@@ -69,9 +112,11 @@ type State struct {
 // Enumerates Keys in the State table
 const (
 	// Used internally
-	UpdateIdKey = "UpdateId"
-	RoundIdKey  = "RoundId"
-	EllipticKey = "EllipticKey"
+	UpdateIdKey       = "UpdateId"
+	RoundIdKey        = "RoundId"
+	EllipticKey       = "EllipticKey"
+	WaitingPool       = "WaitingPool"
+	SchedulerLeaseKey = "SchedulerLease"
 
 	// Provided externally
 	PrecompTimeout       = "timeouts_precomputation"
@@ -81,6 +126,7 @@ const (
 	BatchSize            = "scheduling_batch_size"
 	MinDelay             = "scheduling_min_delay"
 	PoolThreshold        = "scheduling_pool_threshold"
+	PoolMinimumSize      = "scheduling_pool_minimum_size"
 
 	// TODO: Client reg repo?
 	MaxRegistrations   = "registration_max"
@@ -132,6 +178,34 @@ type GeoBin struct {
 	Bin     uint8  `gorm:"NOT NULL"`
 }
 
+// Struct representing the DisabledNode table in the Database
+type DisabledNode struct {
+	// ID of the Node excluded from running rounds
+	Id []byte `gorm:"primary_key"`
+	// Date/time that the Node was disabled
+	Timestamp time.Time `gorm:"NOT NULL"`
+}
+
+// Struct representing the AllowedNodeKey table in the Database
+type AllowedNodeKey struct {
+	// Hex encoded SHA-256 hash of the DER encoded public key of a Node
+	// certificate
+	Fingerprint string `gorm:"primary_key"`
+	// Date/time that the key was added to the allowlist
+	Timestamp time.Time `gorm:"NOT NULL"`
+}
+
+// Struct representing the RevokedCertificate table in the Database
+type RevokedCertificate struct {
+	// Issuer and serial number identifying the revoked certificate
+	Issuer string `gorm:"primary_key"`
+	Serial string `gorm:"primary_key"`
+	// ID of the Node the certificate was registered by
+	NodeId []byte `gorm:"INDEX;NOT NULL"`
+	// Date/time that the certificate was revoked
+	Timestamp time.Time `gorm:"NOT NULL"`
+}
+
 // Struct representing the Node table in the Database
 type Node struct {
 	// Registration code acts as the primary key
@@ -156,6 +230,12 @@ type Node struct {
 	DateRegistered time.Time
 	// Date/time that the node was last active
 	LastActive time.Time
+	// Date/time that the node was decommissioned
+	DateDecommissioned time.Time
+	// Date/time that the node was banned by an administrator
+	DateBanned time.Time
+	// Reason given by the administrator that banned the node
+	BanReason string
 	// Node's network status
 	Status uint8 `gorm:"NOT NULL"`
 
@@ -183,6 +263,53 @@ type NodeMetric struct {
 	NumPings uint64 `gorm:"NOT NULL"`
 }
 
+// Struct representing the PollMetric table in the Database
+type PollMetric struct {
+	// Auto-incrementing primary key (Do not set)
+	Id uint64 `gorm:"primary_key;AUTO_INCREMENT:true"`
+	// Node has many PollMetrics
+	NodeId []byte `gorm:"INDEX;NOT NULL;type:bytea REFERENCES nodes(Id)"`
+	// Start time of monitoring period
+	StartTime time.Time `gorm:"NOT NULL"`
+	// End time of monitoring period
+	EndTime time.Time `gorm:"NOT NULL"`
+	// Number of intervals between polls during monitoring period
+	NumIntervals uint64 `gorm:"NOT NULL"`
+	// Shortest, longest, and mean interval between polls in milliseconds
+	MinInterval  int64 `gorm:"NOT NULL"`
+	MaxInterval  int64 `gorm:"NOT NULL"`
+	MeanInterval int64 `gorm:"NOT NULL"`
+}
+
+// Struct representing the NodeLatency table in the Database, samples of the
+// intervals between a Node's consecutive polls
+type NodeLatency struct {
+	// Auto-incrementing primary key (Do not set)
+	Id uint64 `gorm:"primary_key;AUTO_INCREMENT:true"`
+	// Node has many NodeLatencies
+	NodeId []byte `gorm:"INDEX;NOT NULL;type:bytea REFERENCES nodes(Id)"`
+	// End time of the monitoring period the sample was taken in
+	Timestamp time.Time `gorm:"INDEX;NOT NULL"`
+	// Interval between polls in milliseconds
+	Latency int64 `gorm:"NOT NULL"`
+}
+
+// Struct representing the NodeStateTransition table in the Database, an audit
+// trail of the activity changes of each Node
+type NodeStateTransition struct {
+	// Auto-incrementing primary key (Do not set)
+	Id uint64 `gorm:"primary_key;AUTO_INCREMENT:true"`
+	// Node has many NodeStateTransitions
+	NodeId []byte `gorm:"INDEX;NOT NULL;type:bytea REFERENCES nodes(Id)"`
+	// Activity the Node moved from and to
+	FromActivity uint32 `gorm:"NOT NULL"`
+	ToActivity   uint32 `gorm:"NOT NULL"`
+	// ID of the Round the Node was in, if any
+	RoundId *uint64
+	// Time the transition was handled
+	Timestamp time.Time `gorm:"INDEX;NOT NULL"`
+}
+
 // Junction table for the many-to-many relationship between Nodes & RoundMetrics
 type Topology struct {
 	// Composite primary key
@@ -206,6 +333,13 @@ type RoundMetric struct {
 	RoundEnd      time.Time `gorm:"NOT NULL;INDEX;default:to_timestamp(0)"` // Index for TPS calc
 	BatchSize     uint32    `gorm:"NOT NULL"`
 
+	// Number of errors reported by clients during the Round
+	ClientErrorCount uint32 `gorm:"NOT NULL;default:0"`
+
+	// Number of Nodes in the Round that are not registered, which are omitted
+	// from the Topologies
+	UnknownNodeCount uint32 `gorm:"NOT NULL;default:0"`
+
 	// Each RoundMetric has many Nodes participating in each Round
 	Topologies []Topology `gorm:"foreignkey:RoundMetricId;association_foreignkey:Id"`
 
@@ -223,6 +357,12 @@ type RoundError struct {
 
 	// String of error that occurred during the Round
 	Error string `gorm:"NOT NULL"`
+
+	// Cause of the error, used to aggregate failures
+	Category RoundErrorCategory `gorm:"NOT NULL;INDEX;default:0"`
+
+	// Time the error was stored
+	Timestamp time.Time `gorm:"INDEX"`
 }
 
 // Struct represegnting the validity period of an ephemeral ID length
@@ -246,6 +386,13 @@ type RoundMetricAlt struct {
 	RoundEnd      time.Time `gorm:"NOT NULL;INDEX;"` // Index for TPS calc
 	BatchSize     uint32    `gorm:"NOT NULL"`
 
+	// Number of errors reported by clients during the Round
+	ClientErrorCount uint32 `gorm:"NOT NULL;default:0"`
+
+	// Number of Nodes in the Round that are not registered, which are omitted
+	// from the Topologies
+	UnknownNodeCount uint32 `gorm:"NOT NULL;default:0"`
+
 	// Each RoundMetric has many Nodes participating in each Round
 	Topologies []Topology `gorm:"foreignkey:RoundMetricId;association_foreignkey:Id"`
 
@@ -0,0 +1,69 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the source of NDF timestamps and the clock skew tolerated between them
+
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// ndfClock is the source of the timestamps of the NDFs of a network and the
+// clock skew tolerated when comparing them.
+type ndfClock struct {
+	// Returns the current time; time.Now when nil
+	now func() time.Time
+
+	// How far the timestamp of a new NDF may be behind the output NDF before
+	// it is considered stale
+	skew time.Duration
+
+	mux sync.RWMutex
+}
+
+// SetNdfClock sets the function NDF timestamps are taken from, so that
+// deployments and tests can control them. A nil clock uses time.Now.
+func (s *NetworkState) SetNdfClock(now func() time.Time) {
+	s.ndfClock.mux.Lock()
+	defer s.ndfClock.mux.Unlock()
+	s.ndfClock.now = now
+}
+
+// SetNdfTimestampSkew sets how far the timestamp of a changed internal NDF may
+// be behind the timestamp of the output NDF while still being output, so that
+// clock skew between servers does not cause updates to be skipped. A skew of
+// zero or less only outputs NDFs with later timestamps.
+func (s *NetworkState) SetNdfTimestampSkew(skew time.Duration) {
+	s.ndfClock.mux.Lock()
+	defer s.ndfClock.mux.Unlock()
+	s.ndfClock.skew = skew
+}
+
+// ndfNow returns the current time of the NDF clock.
+func (s *NetworkState) ndfNow() time.Time {
+	s.ndfClock.mux.RLock()
+	defer s.ndfClock.mux.RUnlock()
+	if s.ndfClock.now == nil {
+		return time.Now()
+	}
+	return s.ndfClock.now()
+}
+
+// isStaleNdf returns true if an NDF with the timestamp is not newer than the
+// output NDF with the output timestamp. An NDF with the same timestamp is
+// stale, while one with an earlier timestamp is only stale if it is further
+// behind than the tolerated skew.
+func (s *NetworkState) isStaleNdf(timestamp, output time.Time) bool {
+	s.ndfClock.mux.RLock()
+	defer s.ndfClock.mux.RUnlock()
+	if timestamp.After(output) {
+		return false
+	}
+	return timestamp.Equal(output) || output.Sub(timestamp) > s.ndfClock.skew
+}
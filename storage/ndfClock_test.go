@@ -0,0 +1,76 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that UpdateOutputNdf outputs NDFs timestamped by the NDF clock that are
+// later than the output NDF or within the timestamp skew of it and skips all
+// others.
+func TestNetworkState_UpdateOutputNdf_NdfClock(t *testing.T) {
+	state, output := newDebounceTestState(0, t)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	state.SetNdfClock(func() time.Time { return now })
+
+	// expect updates the internal NDF at the given time and checks whether
+	// the output NDF is updated to it
+	writes := output.count()
+	expect := func(name, address string, at time.Time, updated bool) {
+		now = at
+		changeNdf(state, address)
+		err := state.UpdateOutputNdf()
+		if err != nil {
+			t.Fatalf("Failed to update output NDF for %s: %+v", name, err)
+		}
+
+		if updated {
+			writes++
+		}
+		if output.count() != writes {
+			t.Errorf("Unexpected number of output NDF writes for %s."+
+				"\n\texpected: %d\n\treceived: %d", name, writes, output.count())
+		}
+
+		outputNdf := state.GetFullNdf().Get()
+		if updated && (outputNdf.Registration.Address != address ||
+			!outputNdf.Timestamp.Equal(at)) {
+			t.Errorf("Output NDF not updated for %s."+
+				"\n\texpected: %s at %s\n\treceived: %s at %s", name, address,
+				at, outputNdf.Registration.Address, outputNdf.Timestamp)
+		} else if !updated && outputNdf.Registration.Address == address {
+			t.Errorf("Output NDF updated for %s.", name)
+		}
+	}
+
+	expect("first NDF", "first", start, true)
+	expect("same timestamp", "same", start, false)
+	expect("clock behind", "behind", start.Add(-time.Second), false)
+
+	state.SetNdfTimestampSkew(2 * time.Second)
+	expect("clock behind within skew", "skewed", start.Add(-time.Second), true)
+	expect("clock behind beyond skew", "beyond", start.Add(-4*time.Second), false)
+	expect("clock ahead", "ahead", start.Add(time.Minute), true)
+}
+
+// Tests that a nil NDF clock uses the system time.
+func TestNetworkState_SetNdfClock_Nil(t *testing.T) {
+	state, _ := newDebounceTestState(0, t)
+	state.SetNdfClock(nil)
+
+	before := time.Now()
+	received := state.ndfNow()
+	if received.Before(before) || received.After(time.Now()) {
+		t.Errorf("NDF clock does not use the system time."+
+			"\n\texpected: %s\n\treceived: %s", before, received)
+	}
+}
@@ -0,0 +1,84 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles coalescing bursts of NDF changes into a single output NDF update
+
+package storage
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"sync"
+	"time"
+)
+
+// defaultNdfUpdateDebounceWindow is the default amount of time changes queued
+// with QueueOutputNdfUpdate are collected before the output NDF is updated.
+const defaultNdfUpdateDebounceWindow = 5 * time.Second
+
+// ndfUpdateDebouncer tracks whether the internal NDF has changed since the
+// output NDF was last updated and the timer that will update it.
+type ndfUpdateDebouncer struct {
+	window time.Duration
+	dirty  bool
+	timer  *time.Timer
+	mux    sync.Mutex
+}
+
+// SetNdfUpdateDebounceWindow sets how long changes queued with
+// QueueOutputNdfUpdate are collected before the output NDF is updated. A
+// window of zero or less updates the output NDF on every change.
+func (s *NetworkState) SetNdfUpdateDebounceWindow(window time.Duration) {
+	s.ndfDebounce.mux.Lock()
+	defer s.ndfDebounce.mux.Unlock()
+	s.ndfDebounce.window = window
+}
+
+// QueueOutputNdfUpdate marks the internal NDF as changed so that the output
+// NDF is updated once the debounce window has passed. All changes queued
+// within the window are written by a single update; a change queued after
+// that update has read the internal NDF starts a new window, so no change is
+// lost.
+func (s *NetworkState) QueueOutputNdfUpdate() {
+	s.ndfDebounce.mux.Lock()
+	window := s.ndfDebounce.window
+	if window <= 0 {
+		s.ndfDebounce.mux.Unlock()
+		if err := s.UpdateOutputNdf(); err != nil {
+			jww.ERROR.Printf("Failed to update output NDF: %+v", err)
+		}
+		return
+	}
+
+	s.ndfDebounce.dirty = true
+	if s.ndfDebounce.timer == nil {
+		s.ndfDebounce.timer = time.AfterFunc(window, func() {
+			if err := s.FlushOutputNdf(); err != nil {
+				jww.ERROR.Printf("Failed to update output NDF: %+v", err)
+			}
+		})
+	}
+	s.ndfDebounce.mux.Unlock()
+}
+
+// FlushOutputNdf immediately updates the output NDF if any changes have been
+// queued since it was last updated. It should be called before shutting down
+// so that queued changes are written.
+func (s *NetworkState) FlushOutputNdf() error {
+	s.ndfDebounce.mux.Lock()
+	if s.ndfDebounce.timer != nil {
+		s.ndfDebounce.timer.Stop()
+		s.ndfDebounce.timer = nil
+	}
+	dirty := s.ndfDebounce.dirty
+	s.ndfDebounce.dirty = false
+	s.ndfDebounce.mux.Unlock()
+
+	if !dirty {
+		return nil
+	}
+	return s.UpdateOutputNdf()
+}
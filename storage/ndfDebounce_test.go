@@ -0,0 +1,135 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"gitlab.com/xx_network/primitives/ndf"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingOutput is an NdfOutput that counts its writes.
+type countingOutput struct {
+	writes int
+	mux    sync.Mutex
+}
+
+func (c *countingOutput) Write([]byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.writes++
+	return nil
+}
+
+func (c *countingOutput) count() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.writes
+}
+
+// newDebounceTestState returns a NetworkState with the debounce window whose
+// full NDF writes are counted by the returned output.
+func newDebounceTestState(window time.Duration, t *testing.T) (
+	*NetworkState, *countingOutput) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	output := &countingOutput{}
+	state.SetNdfOutputs(output, &countingOutput{})
+	state.SetNdfUpdateDebounceWindow(window)
+	return state, output
+}
+
+// changeNdf updates the internal NDF of the state to one with the address.
+func changeNdf(state *NetworkState, address string) {
+	state.InternalNdfLock.Lock()
+	state.UpdateInternalNdf(withTestNode(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: address}}))
+	state.InternalNdfLock.Unlock()
+}
+
+// Tests that many changes queued within the debounce window result in a single
+// output NDF update containing the last change and that FlushOutputNdf writes
+// changes queued afterwards.
+func TestNetworkState_QueueOutputNdfUpdate(t *testing.T) {
+	window := 100 * time.Millisecond
+	state, output := newDebounceTestState(window, t)
+
+	const numChanges = 50
+	for i := 0; i < numChanges; i++ {
+		changeNdf(state, strconv.Itoa(i))
+		state.QueueOutputNdfUpdate()
+	}
+	if output.count() != 0 {
+		t.Errorf("Output NDF was written before the window passed.")
+	}
+
+	// Wait for the window to pass and check that a single update was made
+	time.Sleep(3 * window)
+	if output.count() != 1 {
+		t.Errorf("Unexpected number of output NDF writes."+
+			"\n\texpected: %d\n\treceived: %d", 1, output.count())
+	}
+	expected := strconv.Itoa(numChanges - 1)
+	if address := state.GetFullNdf().Get().Registration.Address; address != expected {
+		t.Errorf("Output NDF does not contain the last change."+
+			"\n\texpected: %s\n\treceived: %s", expected, address)
+	}
+
+	// A change queued after the update is written when flushed
+	changeNdf(state, "flushed")
+	state.QueueOutputNdfUpdate()
+	err := state.FlushOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to flush output NDF: %+v", err)
+	}
+	if output.count() != 2 {
+		t.Errorf("Unexpected number of output NDF writes after flush."+
+			"\n\texpected: %d\n\treceived: %d", 2, output.count())
+	}
+	if address := state.GetFullNdf().Get().Registration.Address; address != "flushed" {
+		t.Errorf("Output NDF does not contain the flushed change."+
+			"\n\texpected: %s\n\treceived: %s", "flushed", address)
+	}
+
+	// Nothing is written when no changes are queued, including by the timer
+	// of the flushed change
+	err = state.FlushOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to flush output NDF: %+v", err)
+	}
+	time.Sleep(2 * window)
+	if output.count() != 2 {
+		t.Errorf("Output NDF was written without queued changes."+
+			"\n\texpected: %d\n\treceived: %d", 2, output.count())
+	}
+}
+
+// Tests that every queued change is written immediately when the debounce
+// window is zero.
+func TestNetworkState_QueueOutputNdfUpdate_NoWindow(t *testing.T) {
+	state, output := newDebounceTestState(0, t)
+
+	for i := 0; i < 3; i++ {
+		changeNdf(state, strconv.Itoa(i))
+		state.QueueOutputNdfUpdate()
+		if output.count() != i+1 {
+			t.Errorf("Unexpected number of output NDF writes for change %d."+
+				"\n\texpected: %d\n\treceived: %d", i, i+1, output.count())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles computing incremental differences between NDFs
+
+package storage
+
+import (
+	"bytes"
+	"gitlab.com/xx_network/primitives/ndf"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ndfHistoryLength is the number of previous partial NDFs kept to compute
+// diffs against. Callers with an older NDF must receive the full NDF.
+const ndfHistoryLength = 10
+
+// NdfDiff describes the changes to the Nodes and Gateways between two NDFs.
+type NdfDiff struct {
+	// Timestamp of the newer NDF
+	Timestamp time.Time
+
+	// Entries present in the newer NDF but not in the older one
+	AddedNodes    []ndf.Node
+	AddedGateways []ndf.Gateway
+
+	// IDs of entries present in the older NDF but not in the newer one
+	RemovedNodes    [][]byte
+	RemovedGateways [][]byte
+
+	// Entries present in both NDFs whose contents (e.g. address or status)
+	// have changed; the values are those of the newer NDF
+	ChangedNodes    []ndf.Node
+	ChangedGateways []ndf.Gateway
+}
+
+// IsEmpty returns true if the diff contains no Node or Gateway changes.
+func (d *NdfDiff) IsEmpty() bool {
+	return len(d.AddedNodes) == 0 && len(d.AddedGateways) == 0 &&
+		len(d.RemovedNodes) == 0 && len(d.RemovedGateways) == 0 &&
+		len(d.ChangedNodes) == 0 && len(d.ChangedGateways) == 0
+}
+
+// DiffNdf computes the changes to the Nodes and Gateways from oldNdf to newNdf.
+// Returns false if the NDFs differ in any field other than the Nodes, Gateways,
+// and timestamp, as such changes cannot be expressed as a diff and the full NDF
+// must be sent instead.
+func DiffNdf(oldNdf, newNdf *ndf.NetworkDefinition) (*NdfDiff, bool) {
+	if oldNdf == nil || newNdf == nil {
+		return nil, false
+	}
+
+	// Compare everything except the Nodes, Gateways, and timestamp. The copies
+	// normalize nil and empty fields so that they marshal identically.
+	oldRest, newRest := oldNdf.DeepCopy(), newNdf.DeepCopy()
+	oldRest.Nodes, newRest.Nodes = nil, nil
+	oldRest.Gateways, newRest.Gateways = nil, nil
+	oldRest.Timestamp, newRest.Timestamp = time.Time{}, time.Time{}
+	oldRestData, err := oldRest.Marshal()
+	if err != nil {
+		return nil, false
+	}
+	newRestData, err := newRest.Marshal()
+	if err != nil || !bytes.Equal(oldRestData, newRestData) {
+		return nil, false
+	}
+
+	diff := &NdfDiff{Timestamp: newNdf.Timestamp}
+
+	// Diff the Nodes
+	oldNodes := make(map[string]ndf.Node, len(oldNdf.Nodes))
+	for _, n := range oldNdf.Nodes {
+		oldNodes[string(n.ID)] = n
+	}
+	for _, n := range newNdf.Nodes {
+		oldNode, exists := oldNodes[string(n.ID)]
+		if !exists {
+			diff.AddedNodes = append(diff.AddedNodes, n)
+		} else if !reflect.DeepEqual(oldNode, n) {
+			diff.ChangedNodes = append(diff.ChangedNodes, n)
+		}
+		delete(oldNodes, string(n.ID))
+	}
+	for _, n := range oldNdf.Nodes {
+		if _, removed := oldNodes[string(n.ID)]; removed {
+			diff.RemovedNodes = append(diff.RemovedNodes, n.ID)
+		}
+	}
+
+	// Diff the Gateways
+	oldGateways := make(map[string]ndf.Gateway, len(oldNdf.Gateways))
+	for _, g := range oldNdf.Gateways {
+		oldGateways[string(g.ID)] = g
+	}
+	for _, g := range newNdf.Gateways {
+		oldGateway, exists := oldGateways[string(g.ID)]
+		if !exists {
+			diff.AddedGateways = append(diff.AddedGateways, g)
+		} else if !reflect.DeepEqual(oldGateway, g) {
+			diff.ChangedGateways = append(diff.ChangedGateways, g)
+		}
+		delete(oldGateways, string(g.ID))
+	}
+	for _, g := range oldNdf.Gateways {
+		if _, removed := oldGateways[string(g.ID)]; removed {
+			diff.RemovedGateways = append(diff.RemovedGateways, g.ID)
+		}
+	}
+
+	return diff, true
+}
+
+// ndfHistory is a bounded list of recently output NDFs and their hashes, in
+// order from oldest to newest.
+type ndfHistory struct {
+	entries []ndfHistoryEntry
+	mux     sync.RWMutex
+}
+
+type ndfHistoryEntry struct {
+	hash []byte
+	def  *ndf.NetworkDefinition
+}
+
+// add appends the NDF to the history, dropping the oldest entry if the history
+// is full.
+func (h *ndfHistory) add(hash []byte, def *ndf.NetworkDefinition) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.entries = append(h.entries, ndfHistoryEntry{hash: hash, def: def})
+	if len(h.entries) > ndfHistoryLength {
+		h.entries = h.entries[len(h.entries)-ndfHistoryLength:]
+	}
+}
+
+// get returns the NDF in the history with the matching hash. Returns false if
+// no NDF with the hash is in the history.
+func (h *ndfHistory) get(hash []byte) (*ndf.NetworkDefinition, bool) {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	for _, e := range h.entries {
+		if bytes.Equal(e.hash, hash) {
+			return e.def, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetPartialNdfDiff returns the diff from the partial NDF with the given hash to
+// the current partial NDF. Returns false if the hash is not in the recent
+// history or the change cannot be expressed as a diff, in which case the full
+// partial NDF should be sent instead.
+func (s *NetworkState) GetPartialNdfDiff(theirHash []byte) (*NdfDiff, bool) {
+	oldNdf, exists := s.partialNdfHistory.get(theirHash)
+	if !exists {
+		return nil, false
+	}
+
+	s.outputNdfLock.RLock()
+	newNdf := s.partialNdf.Get()
+	s.outputNdfLock.RUnlock()
+
+	return DiffNdf(oldNdf, newNdf)
+}
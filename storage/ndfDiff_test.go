@@ -0,0 +1,183 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/ndf"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Tests that DiffNdf() returns the added, removed, and changed Nodes and
+// Gateways.
+func TestDiffNdf(t *testing.T) {
+	nid := func(i uint64) []byte { return id.NewIdFromUInt(i, id.Node, t).Bytes() }
+	gid := func(i uint64) []byte { return id.NewIdFromUInt(i, id.Gateway, t).Bytes() }
+
+	oldNdf := &ndf.NetworkDefinition{
+		Timestamp: time.Unix(1, 0),
+		Nodes: []ndf.Node{
+			{ID: nid(0), Status: ndf.Active},
+			{ID: nid(1), Status: ndf.Active},
+			{ID: nid(2), Status: ndf.Active},
+		},
+		Gateways: []ndf.Gateway{
+			{ID: gid(0), Address: "0.0.0.0:0"},
+			{ID: gid(1), Address: "0.0.0.0:1"},
+			{ID: gid(2), Address: "0.0.0.0:2"},
+		},
+	}
+	newNdf := &ndf.NetworkDefinition{
+		Timestamp: time.Unix(2, 0),
+		Nodes: []ndf.Node{
+			{ID: nid(0), Status: ndf.Active},
+			{ID: nid(2), Status: ndf.Stale},
+			{ID: nid(3), Status: ndf.Active},
+		},
+		Gateways: []ndf.Gateway{
+			{ID: gid(0), Address: "0.0.0.0:0"},
+			{ID: gid(2), Address: "0.0.0.0:22"},
+			{ID: gid(3), Address: "0.0.0.0:3"},
+		},
+	}
+
+	expected := &NdfDiff{
+		Timestamp:       newNdf.Timestamp,
+		AddedNodes:      []ndf.Node{newNdf.Nodes[2]},
+		AddedGateways:   []ndf.Gateway{newNdf.Gateways[2]},
+		RemovedNodes:    [][]byte{nid(1)},
+		RemovedGateways: [][]byte{gid(1)},
+		ChangedNodes:    []ndf.Node{newNdf.Nodes[1]},
+		ChangedGateways: []ndf.Gateway{newNdf.Gateways[1]},
+	}
+
+	diff, ok := DiffNdf(oldNdf, newNdf)
+	if !ok {
+		t.Fatal("DiffNdf() failed to diff NDFs that only differ in Nodes " +
+			"and Gateways.")
+	}
+
+	if !reflect.DeepEqual(expected, diff) {
+		t.Errorf("DiffNdf() returned the wrong diff."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, diff)
+	}
+}
+
+// Tests that DiffNdf() returns an empty diff for identical NDFs.
+func TestDiffNdf_Same(t *testing.T) {
+	def := &ndf.NetworkDefinition{
+		Nodes:    []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	}
+
+	diff, ok := DiffNdf(def, def.DeepCopy())
+	if !ok {
+		t.Fatal("DiffNdf() failed to diff identical NDFs.")
+	}
+
+	if !diff.IsEmpty() {
+		t.Errorf("DiffNdf() returned a non-empty diff for identical NDFs: %+v",
+			diff)
+	}
+}
+
+// Error path: Tests that DiffNdf() returns false when a field other than the
+// Nodes and Gateways changes.
+func TestDiffNdf_OtherFieldChanged(t *testing.T) {
+	oldNdf := &ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "0.0.0.0:0"},
+	}
+	newNdf := &ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "0.0.0.0:1"},
+	}
+
+	if _, ok := DiffNdf(oldNdf, newNdf); ok {
+		t.Error("DiffNdf() did not fail when the registration address changed.")
+	}
+
+	if _, ok := DiffNdf(nil, newNdf); ok {
+		t.Error("DiffNdf() did not fail for a nil NDF.")
+	}
+}
+
+// Tests that ndfHistory.add() only keeps the most recent ndfHistoryLength
+// entries.
+func Test_ndfHistory_add(t *testing.T) {
+	var h ndfHistory
+
+	for i := 0; i < ndfHistoryLength*2; i++ {
+		h.add([]byte(strconv.Itoa(i)), &ndf.NetworkDefinition{})
+	}
+
+	if len(h.entries) != ndfHistoryLength {
+		t.Errorf("add() kept the wrong number of entries."+
+			"\n\texpected: %d\n\treceived: %d", ndfHistoryLength, len(h.entries))
+	}
+
+	if _, exists := h.get([]byte(strconv.Itoa(ndfHistoryLength - 1))); exists {
+		t.Error("get() found an entry that should have been dropped.")
+	}
+
+	if _, exists := h.get([]byte(strconv.Itoa(ndfHistoryLength*2 - 1))); !exists {
+		t.Error("get() failed to find the most recent entry.")
+	}
+}
+
+// Tests that NetworkState.GetPartialNdfDiff() returns the diff from a
+// previously output partial NDF and fails for an unknown hash.
+func TestNetworkState_GetPartialNdfDiff(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testNdf := &ndf.NetworkDefinition{
+		Nodes:    []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	}
+	state.UpdateInternalNdf(testNdf)
+	if err = state.UpdateOutputNdf(); err != nil {
+		t.Fatalf("UpdateOutputNdf() produced an error: %+v", err)
+	}
+	oldHash := state.GetPartialNdf().GetHash()
+
+	newNode := ndf.Node{ID: id.NewIdFromUInt(1, id.Node, t).Bytes()}
+	testNdf.Nodes = append(testNdf.Nodes, newNode)
+	testNdf.Gateways = append(testNdf.Gateways,
+		ndf.Gateway{ID: id.NewIdFromUInt(1, id.Gateway, t).Bytes()})
+	state.UpdateInternalNdf(testNdf)
+	if err = state.UpdateOutputNdf(); err != nil {
+		t.Fatalf("UpdateOutputNdf() produced an error: %+v", err)
+	}
+
+	diff, ok := state.GetPartialNdfDiff(oldHash)
+	if !ok {
+		t.Fatal("GetPartialNdfDiff() failed to diff a known NDF hash.")
+	}
+
+	if len(diff.AddedNodes) != 1 ||
+		!bytes.Equal(diff.AddedNodes[0].ID, newNode.ID) {
+		t.Errorf("GetPartialNdfDiff() returned the wrong added Nodes."+
+			"\n\texpected: %v\n\treceived: %v", []ndf.Node{newNode},
+			diff.AddedNodes)
+	}
+
+	if _, ok = state.GetPartialNdfDiff([]byte("unknown")); ok {
+		t.Error("GetPartialNdfDiff() did not fail for an unknown NDF hash.")
+	}
+}
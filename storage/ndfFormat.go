@@ -0,0 +1,139 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the encodings the full NDF can be written to its output in
+
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/pkg/errors"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/xx_network/primitives/ndf"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"path"
+	"strings"
+)
+
+// Names of the NDF formats that can be selected in the config.
+const (
+	JsonNdfFormat     = "json"
+	ProtoNdfFormat    = "proto"
+	GzipJsonNdfFormat = "gzip"
+)
+
+// NdfFormat is an encoding the full NDF is written to its output in.
+type NdfFormat interface {
+	// Marshal encodes the signed NDF message, whose Ndf field holds the JSON
+	// of the NDF.
+	Marshal(ndfMsg *pb.NDF) ([]byte, error)
+
+	// Unmarshal decodes data encoded by Marshal back into the NDF.
+	Unmarshal(data []byte) (*ndf.NetworkDefinition, error)
+}
+
+// NewNdfFormat returns the NdfFormat with the given name. If the name is empty,
+// the format is selected by the extension of the output target: ".pb" for
+// protobuf, ".gz" for gzip-compressed JSON, and JSON for any other extension.
+func NewNdfFormat(name, target string) (NdfFormat, error) {
+	if name == "" {
+		return ndfFormatFor(target), nil
+	}
+
+	switch strings.ToLower(name) {
+	case JsonNdfFormat:
+		return jsonNdfFormat{}, nil
+	case ProtoNdfFormat:
+		return protoNdfFormat{}, nil
+	case GzipJsonNdfFormat:
+		return gzipJsonNdfFormat{}, nil
+	default:
+		return nil, errors.Errorf("Unknown NDF format %q, expected one of "+
+			"%q, %q, or %q", name, JsonNdfFormat, ProtoNdfFormat,
+			GzipJsonNdfFormat)
+	}
+}
+
+// ndfFormatFor returns the NdfFormat selected by the extension of the target.
+func ndfFormatFor(target string) NdfFormat {
+	switch strings.ToLower(path.Ext(target)) {
+	case ".pb":
+		return protoNdfFormat{}
+	case ".gz":
+		return gzipJsonNdfFormat{}
+	default:
+		return jsonNdfFormat{}
+	}
+}
+
+// jsonNdfFormat writes the NDF as JSON.
+type jsonNdfFormat struct{}
+
+// Marshal returns the JSON of the NDF.
+func (jsonNdfFormat) Marshal(ndfMsg *pb.NDF) ([]byte, error) {
+	return ndfMsg.Ndf, nil
+}
+
+// Unmarshal decodes the JSON of the NDF.
+func (jsonNdfFormat) Unmarshal(data []byte) (*ndf.NetworkDefinition, error) {
+	return ndf.Unmarshal(data)
+}
+
+// protoNdfFormat writes the signed NDF message as protobuf, so that the
+// signature is kept with the NDF.
+type protoNdfFormat struct{}
+
+// Marshal returns the protobuf encoding of the signed NDF message.
+func (protoNdfFormat) Marshal(ndfMsg *pb.NDF) ([]byte, error) {
+	data, err := proto.Marshal(ndfMsg)
+	if err != nil {
+		return nil, errors.Errorf("Failed to marshal NDF message: %+v", err)
+	}
+	return data, nil
+}
+
+// Unmarshal decodes the signed NDF message and the NDF it contains.
+func (protoNdfFormat) Unmarshal(data []byte) (*ndf.NetworkDefinition, error) {
+	ndfMsg := &pb.NDF{}
+	if err := proto.Unmarshal(data, ndfMsg); err != nil {
+		return nil, errors.Errorf("Failed to unmarshal NDF message: %+v", err)
+	}
+	return ndf.Unmarshal(ndfMsg.Ndf)
+}
+
+// gzipJsonNdfFormat writes the NDF as gzip-compressed JSON.
+type gzipJsonNdfFormat struct{}
+
+// Marshal returns the gzip-compressed JSON of the NDF.
+func (gzipJsonNdfFormat) Marshal(ndfMsg *pb.NDF) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(ndfMsg.Ndf); err != nil {
+		return nil, errors.Errorf("Failed to compress NDF: %+v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Errorf("Failed to compress NDF: %+v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decompresses and decodes the JSON of the NDF.
+func (gzipJsonNdfFormat) Unmarshal(data []byte) (*ndf.NetworkDefinition, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Errorf("Failed to decompress NDF: %+v", err)
+	}
+	defer r.Close()
+
+	ndfJson, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Errorf("Failed to decompress NDF: %+v", err)
+	}
+	return ndf.Unmarshal(ndfJson)
+}
@@ -0,0 +1,127 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/xx_network/primitives/ndf"
+	"gitlab.com/xx_network/primitives/utils"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that every NdfFormat decodes the NDF it encoded.
+func TestNdfFormat_RoundTrip(t *testing.T) {
+	def := withTestNode(&ndf.NetworkDefinition{
+		Timestamp:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Registration: ndf.Registration{Address: "1.2.3.4:11420"},
+	})
+	ndfJson, err := def.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal NDF: %+v", err)
+	}
+	ndfMsg := &pb.NDF{Ndf: ndfJson}
+
+	for _, name := range []string{
+		JsonNdfFormat, ProtoNdfFormat, GzipJsonNdfFormat} {
+		format, err := NewNdfFormat(name, "")
+		if err != nil {
+			t.Fatalf("NewNdfFormat() returned an error for %q: %+v", name, err)
+		}
+
+		data, err := format.Marshal(ndfMsg)
+		if err != nil {
+			t.Fatalf("Failed to marshal NDF as %q: %+v", name, err)
+		}
+		if name != JsonNdfFormat && bytes.Equal(data, ndfJson) {
+			t.Errorf("NDF written as %q is plain JSON.", name)
+		}
+
+		received, err := format.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal NDF as %q: %+v", name, err)
+		}
+		if !reflect.DeepEqual(def, received) {
+			t.Errorf("NDF changed in a round trip through %q."+
+				"\n\texpected: %+v\n\treceived: %+v", name, def, received)
+		}
+	}
+}
+
+// Tests that NewNdfFormat() selects the named format regardless of the target,
+// selects the format by extension when no name is given, and rejects unknown
+// names.
+func TestNewNdfFormat(t *testing.T) {
+	tests := []struct {
+		name, target string
+		expected     NdfFormat
+	}{
+		{"", "ndf.json", jsonNdfFormat{}},
+		{"", "ndf", jsonNdfFormat{}},
+		{"", "ndf.pb", protoNdfFormat{}},
+		{"", "s3://bucket/ndf.json.gz", gzipJsonNdfFormat{}},
+		{JsonNdfFormat, "ndf.pb", jsonNdfFormat{}},
+		{"PROTO", "ndf.json", protoNdfFormat{}},
+		{GzipJsonNdfFormat, "ndf.json", gzipJsonNdfFormat{}},
+	}
+
+	for i, tt := range tests {
+		format, err := NewNdfFormat(tt.name, tt.target)
+		if err != nil {
+			t.Errorf("NewNdfFormat() returned an error (%d): %+v", i, err)
+		} else if format != tt.expected {
+			t.Errorf("Unexpected format for %q with target %q."+
+				"\n\texpected: %T\n\treceived: %T",
+				tt.name, tt.target, tt.expected, format)
+		}
+	}
+
+	if _, err := NewNdfFormat("gob", "ndf.json"); err == nil {
+		t.Error("NewNdfFormat() did not reject an unknown format.")
+	}
+}
+
+// Tests that UpdateOutputNdf() writes the full NDF in the format that is set.
+func TestNetworkState_UpdateOutputNdf_Format(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ndf.json.gz")
+	state.SetNdfOutputs(fileOutput(path), &countingOutput{})
+	state.SetFullNdfFormat(ndfFormatFor(path))
+
+	state.UpdateInternalNdf(withTestNode(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "1.2.3.4:11420"}}))
+	if err = state.UpdateOutputNdf(); err != nil {
+		t.Fatalf("UpdateOutputNdf() produced an error: %+v", err)
+	}
+
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read full NDF: %+v", err)
+	}
+	written, err := gzipJsonNdfFormat{}.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Full NDF not written as gzip-compressed JSON: %+v", err)
+	}
+	if expected := state.GetFullNdf().Get(); !reflect.DeepEqual(
+		expected, written) {
+		t.Errorf("Unexpected full NDF written."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, written)
+	}
+}
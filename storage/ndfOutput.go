@@ -0,0 +1,377 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles writing the NDFs to local files or S3-compatible object storage
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3Scheme is the URL scheme of NDF output targets in S3-compatible storage.
+const s3Scheme = "s3://"
+
+const (
+	// Timeout of a single request to S3-compatible storage
+	s3RequestTimeout = 30 * time.Second
+
+	// Bounds of the exponential backoff between failed writes to a remote
+	// NDF output
+	ndfOutputInitialBackoff = time.Second
+	ndfOutputMaxBackoff     = time.Minute
+
+	// Time a remote NDF output is given to finish writing pending data when
+	// it is closed
+	ndfOutputCloseTimeout = 10 * time.Second
+)
+
+// NdfOutput is a destination the NDFs are written to on every update.
+type NdfOutput interface {
+	Write(data []byte) error
+}
+
+// S3Config contains the location and credentials of an S3-compatible object
+// store that NDFs are written to.
+type S3Config struct {
+	// URL of the store, e.g. https://s3.us-east-1.amazonaws.com; objects are
+	// addressed in path style as Endpoint/bucket/key
+	Endpoint string
+	Region   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// redacted replaces the credentials in S3Config when it is printed.
+const redacted = "[REDACTED]"
+
+// String returns the S3Config with its credentials redacted, so that they are
+// not logged with the parameters.
+func (c S3Config) String() string {
+	redact := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	return fmt.Sprintf("{Endpoint:%s Region:%s AccessKeyID:%s "+
+		"SecretAccessKey:%s}", c.Endpoint, c.Region, redact(c.AccessKeyID),
+		redact(c.SecretAccessKey))
+}
+
+// GoString returns the S3Config with its credentials redacted for the %#v
+// verb.
+func (c S3Config) GoString() string {
+	return "storage.S3Config" + c.String()
+}
+
+// NewNdfOutput returns the NdfOutput for the target. A target of the form
+// s3://bucket/key is written to the object store described by the config;
+// writes to it are retried in the background and never block the caller.
+// Any other target is treated as a local file path.
+func NewNdfOutput(target string, config S3Config) (NdfOutput, error) {
+	if !strings.HasPrefix(target, s3Scheme) {
+		return fileOutput(target), nil
+	}
+
+	output, err := newS3Output(target, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRetryingOutput(output, ndfOutputInitialBackoff,
+		ndfOutputMaxBackoff), nil
+}
+
+// fileOutput writes NDFs to the local file at its path.
+type fileOutput string
+
+// Write replaces the contents of the file with the data.
+func (f fileOutput) Write(data []byte) error {
+	return utils.WriteFile(string(f), data, utils.FilePerms, utils.DirPerms)
+}
+
+// s3Output writes NDFs to an object in S3-compatible storage.
+type s3Output struct {
+	url    *url.URL
+	config S3Config
+	client *http.Client
+}
+
+// newS3Output parses the s3://bucket/key target into the URL of the object on
+// the configured endpoint.
+func newS3Output(target string, config S3Config) (*s3Output, error) {
+	bucketAndKey := strings.TrimPrefix(target, s3Scheme)
+	if i := strings.Index(bucketAndKey, "/"); i < 1 || i == len(bucketAndKey)-1 {
+		return nil, errors.Errorf("NDF output %q must be of the form "+
+			"%sbucket/key", target, s3Scheme)
+	}
+	if config.Endpoint == "" || config.Region == "" {
+		return nil, errors.Errorf("NDF output %q requires an S3 endpoint "+
+			"and region", target)
+	}
+
+	objectUrl, err := url.Parse(
+		strings.TrimSuffix(config.Endpoint, "/") + "/" + bucketAndKey)
+	if err != nil {
+		return nil, errors.Errorf("Invalid S3 endpoint %q: %+v",
+			config.Endpoint, err)
+	}
+
+	return &s3Output{
+		url:    objectUrl,
+		config: config,
+		client: &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+
+// Write uploads the data to the object, replacing its contents.
+func (s *s3Output) Write(data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.url.String(),
+		bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	payloadHash := sha256.Sum256(data)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	signS3Request(req, s.config, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Errorf("Failed to write NDF to %s: %+v", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("Failed to write NDF to %s: %s: %s",
+			s.url, resp.Status, body)
+	}
+
+	return nil
+}
+
+// signS3Request adds the AWS Signature Version 4 Authorization header to the
+// request, signing the host and every header already set on the request. The
+// X-Amz-Content-Sha256 header must be set to the hex encoded hash of the
+// payload.
+func signS3Request(req *http.Request, config S3Config, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSha256([]byte("AWS4"+config.SecretAccessKey), date)
+	key = hmacSha256(key, config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+
+		config.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+
+		", Signature="+sig)
+}
+
+// hmacSha256 returns the HMAC-SHA256 of the data with the key.
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// retryingOutput writes to another NdfOutput in the background, retrying
+// failed writes with exponential backoff. Only the latest data is kept, so a
+// newer NDF replaces one that has not been written yet.
+type retryingOutput struct {
+	output         NdfOutput
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	closeTimeout   time.Duration
+
+	// Latest data queued, the number of writes queued so far, and the number
+	// of the last queued write that succeeded
+	latest     []byte
+	latestNum  uint64
+	writtenNum uint64
+	mux        sync.Mutex
+
+	// Signals the worker that new data is waiting to be written
+	pending chan struct{}
+
+	// Closed to stop the worker and by the worker once it has stopped
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newRetryingOutput wraps the output and starts its worker.
+func newRetryingOutput(output NdfOutput, initialBackoff,
+	maxBackoff time.Duration) *retryingOutput {
+	r := &retryingOutput{
+		output:         output,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		closeTimeout:   ndfOutputCloseTimeout,
+		pending:        make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Write queues the data to be written and returns immediately.
+func (r *retryingOutput) Write(data []byte) error {
+	r.mux.Lock()
+	r.latest = data
+	r.latestNum++
+	r.mux.Unlock()
+
+	select {
+	case r.pending <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Close stops the worker and makes one more attempt to write data that has not
+// been written yet. Returns an error if the data could not be written or if the
+// worker and the write do not finish within the close timeout.
+func (r *retryingOutput) Close() error {
+	r.closeOnce.Do(func() { close(r.quit) })
+
+	timeout := time.NewTimer(r.closeTimeout)
+	defer timeout.Stop()
+
+	select {
+	case <-r.done:
+	case <-timeout.C:
+		return errors.Errorf("Timed out after %s waiting for the NDF "+
+			"output write in progress", r.closeTimeout)
+	}
+
+	data, num, unwritten := r.getUnwritten()
+	if !unwritten {
+		return nil
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- r.output.Write(data) }()
+	select {
+	case err := <-result:
+		if err != nil {
+			return errors.WithMessage(err, "Failed to write pending NDF output")
+		}
+		r.setWritten(num)
+		return nil
+	case <-timeout.C:
+		return errors.Errorf("Timed out after %s writing pending NDF output",
+			r.closeTimeout)
+	}
+}
+
+// getUnwritten returns the latest data, the number it was queued as, and
+// whether it has yet to be written.
+func (r *retryingOutput) getUnwritten() ([]byte, uint64, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.latest, r.latestNum, r.latestNum != r.writtenNum
+}
+
+// setWritten records that the data queued as num was written.
+func (r *retryingOutput) setWritten(num uint64) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if num > r.writtenNum {
+		r.writtenNum = num
+	}
+}
+
+// run writes the latest data each time it is signaled until the write
+// succeeds or is replaced by newer data. It returns once the output is closed.
+func (r *retryingOutput) run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.pending:
+		case <-r.quit:
+			return
+		}
+
+		backoff := r.initialBackoff
+		for {
+			data, num, unwritten := r.getUnwritten()
+			if !unwritten {
+				break
+			}
+
+			err := r.output.Write(data)
+			if err == nil {
+				r.setWritten(num)
+				break
+			}
+			jww.WARN.Printf("Failed to write NDF output, retrying in %s: %+v",
+				backoff, err)
+
+			select {
+			case <-time.After(backoff):
+			case <-r.quit:
+				return
+			}
+			backoff *= 2
+			if backoff > r.maxBackoff {
+				backoff = r.maxBackoff
+			}
+		}
+	}
+}
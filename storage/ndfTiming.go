@@ -0,0 +1,57 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles tracking how long generating the output NDF takes
+
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// NdfGenerationTiming is how long the phases of an output NDF update took.
+type NdfGenerationTiming struct {
+	// Time the update started
+	Start time.Time
+
+	// Pruning offline nodes from the NDF
+	Prune time.Duration
+
+	// Marshalling the full and partial NDFs
+	Marshal time.Duration
+
+	// Signing the full and partial NDFs with the RSA and elliptic curve keys
+	Sign time.Duration
+
+	// Storing the signed NDFs and writing them to their outputs
+	Write time.Duration
+
+	// The whole update
+	Total time.Duration
+}
+
+// ndfTimer holds the timing of the last output NDF update.
+type ndfTimer struct {
+	last NdfGenerationTiming
+	mux  sync.RWMutex
+}
+
+// GetNdfGenerationTiming returns how long the phases of the last output NDF
+// update took. The timing is zero if the output NDF has not been updated.
+func (s *NetworkState) GetNdfGenerationTiming() NdfGenerationTiming {
+	s.ndfTimer.mux.RLock()
+	defer s.ndfTimer.mux.RUnlock()
+	return s.ndfTimer.last
+}
+
+// setNdfGenerationTiming stores the timing of an output NDF update.
+func (s *NetworkState) setNdfGenerationTiming(timing NdfGenerationTiming) {
+	s.ndfTimer.mux.Lock()
+	defer s.ndfTimer.mux.Unlock()
+	s.ndfTimer.last = timing
+}
@@ -0,0 +1,54 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that UpdateOutputNdf() records the timing of each phase of the update
+// and that skipped updates leave the timing unchanged.
+func TestNetworkState_GetNdfGenerationTiming(t *testing.T) {
+	state, _ := newDebounceTestState(0, t)
+	if timing := state.GetNdfGenerationTiming(); timing != (NdfGenerationTiming{}) {
+		t.Errorf("Timing recorded before the NDF was generated: %+v", timing)
+	}
+
+	before := time.Now()
+	changeNdf(state, "address")
+	if err := state.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output NDF: %+v", err)
+	}
+
+	timing := state.GetNdfGenerationTiming()
+	if timing.Start.Before(before) || timing.Start.After(time.Now()) {
+		t.Errorf("Unexpected start time %s of the update started after %s.",
+			timing.Start, before)
+	}
+	phases := map[string]time.Duration{"prune": timing.Prune,
+		"marshal": timing.Marshal, "sign": timing.Sign, "write": timing.Write}
+	for phase, duration := range phases {
+		if duration <= 0 {
+			t.Errorf("Duration of %s phase not recorded.", phase)
+		}
+	}
+	if sum := timing.Prune + timing.Marshal + timing.Sign + timing.Write; timing.Total < sum {
+		t.Errorf("Total duration is less than the sum of the phases."+
+			"\n\texpected: at least %s\n\treceived: %s", sum, timing.Total)
+	}
+
+	// An update without changes is skipped and not timed
+	if err := state.UpdateOutputNdf(); err != nil {
+		t.Fatalf("Failed to update output NDF: %+v", err)
+	}
+	if received := state.GetNdfGenerationTiming(); received != timing {
+		t.Errorf("Timing changed by a skipped update."+
+			"\n\texpected: %+v\n\treceived: %+v", timing, received)
+	}
+}
@@ -20,11 +20,17 @@ type StateMap struct {
 	mux sync.RWMutex
 
 	nodeStates map[id.ID]*State
+
+	// Node each node and gateway address was last assigned to. Entries are
+	// not removed when a Node's address changes, so they are checked against
+	// the Node's current addresses when looked up.
+	addressOwners map[string]*id.ID
 }
 
 func NewStateMap() *StateMap {
 	return &StateMap{
-		nodeStates: make(map[id.ID]*State),
+		nodeStates:    make(map[id.ID]*State),
+		addressOwners: make(map[string]*id.ID),
 	}
 }
 
@@ -45,6 +51,7 @@ func (nsm *StateMap) AddNode(id *id.ID, ordering, nAddr, gwAddr string, appID ui
 			currentRound:   nil,
 			lastPoll:       time.Unix(0, 0),
 			ordering:       ordering,
+			geoBin:         UnknownGeoBin,
 			id:             id,
 			nodeAddress:    nAddr,
 			gatewayAddress: gwAddr,
@@ -54,6 +61,7 @@ func (nsm *StateMap) AddNode(id *id.ID, ordering, nAddr, gwAddr string, appID ui
 			connectivity:   &pfState,
 			applicationID:  appID,
 		}
+	nsm.indexAddresses(id, nAddr, gwAddr)
 
 	return nil
 }
@@ -74,6 +82,7 @@ func (nsm *StateMap) AddBannedNode(id *id.ID, ordering, nAddr, gwAddr string) er
 			currentRound:   nil,
 			lastPoll:       time.Now(),
 			ordering:       ordering,
+			geoBin:         UnknownGeoBin,
 			id:             id,
 			nodeAddress:    nAddr,
 			gatewayAddress: gwAddr,
@@ -81,10 +90,112 @@ func (nsm *StateMap) AddBannedNode(id *id.ID, ordering, nAddr, gwAddr string) er
 			numPolls:       &numPolls,
 			mux:            sync.RWMutex{},
 		}
+	nsm.indexAddresses(id, nAddr, gwAddr)
 
 	return nil
 }
 
+// IndexAddresses records that the addresses are assigned to the Node, so that
+// GetAddressOwner returns the Node for them. Must be called whenever the node
+// or gateway address of a Node in the map changes.
+func (nsm *StateMap) IndexAddresses(nid *id.ID, addresses ...string) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+	nsm.indexAddresses(nid, addresses...)
+}
+
+// indexAddresses records that the addresses are assigned to the Node. Empty
+// addresses are skipped. Must be called with the lock held.
+func (nsm *StateMap) indexAddresses(nid *id.ID, addresses ...string) {
+	if nsm.addressOwners == nil {
+		nsm.addressOwners = make(map[string]*id.ID)
+	}
+	for _, address := range addresses {
+		if address != "" {
+			nsm.addressOwners[address] = nid
+		}
+	}
+}
+
+// GetAddressOwner returns the ID of the Node whose node or gateway address is
+// the given address, or nil if no Node in the map has the address.
+func (nsm *StateMap) GetAddressOwner(address string) *id.ID {
+	nsm.mux.RLock()
+	defer nsm.mux.RUnlock()
+	return nsm.addressOwner(address)
+}
+
+// addressOwner returns the ID of the Node whose node or gateway address is the
+// given address, or nil if no Node in the map has the address. Must be called
+// with the lock held.
+func (nsm *StateMap) addressOwner(address string) *id.ID {
+	owner, exists := nsm.addressOwners[address]
+	if !exists || address == "" {
+		return nil
+	}
+
+	// The Node may have moved to another address since it was indexed
+	n, exists := nsm.nodeStates[*owner]
+	if !exists || (n.GetNodeAddresses() != address &&
+		n.GetGatewayAddress() != address) {
+		return nil
+	}
+	return owner
+}
+
+// AddressClaim is the result of a Node claiming its node and gateway
+// addresses.
+type AddressClaim struct {
+	// Whether the node and gateway addresses of the Node changed
+	NodeUpdate    bool
+	GatewayUpdate bool
+
+	// Other Nodes the claimed addresses were already assigned to, keyed on
+	// address
+	Owners map[string]*id.ID
+}
+
+// ClaimAddresses updates the node and gateway addresses of the Node and
+// records that they are assigned to it as one operation, so that two Nodes
+// cannot take the same address at once. If an address is already assigned to
+// another Node, the addresses are only updated if allowDuplicates is set; the
+// other Nodes are returned in either case. An empty gateway address is not
+// claimed.
+func (nsm *StateMap) ClaimAddresses(nid *id.ID, nodeAddress,
+	gatewayAddress string, allowDuplicates bool) (AddressClaim, error) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	var claim AddressClaim
+	n, exists := nsm.nodeStates[*nid]
+	if !exists {
+		return claim, errors.New("cannot claim addresses for a Node which " +
+			"does not exist")
+	}
+
+	for _, address := range []string{nodeAddress, gatewayAddress} {
+		owner := nsm.addressOwner(address)
+		if owner != nil && !owner.Cmp(nid) {
+			if claim.Owners == nil {
+				claim.Owners = make(map[string]*id.ID)
+			}
+			claim.Owners[address] = owner
+		}
+	}
+	if len(claim.Owners) != 0 && !allowDuplicates {
+		return claim, nil
+	}
+
+	// Index whichever address was updated, even if the other was not
+	var err error
+	claim.NodeUpdate, err = n.UpdateNodeAddresses(nodeAddress)
+	if err == nil {
+		claim.GatewayUpdate, err = n.UpdateGatewayAddresses(gatewayAddress)
+	}
+	nsm.indexAddresses(nid, n.GetNodeAddresses(), n.GetGatewayAddress())
+	return claim, err
+}
+
 // Returns the State object for the given id if it exists
 func (nsm *StateMap) GetNode(id *id.ID) *State {
 	nsm.mux.RLock()
@@ -13,6 +13,7 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"math/rand"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -203,3 +204,104 @@ func TestStateMap_GetNodeStates(t *testing.T) {
 		t.Errorf("Incorrect number of nodes returned, got %d", len(nodeStates))
 	}
 }
+
+// Tests that GetAddressOwner() returns the Node a node or gateway address is
+// assigned to and stops returning it once the Node moves to another address.
+func TestStateMap_GetAddressOwner(t *testing.T) {
+	sm := NewStateMap()
+	nid := id.NewIdFromUInt(1, id.Node, t)
+	err := sm.AddNode(nid, "", "1.2.3.4:11420", "1.2.3.4:22840", 0)
+	if err != nil {
+		t.Fatalf("Failed to add node: %+v", err)
+	}
+
+	for _, address := range []string{"1.2.3.4:11420", "1.2.3.4:22840"} {
+		if owner := sm.GetAddressOwner(address); owner == nil ||
+			!owner.Cmp(nid) {
+			t.Errorf("Unexpected owner of %s.\n\texpected: %s"+
+				"\n\treceived: %s", address, nid, owner)
+		}
+	}
+	for _, address := range []string{"5.6.7.8:11420", ""} {
+		if owner := sm.GetAddressOwner(address); owner != nil {
+			t.Errorf("Unassigned address %q has owner %s.", address, owner)
+		}
+	}
+
+	// Once the node moves, only its new address is assigned to it
+	sm.GetNode(nid).SetAddresses("5.6.7.8:11420", "1.2.3.4:22840")
+	sm.IndexAddresses(nid, "5.6.7.8:11420", "1.2.3.4:22840")
+	if owner := sm.GetAddressOwner("1.2.3.4:11420"); owner != nil {
+		t.Errorf("Previous address is still assigned to %s.", owner)
+	}
+	if owner := sm.GetAddressOwner("5.6.7.8:11420"); owner == nil ||
+		!owner.Cmp(nid) {
+		t.Errorf("Unexpected owner of new address.\n\texpected: %s"+
+			"\n\treceived: %s", nid, owner)
+	}
+}
+
+// Tests that ClaimAddresses() does not update the addresses of a Node when an
+// address is assigned to another Node, unless duplicates are allowed, and that
+// only one of many Nodes claiming the same address at once takes it.
+func TestStateMap_ClaimAddresses(t *testing.T) {
+	sm := NewStateMap()
+	nodeIds := make([]*id.ID, 10)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i+1), id.Node, t)
+		if err := sm.AddNode(nodeIds[i], "", "", "", 0); err != nil {
+			t.Fatalf("Failed to add node: %+v", err)
+		}
+	}
+
+	claim, err := sm.ClaimAddresses(nodeIds[0], "1.2.3.4:11420",
+		"1.2.3.4:22840", false)
+	if err != nil || !claim.NodeUpdate || !claim.GatewayUpdate {
+		t.Fatalf("Failed to claim unassigned addresses: %+v, %+v", claim, err)
+	}
+
+	// The gateway address is assigned to the first node
+	claim, err = sm.ClaimAddresses(nodeIds[1], "5.6.7.8:11420",
+		"1.2.3.4:22840", false)
+	if err != nil {
+		t.Fatalf("ClaimAddresses() returned an error: %+v", err)
+	}
+	if owner := claim.Owners["1.2.3.4:22840"]; owner == nil ||
+		!owner.Cmp(nodeIds[0]) || claim.NodeUpdate || claim.GatewayUpdate {
+		t.Errorf("Claim of an assigned address was not rejected: %+v", claim)
+	}
+	if address := sm.GetNode(nodeIds[1]).GetNodeAddresses(); address != "" {
+		t.Errorf("Node address updated after a rejected claim: %s", address)
+	}
+
+	claim, err = sm.ClaimAddresses(nodeIds[1], "5.6.7.8:11420",
+		"1.2.3.4:22840", true)
+	if err != nil || !claim.GatewayUpdate || len(claim.Owners) != 1 {
+		t.Errorf("Claim of an assigned address failed when allowed: %+v, %+v",
+			claim, err)
+	}
+
+	// Only one of the remaining nodes takes the same address
+	var wg sync.WaitGroup
+	claims := make([]AddressClaim, len(nodeIds))
+	for i := 2; i < len(nodeIds); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			claims[i], _ = sm.ClaimAddresses(nodeIds[i],
+				"9.9.9.9:11420", "", false)
+		}(i)
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, claim := range claims[2:] {
+		if claim.NodeUpdate {
+			claimed++
+		}
+	}
+	if claimed != 1 {
+		t.Errorf("Unexpected number of nodes took the address."+
+			"\n\texpected: %d\n\treceived: %d", 1, claimed)
+	}
+}
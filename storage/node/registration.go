@@ -20,7 +20,7 @@ type Info struct {
 
 // LoadInfo opens a JSON file and marshals it into a slice of Info. An error is
 // returned when an issue is encountered reading the JSON file or unmarshaling
-// the data.
+// the data, or when an order is not a valid sequence.
 func LoadInfo(filePath string) ([]Info, error) {
 	// Data loaded from file will be stored here
 	var infos []Info
@@ -37,5 +37,13 @@ func LoadInfo(filePath string) ([]Info, error) {
 		return nil, errors.Errorf("Could not unmarshal JSON: %v", err)
 	}
 
+	// Ensure every order is a valid sequence
+	for _, info := range infos {
+		if _, err = ParseSequence(info.Order); err != nil {
+			return nil, errors.Errorf("Invalid order of registration code "+
+				"%s: %v", info.RegCode, err)
+		}
+	}
+
 	return infos, nil
 }
@@ -121,3 +121,19 @@ func TestLoadInfo_JsonError(t *testing.T) {
 			"\n\texpected: %+v\n\treceived: %+v", testInfos, infos)
 	}
 }
+
+// Tests that LoadInfo() produces an error when an order is a malformed
+// structured sequence.
+func TestLoadInfo_InvalidOrder(t *testing.T) {
+	filePath := t.TempDir() + "/testRegCodes.json"
+	testData := []byte(`[{"RegCode": "AAAA", "Order": "US/east/0"},` +
+		`{"RegCode": "BBBB", "Order": "US/east"}]`)
+	err := utils.WriteFile(filePath, testData, utils.FilePerms, utils.DirPerms)
+	if err != nil {
+		t.Fatalf("Error creating test JSON file %s:\n\t%v", filePath, err)
+	}
+
+	if _, err = LoadInfo(filePath); err == nil {
+		t.Error("LoadInfo() did not return an error for an invalid order.")
+	}
+}
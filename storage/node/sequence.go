@@ -0,0 +1,90 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles parsing structured Node sequences
+
+package node
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// SequenceSeparator separates the components of a structured sequence.
+const SequenceSeparator = "/"
+
+// Sequence is a Node sequence parsed into its components. A structured
+// sequence has the form "region/shard/index", where the region is the country
+// code the Node is binned by, the shard is a group of Nodes within the region,
+// and the index orders the Nodes within the shard. A sequence without a
+// separator is a plain country code and only has a region.
+type Sequence struct {
+	Region string
+	Shard  string
+	Index  uint64
+}
+
+// ParseSequence parses the sequence string. Returns an error if the sequence
+// is structured but does not have exactly a non-empty region, a non-empty
+// shard, and an unsigned integer index.
+func ParseSequence(sequence string) (Sequence, error) {
+	if !strings.Contains(sequence, SequenceSeparator) {
+		return Sequence{Region: sequence}, nil
+	}
+
+	parts := strings.Split(sequence, SequenceSeparator)
+	if len(parts) != 3 {
+		return Sequence{}, errors.Errorf("Sequence %q must have the form "+
+			"region%sshard%sindex", sequence, SequenceSeparator,
+			SequenceSeparator)
+	} else if parts[0] == "" || parts[1] == "" {
+		return Sequence{}, errors.Errorf("Sequence %q must have a region "+
+			"and a shard", sequence)
+	}
+
+	index, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return Sequence{}, errors.Errorf("Sequence %q has an invalid index: "+
+			"%+v", sequence, err)
+	}
+
+	return Sequence{Region: parts[0], Shard: parts[1], Index: index}, nil
+}
+
+// IsStructured returns true if the sequence has a shard and an index.
+func (s Sequence) IsStructured() bool {
+	return s.Shard != ""
+}
+
+// ShardKey returns the key identifying the sequence's shard among the shards
+// of every region, or an empty string if the sequence is not structured.
+func (s Sequence) ShardKey() string {
+	if !s.IsStructured() {
+		return ""
+	}
+	return s.Region + SequenceSeparator + s.Shard
+}
+
+// Less returns true if the sequence is ordered before the other sequence, by
+// region, then shard, then index.
+func (s Sequence) Less(other Sequence) bool {
+	if s.Region != other.Region {
+		return s.Region < other.Region
+	} else if s.Shard != other.Shard {
+		return s.Shard < other.Shard
+	}
+	return s.Index < other.Index
+}
+
+// String returns the sequence string the Sequence is parsed from.
+func (s Sequence) String() string {
+	if !s.IsStructured() {
+		return s.Region
+	}
+	return s.ShardKey() + SequenceSeparator + strconv.FormatUint(s.Index, 10)
+}
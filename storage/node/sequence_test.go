@@ -0,0 +1,86 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package node
+
+import (
+	"testing"
+)
+
+// Tests that ParseSequence() parses plain and structured sequences, which
+// String() returns unchanged.
+func TestParseSequence(t *testing.T) {
+	tests := map[string]Sequence{
+		"US":         {Region: "US"},
+		"":           {},
+		"US/east/0":  {Region: "US", Shard: "east", Index: 0},
+		"DE/a/12":    {Region: "DE", Shard: "a", Index: 12},
+		"AA/b-2/007": {Region: "AA", Shard: "b-2", Index: 7},
+	}
+
+	for str, expected := range tests {
+		sequence, err := ParseSequence(str)
+		if err != nil {
+			t.Errorf("ParseSequence(%q) returned an error: %+v", str, err)
+		} else if sequence != expected {
+			t.Errorf("Unexpected sequence parsed from %q.\n\texpected: %+v"+
+				"\n\treceived: %+v", str, expected, sequence)
+		}
+	}
+
+	for _, str := range []string{"US", "US/east/0", "DE/a/12"} {
+		sequence, _ := ParseSequence(str)
+		if sequence.String() != str {
+			t.Errorf("Unexpected sequence string.\n\texpected: %s"+
+				"\n\treceived: %s", str, sequence)
+		}
+	}
+}
+
+// Error path: Tests that ParseSequence() rejects malformed structured
+// sequences.
+func TestParseSequence_Invalid(t *testing.T) {
+	for _, str := range []string{"US/east", "US/east/0/1", "/east/0", "US//0",
+		"US/east/", "US/east/-1", "US/east/x"} {
+		if _, err := ParseSequence(str); err == nil {
+			t.Errorf("ParseSequence(%q) did not return an error.", str)
+		}
+	}
+}
+
+// Tests that ShardKey() distinguishes shards of the same name in different
+// regions and is empty for plain sequences.
+func TestSequence_ShardKey(t *testing.T) {
+	us := Sequence{Region: "US", Shard: "a", Index: 1}
+	de := Sequence{Region: "DE", Shard: "a", Index: 1}
+	if us.ShardKey() == de.ShardKey() {
+		t.Errorf("Shards of different regions have the same key %q.",
+			us.ShardKey())
+	}
+	if key := (Sequence{Region: "US"}).ShardKey(); key != "" {
+		t.Errorf("Plain sequence has shard key %q.", key)
+	}
+}
+
+// Tests that Less() orders sequences by region, then shard, then numerically
+// by index.
+func TestSequence_Less(t *testing.T) {
+	ordered := []Sequence{
+		{Region: "DE", Shard: "b", Index: 5},
+		{Region: "US"},
+		{Region: "US", Shard: "a", Index: 2},
+		{Region: "US", Shard: "a", Index: 10},
+		{Region: "US", Shard: "b", Index: 1},
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		if !ordered[i].Less(ordered[i+1]) || ordered[i+1].Less(ordered[i]) {
+			t.Errorf("Sequence %s not ordered before %s.", ordered[i],
+				ordered[i+1])
+		}
+	}
+}
@@ -17,6 +17,9 @@ import (
 	"gitlab.com/elixxir/registration/storage/round"
 	"gitlab.com/elixxir/registration/transition"
 	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/region"
+	"math"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -25,6 +28,14 @@ import (
 
 const ipUpdateTimeout = 30 * time.Minute
 
+// maxLatencySamples is the number of intervals between polls sampled per
+// monitoring period for latency percentiles.
+const maxLatencySamples = 100
+
+// UnknownGeoBin is the geographic bin of a Node whose ordering does not map to
+// a known bin.
+const UnknownGeoBin = region.GeoBin(math.MaxUint8)
+
 // Enumeration of connectivity statuses for a node
 const (
 	PortUnknown uint32 = iota
@@ -58,12 +69,38 @@ type State struct {
 	// within the node metric tracker
 	lastActive time.Time
 
+	// Timestamp of when the Node was added to the waiting pool
+	waitingSince time.Time
+
+	// Timestamp until which the Node is held out of team selection after
+	// causing a round to fail
+	cooldownUntil time.Time
+
+	// Hash of the full NDF the Node last reported in a poll, when it first
+	// reported it, and the number of consecutive polls in which the reported
+	// NDF was not the current NDF
+	ndfHash       []byte
+	ndfHashSince  time.Time
+	staleNdfPolls uint32
+
+	// Number of errors the Node reported while not in a round since it last
+	// completed a round or the count was reset
+	roundlessErrors uint32
+
+	// Sequence number of the last update notification created for the Node
+	// and of the last one handled by the scheduler
+	updateSequence  uint64
+	handledSequence uint64
+
 	// Number of polls made by the node during the current monitoring period
 	numPolls *uint64
 
 	// Order string to be used in team configuration
 	ordering string
 
+	// Geographic bin the ordering maps to, cached to avoid a lookup per poll
+	geoBin region.GeoBin
+
 	//holds valid state transitions
 	stateMap *[][]bool
 
@@ -96,11 +133,112 @@ type State struct {
 	connectivity *uint32
 
 	ed25519 nike.PublicKey
+
+	// Statistics on the intervals between polls, guarded by their own lock so
+	// that polls are not blocked by the polling lock
+	pollIntervals    PollIntervals
+	lastCountedPoll  time.Time
+	pollIntervalsMux sync.Mutex
+
+	// Uniform sample of the intervals counted in pollIntervals, guarded by
+	// pollIntervalsMux
+	latencySamples []time.Duration
+}
+
+// Snapshot is a copy of a Node's state for diagnostics that can be serialized
+// to JSON.
+type Snapshot struct {
+	ID       *id.ID
+	Activity string
+	Status   string
+
+	// ID of the round the Node is in; nil if it is not in a round
+	CurrentRound *id.Round `json:",omitempty"`
+
+	// Number of polls made during the current monitoring period
+	NumPolls uint64
+	LastPoll time.Time
+
+	// Number of errors reported while not in a round since the Node last
+	// completed a round
+	RoundlessErrors uint32 `json:",omitempty"`
+}
+
+// PollIntervals contains statistics on the intervals between a Node's polls
+// during a monitoring period.
+type PollIntervals struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Total time.Duration
+}
+
+// Mean returns the mean interval between polls.
+func (pi PollIntervals) Mean() time.Duration {
+	if pi.Count == 0 {
+		return 0
+	}
+	return pi.Total / time.Duration(pi.Count)
 }
 
-// Increment function for numPolls
+// Increment function for numPolls. Also records the interval since the
+// previous poll.
 func (n *State) IncrementNumPolls() {
 	atomic.AddUint64(n.numPolls, 1)
+	n.recordPollInterval(time.Now())
+}
+
+// recordPollInterval adds the interval between the previous poll and now to
+// the poll interval statistics.
+func (n *State) recordPollInterval(now time.Time) {
+	n.pollIntervalsMux.Lock()
+	defer n.pollIntervalsMux.Unlock()
+
+	if !n.lastCountedPoll.IsZero() {
+		interval := now.Sub(n.lastCountedPoll)
+		pi := &n.pollIntervals
+		if pi.Count == 0 || interval < pi.Min {
+			pi.Min = interval
+		}
+		if interval > pi.Max {
+			pi.Max = interval
+		}
+		pi.Total += interval
+		pi.Count++
+
+		// Reservoir sample the intervals so that every interval in the period
+		// is equally likely to be kept
+		if len(n.latencySamples) < maxLatencySamples {
+			n.latencySamples = append(n.latencySamples, interval)
+		} else if i := rand.Int63n(int64(pi.Count)); i < maxLatencySamples {
+			n.latencySamples[i] = interval
+		}
+	}
+	n.lastCountedPoll = now
+}
+
+// GetAndResetPollIntervals returns the poll interval statistics collected
+// since the last reset and then resets them. The time of the last poll is
+// kept so that the next interval spans the reset.
+func (n *State) GetAndResetPollIntervals() PollIntervals {
+	n.pollIntervalsMux.Lock()
+	defer n.pollIntervalsMux.Unlock()
+
+	pi := n.pollIntervals
+	n.pollIntervals = PollIntervals{}
+	return pi
+}
+
+// GetAndResetLatencySamples returns the sample of intervals between polls
+// collected since the last reset and then resets it. At most
+// maxLatencySamples intervals are kept per period.
+func (n *State) GetAndResetLatencySamples() []time.Duration {
+	n.pollIntervalsMux.Lock()
+	defer n.pollIntervalsMux.Unlock()
+
+	samples := n.latencySamples
+	n.latencySamples = nil
+	return samples
 }
 
 // Returns the current value of numPolls and then resets numPolls to zero
@@ -154,6 +292,38 @@ func (n *State) Ban() (UpdateNotification, error) {
 		ToStatus:     n.status,
 		FromActivity: n.activity,
 		ToActivity:   n.activity,
+		Sequence:     n.nextUpdateSequence(),
+	}
+
+	return nun, nil
+}
+
+// sets the Node to decommissioned and then returns an update notification for
+// signaling. Unlike Ban, this does not mark the Node as malicious.
+func (n *State) Decommission() (UpdateNotification, error) {
+	// Get and lock n state
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	//check if the Node is already decommissioned. do not continue if it is
+	if n.status == Decommissioned {
+		return UpdateNotification{},
+			errors.New("cannot decommission an already decommissioned Node")
+	}
+
+	oldStatus := n.status
+
+	//decommission the Node
+	n.status = Decommissioned
+
+	//create the update notification
+	nun := UpdateNotification{
+		Node:         n.id,
+		FromStatus:   oldStatus,
+		ToStatus:     n.status,
+		FromActivity: n.activity,
+		ToActivity:   n.activity,
+		Sequence:     n.nextUpdateSequence(),
 	}
 
 	return nun, nil
@@ -237,11 +407,38 @@ func (n *State) Update(newActivity current.Activity) (bool, UpdateNotification,
 		ToStatus:     n.status,
 		FromActivity: oldActivity,
 		ToActivity:   newActivity,
+		Sequence:     n.nextUpdateSequence(),
 	}
 
 	return true, nun, nil
 }
 
+// nextUpdateSequence returns the sequence number of a new update notification
+// of the Node. Must be called with the lock held.
+func (n *State) nextUpdateSequence() uint64 {
+	n.updateSequence++
+	return n.updateSequence
+}
+
+// MarkUpdateHandled records that the update notification with the sequence
+// number is being handled. Returns false if it, or a later update, was already
+// handled, in which case the update is a duplicate and must be ignored.
+// Updates with a sequence number of 0 are not tracked and always handled.
+func (n *State) MarkUpdateHandled(sequence uint64) bool {
+	if sequence == 0 {
+		return true
+	}
+
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	if sequence <= n.handledSequence {
+		return false
+	}
+	n.handledSequence = sequence
+	return true
+}
+
 // gets the current activity of the Node
 func (n *State) GetActivity() current.Activity {
 	n.mux.RLock()
@@ -263,6 +460,13 @@ func (n *State) IsBanned() bool {
 	return n.status == Banned
 }
 
+// Gets if the Node has been decommissioned from the network
+func (n *State) IsDecommissioned() bool {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.status == Decommissioned
+}
+
 // Gets the status of connectivity to the node, atomically
 func (n *State) GetConnectivity() uint32 {
 	// Done to avoid a race condition in the case of a double poll
@@ -306,6 +510,22 @@ func (n *State) GetLastUpdate() time.Time {
 	return n.lastUpdate
 }
 
+// IsStuck returns true if the Node is in an activity of a round in progress
+// (PRECOMPUTING, STANDBY, or REALTIME) and has not polled or has not
+// transitioned to another activity for longer than the threshold.
+func (n *State) IsStuck(threshold time.Duration, now time.Time) bool {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+
+	switch n.activity {
+	case current.PRECOMPUTING, current.STANDBY, current.REALTIME:
+		return now.Sub(n.lastPoll) > threshold ||
+			now.Sub(n.lastUpdate) > threshold
+	default:
+		return false
+	}
+}
+
 func (n *State) GetLastActive() time.Time {
 	n.mux.Lock()
 	defer n.mux.Unlock()
@@ -318,6 +538,126 @@ func (n *State) SetLastActive() {
 	n.lastActive = time.Now()
 }
 
+// GetWaitingSince returns when the Node was added to the waiting pool.
+func (n *State) GetWaitingSince() time.Time {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.waitingSince
+}
+
+// SetWaitingSince sets when the Node was added to the waiting pool.
+func (n *State) SetWaitingSince(waitingSince time.Time) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.waitingSince = waitingSince
+}
+
+// GetCooldownUntil returns when the Node's scheduling cooldown ends. It is
+// zero if the Node has never been held out of team selection.
+func (n *State) GetCooldownUntil() time.Time {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.cooldownUntil
+}
+
+// SetCooldownUntil holds the Node out of team selection until the given time.
+func (n *State) SetCooldownUntil(cooldownUntil time.Time) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.cooldownUntil = cooldownUntil
+}
+
+// GetSnapshot returns a copy of the Node's state. Only the Node's own lock is
+// held while copying; the polling lock is not taken, so that the snapshot does
+// not wait on the scheduler.
+func (n *State) GetSnapshot() Snapshot {
+	n.mux.RLock()
+	snapshot := Snapshot{
+		ID:       n.id,
+		Activity: n.activity.String(),
+		Status:   n.status.String(),
+		LastPoll: n.lastPoll,
+
+		RoundlessErrors: n.roundlessErrors,
+	}
+	r := n.currentRound
+	n.mux.RUnlock()
+
+	if r != nil {
+		rid := r.GetRoundID()
+		snapshot.CurrentRound = &rid
+	}
+	if n.numPolls != nil {
+		snapshot.NumPolls = atomic.LoadUint64(n.numPolls)
+	}
+
+	return snapshot
+}
+
+// RecordNdfHash records the hash of the full NDF the Node reported in a poll and
+// whether it is the hash of the current NDF. It returns the number of
+// consecutive polls, including this one, in which the Node reported an outdated
+// NDF.
+func (n *State) RecordNdfHash(hash []byte, isCurrent bool) uint32 {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	if !bytes.Equal(n.ndfHash, hash) {
+		n.ndfHash = append([]byte{}, hash...)
+		n.ndfHashSince = time.Now()
+	}
+
+	if isCurrent {
+		n.staleNdfPolls = 0
+	} else {
+		n.staleNdfPolls++
+	}
+
+	return n.staleNdfPolls
+}
+
+// GetNdfHash returns the hash of the full NDF the Node last reported and the
+// time it first reported it.
+func (n *State) GetNdfHash() ([]byte, time.Time) {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.ndfHash, n.ndfHashSince
+}
+
+// GetStaleNdfPolls returns the number of consecutive polls in which the Node
+// reported an outdated NDF.
+func (n *State) GetStaleNdfPolls() uint32 {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.staleNdfPolls
+}
+
+// AddRoundlessError records that the Node reported an error while not in a
+// round. It returns the number of such errors since the Node last completed a
+// round or the count was reset, including this one.
+func (n *State) AddRoundlessError() uint32 {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.roundlessErrors++
+	return n.roundlessErrors
+}
+
+// GetRoundlessErrors returns the number of errors the Node reported while not
+// in a round since it last completed a round or the count was reset.
+func (n *State) GetRoundlessErrors() uint32 {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	return n.roundlessErrors
+}
+
+// ResetRoundlessErrors resets the number of errors the Node reported while not
+// in a round.
+func (n *State) ResetRoundlessErrors() {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.roundlessErrors = 0
+}
+
 func (n *State) SetLastActiveTesting(tm time.Time, x interface{}) {
 	// Ensure that this function is only run in testing environments
 	switch x.(type) {
@@ -383,6 +723,20 @@ func (n *State) UpdateGatewayAddresses(gateway string) (bool, error) {
 	return true, nil
 }
 
+// SetAddresses sets the node and gateway addresses from a trusted source,
+// regardless of when they were last updated. The addresses are treated as
+// updated now, so addresses reported by the node are only accepted after the
+// usual timeout.
+func (n *State) SetAddresses(node, gateway string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	n.nodeAddress = node
+	n.lastNodeUpdateTS = time.Now()
+	n.gatewayAddress = gateway
+	n.lastGatewayUpdateTS = time.Now()
+}
+
 // UpdateEd25519Key updates the ed25519 key used for no registration if warranted
 func (n *State) UpdateEd25519Key(ed []byte) (bool, error) {
 	n.mux.Lock()
@@ -414,6 +768,17 @@ func (n *State) GetOrdering() string {
 	return n.ordering
 }
 
+// GetSequence returns the ordering string parsed into a Sequence. An ordering
+// that cannot be parsed is treated as a plain country code.
+func (n *State) GetSequence() Sequence {
+	ordering := n.GetOrdering()
+	sequence, err := ParseSequence(ordering)
+	if err != nil {
+		return Sequence{Region: ordering}
+	}
+	return sequence
+}
+
 // SetOrdering sets the State ordering string.
 func (n *State) SetOrdering(ordering string) {
 	n.mux.Lock()
@@ -421,6 +786,21 @@ func (n *State) SetOrdering(ordering string) {
 	n.mux.Unlock()
 }
 
+// GetGeoBin returns the cached geographic bin of the Node.
+func (n *State) GetGeoBin() region.GeoBin {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+
+	return n.geoBin
+}
+
+// SetGeoBin sets the cached geographic bin of the Node.
+func (n *State) SetGeoBin(geoBin region.GeoBin) {
+	n.mux.Lock()
+	n.geoBin = geoBin
+	n.mux.Unlock()
+}
+
 // gets the ID of the Node
 func (n *State) GetID() *id.ID {
 	return n.id
@@ -473,6 +853,7 @@ func (n *State) updateInactive(newActivity current.Activity) (bool, UpdateNotifi
 			ToStatus:     Active,
 			FromActivity: oldActivity,
 			ToActivity:   newActivity,
+			Sequence:     n.nextUpdateSequence(),
 		}
 		return true, nun, nil
 	case current.ERROR:
@@ -491,6 +872,13 @@ func (n *State) SetLastPoll(lastPoll time.Time, t *testing.T) {
 	n.lastPoll = lastPoll
 }
 
+func (n *State) SetLastUpdate(lastUpdate time.Time, t *testing.T) {
+	if t == nil {
+		panic("Cannot directly set node.State's last update outside of testing")
+	}
+	n.lastUpdate = lastUpdate
+}
+
 func (n *State) GetGatewayAddress() string {
 	return n.gatewayAddress
 }
@@ -8,6 +8,7 @@
 package node
 
 import (
+	"bytes"
 	"gitlab.com/elixxir/primitives/current"
 	"gitlab.com/elixxir/primitives/states"
 	"gitlab.com/elixxir/registration/storage/round"
@@ -40,6 +41,45 @@ func TestState_GetLastUpdate(t *testing.T) {
 	}
 }
 
+// Tests that IsStuck() only returns true for Nodes in an activity of a round in
+// progress that have not polled or transitioned within the threshold.
+func TestState_IsStuck(t *testing.T) {
+	now := time.Now()
+	threshold := time.Minute
+	recent := now.Add(-threshold / 2)
+	old := now.Add(-2 * threshold)
+
+	tests := []struct {
+		activity   current.Activity
+		lastPoll   time.Time
+		lastUpdate time.Time
+		expected   bool
+	}{
+		{current.REALTIME, recent, recent, false},
+		{current.REALTIME, recent, old, true},
+		{current.REALTIME, old, old, true},
+		{current.PRECOMPUTING, recent, old, true},
+		{current.STANDBY, old, recent, true},
+		{current.NOT_STARTED, old, old, false},
+		{current.WAITING, old, old, false},
+		{current.COMPLETED, old, old, false},
+		{current.ERROR, old, old, false},
+	}
+
+	for i, tt := range tests {
+		ns := State{
+			activity:   tt.activity,
+			lastPoll:   tt.lastPoll,
+			lastUpdate: tt.lastUpdate,
+		}
+		if stuck := ns.IsStuck(threshold, now); stuck != tt.expected {
+			t.Errorf("Unexpected result for %s node (%d)."+
+				"\n\texpected: %t\n\treceived: %t",
+				tt.activity, i, tt.expected, stuck)
+		}
+	}
+}
+
 // Test that GetRawConnectivity returns the right connectivity type
 func TestState_GetRawConnectivity(t *testing.T) {
 	// connectivity is a *uint32, so we need to be able to make a
@@ -152,6 +192,170 @@ func TestState_GetAndResetNumPolls(t *testing.T) {
 	}
 }
 
+// Tests that RecordNdfHash() counts consecutive polls with an outdated NDF,
+// resets the count once the current NDF is reported, and only updates the time
+// the hash was first reported when the hash changes.
+func TestState_RecordNdfHash(t *testing.T) {
+	s := State{}
+	oldHash, newHash := []byte("old"), []byte("new")
+
+	for i := uint32(1); i <= 3; i++ {
+		if stalePolls := s.RecordNdfHash(oldHash, false); stalePolls != i {
+			t.Errorf("Unexpected number of stale polls for poll %d."+
+				"\n\texpected: %d\n\treceived: %d", i, i, stalePolls)
+		}
+	}
+
+	hash, since := s.GetNdfHash()
+	if !bytes.Equal(hash, oldHash) {
+		t.Errorf("Unexpected NDF hash.\n\texpected: %q\n\treceived: %q",
+			oldHash, hash)
+	}
+
+	// Reporting the same hash does not change when it was first reported
+	s.RecordNdfHash(oldHash, false)
+	if _, since2 := s.GetNdfHash(); !since2.Equal(since) {
+		t.Errorf("Time the NDF hash was first reported changed."+
+			"\n\texpected: %s\n\treceived: %s", since, since2)
+	}
+
+	// Reporting the current NDF resets the count
+	if stalePolls := s.RecordNdfHash(newHash, true); stalePolls != 0 {
+		t.Errorf("Stale polls not reset for the current NDF."+
+			"\n\texpected: %d\n\treceived: %d", 0, stalePolls)
+	}
+	if hash, _ = s.GetNdfHash(); !bytes.Equal(hash, newHash) {
+		t.Errorf("Unexpected NDF hash.\n\texpected: %q\n\treceived: %q",
+			newHash, hash)
+	}
+	if s.GetStaleNdfPolls() != 0 {
+		t.Errorf("Unexpected number of stale polls."+
+			"\n\texpected: %d\n\treceived: %d", 0, s.GetStaleNdfPolls())
+	}
+}
+
+// Tests that AddRoundlessError() counts errors reported without a round, which
+// GetSnapshot() includes, until ResetRoundlessErrors() resets the count.
+func TestState_AddRoundlessError(t *testing.T) {
+	s := State{}
+	for i := uint32(1); i <= 3; i++ {
+		if count := s.AddRoundlessError(); count != i {
+			t.Errorf("Unexpected roundless error count for error %d."+
+				"\n\texpected: %d\n\treceived: %d", i, i, count)
+		}
+	}
+	if snapshot := s.GetSnapshot(); snapshot.RoundlessErrors != 3 {
+		t.Errorf("Unexpected roundless errors in snapshot."+
+			"\n\texpected: %d\n\treceived: %d", 3, snapshot.RoundlessErrors)
+	}
+
+	s.ResetRoundlessErrors()
+	if count := s.GetRoundlessErrors(); count != 0 {
+		t.Errorf("Roundless error count not reset.\n\texpected: %d"+
+			"\n\treceived: %d", 0, count)
+	}
+}
+
+// Tests that update notifications are given increasing sequence numbers and
+// that MarkUpdateHandled() only accepts each sequence number once and in order.
+func TestState_MarkUpdateHandled(t *testing.T) {
+	s := State{id: id.NewIdFromUInt(50, id.Node, t), status: Active}
+
+	nun1, err := s.Decommission()
+	if err != nil {
+		t.Fatalf("Failed to decommission node: %+v", err)
+	}
+	nun2, err := s.Ban()
+	if err != nil {
+		t.Fatalf("Failed to ban node: %+v", err)
+	}
+	if nun1.Sequence != 1 || nun2.Sequence != 2 {
+		t.Errorf("Unexpected update sequence numbers."+
+			"\n\texpected: %d, %d\n\treceived: %d, %d",
+			1, 2, nun1.Sequence, nun2.Sequence)
+	}
+
+	tests := []struct {
+		sequence uint64
+		handled  bool
+	}{{1, true}, {1, false}, {2, true}, {1, false}, {2, false}, {0, true}, {0, true}}
+	for i, tt := range tests {
+		if handled := s.MarkUpdateHandled(tt.sequence); handled != tt.handled {
+			t.Errorf("Unexpected result for sequence %d (%d)."+
+				"\n\texpected: %t\n\treceived: %t", tt.sequence, i,
+				tt.handled, handled)
+		}
+	}
+}
+
+// Tests that recordPollInterval() tracks the min, max, and mean interval
+// between polls and that GetAndResetPollIntervals() resets them.
+func TestState_GetAndResetPollIntervals(t *testing.T) {
+	s := State{}
+	start := time.Unix(0, 0)
+
+	s.recordPollInterval(start)
+	s.recordPollInterval(start.Add(1 * time.Second))
+	s.recordPollInterval(start.Add(4 * time.Second))
+	s.recordPollInterval(start.Add(6 * time.Second))
+
+	expected := PollIntervals{
+		Count: 3,
+		Min:   1 * time.Second,
+		Max:   3 * time.Second,
+		Total: 6 * time.Second,
+	}
+	pi := s.GetAndResetPollIntervals()
+	if pi != expected {
+		t.Errorf("Returned incorrect poll intervals."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, pi)
+	}
+	if pi.Mean() != 2*time.Second {
+		t.Errorf("Returned incorrect mean interval."+
+			"\n\texpected: %s\n\treceived: %s", 2*time.Second, pi.Mean())
+	}
+
+	if pi = s.GetAndResetPollIntervals(); pi.Count != 0 || pi.Mean() != 0 {
+		t.Errorf("Poll intervals should have been reset: %+v", pi)
+	}
+
+	// The interval spanning the reset is still counted
+	s.recordPollInterval(start.Add(11 * time.Second))
+	if pi = s.GetAndResetPollIntervals(); pi.Count != 1 || pi.Max != 5*time.Second {
+		t.Errorf("Interval spanning the reset was not recorded: %+v", pi)
+	}
+}
+
+// Tests that GetAndResetLatencySamples() returns the intervals between polls,
+// keeps at most maxLatencySamples of them, and resets them.
+func TestState_GetAndResetLatencySamples(t *testing.T) {
+	s := State{}
+	start := time.Unix(0, 0)
+
+	s.recordPollInterval(start)
+	s.recordPollInterval(start.Add(1 * time.Second))
+	s.recordPollInterval(start.Add(4 * time.Second))
+
+	expected := []time.Duration{1 * time.Second, 3 * time.Second}
+	samples := s.GetAndResetLatencySamples()
+	if !reflect.DeepEqual(expected, samples) {
+		t.Errorf("Returned incorrect latency samples."+
+			"\n\texpected: %v\n\treceived: %v", expected, samples)
+	}
+	if samples = s.GetAndResetLatencySamples(); len(samples) != 0 {
+		t.Errorf("Latency samples should have been reset: %v", samples)
+	}
+
+	// Only maxLatencySamples of a longer period are kept
+	for i := 0; i < 3*maxLatencySamples; i++ {
+		s.recordPollInterval(start.Add(time.Duration(i+5) * time.Second))
+	}
+	if samples = s.GetAndResetLatencySamples(); len(samples) != maxLatencySamples {
+		t.Errorf("Unexpected number of latency samples."+
+			"\n\texpected: %d\n\treceived: %d", maxLatencySamples, len(samples))
+	}
+}
+
 // tests that State update functions properly when the state it is updated
 // to is not the one it is not at
 func TestNodeState_Update_Invalid(t *testing.T) {
@@ -584,6 +788,36 @@ func TestState_IsBanned(t *testing.T) {
 	}
 }
 
+func TestState_Decommission(t *testing.T) {
+	testID := id.NewIdFromUInt(50, id.Node, t)
+	ns := State{
+		id:     testID,
+		status: Active,
+	}
+
+	// Test that a node gets updated after decommissioning
+	nun, err := ns.Decommission()
+	if err != nil {
+		t.Errorf("Unexpected error in happy path: %+v", err)
+	}
+
+	if ns.status != Decommissioned || !ns.IsDecommissioned() {
+		t.Errorf("Node status not updated after decommissioning."+
+			"\n\tExpected: %v"+
+			"\n\tReceived: %v", Decommissioned, ns.status)
+	}
+
+	if nun.FromStatus != Active || nun.ToStatus != Decommissioned {
+		t.Errorf("Unexpected update notification: %+v", nun)
+	}
+
+	// Attempt to decommission an already decommissioned node
+	_, err = ns.Decommission()
+	if err == nil {
+		t.Errorf("Should not be able to decommission a decommissioned node")
+	}
+}
+
 // Happy path
 func TestState_UpdateInactive(t *testing.T) {
 	testID := id.NewIdFromUInt(50, id.Node, t)
@@ -611,6 +845,7 @@ func TestState_UpdateInactive(t *testing.T) {
 		ToStatus:     Active,
 		FromActivity: oldActivity,
 		ToActivity:   current.WAITING,
+		Sequence:     1,
 	}
 
 	// Check that the node's status has been updated
@@ -707,3 +942,24 @@ func TestState_UpdateInactive_InvalidActivity(t *testing.T) {
 	}
 
 }
+
+// Tests that SetAddresses() sets the addresses regardless of when they were
+// last updated and that reported addresses are then rejected until the
+// timeout passes.
+func TestState_SetAddresses(t *testing.T) {
+	ns := State{}
+	if _, err := ns.UpdateNodeAddresses("1.1.1.1:1"); err != nil {
+		t.Fatalf("UpdateNodeAddresses() returned an error: %+v", err)
+	}
+
+	ns.SetAddresses("2.2.2.2:1", "2.2.2.2:2")
+	if ns.GetNodeAddresses() != "2.2.2.2:1" ||
+		ns.GetGatewayAddress() != "2.2.2.2:2" {
+		t.Errorf("SetAddresses() did not set the addresses: %s, %s",
+			ns.GetNodeAddresses(), ns.GetGatewayAddress())
+	}
+
+	if _, err := ns.UpdateGatewayAddresses("3.3.3.3:2"); err == nil {
+		t.Errorf("Gateway address updated right after SetAddresses().")
+	}
+}
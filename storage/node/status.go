@@ -15,10 +15,11 @@ package node
 type Status uint8
 
 const (
-	Unregistered = Status(iota) // Default state, equivalent to NULL
-	Active                      // Operational, active Node which will be considered for team
-	Inactive                    // Inactive for a certain amount of time, not considered for teams
-	Banned                      // Stop any teams and ban from teams until manually overridden
+	Unregistered   = Status(iota) // Default state, equivalent to NULL
+	Active                        // Operational, active Node which will be considered for team
+	Inactive                      // Inactive for a certain amount of time, not considered for teams
+	Banned                        // Stop any teams and ban from teams until manually overridden
+	Decommissioned                // Permanently removed by an operator, not considered for teams
 )
 
 // Stringer for the status type
@@ -32,6 +33,8 @@ func (s Status) String() string {
 		return "Inactive"
 	case Banned:
 		return "Banned"
+	case Decommissioned:
+		return "Decommissioned"
 	default:
 		return "Unknown"
 	}
@@ -13,9 +13,9 @@ import "testing"
 func TestStatus_String(t *testing.T) {
 
 	expected := []string{"Unregistered", "Active", "Inactive", "Banned",
-		"Unknown"}
+		"Decommissioned", "Unknown"}
 
-	for i := 0; i < 5; i++ {
+	for i := 0; i < 6; i++ {
 		s := Status(i)
 		if s.String() != expected[i] {
 			t.Errorf("Stringer of status %v incoorect; "+
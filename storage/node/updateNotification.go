@@ -25,4 +25,13 @@ type UpdateNotification struct {
 	ToActivity   current.Activity
 	Error        *mixmessages.RoundError
 	ClientErrors []*mixmessages.ClientError
+
+	// Reason given for a status change, included in the error of any round
+	// killed because of it
+	Reason string
+
+	// Sequence number of the update among the updates of the Node, used to
+	// ignore an update that is handled more than once. Updates with a
+	// sequence number of 0 are always handled.
+	Sequence uint64
 }
@@ -10,6 +10,8 @@
 package storage
 
 import (
+	"bytes"
+	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/registration/storage/node"
@@ -45,6 +47,52 @@ func (d *DatabaseImpl) UpdateNodeSequence(id *id.ID, sequence string) error {
 	return d.db.Take(&newNode, "id = ?", id.Marshal()).Update("sequence", sequence).Error
 }
 
+// Set the status of the Node with the given id to decommissioned and record
+// the time of the decommission
+func (d *DatabaseImpl) DecommissionNode(id *id.ID, timestamp time.Time) error {
+	result := d.db.Model(&Node{}).Where("id = ?", id.Marshal()).
+		Updates(map[string]interface{}{
+			"status":              uint8(node.Decommissioned),
+			"date_decommissioned": timestamp,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errors.Errorf("Unable to decommission node %s: node not found",
+			id)
+	}
+	return nil
+}
+
+// Set the status of the Node with the given id to banned and record the time
+// of and reason for the ban
+func (d *DatabaseImpl) BanNode(id *id.ID, reason string, timestamp time.Time) error {
+	result := d.db.Model(&Node{}).Where("id = ?", id.Marshal()).
+		Updates(map[string]interface{}{
+			"status":      uint8(node.Banned),
+			"date_banned": timestamp,
+			"ban_reason":  reason,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errors.Errorf("Unable to ban node %s: node not found", id)
+	}
+	return nil
+}
+
+// Get the Application with the given applicationId
+func (d *DatabaseImpl) GetApplication(appId uint64) (*Application, error) {
+	app := &Application{}
+	err := d.db.Take(app, "id = ?", appId).Error
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to find application with id %d", appId)
+	}
+	return app, nil
+}
+
 // Update the given applicationId with the given GeoIP information
 func (d *DatabaseImpl) UpdateGeoIP(appId uint64, location, geoBin, gpsLocation string) error {
 	app := &Application{
@@ -72,6 +120,21 @@ func (d *DatabaseImpl) updateLastActive(ids [][]byte, lastActive time.Time) erro
 		Update("last_active", lastActive).Error
 }
 
+// Update LastActive field for all given Node IDs in the map
+func (m *MapImpl) updateLastActive(ids [][]byte, lastActive time.Time) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for _, nodeId := range ids {
+		for _, n := range m.nodes {
+			if bytes.Equal(n.Id, nodeId) {
+				n.LastActive = lastActive
+			}
+		}
+	}
+	return nil
+}
+
 // If Node registration code is valid, add Node information
 func (d *DatabaseImpl) RegisterNode(id *id.ID, salt []byte, code, serverAddr, serverCert,
 	gatewayAddress, gatewayCert string) error {
@@ -89,6 +152,48 @@ func (d *DatabaseImpl) RegisterNode(id *id.ID, salt []byte, code, serverAddr, se
 	return d.db.Model(&newNode).Update(&newNode).Error
 }
 
+// NodeRegistration contains the information stored for a Node registering
+// with its registration code.
+type NodeRegistration struct {
+	Id                 *id.ID
+	Salt               []byte
+	Code               string
+	ServerAddress      string
+	ServerCertificate  string
+	GatewayAddress     string
+	GatewayCertificate string
+}
+
+// RegisterNodes adds the Node information for each registration in a single
+// transaction. If any registration code is invalid or any update fails, the
+// transaction is rolled back and no Nodes are registered.
+func (d *DatabaseImpl) RegisterNodes(registrations []NodeRegistration) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, r := range registrations {
+			newNode := Node{
+				Code:               r.Code,
+				Id:                 r.Id.Marshal(),
+				Salt:               r.Salt,
+				ServerAddress:      r.ServerAddress,
+				GatewayAddress:     r.GatewayAddress,
+				NodeCertificate:    r.ServerCertificate,
+				GatewayCertificate: r.GatewayCertificate,
+				Status:             uint8(node.Active),
+				DateRegistered:     time.Now(),
+			}
+			result := tx.Model(&newNode).Update(&newNode)
+			if result.Error != nil {
+				return errors.Errorf("Failed to register node with "+
+					"registration code %s: %+v", r.Code, result.Error)
+			} else if result.RowsAffected == 0 {
+				return errors.Errorf("No node with registration code %s "+
+					"to register", r.Code)
+			}
+		}
+		return nil
+	})
+}
+
 // Get Node information for the given Node registration code
 func (d *DatabaseImpl) GetNode(code string) (*Node, error) {
 	newNode := &Node{}
@@ -110,6 +215,43 @@ func (d *DatabaseImpl) GetNodeById(id *id.ID) (*Node, error) {
 	return newNode, err
 }
 
+// Get Node information for the given Node ID from the map
+func (m *MapImpl) GetNodeById(id *id.ID) (*Node, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for _, n := range m.nodes {
+		if bytes.Equal(n.Id, id.Marshal()) {
+			return n, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// Get the Application of the Node with the given Node ID
+func (d *DatabaseImpl) GetNodeApplication(id *id.ID) (*Application, error) {
+	app := &Application{}
+	err := d.db.Joins("JOIN nodes ON nodes.application_id = applications.id").
+		Take(app, "nodes.id = ?", id.Marshal()).Error
+	return app, err
+}
+
+// Get the Application of the Node with the given Node ID from the map
+func (m *MapImpl) GetNodeApplication(id *id.ID) (*Application, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for _, n := range m.nodes {
+		if bytes.Equal(n.Id, id.Marshal()) {
+			if app, exists := m.applications[n.ApplicationId]; exists {
+				return app, nil
+			}
+			break
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
 // Return all nodes in Storage with the given Status
 func (d *DatabaseImpl) GetNodesByStatus(status node.Status) ([]*Node, error) {
 	var nodes []*Node
@@ -119,6 +261,28 @@ func (d *DatabaseImpl) GetNodesByStatus(status node.Status) ([]*Node, error) {
 	return nodes, err
 }
 
+// Return all registered nodes in Storage whose LastActive is before the cutoff
+func (d *DatabaseImpl) GetNodesInactiveSince(cutoff time.Time) ([]*Node, error) {
+	var nodes []*Node
+	err := d.db.Where("id IS NOT NULL AND last_active < ?", cutoff).
+		Find(&nodes).Error
+	return nodes, err
+}
+
+// Return all registered nodes in the map whose LastActive is before the cutoff
+func (m *MapImpl) GetNodesInactiveSince(cutoff time.Time) ([]*Node, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var nodes []*Node
+	for _, n := range m.nodes {
+		if n.Id != nil && n.LastActive.Before(cutoff) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
 // Return all ActiveNodes in Storage
 func (d *DatabaseImpl) GetActiveNodes() ([]*ActiveNode, error) {
 	var activeNodes []*ActiveNode
@@ -126,6 +290,26 @@ func (d *DatabaseImpl) GetActiveNodes() ([]*ActiveNode, error) {
 	return activeNodes, err
 }
 
+// Return the ActiveNode with the given wallet address from Storage
+func (d *DatabaseImpl) GetActiveNodeByWallet(wallet string) (*ActiveNode, error) {
+	activeNode := &ActiveNode{}
+	err := d.db.Take(activeNode, "wallet_address = ?", wallet).Error
+	return activeNode, err
+}
+
+// Return the ActiveNode with the given wallet address from the map
+func (m *MapImpl) GetActiveNodeByWallet(wallet string) (*ActiveNode, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for _, activeNode := range m.activeNodes {
+		if activeNode.WalletAddress == wallet {
+			return activeNode, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
 // If Node registration code is valid, add Node information
 // This was originally part of the map impl, and is only used in testing
 func (d *DatabaseImpl) BannedNode(id *id.ID, t interface{}) error {
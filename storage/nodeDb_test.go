@@ -8,12 +8,15 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
 	"github.com/jinzhu/gorm"
 	"gitlab.com/elixxir/registration/storage/node"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/region"
+	"strconv"
 	"testing"
+	"time"
 )
 
 // Happy path
@@ -172,6 +175,91 @@ func TestDatabaseImpl_RegisterNode(t *testing.T) {
 	}
 }
 
+// Happy path: registers multiple nodes in a single transaction
+func TestDatabaseImpl_RegisterNodes(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_RegisterNodes", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	registrations := []NodeRegistration{
+		{Id: id.NewIdFromUInt(0, id.Node, t), Salt: []byte("salt0"), Code: "AAAA",
+			ServerAddress: "addr0", ServerCertificate: "cert0",
+			GatewayAddress: "gwAddr0", GatewayCertificate: "gwCert0"},
+		{Id: id.NewIdFromUInt(1, id.Node, t), Salt: []byte("salt1"), Code: "BBBB",
+			ServerAddress: "addr1", ServerCertificate: "cert1",
+			GatewayAddress: "gwAddr1", GatewayCertificate: "gwCert1"},
+	}
+	for i, r := range registrations {
+		err = d.InsertApplication(&Application{Id: uint64(i + 1)}, &Node{Code: r.Code})
+		if err != nil {
+			t.Fatalf("Failed to set up reg code %s: %+v", r.Code, err)
+		}
+	}
+
+	err = d.RegisterNodes(registrations)
+	if err != nil {
+		t.Fatalf("RegisterNodes returned an error: %+v", err)
+	}
+
+	for _, r := range registrations {
+		info, err := d.GetNode(r.Code)
+		if err != nil || !bytes.Equal(info.Id, r.Id.Marshal()) ||
+			info.NodeCertificate != r.ServerCertificate ||
+			info.GatewayCertificate != r.GatewayCertificate ||
+			info.ServerAddress != r.ServerAddress ||
+			info.GatewayAddress != r.GatewayAddress {
+			t.Errorf("Expected to successfully insert node information: %+v", info)
+		}
+	}
+}
+
+// Error path: an invalid registration code rolls back the whole batch
+func TestDatabaseImpl_RegisterNodes_Rollback(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_RegisterNodes_Rollback", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	err = d.InsertApplication(&Application{Id: 1}, &Node{Code: "AAAA"})
+	if err != nil {
+		t.Fatalf("Failed to set up reg code: %+v", err)
+	}
+
+	// Do NOT load in the second registration code
+	registrations := []NodeRegistration{
+		{Id: id.NewIdFromUInt(0, id.Node, t), Salt: []byte("salt0"), Code: "AAAA",
+			ServerAddress: "addr0", ServerCertificate: "cert0"},
+		{Id: id.NewIdFromUInt(1, id.Node, t), Salt: []byte("salt1"), Code: "BBBB",
+			ServerAddress: "addr1", ServerCertificate: "cert1"},
+	}
+
+	err = d.RegisterNodes(registrations)
+	if err == nil {
+		t.Fatalf("RegisterNodes did not fail for an invalid registration code")
+	}
+
+	info, err := d.GetNode("AAAA")
+	if err != nil {
+		t.Fatalf("Failed to get node: %+v", err)
+	}
+	if len(info.Id) != 0 || info.ServerAddress != "" {
+		t.Errorf("Registration of valid code was not rolled back: %+v", info)
+	}
+}
+
 // Error path: Invalid registration code
 func TestDatabaseImpl_RegisterNode_Invalid(t *testing.T) {
 	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_RegisterNode_Invalid", "", "")
@@ -300,6 +388,82 @@ func TestDatabaseImpl_GetNodeById_Invalid(t *testing.T) {
 	}
 }
 
+// Tests that GetNodeApplication() returns the Application of the node and an
+// error for an unknown node.
+func TestDatabaseImpl_GetNodeApplication(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetNodeApplication", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	ids := []*id.ID{id.NewIdFromUInt(0, id.Node, t), id.NewIdFromUInt(1, id.Node, t)}
+	for i, nid := range ids {
+		err = d.InsertApplication(
+			&Application{Id: uint64(i + 1), Name: "app" + strconv.Itoa(i)},
+			&Node{Code: "TEST" + strconv.Itoa(i), Id: nid.Marshal(),
+				ApplicationId: uint64(i + 1)})
+		if err != nil {
+			t.Fatalf("Failed to insert application: %+v", err)
+		}
+	}
+
+	app, err := d.GetNodeApplication(ids[1])
+	if err != nil {
+		t.Fatalf("GetNodeApplication() returned an error: %+v", err)
+	}
+	if app.Id != 2 || app.Name != "app1" {
+		t.Errorf("Unexpected application.\n\texpected: %d %s"+
+			"\n\treceived: %d %s", 2, "app1", app.Id, app.Name)
+	}
+
+	_, err = d.GetNodeApplication(id.NewIdFromUInt(2, id.Node, t))
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for an unknown node."+
+			"\n\texpected: %v\n\treceived: %+v", gorm.ErrRecordNotFound, err)
+	}
+}
+
+// Tests that MapImpl.GetNodeById() and MapImpl.GetNodeApplication() find the
+// node and its Application in the maps and return an error for an unknown node.
+func TestMapImpl_GetNodeApplication(t *testing.T) {
+	ids := []*id.ID{id.NewIdFromUInt(0, id.Node, t), id.NewIdFromUInt(1, id.Node, t)}
+	m := &MapImpl{
+		nodes: map[string]*Node{
+			"TEST0": {Code: "TEST0", Id: ids[0].Marshal(), ApplicationId: 1},
+			"TEST1": {Code: "TEST1", Id: ids[1].Marshal(), ApplicationId: 2},
+		},
+		applications: map[uint64]*Application{
+			1: {Id: 1, Name: "app0"},
+			2: {Id: 2, Name: "app1"},
+		},
+	}
+
+	n, err := m.GetNodeById(ids[1])
+	if err != nil || n.Code != "TEST1" {
+		t.Errorf("Unexpected node for %s: %+v %+v", ids[1], n, err)
+	}
+	app, err := m.GetNodeApplication(ids[1])
+	if err != nil || app.Name != "app1" {
+		t.Errorf("Unexpected application for %s: %+v %+v", ids[1], app, err)
+	}
+
+	unknown := id.NewIdFromUInt(2, id.Node, t)
+	if _, err = m.GetNodeById(unknown); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for an unknown node."+
+			"\n\texpected: %v\n\treceived: %+v", gorm.ErrRecordNotFound, err)
+	}
+	if _, err = m.GetNodeApplication(unknown); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for an unknown node."+
+			"\n\texpected: %v\n\treceived: %+v", gorm.ErrRecordNotFound, err)
+	}
+}
+
 // Happy path
 func TestDatabaseImpl_GetNodesByStatus(t *testing.T) {
 	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetNodesByStatus", "", "")
@@ -357,6 +521,157 @@ func TestDatabaseImpl_GetNodesByStatus(t *testing.T) {
 	}
 }
 
+// Happy path: only registered nodes that have not been active since the cutoff
+// are returned
+func TestDatabaseImpl_GetNodesInactiveSince(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetNodesInactiveSince", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	// Register nodes AAAA and BBBB, leaving CCCC unregistered
+	codes := []string{"AAAA", "BBBB", "CCCC"}
+	nodeIds := make([]*id.ID, len(codes))
+	for i, code := range codes {
+		err = d.InsertApplication(&Application{Id: uint64(i + 1)}, &Node{Code: code})
+		if err != nil {
+			t.Fatalf("Failed to insert application: %+v", err)
+		}
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		if code != "CCCC" {
+			err = d.RegisterNode(nodeIds[i], []byte("test"), code, "", "", "", "")
+			if err != nil {
+				t.Fatalf("Failed to register node: %+v", err)
+			}
+		}
+	}
+
+	// Mark AAAA active
+	err = d.UpdateLastActive([]*id.ID{nodeIds[0]})
+	if err != nil {
+		t.Fatalf("Failed to update last active: %+v", err)
+	}
+
+	nodes, err := d.GetNodesInactiveSince(time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GetNodesInactiveSince() returned an error: %+v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Code != "BBBB" {
+		t.Errorf("Unexpected inactive nodes.\n\texpected: %s\n\treceived: %+v",
+			"BBBB", nodes)
+	}
+
+	// All registered nodes are inactive since a cutoff in the future
+	nodes, err = d.GetNodesInactiveSince(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetNodesInactiveSince() returned an error: %+v", err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("Unexpected number of inactive nodes."+
+			"\n\texpected: %d\n\treceived: %d", 2, len(nodes))
+	}
+}
+
+// Happy path: the map only returns registered nodes that have not been active
+// since the cutoff
+func TestMapImpl_GetNodesInactiveSince(t *testing.T) {
+	active := id.NewIdFromUInt(0, id.Node, t)
+	inactive := id.NewIdFromUInt(1, id.Node, t)
+	m := &MapImpl{nodes: map[string]*Node{
+		"AAAA": {Code: "AAAA", Id: active.Marshal()},
+		"BBBB": {Code: "BBBB", Id: inactive.Marshal()},
+		"CCCC": {Code: "CCCC"},
+	}}
+
+	err := m.updateLastActive([][]byte{active.Marshal()}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to update last active: %+v", err)
+	}
+
+	nodes, err := m.GetNodesInactiveSince(time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GetNodesInactiveSince() returned an error: %+v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Code != "BBBB" {
+		t.Errorf("Unexpected inactive nodes.\n\texpected: %s\n\treceived: %+v",
+			"BBBB", nodes)
+	}
+}
+
+// Tests that GetActiveNodeByWallet() returns the ActiveNode with the wallet
+// address and a not found error for an unknown wallet address.
+func TestDatabaseImpl_GetActiveNodeByWallet(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetActiveNodeByWallet", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	db := d.GetDatabaseImpl(t)
+
+	wallets := []string{"wallet0", "wallet1"}
+	for i, wallet := range wallets {
+		err = db.db.Create(&ActiveNode{WalletAddress: wallet,
+			Id: id.NewIdFromUInt(uint64(i), id.Node, t).Marshal()}).Error
+		if err != nil {
+			t.Fatalf("Failed to insert active node: %+v", err)
+		}
+	}
+
+	activeNode, err := d.GetActiveNodeByWallet(wallets[1])
+	if err != nil {
+		t.Fatalf("GetActiveNodeByWallet() returned an error: %+v", err)
+	}
+	expectedId := id.NewIdFromUInt(1, id.Node, t).Marshal()
+	if activeNode.WalletAddress != wallets[1] ||
+		!bytes.Equal(activeNode.Id, expectedId) {
+		t.Errorf("Unexpected active node.\n\texpected: %s %v\n\treceived: %+v",
+			wallets[1], expectedId, activeNode)
+	}
+
+	_, err = d.GetActiveNodeByWallet("unknown")
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for an unknown wallet."+
+			"\n\texpected: %v\n\treceived: %+v", gorm.ErrRecordNotFound, err)
+	}
+}
+
+// Tests that MapImpl.GetActiveNodeByWallet() returns the ActiveNode with the
+// wallet address and a not found error for an unknown wallet address.
+func TestMapImpl_GetActiveNodeByWallet(t *testing.T) {
+	ids := []*id.ID{id.NewIdFromUInt(0, id.Node, t), id.NewIdFromUInt(1, id.Node, t)}
+	m := &MapImpl{activeNodes: map[id.ID]*ActiveNode{
+		*ids[0]: {WalletAddress: "wallet0", Id: ids[0].Marshal()},
+		*ids[1]: {WalletAddress: "wallet1", Id: ids[1].Marshal()},
+	}}
+
+	activeNode, err := m.GetActiveNodeByWallet("wallet1")
+	if err != nil {
+		t.Fatalf("GetActiveNodeByWallet() returned an error: %+v", err)
+	}
+	if !bytes.Equal(activeNode.Id, ids[1].Marshal()) {
+		t.Errorf("Unexpected active node.\n\texpected: %v\n\treceived: %v",
+			ids[1].Marshal(), activeNode.Id)
+	}
+
+	_, err = m.GetActiveNodeByWallet("unknown")
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error for an unknown wallet."+
+			"\n\texpected: %v\n\treceived: %+v", gorm.ErrRecordNotFound, err)
+	}
+}
+
 // Happy path
 func TestDatabaseImpl_UpdateNodeAddresses(t *testing.T) {
 	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_UpdateNodeAddresses", "", "")
@@ -442,3 +757,179 @@ func TestDatabaseImpl_UpdateSequence(t *testing.T) {
 			result.Sequence, testResult)
 	}
 }
+
+// Happy path
+func TestDatabaseImpl_DecommissionNode(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_DecommissionNode", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testString := "test"
+	testId := id.NewIdFromString(testString, id.Node, t)
+	applicationId := uint64(10)
+	err = d.InsertApplication(&Application{Id: applicationId}, &Node{
+		Code:          testString,
+		Id:            testId.Marshal(),
+		Status:        uint8(node.Active),
+		ApplicationId: applicationId,
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert data for decommission test: %+v", err)
+	}
+
+	timestamp := time.Unix(1000, 0)
+	err = d.DecommissionNode(testId, timestamp)
+	if err != nil {
+		t.Errorf("Failed to decommission node: %+v", err)
+	}
+
+	nodes, err := d.GetNodesByStatus(node.Decommissioned)
+	if err != nil {
+		t.Fatalf("Unable to get nodes by status: %+v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Code != testString {
+		t.Fatalf("Unexpected nodes returned for status: %v", nodes)
+	}
+	if !nodes[0].DateDecommissioned.Equal(timestamp) {
+		t.Errorf("Decommission time not stored."+
+			"\n\texpected: %s\n\treceived: %s",
+			timestamp, nodes[0].DateDecommissioned)
+	}
+
+	nodes, err = d.GetNodesByStatus(node.Active)
+	if err != nil {
+		t.Fatalf("Unable to get nodes by status: %+v", err)
+	}
+	if len(nodes) > 0 {
+		t.Errorf("Unexpected nodes returned for status: %v", nodes)
+	}
+}
+
+// Error path: the node does not exist
+func TestDatabaseImpl_DecommissionNode_Invalid(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_DecommissionNode_Invalid", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	err = d.DecommissionNode(id.NewIdFromString("test", id.Node, t), time.Now())
+	if err == nil {
+		t.Errorf("Expected error decommissioning a nonexistent node")
+	}
+}
+
+// Tests that BanNode() stores the banned status, time, and reason.
+func TestDatabaseImpl_BanNode(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_BanNode", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testString := "test"
+	testId := id.NewIdFromString(testString, id.Node, t)
+	applicationId := uint64(10)
+	err = d.InsertApplication(&Application{Id: applicationId}, &Node{
+		Code:          testString,
+		Id:            testId.Marshal(),
+		Status:        uint8(node.Active),
+		ApplicationId: applicationId,
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert data for ban test: %+v", err)
+	}
+
+	timestamp := time.Unix(1000, 0)
+	reason := "Node is serving invalid rounds"
+	err = d.BanNode(testId, reason, timestamp)
+	if err != nil {
+		t.Errorf("Failed to ban node: %+v", err)
+	}
+
+	nodes, err := d.GetNodesByStatus(node.Banned)
+	if err != nil {
+		t.Fatalf("Unable to get nodes by status: %+v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Code != testString {
+		t.Fatalf("Unexpected nodes returned for status: %v", nodes)
+	}
+	if !nodes[0].DateBanned.Equal(timestamp) {
+		t.Errorf("Ban time not stored.\n\texpected: %s\n\treceived: %s",
+			timestamp, nodes[0].DateBanned)
+	}
+	if nodes[0].BanReason != reason {
+		t.Errorf("Ban reason not stored.\n\texpected: %s\n\treceived: %s",
+			reason, nodes[0].BanReason)
+	}
+}
+
+// Error path: the node does not exist.
+func TestDatabaseImpl_BanNode_Invalid(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_BanNode_Invalid", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	err = d.BanNode(id.NewIdFromString("test", id.Node, t), "", time.Now())
+	if err == nil {
+		t.Errorf("Expected error banning a nonexistent node")
+	}
+}
+
+// Happy path
+func TestDatabaseImpl_GetApplication(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetApplication", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	applicationId := uint64(10)
+	err = d.InsertApplication(&Application{Id: applicationId, GpsLocation: "1.0, 2.0"},
+		&Node{Code: "test"})
+	if err != nil {
+		t.Fatalf("Failed to insert application: %+v", err)
+	}
+
+	app, err := d.GetApplication(applicationId)
+	if err != nil {
+		t.Fatalf("Failed to get application: %+v", err)
+	}
+	if app.Id != applicationId || app.GpsLocation != "1.0, 2.0" {
+		t.Errorf("Unexpected application returned: %+v", app)
+	}
+
+	_, err = d.GetApplication(applicationId + 1)
+	if err == nil {
+		t.Errorf("Expected error getting a nonexistent application")
+	}
+}
@@ -0,0 +1,143 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles storing samples of node latency and computing their percentiles
+
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"math"
+	"sort"
+	"time"
+)
+
+// Insert the latency samples of the given Node, taken during the monitoring
+// period ending at timestamp, into Storage
+func (d *DatabaseImpl) InsertNodeLatency(nodeId *id.ID, timestamp time.Time,
+	samples []time.Duration) error {
+	jww.TRACE.Printf("Attempting to insert %d NodeLatency for %s into DB",
+		len(samples), nodeId)
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for _, latency := range newNodeLatencies(nodeId, timestamp, samples) {
+			if err := tx.Create(latency).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Insert the latency samples of the given Node, taken during the monitoring
+// period ending at timestamp, into the map
+func (m *MapImpl) InsertNodeLatency(nodeId *id.ID, timestamp time.Time,
+	samples []time.Duration) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.latencySamples == nil {
+		m.latencySamples = make(map[uint64]*NodeLatency)
+	}
+
+	// Mirror the auto-incrementing primary key of the Database
+	for _, latency := range newNodeLatencies(nodeId, timestamp, samples) {
+		m.latencyCounter++
+		latency.Id = m.latencyCounter
+		m.latencySamples[latency.Id] = latency
+	}
+	return nil
+}
+
+// Returns the given percentiles, between 0 and 100, of the latency samples of
+// each Node with a Timestamp between start and end, inclusive, from Storage
+func (d *DatabaseImpl) GetNodeLatencyPercentiles(start, end time.Time,
+	percentiles []float64) (map[id.ID][]time.Duration, error) {
+	var latencies []*NodeLatency
+	err := d.db.Where("? <= timestamp AND timestamp <= ?", start, end).
+		Find(&latencies).Error
+	if err != nil {
+		return nil, err
+	}
+	return nodeLatencyPercentiles(latencies, percentiles)
+}
+
+// Returns the given percentiles, between 0 and 100, of the latency samples of
+// each Node with a Timestamp between start and end, inclusive, from the map
+func (m *MapImpl) GetNodeLatencyPercentiles(start, end time.Time,
+	percentiles []float64) (map[id.ID][]time.Duration, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	latencies := make([]*NodeLatency, 0)
+	for _, latency := range m.latencySamples {
+		if !latency.Timestamp.Before(start) && !latency.Timestamp.After(end) {
+			latencies = append(latencies, latency)
+		}
+	}
+	return nodeLatencyPercentiles(latencies, percentiles)
+}
+
+// newNodeLatencies builds the NodeLatency rows for the samples.
+func newNodeLatencies(nodeId *id.ID, timestamp time.Time,
+	samples []time.Duration) []*NodeLatency {
+	latencies := make([]*NodeLatency, len(samples))
+	for i, sample := range samples {
+		latencies[i] = &NodeLatency{
+			NodeId:    nodeId.Marshal(),
+			Timestamp: timestamp,
+			Latency:   sample.Milliseconds(),
+		}
+	}
+	return latencies
+}
+
+// nodeLatencyPercentiles groups the latency samples by Node and returns the
+// given percentiles of each group.
+func nodeLatencyPercentiles(latencies []*NodeLatency,
+	percentiles []float64) (map[id.ID][]time.Duration, error) {
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, errors.Errorf("Percentile %v is not between 0 and 100", p)
+		}
+	}
+
+	samples := make(map[id.ID][]int64)
+	for _, latency := range latencies {
+		nodeId, err := id.Unmarshal(latency.NodeId)
+		if err != nil {
+			return nil, errors.Errorf("Failed to unmarshal ID of NodeLatency "+
+				"%d: %+v", latency.Id, err)
+		}
+		samples[*nodeId] = append(samples[*nodeId], latency.Latency)
+	}
+
+	result := make(map[id.ID][]time.Duration, len(samples))
+	for nodeId, nodeSamples := range samples {
+		result[nodeId] = percentilesOf(nodeSamples, percentiles)
+	}
+	return result, nil
+}
+
+// percentilesOf returns the given percentiles of the millisecond samples using
+// the nearest-rank method, so that each percentile is one of the samples. The
+// samples are sorted in place and must not be empty.
+func percentilesOf(samples []int64, percentiles []float64) []time.Duration {
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	result := make([]time.Duration, len(percentiles))
+	for i, p := range percentiles {
+		rank := int(math.Ceil(p / 100 * float64(len(samples))))
+		if rank < 1 {
+			rank = 1
+		}
+		result[i] = time.Duration(samples[rank-1]) * time.Millisecond
+	}
+	return result
+}
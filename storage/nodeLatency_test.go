@@ -0,0 +1,130 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// latencyStore is implemented by both DatabaseImpl and MapImpl.
+type latencyStore interface {
+	InsertNodeLatency(nodeId *id.ID, timestamp time.Time,
+		samples []time.Duration) error
+	GetNodeLatencyPercentiles(start, end time.Time,
+		percentiles []float64) (map[id.ID][]time.Duration, error)
+}
+
+// testNodeLatencyPercentiles tests that the percentiles of each node's samples
+// within the window are returned and that samples outside of it are ignored.
+func testNodeLatencyPercentiles(s latencyStore, nodeIds []*id.ID,
+	t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Samples of 1ms to 10ms for the first node and 100ms for the second
+	samples := make([]time.Duration, 10)
+	for i := range samples {
+		samples[i] = time.Duration(10-i) * time.Millisecond
+	}
+	err := s.InsertNodeLatency(nodeIds[0], start, samples[:5])
+	if err != nil {
+		t.Fatalf("Failed to insert latency: %+v", err)
+	}
+	err = s.InsertNodeLatency(nodeIds[0], start.Add(time.Minute), samples[5:])
+	if err != nil {
+		t.Fatalf("Failed to insert latency: %+v", err)
+	}
+	err = s.InsertNodeLatency(nodeIds[1], start.Add(time.Minute),
+		[]time.Duration{100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to insert latency: %+v", err)
+	}
+
+	// Samples outside the window are ignored
+	err = s.InsertNodeLatency(nodeIds[0], start.Add(time.Hour),
+		[]time.Duration{time.Second})
+	if err != nil {
+		t.Fatalf("Failed to insert latency: %+v", err)
+	}
+
+	percentiles, err := s.GetNodeLatencyPercentiles(start,
+		start.Add(time.Minute), []float64{0, 50, 90, 100})
+	if err != nil {
+		t.Fatalf("Failed to get latency percentiles: %+v", err)
+	}
+
+	expected := map[id.ID][]time.Duration{
+		*nodeIds[0]: {1 * time.Millisecond, 5 * time.Millisecond,
+			9 * time.Millisecond, 10 * time.Millisecond},
+		*nodeIds[1]: {100 * time.Millisecond, 100 * time.Millisecond,
+			100 * time.Millisecond, 100 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(expected, percentiles) {
+		t.Errorf("Unexpected latency percentiles."+
+			"\n\texpected: %v\n\treceived: %v", expected, percentiles)
+	}
+
+	// Percentiles outside of 0 to 100 are rejected
+	_, err = s.GetNodeLatencyPercentiles(start, start, []float64{101})
+	if err == nil {
+		t.Errorf("Did not receive an error for an invalid percentile.")
+	}
+}
+
+// Tests DatabaseImpl.GetNodeLatencyPercentiles().
+func TestDatabaseImpl_GetNodeLatencyPercentiles(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	nodeIds := []*id.ID{
+		id.NewIdFromString("node0", id.Node, t),
+		id.NewIdFromString("node1", id.Node, t),
+	}
+	for i, nid := range nodeIds {
+		err = d.InsertApplication(&Application{Id: uint64(i + 1)},
+			&Node{Code: nid.String(), Id: nid.Marshal()})
+		if err != nil {
+			t.Fatalf("Failed to insert node: %+v", err)
+		}
+	}
+
+	testNodeLatencyPercentiles(d.database, nodeIds, t)
+}
+
+// Tests MapImpl.GetNodeLatencyPercentiles().
+func TestMapImpl_GetNodeLatencyPercentiles(t *testing.T) {
+	testNodeLatencyPercentiles(&MapImpl{}, []*id.ID{
+		id.NewIdFromString("node0", id.Node, t),
+		id.NewIdFromString("node1", id.Node, t),
+	}, t)
+}
+
+// Tests that percentilesOf() uses the nearest-rank method.
+func Test_percentilesOf(t *testing.T) {
+	samples := []int64{15, 20, 35, 40, 50}
+	received := percentilesOf(samples, []float64{5, 30, 40, 50, 100})
+	expected := []time.Duration{15, 20, 20, 35, 50}
+	for i := range expected {
+		expected[i] *= time.Millisecond
+	}
+
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected percentiles.\n\texpected: %v\n\treceived: %v",
+			expected, received)
+	}
+}
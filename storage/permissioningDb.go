@@ -10,10 +10,12 @@
 package storage
 
 import (
+	"bytes"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/xx_network/primitives/id"
+	"sort"
 	"time"
 )
 
@@ -53,28 +55,241 @@ func (d *DatabaseImpl) GetStateValue(key string) (string, error) {
 	return result.Value, err
 }
 
+// Replaces the value of the State with the given key with newValue if its
+// current value is oldValue, or inserts the State if oldValue is empty and no
+// State with the key exists. Returns false if the State did not hold oldValue.
+func (d *DatabaseImpl) SwapStateValue(key, oldValue, newValue string) (bool, error) {
+	jww.TRACE.Printf("Attempting to swap State %s from %q to %q in DB",
+		key, oldValue, newValue)
+
+	var result *gorm.DB
+	if oldValue == "" {
+		result = d.db.Set("gorm:insert_option", "ON CONFLICT DO NOTHING").
+			Create(&State{Key: key, Value: newValue})
+	} else {
+		result = d.db.Model(&State{}).
+			Where(&State{Key: key, Value: oldValue}).
+			Update("value", newValue)
+	}
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Replaces the value of the State in the map with the given key with newValue
+// if its current value is oldValue, or inserts the State if oldValue is empty
+// and no State with the key exists. Returns false if the State did not hold
+// oldValue.
+func (m *MapImpl) SwapStateValue(key, oldValue, newValue string) (bool, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.states == nil {
+		m.states = make(map[string]string)
+	}
+	if value, exists := m.states[key]; value != oldValue ||
+		(oldValue == "" && exists) {
+		return false, nil
+	}
+	m.states[key] = newValue
+	return true, nil
+}
+
 // Insert new NodeMetric object into Storage
 func (d *DatabaseImpl) InsertNodeMetric(metric *NodeMetric) error {
 	jww.TRACE.Printf("Attempting to insert NodeMetric into DB: %+v", metric)
 	return d.db.Create(metric).Error
 }
 
+// Insert new PollMetric object into Storage
+func (d *DatabaseImpl) InsertPollMetric(metric *PollMetric) error {
+	jww.TRACE.Printf("Attempting to insert PollMetric into DB: %+v", metric)
+	return d.db.Create(metric).Error
+}
+
+// Insert new PollMetric object into the map
+func (m *MapImpl) InsertPollMetric(metric *PollMetric) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.pollMetrics == nil {
+		m.pollMetrics = make(map[uint64]*PollMetric)
+	}
+
+	// Mirror the auto-incrementing primary key of the Database
+	m.pollMetricCounter++
+	metric.Id = m.pollMetricCounter
+	m.pollMetrics[metric.Id] = metric
+	return nil
+}
+
+// Insert new NodeStateTransition object into Storage
+func (d *DatabaseImpl) InsertNodeStateTransition(transition *NodeStateTransition) error {
+	jww.TRACE.Printf("Attempting to insert NodeStateTransition into DB: %+v", transition)
+	return d.db.Create(transition).Error
+}
+
+// Insert new NodeStateTransition object into the map
+func (m *MapImpl) InsertNodeStateTransition(transition *NodeStateTransition) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.transitions == nil {
+		m.transitions = make(map[uint64]*NodeStateTransition)
+	}
+
+	// Mirror the auto-incrementing primary key of the Database
+	m.transitionCounter++
+	transition.Id = m.transitionCounter
+	m.transitions[transition.Id] = transition
+	return nil
+}
+
+// Returns all NodeStateTransition for the given Node from Storage, oldest first
+func (d *DatabaseImpl) GetNodeStateTransitions(nodeId *id.ID) ([]*NodeStateTransition, error) {
+	var result []*NodeStateTransition
+	err := d.db.Where("node_id = ?", nodeId.Marshal()).
+		Order("timestamp ASC").Order("id ASC").Find(&result).Error
+	return result, err
+}
+
+// Returns all NodeStateTransition for the given Node from the map, oldest first
+func (m *MapImpl) GetNodeStateTransitions(nodeId *id.ID) ([]*NodeStateTransition, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*NodeStateTransition, 0)
+	for _, transition := range m.transitions {
+		if bytes.Equal(transition.NodeId, nodeId.Marshal()) {
+			result = append(result, transition)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Timestamp.Equal(result[j].Timestamp) {
+			return result[i].Timestamp.Before(result[j].Timestamp)
+		}
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
 // Insert new RoundError object into Storage
-func (d *DatabaseImpl) InsertRoundError(roundId id.Round, errStr string) error {
+func (d *DatabaseImpl) InsertRoundError(roundId id.Round,
+	category RoundErrorCategory, errStr string) error {
 	roundErr := &RoundError{
 		RoundMetricId: uint64(roundId),
 		Error:         errStr,
+		Category:      category,
+		Timestamp:     time.Now(),
 	}
 	jww.TRACE.Printf("Attempting to insert RoundError into DB: %+v", roundErr)
 	return d.db.Create(roundErr).Error
 }
 
+// Insert new RoundError object into the map
+func (m *MapImpl) InsertRoundError(roundId id.Round,
+	category RoundErrorCategory, errStr string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.roundErrors == nil {
+		m.roundErrors = make(map[uint64]*RoundError)
+	}
+
+	// Mirror the auto-incrementing primary key of the Database
+	m.roundErrorCounter++
+	m.roundErrors[m.roundErrorCounter] = &RoundError{
+		Id:            m.roundErrorCounter,
+		RoundMetricId: uint64(roundId),
+		Error:         errStr,
+		Category:      category,
+		Timestamp:     time.Now(),
+	}
+	return nil
+}
+
+// Returns all RoundError recorded for the given Round, in the order they were
+// stored
+func (d *DatabaseImpl) GetRoundErrors(roundId id.Round) ([]RoundError, error) {
+	var result []RoundError
+	err := d.db.Where("round_metric_id = ?", uint64(roundId)).
+		Order("id ASC").Find(&result).Error
+	jww.TRACE.Printf("Obtained %d RoundErrors of round %d from DB",
+		len(result), roundId)
+	return result, err
+}
+
+// Returns all RoundError in the map recorded for the given Round, in the order
+// they were stored
+func (m *MapImpl) GetRoundErrors(roundId id.Round) ([]RoundError, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]RoundError, 0)
+	for _, roundErr := range m.roundErrors {
+		if roundErr.RoundMetricId == uint64(roundId) {
+			result = append(result, *roundErr)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
+// Returns the number of RoundError stored between start and end, inclusive,
+// for each RoundErrorCategory with at least one error
+func (d *DatabaseImpl) GetRoundErrorCounts(start, end time.Time) (
+	map[RoundErrorCategory]uint64, error) {
+	var rows []struct {
+		Category RoundErrorCategory
+		Count    uint64
+	}
+	err := d.db.Model(&RoundError{}).
+		Select("category, count(*) as count").
+		Where("timestamp BETWEEN ? AND ?", start, end).
+		Group("category").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[RoundErrorCategory]uint64, len(rows))
+	for _, row := range rows {
+		result[row.Category] = row.Count
+	}
+	jww.TRACE.Printf("Obtained RoundError counts from DB: %v", result)
+	return result, nil
+}
+
+// Returns the number of RoundError in the map stored between start and end,
+// inclusive, for each RoundErrorCategory with at least one error
+func (m *MapImpl) GetRoundErrorCounts(start, end time.Time) (
+	map[RoundErrorCategory]uint64, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make(map[RoundErrorCategory]uint64)
+	for _, roundErr := range m.roundErrors {
+		if !roundErr.Timestamp.Before(start) && !roundErr.Timestamp.After(end) {
+			result[roundErr.Category]++
+		}
+	}
+	return result, nil
+}
+
 // Insert new RoundMetric object with associated topology into Storage
+// Empty entries in the topology are skipped, keeping the order of the others
 func (d *DatabaseImpl) InsertRoundMetric(metric *RoundMetric, topology [][]byte) error {
 
 	// Build the Topology
-	metric.Topologies = make([]Topology, len(topology))
+	metric.Topologies = make([]Topology, 0, len(topology))
 	for i, nodeIdBytes := range topology {
+		if len(nodeIdBytes) == 0 {
+			continue
+		}
 		nodeId, err := id.Unmarshal(nodeIdBytes)
 		if err != nil {
 			return errors.New(err.Error())
@@ -83,7 +298,7 @@ func (d *DatabaseImpl) InsertRoundMetric(metric *RoundMetric, topology [][]byte)
 			NodeId: nodeId.Bytes(),
 			Order:  uint8(i),
 		}
-		metric.Topologies[i] = topologyObj
+		metric.Topologies = append(metric.Topologies, topologyObj)
 	}
 
 	// Save the RoundMetric
@@ -91,6 +306,40 @@ func (d *DatabaseImpl) InsertRoundMetric(metric *RoundMetric, topology [][]byte)
 	return d.db.Create(metric).Error
 }
 
+// Insert new RoundMetric object with associated topology into the map
+// Empty entries in the topology are skipped, keeping the order of the others
+func (m *MapImpl) InsertRoundMetric(metric *RoundMetric, topology [][]byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.roundMetrics == nil {
+		m.roundMetrics = make(map[uint64]*RoundMetric)
+	}
+	if _, exists := m.roundMetrics[metric.Id]; exists {
+		return errors.Errorf("RoundMetric %d already exists", metric.Id)
+	}
+
+	// Build the Topology
+	metric.Topologies = make([]Topology, 0, len(topology))
+	for i, nodeIdBytes := range topology {
+		if len(nodeIdBytes) == 0 {
+			continue
+		}
+		nodeId, err := id.Unmarshal(nodeIdBytes)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		metric.Topologies = append(metric.Topologies, Topology{
+			NodeId:        nodeId.Bytes(),
+			RoundMetricId: metric.Id,
+			Order:         uint8(i),
+		})
+	}
+
+	m.roundMetrics[metric.Id] = metric
+	return nil
+}
+
 // Returns newest (and largest, by implication) EphemeralLength from Storage
 func (d *DatabaseImpl) GetLatestEphemeralLength() (*EphemeralLength, error) {
 	result := &EphemeralLength{}
@@ -107,10 +356,133 @@ func (d *DatabaseImpl) GetEphemeralLengths() ([]*EphemeralLength, error) {
 	return result, err
 }
 
+// Returns all EphemeralLength from Storage ordered by Timestamp, oldest first
+func (d *DatabaseImpl) GetEphemeralLengthSchedule() ([]*EphemeralLength, error) {
+	var result []*EphemeralLength
+	err := d.db.Order("timestamp ASC").Find(&result).Error
+	jww.TRACE.Printf("Obtained EphemeralLength schedule from DB: %+v", result)
+	return result, err
+}
+
+// Returns all EphemeralLength in the map ordered by Timestamp, oldest first
+func (m *MapImpl) GetEphemeralLengthSchedule() ([]*EphemeralLength, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*EphemeralLength, 0, len(m.ephemeralLengths))
+	for _, el := range m.ephemeralLengths {
+		result = append(result, el)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result, nil
+}
+
 // Insert new EphemeralLength into Storage
+// Returns an error if its Timestamp is not after every stored EphemeralLength
 func (d *DatabaseImpl) InsertEphemeralLength(length *EphemeralLength) error {
 	jww.TRACE.Printf("Attempting to insert EphemeralLength into DB: %+v", length)
-	return d.db.Create(length).Error
+
+	// Build a transaction so the schedule cannot change before the insert
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		latest := &EphemeralLength{}
+		err := tx.Order("timestamp DESC").Take(latest).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		} else if err == nil && !length.Timestamp.After(latest.Timestamp) {
+			return errors.Errorf("EphemeralLength %d at %s must be after "+
+				"the latest EphemeralLength %d at %s", length.Length,
+				length.Timestamp, latest.Length, latest.Timestamp)
+		}
+
+		return tx.Create(length).Error
+	})
+}
+
+// Insert new EphemeralLength into the map
+// Returns an error if its Timestamp is not after every stored EphemeralLength
+func (m *MapImpl) InsertEphemeralLength(length *EphemeralLength) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.ephemeralLengths == nil {
+		m.ephemeralLengths = make(map[uint8]*EphemeralLength)
+	}
+
+	// Mirror the unique constraints of the Database
+	if _, exists := m.ephemeralLengths[length.Length]; exists {
+		return errors.Errorf("EphemeralLength %d already exists", length.Length)
+	}
+	var latest *EphemeralLength
+	for _, el := range m.ephemeralLengths {
+		if latest == nil || el.Timestamp.After(latest.Timestamp) {
+			latest = el
+		}
+	}
+	if latest != nil && !length.Timestamp.After(latest.Timestamp) {
+		return errors.Errorf("EphemeralLength %d at %s must be after the "+
+			"latest EphemeralLength %d at %s", length.Length,
+			length.Timestamp, latest.Length, latest.Timestamp)
+	}
+
+	m.ephemeralLengths[length.Length] = length
+	return nil
+}
+
+// Returns the EphemeralLength in effect at the given time, i.e. the one with
+// the most recent Timestamp that is not after it
+func (d *DatabaseImpl) GetActiveEphemeralLength(at time.Time) (*EphemeralLength, error) {
+	result := &EphemeralLength{}
+	err := d.db.Where("timestamp <= ?", at).Order("timestamp DESC").Take(result).Error
+	jww.TRACE.Printf("Obtained active EphemeralLength from DB: %+v", result)
+	return result, err
+}
+
+// Returns the EphemeralLength in effect at the given time from the map
+func (m *MapImpl) GetActiveEphemeralLength(at time.Time) (*EphemeralLength, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var result *EphemeralLength
+	for _, el := range m.ephemeralLengths {
+		if !el.Timestamp.After(at) &&
+			(result == nil || el.Timestamp.After(result.Timestamp)) {
+			result = el
+		}
+	}
+	if result == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return result, nil
+}
+
+// Returns the EphemeralLength that next takes effect after the given time,
+// i.e. the one with the earliest Timestamp after it
+func (d *DatabaseImpl) GetNextEphemeralLength(at time.Time) (*EphemeralLength, error) {
+	result := &EphemeralLength{}
+	err := d.db.Where("timestamp > ?", at).Order("timestamp ASC").Take(result).Error
+	jww.TRACE.Printf("Obtained next EphemeralLength from DB: %+v", result)
+	return result, err
+}
+
+// Returns the EphemeralLength that next takes effect after the given time from
+// the map
+func (m *MapImpl) GetNextEphemeralLength(at time.Time) (*EphemeralLength, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var result *EphemeralLength
+	for _, el := range m.ephemeralLengths {
+		if el.Timestamp.After(at) &&
+			(result == nil || el.Timestamp.Before(result.Timestamp)) {
+			result = el
+		}
+	}
+	if result == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return result, nil
 }
 
 // Get the first round that is timestamped after the given cutoff
@@ -126,9 +498,445 @@ func (d *DatabaseImpl) GetEarliestRound(cutoff time.Duration) (id.Round, time.Ti
 	return roundId, result.RealtimeStart, nil
 }
 
+// Returns all RoundMetric with a RealtimeEnd between start and end, inclusive,
+// along with their Topologies, ordered by round ID
+func (d *DatabaseImpl) GetRoundMetrics(start, end time.Time) ([]*RoundMetric, error) {
+	var result []*RoundMetric
+	err := d.db.Preload("Topologies").
+		Where("realtime_end BETWEEN ? AND ?", start, end).
+		Order("id ASC").Find(&result).Error
+	jww.TRACE.Printf("Obtained %d RoundMetrics from DB", len(result))
+	return result, err
+}
+
+// Returns all RoundMetric in the map with a RealtimeEnd between start and end,
+// inclusive, ordered by round ID
+func (m *MapImpl) GetRoundMetrics(start, end time.Time) ([]*RoundMetric, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*RoundMetric, 0)
+	for _, metric := range m.roundMetrics {
+		if !metric.RealtimeEnd.Before(start) && !metric.RealtimeEnd.After(end) {
+			result = append(result, metric)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
+// Returns the transactions per second processed by the network between start
+// and end, which is the total BatchSize of RoundMetric with a RealtimeEnd
+// between start and end, inclusive, divided by the length of the window.
+// Failed Rounds have no RealtimeEnd and are not counted.
+func (d *DatabaseImpl) GetNetworkTPS(start, end time.Time) (float64, error) {
+	if !end.After(start) {
+		return 0, errors.Errorf("Invalid TPS window: end %s is not after "+
+			"start %s", end, start)
+	}
+
+	var row struct {
+		Total uint64
+	}
+	err := d.db.Model(&RoundMetric{}).
+		Select("COALESCE(SUM(batch_size), 0) as total").
+		Where("realtime_end BETWEEN ? AND ?", start, end).
+		Scan(&row).Error
+	if err != nil {
+		return 0, err
+	}
+
+	jww.TRACE.Printf("Obtained %d transactions between %s and %s from DB",
+		row.Total, start, end)
+	return float64(row.Total) / end.Sub(start).Seconds(), nil
+}
+
+// Returns the transactions per second processed by the network between start
+// and end, which is the total BatchSize of RoundMetric in the map with a
+// RealtimeEnd between start and end, inclusive, divided by the length of the
+// window
+func (m *MapImpl) GetNetworkTPS(start, end time.Time) (float64, error) {
+	if !end.After(start) {
+		return 0, errors.Errorf("Invalid TPS window: end %s is not after "+
+			"start %s", end, start)
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var total uint64
+	for _, metric := range m.roundMetrics {
+		if !metric.RealtimeEnd.Before(start) && !metric.RealtimeEnd.After(end) {
+			total += uint64(metric.BatchSize)
+		}
+	}
+	return float64(total) / end.Sub(start).Seconds(), nil
+}
+
+// Returns all RoundMetric of Rounds the Node participated in that ended at or
+// after since, along with their Topologies, ordered by round ID
+func (d *DatabaseImpl) GetRoundMetricsByNode(id *id.ID, since time.Time) ([]*RoundMetric, error) {
+	var result []*RoundMetric
+	err := d.db.Preload("Topologies").
+		Joins("JOIN topologies ON topologies.round_metric_id = round_metrics.id").
+		Where("topologies.node_id = ? AND round_metrics.round_end >= ?",
+			id.Marshal(), since).
+		Order("round_metrics.id ASC").Find(&result).Error
+	jww.TRACE.Printf("Obtained %d RoundMetrics of Node %s from DB",
+		len(result), id)
+	return result, err
+}
+
+// Returns all RoundMetric in the map of Rounds the Node participated in that
+// ended at or after since, ordered by round ID
+func (m *MapImpl) GetRoundMetricsByNode(id *id.ID, since time.Time) ([]*RoundMetric, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*RoundMetric, 0)
+	for _, metric := range m.roundMetrics {
+		if metric.RoundEnd.Before(since) {
+			continue
+		}
+		for _, topology := range metric.Topologies {
+			if bytes.Equal(topology.NodeId, id.Marshal()) {
+				result = append(result, metric)
+				break
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result, nil
+}
+
+// NodeRoundOutcomes is the number of rounds a Node participated in and how
+// many of them failed.
+type NodeRoundOutcomes struct {
+	Rounds uint64
+	Failed uint64
+}
+
+// Returns the number of Rounds each Node participated in that ended at or after
+// since and how many of them have a RoundError
+func (d *DatabaseImpl) GetNodeRoundOutcomes(since time.Time) (
+	map[id.ID]NodeRoundOutcomes, error) {
+	var rows []struct {
+		NodeId []byte
+		Rounds uint64
+		Failed uint64
+	}
+	err := d.db.Table("topologies").
+		Select("topologies.node_id, count(*) as rounds, "+
+			"count(failed_rounds.round_metric_id) as failed").
+		Joins("JOIN round_metrics ON round_metrics.id = "+
+			"topologies.round_metric_id").
+		Joins("LEFT JOIN (SELECT DISTINCT round_metric_id FROM round_errors) "+
+			"failed_rounds ON failed_rounds.round_metric_id = "+
+			"topologies.round_metric_id").
+		Where("round_metrics.round_end >= ?", since).
+		Group("topologies.node_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[id.ID]NodeRoundOutcomes, len(rows))
+	for _, row := range rows {
+		nodeId, err := id.Unmarshal(row.NodeId)
+		if err != nil {
+			return nil, errors.Errorf("Failed to unmarshal Node ID %v: %+v",
+				row.NodeId, err)
+		}
+		result[*nodeId] = NodeRoundOutcomes{Rounds: row.Rounds, Failed: row.Failed}
+	}
+	jww.TRACE.Printf("Obtained round outcomes of %d Nodes from DB",
+		len(result))
+	return result, nil
+}
+
+// Returns the number of Rounds in the map each Node participated in that ended
+// at or after since and how many of them have a RoundError
+func (m *MapImpl) GetNodeRoundOutcomes(since time.Time) (
+	map[id.ID]NodeRoundOutcomes, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	failed := make(map[uint64]struct{})
+	for _, roundErr := range m.roundErrors {
+		failed[roundErr.RoundMetricId] = struct{}{}
+	}
+
+	result := make(map[id.ID]NodeRoundOutcomes)
+	for _, metric := range m.roundMetrics {
+		if metric.RoundEnd.Before(since) {
+			continue
+		}
+		_, isFailed := failed[metric.Id]
+		for _, topology := range metric.Topologies {
+			nodeId, err := id.Unmarshal(topology.NodeId)
+			if err != nil {
+				return nil, errors.Errorf("Failed to unmarshal Node ID %v: "+
+					"%+v", topology.NodeId, err)
+			}
+			outcomes := result[*nodeId]
+			outcomes.Rounds++
+			if isFailed {
+				outcomes.Failed++
+			}
+			result[*nodeId] = outcomes
+		}
+	}
+	return result, nil
+}
+
 // Returns all GeoBin from Storage
 func (d *DatabaseImpl) getBins() ([]*GeoBin, error) {
 	var result []*GeoBin
 	err := d.db.Find(&result).Error
 	return result, err
 }
+
+// Returns all GeoBin from the map
+func (m *MapImpl) getBins() ([]*GeoBin, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*GeoBin, 0, len(m.geographicBin))
+	for country, bin := range m.geographicBin {
+		result = append(result, &GeoBin{Country: country, Bin: bin})
+	}
+	return result, nil
+}
+
+// Inserts the given GeoBin into Storage if its country does not exist
+// Or updates the bin of the existing country
+func (d *DatabaseImpl) UpsertGeoBin(bin *GeoBin) error {
+	jww.TRACE.Printf("Attempting to upsert GeoBin into DB: %+v", bin)
+	return d.db.Save(bin).Error
+}
+
+// Inserts the given GeoBin into the map if its country does not exist
+// Or updates the bin of the existing country
+func (m *MapImpl) UpsertGeoBin(bin *GeoBin) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.geographicBin == nil {
+		m.geographicBin = make(map[string]uint8)
+	}
+	m.geographicBin[bin.Country] = bin.Bin
+	return nil
+}
+
+// Inserts the Node with the given id into the disabled Node list in Storage
+// or updates the time it was disabled if it is already listed
+func (d *DatabaseImpl) InsertDisabledNode(id *id.ID, timestamp time.Time) error {
+	jww.TRACE.Printf("Attempting to insert DisabledNode into DB: %s", id)
+	return d.db.Save(&DisabledNode{Id: id.Marshal(), Timestamp: timestamp}).Error
+}
+
+// Inserts the Node with the given id into the disabled Node list in the map
+// or updates the time it was disabled if it is already listed
+func (m *MapImpl) InsertDisabledNode(nodeId *id.ID, timestamp time.Time) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.disabledNodes == nil {
+		m.disabledNodes = make(map[id.ID]*DisabledNode)
+	}
+	m.disabledNodes[*nodeId] = &DisabledNode{
+		Id:        nodeId.Marshal(),
+		Timestamp: timestamp,
+	}
+	return nil
+}
+
+// Removes the Node with the given id from the disabled Node list in Storage
+func (d *DatabaseImpl) DeleteDisabledNode(id *id.ID) error {
+	result := d.db.Where("id = ?", id.Marshal()).Delete(&DisabledNode{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errors.Errorf("Unable to delete disabled node %s: node not "+
+			"found", id)
+	}
+	return nil
+}
+
+// Removes the Node with the given id from the disabled Node list in the map
+func (m *MapImpl) DeleteDisabledNode(id *id.ID) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if _, exists := m.disabledNodes[*id]; !exists {
+		return errors.Errorf("Unable to delete disabled node %s: node not "+
+			"found", id)
+	}
+	delete(m.disabledNodes, *id)
+	return nil
+}
+
+// Returns all DisabledNode from Storage
+func (d *DatabaseImpl) GetDisabledNodes() ([]*DisabledNode, error) {
+	var result []*DisabledNode
+	err := d.db.Find(&result).Error
+	return result, err
+}
+
+// Returns all DisabledNode from the map
+func (m *MapImpl) GetDisabledNodes() ([]*DisabledNode, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*DisabledNode, 0, len(m.disabledNodes))
+	for _, disabled := range m.disabledNodes {
+		result = append(result, disabled)
+	}
+	return result, nil
+}
+
+// Inserts the RevokedCertificate into Storage. Returns an error if the
+// certificate has already been revoked.
+func (d *DatabaseImpl) InsertRevokedCertificate(cert *RevokedCertificate) error {
+	jww.TRACE.Printf("Attempting to insert RevokedCertificate into DB: %+v",
+		cert)
+	return d.db.Create(cert).Error
+}
+
+// Inserts the RevokedCertificate into the map. Returns an error if the
+// certificate has already been revoked.
+func (m *MapImpl) InsertRevokedCertificate(cert *RevokedCertificate) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.revokedCerts == nil {
+		m.revokedCerts = make(map[string]*RevokedCertificate)
+	}
+	key := cert.Issuer + "/" + cert.Serial
+	if _, exists := m.revokedCerts[key]; exists {
+		return errors.Errorf("Certificate %s of %s has already been revoked",
+			cert.Serial, cert.Issuer)
+	}
+	m.revokedCerts[key] = cert
+	return nil
+}
+
+// Returns all RevokedCertificate from Storage
+func (d *DatabaseImpl) GetRevokedCertificates() ([]*RevokedCertificate, error) {
+	var result []*RevokedCertificate
+	err := d.db.Find(&result).Error
+	return result, err
+}
+
+// Returns all RevokedCertificate from the map
+func (m *MapImpl) GetRevokedCertificates() ([]*RevokedCertificate, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*RevokedCertificate, 0, len(m.revokedCerts))
+	for _, revoked := range m.revokedCerts {
+		result = append(result, revoked)
+	}
+	return result, nil
+}
+
+// Adds the Node key with the given fingerprint to the allowlist in Storage or
+// updates the time it was added if it is already listed
+func (d *DatabaseImpl) InsertAllowedNodeKey(fingerprint string,
+	timestamp time.Time) error {
+	jww.TRACE.Printf("Attempting to insert AllowedNodeKey into DB: %s",
+		fingerprint)
+	return d.db.Save(&AllowedNodeKey{
+		Fingerprint: fingerprint,
+		Timestamp:   timestamp,
+	}).Error
+}
+
+// Adds the Node key with the given fingerprint to the allowlist in the map or
+// updates the time it was added if it is already listed
+func (m *MapImpl) InsertAllowedNodeKey(fingerprint string,
+	timestamp time.Time) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.allowedNodeKeys == nil {
+		m.allowedNodeKeys = make(map[string]*AllowedNodeKey)
+	}
+	m.allowedNodeKeys[fingerprint] = &AllowedNodeKey{
+		Fingerprint: fingerprint,
+		Timestamp:   timestamp,
+	}
+	return nil
+}
+
+// Removes the Node key with the given fingerprint from the allowlist in Storage
+func (d *DatabaseImpl) DeleteAllowedNodeKey(fingerprint string) error {
+	result := d.db.Where("fingerprint = ?", fingerprint).
+		Delete(&AllowedNodeKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errors.Errorf("Unable to delete allowed node key %s: key not "+
+			"found", fingerprint)
+	}
+	return nil
+}
+
+// Removes the Node key with the given fingerprint from the allowlist in the map
+func (m *MapImpl) DeleteAllowedNodeKey(fingerprint string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if _, exists := m.allowedNodeKeys[fingerprint]; !exists {
+		return errors.Errorf("Unable to delete allowed node key %s: key not "+
+			"found", fingerprint)
+	}
+	delete(m.allowedNodeKeys, fingerprint)
+	return nil
+}
+
+// Returns all AllowedNodeKey from Storage
+func (d *DatabaseImpl) GetAllowedNodeKeys() ([]*AllowedNodeKey, error) {
+	var result []*AllowedNodeKey
+	err := d.db.Find(&result).Error
+	return result, err
+}
+
+// Returns all AllowedNodeKey from the map
+func (m *MapImpl) GetAllowedNodeKeys() ([]*AllowedNodeKey, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	result := make([]*AllowedNodeKey, 0, len(m.allowedNodeKeys))
+	for _, allowed := range m.allowedNodeKeys {
+		result = append(result, allowed)
+	}
+	return result, nil
+}
+
+// Returns true if the Node key with the given fingerprint is on the allowlist
+// in Storage
+func (d *DatabaseImpl) IsNodeKeyAllowed(fingerprint string) (bool, error) {
+	err := d.db.Take(&AllowedNodeKey{}, "fingerprint = ?", fingerprint).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Returns true if the Node key with the given fingerprint is on the allowlist
+// in the map
+func (m *MapImpl) IsNodeKeyAllowed(fingerprint string) (bool, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	_, exists := m.allowedNodeKeys[fingerprint]
+	return exists, nil
+}
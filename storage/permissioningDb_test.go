@@ -8,10 +8,12 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/jinzhu/gorm"
 	"gitlab.com/xx_network/primitives/id"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -175,6 +177,155 @@ import (
 //	jww.FATAL.Printf("%+v", nodes[0])
 //}
 
+// Happy path
+func TestDatabaseImpl_InsertPollMetric(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+	db := d.GetDatabaseImpl(t)
+
+	// Load in a registration code
+	code := "TEST"
+	testId := id.NewIdFromString(code, id.Node, t)
+	err = d.InsertApplication(&Application{Id: 10}, &Node{Code: code, Id: testId.Marshal()})
+	if err != nil {
+		t.Fatalf("Failed to set up reg code for poll metric test: %+v", err)
+	}
+
+	newMetric := &PollMetric{
+		NodeId:       testId.Marshal(),
+		StartTime:    time.Now(),
+		EndTime:      time.Now(),
+		NumIntervals: 10,
+		MinInterval:  100,
+		MaxInterval:  300,
+		MeanInterval: 200,
+	}
+	err = d.InsertPollMetric(newMetric)
+	if err != nil {
+		t.Errorf("Unable to insert poll metric: %+v", err)
+	}
+
+	var insertedMetric PollMetric
+	err = db.db.Take(&insertedMetric).Error
+	if err != nil {
+		t.Fatalf("Failed to get inserted metric: %+v", err)
+	}
+	if insertedMetric.Id != 1 {
+		t.Errorf("Mismatched ID returned!")
+	}
+	if insertedMetric.NumIntervals != newMetric.NumIntervals ||
+		insertedMetric.MinInterval != newMetric.MinInterval ||
+		insertedMetric.MaxInterval != newMetric.MaxInterval ||
+		insertedMetric.MeanInterval != newMetric.MeanInterval {
+		t.Errorf("Mismatched intervals returned!\n\tExpected: %+v\n\tReceived: %+v",
+			newMetric, insertedMetric)
+	}
+
+	// Ensure the MapImpl mirrors the Database
+	m := &MapImpl{}
+	mapMetric := *newMetric
+	mapMetric.Id = 0
+	err = m.InsertPollMetric(&mapMetric)
+	if err != nil {
+		t.Errorf("Unable to insert poll metric into map: %+v", err)
+	}
+	if stored, exists := m.pollMetrics[1]; !exists || stored.Id != insertedMetric.Id {
+		t.Errorf("Map did not store the poll metric with the expected ID: %+v",
+			m.pollMetrics)
+	}
+}
+
+// Tests that inserted NodeStateTransition are returned for their Node only,
+// oldest first, by both the Database and the MapImpl.
+func TestDatabaseImpl_GetNodeStateTransitions(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	nodeIds := []*id.ID{
+		id.NewIdFromString("node0", id.Node, t),
+		id.NewIdFromString("node1", id.Node, t),
+	}
+	for i, nid := range nodeIds {
+		err = d.InsertApplication(&Application{Id: uint64(i + 1)},
+			&Node{Code: nid.String(), Id: nid.Marshal()})
+		if err != nil {
+			t.Fatalf("Failed to insert node: %+v", err)
+		}
+	}
+
+	roundID := uint64(42)
+	now := time.Now().UTC()
+	newTransitions := func() []*NodeStateTransition {
+		return []*NodeStateTransition{
+			{NodeId: nodeIds[0].Marshal(), FromActivity: 2, ToActivity: 3,
+				RoundId: &roundID, Timestamp: now.Add(time.Second)},
+			{NodeId: nodeIds[1].Marshal(), FromActivity: 0, ToActivity: 1,
+				Timestamp: now},
+			{NodeId: nodeIds[0].Marshal(), FromActivity: 1, ToActivity: 2,
+				RoundId: &roundID, Timestamp: now},
+		}
+	}
+
+	type transitionStore interface {
+		InsertNodeStateTransition(transition *NodeStateTransition) error
+		GetNodeStateTransitions(nodeId *id.ID) ([]*NodeStateTransition, error)
+	}
+	for name, db := range map[string]transitionStore{
+		"DatabaseImpl": d.database, "MapImpl": &MapImpl{}} {
+		for _, transition := range newTransitions() {
+			err = db.InsertNodeStateTransition(transition)
+			if err != nil {
+				t.Fatalf("%s: Failed to insert transition: %+v", name, err)
+			}
+		}
+
+		transitions, err := db.GetNodeStateTransitions(nodeIds[0])
+		if err != nil {
+			t.Fatalf("%s: Failed to get transitions: %+v", name, err)
+		}
+		if len(transitions) != 2 {
+			t.Fatalf("%s: Unexpected number of transitions."+
+				"\n\texpected: %d\n\treceived: %d", name, 2, len(transitions))
+		}
+		for i, expected := range []uint32{2, 3} {
+			if transitions[i].ToActivity != expected {
+				t.Errorf("%s: Unexpected transition %d."+
+					"\n\texpected: %d\n\treceived: %d",
+					name, i, expected, transitions[i].ToActivity)
+			}
+			if transitions[i].RoundId == nil || *transitions[i].RoundId != roundID {
+				t.Errorf("%s: Round ID of transition %d not stored: %v",
+					name, i, transitions[i].RoundId)
+			}
+		}
+
+		transitions, err = db.GetNodeStateTransitions(nodeIds[1])
+		if err != nil {
+			t.Fatalf("%s: Failed to get transitions: %+v", name, err)
+		}
+		if len(transitions) != 1 || transitions[0].RoundId != nil {
+			t.Errorf("%s: Unexpected transitions without a round: %+v",
+				name, transitions)
+		}
+	}
+}
+
 // Happy path
 func TestDatabaseImpl_InsertNodeMetric(t *testing.T) {
 	d, dc, err := NewDatabase("", "", "", "", "")
@@ -249,13 +400,14 @@ func TestDatabaseImpl_InsertRoundMetric(t *testing.T) {
 
 	roundId := uint64(1)
 	newMetric := &RoundMetric{
-		Id:            roundId,
-		PrecompStart:  time.Now(),
-		PrecompEnd:    time.Now(),
-		RealtimeStart: time.Now(),
-		RealtimeEnd:   time.Now(),
-		RoundEnd:      time.Now(),
-		BatchSize:     420,
+		Id:               roundId,
+		PrecompStart:     time.Now(),
+		PrecompEnd:       time.Now(),
+		RealtimeStart:    time.Now(),
+		RealtimeEnd:      time.Now(),
+		RoundEnd:         time.Now(),
+		BatchSize:        420,
+		ClientErrorCount: 3,
 	}
 	newTopology := make([][]byte, 3)
 	for i := 0; i < len(newTopology); i++ {
@@ -296,6 +448,64 @@ func TestDatabaseImpl_InsertRoundMetric(t *testing.T) {
 	if insertedMetric.BatchSize != newMetric.BatchSize {
 		t.Errorf("Mismatched BatchSize returned!")
 	}
+	if insertedMetric.ClientErrorCount != newMetric.ClientErrorCount {
+		t.Errorf("Mismatched ClientErrorCount returned!")
+	}
+}
+
+// Tests that MapImpl.InsertRoundMetric stores the RoundMetric with its
+// topology and client error count and rejects a duplicate round.
+func TestMapImpl_InsertRoundMetric(t *testing.T) {
+	m := &MapImpl{}
+
+	topology := make([][]byte, 3)
+	for i := range topology {
+		topology[i] = id.NewIdFromUInt(uint64(i), id.Node, t).Bytes()
+	}
+	newMetric := &RoundMetric{Id: 1, BatchSize: 32, ClientErrorCount: 3}
+
+	err := m.InsertRoundMetric(newMetric, topology)
+	if err != nil {
+		t.Fatalf("Unable to insert round metric: %+v", err)
+	}
+
+	metric, exists := m.roundMetrics[newMetric.Id]
+	if !exists {
+		t.Fatalf("RoundMetric %d not stored.", newMetric.Id)
+	}
+	if metric.ClientErrorCount != newMetric.ClientErrorCount {
+		t.Errorf("Mismatched ClientErrorCount returned."+
+			"\n\texpected: %d\n\treceived: %d",
+			newMetric.ClientErrorCount, metric.ClientErrorCount)
+	}
+	if len(metric.Topologies) != len(topology) {
+		t.Fatalf("Unexpected topology length."+
+			"\n\texpected: %d\n\treceived: %d",
+			len(topology), len(metric.Topologies))
+	}
+	for i, top := range metric.Topologies {
+		if !bytes.Equal(top.NodeId, topology[i]) || top.Order != uint8(i) {
+			t.Errorf("Unexpected Topology at index %d: %+v", i, top)
+		}
+	}
+
+	// Error path: the round is already stored
+	err = m.InsertRoundMetric(&RoundMetric{Id: 1}, topology)
+	if err == nil {
+		t.Errorf("Inserting a duplicate round metric did not return an error.")
+	}
+
+	// Empty topology entries are skipped, keeping the order of the others
+	topology[1] = nil
+	err = m.InsertRoundMetric(&RoundMetric{Id: 2}, topology)
+	if err != nil {
+		t.Fatalf("Unable to insert round metric: %+v", err)
+	}
+	topologies := m.roundMetrics[2].Topologies
+	if len(topologies) != 2 || topologies[0].Order != 0 ||
+		topologies[1].Order != 2 {
+		t.Errorf("Unexpected Topologies with an empty entry: %+v", topologies)
+	}
 }
 
 // Happy path
@@ -339,12 +549,12 @@ func TestDatabaseImpl_InsertRoundError(t *testing.T) {
 		t.Errorf("Unable to insert round metric: %+v", err)
 	}
 
-	err = d.InsertRoundError(roundId, newErrors[0])
+	err = d.InsertRoundError(roundId, TimeoutError, newErrors[0])
 	if err != nil {
 		t.Errorf("Unable to insert round error: %+v", err)
 	}
 
-	err = d.InsertRoundError(roundId, newErrors[1])
+	err = d.InsertRoundError(roundId, NodeReportedError, newErrors[1])
 	if err != nil {
 		t.Errorf("Unable to insert round error: %+v", err)
 	}
@@ -361,6 +571,196 @@ func TestDatabaseImpl_InsertRoundError(t *testing.T) {
 	if insertedMetric.RoundErrors[1].Error != newErrors[1] {
 		t.Errorf("Mismatched Error returned!")
 	}
+	if insertedMetric.RoundErrors[0].Category != TimeoutError ||
+		insertedMetric.RoundErrors[1].Category != NodeReportedError {
+		t.Errorf("Mismatched Category returned!")
+	}
+}
+
+// Tests that GetRoundErrorCounts() counts the RoundErrors in the window by
+// category.
+func TestDatabaseImpl_GetRoundErrorCounts(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetRoundErrorCounts", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	roundId := uint64(1)
+	err = d.InsertRoundMetric(&RoundMetric{
+		Id:            roundId,
+		PrecompStart:  time.Now(),
+		PrecompEnd:    time.Now(),
+		RealtimeStart: time.Now(),
+		RealtimeEnd:   time.Now(),
+		RoundEnd:      time.Now(),
+		BatchSize:     420,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Unable to insert round metric: %+v", err)
+	}
+
+	start := time.Now()
+	for _, category := range []RoundErrorCategory{TimeoutError,
+		NodeReportedError, TimeoutError, BannedNodeError, TimeoutError} {
+		err = d.InsertRoundError(id.Round(roundId), category, "err")
+		if err != nil {
+			t.Fatalf("Unable to insert round error: %+v", err)
+		}
+	}
+	end := time.Now()
+
+	counts, err := d.GetRoundErrorCounts(start, end)
+	if err != nil {
+		t.Fatalf("GetRoundErrorCounts() returned an error: %+v", err)
+	}
+	expected := map[RoundErrorCategory]uint64{
+		TimeoutError: 3, NodeReportedError: 1, BannedNodeError: 1}
+	if !reflect.DeepEqual(expected, counts) {
+		t.Errorf("Unexpected round error counts."+
+			"\n\texpected: %v\n\treceived: %v", expected, counts)
+	}
+
+	// No errors outside the window
+	counts, err = d.GetRoundErrorCounts(end.Add(time.Second), end.Add(time.Hour))
+	if err != nil || len(counts) != 0 {
+		t.Errorf("Unexpected round error counts outside of window: %v, %+v",
+			counts, err)
+	}
+}
+
+// Tests that MapImpl.GetRoundErrorCounts() counts the RoundErrors in the window
+// by category.
+func TestMapImpl_GetRoundErrorCounts(t *testing.T) {
+	m := &MapImpl{}
+
+	start := time.Now()
+	for _, category := range []RoundErrorCategory{DecommissionedNodeError,
+		TimeoutError, DecommissionedNodeError} {
+		err := m.InsertRoundError(1, category, "err")
+		if err != nil {
+			t.Fatalf("Unable to insert round error: %+v", err)
+		}
+	}
+	end := time.Now()
+
+	counts, err := m.GetRoundErrorCounts(start, end)
+	if err != nil {
+		t.Fatalf("GetRoundErrorCounts() returned an error: %+v", err)
+	}
+	expected := map[RoundErrorCategory]uint64{
+		DecommissionedNodeError: 2, TimeoutError: 1}
+	if !reflect.DeepEqual(expected, counts) {
+		t.Errorf("Unexpected round error counts."+
+			"\n\texpected: %v\n\treceived: %v", expected, counts)
+	}
+
+	counts, err = m.GetRoundErrorCounts(end.Add(time.Second), end.Add(time.Hour))
+	if err != nil || len(counts) != 0 {
+		t.Errorf("Unexpected round error counts outside of window: %v, %+v",
+			counts, err)
+	}
+}
+
+// Tests that GetRoundErrors() returns every RoundError of the round in the
+// order they were inserted.
+func TestDatabaseImpl_GetRoundErrors(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetRoundErrors", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testGetRoundErrors(d.GetDatabaseImpl(t), t)
+}
+
+// Tests that MapImpl.GetRoundErrors() returns every RoundError of the round in
+// the order they were inserted.
+func TestMapImpl_GetRoundErrors(t *testing.T) {
+	testGetRoundErrors(&MapImpl{}, t)
+}
+
+// roundErrorDb is the part of the database interface that stores RoundErrors,
+// which MapImpl implements in full.
+type roundErrorDb interface {
+	InsertRoundMetric(metric *RoundMetric, topology [][]byte) error
+	InsertRoundError(roundId id.Round, category RoundErrorCategory,
+		errStr string) error
+	GetRoundErrors(roundId id.Round) ([]RoundError, error)
+}
+
+// testGetRoundErrors inserts errors for two rounds and checks that only the
+// errors of the requested round are returned.
+func testGetRoundErrors(db roundErrorDb, t *testing.T) {
+	for _, roundId := range []uint64{1, 2} {
+		err := db.InsertRoundMetric(&RoundMetric{
+			Id:            roundId,
+			PrecompStart:  time.Now(),
+			PrecompEnd:    time.Now(),
+			RealtimeStart: time.Now(),
+			RealtimeEnd:   time.Now(),
+			RoundEnd:      time.Now(),
+			BatchSize:     420,
+		}, nil)
+		if err != nil {
+			t.Fatalf("Unable to insert round metric %d: %+v", roundId, err)
+		}
+	}
+
+	inserted := []struct {
+		roundId  id.Round
+		category RoundErrorCategory
+		err      string
+	}{
+		{1, TimeoutError, "timeout"},
+		{2, BannedNodeError, "banned"},
+		{1, NodeReportedError, "node error"},
+		{1, UnknownRoundError, "unknown"},
+	}
+	for _, roundErr := range inserted {
+		err := db.InsertRoundError(roundErr.roundId, roundErr.category,
+			roundErr.err)
+		if err != nil {
+			t.Fatalf("Unable to insert round error: %+v", err)
+		}
+	}
+
+	roundErrors, err := db.GetRoundErrors(1)
+	if err != nil {
+		t.Fatalf("GetRoundErrors() returned an error: %+v", err)
+	}
+	expected := []int{0, 2, 3}
+	if len(roundErrors) != len(expected) {
+		t.Fatalf("Unexpected number of round errors."+
+			"\n\texpected: %d\n\treceived: %d", len(expected),
+			len(roundErrors))
+	}
+	for i, j := range expected {
+		if roundErrors[i].RoundMetricId != 1 ||
+			roundErrors[i].Error != inserted[j].err ||
+			roundErrors[i].Category != inserted[j].category {
+			t.Errorf("Unexpected round error at index %d."+
+				"\n\texpected: %+v\n\treceived: %+v", i, inserted[j],
+				roundErrors[i])
+		}
+	}
+
+	// A round without errors has none returned
+	roundErrors, err = db.GetRoundErrors(3)
+	if err != nil || len(roundErrors) != 0 {
+		t.Errorf("Unexpected round errors for round without errors: %v, %+v",
+			roundErrors, err)
+	}
 }
 
 // Happy path
@@ -460,6 +860,182 @@ func TestDatabaseImpl_GetEphemeralLengths(t *testing.T) {
 	}
 }
 
+// ephemeralLengthSchedule is implemented by both DatabaseImpl and MapImpl.
+type ephemeralLengthSchedule interface {
+	InsertEphemeralLength(length *EphemeralLength) error
+	GetActiveEphemeralLength(at time.Time) (*EphemeralLength, error)
+	GetNextEphemeralLength(at time.Time) (*EphemeralLength, error)
+	GetEphemeralLengthSchedule() ([]*EphemeralLength, error)
+}
+
+// testEphemeralLengthSchedule tests that the active and next EphemeralLength
+// are returned for times before, between, and exactly at activation times.
+func testEphemeralLengthSchedule(s ephemeralLengthSchedule, t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, length := range []uint8{16, 17, 18} {
+		err := s.InsertEphemeralLength(&EphemeralLength{
+			Length:    length,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert ephemeral length %d: %+v", length, err)
+		}
+	}
+
+	tests := []struct {
+		at               time.Time
+		active, next     uint8
+		noActive, noNext bool
+	}{
+		{at: start.Add(-time.Nanosecond), noActive: true, next: 16},
+		{at: start, active: 16, next: 17},
+		{at: start.Add(30 * time.Minute), active: 16, next: 17},
+		{at: start.Add(time.Hour - time.Nanosecond), active: 16, next: 17},
+		{at: start.Add(time.Hour), active: 17, next: 18},
+		{at: start.Add(2 * time.Hour), active: 18, noNext: true},
+		{at: start.Add(48 * time.Hour), active: 18, noNext: true},
+	}
+
+	for i, tt := range tests {
+		active, err := s.GetActiveEphemeralLength(tt.at)
+		if tt.noActive {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("Expected no active length at %s (%d): %+v %+v",
+					tt.at, i, active, err)
+			}
+		} else if err != nil {
+			t.Errorf("Failed to get active length at %s (%d): %+v",
+				tt.at, i, err)
+		} else if active.Length != tt.active {
+			t.Errorf("Unexpected active length at %s (%d)."+
+				"\n\texpected: %d\n\treceived: %d",
+				tt.at, i, tt.active, active.Length)
+		}
+
+		next, err := s.GetNextEphemeralLength(tt.at)
+		if tt.noNext {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				t.Errorf("Expected no next length at %s (%d): %+v %+v",
+					tt.at, i, next, err)
+			}
+		} else if err != nil {
+			t.Errorf("Failed to get next length at %s (%d): %+v",
+				tt.at, i, err)
+		} else if next.Length != tt.next {
+			t.Errorf("Unexpected next length at %s (%d)."+
+				"\n\texpected: %d\n\treceived: %d",
+				tt.at, i, tt.next, next.Length)
+		}
+	}
+}
+
+// Tests DatabaseImpl.GetActiveEphemeralLength() and
+// DatabaseImpl.GetNextEphemeralLength() around activation times.
+func TestDatabaseImpl_GetActiveEphemeralLength(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetActiveEphemeralLength", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testEphemeralLengthSchedule(d, t)
+}
+
+// Tests MapImpl.GetActiveEphemeralLength() and MapImpl.GetNextEphemeralLength()
+// around activation times.
+func TestMapImpl_GetActiveEphemeralLength(t *testing.T) {
+	testEphemeralLengthSchedule(&MapImpl{}, t)
+}
+
+// Error path: Tests that MapImpl.InsertEphemeralLength() rejects duplicate
+// lengths and timestamps.
+func TestMapImpl_InsertEphemeralLength_Duplicate(t *testing.T) {
+	m := &MapImpl{}
+	ts := time.Now()
+	if err := m.InsertEphemeralLength(&EphemeralLength{Length: 10, Timestamp: ts}); err != nil {
+		t.Fatalf("Failed to insert ephemeral length: %+v", err)
+	}
+
+	if err := m.InsertEphemeralLength(&EphemeralLength{Length: 10, Timestamp: ts.Add(time.Hour)}); err == nil {
+		t.Errorf("Expected failure from duplicate length.")
+	}
+	if err := m.InsertEphemeralLength(&EphemeralLength{Length: 11, Timestamp: ts}); err == nil {
+		t.Errorf("Expected failure from duplicate timestamp.")
+	}
+}
+
+// testEphemeralLengthOrder tests that EphemeralLength inserted before or at
+// the latest Timestamp are rejected and that the schedule is returned ordered
+// by Timestamp.
+func testEphemeralLengthOrder(s ephemeralLengthSchedule, t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Lengths are not ordered so that ordering by Length would fail
+	expected := []uint8{20, 12, 16}
+	for i, length := range expected {
+		err := s.InsertEphemeralLength(&EphemeralLength{
+			Length:    length,
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert ephemeral length %d: %+v", length, err)
+		}
+	}
+
+	outOfOrder := []*EphemeralLength{
+		{Length: 30, Timestamp: start.Add(-time.Hour)},
+		{Length: 31, Timestamp: start.Add(90 * time.Minute)},
+		{Length: 32, Timestamp: start.Add(2 * time.Hour)},
+	}
+	for _, el := range outOfOrder {
+		if err := s.InsertEphemeralLength(el); err == nil {
+			t.Errorf("Inserted ephemeral length %d at %s before the latest.",
+				el.Length, el.Timestamp)
+		}
+	}
+
+	schedule, err := s.GetEphemeralLengthSchedule()
+	if err != nil {
+		t.Fatalf("Failed to get ephemeral length schedule: %+v", err)
+	}
+	received := make([]uint8, len(schedule))
+	for i, el := range schedule {
+		received[i] = el.Length
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Unexpected ephemeral length schedule."+
+			"\n\texpected: %v\n\treceived: %v", expected, received)
+	}
+}
+
+// Tests that DatabaseImpl.InsertEphemeralLength() rejects out of order lengths
+// and DatabaseImpl.GetEphemeralLengthSchedule() returns lengths in order.
+func TestDatabaseImpl_GetEphemeralLengthSchedule(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetEphemeralLengthSchedule", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testEphemeralLengthOrder(d, t)
+}
+
+// Tests that MapImpl.InsertEphemeralLength() rejects out of order lengths and
+// MapImpl.GetEphemeralLengthSchedule() returns lengths in order.
+func TestMapImpl_GetEphemeralLengthSchedule(t *testing.T) {
+	testEphemeralLengthOrder(&MapImpl{}, t)
+}
+
 // Error path
 func TestDatabaseImpl_GetEphemeralLengthsErr(t *testing.T) {
 	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetEphemeralLengthsErr", "", "")
@@ -499,10 +1075,8 @@ func TestDatabaseImpl_GetLatestEphemeralLength(t *testing.T) {
 	for i := 0; i <= maxLen; i += 5 {
 
 		el := &EphemeralLength{
-			Length: uint8(i + 1),
-			// Unlike the real world, decrease Timestamp as Length increases
-			// in order to ensure latest EphemeralLength is based on Length
-			Timestamp: time.Now().Add(time.Duration(-i) * time.Minute),
+			Length:    uint8(i + 1),
+			Timestamp: time.Now().Add(time.Duration(i) * time.Minute),
 		}
 		err = d.InsertEphemeralLength(el)
 		if err != nil {
@@ -609,9 +1183,10 @@ func TestDatabaseImpl_GetEarliestRound(t *testing.T) {
 	}
 }
 
-// Test error path to ensure error message stays consistent
-func TestDatabaseImpl_GetStateValue(t *testing.T) {
-	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetStateValue", "", "")
+// Tests that DatabaseImpl.GetRoundMetrics only returns the RoundMetric with a
+// RealtimeEnd within the range, in order of round ID, with their Topologies.
+func TestDatabaseImpl_GetRoundMetrics(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetRoundMetrics", "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -622,20 +1197,402 @@ func TestDatabaseImpl_GetStateValue(t *testing.T) {
 		}
 	}()
 
-	_, err = d.GetStateValue("test")
-	if err == nil {
-		t.Errorf("Expected error getting bad state value!")
-		return
+	now := time.Now()
+	start, end := now.Add(-20*time.Minute), now.Add(-5*time.Minute)
+
+	metrics, err := d.GetRoundMetrics(start, end)
+	if err != nil || len(metrics) != 0 {
+		t.Errorf("Invalid return for empty roundMetrics: %v %+v", metrics, err)
 	}
 
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
-		t.Errorf("Invalid error message getting bad state value: Got %s", err.Error())
+	newTopology := make([][]byte, 2)
+	for i := 0; i < len(newTopology); i++ {
+		nid := id.NewIdFromBytes([]byte(fmt.Sprintf("Node%d", i)), t)
+		newTopology[i] = nid.Bytes()
+		appId := uint64(i+1) * 10
+		err = d.InsertApplication(&Application{Id: appId}, &Node{Code: fmt.Sprintf("TEST%d", i), Id: nid.Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert node for test: %+v", err)
+		}
 	}
-}
 
-// Unit test
-func TestDatabaseImpl_GetBin(t *testing.T) {
-	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetBin", "", "")
+	// Rounds 3 and 1 end within the range, round 2 is too old and round 4 is
+	// too recent
+	realtimeEnds := map[uint64]time.Time{
+		3: now.Add(-10 * time.Minute),
+		2: now.Add(-30 * time.Minute),
+		1: now.Add(-15 * time.Minute),
+		4: now.Add(-time.Minute),
+	}
+	for _, rid := range []uint64{3, 2, 1, 4} {
+		err = d.InsertRoundMetric(&RoundMetric{
+			Id:            rid,
+			PrecompStart:  now,
+			PrecompEnd:    now,
+			RealtimeStart: now,
+			RealtimeEnd:   realtimeEnds[rid],
+			RoundEnd:      now,
+			BatchSize:     420,
+		}, newTopology)
+		if err != nil {
+			t.Fatalf("Failed to insert round metric: %+v", err)
+		}
+	}
+
+	metrics, err = d.GetRoundMetrics(start, end)
+	if err != nil {
+		t.Fatalf("GetRoundMetrics returned an error: %+v", err)
+	}
+
+	expectedIds := []uint64{1, 3}
+	if len(metrics) != len(expectedIds) {
+		t.Fatalf("Unexpected number of RoundMetric returned."+
+			"\n\texpected: %d\n\treceived: %d", len(expectedIds), len(metrics))
+	}
+	for i, metric := range metrics {
+		if metric.Id != expectedIds[i] {
+			t.Errorf("Unexpected RoundMetric at index %d."+
+				"\n\texpected: %d\n\treceived: %d", i, expectedIds[i], metric.Id)
+		}
+		if len(metric.Topologies) != len(newTopology) {
+			t.Errorf("Unexpected number of Topologies for round %d."+
+				"\n\texpected: %d\n\treceived: %d",
+				metric.Id, len(newTopology), len(metric.Topologies))
+		}
+	}
+}
+
+// Tests that MapImpl.GetRoundMetrics only returns the RoundMetric with a
+// RealtimeEnd within the range, in order of round ID.
+func TestMapImpl_GetRoundMetrics(t *testing.T) {
+	now := time.Now()
+	m := &MapImpl{roundMetrics: map[uint64]*RoundMetric{
+		3: {Id: 3, RealtimeEnd: now.Add(-10 * time.Minute)},
+		2: {Id: 2, RealtimeEnd: now.Add(-30 * time.Minute)},
+		1: {Id: 1, RealtimeEnd: now.Add(-20 * time.Minute)},
+		4: {Id: 4, RealtimeEnd: now.Add(-time.Minute)},
+	}}
+
+	metrics, err := m.GetRoundMetrics(now.Add(-20*time.Minute), now.Add(-5*time.Minute))
+	if err != nil {
+		t.Fatalf("GetRoundMetrics returned an error: %+v", err)
+	}
+
+	expectedIds := []uint64{1, 3}
+	if len(metrics) != len(expectedIds) {
+		t.Fatalf("Unexpected number of RoundMetric returned."+
+			"\n\texpected: %d\n\treceived: %d", len(expectedIds), len(metrics))
+	}
+	for i, metric := range metrics {
+		if metric.Id != expectedIds[i] {
+			t.Errorf("Unexpected RoundMetric at index %d."+
+				"\n\texpected: %d\n\treceived: %d", i, expectedIds[i], metric.Id)
+		}
+	}
+}
+
+// Tests that DatabaseImpl.GetNetworkTPS() divides the total batch size of the
+// rounds with a RealtimeEnd within the window by the length of the window.
+func TestDatabaseImpl_GetNetworkTPS(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetNetworkTPS", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	now := time.Now()
+	start, end := now.Add(-20*time.Second), now.Add(-10*time.Second)
+
+	tps, err := d.GetNetworkTPS(start, end)
+	if err != nil || tps != 0 {
+		t.Errorf("Invalid return for empty roundMetrics: %f %+v", tps, err)
+	}
+
+	// Rounds 1 and 3 end within the window, round 2 failed before realtime
+	// and round 4 ends after the window
+	metrics := []*RoundMetric{
+		{Id: 1, RealtimeEnd: start, BatchSize: 1000},
+		{Id: 2, RealtimeEnd: time.Unix(0, 0), BatchSize: 1000},
+		{Id: 3, RealtimeEnd: end.Add(-time.Second), BatchSize: 500},
+		{Id: 4, RealtimeEnd: end.Add(time.Second), BatchSize: 1000},
+	}
+	for _, metric := range metrics {
+		metric.PrecompStart = now
+		metric.PrecompEnd = now
+		metric.RealtimeStart = now
+		metric.RoundEnd = now
+		err = d.InsertRoundMetric(metric, nil)
+		if err != nil {
+			t.Fatalf("Failed to insert round metric: %+v", err)
+		}
+	}
+
+	tps, err = d.GetNetworkTPS(start, end)
+	if err != nil {
+		t.Fatalf("GetNetworkTPS() returned an error: %+v", err)
+	}
+	if expected := 150.0; tps != expected {
+		t.Errorf("Unexpected TPS.\n\texpected: %f\n\treceived: %f",
+			expected, tps)
+	}
+
+	if _, err = d.GetNetworkTPS(end, start); err == nil {
+		t.Errorf("GetNetworkTPS() did not reject a window that ends before " +
+			"it starts.")
+	}
+}
+
+// Tests that MapImpl.GetNetworkTPS() divides the total batch size of the
+// rounds with a RealtimeEnd within the window by the length of the window.
+func TestMapImpl_GetNetworkTPS(t *testing.T) {
+	now := time.Now()
+	start, end := now.Add(-time.Minute), now
+	m := &MapImpl{roundMetrics: map[uint64]*RoundMetric{
+		1: {Id: 1, RealtimeEnd: start, BatchSize: 3000},
+		2: {Id: 2, RealtimeEnd: time.Unix(0, 0), BatchSize: 3000},
+		3: {Id: 3, RealtimeEnd: end, BatchSize: 1500},
+		4: {Id: 4, RealtimeEnd: end.Add(time.Second), BatchSize: 3000},
+	}}
+
+	tps, err := m.GetNetworkTPS(start, end)
+	if err != nil {
+		t.Fatalf("GetNetworkTPS() returned an error: %+v", err)
+	}
+	if expected := 75.0; tps != expected {
+		t.Errorf("Unexpected TPS.\n\texpected: %f\n\treceived: %f",
+			expected, tps)
+	}
+
+	if _, err = m.GetNetworkTPS(start, start); err == nil {
+		t.Errorf("GetNetworkTPS() did not reject an empty window.")
+	}
+}
+
+// Tests that GetRoundMetricsByNode only returns the RoundMetric of rounds the
+// Node participated in that ended within the time, in order of round ID.
+func TestDatabaseImpl_GetRoundMetricsByNode(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetRoundMetricsByNode", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromBytes([]byte(fmt.Sprintf("Node%d", i)), t)
+		appId := uint64(i+1) * 10
+		err = d.InsertApplication(&Application{Id: appId},
+			&Node{Code: fmt.Sprintf("TEST%d", i), Id: nodeIds[i].Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert node for test: %+v", err)
+		}
+	}
+
+	// Rounds 1 to 3 have overlapping topologies and round 4 ended too long ago
+	now := time.Now()
+	topologies := map[uint64][]*id.ID{
+		1: {nodeIds[0], nodeIds[1]},
+		2: {nodeIds[1], nodeIds[2]},
+		3: {nodeIds[2], nodeIds[0]},
+		4: {nodeIds[0], nodeIds[1], nodeIds[2]},
+	}
+	roundEnds := map[uint64]time.Time{
+		1: now.Add(-time.Hour),
+		2: now.Add(-2 * time.Hour),
+		3: now.Add(-30 * time.Minute),
+		4: now.Add(-5 * time.Hour),
+	}
+	for _, rid := range []uint64{3, 1, 4, 2} {
+		topology := make([][]byte, len(topologies[rid]))
+		for i, nid := range topologies[rid] {
+			topology[i] = nid.Bytes()
+		}
+		err = d.InsertRoundMetric(&RoundMetric{
+			Id:            rid,
+			PrecompStart:  now,
+			PrecompEnd:    now,
+			RealtimeStart: now,
+			RealtimeEnd:   now,
+			RoundEnd:      roundEnds[rid],
+			BatchSize:     420,
+		}, topology)
+		if err != nil {
+			t.Fatalf("Failed to insert round metric: %+v", err)
+		}
+	}
+
+	expectedIds := [][]uint64{{1, 3}, {1, 2}, {2, 3}}
+	for i, nid := range nodeIds {
+		metrics, err := d.GetRoundMetricsByNode(nid, now.Add(-3*time.Hour))
+		if err != nil {
+			t.Fatalf("GetRoundMetricsByNode returned an error: %+v", err)
+		}
+
+		if len(metrics) != len(expectedIds[i]) {
+			t.Fatalf("Unexpected number of RoundMetric returned for node %d."+
+				"\n\texpected: %d\n\treceived: %d", i, len(expectedIds[i]),
+				len(metrics))
+		}
+		for j, metric := range metrics {
+			if metric.Id != expectedIds[i][j] {
+				t.Errorf("Unexpected RoundMetric at index %d for node %d."+
+					"\n\texpected: %d\n\treceived: %d", j, i,
+					expectedIds[i][j], metric.Id)
+			}
+			if len(metric.Topologies) != len(topologies[metric.Id]) {
+				t.Errorf("Unexpected number of Topologies for round %d."+
+					"\n\texpected: %d\n\treceived: %d", metric.Id,
+					len(topologies[metric.Id]), len(metric.Topologies))
+			}
+		}
+	}
+}
+
+// Tests that MapImpl.GetRoundMetricsByNode only returns the RoundMetric of
+// rounds the Node participated in that ended within the time, in order of
+// round ID.
+func TestMapImpl_GetRoundMetricsByNode(t *testing.T) {
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+	}
+	newMetric := func(rid uint64, roundEnd time.Time,
+		topology ...*id.ID) *RoundMetric {
+		metric := &RoundMetric{Id: rid, RoundEnd: roundEnd}
+		for i, nid := range topology {
+			metric.Topologies = append(metric.Topologies, Topology{
+				NodeId: nid.Bytes(), RoundMetricId: rid, Order: uint8(i)})
+		}
+		return metric
+	}
+
+	now := time.Now()
+	m := &MapImpl{roundMetrics: map[uint64]*RoundMetric{
+		3: newMetric(3, now.Add(-30*time.Minute), nodeIds[2], nodeIds[0]),
+		1: newMetric(1, now.Add(-time.Hour), nodeIds[0], nodeIds[1]),
+		4: newMetric(4, now.Add(-5*time.Hour), nodeIds...),
+		2: newMetric(2, now.Add(-2*time.Hour), nodeIds[1], nodeIds[2]),
+	}}
+
+	expectedIds := [][]uint64{{1, 3}, {1, 2}, {2, 3}}
+	for i, nid := range nodeIds {
+		metrics, err := m.GetRoundMetricsByNode(nid, now.Add(-3*time.Hour))
+		if err != nil {
+			t.Fatalf("GetRoundMetricsByNode returned an error: %+v", err)
+		}
+
+		if len(metrics) != len(expectedIds[i]) {
+			t.Fatalf("Unexpected number of RoundMetric returned for node %d."+
+				"\n\texpected: %d\n\treceived: %d", i, len(expectedIds[i]),
+				len(metrics))
+		}
+		for j, metric := range metrics {
+			if metric.Id != expectedIds[i][j] {
+				t.Errorf("Unexpected RoundMetric at index %d for node %d."+
+					"\n\texpected: %d\n\treceived: %d", j, i,
+					expectedIds[i][j], metric.Id)
+			}
+		}
+	}
+}
+
+// Test error path to ensure error message stays consistent
+func TestDatabaseImpl_GetStateValue(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetStateValue", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	_, err = d.GetStateValue("test")
+	if err == nil {
+		t.Errorf("Expected error getting bad state value!")
+		return
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Invalid error message getting bad state value: Got %s", err.Error())
+	}
+}
+
+// Tests that DatabaseImpl.SwapStateValue only inserts a State that does not
+// exist and only replaces a value that has not changed.
+func TestDatabaseImpl_SwapStateValue(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_SwapStateValue", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+
+	testSwapStateValue(d.SwapStateValue, t)
+	if value, err := d.GetStateValue("test"); err != nil || value != "c" {
+		t.Errorf("Unexpected state value.\n\texpected: %q\n\treceived: %q "+
+			"(%+v)", "c", value, err)
+	}
+}
+
+// Tests that MapImpl.SwapStateValue only inserts a State that does not exist
+// and only replaces a value that has not changed.
+func TestMapImpl_SwapStateValue(t *testing.T) {
+	m := &MapImpl{}
+	testSwapStateValue(m.SwapStateValue, t)
+	if m.states["test"] != "c" {
+		t.Errorf("Unexpected state value.\n\texpected: %q\n\treceived: %q",
+			"c", m.states["test"])
+	}
+}
+
+// testSwapStateValue swaps State values with the swap function and checks
+// which swaps succeed, leaving the value "c".
+func testSwapStateValue(
+	swapStateValue func(key, oldValue, newValue string) (bool, error),
+	t *testing.T) {
+	swaps := []struct {
+		oldValue, newValue string
+		swapped            bool
+	}{
+		{"", "a", true},
+		{"", "b", false},
+		{"b", "c", false},
+		{"a", "c", true},
+		{"a", "d", false},
+	}
+	for i, swap := range swaps {
+		swapped, err := swapStateValue("test", swap.oldValue, swap.newValue)
+		if err != nil {
+			t.Fatalf("SwapStateValue returned an error for swap %d: %+v", i, err)
+		}
+		if swapped != swap.swapped {
+			t.Errorf("Unexpected result of swap %d from %q to %q."+
+				"\n\texpected: %t\n\treceived: %t", i, swap.oldValue,
+				swap.newValue, swap.swapped, swapped)
+		}
+	}
+}
+
+// Unit test
+func TestDatabaseImpl_GetBin(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetBin", "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -695,3 +1652,370 @@ func TestDatabaseImpl_GetBin(t *testing.T) {
 	}
 
 }
+
+// Tests that DisabledNode can be inserted, listed, and deleted from the
+// database and that deleting a Node that is not disabled returns an error.
+func TestDatabaseImpl_DisabledNodes(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_DisabledNodes", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+	db := d.GetDatabaseImpl(t)
+
+	testDisabledNodes(db, t)
+}
+
+// Tests that DisabledNode can be inserted, listed, and deleted from the map
+// and that deleting a Node that is not disabled returns an error.
+func TestMapImpl_DisabledNodes(t *testing.T) {
+	testDisabledNodes(&MapImpl{}, t)
+}
+
+// disabledNodeDb is the part of the database interface that stores disabled
+// Nodes, which MapImpl implements in full.
+type disabledNodeDb interface {
+	InsertDisabledNode(id *id.ID, timestamp time.Time) error
+	DeleteDisabledNode(id *id.ID) error
+	GetDisabledNodes() ([]*DisabledNode, error)
+}
+
+// testDisabledNodes inserts, lists, and deletes disabled Nodes in the database.
+func testDisabledNodes(db disabledNodeDb, t *testing.T) {
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err := db.InsertDisabledNode(nodeIds[i], time.Now())
+		if err != nil {
+			t.Fatalf("Failed to insert disabled node %d: %+v", i, err)
+		}
+	}
+
+	// Inserting a Node again updates it
+	err := db.InsertDisabledNode(nodeIds[0], time.Now())
+	if err != nil {
+		t.Fatalf("Failed to insert disabled node again: %+v", err)
+	}
+
+	err = db.DeleteDisabledNode(nodeIds[1])
+	if err != nil {
+		t.Fatalf("Failed to delete disabled node: %+v", err)
+	}
+
+	disabled, err := db.GetDisabledNodes()
+	if err != nil {
+		t.Fatalf("Failed to get disabled nodes: %+v", err)
+	}
+	received := make(map[id.ID]bool, len(disabled))
+	for _, dn := range disabled {
+		nid, err := id.Unmarshal(dn.Id)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal disabled node ID: %+v", err)
+		}
+		received[*nid] = true
+	}
+	expected := map[id.ID]bool{*nodeIds[0]: true, *nodeIds[2]: true}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Unexpected disabled nodes."+
+			"\n\texpected: %v\n\treceived: %v", expected, received)
+	}
+
+	// Error path: the Node is no longer disabled
+	err = db.DeleteDisabledNode(nodeIds[1])
+	if err == nil {
+		t.Errorf("Deleting a node that is not disabled did not return an " +
+			"error.")
+	}
+}
+
+// Tests that RevokedCertificate can be inserted into and listed from the
+// database and that revoking a certificate again returns an error.
+func TestDatabaseImpl_RevokedCertificates(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_RevokedCertificates", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+	db := d.GetDatabaseImpl(t)
+
+	testRevokedCertificates(db, t)
+}
+
+// Tests that RevokedCertificate can be inserted into and listed from the map
+// and that revoking a certificate again returns an error.
+func TestMapImpl_RevokedCertificates(t *testing.T) {
+	testRevokedCertificates(&MapImpl{}, t)
+}
+
+// revokedCertificateDb is the part of the database interface that stores
+// revoked certificates, which MapImpl implements in full.
+type revokedCertificateDb interface {
+	InsertRevokedCertificate(cert *RevokedCertificate) error
+	GetRevokedCertificates() ([]*RevokedCertificate, error)
+}
+
+// testRevokedCertificates inserts and lists revoked certificates in the
+// database.
+func testRevokedCertificates(db revokedCertificateDb, t *testing.T) {
+	// Certificates with the same serial from different issuers are distinct
+	certs := []*RevokedCertificate{
+		{Issuer: "CN=node0", Serial: "1"},
+		{Issuer: "CN=node1", Serial: "1"},
+		{Issuer: "CN=node1", Serial: "2"},
+	}
+	for i, cert := range certs {
+		cert.NodeId = id.NewIdFromUInt(uint64(i), id.Node, t).Marshal()
+		cert.Timestamp = time.Now()
+		err := db.InsertRevokedCertificate(cert)
+		if err != nil {
+			t.Fatalf("Failed to insert revoked certificate %d: %+v", i, err)
+		}
+	}
+
+	// Error path: the certificate has already been revoked
+	err := db.InsertRevokedCertificate(&RevokedCertificate{
+		Issuer:    certs[0].Issuer,
+		Serial:    certs[0].Serial,
+		NodeId:    certs[0].NodeId,
+		Timestamp: time.Now(),
+	})
+	if err == nil {
+		t.Errorf("Revoking a certificate again did not return an error.")
+	}
+
+	revoked, err := db.GetRevokedCertificates()
+	if err != nil {
+		t.Fatalf("Failed to get revoked certificates: %+v", err)
+	}
+	received := make(map[string][]byte, len(revoked))
+	for _, cert := range revoked {
+		received[cert.Issuer+" "+cert.Serial] = cert.NodeId
+	}
+	expected := make(map[string][]byte, len(certs))
+	for _, cert := range certs {
+		expected[cert.Issuer+" "+cert.Serial] = cert.NodeId
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Unexpected revoked certificates."+
+			"\n\texpected: %v\n\treceived: %v", expected, received)
+	}
+}
+
+// Tests that AllowedNodeKey can be inserted, checked, listed, and deleted from
+// the database and that deleting a key that is not listed returns an error.
+func TestDatabaseImpl_AllowedNodeKeys(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_AllowedNodeKeys", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+	db := d.GetDatabaseImpl(t)
+
+	testAllowedNodeKeys(db, t)
+}
+
+// Tests that AllowedNodeKey can be inserted, checked, listed, and deleted from
+// the map and that deleting a key that is not listed returns an error.
+func TestMapImpl_AllowedNodeKeys(t *testing.T) {
+	testAllowedNodeKeys(&MapImpl{}, t)
+}
+
+// allowedNodeKeyDb is the part of the database interface that stores the Node
+// key allowlist, which MapImpl implements in full.
+type allowedNodeKeyDb interface {
+	InsertAllowedNodeKey(fingerprint string, timestamp time.Time) error
+	DeleteAllowedNodeKey(fingerprint string) error
+	GetAllowedNodeKeys() ([]*AllowedNodeKey, error)
+	IsNodeKeyAllowed(fingerprint string) (bool, error)
+}
+
+// testAllowedNodeKeys inserts, checks, lists, and deletes allowed Node keys in
+// the database.
+func testAllowedNodeKeys(db allowedNodeKeyDb, t *testing.T) {
+	fingerprints := []string{"aa", "bb", "cc"}
+	for i, fingerprint := range fingerprints {
+		err := db.InsertAllowedNodeKey(fingerprint, time.Now())
+		if err != nil {
+			t.Fatalf("Failed to insert allowed node key %d: %+v", i, err)
+		}
+	}
+
+	// Inserting a key again updates it
+	err := db.InsertAllowedNodeKey(fingerprints[0], time.Now())
+	if err != nil {
+		t.Fatalf("Failed to insert allowed node key again: %+v", err)
+	}
+
+	err = db.DeleteAllowedNodeKey(fingerprints[1])
+	if err != nil {
+		t.Fatalf("Failed to delete allowed node key: %+v", err)
+	}
+
+	allowed, err := db.GetAllowedNodeKeys()
+	if err != nil {
+		t.Fatalf("Failed to get allowed node keys: %+v", err)
+	}
+	received := make(map[string]bool, len(allowed))
+	for _, key := range allowed {
+		received[key.Fingerprint] = true
+	}
+	expected := map[string]bool{fingerprints[0]: true, fingerprints[2]: true}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Unexpected allowed node keys."+
+			"\n\texpected: %v\n\treceived: %v", expected, received)
+	}
+
+	for _, fingerprint := range append(fingerprints, "dd") {
+		isAllowed, err := db.IsNodeKeyAllowed(fingerprint)
+		if err != nil {
+			t.Fatalf("Failed to check allowed node key %s: %+v",
+				fingerprint, err)
+		}
+		if isAllowed != expected[fingerprint] {
+			t.Errorf("Unexpected result for node key %s."+
+				"\n\texpected: %t\n\treceived: %t",
+				fingerprint, expected[fingerprint], isAllowed)
+		}
+	}
+
+	// Error path: the key is no longer listed
+	err = db.DeleteAllowedNodeKey(fingerprints[1])
+	if err == nil {
+		t.Errorf("Deleting a key that is not listed did not return an error.")
+	}
+}
+
+// Tests that GetNodeRoundOutcomes() counts the rounds each Node participated in
+// within the window and how many of them failed.
+func TestDatabaseImpl_GetNodeRoundOutcomes(t *testing.T) {
+	d, dc, err := NewDatabase("", "", "TestDatabaseImpl_GetNodeRoundOutcomes", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := dc()
+		if err != nil {
+			t.Errorf("Failed to close database: %+v", err)
+		}
+	}()
+	db := d.GetDatabaseImpl(t)
+
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromBytes([]byte(fmt.Sprintf("Node%d", i)), t)
+		err = db.InsertApplication(&Application{Id: uint64(i + 1)},
+			&Node{Code: fmt.Sprintf("TEST%d", i), Id: nodeIds[i].Bytes()})
+		if err != nil {
+			t.Fatalf("Failed to insert node for test: %+v", err)
+		}
+	}
+
+	testNodeRoundOutcomes(db, nodeIds, t)
+}
+
+// Tests that MapImpl.GetNodeRoundOutcomes() counts the rounds each Node
+// participated in within the window and how many of them failed.
+func TestMapImpl_GetNodeRoundOutcomes(t *testing.T) {
+	nodeIds := make([]*id.ID, 3)
+	for i := range nodeIds {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+	}
+
+	testNodeRoundOutcomes(&MapImpl{}, nodeIds, t)
+}
+
+// nodeRoundOutcomesDb is the part of the database interface used to count the
+// round outcomes of Nodes, which MapImpl implements in full.
+type nodeRoundOutcomesDb interface {
+	InsertRoundMetric(metric *RoundMetric, topology [][]byte) error
+	InsertRoundError(roundId id.Round, category RoundErrorCategory,
+		errStr string) error
+	GetNodeRoundOutcomes(since time.Time) (map[id.ID]NodeRoundOutcomes, error)
+}
+
+// testNodeRoundOutcomes stores rounds of the three Nodes, some of which failed
+// or ended before the window, and checks the outcomes counted for each Node.
+func testNodeRoundOutcomes(db nodeRoundOutcomesDb, nodeIds []*id.ID,
+	t *testing.T) {
+	now := time.Now()
+	rounds := []struct {
+		id       uint64
+		roundEnd time.Time
+		topology []*id.ID
+		errors   int
+	}{
+		// Round 1 has two errors, which count as one failed round
+		{1, now.Add(-time.Hour), []*id.ID{nodeIds[0], nodeIds[1]}, 2},
+		{2, now.Add(-time.Hour), []*id.ID{nodeIds[0], nodeIds[2]}, 0},
+		{3, now.Add(-2 * time.Hour), []*id.ID{nodeIds[1], nodeIds[2]}, 1},
+		{4, now.Add(-30 * time.Minute), []*id.ID{nodeIds[0]}, 0},
+		// Rounds 5 and 6 ended before the window
+		{5, now.Add(-5 * time.Hour), nodeIds, 0},
+		{6, now.Add(-5 * time.Hour), []*id.ID{nodeIds[0], nodeIds[1]}, 1},
+	}
+	for _, r := range rounds {
+		topology := make([][]byte, len(r.topology))
+		for i, nid := range r.topology {
+			topology[i] = nid.Bytes()
+		}
+		err := db.InsertRoundMetric(&RoundMetric{
+			Id:            r.id,
+			PrecompStart:  now,
+			PrecompEnd:    now,
+			RealtimeStart: now,
+			RealtimeEnd:   now,
+			RoundEnd:      r.roundEnd,
+			BatchSize:     420,
+		}, topology)
+		if err != nil {
+			t.Fatalf("Failed to insert round metric %d: %+v", r.id, err)
+		}
+		for i := 0; i < r.errors; i++ {
+			err = db.InsertRoundError(id.Round(r.id), TimeoutError,
+				"test error")
+			if err != nil {
+				t.Fatalf("Failed to insert round error for round %d: %+v",
+					r.id, err)
+			}
+		}
+	}
+
+	outcomes, err := db.GetNodeRoundOutcomes(now.Add(-3 * time.Hour))
+	if err != nil {
+		t.Fatalf("GetNodeRoundOutcomes() returned an error: %+v", err)
+	}
+
+	expected := map[id.ID]NodeRoundOutcomes{
+		*nodeIds[0]: {Rounds: 3, Failed: 1},
+		*nodeIds[1]: {Rounds: 2, Failed: 2},
+		*nodeIds[2]: {Rounds: 2, Failed: 1},
+	}
+	if !reflect.DeepEqual(expected, outcomes) {
+		t.Errorf("Unexpected round outcomes.\n\texpected: %v\n\treceived: %v",
+			expected, outcomes)
+	}
+
+	// No rounds ended after now
+	outcomes, err = db.GetNodeRoundOutcomes(now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetNodeRoundOutcomes() returned an error: %+v", err)
+	}
+	if len(outcomes) != 0 {
+		t.Errorf("Expected no round outcomes, received: %v", outcomes)
+	}
+}
@@ -0,0 +1,39 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+// Contains the enumeration of the causes of a round failure, stored with each
+// RoundError so that failures can be aggregated by cause.
+
+type RoundErrorCategory uint8
+
+const (
+	UnknownRoundError       = RoundErrorCategory(iota) // Default, cause not recorded
+	TimeoutError                                       // Round timed out in precomputation or realtime
+	BannedNodeError                                    // A member of the round was banned
+	DecommissionedNodeError                            // A member of the round was decommissioned
+	NodeReportedError                                  // A member of the round reported an error
+)
+
+// Stringer for the round error category type
+func (c RoundErrorCategory) String() string {
+	switch c {
+	case UnknownRoundError:
+		return "Unknown"
+	case TimeoutError:
+		return "Timeout"
+	case BannedNodeError:
+		return "BannedNode"
+	case DecommissionedNodeError:
+		return "DecommissionedNode"
+	case NodeReportedError:
+		return "NodeReported"
+	default:
+		return "Invalid"
+	}
+}
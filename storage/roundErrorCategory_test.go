@@ -0,0 +1,24 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import "testing"
+
+// Tests that the stringer of RoundErrorCategory is correct
+func TestRoundErrorCategory_String(t *testing.T) {
+	expected := []string{"Unknown", "Timeout", "BannedNode",
+		"DecommissionedNode", "NodeReported", "Invalid"}
+
+	for i := range expected {
+		c := RoundErrorCategory(i)
+		if c.String() != expected[i] {
+			t.Errorf("Stringer of category %d incorrect."+
+				"\n\texpected: %s\n\treceived: %s", i, expected[i], c.String())
+		}
+	}
+}
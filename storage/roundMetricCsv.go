@@ -0,0 +1,113 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles writing round metrics as CSV
+
+package storage
+
+import (
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoundMetricCsvHeader is the header row of a round metric CSV.
+var RoundMetricCsvHeader = []string{"round_id", "precomp_start",
+	"precomp_end", "realtime_start", "realtime_end", "round_end", "batch_size",
+	"client_error_count", "unknown_node_count", "topology"}
+
+// RoundMetricTimeFormat is the format of the timestamps in a round metric CSV.
+// Timestamps are written in UTC and unset timestamps are left empty.
+const RoundMetricTimeFormat = time.RFC3339Nano
+
+// TopologySeparator separates the Node IDs in the topology column of a round
+// metric CSV.
+const TopologySeparator = ";"
+
+// WriteRoundMetricsCsv writes the header followed by a row for each of the
+// metrics to the writer. The topology is written as the IDs of the Nodes in the
+// round, in order, separated by TopologySeparator.
+func WriteRoundMetricsCsv(w io.Writer, metrics []*RoundMetric) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(RoundMetricCsvHeader); err != nil {
+		return errors.Errorf("Failed to write round metric header: %+v", err)
+	}
+
+	for _, metric := range metrics {
+		row, err := roundMetricCsvRow(metric)
+		if err != nil {
+			return err
+		}
+		if err = cw.Write(row); err != nil {
+			return errors.Errorf("Failed to write round metric %d: %+v",
+				metric.Id, err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errors.Errorf("Failed to write round metrics: %+v", err)
+	}
+	return nil
+}
+
+// roundMetricCsvRow returns the CSV row of the metric.
+func roundMetricCsvRow(metric *RoundMetric) ([]string, error) {
+	topology, err := formatTopology(metric.Topologies)
+	if err != nil {
+		return nil, errors.WithMessagef(err,
+			"Failed to format topology of round metric %d", metric.Id)
+	}
+
+	return []string{
+		strconv.FormatUint(metric.Id, 10),
+		formatRoundMetricTime(metric.PrecompStart),
+		formatRoundMetricTime(metric.PrecompEnd),
+		formatRoundMetricTime(metric.RealtimeStart),
+		formatRoundMetricTime(metric.RealtimeEnd),
+		formatRoundMetricTime(metric.RoundEnd),
+		strconv.FormatUint(uint64(metric.BatchSize), 10),
+		strconv.FormatUint(uint64(metric.ClientErrorCount), 10),
+		strconv.FormatUint(uint64(metric.UnknownNodeCount), 10),
+		topology,
+	}, nil
+}
+
+// formatRoundMetricTime formats the timestamp in UTC, or returns an empty
+// string if it is unset.
+func formatRoundMetricTime(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+	return t.UTC().Format(RoundMetricTimeFormat)
+}
+
+// formatTopology returns the IDs of the Nodes in the topology, in order,
+// separated by TopologySeparator.
+func formatTopology(topologies []Topology) (string, error) {
+	ordered := make([]Topology, len(topologies))
+	copy(ordered, topologies)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Order < ordered[j].Order
+	})
+
+	nodes := make([]string, len(ordered))
+	for i, topology := range ordered {
+		nid, err := id.Unmarshal(topology.NodeId)
+		if err != nil {
+			return "", err
+		}
+		nodes[i] = nid.String()
+	}
+
+	return strings.Join(nodes, TopologySeparator), nil
+}
@@ -0,0 +1,80 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that WriteRoundMetricsCsv() writes the header and a row for each
+// metric, with timestamps in UTC and the topology in order.
+func TestWriteRoundMetricsCsv(t *testing.T) {
+	start := time.Date(2022, 3, 4, 5, 6, 7, 800, time.FixedZone("test", 3600))
+	node0 := id.NewIdFromString("node0", id.Node, t)
+	node1 := id.NewIdFromString("node1", id.Node, t)
+	metrics := []*RoundMetric{{
+		Id:               5,
+		PrecompStart:     start,
+		PrecompEnd:       start.Add(time.Second),
+		RealtimeStart:    start.Add(2 * time.Second),
+		RealtimeEnd:      start.Add(3 * time.Second),
+		BatchSize:        32,
+		ClientErrorCount: 1,
+		UnknownNodeCount: 2,
+		Topologies: []Topology{
+			{NodeId: node1.Bytes(), Order: 1},
+			{NodeId: node0.Bytes(), Order: 0},
+		},
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := WriteRoundMetricsCsv(buf, metrics); err != nil {
+		t.Fatalf("WriteRoundMetricsCsv() returned an error: %+v", err)
+	}
+
+	rows, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %+v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Unexpected number of rows.\n\texpected: %d\n\treceived: %d",
+			2, len(rows))
+	}
+	if !reflect.DeepEqual(RoundMetricCsvHeader, rows[0]) {
+		t.Errorf("Unexpected header.\n\texpected: %v\n\treceived: %v",
+			RoundMetricCsvHeader, rows[0])
+	}
+
+	expected := []string{"5", "2022-03-04T04:06:07.0000008Z",
+		"2022-03-04T04:06:08.0000008Z", "2022-03-04T04:06:09.0000008Z",
+		"2022-03-04T04:06:10.0000008Z", "", "32", "1", "2",
+		node0.String() + TopologySeparator + node1.String()}
+	if !reflect.DeepEqual(expected, rows[1]) {
+		t.Errorf("Unexpected row.\n\texpected: %v\n\treceived: %v",
+			expected, rows[1])
+	}
+}
+
+// Tests that WriteRoundMetricsCsv() returns an error for a topology with an
+// invalid Node ID.
+func TestWriteRoundMetricsCsv_InvalidTopology(t *testing.T) {
+	metrics := []*RoundMetric{{
+		Id:         5,
+		Topologies: []Topology{{NodeId: []byte("invalid")}},
+	}}
+
+	if err := WriteRoundMetricsCsv(&bytes.Buffer{}, metrics); err == nil {
+		t.Errorf("WriteRoundMetricsCsv() did not return an error for an " +
+			"invalid topology.")
+	}
+}
@@ -0,0 +1,120 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the pool of workers that sign round updates
+
+package storage
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/comms/network/dataStructures"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/xx_network/comms/signature"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"runtime"
+	"sync"
+)
+
+// roundUpdateSigningQueueLength is the number of round updates waiting to be
+// signed before AddRoundUpdate blocks.
+const roundUpdateSigningQueueLength = 500
+
+// defaultRoundUpdateSigners is the default number of workers signing round
+// updates.
+var defaultRoundUpdateSigners = runtime.NumCPU()
+
+// roundUpdateSigningJob is a round update waiting to be signed with the key
+// that was active when it was added.
+type roundUpdateSigningJob struct {
+	roundInfo  *pb.RoundInfo
+	signingKey *rsa.PrivateKey
+}
+
+// roundUpdateSigners is a pool of workers that sign round updates and send
+// them to the RoundAdderRoutine. Updates may finish signing out of order; the
+// RoundAdderRoutine adds them in order of their update IDs.
+type roundUpdateSigners struct {
+	jobs chan roundUpdateSigningJob
+
+	// Each value received stops one worker
+	stop chan struct{}
+
+	workers int
+	mux     sync.Mutex
+}
+
+// SetRoundUpdateSigners sets the number of workers signing round updates,
+// starting or stopping workers as needed. Stopped workers finish the update
+// they are signing first.
+func (s *NetworkState) SetRoundUpdateSigners(workers int) error {
+	if workers < 1 {
+		return errors.Errorf("Number of round update signers must be "+
+			"positive, received %d", workers)
+	}
+
+	s.signers.mux.Lock()
+	defer s.signers.mux.Unlock()
+
+	for ; s.signers.workers < workers; s.signers.workers++ {
+		go s.roundUpdateSigner()
+	}
+	for ; s.signers.workers > workers; s.signers.workers-- {
+		s.signers.stop <- struct{}{}
+	}
+
+	return nil
+}
+
+// GetRoundUpdateSigners returns the number of workers signing round updates.
+func (s *NetworkState) GetRoundUpdateSigners() int {
+	s.signers.mux.Lock()
+	defer s.signers.mux.Unlock()
+	return s.signers.workers
+}
+
+// roundUpdateSigner signs queued round updates with the RSA and elliptic curve
+// keys and sends them to the RoundAdderRoutine until it is stopped.
+func (s *NetworkState) roundUpdateSigner() {
+	for {
+		select {
+		case <-s.signers.stop:
+			return
+		case job := <-s.signers.jobs:
+			s.roundUpdatesToAddCh <- s.signRoundUpdate(job)
+		}
+	}
+}
+
+// signRoundUpdate signs the round update of the job and returns it as a
+// verified round.
+func (s *NetworkState) signRoundUpdate(job roundUpdateSigningJob) *dataStructures.Round {
+	roundInfo := job.roundInfo
+	err := signature.SignRsa(roundInfo, job.signingKey)
+	if err != nil {
+		jww.FATAL.Panicf("Could not add round update %v "+
+			"for round %v due to failed signature: %+v",
+			roundInfo.UpdateID, roundInfo.ID, err)
+	}
+
+	err = signature.SignEddsa(roundInfo, s.GetEllipticPrivateKey())
+	if err != nil {
+		jww.FATAL.Panicf("Could not add round update %v "+
+			"for round %v due to failed elliptic curve "+
+			"signature: %+v", roundInfo.UpdateID,
+			roundInfo.ID, err)
+	}
+
+	jww.TRACE.Printf("Round Info: %+v", roundInfo)
+
+	jww.INFO.Printf("Round %v state updated to %s", roundInfo.ID,
+		states.Round(roundInfo.State))
+
+	return dataStructures.NewVerifiedRound(roundInfo,
+		job.signingKey.GetPublic())
+}
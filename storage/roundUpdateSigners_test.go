@@ -0,0 +1,145 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/states"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// countStorageGoroutines returns the number of goroutines, across every
+// NetworkState, started by this package, including those not yet running.
+func countStorageGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return bytes.Count(buf[:n],
+				[]byte("created by gitlab.com/elixxir/registration/storage."))
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Tests that many round updates added rapidly are all signed and added in
+// order without starting a goroutine per update.
+func TestNetworkState_AddRoundUpdate_SignerPool(t *testing.T) {
+	const numUpdates = 300
+	const workers = 4
+	state := newRoundAdderTestState(0, t)
+	err := state.SetRoundUpdateSigners(workers)
+	if err != nil {
+		t.Fatalf("Failed to set round update signers: %+v", err)
+	}
+
+	firstID := uint64(state.roundUpdates.GetLastUpdateID() + 1)
+	baseline := countStorageGoroutines()
+	maxGoroutines := baseline
+	for i := 0; i < numUpdates; i++ {
+		err = state.AddRoundUpdate(&pb.RoundInfo{
+			ID:         uint64(i + 1),
+			Timestamps: make([]uint64, states.FAILED),
+		})
+		if err != nil {
+			t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+		}
+		if n := countStorageGoroutines(); n > maxGoroutines {
+			maxGoroutines = n
+		}
+	}
+
+	if maxGoroutines != baseline {
+		t.Errorf("Goroutines were started while adding round updates."+
+			"\n\tbaseline: %d\n\tmaximum: %d", baseline, maxGoroutines)
+	}
+
+	lastID := int(firstID) + numUpdates - 1
+	timeout := time.After(10 * time.Second)
+	for state.roundUpdates.GetLastUpdateID() != lastID {
+		select {
+		case <-timeout:
+			t.Fatalf("Round updates were never all added."+
+				"\n\texpected last update ID: %d\n\treceived: %d",
+				lastID, state.roundUpdates.GetLastUpdateID())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	updates, err := state.GetUpdates(int(firstID) - 1)
+	if err != nil {
+		t.Fatalf("GetUpdates() produced an error: %+v", err)
+	}
+	if len(updates) != numUpdates {
+		t.Fatalf("Unexpected number of updates.\n\texpected: %d"+
+			"\n\treceived: %d", numUpdates, len(updates))
+	}
+	for i, update := range updates {
+		if update.ID != uint64(i+1) || update.UpdateID != firstID+uint64(i) {
+			t.Errorf("Update %d out of order.\n\treceived: round %d, "+
+				"update %d", i, update.ID, update.UpdateID)
+		}
+	}
+}
+
+// Tests that SetRoundUpdateSigners() starts and stops workers and that round
+// updates are still signed after workers are stopped.
+func TestNetworkState_SetRoundUpdateSigners(t *testing.T) {
+	state := newRoundAdderTestState(0, t)
+
+	for _, workers := range []int{8, 1} {
+		baseline := countStorageGoroutines() - state.GetRoundUpdateSigners()
+		err := state.SetRoundUpdateSigners(workers)
+		if err != nil {
+			t.Fatalf("Failed to set %d round update signers: %+v",
+				workers, err)
+		}
+		if received := state.GetRoundUpdateSigners(); received != workers {
+			t.Errorf("Unexpected number of round update signers."+
+				"\n\texpected: %d\n\treceived: %d", workers, received)
+		}
+
+		// Stopped workers exit asynchronously
+		timeout := time.After(time.Second)
+		for countStorageGoroutines() != baseline+workers {
+			select {
+			case <-timeout:
+				t.Fatalf("Unexpected number of goroutines for %d "+
+					"signers.\n\texpected: %d\n\treceived: %d", workers,
+					baseline+workers, countStorageGoroutines())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}
+
+	lastID := state.roundUpdates.GetLastUpdateID()
+	err := state.AddRoundUpdate(&pb.RoundInfo{
+		Timestamps: make([]uint64, states.FAILED)})
+	if err != nil {
+		t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+	}
+	waitForLastUpdateID(state, lastID+1, t)
+}
+
+// Error path: Tests that SetRoundUpdateSigners() rejects a pool without
+// workers.
+func TestNetworkState_SetRoundUpdateSigners_NoWorkers(t *testing.T) {
+	state := newRoundAdderTestState(0, t)
+	workers := state.GetRoundUpdateSigners()
+
+	if err := state.SetRoundUpdateSigners(0); err == nil {
+		t.Error("SetRoundUpdateSigners() did not reject zero workers.")
+	}
+	if received := state.GetRoundUpdateSigners(); received != workers {
+		t.Errorf("Number of round update signers changed."+
+			"\n\texpected: %d\n\treceived: %d", workers, received)
+	}
+}
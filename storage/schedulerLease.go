@@ -0,0 +1,294 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the lease a permissioning server must hold to schedule rounds
+
+package storage
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SchedulerLease is the lease stored in the State table by the permissioning
+// server scheduling rounds. A second server sharing the database detects the
+// lease and refuses to schedule until it expires, so that only one server
+// creates rounds and increments the round and update IDs.
+type SchedulerLease struct {
+	Holder string
+	Expiry time.Time
+}
+
+// schedulerLease tracks the lease held by the NetworkState and signals the
+// scheduler when it is acquired or lost.
+type schedulerLease struct {
+	// Identifies this server as the holder of the lease
+	holder string
+
+	// How long the lease is held without a heartbeat; 0 disables the lease
+	duration int64
+
+	// When the lease held by this server expires, in Unix nanoseconds; 0 if
+	// the lease is not held
+	expiry int64
+
+	mux     sync.Mutex
+	changed chan struct{}
+}
+
+// SchedulerLeaseHolder returns a name identifying the server at the address as
+// the holder of the lease, made up of the host name and the address. The name
+// is stable across restarts, so that a restarted server reclaims its own lease,
+// and distinguishes servers on the same host. Without an address, only the host
+// name is used.
+func SchedulerLeaseHolder(address string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	if address == "" {
+		return host
+	}
+	return host + "/" + address
+}
+
+// SetSchedulerLeaseHolder sets the name identifying this server as the holder
+// of the scheduler lease. It must be stable across restarts, so that a server
+// restarting after a crash reclaims the lease it held, and unique among the
+// servers sharing the database.
+func (s *NetworkState) SetSchedulerLeaseHolder(holder string) {
+	s.lease.mux.Lock()
+	defer s.lease.mux.Unlock()
+	s.lease.holder = holder
+}
+
+// SetSchedulerLeaseDuration sets how long the scheduler lease is held without a
+// heartbeat. Once set, new rounds are only scheduled while the lease is held.
+// The lease is disabled when set to 0.
+func (s *NetworkState) SetSchedulerLeaseDuration(duration time.Duration) {
+	atomic.StoreInt64(&s.lease.duration, int64(duration))
+}
+
+// GetSchedulerLeaseHolder returns the name identifying this server as the
+// holder of the scheduler lease.
+func (s *NetworkState) GetSchedulerLeaseHolder() string {
+	s.lease.mux.Lock()
+	defer s.lease.mux.Unlock()
+	return s.lease.holder
+}
+
+// HoldsSchedulerLease returns true if this server holds the scheduler lease or
+// the lease is disabled.
+func (s *NetworkState) HoldsSchedulerLease() bool {
+	if atomic.LoadInt64(&s.lease.duration) == 0 {
+		return true
+	}
+	return time.Now().UnixNano() < atomic.LoadInt64(&s.lease.expiry)
+}
+
+// GetSchedulerLeaseChangeChannel returns a channel that receives a signal when
+// the scheduler lease is acquired or lost, so that the scheduler can reconsider
+// the nodes waiting to be scheduled.
+func (s *NetworkState) GetSchedulerLeaseChangeChannel() <-chan struct{} {
+	return s.lease.changed
+}
+
+// AcquireSchedulerLease acquires or renews the scheduler lease. Returns an
+// error naming the holder if the lease is held by another server. When the
+// lease is newly acquired, the round and update IDs are reloaded from storage
+// in case another server advanced them.
+func (s *NetworkState) AcquireSchedulerLease() error {
+	duration := time.Duration(atomic.LoadInt64(&s.lease.duration))
+	if duration == 0 {
+		return nil
+	}
+
+	s.lease.mux.Lock()
+	defer s.lease.mux.Unlock()
+
+	key := s.stateKey(SchedulerLeaseKey)
+	current, err := PermissioningDb.GetStateValue(key)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return errors.Errorf("Unable to obtain scheduler lease: %+v", err)
+	}
+
+	now := time.Now()
+	if current != "" {
+		lease := &SchedulerLease{}
+		if err = json.Unmarshal([]byte(current), lease); err != nil {
+			return errors.Errorf("Unable to parse scheduler lease: %+v", err)
+		}
+		if lease.Holder != s.lease.holder && now.Before(lease.Expiry) {
+			s.loseSchedulerLease()
+			return errors.Errorf("Scheduler lease of network %q is held by "+
+				"%s until %s", s.network, lease.Holder, lease.Expiry)
+		}
+	}
+
+	value, err := json.Marshal(&SchedulerLease{
+		Holder: s.lease.holder,
+		Expiry: now.Add(duration),
+	})
+	if err != nil {
+		return errors.Errorf("Unable to marshal scheduler lease: %+v", err)
+	}
+	swapped, err := PermissioningDb.SwapStateValue(key, current, string(value))
+	if err != nil {
+		return errors.Errorf("Unable to store scheduler lease: %+v", err)
+	} else if !swapped {
+		s.loseSchedulerLease()
+		return errors.Errorf("Scheduler lease of network %q was taken by "+
+			"another server", s.network)
+	}
+
+	if !s.HoldsSchedulerLease() {
+		if err = s.reloadIds(); err != nil {
+			return err
+		}
+		jww.INFO.Printf("Acquired scheduler lease of network %q as %s",
+			s.network, s.lease.holder)
+		defer s.signalSchedulerLeaseChange()
+	}
+	atomic.StoreInt64(&s.lease.expiry, now.Add(duration).UnixNano())
+
+	return nil
+}
+
+// ReleaseSchedulerLease expires the scheduler lease held by this server so that
+// another server can acquire it without waiting for it to expire.
+func (s *NetworkState) ReleaseSchedulerLease() error {
+	if atomic.LoadInt64(&s.lease.duration) == 0 || !s.HoldsSchedulerLease() {
+		return nil
+	}
+
+	s.lease.mux.Lock()
+	defer s.lease.mux.Unlock()
+
+	key := s.stateKey(SchedulerLeaseKey)
+	current, err := PermissioningDb.GetStateValue(key)
+	if err != nil {
+		return errors.Errorf("Unable to obtain scheduler lease: %+v", err)
+	}
+
+	lease := &SchedulerLease{}
+	if err = json.Unmarshal([]byte(current), lease); err != nil {
+		return errors.Errorf("Unable to parse scheduler lease: %+v", err)
+	}
+	if lease.Holder != s.lease.holder {
+		s.loseSchedulerLease()
+		return errors.Errorf("Scheduler lease of network %q was taken by %s",
+			s.network, lease.Holder)
+	}
+	atomic.StoreInt64(&s.lease.expiry, 0)
+	s.signalSchedulerLeaseChange()
+
+	value, err := json.Marshal(&SchedulerLease{
+		Holder: s.lease.holder,
+		Expiry: time.Now(),
+	})
+	if err != nil {
+		return errors.Errorf("Unable to marshal scheduler lease: %+v", err)
+	}
+
+	swapped, err := PermissioningDb.SwapStateValue(key, current, string(value))
+	if err != nil {
+		return errors.Errorf("Unable to store scheduler lease: %+v", err)
+	} else if !swapped {
+		return errors.Errorf("Scheduler lease of network %q was taken by "+
+			"another server", s.network)
+	}
+
+	jww.INFO.Printf("Released scheduler lease of network %q", s.network)
+	return nil
+}
+
+// TrackSchedulerLease starts a service that renews the scheduler lease as a
+// heartbeat, or acquires it once the server holding it stops renewing it. The
+// lease is released when the quit channel is invoked.
+func (s *NetworkState) TrackSchedulerLease(quit chan struct{}) {
+	duration := time.Duration(atomic.LoadInt64(&s.lease.duration))
+	if duration == 0 {
+		<-quit
+		return
+	}
+
+	ticker := time.NewTicker(duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			jww.INFO.Print("Stopping scheduler lease tracker.")
+			if err := s.ReleaseSchedulerLease(); err != nil {
+				jww.ERROR.Printf("Failed to release scheduler lease: %+v", err)
+			}
+			return
+		case <-ticker.C:
+			held := s.HoldsSchedulerLease()
+			if err := s.AcquireSchedulerLease(); err != nil && held {
+				jww.ERROR.Printf("Failed to renew scheduler lease: %+v", err)
+			} else if err != nil {
+				jww.DEBUG.Printf("Waiting on scheduler lease: %+v", err)
+			}
+		}
+	}
+}
+
+// loseSchedulerLease marks the lease as not held by this server. Must be called
+// while holding the lease lock.
+func (s *NetworkState) loseSchedulerLease() {
+	if atomic.SwapInt64(&s.lease.expiry, 0) > time.Now().UnixNano() {
+		jww.WARN.Printf("Lost scheduler lease of network %q, no new rounds "+
+			"will be scheduled", s.network)
+		s.signalSchedulerLeaseChange()
+	}
+}
+
+// signalSchedulerLeaseChange signals the change without blocking; a pending
+// signal already covers it.
+func (s *NetworkState) signalSchedulerLeaseChange() {
+	select {
+	case s.lease.changed <- struct{}{}:
+	default:
+	}
+}
+
+// reloadIds replaces the round and update IDs with those in storage if they
+// are ahead, which happens when another server scheduled rounds while this
+// server did not hold the lease.
+func (s *NetworkState) reloadIds() error {
+	roundID, err := s.GetRoundID()
+	if err != nil {
+		return err
+	}
+	if roundID > id.Round(atomic.LoadUint64((*uint64)(&s.roundID))) {
+		jww.INFO.Printf("Advancing round ID of network %q to %d",
+			s.network, roundID)
+		atomic.StoreUint64((*uint64)(&s.roundID), uint64(roundID))
+	}
+
+	s.updateMux.Lock()
+	defer s.updateMux.Unlock()
+	updateID, err := s.GetUpdateID()
+	if err != nil {
+		return err
+	}
+	if updateID > atomic.LoadUint64(&s.updateID) {
+		jww.INFO.Printf("Advancing update ID of network %q to %d",
+			s.network, updateID)
+		atomic.StoreUint64(&s.updateID, updateID)
+	}
+
+	return nil
+}
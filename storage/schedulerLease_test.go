@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLeaseTestStates returns two NetworkState sharing a database, as two
+// permissioning servers would, with the scheduler lease enabled and distinct
+// holders.
+func newLeaseTestStates(duration time.Duration, t *testing.T) (
+	*NetworkState, *NetworkState) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	states := make([]*NetworkState, 2)
+	for i := range states {
+		states[i], _, err = generateTestNetworkState()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		states[i].SetSchedulerLeaseDuration(duration)
+		states[i].SetSchedulerLeaseHolder(fmt.Sprintf("server%d", i))
+	}
+
+	return states[0], states[1]
+}
+
+// Tests that only one of two NetworkState contending for the scheduler lease
+// acquires it, and that the other acquires it, continuing from the stored round
+// and update IDs, once it is released.
+func TestNetworkState_AcquireSchedulerLease(t *testing.T) {
+	leader, standby := newLeaseTestStates(time.Minute, t)
+
+	if err := leader.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Failed to acquire scheduler lease: %+v", err)
+	}
+	err := standby.AcquireSchedulerLease()
+	if err == nil || !strings.Contains(err.Error(),
+		leader.GetSchedulerLeaseHolder()) {
+		t.Errorf("Acquiring a held lease did not return an error naming its "+
+			"holder: %+v", err)
+	}
+	if !leader.HoldsSchedulerLease() || standby.HoldsSchedulerLease() {
+		t.Errorf("Unexpected lease holders.\n\texpected: leader\n\treceived: "+
+			"leader %t, standby %t", leader.HoldsSchedulerLease(),
+			standby.HoldsSchedulerLease())
+	}
+
+	// The leader schedules rounds, advancing the IDs
+	for i := 0; i < 3; i++ {
+		if _, err = leader.IncrementRoundID(); err != nil {
+			t.Fatalf("Leader failed to increment round ID: %+v", err)
+		}
+		if _, err = leader.IncrementUpdateID(); err != nil {
+			t.Fatalf("Leader failed to increment update ID: %+v", err)
+		}
+	}
+	// Renewing the lease keeps it with the leader
+	if err = leader.AcquireSchedulerLease(); err != nil {
+		t.Errorf("Failed to renew scheduler lease: %+v", err)
+	}
+	if err = standby.AcquireSchedulerLease(); err == nil {
+		t.Errorf("Standby acquired a renewed lease.")
+	}
+
+	// The standby takes over once the lease is released
+	if err = leader.ReleaseSchedulerLease(); err != nil {
+		t.Fatalf("Failed to release scheduler lease: %+v", err)
+	}
+	if err = standby.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Standby failed to acquire a released lease: %+v", err)
+	}
+	if leader.HoldsSchedulerLease() || !standby.HoldsSchedulerLease() {
+		t.Errorf("Unexpected lease holders.\n\texpected: standby\n\treceived: "+
+			"leader %t, standby %t", leader.HoldsSchedulerLease(),
+			standby.HoldsSchedulerLease())
+	}
+	expected, received := leader.GetSnapshot(), standby.GetSnapshot()
+	if received.RoundID != expected.RoundID ||
+		received.UpdateID != expected.UpdateID {
+		t.Errorf("Standby did not continue from the stored IDs."+
+			"\n\texpected: round %d, update %d\n\treceived: round %d, "+
+			"update %d", expected.RoundID, expected.UpdateID,
+			received.RoundID, received.UpdateID)
+	}
+}
+
+// Tests that a lease that is not renewed expires and can be acquired by
+// another NetworkState, after which the former holder cannot renew it.
+func TestNetworkState_AcquireSchedulerLease_Expired(t *testing.T) {
+	leader, standby := newLeaseTestStates(50*time.Millisecond, t)
+
+	if err := leader.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Failed to acquire scheduler lease: %+v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if leader.HoldsSchedulerLease() {
+		t.Errorf("Lease held after it expired.")
+	}
+
+	if err := standby.AcquireSchedulerLease(); err != nil {
+		t.Fatalf("Failed to acquire an expired lease: %+v", err)
+	}
+	select {
+	case <-standby.GetSchedulerLeaseChangeChannel():
+	default:
+		t.Errorf("Acquiring the lease was not signalled.")
+	}
+
+	if err := leader.AcquireSchedulerLease(); err == nil {
+		t.Errorf("Former leader acquired a lease held by another server.")
+	}
+}
+
+// Tests that a NetworkState without a lease duration always holds the lease.
+func TestNetworkState_HoldsSchedulerLease_Disabled(t *testing.T) {
+	state, _ := newLeaseTestStates(0, t)
+
+	if !state.HoldsSchedulerLease() {
+		t.Errorf("Disabled lease not held.")
+	}
+	if err := state.AcquireSchedulerLease(); err != nil {
+		t.Errorf("Acquiring a disabled lease returned an error: %+v", err)
+	}
+}
@@ -0,0 +1,155 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles rotating the RSA key NDFs and round updates are signed with
+
+package storage
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/comms/signature"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/crypto/tls"
+	"sync"
+	"time"
+)
+
+// signingKey is an RSA key that NDFs and round updates are signed with once it
+// becomes active.
+type signingKey struct {
+	key *rsa.PrivateKey
+
+	// PEM certificate of the key published in the NDF so that clients can
+	// verify its signatures
+	certificate string
+
+	// Time the key starts signing, replacing the key before it
+	activeFrom time.Time
+
+	// How long the signatures of the key before it continue to verify after
+	// this key becomes active
+	gracePeriod time.Duration
+}
+
+// signingKeys holds the RSA keys the server rotates to after the key it was
+// started with, ordered by the time they become active. Each key signs until
+// the next key becomes active and its signatures verify until the grace period
+// of the next key has passed.
+type signingKeys struct {
+	keys []*signingKey
+
+	// The elliptic curve public key signed with the active key and the key
+	// it was signed with, so that it is only signed again after a rotation
+	signedEllipticKey *SignedEllipticKey
+	ellipticKeySigner *rsa.PrivateKey
+
+	mux sync.RWMutex
+}
+
+// active returns the index of the key active at the given time or -1 if no
+// key has replaced the key the server was started with. Must be called with
+// the lock held.
+func (sk *signingKeys) active(now time.Time) int {
+	for i := len(sk.keys) - 1; i >= 0; i-- {
+		if !sk.keys[i].activeFrom.After(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddSigningKey adds an RSA key that NDFs and round updates are signed with
+// from activeFrom, replacing the current signing key without a hard cutover.
+// Once the key is active, its certificate is published as the registration
+// certificate the next time the NDF is output and signatures of the key it
+// replaces continue to verify for the grace period. The certificate must be of
+// the key and the key must become active after every key added before it.
+func (s *NetworkState) AddSigningKey(key *rsa.PrivateKey, certificate string,
+	activeFrom time.Time, gracePeriod time.Duration) error {
+	if key == nil {
+		return errors.New("Signing key is nil")
+	} else if gracePeriod < 0 {
+		return errors.Errorf("Grace period %s must not be negative",
+			gracePeriod)
+	}
+
+	certKey, err := tls.NewPublicKeyFromPEM([]byte(certificate))
+	if err != nil {
+		return errors.Errorf("Failed to load the public key of the signing "+
+			"key certificate: %+v", err)
+	} else if certKey.GetN().Cmp(key.GetN()) != 0 ||
+		certKey.GetE() != key.GetE() {
+		return errors.New("Signing key certificate is not of the signing key")
+	}
+
+	s.signingKeys.mux.Lock()
+	defer s.signingKeys.mux.Unlock()
+
+	if numKeys := len(s.signingKeys.keys); numKeys > 0 {
+		last := s.signingKeys.keys[numKeys-1]
+		if !activeFrom.After(last.activeFrom) {
+			return errors.Errorf("Signing key must become active after the "+
+				"last signing key added, which becomes active at %s",
+				last.activeFrom)
+		}
+	}
+
+	s.signingKeys.keys = append(s.signingKeys.keys, &signingKey{
+		key:         key,
+		certificate: certificate,
+		activeFrom:  activeFrom,
+		gracePeriod: gracePeriod,
+	})
+	jww.INFO.Printf("Added signing key for network %q active from %s with "+
+		"a grace period of %s", s.network, activeFrom, gracePeriod)
+
+	return nil
+}
+
+// getSigningKey returns the active signing key and the certificate to publish
+// in the NDF for it, which is empty if the NDF certificate is not replaced.
+func (s *NetworkState) getSigningKey() (*rsa.PrivateKey, string) {
+	s.signingKeys.mux.RLock()
+	defer s.signingKeys.mux.RUnlock()
+
+	i := s.signingKeys.active(time.Now())
+	if i < 0 {
+		return s.rsaPrivateKey, ""
+	}
+	return s.signingKeys.keys[i].key, s.signingKeys.keys[i].certificate
+}
+
+// VerifyRsa verifies the RSA signature of the message against the active
+// signing key and any earlier key still within the grace period of the key
+// that replaced it.
+func (s *NetworkState) VerifyRsa(msg signature.GenericRsaSignable) error {
+	s.signingKeys.mux.RLock()
+	defer s.signingKeys.mux.RUnlock()
+
+	now := time.Now()
+	keys := s.signingKeys.keys
+	var err error
+	for i := s.signingKeys.active(now); i >= -1; i-- {
+		if i < len(keys)-1 &&
+			!now.Before(keys[i+1].activeFrom.Add(keys[i+1].gracePeriod)) {
+			continue
+		}
+
+		key := s.rsaPrivateKey
+		if i >= 0 {
+			key = keys[i].key
+		}
+		err = signature.VerifyRsa(msg, key.GetPublic())
+		if err == nil {
+			return nil
+		}
+	}
+
+	return errors.Errorf("Signature does not verify against any valid "+
+		"signing key: %+v", err)
+}
@@ -0,0 +1,238 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/primitives/states"
+	"gitlab.com/xx_network/comms/signature"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/ndf"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSigningKey returns a new RSA key and a PEM certificate of it.
+func newTestSigningKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "registration"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PrivateKey.PublicKey, &key.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	return key, string(pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// addSignedRoundUpdate adds a round update to the state and returns it once
+// it has been signed.
+func addSignedRoundUpdate(state *NetworkState, roundID uint64,
+	t *testing.T) *pb.RoundInfo {
+	err := state.AddRoundUpdate(&pb.RoundInfo{
+		ID:         roundID,
+		Timestamps: make([]uint64, states.NUM_STATES),
+	})
+	if err != nil {
+		t.Fatalf("Failed to add round update: %+v", err)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		for _, update := range state.roundUpdates.GetUpdates(0) {
+			if update.ID == roundID {
+				return update
+			}
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Round update for round %d was not added.", roundID)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// Tests that round updates and NDFs are signed with a new signing key once it
+// becomes active, that updates signed before and after the rotation both
+// verify during the grace period, and that the NDF publishes the certificate
+// of the new key.
+func TestNetworkState_AddSigningKey(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, oldKey, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	oldSignedKey := state.GetSignedEllipticPublicKey()
+
+	newKey, newCert := newTestSigningKey(t)
+	activeFrom := time.Now().Add(100 * time.Millisecond)
+	gracePeriod := 300 * time.Millisecond
+	err = state.AddSigningKey(newKey, newCert, activeFrom, gracePeriod)
+	if err != nil {
+		t.Fatalf("Failed to add signing key: %+v", err)
+	}
+
+	// The old key signs until the new key is active
+	if state.GetPrivateKey() != oldKey {
+		t.Errorf("Signing key changed before the new key is active.")
+	}
+	before := addSignedRoundUpdate(state, 1, t)
+
+	time.Sleep(time.Until(activeFrom))
+	if state.GetPrivateKey() != newKey {
+		t.Errorf("Signing key did not change once the new key is active.")
+	}
+	after := addSignedRoundUpdate(state, 2, t)
+
+	// Each update is signed by the key active when it was made and both
+	// verify during the grace period
+	if err = signature.VerifyRsa(before, oldKey.GetPublic()); err != nil {
+		t.Errorf("Update before the rotation is not signed with the old "+
+			"key: %+v", err)
+	}
+	if err = signature.VerifyRsa(after, newKey.GetPublic()); err != nil {
+		t.Errorf("Update after the rotation is not signed with the new "+
+			"key: %+v", err)
+	}
+	for name, update := range map[string]*pb.RoundInfo{
+		"before": before, "after": after} {
+		if err = state.VerifyRsa(update); err != nil {
+			t.Errorf("Update signed %s the rotation does not verify: %+v",
+				name, err)
+		}
+	}
+
+	// The elliptic key is signed again with the new key
+	signedKey := state.GetSignedEllipticPublicKey()
+	if signedKey == oldSignedKey {
+		t.Errorf("Elliptic key was not signed again after the rotation.")
+	} else if err = signature.VerifyRsa(signedKey, newKey.GetPublic()); err != nil {
+		t.Errorf("Elliptic key is not signed with the new key: %+v", err)
+	}
+
+	// The NDF is signed with the new key and publishes its certificate
+	state.UpdateInternalNdf(withTestNode(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{TlsCertificate: "old certificate"}}))
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update output NDF: %+v", err)
+	}
+	for name, outputNdf := range map[string]interface {
+		Get() *ndf.NetworkDefinition
+		GetPb() *pb.NDF
+	}{"full": state.GetFullNdf(), "partial": state.GetPartialNdf()} {
+		if outputNdf.Get().Registration.TlsCertificate != newCert {
+			t.Errorf("The %s NDF does not publish the new certificate."+
+				"\n\texpected: %s\n\treceived: %s", name, newCert,
+				outputNdf.Get().Registration.TlsCertificate)
+		}
+		if err = signature.VerifyRsa(outputNdf.GetPb(), newKey.GetPublic()); err != nil {
+			t.Errorf("The %s NDF is not signed with the new key: %+v",
+				name, err)
+		}
+	}
+
+	// Once the grace period passes, only updates of the new key verify
+	time.Sleep(time.Until(activeFrom.Add(gracePeriod)))
+	if err = state.VerifyRsa(before); err == nil {
+		t.Errorf("Update signed with the old key verified after the grace " +
+			"period.")
+	}
+	if err = state.VerifyRsa(after); err != nil {
+		t.Errorf("Update signed with the new key does not verify: %+v", err)
+	}
+}
+
+// Tests that UpdateOutputNdf() outputs the NDF again once a new signing key
+// becomes active even if the internal NDF has not changed.
+func TestNetworkState_UpdateOutputNdf_SigningKeyRotated(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state.UpdateInternalNdf(withTestNode(&ndf.NetworkDefinition{}))
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update output NDF: %+v", err)
+	}
+	oldHash := state.GetFullNdf().GetHash()
+
+	newKey, newCert := newTestSigningKey(t)
+	err = state.AddSigningKey(newKey, newCert, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to add signing key: %+v", err)
+	}
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("Failed to update output NDF: %+v", err)
+	}
+
+	if state.GetFullNdf().Get().Registration.TlsCertificate != newCert {
+		t.Errorf("NDF was not output again after the signing key rotated.")
+	}
+	if string(state.GetFullNdf().GetHash()) == string(oldHash) {
+		t.Errorf("NDF hash did not change after the signing key rotated.")
+	}
+}
+
+// Error path: Tests that AddSigningKey() rejects a certificate of another key
+// and a key that does not become active after the last key added.
+func TestNetworkState_AddSigningKey_Invalid(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	key, cert := newTestSigningKey(t)
+	otherKey, _ := newTestSigningKey(t)
+	activeFrom := time.Now().Add(time.Hour)
+
+	err = state.AddSigningKey(otherKey, cert, activeFrom, 0)
+	if err == nil || !strings.Contains(err.Error(), "not of the signing key") {
+		t.Errorf("Unexpected error for a certificate of another key."+
+			"\n\texpected: %s\n\treceived: %+v", "not of the signing key", err)
+	}
+
+	err = state.AddSigningKey(key, cert, activeFrom, 0)
+	if err != nil {
+		t.Fatalf("Failed to add signing key: %+v", err)
+	}
+	err = state.AddSigningKey(key, cert, activeFrom, 0)
+	if err == nil || !strings.Contains(err.Error(), "must become active after") {
+		t.Errorf("Unexpected error for a key active before the last key."+
+			"\n\texpected: %s\n\treceived: %+v", "must become active after", err)
+	}
+}
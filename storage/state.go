@@ -10,6 +10,7 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"github.com/jinzhu/gorm"
@@ -26,8 +27,10 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
 	"gitlab.com/xx_network/primitives/region"
-	"gitlab.com/xx_network/primitives/utils"
 	"google.golang.org/protobuf/proto"
+	"io"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -37,18 +40,46 @@ import (
 
 const updateBufferLength = 10000
 
+// GatewayUnreachable is the NDF status of a Node that is online but whose
+// gateway cannot be reached, so that clients can tell it apart from a Stale
+// Node. The ndf package does not define this status, so it takes a value past
+// the ndf.NumTypes sentinel.
+const GatewayUnreachable = ndf.NumTypes + 1
+
+// defaultRoundUpdateGapTimeout is the default amount of time the
+// RoundAdderRoutine waits for a missing update ID before skipping it.
+const defaultRoundUpdateGapTimeout = time.Minute
+
+// defaultMaxFutureRoundUpdates is the default number of round updates the
+// RoundAdderRoutine holds behind missing update IDs before skipping them.
+const defaultMaxFutureRoundUpdates = 10000
+
+// flushRoundUpdatesInterval is how often FlushRoundUpdates checks whether the
+// pending round updates have been added.
+const flushRoundUpdatesInterval = 10 * time.Millisecond
+
 // NetworkState structure used for keeping track of NDF and Round state.
 type NetworkState struct {
+	// Name of the network tracked by this state; empty for the default network
+	network string
+
 	// NetworkState parameters
 	rsaPrivateKey      *rsa.PrivateKey
 	ellipticPrivateKey *ec.PrivateKey
 
+	// RSA keys signing is rotated to after rsaPrivateKey and the elliptic
+	// curve public key signed with the active key
+	signingKeys signingKeys
+
 	// Round state
 	rounds       *round.StateMap
 	roundUpdates *dataStructures.Updates
 	roundData    *dataStructures.Data
 	update       chan node.UpdateNotification // For triggering updates to top level
 
+	// Update notifications dropped because the update channel was full
+	droppedUpdates droppedUpdateLog
+
 	// Node NetworkState
 	nodes     *node.StateMap
 	updateMux sync.Mutex
@@ -65,33 +96,88 @@ type NetworkState struct {
 	pruneListMux    sync.RWMutex
 	// Boolean determines whether Node is omitted from NDF
 	pruneList map[id.ID]bool
+	// Nodes whose gateway cannot be reached, guarded by pruneListMux
+	unreachableGateways map[id.ID]struct{}
 
 	outputNdfLock sync.RWMutex
 	partialNdf    *dataStructures.Ndf
 	fullNdf       *dataStructures.Ndf
 
-	// Address space size
+	// EdDSA signed copies of the output NDFs for lightweight clients
+	partialEccNdf *EccSignedNdf
+	fullEccNdf    *EccSignedNdf
+
+	// Recently output partial NDFs used to compute diffs for pollers
+	partialNdfHistory ndfHistory
+
+	// Coalesces output NDF updates queued within a short window
+	ndfDebounce ndfUpdateDebouncer
+
+	// Source of NDF timestamps and the clock skew tolerated between them
+	ndfClock ndfClock
+
+	// How long the last output NDF update took
+	ndfTimer ndfTimer
+
+	// Whether new rounds are held back while rounds in progress complete
+	drain drainState
+
+	// Lease that must be held to schedule rounds when several permissioning
+	// servers share the database
+	lease schedulerLease
+
+	// Address space size used until the first scheduled size takes effect
 	addressSpaceSize *uint32
 
-	// Output path to the full ndf
-	fullNdfOutputPath string
+	// Scheduled address space sizes, ordered by the time they take effect
+	addressSpaceSchedule    []ndf.AddressSpace
+	addressSpaceScheduleMux sync.RWMutex
+
+	// Output the full ndf is written to and the format it is written in
+	fullNdfOutput NdfOutput
+	fullNdfFormat NdfFormat
 
-	// Output path to the signed partial ndf provided to client
-	// by uploading the file
-	signedPartialNdfOutputPath string
+	// Output the signed partial ndf provided to client is written
+	// to by uploading the file
+	signedPartialNdfOutput NdfOutput
+
+	// Workers signing round updates before they are sent to the round adder
+	signers roundUpdateSigners
 
 	// round adder buffer channel
 	roundUpdatesToAddCh chan *dataStructures.Round
 
+	// Number of round updates added that the round adder has not yet added
+	// or dropped
+	pendingRoundUpdates *int64
+
+	// How long the round adder waits on a missing update ID before skipping
+	// it, the number of updates it holds before skipping missing update IDs
+	// early, and the number of update IDs skipped so far
+	roundUpdateGapTimeout *int64
+	maxFutureRoundUpdates *int64
+	skippedRoundUpdates   *uint64
+
 	// round states
 	roundID  id.Round
 	updateID uint64
 }
 
-// NewState returns a new NetworkState object.
+// NewState returns a new NetworkState object for the default network.
 func NewState(rsaPrivKey *rsa.PrivateKey, addressSpaceSize uint32,
 	fullNdfOutputPath string, signedPartialNdfOutputPath string,
 	geoBins map[string]region.GeoBin) (*NetworkState, error) {
+	return NewNetworkState("", rsaPrivKey, addressSpaceSize,
+		fullNdfOutputPath, signedPartialNdfOutputPath, geoBins)
+}
+
+// NewNetworkState returns a new NetworkState object for the named network.
+// The round ID, update ID, and elliptic key of each network are stored
+// separately; the default network, with an empty name, uses the original keys.
+func NewNetworkState(network string, rsaPrivKey *rsa.PrivateKey,
+	addressSpaceSize uint32, fullNdfOutputPath string,
+	signedPartialNdfOutputPath string,
+	geoBins map[string]region.GeoBin) (*NetworkState, error) {
 
 	fullNdf, err := dataStructures.NewNdf(&ndf.NetworkDefinition{})
 	if err != nil {
@@ -102,26 +188,48 @@ func NewState(rsaPrivKey *rsa.PrivateKey, addressSpaceSize uint32,
 		return nil, err
 	}
 
+	gapTimeout := int64(defaultRoundUpdateGapTimeout)
+	maxFutureRoundUpdates := int64(defaultMaxFutureRoundUpdates)
 	state := &NetworkState{
-		rounds:                     round.NewStateMap(),
-		roundUpdates:               dataStructures.NewUpdates(),
-		update:                     make(chan node.UpdateNotification, updateBufferLength),
-		nodes:                      node.NewStateMap(),
-		fullNdf:                    fullNdf,
-		partialNdf:                 partialNdf,
-		rsaPrivateKey:              rsaPrivKey,
-		addressSpaceSize:           &addressSpaceSize,
-		unprunedNdf:                &ndf.NetworkDefinition{},
-		pruneList:                  make(map[id.ID]bool),
-		fullNdfOutputPath:          fullNdfOutputPath,
-		signedPartialNdfOutputPath: signedPartialNdfOutputPath,
-		roundUpdatesToAddCh:        make(chan *dataStructures.Round, 500),
-		geoBins:                    geoBins,
+		network:                network,
+		rounds:                 round.NewStateMap(),
+		roundUpdates:           dataStructures.NewUpdates(),
+		update:                 make(chan node.UpdateNotification, updateBufferLength),
+		nodes:                  node.NewStateMap(),
+		fullNdf:                fullNdf,
+		partialNdf:             partialNdf,
+		rsaPrivateKey:          rsaPrivKey,
+		addressSpaceSize:       &addressSpaceSize,
+		unprunedNdf:            &ndf.NetworkDefinition{},
+		pruneList:              make(map[id.ID]bool),
+		unreachableGateways:    make(map[id.ID]struct{}),
+		fullNdfOutput:          fileOutput(fullNdfOutputPath),
+		fullNdfFormat:          ndfFormatFor(fullNdfOutputPath),
+		signedPartialNdfOutput: fileOutput(signedPartialNdfOutputPath),
+		roundUpdatesToAddCh:    make(chan *dataStructures.Round, 500),
+		geoBins:                geoBins,
+		roundUpdateGapTimeout:  &gapTimeout,
+		maxFutureRoundUpdates:  &maxFutureRoundUpdates,
+		skippedRoundUpdates:    new(uint64),
+		pendingRoundUpdates:    new(int64),
 	}
+	state.ndfDebounce.window = defaultNdfUpdateDebounceWindow
+	state.drain.changed = make(chan struct{}, 1)
+	state.lease.holder = SchedulerLeaseHolder("")
+	state.lease.changed = make(chan struct{}, 1)
+	state.signers.jobs = make(chan roundUpdateSigningJob,
+		roundUpdateSigningQueueLength)
+	state.signers.stop = make(chan struct{})
 
 	//begin the thread that reads and adds round updates
 	go state.RoundAdderRoutine()
 
+	// Start the workers that sign round updates
+	err = state.SetRoundUpdateSigners(defaultRoundUpdateSigners)
+	if err != nil {
+		return nil, err
+	}
+
 	// Obtain round & update Id from Storage
 	// Ignore not found in Storage errors, zero-value will be handled below
 	state.updateID, err = state.GetUpdateID()
@@ -163,6 +271,11 @@ func NewState(rsaPrivKey *rsa.PrivateKey, addressSpaceSize uint32,
 		}
 	}
 
+	// Sign the elliptic curve public key so that it can be served to clients
+	if state.GetSignedEllipticPublicKey() == nil {
+		return nil, errors.New("Failed to sign elliptic public key")
+	}
+
 	// Updates are handled in the uint space, as a result, the designator for
 	// update 0 also designates that no updates are known by the server. To
 	// avoid this collision, permissioning will skip this update as well.
@@ -217,6 +330,24 @@ func (s *NetworkState) setPrunedNodesNoReset(ids []*id.ID) {
 	}
 }
 
+// Updates the disabled Nodes in the prune list, used by disabledNodes polling
+// the database. Nodes that are no longer disabled are removed from the prune
+// list unless they are pruned from the NDF.
+func (s *NetworkState) setDisabledNodes(disabled, enabled []*id.ID) {
+	s.pruneListMux.Lock()
+	defer s.pruneListMux.Unlock()
+
+	for _, i := range enabled {
+		if isPruned, exists := s.pruneList[*i]; exists && !isPruned {
+			delete(s.pruneList, *i)
+		}
+	}
+	for _, i := range disabled {
+		// Disabled nodes will remain in NDF
+		s.pruneList[*i] = false
+	}
+}
+
 // Sets pruned Nodes, including disabled Nodes
 // Used by node metrics tracker
 func (s *NetworkState) SetPrunedNodes(prunedNodes map[id.ID]bool) {
@@ -243,6 +374,32 @@ func (s *NetworkState) SetPrunedNode(id *id.ID) {
 	s.pruneList[*id] = true
 }
 
+// PruneNodes sets the Nodes as pruned (to be removed from NDF), except for
+// disabled Nodes, which remain in the NDF. Returns the number of Nodes that
+// were not already pruned.
+func (s *NetworkState) PruneNodes(ids []*id.ID) int {
+	disabled := make(map[id.ID]struct{})
+	if s.disabledNodesStates != nil {
+		for _, nid := range s.disabledNodesStates.getDisabledNodes() {
+			disabled[*nid] = struct{}{}
+		}
+	}
+
+	s.pruneListMux.Lock()
+	defer s.pruneListMux.Unlock()
+
+	var pruned int
+	for _, nid := range ids {
+		if _, isDisabled := disabled[*nid]; isDisabled || s.pruneList[*nid] {
+			continue
+		}
+		s.pruneList[*nid] = true
+		pruned++
+	}
+
+	return pruned
+}
+
 func (s *NetworkState) IsPruned(node *id.ID) bool {
 	s.pruneListMux.RLock()
 	defer s.pruneListMux.RUnlock()
@@ -251,6 +408,62 @@ func (s *NetworkState) IsPruned(node *id.ID) bool {
 	return exists
 }
 
+// GetPruneListSnapshot returns a copy of the prune list. A value of true
+// denotes a Node pruned from the NDF, while false denotes a stale Node that
+// remains in the NDF. The copy is safe to modify.
+func (s *NetworkState) GetPruneListSnapshot() map[id.ID]bool {
+	s.pruneListMux.RLock()
+	defer s.pruneListMux.RUnlock()
+
+	snapshot := make(map[id.ID]bool, len(s.pruneList))
+	for nid, isPruned := range s.pruneList {
+		snapshot[nid] = isPruned
+	}
+
+	return snapshot
+}
+
+// CountPrunedNodes returns the number of Nodes in the prune list that are
+// pruned from the NDF and the number that are only marked as stale.
+func (s *NetworkState) CountPrunedNodes() (pruned, stale int) {
+	s.pruneListMux.RLock()
+	defer s.pruneListMux.RUnlock()
+
+	for _, isPruned := range s.pruneList {
+		if isPruned {
+			pruned++
+		} else {
+			stale++
+		}
+	}
+
+	return pruned, stale
+}
+
+// SetGatewayReachable records whether the Node's gateway can be reached. An
+// online Node whose gateway cannot be reached is output in the NDF with the
+// GatewayUnreachable status and its gateway address blanked.
+func (s *NetworkState) SetGatewayReachable(nid *id.ID, reachable bool) {
+	s.pruneListMux.Lock()
+	defer s.pruneListMux.Unlock()
+
+	if reachable {
+		delete(s.unreachableGateways, *nid)
+	} else {
+		s.unreachableGateways[*nid] = struct{}{}
+	}
+}
+
+// IsGatewayReachable returns false if the Node's gateway has been marked as
+// unreachable.
+func (s *NetworkState) IsGatewayReachable(nid *id.ID) bool {
+	s.pruneListMux.RLock()
+	defer s.pruneListMux.RUnlock()
+
+	_, unreachable := s.unreachableGateways[*nid]
+	return !unreachable
+}
+
 func (s *NetworkState) GetUnprunedNdf() *ndf.NetworkDefinition {
 	return s.unprunedNdf
 }
@@ -269,6 +482,22 @@ func (s *NetworkState) GetPartialNdf() *dataStructures.Ndf {
 	return s.partialNdf
 }
 
+// GetFullEccNdf returns the EdDSA signed full NDF. Returns nil if no NDF has
+// been output yet.
+func (s *NetworkState) GetFullEccNdf() *EccSignedNdf {
+	s.outputNdfLock.RLock()
+	defer s.outputNdfLock.RUnlock()
+	return s.fullEccNdf
+}
+
+// GetPartialEccNdf returns the EdDSA signed partial NDF. Returns nil if no NDF
+// has been output yet.
+func (s *NetworkState) GetPartialEccNdf() *EccSignedNdf {
+	s.outputNdfLock.RLock()
+	defer s.outputNdfLock.RUnlock()
+	return s.partialEccNdf
+}
+
 // GetGeoBin returns the GeoBin map.
 func (s *NetworkState) GetGeoBins() map[string]region.GeoBin {
 	return s.geoBins
@@ -279,8 +508,29 @@ func (s *NetworkState) GetUpdates(id int) ([]*pb.RoundInfo, error) {
 	return s.roundUpdates.GetUpdates(id), nil
 }
 
-// AddRoundUpdate creates a copy of the round before inserting it into
-// roundUpdates.
+// GetRoundUpdateHistory returns every update of the round still held in the
+// round update buffer, in the order they were added, so that the lifecycle of
+// the round can be reconstructed. The buffer is scanned as it is not indexed by
+// round. Returns an error if no update of the round is held, such as when the
+// round is unknown or its updates have been overwritten by newer ones.
+func (s *NetworkState) GetRoundUpdateHistory(roundId id.Round) (
+	[]*pb.RoundInfo, error) {
+	var history []*pb.RoundInfo
+	for _, update := range s.roundUpdates.GetUpdates(0) {
+		if id.Round(update.ID) == roundId {
+			history = append(history, update)
+		}
+	}
+
+	if len(history) == 0 {
+		return nil, errors.Errorf("No updates of round %d are held", roundId)
+	}
+
+	return history, nil
+}
+
+// AddRoundUpdate creates a copy of the round and queues it to be signed and
+// inserted into roundUpdates. Blocks while the signing queue is full.
 func (s *NetworkState) AddRoundUpdate(r *pb.RoundInfo) error {
 	s.updateMux.Lock()
 	defer s.updateMux.Unlock()
@@ -293,113 +543,333 @@ func (s *NetworkState) AddRoundUpdate(r *pb.RoundInfo) error {
 
 	roundCopy.UpdateID = updateID
 
-	go func() {
-		err = signature.SignRsa(roundCopy, s.rsaPrivateKey)
-		if err != nil {
-			jww.FATAL.Panicf("Could not add round update %v "+
-				"for round %v due to failed signature: %+v",
-				roundCopy.UpdateID, roundCopy.ID, err)
-		}
-
-		err = signature.SignEddsa(roundCopy, s.GetEllipticPrivateKey())
-		if err != nil {
-			jww.FATAL.Panicf("Could not add round update %v "+
-				"for round %v due to failed elliptic curve "+
-				"signature: %+v", roundCopy.UpdateID,
-				roundCopy.ID, err)
-		}
-
-		jww.TRACE.Printf("Round Info: %+v", roundCopy)
-
-		jww.INFO.Printf("Round %v state updated to %s", r.ID,
-			states.Round(roundCopy.State))
-
-		rnd := dataStructures.NewVerifiedRound(roundCopy,
-			s.rsaPrivateKey.GetPublic())
-		s.roundUpdatesToAddCh <- rnd
-	}()
+	atomic.AddInt64(s.pendingRoundUpdates, 1)
+	s.signers.jobs <- roundUpdateSigningJob{
+		roundInfo:  roundCopy,
+		signingKey: s.GetPrivateKey(),
+	}
 	return nil
 }
 
 // RoundAdderRoutine monitors a channel and keeps track of pending round updates,
-// adding them in order
+// adding them in order. If an update ID is missing for longer than the round
+// update gap timeout while later updates are pending, the missing IDs are
+// skipped so that processing can resume. If more updates are pending than the
+// maximum, missing IDs are skipped immediately, earliest first, until the
+// pending updates are within the maximum. Skipped updates received late are
+// dropped so that no update is added after the updates that followed it.
 func (s *NetworkState) RoundAdderRoutine() {
 	futureRoundUpdates := make(map[uint64]*dataStructures.Round)
 	nextID := uint64(0)
+
+	// Fires when the update at gapID has been missing for too long
+	var gapTimeout <-chan time.Time
+	var gapID uint64
+
+	// The update ID following the last skipped gap; updates received below it
+	// are dropped
+	skippedTo := uint64(0)
+
 	for {
+		select {
 		// Add the next round update from the channel
-		rnd := <-s.roundUpdatesToAddCh
-		rndUpdateId := rnd.Get().UpdateID
-
-		// Print the size of the future updates map so that potential memory leaks
-		// as a result of the structure of this function can be noticed.
-		if nextID%100 == 0 {
-			jww.DEBUG.Printf("RoundAdderRoutine has %d future updates queued",
-				len(futureRoundUpdates))
+		case rnd := <-s.roundUpdatesToAddCh:
+			rndUpdateId := rnd.Get().UpdateID
+
+			// Print the size of the future updates map so that potential memory leaks
+			// as a result of the structure of this function can be noticed.
+			if nextID%100 == 0 {
+				jww.DEBUG.Printf("RoundAdderRoutine has %d future updates queued",
+					len(futureRoundUpdates))
+			}
+
+			// Drop skipped updates, as the updates after them have been added
+			if rndUpdateId < skippedTo {
+				jww.ERROR.Printf("RoundAdderRoutine received round update %d "+
+					"after skipping it, dropping it", rndUpdateId)
+				atomic.AddInt64(s.pendingRoundUpdates, -1)
+				continue
+			}
+
+			// If update is not current, process it immediately
+			if rndUpdateId < nextID {
+				err := s.roundUpdates.AddRound(rnd)
+				if err != nil {
+					jww.FATAL.Panicf("%+v", err)
+				}
+				atomic.AddInt64(s.pendingRoundUpdates, -1)
+				continue
+			}
+
+			// if the next ID has not been set, then set it to the new ID
+			if nextID == 0 {
+				nextID = rndUpdateId
+			}
+
+			// Update comes from the future, add it for future processing
+			futureRoundUpdates[rndUpdateId] = rnd
+
+		// Skip the missing updates up to the earliest pending update
+		case <-gapTimeout:
+			skipTo := s.skipRoundUpdateGap(futureRoundUpdates, nextID)
+			jww.WARN.Printf("RoundAdderRoutine did not receive round updates "+
+				"%d to %d within %s, skipping them", nextID, skipTo-1,
+				s.GetRoundUpdateGapTimeout())
+			nextID, skippedTo = skipTo, skipTo
+			gapTimeout = nil
 		}
 
-		// If update is not current, process it immediately
-		if rndUpdateId < nextID {
-			err := s.roundUpdates.AddRound(rnd)
-			if err != nil {
-				jww.FATAL.Panicf("%+v", err)
+		// Sequentially process updates added earlier until a gap is reached
+		nextID = s.addFutureRoundUpdates(futureRoundUpdates, nextID)
+
+		// If too many updates are pending, skip the earliest gaps without
+		// waiting until the pending updates are within the maximum
+		maxPending := s.GetMaxFutureRoundUpdates()
+		if maxPending > 0 && len(futureRoundUpdates) > maxPending {
+			jww.ERROR.Printf("RoundAdderRoutine has %d future updates queued, "+
+				"exceeding the maximum of %d, skipping missing updates",
+				len(futureRoundUpdates), maxPending)
+			for len(futureRoundUpdates) > maxPending {
+				skipTo := s.skipRoundUpdateGap(futureRoundUpdates, nextID)
+				jww.ERROR.Printf("RoundAdderRoutine skipped round updates %d "+
+					"to %d", nextID, skipTo-1)
+				skippedTo = skipTo
+				nextID = s.addFutureRoundUpdates(futureRoundUpdates, skipTo)
 			}
-			continue
 		}
 
-		// if the next ID has not been set, then set it to the new ID
-		if nextID == 0 {
-			nextID = rndUpdateId
+		// Wait on the gap if updates are pending behind a missing update,
+		// restarting the wait whenever a new gap is reached
+		if len(futureRoundUpdates) == 0 {
+			gapTimeout = nil
+		} else if gapTimeout == nil || gapID != nextID {
+			gapTimeout = time.After(s.GetRoundUpdateGapTimeout())
+			gapID = nextID
 		}
+	}
+}
 
-		// Update comes from the future, add it for future processing
-		futureRoundUpdates[rndUpdateId] = rnd
+// skipRoundUpdateGap counts the missing update IDs from nextID up to the
+// earliest pending update as skipped and returns the earliest pending update
+// ID. Must only be called when updates are pending.
+func (s *NetworkState) skipRoundUpdateGap(
+	futureRoundUpdates map[uint64]*dataStructures.Round, nextID uint64) uint64 {
+	skipTo := uint64(math.MaxUint64)
+	for updateID := range futureRoundUpdates {
+		if updateID < skipTo {
+			skipTo = updateID
+		}
+	}
+	atomic.AddUint64(s.skippedRoundUpdates, skipTo-nextID)
+	return skipTo
+}
 
-		// Sequentially process updates added earlier until a gap is reached
-		for r, ok := futureRoundUpdates[nextID]; ok; r, ok = futureRoundUpdates[nextID] {
-			err := s.roundUpdates.AddRound(r)
-			if err != nil {
-				jww.FATAL.Panicf("%+v", err)
+// addFutureRoundUpdates adds the pending updates starting at nextID in order
+// until a missing update ID is reached, removing them from the pending
+// updates. Returns the missing update ID.
+func (s *NetworkState) addFutureRoundUpdates(
+	futureRoundUpdates map[uint64]*dataStructures.Round, nextID uint64) uint64 {
+	for r, ok := futureRoundUpdates[nextID]; ok; r, ok = futureRoundUpdates[nextID] {
+		err := s.roundUpdates.AddRound(r)
+		if err != nil {
+			jww.FATAL.Panicf("%+v", err)
+		}
+		atomic.AddInt64(s.pendingRoundUpdates, -1)
+		// Clean up processed round
+		delete(futureRoundUpdates, nextID)
+		nextID++
+	}
+	return nextID
+}
+
+// FlushRoundUpdates waits until every round update added with AddRoundUpdate
+// has been signed and added to the round updates, or dropped by the
+// RoundAdderRoutine. Returns an error if updates are still pending once the
+// timeout is reached.
+func (s *NetworkState) FlushRoundUpdates(timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for atomic.LoadInt64(s.pendingRoundUpdates) > 0 {
+		select {
+		case <-deadline:
+			return errors.Errorf("%d round updates are still pending after %s",
+				atomic.LoadInt64(s.pendingRoundUpdates), timeout)
+		case <-time.After(flushRoundUpdatesInterval):
+		}
+	}
+	return nil
+}
+
+// GetRoundUpdateGapTimeout returns how long the RoundAdderRoutine waits for a
+// missing update ID before skipping it.
+func (s *NetworkState) GetRoundUpdateGapTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(s.roundUpdateGapTimeout))
+}
+
+// SetNdfOutputs sets the outputs the full and signed partial NDFs are written
+// to, replacing the files given to NewState. Must be called before the NDF is
+// first updated.
+func (s *NetworkState) SetNdfOutputs(full, signedPartial NdfOutput) {
+	s.fullNdfOutput = full
+	s.signedPartialNdfOutput = signedPartial
+}
+
+// CloseNdfOutputs closes the outputs the NDFs are written to that write in the
+// background, making a final attempt to write any NDF they have not written
+// yet. Returns the first error closing an output.
+func (s *NetworkState) CloseNdfOutputs() error {
+	for _, output := range []NdfOutput{s.fullNdfOutput,
+		s.signedPartialNdfOutput} {
+		if closer, ok := output.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return err
 			}
-			// Clean up processed round
-			delete(futureRoundUpdates, nextID)
-			nextID++
 		}
 	}
+	return nil
+}
+
+// SetFullNdfFormat sets the format the full NDF is written in, replacing the
+// format selected by the extension of the file given to NewState. Must be
+// called before the NDF is first updated.
+func (s *NetworkState) SetFullNdfFormat(format NdfFormat) {
+	s.fullNdfFormat = format
+}
+
+// SetRoundUpdateGapTimeout sets how long the RoundAdderRoutine waits for a
+// missing update ID before skipping it. Takes effect on the next gap.
+func (s *NetworkState) SetRoundUpdateGapTimeout(timeout time.Duration) {
+	atomic.StoreInt64(s.roundUpdateGapTimeout, int64(timeout))
+}
+
+// GetMaxFutureRoundUpdates returns the number of updates the RoundAdderRoutine
+// holds behind missing update IDs before skipping them without waiting.
+func (s *NetworkState) GetMaxFutureRoundUpdates() int {
+	return int(atomic.LoadInt64(s.maxFutureRoundUpdates))
+}
+
+// SetMaxFutureRoundUpdates sets the number of updates the RoundAdderRoutine
+// holds behind missing update IDs before skipping them without waiting. A
+// maximum of zero or less leaves the pending updates unbounded.
+func (s *NetworkState) SetMaxFutureRoundUpdates(max int) {
+	atomic.StoreInt64(s.maxFutureRoundUpdates, int64(max))
+}
+
+// GetNumSkippedRoundUpdates returns the number of update IDs the
+// RoundAdderRoutine has skipped because they were never received.
+func (s *NetworkState) GetNumSkippedRoundUpdates() uint64 {
+	return atomic.LoadUint64(s.skippedRoundUpdates)
 }
 
 // UpdateInternalNdf updates the unpruned internal NDF to the passed in NDF.
 // This will be used for the output NDF next time it is updated.  Note that
 // callers of this function should take s.InternalNdfLock as appropriate.
 func (s *NetworkState) UpdateInternalNdf(newNdf *ndf.NetworkDefinition) {
-	newNdf.Timestamp = time.Now()
+	newNdf.Timestamp = s.ndfNow()
 	s.unprunedNdf = newNdf.DeepCopy()
 }
 
-// UpdateOutputNdf takes the current unprunedNdf and signs and outputs
-// it to the full & partial ndf fields, along with writing it to disk.
-func (s *NetworkState) UpdateOutputNdf() (err error) {
-	s.outputNdfLock.Lock()
-	defer s.outputNdfLock.Unlock()
+// ReplaceInternalNdf atomically replaces the unpruned internal NDF with the
+// passed in NDF and regenerates the output NDF once, replacing any update
+// waiting in the debounce window. Used for coordinated topology changes where
+// many parts of the NDF change at once. Returns an error and keeps the current
+// NDF if the new NDF is invalid. Callers must not hold s.InternalNdfLock.
+func (s *NetworkState) ReplaceInternalNdf(newNdf *ndf.NetworkDefinition) error {
+	if newNdf == nil {
+		return errors.New("Cannot replace the internal NDF with a nil NDF")
+	} else if err := validateNdf(newNdf); err != nil {
+		return errors.WithMessage(err, "Cannot replace the internal NDF")
+	}
+
+	s.InternalNdfLock.Lock()
+	s.UpdateInternalNdf(newNdf)
+	s.InternalNdfLock.Unlock()
 
+	s.ndfDebounce.mux.Lock()
+	s.ndfDebounce.dirty = true
+	s.ndfDebounce.mux.Unlock()
+
+	return s.FlushOutputNdf()
+}
+
+// PreviewOutputNdf returns the NDF that UpdateOutputNdf would output from the
+// current unprunedNdf, with the same pruning and Node statuses applied. The NDF
+// is neither signed, stored, nor written to disk, so it can be used to inspect
+// the effect of a change before it is output.
+func (s *NetworkState) PreviewOutputNdf() (*ndf.NetworkDefinition, error) {
 	s.InternalNdfLock.RLock()
-	loadedNdf := s.unprunedNdf.DeepCopy()
+	if s.unprunedNdf == nil {
+		s.InternalNdfLock.RUnlock()
+		return nil, errors.New("No unpruned NDF stored to preview")
+	}
+	previewNdf := s.unprunedNdf.DeepCopy()
 	s.InternalNdfLock.RUnlock()
-	// Sanity checks on loaded ndf data
-	if loadedNdf == nil {
-		jww.WARN.Printf("No unpruned NDF stored to output, skipping update")
-		return nil
-	} else if s.fullNdf != nil && s.fullNdf.Get() != nil &&
-		!loadedNdf.Timestamp.After(s.fullNdf.Get().Timestamp) {
-		jww.WARN.Printf("Skipping update: Loaded unpruned NDF timestamp"+
-			" %s is not later than current output NDF timestamp %s",
-			loadedNdf.Timestamp.String(), s.fullNdf.Get().Timestamp.String())
-		return nil
+
+	s.pruneNdf(previewNdf)
+	previewNdf.Registration.EllipticPubKey =
+		s.GetEllipticPublicKey().MarshalText()
+	if _, certificate := s.getSigningKey(); certificate != "" {
+		previewNdf.Registration.TlsCertificate = certificate
 	}
 
-	newNdf := loadedNdf.DeepCopy()
+	return previewNdf, nil
+}
 
+// validateNdf checks that the NDF can be output. It must have at least one
+// Node, a Gateway for every Node, as pruning removes them by index, and a
+// valid ID for every Node.
+func validateNdf(def *ndf.NetworkDefinition) error {
+	if len(def.Nodes) == 0 {
+		return errors.New("NDF has no Nodes")
+	} else if len(def.Nodes) != len(def.Gateways) {
+		return errors.Errorf("NDF has %d Nodes but %d Gateways",
+			len(def.Nodes), len(def.Gateways))
+	}
+
+	for i, n := range def.Nodes {
+		if len(n.ID) == 0 {
+			return errors.Errorf("Node %d of the NDF has no ID", i)
+		} else if _, err := id.Unmarshal(n.ID); err != nil {
+			return errors.Errorf("Node %d of the NDF has an invalid ID: %+v",
+				i, err)
+		}
+	}
+
+	return nil
+}
+
+// sortNdfNodes orders the Nodes of the NDF by ID, moving each Gateway with its
+// Node, so that the same set of Nodes always produces the same NDF regardless
+// of the order they were added in. The NDF must have a Gateway for each Node.
+func sortNdfNodes(def *ndf.NetworkDefinition) {
+	order := make([]int, len(def.Nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(def.Nodes[order[i]].ID, def.Nodes[order[j]].ID) < 0
+	})
+
+	nodes := make([]ndf.Node, len(def.Nodes))
+	gateways := make([]ndf.Gateway, len(def.Gateways))
+	for i, j := range order {
+		nodes[i] = def.Nodes[j]
+		gateways[i] = def.Gateways[j]
+	}
+	def.Nodes = nodes
+	def.Gateways = gateways
+}
+
+// pruneNdf removes pruned Nodes and their Gateways from the NDF and sets the
+// status of the remaining Nodes. Stale Nodes and Nodes marked Stale in the
+// internal NDF because they have no address are marked Stale, Nodes whose
+// gateway cannot be reached are marked GatewayUnreachable with their gateway
+// address blanked, and all others are marked Active. The gateway entry is kept
+// rather than omitted because clients pair each Gateway with the Node at the
+// same index.
+func (s *NetworkState) pruneNdf(newNdf *ndf.NetworkDefinition) {
 	s.pruneListMux.RLock()
+	defer s.pruneListMux.RUnlock()
+
 	//prune the NDF
 	for i := 0; i < len(newNdf.Nodes); i++ {
 		nid, _ := id.Unmarshal(newNdf.Nodes[i].ID)
@@ -413,14 +883,78 @@ func (s *NetworkState) UpdateOutputNdf() (err error) {
 			} else {
 				newNdf.Nodes[i].Status = ndf.Stale
 			}
+		} else if newNdf.Nodes[i].Status == ndf.Stale &&
+			newNdf.Nodes[i].Address == "" {
+			// Nodes restored without an address remain Stale until they
+			// report one
+		} else if _, unreachable := s.unreachableGateways[*nid]; unreachable {
+			newNdf.Nodes[i].Status = GatewayUnreachable
+			if i < len(newNdf.Gateways) {
+				newNdf.Gateways[i].Address = ""
+			}
 		} else {
 			newNdf.Nodes[i].Status = ndf.Active
 		}
 
 	}
-	s.pruneListMux.RUnlock()
+}
+
+// UpdateOutputNdf takes the current unprunedNdf and signs and outputs
+// it to the full & partial ndf fields, along with writing it to disk.
+// Nodes are ordered by ID so that an unchanged set of Nodes always produces
+// the same NDF and hash.
+func (s *NetworkState) UpdateOutputNdf() (err error) {
+	s.outputNdfLock.Lock()
+	defer s.outputNdfLock.Unlock()
+
+	s.InternalNdfLock.RLock()
+	loadedNdf := s.unprunedNdf.DeepCopy()
+	s.InternalNdfLock.RUnlock()
+
+	// The NDF is signed with the active signing key; if it has been rotated,
+	// its certificate is published so that clients verify against it
+	signingKey, certificate := s.getSigningKey()
+
+	// Sanity checks on loaded ndf data
+	if loadedNdf == nil {
+		jww.WARN.Printf("No unpruned NDF stored to output, skipping update")
+		return nil
+	} else if s.fullNdf != nil && s.fullNdf.Get() != nil &&
+		s.isStaleNdf(loadedNdf.Timestamp, s.fullNdf.Get().Timestamp) {
+		if certificate == "" ||
+			certificate == s.fullNdf.Get().Registration.TlsCertificate {
+			jww.WARN.Printf("Skipping update: Loaded unpruned NDF timestamp"+
+				" %s is not later than current output NDF timestamp %s",
+				loadedNdf.Timestamp.String(), s.fullNdf.Get().Timestamp.String())
+			return nil
+		}
+
+		// The signing key was rotated since the NDF was last output
+		loadedNdf.Timestamp = s.ndfNow()
+	}
+
+	// Never publish a broken NDF; the last valid NDF remains the output
+	if err = validateNdf(loadedNdf); err != nil {
+		jww.ERROR.Printf("Skipping update: Loaded unpruned NDF of network "+
+			"%q is invalid and will not be output: %+v", s.network, err)
+		return nil
+	}
+
+	timing := NdfGenerationTiming{Start: time.Now()}
+	newNdf := loadedNdf.DeepCopy()
+	sortNdfNodes(newNdf)
+	s.pruneNdf(newNdf)
+	timing.Prune = time.Since(timing.Start)
+
+	// Always publish this network's EdDSA public key so that clients can
+	// verify EdDSA signatures using only the NDF
+	newNdf.Registration.EllipticPubKey = s.GetEllipticPublicKey().MarshalText()
+	if certificate != "" {
+		newNdf.Registration.TlsCertificate = certificate
+	}
 
 	// Build NDF comms messages
+	phaseStart := time.Now()
 	fullNdfMsg := &pb.NDF{}
 	fullNdfMsg.Ndf, err = newNdf.Marshal()
 	if err != nil {
@@ -432,17 +966,35 @@ func (s *NetworkState) UpdateOutputNdf() (err error) {
 		return
 	}
 
+	timing.Marshal = time.Since(phaseStart)
+
 	// Sign NDF comms messages
-	err = signature.SignRsa(fullNdfMsg, s.rsaPrivateKey)
+	phaseStart = time.Now()
+	err = signature.SignRsa(fullNdfMsg, signingKey)
 	if err != nil {
 		return
 	}
-	err = signature.SignRsa(partialNdfMsg, s.rsaPrivateKey)
+	err = signature.SignRsa(partialNdfMsg, signingKey)
 	if err != nil {
 		return
 	}
 
+	// Additionally sign the NDFs with the elliptic curve key
+	fullEccNdfMsg := &EccSignedNdf{Ndf: fullNdfMsg.Ndf}
+	err = signature.SignEddsa(fullEccNdfMsg, s.ellipticPrivateKey)
+	if err != nil {
+		return
+	}
+	partialEccNdfMsg := &EccSignedNdf{Ndf: partialNdfMsg.Ndf}
+	err = signature.SignEddsa(partialEccNdfMsg, s.ellipticPrivateKey)
+	if err != nil {
+		return
+	}
+
+	timing.Sign = time.Since(phaseStart)
+
 	// Assign NDF comms messages
+	phaseStart = time.Now()
 	err = s.fullNdf.Update(fullNdfMsg)
 	if err != nil {
 		return err
@@ -452,11 +1004,15 @@ func (s *NetworkState) UpdateOutputNdf() (err error) {
 	if err != nil {
 		return err
 	}
+	s.partialNdfHistory.add(s.partialNdf.GetHash(), s.partialNdf.Get())
+
+	s.fullEccNdf = fullEccNdfMsg
+	s.partialEccNdf = partialEccNdfMsg
 
-	// Output full NDF to file
-	err = outputToJSON(newNdf, s.fullNdfOutputPath)
+	// Output full NDF
+	err = outputNdf(fullNdfMsg, s.fullNdfFormat, s.fullNdfOutput)
 	if err != nil {
-		jww.ERROR.Printf("unable to output full NDF JSON file: %+v", err)
+		jww.ERROR.Printf("unable to output full NDF file: %+v", err)
 	}
 
 	// Marshal signed partial NDF
@@ -468,21 +1024,28 @@ func (s *NetworkState) UpdateOutputNdf() (err error) {
 	// Base64 encode the signed marshaled NDF
 	signedPartialEncoded := base64.StdEncoding.EncodeToString(signedPartialNdfMarshal)
 
-	// Output signed partial ndf to file
-	err = utils.WriteFile(s.signedPartialNdfOutputPath,
-		[]byte(signedPartialEncoded), utils.FilePerms, utils.DirPerms)
+	// Output signed partial ndf
+	err = s.signedPartialNdfOutput.Write([]byte(signedPartialEncoded))
 	if err != nil {
 		jww.ERROR.Printf("unable to output signed partial NDF to file: %+v", err)
 	}
 
 	jww.INFO.Printf("Full NDF updated to: %s", base64.StdEncoding.EncodeToString(s.fullNdf.GetHash()))
 
+	timing.Write = time.Since(phaseStart)
+	timing.Total = time.Since(timing.Start)
+	s.setNdfGenerationTiming(timing)
+	jww.DEBUG.Printf("Generated NDF of network %q in %s (prune: %s, "+
+		"marshal: %s, sign: %s, write: %s)", s.network, timing.Total,
+		timing.Prune, timing.Marshal, timing.Sign, timing.Write)
+
 	return nil
 }
 
-// GetPrivateKey returns the server's private key.
+// GetPrivateKey returns the server's active signing key.
 func (s *NetworkState) GetPrivateKey() *rsa.PrivateKey {
-	return s.rsaPrivateKey
+	key, _ := s.getSigningKey()
+	return key
 }
 
 // Get the elliptic curve private key
@@ -495,6 +1058,31 @@ func (s *NetworkState) GetEllipticPublicKey() *ec.PublicKey {
 	return s.ellipticPrivateKey.GetPublic()
 }
 
+// GetSignedEllipticPublicKey returns the marshalled elliptic curve public key
+// signed with the active RSA signing key. The key is only signed again once
+// the signing key is rotated. Returns nil if it cannot be signed.
+func (s *NetworkState) GetSignedEllipticPublicKey() *SignedEllipticKey {
+	signingKey := s.GetPrivateKey()
+
+	s.signingKeys.mux.Lock()
+	defer s.signingKeys.mux.Unlock()
+
+	if s.signingKeys.ellipticKeySigner != signingKey {
+		signedKey := &SignedEllipticKey{
+			EllipticPubKey: s.ellipticPrivateKey.GetPublic().Marshal(),
+		}
+		err := signature.SignRsa(signedKey, signingKey)
+		if err != nil {
+			jww.ERROR.Printf("Failed to sign elliptic public key: %+v", err)
+			return nil
+		}
+		s.signingKeys.signedEllipticKey = signedKey
+		s.signingKeys.ellipticKeySigner = signingKey
+	}
+
+	return s.signingKeys.signedEllipticKey
+}
+
 // GetRoundMap returns the map of rounds.
 func (s *NetworkState) GetRoundMap() *round.StateMap {
 	return s.rounds
@@ -505,23 +1093,62 @@ func (s *NetworkState) GetNodeMap() *node.StateMap {
 	return s.nodes
 }
 
-// GetAddressSpaceSize returns the address space size
+// GetAddressSpaceSize returns the address space size active at the current
+// time.
 func (s *NetworkState) GetAddressSpaceSize() uint32 {
+	return s.getAddressSpaceSizeAt(time.Now())
+}
+
+// getAddressSpaceSizeAt returns the address space size active at the given
+// time, which is the most recent scheduled size that has taken effect by then.
+// If no scheduled size has taken effect, the size set by SetAddressSpaceSize is
+// returned.
+func (s *NetworkState) getAddressSpaceSizeAt(at time.Time) uint32 {
+	s.addressSpaceScheduleMux.RLock()
+	defer s.addressSpaceScheduleMux.RUnlock()
+
+	for i := len(s.addressSpaceSchedule) - 1; i >= 0; i-- {
+		if !s.addressSpaceSchedule[i].Timestamp.After(at) {
+			return uint32(s.addressSpaceSchedule[i].Size)
+		}
+	}
+
 	return atomic.LoadUint32(s.addressSpaceSize)
 }
 
-// SetAddressSpaceSize sets the address space size.
+// SetAddressSpaceSize sets the address space size used until the first
+// scheduled size takes effect.
 func (s *NetworkState) SetAddressSpaceSize(size uint32) {
 	atomic.StoreUint32(s.addressSpaceSize, size)
 }
 
+// SetAddressSpaceSchedule replaces the scheduled address space sizes. Each size
+// takes effect at its timestamp, so that a size change can be coordinated
+// across the network ahead of time.
+func (s *NetworkState) SetAddressSpaceSchedule(addressSpaces []ndf.AddressSpace) {
+	schedule := make([]ndf.AddressSpace, len(addressSpaces))
+	copy(schedule, addressSpaces)
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].Timestamp.Before(schedule[j].Timestamp)
+	})
+
+	s.addressSpaceScheduleMux.Lock()
+	s.addressSpaceSchedule = schedule
+	s.addressSpaceScheduleMux.Unlock()
+}
+
 // NodeUpdateNotification sends a notification to the control thread of an
-// update to a nodes state.
+// update to a nodes state. If the update channel is full, the notification is
+// dropped and recorded so that it can be found with GetDroppedUpdates.
 func (s *NetworkState) SendUpdateNotification(nun node.UpdateNotification) error {
 	select {
 	case s.update <- nun:
 		return nil
 	default:
+		s.droppedUpdates.add(nun, time.Now())
+		jww.WARN.Printf("Dropped update notification of node %s from %s to "+
+			"%s: update channel is full", nun.Node, nun.FromActivity,
+			nun.ToActivity)
 		return errors.New("Could not send update notification")
 	}
 }
@@ -531,10 +1158,83 @@ func (s *NetworkState) GetNodeUpdateChannel() <-chan node.UpdateNotification {
 	return s.update
 }
 
+// GetNodeSnapshots returns a snapshot of the state of every node in the
+// network, ordered by node ID, for diagnostics. The lock of each node is taken
+// in turn in ID order and released before the next is taken, so the snapshot
+// cannot deadlock with other holders of node locks and does not block the
+// scheduler for longer than a single copy. As a result, the snapshots of
+// different nodes may be taken at slightly different times.
+func (s *NetworkState) GetNodeSnapshots() []node.Snapshot {
+	nodeStates := s.getSortedNodeStates()
+
+	snapshots := make([]node.Snapshot, len(nodeStates))
+	for i, n := range nodeStates {
+		snapshots[i] = n.GetSnapshot()
+	}
+
+	return snapshots
+}
+
+// GetStuckNodes returns a snapshot of every node in the network, ordered by
+// node ID, that entered an activity of a round in progress and has not polled
+// or has not progressed to another activity for longer than the threshold.
+// Locks are taken as in GetNodeSnapshots.
+func (s *NetworkState) GetStuckNodes(threshold time.Duration) []node.Snapshot {
+	now := time.Now()
+	var snapshots []node.Snapshot
+	for _, n := range s.getSortedNodeStates() {
+		if n.IsStuck(threshold, now) {
+			snapshots = append(snapshots, n.GetSnapshot())
+		}
+	}
+
+	return snapshots
+}
+
+// GetNodeRound returns the ID of the round the node is currently in. Returns
+// false if the node is not in a round or is not in the network. The read locks
+// of the node map and then of the node are taken in turn.
+func (s *NetworkState) GetNodeRound(nid *id.ID) (id.Round, bool) {
+	n := s.nodes.GetNode(nid)
+	if n == nil {
+		return 0, false
+	}
+
+	inRound, r := n.GetCurrentRound()
+	if !inRound {
+		return 0, false
+	}
+	return r.GetRoundID(), true
+}
+
+// Helper to return the state of every node in the network ordered by node ID
+func (s *NetworkState) getSortedNodeStates() []*node.State {
+	nodeStates := s.nodes.GetNodeStates()
+	sort.Slice(nodeStates, func(i, j int) bool {
+		return bytes.Compare(
+			nodeStates[i].GetID().Bytes(), nodeStates[j].GetID().Bytes()) < 0
+	})
+	return nodeStates
+}
+
+// GetNetwork returns the name of the network; it is empty for the default
+// network.
+func (s *NetworkState) GetNetwork() string {
+	return s.network
+}
+
+// Helper to return the key in the State table for this network
+func (s *NetworkState) stateKey(key string) string {
+	if s.network == "" {
+		return key
+	}
+	return s.network + "/" + key
+}
+
 // Helper to set the roundId or updateId value
 func (s *NetworkState) setId(key string, newVal uint64) error {
 	err := PermissioningDb.UpsertState(&State{
-		Key:   key,
+		Key:   s.stateKey(key),
 		Value: strconv.FormatUint(newVal, 10),
 	})
 	if err != nil {
@@ -545,7 +1245,7 @@ func (s *NetworkState) setId(key string, newVal uint64) error {
 
 // Helper to return the RoundId or UpdateId depending on the given key
 func (s *NetworkState) get(key string) (uint64, error) {
-	roundIdStr, err := PermissioningDb.GetStateValue(key)
+	roundIdStr, err := PermissioningDb.GetStateValue(s.stateKey(key))
 	if err != nil {
 		return 0, errors.Errorf("Unable to obtain current %s: %+v", key, err)
 	}
@@ -559,7 +1259,7 @@ func (s *NetworkState) get(key string) (uint64, error) {
 
 // Helper to return the RoundId or UpdateId depending on the given key
 func (s *NetworkState) getEcKey() (string, error) {
-	ellipticKey, err := PermissioningDb.GetStateValue(EllipticKey)
+	ellipticKey, err := PermissioningDb.GetStateValue(s.stateKey(EllipticKey))
 	if err != nil {
 		return "", errors.Errorf("Unable to obtain current %s: %+v", EllipticKey, err)
 	}
@@ -570,7 +1270,7 @@ func (s *NetworkState) getEcKey() (string, error) {
 // Helper to set the elliptic key into the state table
 func (s *NetworkState) storeEcKey(newVal string) error {
 	err := PermissioningDb.UpsertState(&State{
-		Key:   EllipticKey,
+		Key:   s.stateKey(EllipticKey),
 		Value: newVal,
 	})
 	if err != nil {
@@ -579,21 +1279,23 @@ func (s *NetworkState) storeEcKey(newVal string) error {
 	return nil
 }
 
-// IncrementRoundID increments the round ID
+// IncrementRoundID increments the round ID. The new ID is stored atomically so
+// that it can be read by GetSnapshot.
 // THIS IS NOT THREAD SAFE. IT IS INTENDED TO ONLY BE CALLED BY THE SERIAL
 // SCHEDULING THREAD
 func (s *NetworkState) IncrementRoundID() (id.Round, error) {
 	oldRoundID := s.roundID
-	s.roundID = s.roundID + 1
+	atomic.StoreUint64((*uint64)(&s.roundID), uint64(oldRoundID+1))
 	return oldRoundID, s.setId(RoundIdKey, uint64(s.roundID))
 }
 
-// IncrementUpdateID increments the update ID
+// IncrementUpdateID increments the update ID. The new ID is stored atomically
+// so that it can be read by GetSnapshot.
 // THIS IS NOT THREAD SAFE. IT IS INTENDED TO ONLY BE CALLED BY THE SERIAL
 // SCHEDULING THREAD
 func (s *NetworkState) IncrementUpdateID() (uint64, error) {
 	oldUpdateID := s.updateID
-	s.updateID = s.updateID + 1
+	atomic.StoreUint64(&s.updateID, oldUpdateID+1)
 	return oldUpdateID, s.setId(UpdateIdKey, s.updateID)
 }
 
@@ -620,20 +1322,29 @@ func (s *NetworkState) CreateDisabledNodes(path string, interval time.Duration)
 	return err
 }
 
+// CreateDbDisabledNodes generates and sets a disabledNodes object that will
+// track the disabled Nodes list stored in the database. Used instead of
+// CreateDisabledNodes when several permissioning servers share the list.
+func (s *NetworkState) CreateDbDisabledNodes(interval time.Duration) error {
+	var err error
+	s.disabledNodesStates, err = generateDbDisabledNodes(interval, s.setDisabledNodes)
+	return err
+}
+
 // StartPollDisabledNodes starts the loop that polls for updates
 func (s *NetworkState) StartPollDisabledNodes(quitChan chan struct{}) {
 	s.disabledNodesStates.pollDisabledNodes(quitChan)
 }
 
-// outputNodeTopologyToJSON encodes the NodeTopology structure to JSON and
-// outputs it to the specified file path. An error is returned if the JSON
-// marshaling fails or if the JSON file cannot be created.
-func outputToJSON(ndfData *ndf.NetworkDefinition, filePath string) error {
-	// Generate JSON from structure
-	data, err := ndfData.Marshal()
+// outputNdf encodes the signed NDF message in the format and writes it to the
+// specified output. An error is returned if the encoding fails or if the
+// encoded NDF cannot be written.
+func outputNdf(ndfMsg *pb.NDF, format NdfFormat, output NdfOutput) error {
+	// Encode the NDF
+	data, err := format.Marshal(ndfMsg)
 	if err != nil {
 		return err
 	}
-	// Write JSON to file
-	return utils.WriteFile(filePath, data, utils.FilePerms, utils.DirPerms)
+	// Write the encoded NDF to output
+	return output.Write(data)
 }
@@ -0,0 +1,191 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles checkpointing the essentials of the NetworkState to a local file
+
+package storage
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/utils"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// stateSnapshotVersion is the current version of the serialized StateSnapshot.
+// It must be incremented when the serialized format changes.
+const stateSnapshotVersion = 0
+
+// StateSnapshot is a checkpoint of the essentials of a NetworkState, written
+// to a local file so that the state can be recovered after a crash without
+// waiting on the database.
+type StateSnapshot struct {
+	Version   int
+	Network   string
+	Timestamp time.Time
+
+	RoundID          id.Round
+	UpdateID         uint64
+	AddressSpaceSize uint32
+
+	// Nodes in the prune list; Pruned is true for a Node pruned from the NDF
+	// and false for a stale Node that remains in the NDF
+	PruneList []PrunedNode
+}
+
+// PrunedNode is an entry of the prune list in a StateSnapshot.
+type PrunedNode struct {
+	ID     *id.ID
+	Pruned bool
+}
+
+// GetSnapshot returns a StateSnapshot of the current state.
+func (s *NetworkState) GetSnapshot() *StateSnapshot {
+	snapshot := &StateSnapshot{
+		Version:          stateSnapshotVersion,
+		Network:          s.network,
+		Timestamp:        time.Now(),
+		RoundID:          id.Round(atomic.LoadUint64((*uint64)(&s.roundID))),
+		UpdateID:         atomic.LoadUint64(&s.updateID),
+		AddressSpaceSize: atomic.LoadUint32(s.addressSpaceSize),
+	}
+
+	for nid, pruned := range s.GetPruneListSnapshot() {
+		nid := nid
+		snapshot.PruneList = append(snapshot.PruneList,
+			PrunedNode{ID: &nid, Pruned: pruned})
+	}
+
+	return snapshot
+}
+
+// WriteSnapshot writes a StateSnapshot of the current state to the path. The
+// snapshot is written to a temporary file that replaces the file at the path,
+// so that a crash while writing never leaves a partial snapshot.
+func (s *NetworkState) WriteSnapshot(path string) error {
+	data, err := json.Marshal(s.GetSnapshot())
+	if err != nil {
+		return errors.Errorf("Failed to marshal state snapshot: %+v", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, utils.DirPerms); err != nil {
+		return errors.Errorf("Failed to create directory %s for state "+
+			"snapshot: %+v", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return errors.Errorf("Failed to create temporary state snapshot: %+v",
+			err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), utils.FilePerms)
+	}
+	if err != nil {
+		return errors.Errorf("Failed to write state snapshot: %+v", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return errors.Errorf("Failed to replace state snapshot %s: %+v",
+			path, err)
+	}
+	return nil
+}
+
+// ReadStateSnapshot reads the StateSnapshot written to the path. Returns nil
+// without an error if no snapshot has been written.
+func ReadStateSnapshot(path string) (*StateSnapshot, error) {
+	if !utils.Exists(path) {
+		return nil, nil
+	}
+
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("Failed to read state snapshot: %+v", err)
+	}
+
+	snapshot := &StateSnapshot{}
+	if err = json.Unmarshal(data, snapshot); err != nil {
+		return nil, errors.Errorf("Failed to unmarshal state snapshot: %+v",
+			err)
+	} else if snapshot.Version != stateSnapshotVersion {
+		return nil, errors.Errorf("State snapshot has version %d, expected "+
+			"version %d", snapshot.Version, stateSnapshotVersion)
+	}
+	return snapshot, nil
+}
+
+// RestoreSnapshot restores the state from a StateSnapshot taken by this
+// network. The snapshot is only restored if it is not behind the round and
+// update IDs loaded from the database; otherwise, it is stale and ignored. The
+// round and update IDs are stored in the database if they are ahead of it, the
+// Nodes in the snapshot's prune list are added to the prune list, and the
+// address space size is set. Returns true if the snapshot was restored. Must be
+// called before scheduling starts.
+func (s *NetworkState) RestoreSnapshot(snapshot *StateSnapshot) (bool, error) {
+	if snapshot.Network != s.network {
+		return false, errors.Errorf("State snapshot of network %q cannot "+
+			"be restored to network %q", snapshot.Network, s.network)
+	}
+
+	if snapshot.RoundID < s.roundID || snapshot.UpdateID < s.updateID {
+		jww.WARN.Printf("Ignoring state snapshot of network %q taken at %s: "+
+			"round ID %d and update ID %d are behind the database's %d and "+
+			"%d", s.network, snapshot.Timestamp, snapshot.RoundID,
+			snapshot.UpdateID, s.roundID, s.updateID)
+		return false, nil
+	}
+
+	if snapshot.RoundID > s.roundID {
+		if err := s.setId(RoundIdKey, uint64(snapshot.RoundID)); err != nil {
+			return false, err
+		}
+		atomic.StoreUint64((*uint64)(&s.roundID), uint64(snapshot.RoundID))
+	}
+	if snapshot.UpdateID > s.updateID {
+		if err := s.setId(UpdateIdKey, snapshot.UpdateID); err != nil {
+			return false, err
+		}
+		atomic.StoreUint64(&s.updateID, snapshot.UpdateID)
+	}
+
+	s.pruneListMux.Lock()
+	for _, entry := range snapshot.PruneList {
+		if entry.ID == nil {
+			continue
+		}
+		// A Node pruned since the snapshot stays pruned
+		s.pruneList[*entry.ID] = s.pruneList[*entry.ID] || entry.Pruned
+	}
+	s.pruneListMux.Unlock()
+
+	s.SetAddressSpaceSize(snapshot.AddressSpaceSize)
+
+	jww.INFO.Printf("Restored state snapshot of network %q taken at %s: "+
+		"round ID %d, update ID %d, %d nodes in the prune list",
+		s.network, snapshot.Timestamp, snapshot.RoundID, snapshot.UpdateID,
+		len(snapshot.PruneList))
+	return true, nil
+}
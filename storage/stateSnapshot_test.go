@@ -0,0 +1,169 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that a snapshot written by WriteSnapshot() restores the round ID,
+// update ID, prune list, and address space size to the state created after a
+// restart whose database is behind the snapshot.
+func TestNetworkState_WriteSnapshot_RestoreSnapshot(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err = state.IncrementRoundID(); err != nil {
+			t.Fatalf("Failed to increment round ID: %+v", err)
+		}
+		if _, err = state.IncrementUpdateID(); err != nil {
+			t.Fatalf("Failed to increment update ID: %+v", err)
+		}
+	}
+	pruned := id.NewIdFromUInt(1, id.Node, t)
+	stale := id.NewIdFromUInt(2, id.Node, t)
+	state.SetPrunedNodes(map[id.ID]bool{*pruned: true, *stale: false})
+	state.SetAddressSpaceSize(12)
+	expected := state.GetSnapshot()
+
+	path := filepath.Join(t.TempDir(), "snapshots", "state.json")
+	if err = state.WriteSnapshot(path); err != nil {
+		t.Fatalf("WriteSnapshot() returned an error: %+v", err)
+	}
+
+	// Simulate a restart after the database lost the latest IDs
+	if err = state.setId(RoundIdKey, 2); err != nil {
+		t.Fatalf("Failed to rewind round ID: %+v", err)
+	}
+	if err = state.setId(UpdateIdKey, 2); err != nil {
+		t.Fatalf("Failed to rewind update ID: %+v", err)
+	}
+	restarted, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	snapshot, err := ReadStateSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadStateSnapshot() returned an error: %+v", err)
+	}
+	restored, err := restarted.RestoreSnapshot(snapshot)
+	if err != nil || !restored {
+		t.Fatalf("Snapshot not restored (%t): %+v", restored, err)
+	}
+
+	received := restarted.GetSnapshot()
+	if received.RoundID != expected.RoundID ||
+		received.UpdateID != expected.UpdateID ||
+		received.AddressSpaceSize != expected.AddressSpaceSize {
+		t.Errorf("Unexpected restored state.\n\texpected: round %d, update "+
+			"%d, address space %d\n\treceived: round %d, update %d, address "+
+			"space %d", expected.RoundID, expected.UpdateID,
+			expected.AddressSpaceSize, received.RoundID, received.UpdateID,
+			received.AddressSpaceSize)
+	}
+	if pruneList := restarted.GetPruneListSnapshot(); !reflect.DeepEqual(
+		map[id.ID]bool{*pruned: true, *stale: false}, pruneList) {
+		t.Errorf("Unexpected restored prune list: %v", pruneList)
+	}
+
+	// The restored IDs are stored in the database
+	roundID, err := restarted.GetRoundID()
+	if err != nil || roundID != expected.RoundID {
+		t.Errorf("Restored round ID not stored.\n\texpected: %d"+
+			"\n\treceived: %d (%+v)", expected.RoundID, roundID, err)
+	}
+	updateID, err := restarted.GetUpdateID()
+	if err != nil || updateID != expected.UpdateID {
+		t.Errorf("Restored update ID not stored.\n\texpected: %d"+
+			"\n\treceived: %d (%+v)", expected.UpdateID, updateID, err)
+	}
+
+	// Only the snapshot is left in the directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read snapshot directory: %+v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+		t.Errorf("Unexpected files in snapshot directory: %v", entries)
+	}
+}
+
+// Tests that RestoreSnapshot() ignores a snapshot that is behind the database
+// and rejects a snapshot of another network.
+func TestNetworkState_RestoreSnapshot_Stale(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err = state.WriteSnapshot(path); err != nil {
+		t.Fatalf("WriteSnapshot() returned an error: %+v", err)
+	}
+	if _, err = state.IncrementRoundID(); err != nil {
+		t.Fatalf("Failed to increment round ID: %+v", err)
+	}
+	state.SetAddressSpaceSize(12)
+	expected := state.GetSnapshot()
+
+	snapshot, err := ReadStateSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadStateSnapshot() returned an error: %+v", err)
+	}
+	restored, err := state.RestoreSnapshot(snapshot)
+	if err != nil || restored {
+		t.Errorf("Stale snapshot restored (%t): %+v", restored, err)
+	}
+	if received := state.GetSnapshot(); received.RoundID != expected.RoundID ||
+		received.AddressSpaceSize != expected.AddressSpaceSize {
+		t.Errorf("State changed by a stale snapshot.\n\texpected: %+v"+
+			"\n\treceived: %+v", expected, received)
+	}
+
+	snapshot.Network = "other"
+	if _, err = state.RestoreSnapshot(snapshot); err == nil {
+		t.Errorf("Snapshot of another network restored.")
+	}
+}
+
+// Tests that ReadStateSnapshot() returns nil when no snapshot has been written
+// and an error for a snapshot of an unknown version.
+func TestReadStateSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	snapshot, err := ReadStateSnapshot(path)
+	if err != nil || snapshot != nil {
+		t.Errorf("Unexpected snapshot read from a missing file: %+v, %+v",
+			snapshot, err)
+	}
+
+	err = os.WriteFile(path, []byte(`{"Version": 99}`), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %+v", err)
+	}
+	if _, err = ReadStateSnapshot(path); err == nil {
+		t.Errorf("Snapshot of an unknown version read.")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	gorsa "crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	pb "gitlab.com/elixxir/comms/mixmessages"
@@ -30,7 +31,9 @@ import (
 	mrand "math/rand"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -108,6 +111,78 @@ func TestNewState(t *testing.T) {
 	}
 }
 
+// Tests that NewNetworkState() stores the round ID and elliptic key of each
+// network separately so that networks sharing a database do not interfere.
+func TestNewNetworkState_SeparateNetworks(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %+v", err)
+	}
+
+	defaultState, err := NewState(privateKey, 8, "", "", region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("NewState() produced an unexpected error: %+v", err)
+	}
+	testState, err := NewNetworkState("testnet", privateKey, 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("NewNetworkState() produced an unexpected error: %+v", err)
+	}
+
+	if defaultState.GetNetwork() != "" || testState.GetNetwork() != "testnet" {
+		t.Errorf("Unexpected network names.\n\texpected: %q, %q"+
+			"\n\treceived: %q, %q", "", "testnet", defaultState.GetNetwork(),
+			testState.GetNetwork())
+	}
+
+	// Incrementing the round ID of one network does not affect the other
+	for i := 0; i < 3; i++ {
+		_, err = testState.IncrementRoundID()
+		if err != nil {
+			t.Fatalf("Failed to increment round ID: %+v", err)
+		}
+	}
+	defaultRoundID, err := defaultState.GetRoundID()
+	if err != nil {
+		t.Fatalf("Failed to get round ID: %+v", err)
+	}
+	testRoundID, err := testState.GetRoundID()
+	if err != nil {
+		t.Fatalf("Failed to get round ID: %+v", err)
+	}
+	if defaultRoundID != 1 || testRoundID != 4 {
+		t.Errorf("Unexpected round IDs.\n\texpected: %d, %d"+
+			"\n\treceived: %d, %d", 1, 4, defaultRoundID, testRoundID)
+	}
+
+	// Each network has its own elliptic key
+	if reflect.DeepEqual(defaultState.GetEllipticPublicKey().Marshal(),
+		testState.GetEllipticPublicKey().Marshal()) {
+		t.Errorf("Networks share the same elliptic key.")
+	}
+
+	// Reloading a network restores its stored values
+	reloaded, err := NewNetworkState("testnet", privateKey, 8, "", "",
+		region.GetCountryBins())
+	if err != nil {
+		t.Fatalf("NewNetworkState() produced an unexpected error: %+v", err)
+	}
+	if reloaded.roundID != testRoundID {
+		t.Errorf("Reloaded network has the wrong round ID."+
+			"\n\texpected: %d\n\treceived: %d", testRoundID, reloaded.roundID)
+	}
+	if !reflect.DeepEqual(reloaded.GetEllipticPublicKey().Marshal(),
+		testState.GetEllipticPublicKey().Marshal()) {
+		t.Errorf("Reloaded network has the wrong elliptic key.")
+	}
+}
+
 // Tests that GetFullNdf() returns the correct NDF for a newly created
 // NetworkState.
 func TestNetworkState_GetFullNdf(t *testing.T) {
@@ -198,6 +273,61 @@ func TestNetworkState_GetUpdates(t *testing.T) {
 	}
 }
 
+// Tests that GetRoundUpdateHistory() returns every update of a round driven
+// through its states, in order, without the updates of other rounds.
+func TestNetworkState_GetRoundUpdateHistory(t *testing.T) {
+	state := newRoundAdderTestState(0, t)
+
+	const roundId, otherRoundId = 42, 43
+	lifecycle := []states.Round{states.PENDING, states.PRECOMPUTING,
+		states.STANDBY, states.QUEUED, states.REALTIME, states.COMPLETED}
+	firstID := state.roundUpdates.GetLastUpdateID()
+	for _, roundState := range lifecycle {
+		for _, rid := range []uint64{roundId, otherRoundId} {
+			err := state.AddRoundUpdate(&pb.RoundInfo{
+				ID:         rid,
+				State:      uint32(roundState),
+				Timestamps: make([]uint64, states.NUM_STATES),
+			})
+			if err != nil {
+				t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+			}
+		}
+	}
+	waitForLastUpdateID(state, firstID+2*len(lifecycle), t)
+
+	history, err := state.GetRoundUpdateHistory(roundId)
+	if err != nil {
+		t.Fatalf("GetRoundUpdateHistory() produced an error: %+v", err)
+	}
+	if len(history) != len(lifecycle) {
+		t.Fatalf("Unexpected number of updates.\n\texpected: %d"+
+			"\n\treceived: %d", len(lifecycle), len(history))
+	}
+	for i, update := range history {
+		if update.ID != roundId || states.Round(update.State) != lifecycle[i] {
+			t.Errorf("Unexpected update %d.\n\texpected: round %d in %s"+
+				"\n\treceived: round %d in %s", i, roundId, lifecycle[i],
+				update.ID, states.Round(update.State))
+		}
+		if i > 0 && update.UpdateID <= history[i-1].UpdateID {
+			t.Errorf("Update %d added after update %d.",
+				update.UpdateID, history[i-1].UpdateID)
+		}
+	}
+}
+
+// Error path: Tests that GetRoundUpdateHistory() returns an error for a round
+// without updates.
+func TestNetworkState_GetRoundUpdateHistory_UnknownRound(t *testing.T) {
+	state := newRoundAdderTestState(0, t)
+
+	if _, err := state.GetRoundUpdateHistory(42); err == nil {
+		t.Error("GetRoundUpdateHistory() did not return an error for a " +
+			"round without updates.")
+	}
+}
+
 // Tests that AddRoundUpdate() by adding a round, checking that it is correct
 // and verifying the signature.
 func TestNetworkState_AddRoundUpdate(t *testing.T) {
@@ -255,6 +385,243 @@ func TestNetworkState_AddRoundUpdate(t *testing.T) {
 	}
 }
 
+// Tests that RoundAdderRoutine() skips an update ID that is never received once
+// the gap timeout elapses and still adds the later updates in order.
+func TestNetworkState_RoundAdderRoutine_SkipGap(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state.SetRoundUpdateGapTimeout(50 * time.Millisecond)
+
+	// Lose an update ID, as if its signing goroutine had failed
+	lostID, err := state.IncrementUpdateID()
+	if err != nil {
+		t.Fatalf("Failed to increment update ID: %+v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = state.AddRoundUpdate(&pb.RoundInfo{
+			ID:         uint64(i + 1),
+			Timestamps: make([]uint64, states.FAILED),
+		})
+		if err != nil {
+			t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+		}
+	}
+
+	// The updates after the gap are only added once the gap is skipped
+	time.Sleep(20 * time.Millisecond)
+	if lastID := state.roundUpdates.GetLastUpdateID(); lastID >= int(lostID) {
+		t.Errorf("Updates after the gap were added before the gap was skipped."+
+			"\n\tlast update ID: %d", lastID)
+	}
+
+	timeout := time.After(time.Second)
+	for state.roundUpdates.GetLastUpdateID() != int(lostID+3) {
+		select {
+		case <-timeout:
+			t.Fatalf("Updates after the gap were never added."+
+				"\n\texpected last update ID: %d\n\treceived: %d",
+				lostID+3, state.roundUpdates.GetLastUpdateID())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	if skipped := state.GetNumSkippedRoundUpdates(); skipped != 1 {
+		t.Errorf("Unexpected number of skipped round updates."+
+			"\n\texpected: %d\n\treceived: %d", 1, skipped)
+	}
+
+	updates, err := state.GetUpdates(int(lostID))
+	if err != nil {
+		t.Fatalf("GetUpdates() produced an error: %+v", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("Unexpected number of updates.\n\texpected: %d"+
+			"\n\treceived: %d", 3, len(updates))
+	}
+	for i, update := range updates {
+		if update.ID != uint64(i+1) || update.UpdateID != lostID+uint64(i+1) {
+			t.Errorf("Update %d out of order.\n\treceived: round %d, "+
+				"update %d", i, update.ID, update.UpdateID)
+		}
+	}
+}
+
+// newRoundAdderTestState returns a NetworkState whose RoundAdderRoutine holds
+// at most maxPending updates and never skips a gap because of the timeout.
+func newRoundAdderTestState(maxPending int, t *testing.T) *NetworkState {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state.SetRoundUpdateGapTimeout(time.Hour)
+	state.SetMaxFutureRoundUpdates(maxPending)
+	return state
+}
+
+// sendRoundUpdates sends round updates with the update IDs directly to the
+// RoundAdderRoutine in the order given.
+func sendRoundUpdates(state *NetworkState, updateIDs ...uint64) {
+	for _, updateID := range updateIDs {
+		state.roundUpdatesToAddCh <- dataStructures.NewVerifiedRound(
+			&pb.RoundInfo{ID: updateID, UpdateID: updateID,
+				Timestamps: make([]uint64, states.NUM_STATES)},
+			state.GetPrivateKey().GetPublic())
+	}
+}
+
+// waitForLastUpdateID waits until the last added update ID is the expected ID.
+func waitForLastUpdateID(state *NetworkState, expected int, t *testing.T) {
+	timeout := time.After(time.Second)
+	for state.roundUpdates.GetLastUpdateID() != expected {
+		select {
+		case <-timeout:
+			t.Fatalf("Unexpected last update ID.\n\texpected: %d"+
+				"\n\treceived: %d", expected,
+				state.roundUpdates.GetLastUpdateID())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// checkRoundUpdateOrder checks that the added updates are in order.
+func checkRoundUpdateOrder(state *NetworkState, t *testing.T) {
+	updates := state.roundUpdates.GetUpdates(0)
+	for i := 1; i < len(updates); i++ {
+		if updates[i].UpdateID <= updates[i-1].UpdateID {
+			t.Errorf("Update %d added after update %d.",
+				updates[i].UpdateID, updates[i-1].UpdateID)
+		}
+	}
+}
+
+// Tests that RoundAdderRoutine() skips a large gap once the maximum number of
+// pending updates is exceeded, without waiting for the gap timeout, and drops
+// a skipped update received late.
+func TestNetworkState_RoundAdderRoutine_MaxFutureRoundUpdates(t *testing.T) {
+	const maxPending = 10
+	state := newRoundAdderTestState(maxPending, t)
+
+	// Updates 2 to 999 are missing
+	sendRoundUpdates(state, 1)
+	waitForLastUpdateID(state, 1, t)
+	for updateID := uint64(1000); updateID < 1000+maxPending; updateID++ {
+		sendRoundUpdates(state, updateID)
+	}
+
+	// The pending updates are held until the maximum is exceeded
+	time.Sleep(20 * time.Millisecond)
+	if lastID := state.roundUpdates.GetLastUpdateID(); lastID != 1 {
+		t.Errorf("Updates after the gap were added before the maximum was "+
+			"exceeded.\n\tlast update ID: %d", lastID)
+	}
+
+	sendRoundUpdates(state, 1000+maxPending, 1000+maxPending+1)
+	waitForLastUpdateID(state, 1000+maxPending+1, t)
+
+	if skipped := state.GetNumSkippedRoundUpdates(); skipped != 998 {
+		t.Errorf("Unexpected number of skipped round updates."+
+			"\n\texpected: %d\n\treceived: %d", 998, skipped)
+	}
+
+	// A skipped update received late is dropped
+	sendRoundUpdates(state, 500, 1000+maxPending+2)
+	waitForLastUpdateID(state, 1000+maxPending+2, t)
+	if _, err := state.roundUpdates.GetUpdate(500); err == nil {
+		t.Errorf("Skipped update received late was added.")
+	}
+
+	checkRoundUpdateOrder(state, t)
+}
+
+// Tests that RoundAdderRoutine() holds at most the maximum number of pending
+// updates when every other update is missing, skipping only the earliest gaps,
+// and recovers when a missing update is received.
+func TestNetworkState_RoundAdderRoutine_MaxFutureRoundUpdates_ManyGaps(t *testing.T) {
+	const maxPending = 5
+	state := newRoundAdderTestState(maxPending, t)
+
+	// Every even update ID is missing
+	sendRoundUpdates(state, 1)
+	for updateID := uint64(3); updateID <= 41; updateID += 2 {
+		sendRoundUpdates(state, updateID)
+	}
+
+	// Only the latest updates are held, all earlier gaps are skipped
+	waitForLastUpdateID(state, 31, t)
+	time.Sleep(20 * time.Millisecond)
+	if lastID := state.roundUpdates.GetLastUpdateID(); lastID != 31 {
+		t.Errorf("Unexpected last update ID once within the maximum."+
+			"\n\texpected: %d\n\treceived: %d", 31, lastID)
+	}
+	if skipped := state.GetNumSkippedRoundUpdates(); skipped != 15 {
+		t.Errorf("Unexpected number of skipped round updates."+
+			"\n\texpected: %d\n\treceived: %d", 15, skipped)
+	}
+
+	// The missing update at the current gap is added with the update after it
+	sendRoundUpdates(state, 32)
+	waitForLastUpdateID(state, 33, t)
+
+	checkRoundUpdateOrder(state, t)
+}
+
+// Tests that FlushRoundUpdates() returns once every round update added has been
+// signed and added to the round updates.
+func TestNetworkState_FlushRoundUpdates(t *testing.T) {
+	const numUpdates = 100
+	state := newRoundAdderTestState(0, t)
+
+	firstID := state.roundUpdates.GetLastUpdateID() + 1
+	for i := 0; i < numUpdates; i++ {
+		err := state.AddRoundUpdate(&pb.RoundInfo{
+			ID:         uint64(i + 1),
+			Timestamps: make([]uint64, states.FAILED),
+		})
+		if err != nil {
+			t.Fatalf("AddRoundUpdate() produced an error: %+v", err)
+		}
+	}
+
+	if err := state.FlushRoundUpdates(10 * time.Second); err != nil {
+		t.Fatalf("FlushRoundUpdates() produced an error: %+v", err)
+	}
+
+	expected := firstID + numUpdates - 1
+	if lastID := state.roundUpdates.GetLastUpdateID(); lastID != expected {
+		t.Errorf("Not all round updates were added before returning."+
+			"\n\texpected last update ID: %d\n\treceived: %d",
+			expected, lastID)
+	}
+}
+
+// Error path: Tests that FlushRoundUpdates() returns an error when an update is
+// still pending once the timeout is reached.
+func TestNetworkState_FlushRoundUpdates_Timeout(t *testing.T) {
+	state := newRoundAdderTestState(0, t)
+
+	// An update that is never received by the RoundAdderRoutine
+	atomic.AddInt64(state.pendingRoundUpdates, 1)
+
+	if err := state.FlushRoundUpdates(20 * time.Millisecond); err == nil {
+		t.Error("FlushRoundUpdates() did not return an error for a pending " +
+			"update.")
+	}
+}
+
 // Tests that UpdateInternalNdf() updates fullNdf and partialNdf correctly.
 func TestNetworkState_UpdateOutputNdf(t *testing.T) {
 	// Expected values
@@ -297,6 +664,8 @@ func TestNetworkState_UpdateOutputNdf(t *testing.T) {
 	if err != nil {
 		t.Fatalf("%+v", err)
 	}
+	testNDF.Registration.EllipticPubKey =
+		state.GetEllipticPublicKey().MarshalText()
 
 	// Update NDF
 	state.UpdateInternalNdf(testNDF)
@@ -345,11 +714,278 @@ func TestNetworkState_UpdateOutputNdf(t *testing.T) {
 	}
 }
 
+// Tests that UpdateOutputNdf() adds the network's EdDSA public key to the full
+// and partial NDFs when the internal NDF does not have it and that the NDF
+// hashes account for the key.
+func TestNetworkState_UpdateOutputNdf_EllipticPubKey(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	internalNdf := &ndf.NetworkDefinition{
+		Timestamp:    time.Now(),
+		Registration: ndf.Registration{Address: "registration"},
+		Nodes:        []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{
+			{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	}
+	state.UpdateInternalNdf(internalNdf)
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("UpdateOutputNdf() unexpectedly produced an error:\n%+v", err)
+	}
+
+	expected := state.GetEllipticPublicKey().MarshalText()
+	for name, outputNdf := range map[string]*dataStructures.Ndf{
+		"full":    state.GetFullNdf(),
+		"partial": state.GetPartialNdf(),
+	} {
+		received := outputNdf.Get().Registration.EllipticPubKey
+		if received != expected {
+			t.Errorf("The %s NDF does not contain the EdDSA public key."+
+				"\n\texpected: %s\n\treceived: %s", name, expected, received)
+		}
+	}
+
+	// The hash must differ from the hash of the NDF without the key
+	withoutKey := &pb.NDF{}
+	withoutKey.Ndf, err = internalNdf.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal NDF: %+v", err)
+	}
+	hashWithoutKey, err := dataStructures.GenerateNDFHash(withoutKey)
+	if err != nil {
+		t.Fatalf("Failed to hash NDF: %+v", err)
+	}
+	if bytes.Equal(hashWithoutKey, state.GetFullNdf().GetHash()) {
+		t.Errorf("Full NDF hash does not account for the EdDSA public key.")
+	}
+}
+
+// Tests that UpdateOutputNdf() signs the full and partial NDFs with both the
+// RSA and elliptic curve keys and that both signatures cover the same NDF.
+func TestNetworkState_UpdateOutputNdf_EccSignature(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if state.GetFullEccNdf() != nil || state.GetPartialEccNdf() != nil {
+		t.Errorf("EdDSA signed NDFs set before an NDF is output.")
+	}
+
+	state.UpdateInternalNdf(&ndf.NetworkDefinition{
+		Nodes:    []ndf.Node{{ID: id.NewIdFromUInt(0, id.Node, t).Bytes()}},
+		Gateways: []ndf.Gateway{{ID: id.NewIdFromUInt(0, id.Gateway, t).Bytes()}},
+	})
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("UpdateOutputNdf() unexpectedly produced an error:\n%+v", err)
+	}
+
+	for name, ndfs := range map[string]struct {
+		rsa *pb.NDF
+		ecc *EccSignedNdf
+	}{
+		"full":    {state.GetFullNdf().GetPb(), state.GetFullEccNdf()},
+		"partial": {state.GetPartialNdf().GetPb(), state.GetPartialEccNdf()},
+	} {
+		err = signature.VerifyRsa(ndfs.rsa, state.GetPrivateKey().GetPublic())
+		if err != nil {
+			t.Errorf("Failed to verify RSA signature of %s NDF: %+v", name, err)
+		}
+		err = signature.VerifyEddsa(ndfs.ecc, state.GetEllipticPublicKey())
+		if err != nil {
+			t.Errorf("Failed to verify EdDSA signature of %s NDF: %+v", name, err)
+		}
+		if !bytes.Equal(ndfs.rsa.Ndf, ndfs.ecc.Ndf) {
+			t.Errorf("RSA and EdDSA signed %s NDFs differ."+
+				"\n\trsa: %s\n\tecc: %s", name, ndfs.rsa.Ndf, ndfs.ecc.Ndf)
+		}
+	}
+}
+
+// Tests that UpdateOutputNdf() marks a Node whose gateway is unreachable as
+// GatewayUnreachable and blanks its gateway address while keeping each Gateway
+// at the index of its Node, while other Nodes remain Active and a stale Node
+// remains Stale. The statuses are checked in the full and partial NDFs as a
+// client unmarshalls them.
+func TestNetworkState_UpdateOutputNdf_UnreachableGateway(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testNDF := &ndf.NetworkDefinition{}
+	for i := uint64(0); i < 3; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		gwID := nid.DeepCopy()
+		gwID.SetType(id.Gateway)
+		testNDF.Nodes = append(testNDF.Nodes, ndf.Node{ID: nid.Bytes()})
+		testNDF.Gateways = append(testNDF.Gateways, ndf.Gateway{
+			ID: gwID.Bytes(), Address: fmt.Sprintf("%d.%d.%d.%d:22840", i, i, i, i)})
+	}
+
+	activeID := id.NewIdFromUInt(0, id.Node, t)
+	unreachableID := id.NewIdFromUInt(1, id.Node, t)
+	staleID := id.NewIdFromUInt(2, id.Node, t)
+	state.SetGatewayReachable(unreachableID, false)
+	state.SetGatewayReachable(staleID, false)
+	state.SetPrunedNodes(map[id.ID]bool{*staleID: false})
+
+	state.UpdateInternalNdf(testNDF)
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("UpdateOutputNdf() unexpectedly produced an error:\n%+v", err)
+	}
+
+	expectedStatus := map[id.ID]ndf.Status{
+		*activeID:      ndf.Active,
+		*unreachableID: GatewayUnreachable,
+		*staleID:       ndf.Stale,
+	}
+	for name, pbNdf := range map[string]*pb.NDF{
+		"full":    state.GetFullNdf().GetPb(),
+		"partial": state.GetPartialNdf().GetPb(),
+	} {
+		clientNdf, err := ndf.Unmarshal(pbNdf.Ndf)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %s NDF: %+v", name, err)
+		}
+		if len(clientNdf.Nodes) != len(expectedStatus) {
+			t.Fatalf("Unexpected number of nodes in the %s NDF."+
+				"\n\texpected: %d\n\treceived: %d",
+				name, len(expectedStatus), len(clientNdf.Nodes))
+		}
+		for _, n := range clientNdf.Nodes {
+			nid, _ := id.Unmarshal(n.ID)
+			if n.Status != expectedStatus[*nid] {
+				t.Errorf("Unexpected status for node %s in the %s NDF."+
+					"\n\texpected: %v\n\treceived: %v",
+					nid, name, expectedStatus[*nid], n.Status)
+			}
+		}
+	}
+
+	output := state.GetFullNdf().Get()
+	if len(output.Gateways) != len(output.Nodes) {
+		t.Fatalf("Unexpected number of gateways in the NDF."+
+			"\n\texpected: %d\n\treceived: %d",
+			len(output.Nodes), len(output.Gateways))
+	}
+	for i, expected := range testNDF.Gateways {
+		if i == 1 {
+			expected.Address = ""
+		}
+		if !bytes.Equal(expected.ID, output.Gateways[i].ID) ||
+			expected.Address != output.Gateways[i].Address {
+			t.Errorf("Unexpected gateway at index %d."+
+				"\n\texpected: %v %q\n\treceived: %v %q", i, expected.ID,
+				expected.Address, output.Gateways[i].ID,
+				output.Gateways[i].Address)
+		}
+	}
+}
+
+// Tests that PreviewOutputNdf() returns the NDF that UpdateOutputNdf() then
+// outputs, without modifying the output NDFs itself.
+func TestNetworkState_PreviewOutputNdf(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	testNDF := &ndf.NetworkDefinition{Timestamp: time.Now()}
+	for i := uint64(0); i < 4; i++ {
+		nid := id.NewIdFromUInt(i, id.Node, t)
+		gwID := nid.DeepCopy()
+		gwID.SetType(id.Gateway)
+		testNDF.Nodes = append(testNDF.Nodes, ndf.Node{ID: nid.Bytes()})
+		testNDF.Gateways = append(testNDF.Gateways, ndf.Gateway{
+			ID: gwID.Bytes(), Address: fmt.Sprintf("%d.%d.%d.%d:22840", i, i, i, i)})
+	}
+	state.SetPrunedNodes(map[id.ID]bool{
+		*id.NewIdFromUInt(1, id.Node, t): true,
+		*id.NewIdFromUInt(2, id.Node, t): false,
+	})
+	state.SetGatewayReachable(id.NewIdFromUInt(3, id.Node, t), false)
+	state.UpdateInternalNdf(testNDF)
+
+	preview, err := state.PreviewOutputNdf()
+	if err != nil {
+		t.Fatalf("PreviewOutputNdf() returned an error: %+v", err)
+	}
+	if len(state.GetFullNdf().Get().Nodes) != 0 {
+		t.Errorf("PreviewOutputNdf() modified the output NDF: %+v",
+			state.GetFullNdf().Get())
+	}
+
+	err = state.UpdateOutputNdf()
+	if err != nil {
+		t.Fatalf("UpdateOutputNdf() returned an error: %+v", err)
+	}
+
+	expected, err := state.GetFullNdf().Get().Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal full ndf: %+v", err)
+	}
+	received, err := preview.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal preview ndf: %+v", err)
+	}
+	if !bytes.Equal(expected, received) {
+		t.Errorf("PreviewOutputNdf() does not match the output NDF."+
+			"\n\texpected: %s\n\treceived: %s", expected, received)
+	}
+	if len(preview.Nodes) != 3 || len(preview.Gateways) != 3 {
+		t.Errorf("PreviewOutputNdf() did not prune the NDF."+
+			"\n\texpected: %d nodes, %d gateways"+
+			"\n\treceived: %d nodes, %d gateways",
+			3, 3, len(preview.Nodes), len(preview.Gateways))
+	}
+}
+
+// Error path: Tests that PreviewOutputNdf() returns an error when there is no
+// unpruned NDF.
+func TestNetworkState_PreviewOutputNdf_NoNdf(t *testing.T) {
+	state := &NetworkState{pruneList: make(map[id.ID]bool)}
+
+	_, err := state.PreviewOutputNdf()
+	if err == nil {
+		t.Errorf("PreviewOutputNdf() did not return an error without an NDF.")
+	}
+}
+
 // Tests that UpdateInternalNdf() generates an error when injected with invalid private
 // key.
 func TestNetworkState_UpdateOutputNdf_SignError(t *testing.T) {
 	// Expected values
-	testNDF := &ndf.NetworkDefinition{}
+	testNDF := withTestNode(&ndf.NetworkDefinition{})
 	expectedErr := "Unable to sign message: crypto/rsa: key size too small " +
 		"for PSS signature"
 	expectedErrNewGoVersion := fmt.Sprintf("Unable to sign message: %+v", gorsa.ErrMessageTooLong)
@@ -376,6 +1012,110 @@ func TestNetworkState_UpdateOutputNdf_SignError(t *testing.T) {
 	}
 }
 
+// Tests that UpdateOutputNdf() skips outputting an NDF without Nodes, with
+// mismatched Node and Gateway counts, or with a Node without an ID, keeping the
+// last valid NDF as the output.
+func TestNetworkState_UpdateOutputNdf_Invalid(t *testing.T) {
+	nodes := withTestNode(&ndf.NetworkDefinition{})
+	node, gateway := nodes.Nodes[0], nodes.Gateways[0]
+
+	tests := map[string]*ndf.NetworkDefinition{
+		"no nodes": {},
+		"missing gateway": {
+			Nodes:    []ndf.Node{node, node},
+			Gateways: []ndf.Gateway{gateway},
+		},
+		"missing node": {
+			Nodes:    []ndf.Node{node},
+			Gateways: []ndf.Gateway{gateway, gateway},
+		},
+		"node without ID": {
+			Nodes:    []ndf.Node{node, {Address: "address"}},
+			Gateways: []ndf.Gateway{gateway, gateway},
+		},
+	}
+
+	for name, invalidNdf := range tests {
+		state, output := newDebounceTestState(0, t)
+		changeNdf(state, "valid")
+		err := state.UpdateOutputNdf()
+		if err != nil {
+			t.Fatalf("Failed to output valid NDF (%s): %+v", name, err)
+		}
+		expectedHash := state.GetFullNdf().GetHash()
+
+		state.UpdateInternalNdf(invalidNdf)
+		err = state.UpdateOutputNdf()
+		if err != nil {
+			t.Errorf("UpdateOutputNdf() returned an error for an invalid "+
+				"NDF (%s): %+v", name, err)
+		}
+		if output.count() != 1 {
+			t.Errorf("Invalid NDF was written (%s).", name)
+		}
+		if !bytes.Equal(state.GetFullNdf().GetHash(), expectedHash) {
+			t.Errorf("Invalid NDF replaced the output NDF (%s).", name)
+		}
+	}
+}
+
+// Tests that UpdateOutputNdf() orders the Nodes of the output NDF by ID, with
+// each Gateway kept alongside its Node, so that the same Nodes added in
+// different orders produce the same NDF hash.
+func TestNetworkState_UpdateOutputNdf_NodeOrder(t *testing.T) {
+	timestamp := time.Now()
+	ndfInOrder := func(order ...uint64) *ndf.NetworkDefinition {
+		def := &ndf.NetworkDefinition{
+			Registration: ndf.Registration{Address: "address"},
+		}
+		for _, i := range order {
+			def.Nodes = append(def.Nodes, ndf.Node{
+				ID:      id.NewIdFromUInt(i, id.Node, t).Bytes(),
+				Address: fmt.Sprintf("node%d", i),
+			})
+			def.Gateways = append(def.Gateways, ndf.Gateway{
+				ID:      id.NewIdFromUInt(i, id.Gateway, t).Bytes(),
+				Address: fmt.Sprintf("gateway%d", i),
+			})
+		}
+		return def
+	}
+
+	states := make([]*NetworkState, 2)
+	for i, order := range [][]uint64{{2, 0, 1}, {1, 2, 0}} {
+		states[i], _ = newDebounceTestState(0, t)
+		states[i].ellipticPrivateKey = states[0].ellipticPrivateKey
+		states[i].SetNdfClock(func() time.Time { return timestamp })
+		states[i].UpdateInternalNdf(ndfInOrder(order...))
+		if err := states[i].UpdateOutputNdf(); err != nil {
+			t.Fatalf("Failed to output NDF %d: %+v", i, err)
+		}
+	}
+
+	if !bytes.Equal(states[0].GetFullNdf().GetHash(),
+		states[1].GetFullNdf().GetHash()) {
+		t.Errorf("Full NDFs of the same Nodes in different orders differ.")
+	}
+	if !bytes.Equal(states[0].GetPartialNdf().GetHash(),
+		states[1].GetPartialNdf().GetHash()) {
+		t.Errorf("Partial NDFs of the same Nodes in different orders differ.")
+	}
+
+	output := states[0].GetFullNdf().Get()
+	for i := range output.Nodes {
+		if i > 0 && bytes.Compare(output.Nodes[i-1].ID, output.Nodes[i].ID) >= 0 {
+			t.Errorf("Nodes %d and %d are not ordered by ID.", i-1, i)
+		}
+		expected := strings.Replace(output.Nodes[i].Address, "node",
+			"gateway", 1)
+		if output.Gateways[i].Address != expected {
+			t.Errorf("Gateway %d not kept with its Node."+
+				"\n\texpected: %s\n\treceived: %s", i, expected,
+				output.Gateways[i].Address)
+		}
+	}
+}
+
 // Tests that GetPrivateKey() returns the correct private key.
 func TestNetworkState_GetPrivateKey(t *testing.T) {
 	// Generate new private RSA key and NetworkState
@@ -430,6 +1170,252 @@ func TestNetworkState_GetNodeMap(t *testing.T) {
 	}
 }
 
+// Tests that getAddressSpaceSizeAt() returns the size set by
+// SetAddressSpaceSize() before the first scheduled size and each scheduled size
+// from exactly its timestamp until the next one takes effect.
+func TestNetworkState_getAddressSpaceSizeAt(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state.SetAddressSpaceSize(5)
+
+	start := time.Now()
+	state.SetAddressSpaceSchedule([]ndf.AddressSpace{
+		{Size: 32, Timestamp: start.Add(2 * time.Hour)},
+		{Size: 16, Timestamp: start.Add(time.Hour)},
+	})
+
+	tests := []struct {
+		at       time.Time
+		expected uint32
+	}{
+		{start, 5},
+		{start.Add(time.Hour - time.Nanosecond), 5},
+		{start.Add(time.Hour), 16},
+		{start.Add(2*time.Hour - time.Nanosecond), 16},
+		{start.Add(2 * time.Hour), 32},
+		{start.Add(3 * time.Hour), 32},
+	}
+
+	for i, tt := range tests {
+		if size := state.getAddressSpaceSizeAt(tt.at); size != tt.expected {
+			t.Errorf("Unexpected address space size at %s (%d)."+
+				"\n\texpected: %d\n\treceived: %d",
+				tt.at.Sub(start), i, tt.expected, size)
+		}
+	}
+
+	if size := state.GetAddressSpaceSize(); size != 5 {
+		t.Errorf("Unexpected current address space size."+
+			"\n\texpected: %d\n\treceived: %d", 5, size)
+	}
+}
+
+// Tests that GetNodeSnapshots() returns the state of every node, ordered by
+// ID, for nodes with different activities, rounds, and statuses.
+func TestNetworkState_GetNodeSnapshots(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Add the nodes out of order
+	nodeIds := make([]*id.ID, 4)
+	for i := len(nodeIds) - 1; i >= 0; i-- {
+		nodeIds[i] = id.NewIdFromUInt(uint64(i), id.Node, t)
+		err = state.GetNodeMap().AddNode(nodeIds[i], strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to add node %d: %+v", i, err)
+		}
+	}
+	nodes := make([]*node.State, len(nodeIds))
+	for i, nid := range nodeIds {
+		nodes[i] = state.GetNodeMap().GetNode(nid)
+	}
+
+	// Node 0 has not started, node 1 is waiting, node 2 is waiting in a round,
+	// and node 3 is banned
+	lastPoll := time.Unix(1000, 0)
+	for _, n := range nodes[1:3] {
+		if _, _, err = n.Update(current.WAITING); err != nil {
+			t.Fatalf("Failed to update node %s: %+v", n.GetID(), err)
+		}
+		n.IncrementNumPolls()
+		n.IncrementNumPolls()
+		n.SetLastPoll(lastPoll, t)
+	}
+	err = nodes[2].SetRound(round.NewState_Testing(42, 2, nil, t))
+	if err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	if _, err = nodes[3].Ban(); err != nil {
+		t.Fatalf("Failed to ban node: %+v", err)
+	}
+
+	rid := id.Round(42)
+	expected := []node.Snapshot{
+		{ID: nodeIds[0], Activity: current.NOT_STARTED.String(),
+			Status: node.Active.String(), LastPoll: time.Unix(0, 0)},
+		{ID: nodeIds[1], Activity: current.WAITING.String(),
+			Status: node.Active.String(), NumPolls: 2, LastPoll: lastPoll},
+		{ID: nodeIds[2], Activity: current.WAITING.String(),
+			Status: node.Active.String(), CurrentRound: &rid, NumPolls: 2,
+			LastPoll: lastPoll},
+		{ID: nodeIds[3], Activity: nodes[3].GetActivity().String(),
+			Status: node.Banned.String(), LastPoll: time.Unix(0, 0)},
+	}
+
+	snapshots := state.GetNodeSnapshots()
+	if !reflect.DeepEqual(expected, snapshots) {
+		t.Errorf("Unexpected node snapshots.\n\texpected: %+v\n\treceived: %+v",
+			expected, snapshots)
+	}
+
+	// The snapshots must be serializable for support tickets
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshots: %+v", err)
+	}
+	var unmarshalled []node.Snapshot
+	if err = json.Unmarshal(data, &unmarshalled); err != nil {
+		t.Fatalf("Failed to unmarshal snapshots: %+v", err)
+	}
+	if len(unmarshalled) != len(expected) ||
+		!unmarshalled[2].ID.Cmp(nodeIds[2]) ||
+		unmarshalled[2].CurrentRound == nil ||
+		*unmarshalled[2].CurrentRound != rid ||
+		unmarshalled[1].CurrentRound != nil {
+		t.Errorf("Snapshots did not survive JSON serialization."+
+			"\n\texpected: %+v\n\treceived: %+v", expected, unmarshalled)
+	}
+}
+
+// Tests that GetNodeRound() returns the round of a node in a round and no round
+// for nodes that are not in a round, including after the round is cleared.
+func TestNetworkState_GetNodeRound(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	inRoundId := id.NewIdFromUInt(0, id.Node, t)
+	idleId := id.NewIdFromUInt(1, id.Node, t)
+	for i, nid := range []*id.ID{inRoundId, idleId} {
+		err = state.GetNodeMap().AddNode(nid, strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to add node %d: %+v", i, err)
+		}
+	}
+	inRound := state.GetNodeMap().GetNode(inRoundId)
+	err = inRound.SetRound(round.NewState_Testing(42, 2, nil, t))
+	if err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+
+	if rid, ok := state.GetNodeRound(inRoundId); !ok || rid != 42 {
+		t.Errorf("Unexpected round of node in a round."+
+			"\n\texpected: %d\n\treceived: %d (%t)", 42, rid, ok)
+	}
+	if rid, ok := state.GetNodeRound(idleId); ok {
+		t.Errorf("Node not in a round reported in round %d.", rid)
+	}
+	if rid, ok := state.GetNodeRound(id.NewIdFromUInt(2, id.Node, t)); ok {
+		t.Errorf("Unknown node reported in round %d.", rid)
+	}
+
+	inRound.ClearRound()
+	if rid, ok := state.GetNodeRound(inRoundId); ok {
+		t.Errorf("Node reported in round %d after the round was cleared.", rid)
+	}
+}
+
+// Tests that GetStuckNodes() returns a node stalled in REALTIME once it has not
+// progressed for longer than the threshold, and never returns nodes outside of
+// a round.
+func TestNetworkState_GetStuckNodes(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	nodeIds := []*id.ID{id.NewIdFromUInt(0, id.Node, t),
+		id.NewIdFromUInt(1, id.Node, t)}
+	for i, nid := range nodeIds {
+		err = state.GetNodeMap().AddNode(nid, strconv.Itoa(i), "", "", 0)
+		if err != nil {
+			t.Fatalf("Failed to add node %d: %+v", i, err)
+		}
+	}
+	waiting := state.GetNodeMap().GetNode(nodeIds[0])
+	stalled := state.GetNodeMap().GetNode(nodeIds[1])
+
+	// Move one node through a round into REALTIME
+	for _, n := range []*node.State{waiting, stalled} {
+		if _, _, err = n.Update(current.WAITING); err != nil {
+			t.Fatalf("Failed to update node to WAITING: %+v", err)
+		}
+	}
+	r := round.NewState_Testing(42, states.PRECOMPUTING, nil, t)
+	if err = stalled.SetRound(r); err != nil {
+		t.Fatalf("Failed to set round: %+v", err)
+	}
+	for _, activity := range []current.Activity{
+		current.PRECOMPUTING, current.STANDBY} {
+		if _, _, err = stalled.Update(activity); err != nil {
+			t.Fatalf("Failed to update node to %s: %+v", activity, err)
+		}
+	}
+	if err = r.Update(states.REALTIME, time.Now()); err != nil {
+		t.Fatalf("Failed to update round: %+v", err)
+	}
+	if _, _, err = stalled.Update(current.REALTIME); err != nil {
+		t.Fatalf("Failed to update node to REALTIME: %+v", err)
+	}
+
+	threshold := time.Minute
+	if stuck := state.GetStuckNodes(threshold); len(stuck) != 0 {
+		t.Errorf("Nodes reported stuck before the threshold: %+v", stuck)
+	}
+
+	// Stall both nodes past the threshold
+	stalledSince := time.Now().Add(-2 * threshold)
+	for _, n := range []*node.State{waiting, stalled} {
+		n.SetLastPoll(stalledSince, t)
+		n.SetLastUpdate(stalledSince, t)
+	}
+
+	stuck := state.GetStuckNodes(threshold)
+	if len(stuck) != 1 || !stuck[0].ID.Cmp(nodeIds[1]) {
+		t.Fatalf("Expected only node %s to be stuck.\n\treceived: %+v",
+			nodeIds[1], stuck)
+	}
+	if stuck[0].Activity != current.REALTIME.String() ||
+		stuck[0].CurrentRound == nil || *stuck[0].CurrentRound != 42 {
+		t.Errorf("Unexpected snapshot of stuck node: %+v", stuck[0])
+	}
+}
+
 // Tests that NodeUpdateNotification() correctly sends an update to the update
 // channel and that GetNodeUpdateChannel() receives and returns it.
 func TestNetworkState_NodeUpdateNotification(t *testing.T) {
@@ -504,6 +1490,132 @@ func TestNetworkState_NodeUpdateNotification_Error(t *testing.T) {
 
 // generateTestNetworkState returns a newly generated NetworkState and private
 // key. Errors created by generating the key or NetworkState are returned.
+// withTestNode adds a Node and its Gateway to the NDF so that it is valid to
+// output and returns the NDF.
+// Tests that ReplaceInternalNdf() replaces the entire NDF and that the output
+// NDF is regenerated once and holds exactly the nodes and gateways of the new
+// NDF.
+func TestNetworkState_ReplaceInternalNdf(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	output := &countingOutput{}
+	state.SetNdfOutputs(output, &countingOutput{})
+
+	newTestNdf := func(address string, first, count uint64) *ndf.NetworkDefinition {
+		def := &ndf.NetworkDefinition{
+			Registration: ndf.Registration{Address: address}}
+		for i := first; i < first+count; i++ {
+			def.Nodes = append(def.Nodes, ndf.Node{
+				ID: id.NewIdFromUInt(i, id.Node, t).Bytes()})
+			def.Gateways = append(def.Gateways, ndf.Gateway{
+				ID: id.NewIdFromUInt(i, id.Gateway, t).Bytes()})
+		}
+		return def
+	}
+
+	for i, def := range []*ndf.NetworkDefinition{
+		newTestNdf("1.2.3.4:11420", 0, 2),
+		newTestNdf("5.6.7.8:11420", 5, 3),
+	} {
+		if err = state.ReplaceInternalNdf(def); err != nil {
+			t.Fatalf("ReplaceInternalNdf() returned an error (%d): %+v", i, err)
+		}
+		if output.count() != i+1 {
+			t.Errorf("Unexpected number of output NDF writes (%d)."+
+				"\n\texpected: %d\n\treceived: %d", i, i+1, output.count())
+		}
+
+		received := state.GetFullNdf().Get()
+		if received.Registration.Address != def.Registration.Address {
+			t.Errorf("Unexpected registration address (%d)."+
+				"\n\texpected: %s\n\treceived: %s", i,
+				def.Registration.Address, received.Registration.Address)
+		}
+		if len(received.Nodes) != len(def.Nodes) ||
+			len(received.Gateways) != len(def.Gateways) {
+			t.Fatalf("Unexpected number of nodes and gateways (%d)."+
+				"\n\texpected: %d, %d\n\treceived: %d, %d", i,
+				len(def.Nodes), len(def.Gateways),
+				len(received.Nodes), len(received.Gateways))
+		}
+		for j := range def.Nodes {
+			if !bytes.Equal(received.Nodes[j].ID, def.Nodes[j].ID) {
+				t.Errorf("Unexpected node %d (%d).\n\texpected: %v"+
+					"\n\treceived: %v", j, i, def.Nodes[j].ID,
+					received.Nodes[j].ID)
+			}
+			if !bytes.Equal(received.Gateways[j].ID, def.Gateways[j].ID) {
+				t.Errorf("Unexpected gateway %d (%d).\n\texpected: %v"+
+					"\n\treceived: %v", j, i, def.Gateways[j].ID,
+					received.Gateways[j].ID)
+			}
+		}
+	}
+}
+
+// Error path: Tests that ReplaceInternalNdf() rejects an invalid NDF and keeps
+// the current internal and output NDF.
+func TestNetworkState_ReplaceInternalNdf_InvalidNdf(t *testing.T) {
+	var err error
+	PermissioningDb, _, err = NewDatabase("", "", "", "", "")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	state, _, err := generateTestNetworkState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	output := &countingOutput{}
+	state.SetNdfOutputs(output, &countingOutput{})
+
+	err = state.ReplaceInternalNdf(withTestNode(&ndf.NetworkDefinition{
+		Registration: ndf.Registration{Address: "1.2.3.4:11420"}}))
+	if err != nil {
+		t.Fatalf("ReplaceInternalNdf() returned an error: %+v", err)
+	}
+	expected := state.GetFullNdf().Get()
+
+	invalid := []*ndf.NetworkDefinition{nil,
+		{Registration: ndf.Registration{Address: "5.6.7.8:11420"}}}
+	for i, def := range invalid {
+		if err = state.ReplaceInternalNdf(def); err == nil {
+			t.Errorf("ReplaceInternalNdf() did not reject invalid NDF %d.", i)
+		}
+	}
+
+	if output.count() != 1 {
+		t.Errorf("Output NDF written for an invalid NDF."+
+			"\n\texpected: %d\n\treceived: %d", 1, output.count())
+	}
+	if received := state.GetFullNdf().Get(); !reflect.DeepEqual(
+		expected, received) {
+		t.Errorf("Output NDF changed.\n\texpected: %+v\n\treceived: %+v",
+			expected, received)
+	}
+	if address := state.GetUnprunedNdf().Registration.Address; address !=
+		expected.Registration.Address {
+		t.Errorf("Internal NDF changed.\n\texpected: %s\n\treceived: %s",
+			expected.Registration.Address, address)
+	}
+}
+
+func withTestNode(def *ndf.NetworkDefinition) *ndf.NetworkDefinition {
+	nid := id.ID{1}
+	nid.SetType(id.Node)
+	gwID := nid.DeepCopy()
+	gwID.SetType(id.Gateway)
+	def.Nodes = append(def.Nodes, ndf.Node{ID: nid.Bytes()})
+	def.Gateways = append(def.Gateways, ndf.Gateway{ID: gwID.Bytes()})
+	return def
+}
+
 func generateTestNetworkState() (*NetworkState, *rsa.PrivateKey, error) {
 	// Generate new private RSA key
 	keyPath := testkeys.GetNodeKeyPath()
@@ -678,3 +1790,98 @@ func TestNetworkState_StartPollDisabledNodes(t *testing.T) {
 		t.Errorf("StartPollDisabledNodes() did not correctly stop when kill command sent.")
 	}
 }
+
+// Tests that GetPruneListSnapshot() returns pruned Nodes as true and disabled
+// Nodes as false, and that modifying the snapshot does not modify the state.
+func TestNetworkState_GetPruneListSnapshot(t *testing.T) {
+	state := &NetworkState{pruneList: make(map[id.ID]bool)}
+	prunedID := id.NewIdFromUInt(1, id.Node, t)
+	disabledID := id.NewIdFromUInt(2, id.Node, t)
+
+	state.SetPrunedNode(prunedID)
+	state.setPrunedNodesNoReset([]*id.ID{disabledID})
+
+	snapshot := state.GetPruneListSnapshot()
+	expected := map[id.ID]bool{*prunedID: true, *disabledID: false}
+	if !reflect.DeepEqual(expected, snapshot) {
+		t.Errorf("GetPruneListSnapshot() returned unexpected snapshot."+
+			"\n\texpected: %v\n\treceived: %v", expected, snapshot)
+	}
+
+	// Modify the snapshot and ensure the prune list is untouched
+	delete(snapshot, *prunedID)
+	snapshot[*id.NewIdFromUInt(3, id.Node, t)] = true
+	if !reflect.DeepEqual(expected, state.pruneList) {
+		t.Errorf("Modifying the snapshot modified the prune list."+
+			"\n\texpected: %v\n\treceived: %v", expected, state.pruneList)
+	}
+}
+
+// Tests that PruneNodes() prunes the Nodes, counting only those not already
+// pruned, and leaves disabled Nodes in the NDF.
+func TestNetworkState_PruneNodes(t *testing.T) {
+	disabledID := id.NewIdFromUInt(3, id.Node, t)
+	state := &NetworkState{
+		pruneList: make(map[id.ID]bool),
+		disabledNodesStates: &disabledNodes{
+			nodes: []*id.ID{disabledID},
+		},
+	}
+	prunedID := id.NewIdFromUInt(1, id.Node, t)
+	staleID := id.NewIdFromUInt(2, id.Node, t)
+	state.SetPrunedNode(prunedID)
+	state.setPrunedNodesNoReset([]*id.ID{staleID})
+
+	pruned := state.PruneNodes([]*id.ID{prunedID, staleID, disabledID,
+		id.NewIdFromUInt(4, id.Node, t)})
+	if pruned != 2 {
+		t.Errorf("Unexpected number of newly pruned Nodes."+
+			"\n\texpected: %d\n\treceived: %d", 2, pruned)
+	}
+
+	expected := map[id.ID]bool{*prunedID: true, *staleID: true,
+		*id.NewIdFromUInt(4, id.Node, t): true}
+	if !reflect.DeepEqual(expected, state.GetPruneListSnapshot()) {
+		t.Errorf("Unexpected prune list.\n\texpected: %v\n\treceived: %v",
+			expected, state.GetPruneListSnapshot())
+	}
+}
+
+// Tests that CountPrunedNodes() returns the correct number of pruned and stale
+// Nodes.
+func TestNetworkState_CountPrunedNodes(t *testing.T) {
+	state := &NetworkState{pruneList: make(map[id.ID]bool)}
+	state.SetPrunedNodes(map[id.ID]bool{
+		*id.NewIdFromUInt(1, id.Node, t): true,
+		*id.NewIdFromUInt(2, id.Node, t): true,
+		*id.NewIdFromUInt(3, id.Node, t): false,
+	})
+
+	pruned, stale := state.CountPrunedNodes()
+	if pruned != 2 || stale != 1 {
+		t.Errorf("CountPrunedNodes() returned unexpected counts."+
+			"\n\texpected: %d pruned, %d stale\n\treceived: %d pruned, %d stale",
+			2, 1, pruned, stale)
+	}
+}
+
+// Tests that SetGatewayReachable() marks and clears a Node's gateway as
+// unreachable.
+func TestNetworkState_SetGatewayReachable(t *testing.T) {
+	state := &NetworkState{unreachableGateways: make(map[id.ID]struct{})}
+	nid := id.NewIdFromUInt(1, id.Node, t)
+
+	if !state.IsGatewayReachable(nid) {
+		t.Errorf("Gateway reported unreachable before being marked.")
+	}
+
+	state.SetGatewayReachable(nid, false)
+	if state.IsGatewayReachable(nid) {
+		t.Errorf("Gateway reported reachable after being marked unreachable.")
+	}
+
+	state.SetGatewayReachable(nid, true)
+	if !state.IsGatewayReachable(nid) {
+		t.Errorf("Gateway reported unreachable after being marked reachable.")
+	}
+}